@@ -0,0 +1,406 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ctlAddr   string
+	ctlToken  string
+	ctlCert   string
+	ctlKey    string
+	ctlCACert string
+)
+
+func init() {
+	RootCmd.AddCommand(ctlCmd)
+	ctlCmd.AddCommand(ctlStatusCmd, ctlBackendsCmd, ctlSessionsCmd, ctlCacheCmd, ctlLockoutCmd, ctlApprovalsCmd, ctlLogCmd, ctlConfigCmd, ctlReloadCmd)
+	ctlBackendsCmd.AddCommand(ctlBackendsListCmd, ctlBackendsHealthCmd, ctlBackendsEnableCmd, ctlBackendsDisableCmd)
+	ctlLockoutCmd.AddCommand(ctlLockoutResetCmd)
+	ctlApprovalsCmd.AddCommand(ctlApprovalsListCmd, ctlApprovalsApproveCmd, ctlApprovalsRejectCmd)
+	ctlLogCmd.AddCommand(ctlLogLevelsCmd, ctlLogLevelCmd)
+	ctlSessionsCmd.AddCommand(ctlSessionsListCmd, ctlSessionsKillCmd)
+	ctlCacheCmd.AddCommand(ctlCacheFlushCmd, ctlCacheInvalidateCmd, ctlCacheStatsCmd)
+
+	ctlCmd.PersistentFlags().StringVar(&ctlAddr, "admin-addr", "http://localhost:8081", "the admin api of the proxy e.g. http://localhost:8081 or unix:/run/ldap-proxy.sock")
+	ctlCmd.PersistentFlags().StringVar(&ctlToken, "admin-token", os.Getenv("LDAP_PROXY_ADMIN_TOKEN"), "the bearer token for the admin api (default $LDAP_PROXY_ADMIN_TOKEN)")
+	ctlCmd.PersistentFlags().StringVar(&ctlCert, "admin-cert", "", "the client certificate for an https admin api")
+	ctlCmd.PersistentFlags().StringVar(&ctlKey, "admin-key", "", "the private key of the client certificate")
+	ctlCmd.PersistentFlags().StringVar(&ctlCACert, "admin-ca", "", "the ca verifying the certificate of an https admin api")
+}
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control a running proxy through its admin api",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the uptime, sessions and backends of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := adminClient().Status()
+		exitOnError(err)
+
+		fmt.Printf("started:  %s (up %s)\n", status.Started.Format(time.RFC3339), time.Since(status.Started).Truncate(time.Second))
+		fmt.Printf("sessions: %d\n", status.Sessions)
+		printBackends(status.Backends)
+	},
+}
+
+var ctlBackendsCmd = &cobra.Command{
+	Use:   "backends",
+	Short: "Manage the backends of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlBackendsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backends and whether they are enabled",
+	Run: func(cmd *cobra.Command, args []string) {
+		backends, err := adminClient().Backends()
+		exitOnError(err)
+
+		printBackends(backends)
+	},
+}
+
+var ctlBackendsHealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check the health of the enabled backends",
+	Run: func(cmd *cobra.Command, args []string) {
+		health, err := adminClient().Health()
+		exitOnError(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "BACKEND\tHEALTHY\tDURATION\tERROR")
+		for _, backend := range health {
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", backend.Name, backend.Healthy, backend.Duration, backend.Error)
+		}
+		w.Flush()
+	},
+}
+
+var ctlBackendsEnableCmd = &cobra.Command{
+	Use:   "enable [name]",
+	Short: "Enable a backend",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().EnableBackend(args[0]))
+	},
+}
+
+var ctlBackendsDisableCmd = &cobra.Command{
+	Use:   "disable [name]",
+	Short: "Disable a backend, it is neither asked to authenticate nor searched",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().DisableBackend(args[0]))
+	},
+}
+
+var ctlSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage the sessions of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlSessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the connected sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := adminClient().Sessions()
+		exitOnError(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDN\tREMOTE\tLISTENER\tBACKEND\tCONNECTED")
+		for _, session := range sessions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", session.Id, session.DN, session.RemoteAddr, session.Listener, session.Backend, session.Connected.Format(time.RFC3339))
+		}
+		w.Flush()
+	},
+}
+
+var ctlSessionsKillCmd = &cobra.Command{
+	Use:   "kill [id]",
+	Short: "Kill a session, its connection is closed with the next request",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		exitOnError(err)
+
+		exitOnError(adminClient().KillSession(id))
+	},
+}
+
+var ctlCacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the caches of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlCacheFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Drop all cached entries",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(adminClient().FlushCache())
+	},
+}
+
+var ctlCacheInvalidateCmd = &cobra.Command{
+	Use:   "invalidate [dn]",
+	Short: "Drop the cached binds and search results of an entry",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		entries, err := adminClient().InvalidateCache(args[0])
+		exitOnError(err)
+
+		fmt.Printf("dropped %d cached search results\n", entries)
+	},
+}
+
+var ctlCacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "List the caches with their size and lookups",
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := adminClient().CacheStats()
+		exitOnError(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CACHE\tENTRIES\tMAX\tTTL\tHITS\tMISSES")
+		for _, cache := range stats {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%d\n", cache.Name, cache.Entries, cache.MaxEntries, cache.TTL, cache.Hits, cache.Misses)
+		}
+		w.Flush()
+	},
+}
+
+var ctlLockoutCmd = &cobra.Command{
+	Use:   "lockout",
+	Short: "Manage the lockouts of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlLockoutResetCmd = &cobra.Command{
+	Use:   "reset [dn]",
+	Short: "Forget the failed binds of a dn and end its cooldown",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().ResetLockout(args[0]))
+	},
+}
+
+var ctlApprovalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "Decide on the sensitive operations waiting for approval",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlApprovalsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the operations waiting for approval",
+	Run: func(cmd *cobra.Command, args []string) {
+		approvals, err := adminClient().Approvals()
+		exitOnError(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tOPERATION\tDN\tBOUND DN\tATTRIBUTES")
+		for _, approval := range approvals {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", approval.Id, approval.Operation, approval.DN, approval.BoundDN, strings.Join(approval.Attributes, ","))
+		}
+		w.Flush()
+	},
+}
+
+var ctlApprovalsApproveCmd = &cobra.Command{
+	Use:   "approve [id]",
+	Short: "Forward a waiting operation",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().Approve(args[0]))
+	},
+}
+
+var ctlApprovalsRejectCmd = &cobra.Command{
+	Use:   "reject [id]",
+	Short: "Refuse a waiting operation",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().Reject(args[0]))
+	},
+}
+
+var ctlLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Manage the log levels of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var ctlLogLevelsCmd = &cobra.Command{
+	Use:   "levels",
+	Short: "List the overridden log levels",
+	Run: func(cmd *cobra.Command, args []string) {
+		levels, err := adminClient().LogLevels()
+		exitOnError(err)
+
+		components := make([]string, 0, len(levels))
+		for component := range levels {
+			components = append(components, component)
+		}
+		sort.Strings(components)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "COMPONENT\tLEVEL")
+		for _, component := range components {
+			fmt.Fprintf(w, "%s\t%s\n", component, levels[component])
+		}
+		w.Flush()
+	},
+}
+
+var ctlLogLevelCmd = &cobra.Command{
+	Use:   "level [component] [debug|info|off|default]",
+	Short: "Set the log level of a component, e.g. backend.ad, until the next start",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(adminClient().SetLogLevel(args[0], args[1]))
+	},
+}
+
+var ctlConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show the effective configuration with redacted credentials",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := adminClient().Config()
+		exitOnError(err)
+
+		var indented interface{}
+		exitOnError(json.Unmarshal(config, &indented))
+		out, err := json.MarshalIndent(indented, "", "  ")
+		exitOnError(err)
+
+		fmt.Println(string(out))
+	},
+}
+
+var ctlReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload the configuration of the proxy",
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(adminClient().Reload())
+	},
+}
+
+func adminClient() *admin.Client {
+	client := admin.NewClient(ctlAddr)
+	client.SetToken(ctlToken)
+
+	if ctlCert != "" || ctlCACert != "" {
+		config := &tls.Config{}
+
+		if ctlCert != "" {
+			cer, err := tls.LoadX509KeyPair(ctlCert, ctlKey)
+			exitOnError(err)
+			config.Certificates = []tls.Certificate{cer}
+		}
+
+		if ctlCACert != "" {
+			pem, err := ioutil.ReadFile(ctlCACert)
+			exitOnError(err)
+			config.RootCAs = x509.NewCertPool()
+			config.RootCAs.AppendCertsFromPEM(pem)
+		}
+
+		client.SetTLSConfig(config)
+	}
+
+	return client
+}
+
+func printBackends(backends []admin.Backend) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BACKEND\tENABLED")
+	for _, backend := range backends {
+		fmt.Fprintf(w, "%s\t%t\n", backend.Name, backend.Enabled)
+	}
+	w.Flush()
+}
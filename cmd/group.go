@@ -0,0 +1,131 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gopenguin/ldap-proxy/pkg/group"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var groupFile string
+
+func init() {
+	RootCmd.AddCommand(groupCmd)
+	groupCmd.AddCommand(groupListCmd, groupAddCmd, groupDeleteCmd, groupAddMemberCmd, groupRemoveMemberCmd)
+
+	groupCmd.PersistentFlags().StringVar(&groupFile, "file", "groups.json", "the file the proxy local groups are stored in")
+	groupAddCmd.Flags().String("description", "", "a description of the group")
+}
+
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage the proxy local groups served by the group backend",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var groupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all groups and their members",
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := openGroupBackend()
+
+		for _, g := range backend.Groups() {
+			fmt.Println(g.Name)
+			for _, member := range g.Members {
+				fmt.Println("  ", member)
+			}
+		}
+	},
+}
+
+var groupAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a new group",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		description, _ := cmd.Flags().GetString("description")
+
+		exitOnError(openGroupBackend().AddGroup(args[0], description))
+	},
+}
+
+var groupDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete a group",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(openGroupBackend().DeleteGroup(args[0]))
+	},
+}
+
+var groupAddMemberCmd = &cobra.Command{
+	Use:   "add-member [name] [member dn]",
+	Short: "Add a member to a group",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(openGroupBackend().AddMember(args[0], args[1]))
+	},
+}
+
+var groupRemoveMemberCmd = &cobra.Command{
+	Use:   "remove-member [name] [member dn]",
+	Short: "Remove a member from a group",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Help()
+			return
+		}
+
+		exitOnError(openGroupBackend().RemoveMember(args[0], args[1]))
+	},
+}
+
+func openGroupBackend() *group.Backend {
+	backend, err := group.NewBackend(&group.Config{}, group.NewFileStore(groupFile))
+	exitOnError(err)
+
+	return backend
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
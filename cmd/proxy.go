@@ -21,20 +21,30 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"crypto/tls"
+	"crypto/x509"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/changes"
 	"github.com/gopenguin/ldap-proxy/pkg/config"
+	"github.com/gopenguin/ldap-proxy/pkg/group"
+	"github.com/gopenguin/ldap-proxy/pkg/kubernetes"
 	"github.com/gopenguin/ldap-proxy/pkg/log"
 	"github.com/gopenguin/ldap-proxy/pkg/memory"
 	"github.com/gopenguin/ldap-proxy/pkg/postgres"
+	"github.com/gopenguin/ldap-proxy/pkg/static"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type proxyConfig struct {
@@ -46,6 +56,35 @@ type proxyConfig struct {
 
 	Prometheus     bool
 	PrometheusAddr string
+	ChangesStream  bool
+	AdminAddr      string
+	AdminCert      string
+	AdminKey       string
+	AdminClientCA  string
+
+	Kubernetes          bool
+	KubernetesNamespace string
+
+	ShutdownGracePeriod time.Duration
+
+	SearchConcurrency    int
+	MaxConnections       int
+	MaxConnectionsPerIP  int
+	BackendTimeout       time.Duration
+	SizeLimit            int
+	MaxFilterDepth       int
+	MaxFilterComponents  int
+	MaxFilterWildcards   int
+	TimeLimit            time.Duration
+	CoalesceSearches     bool
+	SessionAffinity      bool
+	ReadyAllBackends     bool
+	Monitor              bool
+	UnauthenticatedBinds bool
+	AccountStatus        bool
+	SessionAttributes    []string
+	MergeStrategy        string
+	AuthzIdFormat        string
 }
 
 // proxyCmd represents the proxy subcommand.
@@ -69,13 +108,41 @@ func proxyCmd() *cobra.Command {
 	}
 
 	proxyCmd.Flags().IntVarP(&c.Port, "port", "p", 10636, "port to listen on for secure ldap communication")
-	proxyCmd.Flags().StringVar(&c.Config, "config", "config.json", "configuration file for the backends in json format")
+	proxyCmd.Flags().StringVar(&c.Config, "config", "config.json", "configuration file for the backends in json, yaml (.yaml, .yml) or toml (.toml) format")
 
 	proxyCmd.Flags().StringVar(&c.ServerCert, "server-cert", "server.pem", "the server certificate")
 	proxyCmd.Flags().StringVar(&c.ServerKey, "server-key", "server-key.pem", "the servers private key")
 
 	proxyCmd.Flags().BoolVar(&c.Prometheus, "prometheus", false, "enable prometheus metrics")
 	proxyCmd.Flags().StringVar(&c.PrometheusAddr, "prometheus-addr", ":8080", "port to serve the prometheus metrics on")
+	proxyCmd.Flags().StringVar(&c.AdminAddr, "admin-addr", "", "address of the admin api e.g. localhost:8081 or unix:/run/ldap-proxy.sock (disabled if empty)")
+	proxyCmd.Flags().StringVar(&c.AdminCert, "admin-cert", "", "serve the admin api over https with the certificate")
+	proxyCmd.Flags().StringVar(&c.AdminKey, "admin-key", "", "the private key of the admin certificate")
+	proxyCmd.Flags().StringVar(&c.AdminClientCA, "admin-client-ca", "", "verify client certificates of the admin api with the ca, e.g. for the clientCerts of the admin config")
+	proxyCmd.Flags().BoolVar(&c.Kubernetes, "kubernetes", false, "operator mode: add the backends and listeners of the LdapProxyBackend and LdapProxyListener resources and reload on their changes")
+	proxyCmd.Flags().StringVar(&c.KubernetesNamespace, "kubernetes-namespace", "", "namespace of the resources in operator mode (the namespace of the pod if empty)")
+	proxyCmd.Flags().DurationVar(&c.ShutdownGracePeriod, "shutdown-grace-period", 20*time.Second, "time the requests in flight may take to finish on SIGTERM before they are canceled")
+	proxyCmd.Flags().BoolVar(&c.ChangesStream, "changes-stream", false, "stream directory changes as server-sent events on /changes of the admin api")
+
+	defaults := pkg.DefaultProxyConfig()
+	proxyCmd.Flags().IntVar(&c.SearchConcurrency, "search-concurrency", defaults.SearchConcurrency, "maximum number of backends searched concurrently (0 for all)")
+	proxyCmd.Flags().IntVar(&c.MaxConnections, "max-connections", defaults.MaxConnections, "maximum number of open connections (0 for unlimited)")
+	proxyCmd.Flags().IntVar(&c.MaxConnectionsPerIP, "max-connections-per-ip", defaults.MaxConnectionsPerIP, "maximum number of open connections of a single source ip (0 for unlimited)")
+	proxyCmd.Flags().DurationVar(&c.BackendTimeout, "backend-timeout", defaults.BackendTimeout, "deadline for a single backend call (0 to disable)")
+	proxyCmd.Flags().IntVar(&c.SizeLimit, "size-limit", defaults.SizeLimit, "maximum number of entries returned by a search, also if the client requests more (0 for unlimited)")
+	proxyCmd.Flags().IntVar(&c.MaxFilterDepth, "max-filter-depth", defaults.MaxFilterDepth, "maximum nesting depth of the and, or and not filters of a search (0 for unlimited)")
+	proxyCmd.Flags().IntVar(&c.MaxFilterComponents, "max-filter-components", defaults.MaxFilterComponents, "maximum number of components of a search filter (0 for unlimited)")
+	proxyCmd.Flags().IntVar(&c.MaxFilterWildcards, "max-filter-wildcards", defaults.MaxFilterWildcards, "maximum number of wildcards of a substring filter (0 for unlimited)")
+	proxyCmd.Flags().DurationVar(&c.TimeLimit, "time-limit", defaults.TimeLimit, "maximum duration of a search, also if the client requests more (0 for unlimited)")
+	proxyCmd.Flags().BoolVar(&c.CoalesceSearches, "coalesce-searches", defaults.CoalesceSearches, "answer identical concurrent searches of a backend with a single backend call")
+	proxyCmd.Flags().BoolVar(&c.SessionAffinity, "session-affinity", defaults.SessionAffinity, "only search the backend which authenticated the session")
+	proxyCmd.Flags().BoolVar(&c.ReadyAllBackends, "ready-all-backends", defaults.ReadyAllBackends, "only report ready on /readyz while all enabled backends pass their health checks instead of at least one")
+	proxyCmd.Flags().BoolVar(&c.Monitor, "monitor", defaults.Monitor, "serve the connection, operation and backend counters as cn=Monitor subtree like OpenLDAP")
+	proxyCmd.Flags().BoolVar(&c.UnauthenticatedBinds, "allow-unauthenticated-binds", defaults.UnauthenticatedBinds, "pass binds with a dn but without password to the backends instead of refusing them")
+	proxyCmd.Flags().BoolVar(&c.AccountStatus, "account-status", defaults.AccountStatus, "ask the backend refusing a bind whether the account is locked or disabled and stop asking the other backends")
+	proxyCmd.Flags().StringSliceVar(&c.SessionAttributes, "session-attributes", nil, "attributes of the bound entry fetched at bind time and kept for the session e.g. memberOf,department")
+	proxyCmd.Flags().StringVar(&c.AuthzIdFormat, "whoami-format", string(defaults.AuthzIdFormat), "how whoami returns the identity of a session: dn (dn:<dn>), u (u:<first rdn value>) or raw (the dn without prefix)")
+	proxyCmd.Flags().StringVar(&c.MergeStrategy, "merge-strategy", string(defaults.MergeStrategy), "how entries of multiple backends are combined: merge-all, first-backend-wins, merge-and-deduplicate or fail-on-conflict")
 
 	return proxyCmd
 }
@@ -85,32 +152,124 @@ func init() {
 }
 
 func runProxyFromConfigFile(c *proxyConfig) {
-	initPrometheus(c)
-
 	log.Printf("Loading Config from %s", c.Config)
-	f, err := os.Open(c.Config)
-	if err != nil {
-		log.Print(err)
-		os.Exit(1)
-	}
 
 	loader := config.NewLoader()
 
 	loader.AddFactory(memory.NewFactory())
 	loader.AddFactory(postgres.NewFactory())
+	loader.AddFactory(group.NewFactory())
+	loader.AddFactory(static.NewFactory())
 
-	reader := bufio.NewReader(f)
-	backends, err := loader.Load(reader)
+	mergeStrategy, err := pkg.ParseMergeStrategy(c.MergeStrategy)
 	if err != nil {
 		log.Print(err)
 		os.Exit(1)
 	}
 
-	tlsConfig := loadTlsConfig(c)
+	authzIdFormat, err := pkg.ParseAuthzIdFormat(c.AuthzIdFormat)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
 
 	proxy := pkg.NewLdapProxy()
-	proxy.AddBackend(backends...)
-	proxy.ListenAndServeTLS("tcp", fmt.Sprintf(":%d", c.Port), tlsConfig)
+	initPrometheus(c, proxy)
+
+	reloader := &reloader{
+		c:             c,
+		loader:        loader,
+		proxy:         proxy,
+		tlsConfig:     loadTlsConfig(c),
+		mergeStrategy: mergeStrategy,
+		authzIdFormat: authzIdFormat,
+		listeners:     make(map[string]*runningListener),
+	}
+
+	fileConfig, err := reloader.load()
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	reloader.apply(fileConfig)
+
+	initAdmin(c, reloader, fileConfig.Admin)
+	initKubernetes(c, reloader)
+
+	go reloader.reloadOnHangup()
+	go reloader.shutdownOnTerm()
+
+	proxy.ListenAndServeTLS("tcp", fmt.Sprintf(":%d", c.Port), reloader.tlsConfig)
+}
+
+// initKubernetes watches the backend and listener resources of the namespace
+// in operator mode
+func initKubernetes(c *proxyConfig, reloader *reloader) {
+	if !c.Kubernetes {
+		return
+	}
+
+	client, err := kubernetes.InClusterClient(c.KubernetesNamespace)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	log.Printf("Watching the %s and %s of namespace %s", kubernetes.BackendsResource, kubernetes.ListenersResource, client.Namespace)
+	go kubernetes.NewController(client, reloader.applyResources).Run(context.Background())
+}
+
+func newProxyConfig(c *proxyConfig, fileConfig *config.Config, mergeStrategy pkg.MergeStrategy, authzIdFormat pkg.AuthzIdFormat) pkg.ProxyConfig {
+	return pkg.ProxyConfig{
+		SearchConcurrency:    c.SearchConcurrency,
+		MaxConnections:       c.MaxConnections,
+		MaxConnectionsPerIP:  c.MaxConnectionsPerIP,
+		BackendTimeout:       c.BackendTimeout,
+		SizeLimit:            c.SizeLimit,
+		MaxFilterDepth:       c.MaxFilterDepth,
+		MaxFilterComponents:  c.MaxFilterComponents,
+		MaxFilterWildcards:   c.MaxFilterWildcards,
+		TimeLimit:            c.TimeLimit,
+		CoalesceSearches:     c.CoalesceSearches,
+		SessionAffinity:      c.SessionAffinity,
+		ReadyAllBackends:     c.ReadyAllBackends,
+		Monitor:              c.Monitor,
+		UnauthenticatedBinds: c.UnauthenticatedBinds,
+		AccountStatus:        c.AccountStatus,
+		SessionAttributes:    c.SessionAttributes,
+		BackendTimeouts:      fileConfig.BackendTimeouts,
+		BackendSizeLimits:    fileConfig.BackendSizeLimits,
+		FilterResults:        fileConfig.FilterResults,
+		Replicas:             fileConfig.Replicas,
+		NamingContexts:       fileConfig.NamingContexts,
+		Writable:             fileConfig.Writable,
+		Subschema:            fileConfig.Subschema,
+		Referrals:            fileConfig.Referrals,
+		ProtectedSubtrees:    fileConfig.ProtectedSubtrees,
+		Anonymous:            fileConfig.Anonymous,
+		ACL:                  fileConfig.ACL,
+		Redaction:            fileConfig.Redaction,
+		ValueRules:           fileConfig.ValueRules,
+		MergeStrategy:        mergeStrategy,
+		AuthzIdFormat:        authzIdFormat,
+		Approval:             fileConfig.Approval,
+		Anomaly:              fileConfig.Anomaly,
+		Lockout:              fileConfig.Lockout,
+		TOTP:                 fileConfig.TOTP,
+		MFA:                  fileConfig.MFA,
+		GeoIP:                fileConfig.GeoIP,
+		MemberOf:             fileConfig.MemberOf,
+		IPFilter:             fileConfig.IPFilter,
+		RateLimit:            fileConfig.RateLimit,
+		Audit:                fileConfig.Audit,
+		AuthLog:              fileConfig.AuthLog,
+		SearchCache:          fileConfig.SearchCache,
+		BindCache:            fileConfig.BindCache,
+		NegativeSearchCache:  fileConfig.NegativeSearchCache,
+		NegativeBindCache:    fileConfig.NegativeBindCache,
+		OfflineSearchCache:   fileConfig.OfflineSearchCache,
+		OfflineBindCache:     fileConfig.OfflineBindCache,
+	}
 }
 
 func loadTlsConfig(c *proxyConfig) *tls.Config {
@@ -125,7 +284,36 @@ func loadTlsConfig(c *proxyConfig) *tls.Config {
 	}
 }
 
-func initPrometheus(c *proxyConfig) {
+func loadAdminTlsConfig(c *proxyConfig) *tls.Config {
+	cer, err := tls.LoadX509KeyPair(c.AdminCert, c.AdminKey)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cer},
+	}
+
+	if c.AdminClientCA != "" {
+		pem, err := ioutil.ReadFile(c.AdminClientCA)
+		if err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			log.Printf("No certificates found in %s", c.AdminClientCA)
+			os.Exit(1)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config
+}
+
+func initPrometheus(c *proxyConfig, proxy *pkg.LdapProxy) {
 	if !c.Prometheus {
 		if c.PrometheusAddr != ":8080" {
 			log.Print("Prometheus wont be startet. Please also set the flag --prometheus")
@@ -135,7 +323,59 @@ func initPrometheus(c *proxyConfig) {
 	}
 
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/healthz", proxy.LivenessHandler())
+	http.Handle("/readyz", proxy.ReadinessHandler())
 
 	log.Print("Starting prometheus server on ", c.PrometheusAddr)
 	go http.ListenAndServe(c.PrometheusAddr, nil)
 }
+
+func initAdmin(c *proxyConfig, reloader *reloader, auth *admin.Auth) {
+	if c.AdminAddr == "" {
+		if c.ChangesStream {
+			log.Print("The changes wont be streamed. Please also set the flag --admin-addr")
+		}
+
+		return
+	}
+
+	network, addr := "tcp", c.AdminAddr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+		os.Remove(addr)
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	if c.AdminCert != "" {
+		listener = tls.NewListener(listener, loadAdminTlsConfig(c))
+	}
+
+	if auth == nil {
+		log.Print("The admin api is unauthenticated, configure tokens or client certificates with the admin key of the config")
+	}
+
+	server := &admin.Server{
+		Started:   time.Now(),
+		Auth:      auth,
+		Sessions:  reloader.proxy,
+		Backends:  reloader.proxy,
+		Cache:     reloader.proxy,
+		Health:    reloader.proxy,
+		Lockouts:  reloader.proxy,
+		Approvals: reloader.proxy,
+		LogLevels: reloader.proxy,
+		Config:    reloader.effective,
+		Reload:    reloader.reload,
+	}
+	if c.ChangesStream {
+		server.Changes = changes.Handler(changes.DefaultHub)
+	}
+
+	log.Print("Starting admin api on ", c.AdminAddr)
+	go http.Serve(listener, server.Handler())
+}
@@ -0,0 +1,185 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/config"
+	"github.com/gopenguin/ldap-proxy/pkg/kubernetes"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reloader applies the config file and the kubernetes resources to the
+// running proxy
+type reloader struct {
+	c             *proxyConfig
+	loader        *config.Loader
+	proxy         *pkg.LdapProxy
+	tlsConfig     *tls.Config
+	mergeStrategy pkg.MergeStrategy
+	authzIdFormat pkg.AuthzIdFormat
+
+	mutex     sync.Mutex
+	current   *config.Config
+	resources *kubernetes.Resources
+	listeners map[string]*runningListener
+}
+
+type runningListener struct {
+	config   config.Listener
+	listener *pkg.Listener
+}
+
+// load loads the config file with the backends and listeners of the
+// resources
+func (reloader *reloader) load() (*config.Config, error) {
+	f, err := os.Open(reloader.c.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resources := reloader.resources
+	if resources == nil {
+		resources = &kubernetes.Resources{}
+	}
+
+	return reloader.loader.LoadConfigWith(bufio.NewReader(f), config.FormatOf(reloader.c.Config), resources.Backends, resources.Listeners)
+}
+
+// apply replaces the backends, the settings and the listeners of the proxy.
+// Only the listeners added or changed are (re)started.
+func (reloader *reloader) apply(fileConfig *config.Config) {
+	if reloader.current != nil {
+		changes := config.Diff(reloader.current, fileConfig)
+		for _, change := range changes {
+			log.Printf("Config: %s", change)
+		}
+		if len(changes) == 0 {
+			log.Print("Config: no changes")
+		}
+	}
+
+	reloader.proxy.Reload(newProxyConfig(reloader.c, fileConfig, reloader.mergeStrategy, reloader.authzIdFormat), fileConfig.Backends...)
+
+	configured := make(map[string]config.Listener)
+	for _, listenerConfig := range fileConfig.Listeners {
+		configured[listenerConfig.Name] = listenerConfig
+	}
+	for name, running := range reloader.listeners {
+		if listenerConfig, ok := configured[name]; !ok || !listenerConfig.Equal(running.config) {
+			running.listener.Close()
+			delete(reloader.listeners, name)
+		}
+	}
+	for _, listenerConfig := range fileConfig.Listeners {
+		if _, ok := reloader.listeners[listenerConfig.Name]; ok {
+			continue
+		}
+
+		listener := reloader.proxy.NewListener(pkg.ListenerConfig{
+			Name:       listenerConfig.Name,
+			Masking:    listenerConfig.Masking,
+			IPFilter:   listenerConfig.IPFilter,
+			ValueRules: listenerConfig.ValueRules,
+		})
+		reloader.listeners[listenerConfig.Name] = &runningListener{config: listenerConfig, listener: listener}
+		go listener.ListenAndServeTLS("tcp", listenerConfig.Address, reloader.tlsConfig)
+	}
+
+	reloader.current = fileConfig
+}
+
+// reload loads and applies the config. A config failing to load keeps the
+// previous one.
+func (reloader *reloader) reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	log.Printf("Reloading Config from %s", reloader.c.Config)
+	fileConfig, err := reloader.load()
+	if err != nil {
+		log.Printf("Reloading the config failed, keeping the previous one: %v", err)
+		return err
+	}
+
+	reloader.apply(fileConfig)
+	return nil
+}
+
+// effective returns the applied config with redacted credentials for the
+// admin api
+func (reloader *reloader) effective() interface{} {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	return reloader.current.Effective()
+}
+
+// applyResources reloads the config with the backends and listeners of
+// changed kubernetes resources
+func (reloader *reloader) applyResources(resources *kubernetes.Resources) {
+	reloader.mutex.Lock()
+	reloader.resources = resources
+	reloader.mutex.Unlock()
+
+	log.Printf("Applying %d backend and %d listener resources", len(resources.Backends), len(resources.Listeners))
+	reloader.reload()
+}
+
+// reloadOnHangup reloads the config on SIGHUP
+func (reloader *reloader) reloadOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	for range hangups {
+		reloader.reload()
+	}
+}
+
+// shutdownOnTerm drains the proxy on SIGTERM or SIGINT. The listeners stop
+// accepting connections at once and the config isn't reloaded anymore.
+func (reloader *reloader) shutdownOnTerm() {
+	terms := make(chan os.Signal, 1)
+	signal.Notify(terms, syscall.SIGTERM, os.Interrupt)
+	<-terms
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	for _, running := range reloader.listeners {
+		running.listener.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reloader.c.ShutdownGracePeriod)
+	defer cancel()
+
+	if err := reloader.proxy.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+}
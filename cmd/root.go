@@ -35,9 +35,26 @@ var RootCmd = &cobra.Command{
 }
 
 func init() {
-	cobra.OnInitialize(log.Reinit)
+	cobra.OnInitialize(initLog)
 
 	RootCmd.PersistentFlags().BoolVar(&log.DebugEnabled, "debug", log.DebugEnabled, "enable debug logging")
+	RootCmd.PersistentFlags().StringVar(&log.Format, "log-format", log.Format, "the format of the log lines, either text or json")
+	RootCmd.PersistentFlags().StringSliceVar(&logLevels, "log-level", nil, "the log level of a component as component=level e.g. backend.ad=debug,cache=off, the levels are debug, info and off")
+}
+
+var logLevels []string
+
+func initLog() {
+	if !log.ValidFormat(log.Format) {
+		fmt.Printf("unknown log format %q\n", log.Format)
+		os.Exit(-1)
+	}
+	if err := log.SetLevels(logLevels); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	log.Reinit()
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
@@ -31,7 +31,11 @@ import (
 
 func TestExamplesLoadable(t *testing.T) {
 	wd, _ := os.Getwd()
-	matches, _ := filepath.Glob(filepath.Join(wd, "*.json"))
+	var matches []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.toml"} {
+		found, _ := filepath.Glob(filepath.Join(wd, pattern))
+		matches = append(matches, found...)
+	}
 
 	loader := config.NewLoader()
 	loader.AddFactory(memory.NewFactory())
@@ -47,7 +51,7 @@ func TestExamplesLoadable(t *testing.T) {
 		}
 		defer file.Close()
 
-		_, err = loader.Load(file)
+		_, err = loader.LoadConfigFormat(file, config.FormatOf(match))
 		if err != nil {
 			t.Log(err)
 			t.Fail()
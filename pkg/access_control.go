@@ -0,0 +1,98 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/acl"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// subject is the identity of the session for the access control, the groups
+// are the session attribute named by the policy
+func (ldapProxy *LdapProxy) subject(ctx context.Context) *acl.Subject {
+	return &acl.Subject{
+		DN:     getDn(ctx),
+		Groups: filter.Values(getAttributes(ctx), ldapProxy.config.ACL.GroupAttribute()),
+	}
+}
+
+// authorizeResults drops the entries the session may not read or not find
+// with the filter and the attributes it may not read. Entries matched by a
+// filter on attributes the session may not search would disclose their
+// values.
+func (ldapProxy *LdapProxy) authorizeResults(ctx context.Context, f ldap.Filter, users []*User) []*User {
+	policy := ldapProxy.config.ACL
+	if policy == nil {
+		return users
+	}
+
+	subject := ldapProxy.subject(ctx)
+	attributes := filter.Attributes(f)
+
+	var authorized []*User
+	for _, user := range users {
+		if !policy.Allowed(subject, acl.AccessRead, user.DN, "") || !searchable(policy, subject, user.DN, attributes) {
+			continue
+		}
+
+		authorized = append(authorized, &User{DN: user.DN, Attributes: policy.Readable(subject, user.DN, user.Attributes)})
+	}
+
+	return authorized
+}
+
+func searchable(policy *acl.Policy, subject *acl.Subject, dn string, attributes []string) bool {
+	for _, attribute := range attributes {
+		if !policy.Allowed(subject, acl.AccessSearch, dn, attribute) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorizeWrite returns the response refusing the write if the session may
+// not write the attributes of the entry. No attributes check the write access
+// to the entry itself, e.g. of a delete.
+func (ldapProxy *LdapProxy) authorizeWrite(ctx context.Context, sess *session, operation string, dn string, attributes []string) *ldap.BaseResponse {
+	policy := ldapProxy.config.ACL
+	if policy == nil {
+		return nil
+	}
+
+	subject := ldapProxy.subject(sess.context)
+	allowed := policy.Allowed(subject, acl.AccessWrite, dn, "")
+	for _, attribute := range attributes {
+		allowed = allowed && policy.Allowed(subject, acl.AccessWrite, dn, attribute)
+	}
+	if allowed {
+		return nil
+	}
+
+	auditLog.Printf("AUDIT: %s of %s by '%s' from %v refused by the access control%s", operation, dn, subject.DN, getRemoteAddr(sess.context), logRequestId(RequestId(ctx)))
+
+	return &ldap.BaseResponse{
+		Code:    ldap.ResultInsufficientAccessRights,
+		Message: "access denied",
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/acl"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_AccessControl(t *testing.T) {
+	Convey("Given a ldap proxy where only the admins may read the phone numbers", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"cn": {"John Doe"}, "mail": {"jdoe@example.com"}, "telephoneNumber": {"1234"}}},
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}}},
+		}})
+
+		policy, err := acl.New(&acl.Config{Rules: []acl.Rule{
+			{Who: []string{acl.WhoUsers}, Subtree: "ou=People,dc=example,dc=com", Attributes: []string{"cn", "mail"}, Access: []string{acl.AccessRead, acl.AccessSearch}},
+			{Who: []string{"group:cn=admins,ou=Groups,dc=example,dc=com"}, Subtree: "ou=People,dc=example,dc=com", Attributes: []string{"telephoneNumber"}, Access: []string{acl.AccessRead, acl.AccessSearch, acl.AccessWrite}},
+		}})
+		So(err, ShouldBeNil)
+
+		config := DefaultProxyConfig()
+		config.ACL = policy
+		proxy.Configure(config)
+
+		user := &session{context: setDn(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com")}
+		admin := &session{context: setAttributes(setDn(context.Background(), "uid=root,ou=People,dc=example,dc=com"), map[string][]string{"memberOf": {"cn=admins,ou=Groups,dc=example,dc=com"}})}
+
+		Convey("When a user searches", func() {
+			res, err := proxy.Search(user, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the names and mails of the people are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes, ShouldResemble, map[string][][]byte{"cn": {[]byte("John Doe")}, "mail": {[]byte("jdoe@example.com")}})
+			})
+		})
+
+		Convey("When a user filters by phone number", func() {
+			f, _ := filter.Parse("(telephoneNumber=1*)")
+			res, err := proxy.Search(user, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: f})
+
+			Convey("Then no entry is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an admin searches", func() {
+			res, err := proxy.Search(admin, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the phone numbers are returned as well", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes["telephoneNumber"], ShouldResemble, [][]byte{[]byte("1234")})
+			})
+		})
+
+		Convey("When a user modifies a phone number", func() {
+			res, err := proxy.Modify(user, &ldap.ModifyRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com", Mods: []*ldap.Mod{{Type: ldap.ModReplace, Name: "telephoneNumber", Values: [][]byte{[]byte("5678")}}}})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When a user deletes an entry", func() {
+			res, err := proxy.Delete(user, &ldap.DeleteRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com"})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When an admin modifies a phone number", func() {
+			res, err := proxy.Modify(admin, &ldap.ModifyRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com", Mods: []*ldap.Mod{{Type: ldap.ModReplace, Name: "telephoneNumber", Values: [][]byte{[]byte("5678")}}}})
+
+			Convey("Then the modify is passed on", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldNotEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/authlog"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"strconv"
+	"strings"
+)
+
+// The status of an account reported by the backend which refused its bind.
+// Active accounts have no status.
+const (
+	AccountActive   = ""
+	AccountLocked   = "locked"
+	AccountDisabled = "disabled"
+)
+
+// The bits of the active directory userAccountControl attribute
+const (
+	userAccountDisabled = 0x2
+	userAccountLockout  = 0x10
+)
+
+// An AccountStatusBackend reports the status of its accounts itself. The
+// entries of the other backends are checked for the attributes of active
+// directory, ppolicy and 389 ds.
+type AccountStatusBackend interface {
+	Backend
+	AccountStatus(ctx context.Context, username string) (status string, err error)
+}
+
+// accountStatus asks the backend which refused the bind of the dn whether the
+// account is locked or disabled. Errors are logged and leave the account
+// active, the bind is refused as invalid credentials then.
+func (ldapProxy *LdapProxy) accountStatus(ctx context.Context, backend Backend, dn string) string {
+	backendCtx, cancelBackend := ldapProxy.backendContext(ctx, backend, actionSearch)
+	defer cancelBackend()
+
+	if statusBackend, ok := backend.(AccountStatusBackend); ok {
+		status, err := statusBackend.AccountStatus(backendCtx, dn)
+		if err != nil {
+			log.Printf("backend %s failed reporting the account status of %s: %v", backend.Name(), dn, err)
+			return AccountActive
+		}
+		return status
+	}
+
+	f := rdnFilter(dn)
+	if f == nil {
+		return AccountActive
+	}
+
+	users, err := backend.GetUsers(backendCtx, f)
+	if err != nil {
+		log.Printf("backend %s failed looking up the account status of %s: %v", backend.Name(), dn, err)
+		return AccountActive
+	}
+
+	for _, user := range users {
+		if util.EqualDN(user.DN, dn) {
+			return entryAccountStatus(user.Attributes)
+		}
+	}
+
+	return AccountActive
+}
+
+// entryAccountStatus derives the account status from the attributes of the
+// entry. Disabled wins over locked as unlocking doesn't enable the account.
+func entryAccountStatus(attributes map[string][]string) string {
+	status := AccountActive
+	for _, value := range filter.Values(attributes, "userAccountControl") {
+		flags, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if flags&userAccountDisabled != 0 {
+			return AccountDisabled
+		}
+		if flags&userAccountLockout != 0 {
+			status = AccountLocked
+		}
+	}
+
+	for _, value := range filter.Values(attributes, "nsAccountLock") {
+		if strings.EqualFold(value, "true") {
+			return AccountDisabled
+		}
+	}
+
+	if len(filter.Values(attributes, "pwdAccountLockedTime")) > 0 {
+		status = AccountLocked
+	}
+
+	return status
+}
+
+// accountStatusReason is the reason of the auth log for binds refused because
+// of the account status
+func accountStatusReason(status string) string {
+	if status == AccountDisabled {
+		return authlog.ReasonAccountDisabled
+	}
+
+	return authlog.ReasonAccountLocked
+}
+
+// accountStatusMessage is the diagnostic message of binds refused because of
+// the account status. It carries the sub-codes of active directory which
+// many clients look for to tell the user why the bind failed.
+func accountStatusMessage(status string) string {
+	if status == AccountDisabled {
+		return "account disabled, data 533"
+	}
+
+	return "account locked, data 775"
+}
@@ -0,0 +1,95 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_AccountStatus(t *testing.T) {
+	Convey("Given a ldap proxy checking the account status", t, func() {
+		dn := "uid=user1,ou=People"
+		corp := &testBackend{name: "corp", user: []*User{
+			{DN: dn, Attributes: map[string][]string{"uid": {"user1"}, "userAccountControl": {"514"}}},
+		}}
+		other := &testBackend{name: "other", result: true}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(corp)
+		proxy.AddBackend(other)
+
+		config := DefaultProxyConfig()
+		config.AccountStatus = true
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When a disabled account binds", func() {
+			res, err := proxy.Bind(ctx, &ldap.BindRequest{DN: dn, Password: []byte("secure")})
+
+			Convey("Then the bind fails as disabled without asking the other backend", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(res.Message, ShouldEqual, "account disabled, data 533")
+				So(other.lastUsername, ShouldBeBlank)
+			})
+		})
+
+		Convey("When an active account binds", func() {
+			corp.user[0].Attributes["userAccountControl"] = []string{"512"}
+			res, err := proxy.Bind(ctx, &ldap.BindRequest{DN: dn, Password: []byte("secure")})
+
+			Convey("Then the other backend is asked", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(other.lastUsername, ShouldEqual, dn)
+			})
+		})
+
+		Convey("When the account status isn't checked", func() {
+			proxy.Configure(DefaultProxyConfig())
+			res, err := proxy.Bind(ctx, &ldap.BindRequest{DN: dn, Password: []byte("secure")})
+
+			Convey("Then the other backend is asked", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(other.lastUsername, ShouldEqual, dn)
+			})
+		})
+	})
+}
+
+func TestEntryAccountStatus(t *testing.T) {
+	Convey("Given the attributes of entries", t, func() {
+		Convey("Then the account status is derived from them", func() {
+			So(entryAccountStatus(map[string][]string{"uid": {"user1"}}), ShouldEqual, AccountActive)
+			So(entryAccountStatus(map[string][]string{"userAccountControl": {"512"}}), ShouldEqual, AccountActive)
+			So(entryAccountStatus(map[string][]string{"userAccountControl": {"514"}}), ShouldEqual, AccountDisabled)
+			So(entryAccountStatus(map[string][]string{"userAccountControl": {"528"}}), ShouldEqual, AccountLocked)
+			So(entryAccountStatus(map[string][]string{"useraccountcontrol": {"530"}}), ShouldEqual, AccountDisabled)
+			So(entryAccountStatus(map[string][]string{"nsAccountLock": {"TRUE"}}), ShouldEqual, AccountDisabled)
+			So(entryAccountStatus(map[string][]string{"nsAccountLock": {"false"}}), ShouldEqual, AccountActive)
+			So(entryAccountStatus(map[string][]string{"pwdAccountLockedTime": {"20171014120000Z"}}), ShouldEqual, AccountLocked)
+		})
+	})
+}
@@ -0,0 +1,237 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"strings"
+)
+
+// the kinds of access a rule grants
+const (
+	// read the values of the attributes in search results
+	AccessRead = "read"
+	// use the attributes in search filters
+	AccessSearch = "search"
+	// compare values of the attributes
+	AccessCompare = "compare"
+	// add, modify, delete and rename entries
+	AccessWrite = "write"
+)
+
+// the subjects of a rule besides a dn or a group
+const (
+	WhoAnyone    = "*"
+	WhoAnonymous = "anonymous"
+	WhoUsers     = "users"
+	WhoSelf      = "self"
+
+	// the prefix of a group dn, e.g. group:cn=admins,ou=groups,dc=example,dc=com
+	groupPrefix = "group:"
+)
+
+var (
+	ErrNoRules       = errors.New("acl: no rules configured")
+	ErrNoSubject     = errors.New("acl: a rule requires who")
+	ErrUnknownAccess = errors.New("acl: unknown access")
+)
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+
+	// The attribute of the bound entry listing its groups, memberOf by default
+	GroupAttribute string `json:"groupAttribute"`
+}
+
+// A Rule grants who the access to the attributes of the entries in the
+// subtree. Who lists dns, `group:` followed by a group dn, `self` for the
+// bound entry itself, `users` for every bound session, `anonymous` for
+// sessions without dn or `*` for everybody. No subtree covers every entry, no
+// attributes every attribute.
+type Rule struct {
+	Who        []string `json:"who"`
+	Subtree    string   `json:"subtree"`
+	Attributes []string `json:"attributes"`
+	Access     []string `json:"access"`
+}
+
+// The Subject is the identity of a session, the bound dn and its groups. The
+// subject of an anonymous session has no dn.
+type Subject struct {
+	DN     string
+	Groups []string
+}
+
+// A Policy decides which session may access which attributes of which entries.
+// Rules only grant access, everything no rule grants is denied. All methods may
+// be called on a nil policy, which allows everything.
+type Policy struct {
+	rules          []*rule
+	groupAttribute string
+}
+
+type rule struct {
+	who        []string
+	subtree    string
+	attributes map[string]bool
+	access     map[string]bool
+}
+
+func New(config *Config) (*Policy, error) {
+	if len(config.Rules) == 0 {
+		return nil, ErrNoRules
+	}
+
+	policy := &Policy{groupAttribute: config.GroupAttribute}
+	if policy.groupAttribute == "" {
+		policy.groupAttribute = "memberOf"
+	}
+
+	for i, r := range config.Rules {
+		if len(r.Who) == 0 {
+			return nil, fmt.Errorf("%v: rule %d", ErrNoSubject, i)
+		}
+
+		compiled := &rule{
+			subtree: util.NormalizeDN(r.Subtree),
+			access:  make(map[string]bool),
+		}
+		for _, who := range r.Who {
+			if strings.HasPrefix(strings.ToLower(who), groupPrefix) {
+				who = groupPrefix + util.NormalizeDN(who[len(groupPrefix):])
+			} else if !isKeyword(who) {
+				who = util.NormalizeDN(who)
+			}
+			compiled.who = append(compiled.who, who)
+		}
+		if len(r.Attributes) > 0 {
+			compiled.attributes = make(map[string]bool)
+			for _, attribute := range r.Attributes {
+				compiled.attributes[strings.ToLower(attribute)] = true
+			}
+		}
+		for _, access := range r.Access {
+			switch access {
+			case AccessRead, AccessSearch, AccessCompare, AccessWrite:
+			default:
+				return nil, fmt.Errorf("%v: %s", ErrUnknownAccess, access)
+			}
+			compiled.access[access] = true
+		}
+
+		policy.rules = append(policy.rules, compiled)
+	}
+
+	return policy, nil
+}
+
+func isKeyword(who string) bool {
+	return who == WhoAnyone || who == WhoAnonymous || who == WhoUsers || who == WhoSelf
+}
+
+// GroupAttribute is the attribute of the bound entry listing its groups.
+func (policy *Policy) GroupAttribute() string {
+	if policy == nil {
+		return ""
+	}
+
+	return policy.groupAttribute
+}
+
+// Allowed reports whether the subject has the access to the attribute of the
+// entry. An empty attribute asks for the entry itself, granted by any rule of
+// the subtree with the access.
+func (policy *Policy) Allowed(subject *Subject, access string, dn string, attribute string) bool {
+	if policy == nil {
+		return true
+	}
+
+	dn = util.NormalizeDN(dn)
+	for _, r := range policy.rules {
+		if r.access[access] && r.covers(dn, attribute) && r.applies(subject, dn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Readable returns the attributes the subject may read of the entry, a nil
+// policy returns the attributes unchanged.
+func (policy *Policy) Readable(subject *Subject, dn string, attributes map[string][]string) map[string][]string {
+	if policy == nil {
+		return attributes
+	}
+
+	readable := make(map[string][]string)
+	for name, values := range attributes {
+		if policy.Allowed(subject, AccessRead, dn, name) {
+			readable[name] = values
+		}
+	}
+
+	return readable
+}
+
+func (r *rule) covers(dn string, attribute string) bool {
+	if r.subtree != "" && dn != r.subtree && !strings.HasSuffix(dn, ","+r.subtree) {
+		return false
+	}
+
+	return attribute == "" || r.attributes == nil || r.attributes[strings.ToLower(attribute)]
+}
+
+func (r *rule) applies(subject *Subject, dn string) bool {
+	bound := util.NormalizeDN(subject.DN)
+
+	for _, who := range r.who {
+		switch {
+		case who == WhoAnyone:
+			return true
+		case who == WhoAnonymous:
+			if bound == "" {
+				return true
+			}
+		case who == WhoUsers:
+			if bound != "" {
+				return true
+			}
+		case who == WhoSelf:
+			if bound != "" && bound == dn {
+				return true
+			}
+		case strings.HasPrefix(who, groupPrefix):
+			for _, group := range subject.Groups {
+				if util.NormalizeDN(group) == who[len(groupPrefix):] {
+					return true
+				}
+			}
+		default:
+			if bound != "" && bound == who {
+				return true
+			}
+		}
+	}
+
+	return false
+}
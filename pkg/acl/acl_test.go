@@ -0,0 +1,107 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package acl
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Given a policy where only the admins may read the phone numbers", t, func() {
+		policy, err := New(&Config{Rules: []Rule{
+			{Who: []string{WhoAnyone}, Subtree: "ou=People,dc=example,dc=com", Attributes: []string{"cn", "mail"}, Access: []string{AccessRead, AccessSearch}},
+			{Who: []string{"group:cn=admins, ou=Groups, dc=example, dc=com"}, Attributes: []string{"telephoneNumber"}, Access: []string{AccessRead, AccessSearch, AccessWrite}},
+			{Who: []string{WhoSelf}, Attributes: []string{"mail"}, Access: []string{AccessWrite}},
+		}})
+		So(err, ShouldBeNil)
+
+		dn := "uid=jdoe,ou=People,dc=example,dc=com"
+		anonymous := &Subject{}
+		user := &Subject{DN: "uid=jdoe,ou=people,dc=example,dc=com"}
+		admin := &Subject{DN: "uid=root,ou=People,dc=example,dc=com", Groups: []string{"CN=admins,OU=Groups,DC=example,DC=com"}}
+
+		Convey("Then everybody may read the names and mails", func() {
+			So(policy.Allowed(anonymous, AccessRead, dn, "cn"), ShouldBeTrue)
+			So(policy.Allowed(user, AccessSearch, dn, "MAIL"), ShouldBeTrue)
+			So(policy.Allowed(anonymous, AccessRead, "cn=admins,ou=Groups,dc=example,dc=com", "cn"), ShouldBeFalse)
+		})
+
+		Convey("Then only the admins may read the phone numbers", func() {
+			So(policy.Allowed(anonymous, AccessRead, dn, "telephoneNumber"), ShouldBeFalse)
+			So(policy.Allowed(user, AccessRead, dn, "telephoneNumber"), ShouldBeFalse)
+			So(policy.Allowed(admin, AccessRead, dn, "telephoneNumber"), ShouldBeTrue)
+		})
+
+		Convey("Then users may only write their own mail", func() {
+			So(policy.Allowed(user, AccessWrite, dn, "mail"), ShouldBeTrue)
+			So(policy.Allowed(user, AccessWrite, dn, "cn"), ShouldBeFalse)
+			So(policy.Allowed(user, AccessWrite, "uid=other,ou=People,dc=example,dc=com", "mail"), ShouldBeFalse)
+			So(policy.Allowed(anonymous, AccessWrite, dn, "mail"), ShouldBeFalse)
+		})
+
+		Convey("Then no rule grants compare", func() {
+			So(policy.Allowed(admin, AccessCompare, dn, "cn"), ShouldBeFalse)
+		})
+
+		Convey("Then the readable attributes depend on the subject", func() {
+			attributes := map[string][]string{"cn": {"John Doe"}, "telephoneNumber": {"1234"}}
+
+			So(policy.Readable(user, dn, attributes), ShouldResemble, map[string][]string{"cn": {"John Doe"}})
+			So(policy.Readable(admin, dn, attributes), ShouldResemble, attributes)
+		})
+	})
+
+	Convey("Given rules for anonymous and bound sessions", t, func() {
+		policy, err := New(&Config{Rules: []Rule{
+			{Who: []string{WhoAnonymous}, Attributes: []string{"cn"}, Access: []string{AccessRead}},
+			{Who: []string{WhoUsers, "cn=reader,dc=example,dc=com"}, Access: []string{AccessRead}},
+		}})
+		So(err, ShouldBeNil)
+
+		Convey("Then they only apply to their sessions", func() {
+			So(policy.Allowed(&Subject{}, AccessRead, "dc=example,dc=com", "cn"), ShouldBeTrue)
+			So(policy.Allowed(&Subject{}, AccessRead, "dc=example,dc=com", "mail"), ShouldBeFalse)
+			So(policy.Allowed(&Subject{DN: "uid=jdoe"}, AccessRead, "dc=example,dc=com", "mail"), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a nil policy", t, func() {
+		var policy *Policy
+
+		Convey("Then everything is allowed", func() {
+			So(policy.Allowed(&Subject{}, AccessWrite, "dc=example,dc=com", "cn"), ShouldBeTrue)
+			So(policy.GroupAttribute(), ShouldEqual, "")
+		})
+	})
+
+	Convey("Given invalid configs", t, func() {
+		_, noRules := New(&Config{})
+		_, noSubject := New(&Config{Rules: []Rule{{Access: []string{AccessRead}}}})
+		_, unknownAccess := New(&Config{Rules: []Rule{{Who: []string{WhoAnyone}, Access: []string{"delete"}}}})
+
+		Convey("Then errors are returned", func() {
+			So(noRules, ShouldEqual, ErrNoRules)
+			So(noSubject, ShouldNotBeNil)
+			So(unknownAccess, ShouldNotBeNil)
+		})
+	})
+}
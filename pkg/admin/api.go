@@ -0,0 +1,146 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// Returned for unknown sessions and backends.
+	ErrNotFound = errors.New("admin: not found")
+
+	ErrNoDN = errors.New("admin: no dn given")
+
+	ErrNoComponent  = errors.New("admin: no component given")
+	ErrUnknownLevel = errors.New("admin: unknown log level")
+)
+
+// A Session is a client connection of the proxy.
+type Session struct {
+	Id         int64     `json:"id"`
+	DN         string    `json:"dn,omitempty"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Listener   string    `json:"listener,omitempty"`
+	Backend    string    `json:"backend,omitempty"`
+	Location   string    `json:"location,omitempty"`
+	Connected  time.Time `json:"connected"`
+
+	// The attributes of the bound entry fetched at bind time.
+	Attributes map[string][]string `json:"attributes,omitempty"`
+}
+
+// A Backend is a configured backend of the proxy. Disabled backends are
+// neither asked to authenticate nor searched.
+type Backend struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// BackendHealth is the result of the health check of a backend.
+type BackendHealth struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Status summarizes a running proxy.
+type Status struct {
+	Started  time.Time `json:"started"`
+	Sessions int       `json:"sessions"`
+	Backends []Backend `json:"backends"`
+}
+
+// CacheStats describe the content of a cache of the proxy and the lookups
+// since the start.
+type CacheStats struct {
+	Name       string `json:"name"`
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"maxEntries"`
+	TTL        string `json:"ttl"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+}
+
+// An Approval is a sensitive operation waiting for the decision of an
+// operator.
+type Approval struct {
+	Id         string   `json:"id"`
+	Operation  string   `json:"operation"`
+	DN         string   `json:"dn"`
+	BoundDN    string   `json:"boundDn"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// An Invalidation reports the cached search results dropped for a dn.
+type Invalidation struct {
+	DN      string `json:"dn"`
+	Entries int    `json:"entries"`
+}
+
+type Sessions interface {
+	Sessions() []Session
+	KillSession(id int64) error
+}
+
+type Backends interface {
+	Backends() []Backend
+	SetBackendEnabled(name string, enabled bool) error
+}
+
+type Health interface {
+	CheckHealth(ctx context.Context) []BackendHealth
+}
+
+type Lockouts interface {
+	// ResetLockout forgets the failed binds of the dn and ends its cooldown.
+	ResetLockout(dn string) error
+}
+
+type Approvals interface {
+	Approvals() []Approval
+
+	// DecideApproval forwards or refuses the waiting operation.
+	DecideApproval(id string, approved bool) error
+}
+
+type LogLevels interface {
+	// LogLevels returns the overridden levels by component and the level of
+	// the others as default.
+	LogLevels() map[string]string
+
+	// SetLogLevel overrides the level of the component, the level default
+	// removes the override.
+	SetLogLevel(component string, level string) error
+}
+
+type Cache interface {
+	FlushCache()
+
+	// InvalidateCache drops everything cached about the entry with the dn
+	// and returns the number of dropped search results.
+	InvalidateCache(dn string) int
+
+	CacheStats() []CacheStats
+}
@@ -0,0 +1,165 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrUnauthorized = errors.New("admin: missing or unknown credentials")
+	ErrForbidden    = errors.New("admin: permission denied")
+)
+
+// A Role grants a caller of the admin api the permissions of all lower roles.
+// Viewers read the state of the proxy, operators additionally manage sessions,
+// backends and caches, admins may also reload the configuration.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+
+	return 0, fmt.Errorf("admin: unknown role '%s', expected viewer, operator or admin", name)
+}
+
+func (role Role) String() string {
+	if role == 0 {
+		return "none"
+	}
+
+	if name, ok := roleNames[role]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Role(%d)", int(role))
+}
+
+// A Principal is an authenticated caller of the admin api.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// AuthConfig lists the callers of the admin api, either identified by a
+// bearer token or by the common name of a verified client certificate.
+type AuthConfig struct {
+	Tokens      []TokenConfig      `json:"tokens"`
+	ClientCerts []ClientCertConfig `json:"clientCerts"`
+}
+
+type TokenConfig struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
+
+type ClientCertConfig struct {
+	CommonName string `json:"commonName"`
+	Role       string `json:"role"`
+}
+
+type token struct {
+	value     []byte
+	principal Principal
+}
+
+// Auth authenticates the callers of the admin api.
+type Auth struct {
+	tokens []token
+	certs  map[string]Principal
+}
+
+func NewAuth(config *AuthConfig) (*Auth, error) {
+	auth := &Auth{certs: make(map[string]Principal)}
+
+	for _, tokenConfig := range config.Tokens {
+		if tokenConfig.Token == "" {
+			return nil, fmt.Errorf("admin: empty token for '%s'", tokenConfig.Name)
+		}
+
+		role, err := ParseRole(tokenConfig.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		auth.tokens = append(auth.tokens, token{
+			value:     []byte(tokenConfig.Token),
+			principal: Principal{Name: tokenConfig.Name, Role: role},
+		})
+	}
+
+	for _, certConfig := range config.ClientCerts {
+		role, err := ParseRole(certConfig.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		auth.certs[certConfig.CommonName] = Principal{Name: certConfig.CommonName, Role: role}
+	}
+
+	return auth, nil
+}
+
+// authenticate identifies the caller by the bearer token of the request or
+// else by its verified client certificate.
+func (auth *Auth) authenticate(r *http.Request) (Principal, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		value := []byte(strings.TrimPrefix(header, "Bearer "))
+
+		// all tokens are compared to not leak which one matched by timing
+		var principal Principal
+		found := false
+		for _, token := range auth.tokens {
+			if subtle.ConstantTimeCompare(token.value, value) == 1 {
+				principal, found = token.principal, true
+			}
+		}
+
+		return principal, found
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		principal, ok := auth.certs[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+		return principal, ok
+	}
+
+	return Principal{}, false
+}
@@ -0,0 +1,162 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	Convey("Given an admin server with a viewer and an operator token", t, func() {
+		auth, err := NewAuth(&AuthConfig{
+			Tokens: []TokenConfig{
+				{Name: "grafana", Token: "viewer-token", Role: "viewer"},
+				{Name: "oncall", Token: "operator-token", Role: "operator"},
+			},
+			ClientCerts: []ClientCertConfig{{CommonName: "deploy", Role: "admin"}},
+		})
+		So(err, ShouldBeNil)
+
+		proxy := &testProxy{backends: map[string]bool{"corp": true}}
+		changes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, streaming := w.(http.Flusher)
+			fmt.Fprint(w, streaming)
+		})
+		server := httptest.NewServer((&Server{Auth: auth, Sessions: proxy, Backends: proxy, Reload: func() error { return nil }, Changes: changes}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When a call has no token", func() {
+			_, err := client.Status()
+
+			Convey("Then it is unauthorized", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When a call has an unknown token", func() {
+			client.SetToken("guessed")
+			_, err := client.Status()
+
+			Convey("Then it is unauthorized", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When a viewer reads the backends", func() {
+			client.SetToken("viewer-token")
+			backends, err := client.Backends()
+
+			Convey("Then the backends are listed", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a viewer disables a backend", func() {
+			client.SetToken("viewer-token")
+			err := client.DisableBackend("corp")
+
+			Convey("Then it is forbidden", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusForbidden)
+				So(proxy.backends["corp"], ShouldBeTrue)
+			})
+		})
+
+		Convey("When an operator disables a backend", func() {
+			client.SetToken("operator-token")
+			err := client.DisableBackend("corp")
+
+			Convey("Then the backend is disabled", func() {
+				So(err, ShouldBeNil)
+				So(proxy.backends["corp"], ShouldBeFalse)
+			})
+		})
+
+		Convey("When an operator reloads the configuration", func() {
+			client.SetToken("operator-token")
+			err := client.Reload()
+
+			Convey("Then it is forbidden", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("When the changes are streamed without a token", func() {
+			res, err := http.Get(server.URL + "/changes")
+			So(err, ShouldBeNil)
+			res.Body.Close()
+
+			Convey("Then it is unauthorized", func() {
+				So(res.StatusCode, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When a viewer streams the changes", func() {
+			r, _ := http.NewRequest(http.MethodGet, server.URL+"/changes", nil)
+			r.Header.Set("Authorization", "Bearer viewer-token")
+			res, err := http.DefaultClient.Do(r)
+			So(err, ShouldBeNil)
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+
+			Convey("Then the stream can be flushed", func() {
+				So(res.StatusCode, ShouldEqual, http.StatusOK)
+				So(string(body), ShouldEqual, "true")
+			})
+		})
+
+		Convey("When a caller has a verified client certificate", func() {
+			r := httptest.NewRequest(http.MethodPost, "/reload", nil)
+			r.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "deploy"}}}},
+			}
+
+			principal, ok := auth.authenticate(r)
+
+			Convey("Then the caller is identified by the common name", func() {
+				So(ok, ShouldBeTrue)
+				So(principal, ShouldResemble, Principal{Name: "deploy", Role: RoleAdmin})
+			})
+		})
+	})
+
+	Convey("Given an auth config with an unknown role", t, func() {
+		_, err := NewAuth(&AuthConfig{Tokens: []TokenConfig{{Name: "root", Token: "secret", Role: "root"}}})
+
+		Convey("Then it is rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,232 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// An Error is a failed call of the admin api.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("admin: %d %s", err.StatusCode, err.Message)
+}
+
+// Client calls the admin api of a running proxy.
+type Client struct {
+	baseUrl string
+	token   string
+	client  *http.Client
+}
+
+// NewClient creates a client for the admin api at the address, either an http
+// url like `http://localhost:8081` or a unix socket like
+// `unix:/run/ldap-proxy.sock`.
+func NewClient(address string) *Client {
+	client := &Client{
+		baseUrl: strings.TrimSuffix(address, "/"),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	if strings.HasPrefix(address, "unix:") {
+		socket := strings.TrimPrefix(address, "unix:")
+		client.baseUrl = "http://unix"
+		client.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	return client
+}
+
+// SetToken authenticates the calls with the bearer token.
+func (client *Client) SetToken(token string) {
+	client.token = token
+}
+
+// SetTLSConfig configures https calls, e.g. with a client certificate.
+func (client *Client) SetTLSConfig(config *tls.Config) {
+	client.client.Transport = &http.Transport{
+		TLSClientConfig: config,
+	}
+}
+
+func (client *Client) Status() (*Status, error) {
+	status := &Status{}
+	err := client.call(http.MethodGet, "/status", status)
+
+	return status, err
+}
+
+func (client *Client) Sessions() ([]Session, error) {
+	sessions := []Session{}
+	err := client.call(http.MethodGet, "/sessions", &sessions)
+
+	return sessions, err
+}
+
+// KillSession cancels the session, its connection is closed with the next
+// request.
+func (client *Client) KillSession(id int64) error {
+	return client.call(http.MethodDelete, fmt.Sprintf("/sessions/%d", id), nil)
+}
+
+func (client *Client) Backends() ([]Backend, error) {
+	backends := []Backend{}
+	err := client.call(http.MethodGet, "/backends", &backends)
+
+	return backends, err
+}
+
+func (client *Client) EnableBackend(name string) error {
+	return client.call(http.MethodPost, "/backends/"+url.PathEscape(name)+"/enable", nil)
+}
+
+func (client *Client) DisableBackend(name string) error {
+	return client.call(http.MethodPost, "/backends/"+url.PathEscape(name)+"/disable", nil)
+}
+
+func (client *Client) FlushCache() error {
+	return client.call(http.MethodPost, "/cache/flush", nil)
+}
+
+// InvalidateCache drops everything cached about the entry with the dn and
+// returns the number of dropped search results.
+func (client *Client) InvalidateCache(dn string) (int, error) {
+	invalidation := &Invalidation{}
+	err := client.call(http.MethodPost, "/cache/invalidate?dn="+url.QueryEscape(dn), invalidation)
+
+	return invalidation.Entries, err
+}
+
+func (client *Client) CacheStats() ([]CacheStats, error) {
+	stats := []CacheStats{}
+	err := client.call(http.MethodGet, "/cache/stats", &stats)
+
+	return stats, err
+}
+
+func (client *Client) Health() ([]BackendHealth, error) {
+	health := []BackendHealth{}
+	err := client.call(http.MethodGet, "/health", &health)
+
+	return health, err
+}
+
+// ResetLockout forgets the failed binds of the dn and ends its cooldown.
+func (client *Client) ResetLockout(dn string) error {
+	return client.call(http.MethodPost, "/lockout/reset?dn="+url.QueryEscape(dn), nil)
+}
+
+// Approvals returns the sensitive operations waiting for a decision.
+func (client *Client) Approvals() ([]Approval, error) {
+	approvals := []Approval{}
+	err := client.call(http.MethodGet, "/approvals", &approvals)
+
+	return approvals, err
+}
+
+// Approve forwards the waiting operation.
+func (client *Client) Approve(id string) error {
+	return client.call(http.MethodPost, "/approvals/"+url.PathEscape(id)+"/approve", nil)
+}
+
+// Reject refuses the waiting operation.
+func (client *Client) Reject(id string) error {
+	return client.call(http.MethodPost, "/approvals/"+url.PathEscape(id)+"/reject", nil)
+}
+
+// LogLevels returns the overridden log levels by component.
+func (client *Client) LogLevels() (map[string]string, error) {
+	levels := map[string]string{}
+	err := client.call(http.MethodGet, "/log/levels", &levels)
+
+	return levels, err
+}
+
+// SetLogLevel overrides the log level of the component, the level default
+// removes the override.
+func (client *Client) SetLogLevel(component string, level string) error {
+	return client.call(http.MethodPost, "/log/level?component="+url.QueryEscape(component)+"&level="+url.QueryEscape(level), nil)
+}
+
+// Config returns the effective configuration of the proxy.
+func (client *Client) Config() (json.RawMessage, error) {
+	var config json.RawMessage
+	err := client.call(http.MethodGet, "/config", &config)
+
+	return config, err
+}
+
+func (client *Client) Reload() error {
+	return client.call(http.MethodPost, "/reload", nil)
+}
+
+func (client *Client) call(method string, path string, result interface{}) error {
+	req, err := http.NewRequest(method, client.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if client.token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	res, err := client.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		errRes := &errorResponse{}
+		if json.NewDecoder(res.Body).Decode(errRes) != nil || errRes.Error == "" {
+			errRes.Error = http.StatusText(res.StatusCode)
+		}
+		return &Error{StatusCode: res.StatusCode, Message: errRes.Error}
+	}
+
+	if result == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
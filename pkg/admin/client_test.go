@@ -0,0 +1,352 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testProxy struct {
+	killed   []int64
+	backends map[string]bool
+}
+
+func (proxy *testProxy) Sessions() []Session {
+	return []Session{{Id: 1, DN: "cn=test", RemoteAddr: "10.0.0.1:40000"}}
+}
+
+func (proxy *testProxy) KillSession(id int64) error {
+	if id != 1 {
+		return ErrNotFound
+	}
+
+	proxy.killed = append(proxy.killed, id)
+	return nil
+}
+
+func (proxy *testProxy) Backends() []Backend {
+	return []Backend{{Name: "corp", Enabled: proxy.backends["corp"]}}
+}
+
+func (proxy *testProxy) SetBackendEnabled(name string, enabled bool) error {
+	if _, ok := proxy.backends[name]; !ok {
+		return ErrNotFound
+	}
+
+	proxy.backends[name] = enabled
+	return nil
+}
+
+type testCache struct {
+	invalidated []string
+}
+
+func (cache *testCache) FlushCache() {}
+
+func (cache *testCache) InvalidateCache(dn string) int {
+	cache.invalidated = append(cache.invalidated, dn)
+	return 2
+}
+
+func (cache *testCache) CacheStats() []CacheStats {
+	return []CacheStats{{Name: "search", Entries: 2, MaxEntries: 10000, TTL: "1m0s", Hits: 5, Misses: 2}}
+}
+
+type testLockouts struct {
+	reset []string
+}
+
+func (lockouts *testLockouts) CheckHealth(ctx context.Context) []BackendHealth {
+	return []BackendHealth{{Name: "corp", Healthy: false, Error: "connection refused"}}
+}
+
+func (lockouts *testLockouts) ResetLockout(dn string) error {
+	if dn != "cn=locked" {
+		return ErrNotFound
+	}
+
+	lockouts.reset = append(lockouts.reset, dn)
+	return nil
+}
+
+type testApprovals struct {
+	decided map[string]bool
+}
+
+func (approvals *testApprovals) Approvals() []Approval {
+	return []Approval{{Id: "1", Operation: "delete", DN: "uid=a,dc=example,dc=com", BoundDN: "cn=test"}}
+}
+
+func (approvals *testApprovals) DecideApproval(id string, approved bool) error {
+	if id != "1" {
+		return ErrNotFound
+	}
+
+	approvals.decided[id] = approved
+	return nil
+}
+
+type testLogLevels struct {
+	levels map[string]string
+}
+
+func (logLevels *testLogLevels) LogLevels() map[string]string {
+	return logLevels.levels
+}
+
+func (logLevels *testLogLevels) SetLogLevel(component string, level string) error {
+	if level != "debug" {
+		return ErrUnknownLevel
+	}
+
+	logLevels.levels[component] = level
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	Convey("Given a client of an admin server without cache and reload", t, func() {
+		proxy := &testProxy{backends: map[string]bool{"corp": true}}
+		server := httptest.NewServer((&Server{Sessions: proxy, Backends: proxy}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When the status is requested", func() {
+			status, err := client.Status()
+
+			Convey("Then the sessions are counted and the backends are listed", func() {
+				So(err, ShouldBeNil)
+				So(status.Sessions, ShouldEqual, 1)
+				So(status.Backends, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the sessions are listed", func() {
+			sessions, err := client.Sessions()
+
+			Convey("Then the sessions of the proxy are returned", func() {
+				So(err, ShouldBeNil)
+				So(sessions, ShouldHaveLength, 1)
+				So(sessions[0].DN, ShouldEqual, "cn=test")
+			})
+		})
+
+		Convey("When a session is killed", func() {
+			err := client.KillSession(1)
+
+			Convey("Then the proxy kills the session", func() {
+				So(err, ShouldBeNil)
+				So(proxy.killed, ShouldResemble, []int64{1})
+			})
+		})
+
+		Convey("When an unknown session is killed", func() {
+			err := client.KillSession(2)
+
+			Convey("Then a not found error is returned", func() {
+				So(err, ShouldHaveSameTypeAs, &Error{})
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusNotFound)
+				So(err.(*Error).Message, ShouldEqual, ErrNotFound.Error())
+			})
+		})
+
+		Convey("When a backend is disabled", func() {
+			err := client.DisableBackend("corp")
+			backends, _ := client.Backends()
+
+			Convey("Then the backend is listed as disabled", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldResemble, []Backend{{Name: "corp", Enabled: false}})
+			})
+		})
+
+		Convey("When the cache is flushed", func() {
+			err := client.FlushCache()
+
+			Convey("Then the missing feature is reported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusNotImplemented)
+			})
+		})
+	})
+
+	Convey("Given a client of an admin server with a cache", t, func() {
+		cache := &testCache{}
+		server := httptest.NewServer((&Server{Cache: cache}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When the cache of a dn is invalidated", func() {
+			entries, err := client.InvalidateCache("uid=a+b,ou=People,dc=example,dc=com")
+
+			Convey("Then the proxy invalidates the dn", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldEqual, 2)
+				So(cache.invalidated, ShouldResemble, []string{"uid=a+b,ou=People,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the cache is invalidated without a dn", func() {
+			_, err := client.InvalidateCache("")
+
+			Convey("Then the request is rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When the cache stats are requested", func() {
+			stats, err := client.CacheStats()
+
+			Convey("Then the stats of the proxy are returned", func() {
+				So(err, ShouldBeNil)
+				So(stats, ShouldHaveLength, 1)
+				So(stats[0].Hits, ShouldEqual, 5)
+			})
+		})
+	})
+	Convey("Given a client of an admin server with health checks, lockouts and config", t, func() {
+		lockouts := &testLockouts{}
+		server := httptest.NewServer((&Server{
+			Health:   lockouts,
+			Lockouts: lockouts,
+			Config: func() interface{} {
+				return map[string]interface{}{"backends": []interface{}{}}
+			},
+		}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When the health is requested", func() {
+			health, err := client.Health()
+
+			Convey("Then the health of the backends is returned", func() {
+				So(err, ShouldBeNil)
+				So(health, ShouldResemble, []BackendHealth{{Name: "corp", Healthy: false, Error: "connection refused"}})
+			})
+		})
+
+		Convey("When the lockout of a dn is reset", func() {
+			err := client.ResetLockout("cn=locked")
+
+			Convey("Then the proxy resets the dn", func() {
+				So(err, ShouldBeNil)
+				So(lockouts.reset, ShouldResemble, []string{"cn=locked"})
+			})
+		})
+
+		Convey("When the lockout of a dn without failures is reset", func() {
+			err := client.ResetLockout("cn=other")
+
+			Convey("Then a not found error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When the config is requested", func() {
+			config, err := client.Config()
+
+			Convey("Then the effective config is returned", func() {
+				So(err, ShouldBeNil)
+				So(string(config), ShouldContainSubstring, `"backends":[]`)
+			})
+		})
+	})
+	Convey("Given a client of an admin server with approvals", t, func() {
+		approvals := &testApprovals{decided: map[string]bool{}}
+		server := httptest.NewServer((&Server{Approvals: approvals}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When the approvals are listed", func() {
+			list, err := client.Approvals()
+
+			Convey("Then the waiting operations are returned", func() {
+				So(err, ShouldBeNil)
+				So(list, ShouldHaveLength, 1)
+				So(list[0].DN, ShouldEqual, "uid=a,dc=example,dc=com")
+			})
+		})
+
+		Convey("When an operation is approved", func() {
+			err := client.Approve("1")
+
+			Convey("Then it is decided", func() {
+				So(err, ShouldBeNil)
+				So(approvals.decided, ShouldResemble, map[string]bool{"1": true})
+			})
+		})
+
+		Convey("When an unknown operation is rejected", func() {
+			err := client.Reject("2")
+
+			Convey("Then a not found error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+	Convey("Given a client of an admin server with log levels", t, func() {
+		logLevels := &testLogLevels{levels: map[string]string{"default": "info"}}
+		server := httptest.NewServer((&Server{LogLevels: logLevels}).Handler())
+		Reset(server.Close)
+
+		client := NewClient(server.URL)
+
+		Convey("When the level of a component is set", func() {
+			err := client.SetLogLevel("backend.ad", "debug")
+
+			Convey("Then the component has the level", func() {
+				So(err, ShouldBeNil)
+
+				levels, err := client.LogLevels()
+				So(err, ShouldBeNil)
+				So(levels, ShouldResemble, map[string]string{"default": "info", "backend.ad": "debug"})
+			})
+		})
+
+		Convey("When an unknown level is set", func() {
+			err := client.SetLogLevel("cache", "verbose")
+
+			Convey("Then a bad request error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When the level of no component is set", func() {
+			err := client.SetLogLevel("", "debug")
+
+			Convey("Then a bad request error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*Error).StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
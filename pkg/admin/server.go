@@ -0,0 +1,397 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package admin
+
+import (
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var auditLog = log.Component(log.Audit)
+
+// Server exposes the administration of a running proxy over http. Features
+// which are nil answer with 501 Not Implemented.
+//
+//	GET    /status
+//	GET    /sessions
+//	DELETE /sessions/{id}
+//	GET    /backends
+//	GET    /health
+//	POST   /backends/{name}/enable
+//	POST   /backends/{name}/disable
+//	POST   /cache/flush
+//	POST   /cache/invalidate?dn={dn}
+//	GET    /cache/stats
+//	POST   /lockout/reset?dn={dn}
+//	GET    /approvals
+//	POST   /approvals/{id}/approve
+//	POST   /approvals/{id}/reject
+//	GET    /log/levels
+//	POST   /log/level?component={component}&level={level}
+//	GET    /config
+//	POST   /reload
+//	GET    /changes?base={dn}&filter={filter}
+//
+// With Auth every call requires a bearer token or client certificate of a
+// caller with the role of the endpoint, all calls are written to the audit
+// log. Without Auth the api is open to everyone who can reach it.
+type Server struct {
+	Started time.Time
+	Auth    *Auth
+
+	Sessions  Sessions
+	Backends  Backends
+	Cache     Cache
+	Health    Health
+	Lockouts  Lockouts
+	Approvals Approvals
+	LogLevels LogLevels
+
+	// Config returns the effective configuration with redacted credentials.
+	Config func() interface{}
+	Reload func() error
+
+	// Changes streams the directory changes as server-sent events.
+	Changes http.Handler
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", server.authorized(RoleViewer, server.handleStatus))
+	mux.HandleFunc("/sessions", server.authorized(RoleViewer, server.handleSessions))
+	mux.HandleFunc("/sessions/", server.authorized(RoleOperator, server.handleSession))
+	mux.HandleFunc("/backends", server.authorized(RoleViewer, server.handleBackends))
+	mux.HandleFunc("/backends/", server.authorized(RoleOperator, server.handleBackend))
+	mux.HandleFunc("/cache/flush", server.authorized(RoleOperator, server.handleCacheFlush))
+	mux.HandleFunc("/cache/invalidate", server.authorized(RoleOperator, server.handleCacheInvalidate))
+	mux.HandleFunc("/cache/stats", server.authorized(RoleViewer, server.handleCacheStats))
+	mux.HandleFunc("/health", server.authorized(RoleViewer, server.handleHealth))
+	mux.HandleFunc("/lockout/reset", server.authorized(RoleOperator, server.handleLockoutReset))
+	mux.HandleFunc("/approvals", server.authorized(RoleViewer, server.handleApprovals))
+	mux.HandleFunc("/approvals/", server.authorized(RoleOperator, server.handleApproval))
+	mux.HandleFunc("/log/levels", server.authorized(RoleViewer, server.handleLogLevels))
+	mux.HandleFunc("/log/level", server.authorized(RoleAdmin, server.handleLogLevel))
+	mux.HandleFunc("/config", server.authorized(RoleAdmin, server.handleConfig))
+	mux.HandleFunc("/reload", server.authorized(RoleAdmin, server.handleReload))
+	mux.HandleFunc("/changes", server.authorized(RoleViewer, server.handleChanges))
+
+	return mux
+}
+
+// statusRecorder keeps the status of a response for the audit log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes the flushes of streamed responses on
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// authorized only passes calls of callers with at least the role to the
+// handler and records them in the audit log
+func (server *Server) authorized(role Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.Auth == nil {
+			handler(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		principal, ok := server.Auth.authenticate(r)
+		switch {
+		case !ok:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(recorder, http.StatusUnauthorized, ErrUnauthorized)
+		case principal.Role < role:
+			writeError(recorder, http.StatusForbidden, ErrForbidden)
+		default:
+			handler(recorder, r)
+		}
+
+		auditLog.Printf("AUDIT: admin %s %s by '%s' (%s) from %s: %d", r.Method, r.URL.RequestURI(), principal.Name, principal.Role, r.RemoteAddr, recorder.status)
+	}
+}
+
+func (server *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+
+	status := &Status{
+		Started:  server.Started,
+		Backends: []Backend{},
+	}
+	if server.Sessions != nil {
+		status.Sessions = len(server.Sessions.Sessions())
+	}
+	if server.Backends != nil {
+		status.Backends = server.Backends.Backends()
+	}
+
+	writeJson(w, status)
+}
+
+func (server *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Sessions != nil) {
+		return
+	}
+
+	writeJson(w, server.Sessions.Sessions())
+}
+
+func (server *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodDelete) || !implemented(w, server.Sessions != nil) {
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/sessions/"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeResult(w, server.Sessions.KillSession(id))
+}
+
+func (server *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Changes != nil) {
+		return
+	}
+
+	server.Changes.ServeHTTP(w, r)
+}
+
+func (server *Server) handleBackends(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Backends != nil) {
+		return
+	}
+
+	writeJson(w, server.Backends.Backends())
+}
+
+func (server *Server) handleBackend(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Backends != nil) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/backends/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	name, action := path[:i], path[i+1:]
+	switch action {
+	case "enable":
+		writeResult(w, server.Backends.SetBackendEnabled(name, true))
+	case "disable":
+		writeResult(w, server.Backends.SetBackendEnabled(name, false))
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (server *Server) handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Cache != nil) {
+		return
+	}
+
+	server.Cache.FlushCache()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleCacheInvalidate(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Cache != nil) {
+		return
+	}
+
+	dn := r.URL.Query().Get("dn")
+	if dn == "" {
+		writeError(w, http.StatusBadRequest, ErrNoDN)
+		return
+	}
+
+	writeJson(w, &Invalidation{DN: dn, Entries: server.Cache.InvalidateCache(dn)})
+}
+
+func (server *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Cache != nil) {
+		return
+	}
+
+	writeJson(w, server.Cache.CacheStats())
+}
+
+func (server *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Health != nil) {
+		return
+	}
+
+	writeJson(w, server.Health.CheckHealth(r.Context()))
+}
+
+func (server *Server) handleLockoutReset(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Lockouts != nil) {
+		return
+	}
+
+	dn := r.URL.Query().Get("dn")
+	if dn == "" {
+		writeError(w, http.StatusBadRequest, ErrNoDN)
+		return
+	}
+
+	writeResult(w, server.Lockouts.ResetLockout(dn))
+}
+
+func (server *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Approvals != nil) {
+		return
+	}
+
+	writeJson(w, server.Approvals.Approvals())
+}
+
+func (server *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Approvals != nil) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/approvals/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	id, action := path[:i], path[i+1:]
+	switch action {
+	case "approve":
+		writeResult(w, server.Approvals.DecideApproval(id, true))
+	case "reject":
+		writeResult(w, server.Approvals.DecideApproval(id, false))
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (server *Server) handleLogLevels(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.LogLevels != nil) {
+		return
+	}
+
+	writeJson(w, server.LogLevels.LogLevels())
+}
+
+func (server *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.LogLevels != nil) {
+		return
+	}
+
+	component := r.URL.Query().Get("component")
+	if component == "" {
+		writeError(w, http.StatusBadRequest, ErrNoComponent)
+		return
+	}
+
+	writeResult(w, server.LogLevels.SetLogLevel(component, r.URL.Query().Get("level")))
+}
+
+func (server *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) || !implemented(w, server.Config != nil) {
+		return
+	}
+
+	writeJson(w, server.Config())
+}
+
+func (server *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) || !implemented(w, server.Reload != nil) {
+		return
+	}
+
+	writeResult(w, server.Reload())
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, nil)
+		return false
+	}
+
+	return true
+}
+
+func implemented(w http.ResponseWriter, implemented bool) bool {
+	if !implemented {
+		writeError(w, http.StatusNotImplemented, nil)
+	}
+
+	return implemented
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case err == ErrNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case err == ErrUnknownLevel:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	message := http.StatusText(status)
+	if err != nil {
+		message = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{Error: message})
+}
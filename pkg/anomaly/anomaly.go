@@ -0,0 +1,234 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package anomaly
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	KindNewNetwork    = "new_network"
+	KindUnusualHour   = "unusual_hour"
+	KindNewOperation  = "new_operation"
+	KindEnumeration   = "enumeration"
+	KindQuota         = "quota_exceeded"
+	defaultLearnBinds = 20
+)
+
+type Config struct {
+	// The number of binds of an identity which are used to learn its behavior
+	// before deviations are reported.
+	LearningBinds int `json:"learningBinds"`
+
+	// The number of entries a single search may return before it is reported
+	// as mass enumeration. Zero disables the check.
+	MaxSearchResults int `json:"maxSearchResults"`
+
+	// The number of entries an identity may receive per day before a soft
+	// quota warning is reported. Zero disables the quota.
+	DailyResultQuota int `json:"dailyResultQuota"`
+
+	// Whether searches of an identity over its quota are refused for the rest
+	// of the day.
+	ThrottleOverQuota bool `json:"throttleOverQuota"`
+}
+
+// An Event describes a deviation of a session from the learned behavior of
+// the bound identity.
+type Event struct {
+	DN     string
+	Kind   string
+	Detail string
+}
+
+func (event *Event) String() string {
+	return fmt.Sprintf("%s %s: %s", event.DN, event.Kind, event.Detail)
+}
+
+// A Detector keeps a lightweight behavioral fingerprint per bind dn: the
+// source networks, the hours of the day and the operations used.
+type Detector struct {
+	config *Config
+
+	now func() time.Time
+
+	mutex        sync.Mutex
+	fingerprints map[string]*fingerprint
+}
+
+type fingerprint struct {
+	binds      int
+	networks   map[string]int
+	hours      [24]int
+	operations map[string]int
+
+	// the entries returned on quotaDay
+	quotaDay      string
+	quotaResults  int
+	quotaReported bool
+}
+
+func NewDetector(config *Config) *Detector {
+	if config.LearningBinds <= 0 {
+		config.LearningBinds = defaultLearnBinds
+	}
+
+	return &Detector{
+		config:       config,
+		now:          time.Now,
+		fingerprints: make(map[string]*fingerprint),
+	}
+}
+
+// Bind records a successful bind and returns the deviations from the
+// fingerprint.
+func (detector *Detector) Bind(dn string, addr net.Addr, at time.Time) []*Event {
+	if detector == nil {
+		return nil
+	}
+
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+
+	fp := detector.fingerprint(dn)
+	learned := fp.binds >= detector.config.LearningBinds
+
+	var events []*Event
+	network := networkOf(addr)
+	if learned && network != "" && fp.networks[network] == 0 {
+		events = append(events, &Event{DN: dn, Kind: KindNewNetwork, Detail: network})
+	}
+	if learned && fp.hours[at.Hour()] == 0 {
+		events = append(events, &Event{DN: dn, Kind: KindUnusualHour, Detail: fmt.Sprintf("%02d:00", at.Hour())})
+	}
+
+	fp.binds++
+	fp.networks[network]++
+	fp.hours[at.Hour()]++
+
+	return events
+}
+
+// Operation records an operation of a bound identity with the number of
+// returned entries and returns the deviations from the fingerprint.
+func (detector *Detector) Operation(dn string, operation string, results int) []*Event {
+	if detector == nil || dn == "" {
+		return nil
+	}
+
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+
+	fp := detector.fingerprint(dn)
+
+	var events []*Event
+	if fp.binds >= detector.config.LearningBinds && fp.operations[operation] == 0 {
+		events = append(events, &Event{DN: dn, Kind: KindNewOperation, Detail: operation})
+	}
+	if detector.config.MaxSearchResults > 0 && results > detector.config.MaxSearchResults {
+		events = append(events, &Event{DN: dn, Kind: KindEnumeration, Detail: fmt.Sprintf("%s returned %d entries", operation, results)})
+	}
+
+	if event := detector.countQuota(fp, dn, results); event != nil {
+		events = append(events, event)
+	}
+
+	fp.operations[operation]++
+
+	return events
+}
+
+// countQuota adds the results to the daily total of the identity and reports
+// the first time the quota is exceeded on a day
+func (detector *Detector) countQuota(fp *fingerprint, dn string, results int) *Event {
+	if detector.config.DailyResultQuota <= 0 {
+		return nil
+	}
+
+	if day := detector.now().Format("2006-01-02"); fp.quotaDay != day {
+		fp.quotaDay, fp.quotaResults, fp.quotaReported = day, 0, false
+	}
+
+	fp.quotaResults += results
+	if fp.quotaReported || fp.quotaResults <= detector.config.DailyResultQuota {
+		return nil
+	}
+
+	fp.quotaReported = true
+	return &Event{DN: dn, Kind: KindQuota, Detail: fmt.Sprintf("%d entries returned today, quota %d", fp.quotaResults, detector.config.DailyResultQuota)}
+}
+
+// OverQuota reports whether the searches of the identity are throttled
+// because it received more entries than its daily quota.
+func (detector *Detector) OverQuota(dn string) bool {
+	if detector == nil || !detector.config.ThrottleOverQuota || detector.config.DailyResultQuota <= 0 {
+		return false
+	}
+
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+
+	fp, ok := detector.fingerprints[dn]
+	if !ok {
+		return false
+	}
+
+	return fp.quotaDay == detector.now().Format("2006-01-02") && fp.quotaResults > detector.config.DailyResultQuota
+}
+
+func (detector *Detector) fingerprint(dn string) *fingerprint {
+	fp, ok := detector.fingerprints[dn]
+	if !ok {
+		fp = &fingerprint{
+			networks:   make(map[string]int),
+			operations: make(map[string]int),
+		}
+		detector.fingerprints[dn] = fp
+	}
+
+	return fp
+}
+
+// networkOf returns the /24 (IPv4) or /64 (IPv6) network of the address
+func networkOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
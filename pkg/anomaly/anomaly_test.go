@@ -0,0 +1,117 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package anomaly
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDetector_Bind(t *testing.T) {
+	Convey("Given a detector which learned the behavior of a user", t, func() {
+		detector := NewDetector(&Config{LearningBinds: 2})
+		morning := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+		office := &net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}
+
+		So(detector.Bind("uid=user1", office, morning), ShouldBeEmpty)
+		So(detector.Bind("uid=user1", office, morning), ShouldBeEmpty)
+
+		Convey("When the user binds as usual", func() {
+			events := detector.Bind("uid=user1", &net.TCPAddr{IP: net.ParseIP("10.0.0.13"), Port: 40001}, morning)
+
+			Convey("Then no event is raised", func() {
+				So(events, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the user binds from another network at night", func() {
+			events := detector.Bind("uid=user1", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40001}, morning.Add(15*time.Hour))
+
+			Convey("Then both deviations are reported", func() {
+				So(events, ShouldHaveLength, 2)
+				So(events[0].Kind, ShouldEqual, KindNewNetwork)
+				So(events[0].Detail, ShouldEqual, "192.0.2.0/24")
+				So(events[1].Kind, ShouldEqual, KindUnusualHour)
+			})
+		})
+	})
+}
+
+func TestDetector_Operation(t *testing.T) {
+	Convey("Given a detector limiting the search results", t, func() {
+		detector := NewDetector(&Config{LearningBinds: 1, MaxSearchResults: 100})
+		detector.Bind("uid=user1", nil, time.Now())
+		detector.Operation("uid=user1", "search", 1)
+
+		Convey("When a search returns a huge number of entries", func() {
+			events := detector.Operation("uid=user1", "search", 5000)
+
+			Convey("Then an enumeration is reported", func() {
+				So(events, ShouldHaveLength, 1)
+				So(events[0].Kind, ShouldEqual, KindEnumeration)
+			})
+		})
+
+		Convey("When the user uses a new operation", func() {
+			events := detector.Operation("uid=user1", "modify", 0)
+
+			Convey("Then the new operation is reported", func() {
+				So(events, ShouldHaveLength, 1)
+				So(events[0].Kind, ShouldEqual, KindNewOperation)
+			})
+		})
+	})
+}
+
+func TestDetector_Quota(t *testing.T) {
+	Convey("Given a detector with a throttling daily quota", t, func() {
+		detector := NewDetector(&Config{DailyResultQuota: 100, ThrottleOverQuota: true})
+		now := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+		detector.now = func() time.Time { return now }
+
+		detector.Operation("uid=user1", "search", 60)
+
+		Convey("When the quota is exceeded", func() {
+			events := detector.Operation("uid=user1", "search", 60)
+			again := detector.Operation("uid=user1", "search", 60)
+
+			Convey("Then it is reported once and the identity is throttled", func() {
+				So(events, ShouldHaveLength, 1)
+				So(events[0].Kind, ShouldEqual, KindQuota)
+				So(again, ShouldBeEmpty)
+				So(detector.OverQuota("uid=user1"), ShouldBeTrue)
+				So(detector.OverQuota("uid=user2"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the next day starts", func() {
+			detector.Operation("uid=user1", "search", 60)
+			now = now.Add(24 * time.Hour)
+
+			Convey("Then the identity isn't throttled anymore", func() {
+				So(detector.OverQuota("uid=user1"), ShouldBeFalse)
+				So(detector.Operation("uid=user1", "search", 60), ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// AnonymousAccess is the view of sessions which didn't bind or bound without
+// a dn and password. They may only search below the subtrees and only read
+// the attributes, the objectClass is always readable. No subtrees allow every
+// base, no attributes every attribute.
+type AnonymousAccess struct {
+	Subtrees   []string
+	Attributes []string
+}
+
+// allows checks that the search stays within the view. Filters asserting on
+// hidden attributes are refused, their results would disclose the values.
+func (access *AnonymousAccess) allows(req *ldap.SearchRequest) bool {
+	if access == nil {
+		return false
+	}
+
+	for _, attribute := range filter.Attributes(req.Filter) {
+		if !access.readable(attribute) {
+			return false
+		}
+	}
+
+	if len(access.Subtrees) == 0 {
+		return true
+	}
+
+	for _, subtree := range access.Subtrees {
+		if util.IsBelowDN(req.BaseDN, subtree) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (access *AnonymousAccess) readable(attribute string) bool {
+	if len(access.Attributes) == 0 || strings.EqualFold(attribute, "objectClass") {
+		return true
+	}
+
+	for _, allowed := range access.Attributes {
+		if strings.EqualFold(allowed, attribute) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restrict drops the attributes of the user hidden from anonymous sessions
+func (access *AnonymousAccess) restrict(user *User) *User {
+	if len(access.Attributes) == 0 {
+		return user
+	}
+
+	attributes := make(map[string][]string)
+	for name, values := range user.Attributes {
+		if access.readable(name) {
+			attributes[name] = values
+		}
+	}
+
+	return &User{DN: user.DN, Attributes: attributes}
+}
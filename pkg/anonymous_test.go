@@ -0,0 +1,100 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_Anonymous(t *testing.T) {
+	Convey("Given a ldap proxy allowing anonymous searches of the people", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"cn": {"John Doe"}, "mail": {"jdoe@example.com"}, "telephoneNumber": {"1234"}}},
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}}},
+		}})
+
+		config := DefaultProxyConfig()
+		config.Anonymous = &AnonymousAccess{Subtrees: []string{"ou=People,dc=example,dc=com"}, Attributes: []string{"cn", "mail"}}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), ""))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the session binds anonymously", func() {
+			res, err := proxy.Bind(sess, &ldap.BindRequest{})
+
+			Convey("Then the bind succeeds without bound dn", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(getDn(sess.context), ShouldEqual, "")
+			})
+		})
+
+		Convey("When the people are searched", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the readable attributes of the people are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes, ShouldResemble, map[string][][]byte{"cn": {[]byte("John Doe")}, "mail": {[]byte("jdoe@example.com")}})
+			})
+		})
+
+		Convey("When a base outside of the subtrees is searched", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When the filter asserts on a hidden attribute", func() {
+			f, _ := filter.Parse("(telephoneNumber=1*)")
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: f})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When anonymous access isn't configured", func() {
+			proxy.Configure(DefaultProxyConfig())
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package approval
+
+import (
+	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDenied = errors.New("approval: operation denied")
+)
+
+const (
+	OperationDelete = "delete"
+	OperationModify = "modify"
+)
+
+// A Request describes a sensitive operation waiting for approval.
+type Request struct {
+	Id         string   `json:"id"`
+	Operation  string   `json:"operation"`
+	DN         string   `json:"dn"`
+	BoundDN    string   `json:"boundDn"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// An Approver decides whether a sensitive operation may be forwarded.
+type Approver interface {
+	Approve(ctx context.Context, req *Request) (approved bool, err error)
+}
+
+// A Rule designates sensitive operations. It matches operations of the given
+// type on the dn or any entry below it. Modify rules can be narrowed down to
+// changes of the listed attributes.
+type Rule struct {
+	Operation  string   `json:"operation"`
+	DN         string   `json:"dn"`
+	Attributes []string `json:"attributes"`
+}
+
+type Config struct {
+	Rules   []Rule `json:"rules"`
+	Webhook string `json:"webhook"`
+	Timeout string `json:"timeout"`
+}
+
+// A Guard asks the approver for operations matching one of the rules.
+type Guard struct {
+	rules    []Rule
+	approver Approver
+	timeout  time.Duration
+}
+
+// New creates the guard for the configuration. Without a webhook the requests
+// are held as DefaultPending until an operator decides on them.
+func New(config *Config) (*Guard, error) {
+	timeout := 5 * time.Minute
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var approver Approver = DefaultPending
+	if config.Webhook != "" {
+		approver = NewWebhookApprover(config.Webhook, timeout)
+	}
+
+	guard := NewGuard(config.Rules, approver)
+	guard.timeout = timeout
+	return guard, nil
+}
+
+func NewGuard(rules []Rule, approver Approver) *Guard {
+	return &Guard{
+		rules:    rules,
+		approver: approver,
+	}
+}
+
+// Pending returns the pending requests if the guard waits for operator
+// decisions, nil otherwise.
+func (guard *Guard) Pending() *Pending {
+	if guard == nil {
+		return nil
+	}
+
+	pending, _ := guard.approver.(*Pending)
+	return pending
+}
+
+// Check returns nil if the operation doesn't require approval or has been
+// approved, ErrDenied if it was rejected.
+func (guard *Guard) Check(ctx context.Context, req *Request) error {
+	if guard == nil || !guard.requiresApproval(req) {
+		return nil
+	}
+
+	if guard.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, guard.timeout)
+		defer cancel()
+	}
+
+	approved, err := guard.approver.Approve(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return ErrDenied
+	}
+
+	return nil
+}
+
+func (guard *Guard) requiresApproval(req *Request) bool {
+	for _, rule := range guard.rules {
+		if rule.matches(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule *Rule) matches(req *Request) bool {
+	if !strings.EqualFold(rule.Operation, req.Operation) {
+		return false
+	}
+
+	if !isBelow(req.DN, rule.DN) {
+		return false
+	}
+
+	if len(rule.Attributes) == 0 {
+		return true
+	}
+
+	for _, attribute := range req.Attributes {
+		for _, sensitive := range rule.Attributes {
+			if strings.EqualFold(attribute, sensitive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isBelow(dn string, base string) bool {
+	return base == "" || util.IsBelowDN(dn, base)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testApprover struct {
+	lastRequest *Request
+	approved    bool
+}
+
+func (approver *testApprover) Approve(ctx context.Context, req *Request) (bool, error) {
+	approver.lastRequest = req
+
+	return approver.approved, nil
+}
+
+func TestGuard_Check(t *testing.T) {
+	Convey("Given a guard for subtree deletes and admin group modifications", t, func() {
+		approver := &testApprover{}
+		guard := NewGuard([]Rule{
+			{Operation: OperationDelete, DN: "ou=People,dc=example,dc=com"},
+			{Operation: OperationModify, DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: []string{"member"}},
+		}, approver)
+
+		Convey("When an entry of the subtree is deleted", func() {
+			err := guard.Check(context.Background(), &Request{Operation: OperationDelete, DN: "uid=user1, ou=people,dc=example,dc=com"})
+
+			Convey("Then the approver is asked", func() {
+				So(err, ShouldEqual, ErrDenied)
+				So(approver.lastRequest, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the membership of the admin group is modified and approved", func() {
+			approver.approved = true
+			err := guard.Check(context.Background(), &Request{Operation: OperationModify, DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: []string{"Member"}})
+
+			Convey("Then the operation may be forwarded", func() {
+				So(err, ShouldBeNil)
+				So(approver.lastRequest, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When another attribute of the admin group is modified", func() {
+			err := guard.Check(context.Background(), &Request{Operation: OperationModify, DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: []string{"description"}})
+
+			Convey("Then no approval is required", func() {
+				So(err, ShouldBeNil)
+				So(approver.lastRequest, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given no guard", t, func() {
+		var guard *Guard
+
+		Convey("Then every operation may be forwarded", func() {
+			So(guard.Check(context.Background(), &Request{Operation: OperationDelete}), ShouldBeNil)
+		})
+	})
+}
+
+func TestPending(t *testing.T) {
+	Convey("Given a pending approver", t, func() {
+		pending := NewPending()
+
+		Convey("When an operator approves a waiting request", func() {
+			go func() {
+				for len(pending.List()) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				pending.Decide(pending.List()[0].Id, true)
+			}()
+
+			approved, err := pending.Approve(context.Background(), &Request{Operation: OperationDelete})
+
+			Convey("Then the request is approved", func() {
+				So(err, ShouldBeNil)
+				So(approved, ShouldBeTrue)
+				So(pending.List(), ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When nobody decides in time", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			approved, err := pending.Approve(ctx, &Request{Operation: OperationDelete})
+
+			Convey("Then the request is rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(approved, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestWebhookApprover(t *testing.T) {
+	Convey("Given a webhook approving deletes", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &Request{}
+			json.NewDecoder(r.Body).Decode(req)
+			json.NewEncoder(w).Encode(&webhookResponse{Approved: req.Operation == OperationDelete})
+		}))
+		defer server.Close()
+
+		approver := NewWebhookApprover(server.URL, time.Second)
+
+		Convey("Then deletes are approved and modifications are not", func() {
+			approved, err := approver.Approve(context.Background(), &Request{Operation: OperationDelete})
+			So(err, ShouldBeNil)
+			So(approved, ShouldBeTrue)
+
+			approved, err = approver.Approve(context.Background(), &Request{Operation: OperationModify})
+			So(err, ShouldBeNil)
+			So(approved, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package approval
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrUnknownRequest = errors.New("approval: unknown request")
+)
+
+// DefaultPending holds the requests of the guards without webhook. It's kept
+// by a reload, so requests waiting during a reload can still be decided on.
+var DefaultPending = NewPending()
+
+// Pending is an approver holding the requests until an operator decides on
+// them, e.g. through an admin interface. Requests not decided on before the
+// context is done are rejected.
+type Pending struct {
+	counter int64
+
+	mutex    sync.Mutex
+	requests map[string]*pendingRequest
+}
+
+type pendingRequest struct {
+	request  *Request
+	decision chan bool
+}
+
+func NewPending() *Pending {
+	return &Pending{
+		requests: make(map[string]*pendingRequest),
+	}
+}
+
+func (pending *Pending) Approve(ctx context.Context, req *Request) (bool, error) {
+	req.Id = strconv.FormatInt(atomic.AddInt64(&pending.counter, 1), 10)
+	p := &pendingRequest{
+		request:  req,
+		decision: make(chan bool, 1),
+	}
+
+	pending.mutex.Lock()
+	pending.requests[req.Id] = p
+	pending.mutex.Unlock()
+
+	defer func() {
+		pending.mutex.Lock()
+		delete(pending.requests, req.Id)
+		pending.mutex.Unlock()
+	}()
+
+	select {
+	case approved := <-p.decision:
+		return approved, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// List returns the requests waiting for a decision.
+func (pending *Pending) List() []*Request {
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+
+	requests := []*Request{}
+	for _, p := range pending.requests {
+		requests = append(requests, p.request)
+	}
+
+	return requests
+}
+
+// Decide approves or rejects the request with the given id.
+func (pending *Pending) Decide(id string, approved bool) error {
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+
+	p, ok := pending.requests[id]
+	if !ok {
+		return ErrUnknownRequest
+	}
+
+	delete(pending.requests, id)
+	p.decision <- approved
+	return nil
+}
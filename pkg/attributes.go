@@ -0,0 +1,91 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+const (
+	allUserAttributes        = "*"
+	allOperationalAttributes = "+"
+	noAttributes             = "1.1"
+)
+
+// The operational attributes (lower case) only returned if requested by name
+// or with `+`.
+var operationalAttributes = map[string]bool{
+	"createtimestamp":       true,
+	"modifytimestamp":       true,
+	"creatorsname":          true,
+	"modifiersname":         true,
+	"entryuuid":             true,
+	"entrydn":               true,
+	"entrycsn":              true,
+	"hassubordinates":       true,
+	"subschemasubentry":     true,
+	"structuralobjectclass": true,
+	"pwdchangedtime":        true,
+	"pwdaccountlockedtime":  true,
+}
+
+// selectAttributes returns the user with the attributes requested by a
+// search: all user attributes if none or `*` is requested, all operational
+// attributes with `+` and none if only `1.1` is requested.
+func selectAttributes(user *User, requested map[string]bool) *User {
+	allUser, allOperational := len(requested) == 0, false
+	wanted := make(map[string]bool)
+	for name := range requested {
+		switch name {
+		case allUserAttributes:
+			allUser = true
+		case allOperationalAttributes:
+			allOperational = true
+		case noAttributes:
+		default:
+			wanted[strings.ToLower(name)] = true
+		}
+	}
+
+	attributes := make(map[string][]string)
+	for name, values := range user.Attributes {
+		key := strings.ToLower(name)
+		operational := operationalAttributes[key]
+		if wanted[key] || (allUser && !operational) || (allOperational && operational) {
+			attributes[name] = values
+		}
+	}
+
+	return &User{DN: user.DN, Attributes: attributes}
+}
+
+// typesOnly drops the values of the attributes of the result if only the
+// attribute descriptions are requested
+func typesOnly(result *ldap.SearchResult, typesOnly bool) *ldap.SearchResult {
+	if typesOnly {
+		for name := range result.Attributes {
+			result.Attributes[name] = [][]byte{}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,97 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSelectAttributes(t *testing.T) {
+	Convey("Given an entry with user and operational attributes", t, func() {
+		user := &User{
+			DN: "uid=a,dc=example,dc=com",
+			Attributes: map[string][]string{
+				"cn":              {"a"},
+				"mail":            {"a@example.com"},
+				"modifyTimestamp": {"20171010120000Z"},
+			},
+		}
+
+		Convey("When no attributes are requested", func() {
+			selected := selectAttributes(user, nil)
+
+			Convey("Then all user attributes are returned", func() {
+				So(selected.Attributes, ShouldResemble, map[string][]string{"cn": {"a"}, "mail": {"a@example.com"}})
+			})
+		})
+
+		Convey("When attributes are requested by name in another case", func() {
+			selected := selectAttributes(user, map[string]bool{"CN": true, "modifytimestamp": true})
+
+			Convey("Then only these are returned", func() {
+				So(selected.Attributes, ShouldResemble, map[string][]string{"cn": {"a"}, "modifyTimestamp": {"20171010120000Z"}})
+			})
+		})
+
+		Convey("When the operational attributes are requested", func() {
+			selected := selectAttributes(user, map[string]bool{"+": true, "*": true})
+
+			Convey("Then all attributes are returned", func() {
+				So(selected.Attributes, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When no attributes are requested with 1.1", func() {
+			selected := selectAttributes(user, map[string]bool{"1.1": true})
+
+			Convey("Then only the dn is returned", func() {
+				So(selected.DN, ShouldEqual, user.DN)
+				So(selected.Attributes, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_TypesOnly(t *testing.T) {
+	Convey("Given a ldap proxy with an entry", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{user: []*User{{DN: "uid=a,dc=example,dc=com", Attributes: map[string][]string{"cn": {"a"}}}}})
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When only the attribute types are requested", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, TypesOnly: true})
+
+			Convey("Then the attributes are returned without values", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes, ShouldResemble, map[string][][]byte{"cn": {}})
+			})
+		})
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"io"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	OutputStdout = "stdout"
+	OutputSyslog = "syslog"
+)
+
+var defaultRedacted = []string{"userPassword", "unicodePwd", "sambaNTPassword", "sambaLMPassword"}
+
+type Config struct {
+	// stdout (default), syslog or the path of a file the events are appended to.
+	Output string `json:"output"`
+
+	// The attributes whose values are redacted in the logged filters. Default
+	// are the common password attributes.
+	RedactAttributes []string `json:"redactAttributes"`
+}
+
+// An Event is a request of a client with its outcome, logged as a json line.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Session   int64     `json:"session"`
+	Request   string    `json:"request,omitempty"`
+	Operation string    `json:"operation"`
+	Client    string    `json:"client,omitempty"`
+
+	// The location of the client if geoip databases are configured.
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+
+	// The bound dn after the request, the dn the request is about and the
+	// backend which answered it.
+	DN      string `json:"dn,omitempty"`
+	Target  string `json:"target,omitempty"`
+	Filter  string `json:"filter,omitempty"`
+	Backend string `json:"backend,omitempty"`
+
+	Result  ldap.ResultCode `json:"result"`
+	Message string          `json:"message,omitempty"`
+	Entries int             `json:"entries,omitempty"`
+	Latency float64         `json:"latencyMs"`
+
+	// Set if the request was answered from the offline caches while no
+	// backend could be reached.
+	Offline bool `json:"offline,omitempty"`
+}
+
+// A Logger writes the audit events, separate from the debug log. All methods
+// may be called on a nil logger, which drops the events.
+type Logger struct {
+	redacted []string
+
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func New(config *Config) (*Logger, error) {
+	logger := &Logger{
+		redacted: config.RedactAttributes,
+	}
+	if logger.redacted == nil {
+		logger.redacted = defaultRedacted
+	}
+
+	switch config.Output {
+	case "", OutputStdout:
+		logger.writer = os.Stdout
+	case OutputSyslog:
+		writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "ldap-proxy")
+		if err != nil {
+			return nil, fmt.Errorf("audit: connecting to syslog failed: %v", err)
+		}
+		logger.writer = writer
+	default:
+		file, err := os.OpenFile(config.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("audit: opening '%s' failed: %v", config.Output, err)
+		}
+		logger.writer = file
+	}
+
+	return logger, nil
+}
+
+// Filter renders the filter of an event with the redacted attributes.
+func (logger *Logger) Filter(f ldap.Filter) string {
+	if logger == nil || f == nil {
+		return ""
+	}
+
+	return filter.Redacted(f, logger.redacted)
+}
+
+func (logger *Logger) Log(event *Event) {
+	if logger == nil {
+		return
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.writer.Write(append(line, '\n'))
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	Convey("Given a logger writing to a buffer", t, func() {
+		logger, err := New(&Config{})
+		So(err, ShouldBeNil)
+
+		buffer := &bytes.Buffer{}
+		logger.writer = buffer
+
+		Convey("When an event is logged", func() {
+			logger.Log(&Event{
+				Time:      time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC),
+				Session:   3,
+				Operation: "bind",
+				Client:    "10.0.0.12:40000",
+				Target:    "uid=jdoe,ou=People,dc=example,dc=com",
+				Result:    ldap.ResultInvalidCredentials,
+				Latency:   1.5,
+			})
+
+			Convey("Then it is written as a json line", func() {
+				So(buffer.String(), ShouldEndWith, "\n")
+
+				var event Event
+				So(json.Unmarshal(buffer.Bytes(), &event), ShouldBeNil)
+				So(event.Operation, ShouldEqual, "bind")
+				So(event.Target, ShouldEqual, "uid=jdoe,ou=People,dc=example,dc=com")
+				So(event.Result, ShouldEqual, ldap.ResultInvalidCredentials)
+			})
+		})
+
+		Convey("When a filter asserting a password is rendered", func() {
+			f, _ := filter.Parse("(&(uid=jdoe)(userPassword=secret))")
+
+			Convey("Then the password is redacted", func() {
+				So(logger.Filter(f), ShouldEqual, "(&(uid=jdoe)(userPassword=***))")
+			})
+		})
+	})
+
+	Convey("Given a nil logger", t, func() {
+		var logger *Logger
+
+		Convey("Then events are dropped", func() {
+			So(func() { logger.Log(&Event{}) }, ShouldNotPanic)
+		})
+	})
+}
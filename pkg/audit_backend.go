@@ -0,0 +1,187 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/audit"
+	"github.com/samuel/go-ldap/ldap"
+	"time"
+)
+
+// auditBackend records the binds, searches and writes of the clients with
+// their result in the audit log of the proxy
+type auditBackend struct {
+	ldap.Backend
+	proxy *LdapProxy
+}
+
+func (ldapProxy *LdapProxy) audited(backend ldap.Backend) ldap.Backend {
+	return &auditBackend{
+		Backend: backend,
+		proxy:   ldapProxy,
+	}
+}
+
+func (backend *auditBackend) Bind(ctx ldap.Context, req *ldap.BindRequest) (*ldap.BindResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.Bind(ctx, req)
+
+	event := &audit.Event{Operation: "bind", Target: req.DN}
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+		event.Message = res.Message
+	}
+	event.Result = resultCode(base, err)
+	backend.record(ctx, event, start)
+
+	return res, err
+}
+
+func (backend *auditBackend) Search(ctx ldap.Context, req *ldap.SearchRequest) (*ldap.SearchResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.Search(ctx, req)
+
+	event := &audit.Event{Operation: "search", Target: req.BaseDN, Filter: backend.proxy.current().config.Audit.Filter(req.Filter)}
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+		event.Entries = len(res.Results)
+	}
+	event.Result = resultCode(base, err)
+	backend.record(ctx, event, start)
+
+	return res, err
+}
+
+func (backend *auditBackend) Add(ctx ldap.Context, req *ldap.AddRequest) (*ldap.AddResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.Add(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	backend.recordWrite(ctx, actionAdd, req.DN, resultCode(base, err), start)
+
+	return res, err
+}
+
+func (backend *auditBackend) Modify(ctx ldap.Context, req *ldap.ModifyRequest) (*ldap.ModifyResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.Modify(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	backend.recordWrite(ctx, actionModify, req.DN, resultCode(base, err), start)
+
+	return res, err
+}
+
+func (backend *auditBackend) Delete(ctx ldap.Context, req *ldap.DeleteRequest) (*ldap.DeleteResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.Delete(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	backend.recordWrite(ctx, actionDelete, req.DN, resultCode(base, err), start)
+
+	return res, err
+}
+
+func (backend *auditBackend) ModifyDN(ctx ldap.Context, req *ldap.ModifyDNRequest) (*ldap.ModifyDNResponse, error) {
+	start := time.Now()
+	res, err := backend.Backend.ModifyDN(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	backend.recordWrite(ctx, actionModifyDN, req.DN, resultCode(base, err), start)
+
+	return res, err
+}
+
+func (backend *auditBackend) PasswordModify(ctx ldap.Context, req *ldap.PasswordModifyRequest) ([]byte, error) {
+	start := time.Now()
+	generated, err := backend.Backend.PasswordModify(ctx, req)
+
+	backend.record(ctx, &audit.Event{Operation: "password_modify", Target: req.UserIdentity, Result: resultCode(nil, err)}, start)
+
+	return generated, err
+}
+
+func (backend *auditBackend) recordWrite(ctx ldap.Context, action string, dn string, result ldap.ResultCode, start time.Time) {
+	event := &audit.Event{Operation: action, Target: dn, Result: result}
+	if writer, ok := backend.proxy.current().writerBackend(dn); ok {
+		event.Backend = writer.Name()
+	}
+
+	backend.record(ctx, event, start)
+}
+
+// record completes the event with the session and the latency
+func (backend *auditBackend) record(ctx ldap.Context, event *audit.Event, start time.Time) {
+	logger := backend.proxy.current().config.Audit
+	sess, ok := sessionOf(ctx)
+	if logger == nil || !ok {
+		return
+	}
+
+	event.Time = start
+	event.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	event.Session = getId(sess.context)
+	event.Request = requestId(ctx)
+	event.Offline = servedOffline(ctx)
+	event.DN = getDn(sess.context)
+	if event.Backend == "" {
+		event.Backend = getBackend(sess.context)
+	}
+	if addr := getRemoteAddr(sess.context); addr != nil {
+		event.Client = addr.String()
+	}
+	if location := getLocation(sess.context); location != nil {
+		event.Country = location.Country
+		event.ASN = location.ASN
+	}
+
+	logger.Log(event)
+}
+
+// resultCode is the result of a response, errors returned as response keep
+// their code
+func resultCode(res *ldap.BaseResponse, err error) ldap.ResultCode {
+	if response, ok := err.(*ldap.BaseResponse); ok {
+		return response.Code
+	}
+	if err != nil {
+		return ldap.ResultOperationsError
+	}
+	if res == nil {
+		return ldap.ResultSuccess
+	}
+
+	return res.Code
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg/audit"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditBackend(t *testing.T) {
+	Convey("Given a ldap proxy writing the audit log to a file", t, func() {
+		dir, err := ioutil.TempDir("", "audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "audit.log")
+		logger, err := audit.New(&audit.Config{Output: file})
+		So(err, ShouldBeNil)
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{result: true, user: []*User{{DN: "uid=jdoe,ou=People,dc=example,dc=com"}}})
+		config := DefaultProxyConfig()
+		config.Audit = logger
+		proxy.Configure(config)
+
+		backend := proxy.audited(proxy)
+		ctx, _ := backend.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000})
+
+		events := func() []*audit.Event {
+			content, err := ioutil.ReadFile(file)
+			So(err, ShouldBeNil)
+
+			var events []*audit.Event
+			for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+				event := &audit.Event{}
+				So(json.Unmarshal([]byte(line), event), ShouldBeNil)
+				events = append(events, event)
+			}
+			return events
+		}
+
+		Convey("When a client binds and searches", func() {
+			backend.Bind(ctx, &ldap.BindRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com", Password: []byte("secure")})
+			f, _ := filter.Parse("(&(uid=jdoe)(userPassword=secret))")
+			backend.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: f})
+
+			Convey("Then both requests are recorded with their result", func() {
+				logged := events()
+				So(logged, ShouldHaveLength, 2)
+
+				So(logged[0].Operation, ShouldEqual, "bind")
+				So(logged[0].Client, ShouldEqual, "10.0.0.12:40000")
+				So(logged[0].Target, ShouldEqual, "uid=jdoe,ou=People,dc=example,dc=com")
+				So(logged[0].Backend, ShouldEqual, "test")
+				So(logged[0].Result, ShouldEqual, ldap.ResultSuccess)
+
+				So(logged[1].Operation, ShouldEqual, "search")
+				So(logged[1].DN, ShouldEqual, "uid=jdoe,ou=People,dc=example,dc=com")
+				So(logged[1].Filter, ShouldEqual, "(&(uid=jdoe)(userPassword=***))")
+				So(logged[1].Entries, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When an anonymous client deletes an entry", func() {
+			backend.Delete(ctx, &ldap.DeleteRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com"})
+
+			Convey("Then the refused write is recorded", func() {
+				logged := events()
+				So(logged, ShouldHaveLength, 1)
+				So(logged[0].Operation, ShouldEqual, actionDelete)
+				So(logged[0].Result, ShouldNotEqual, ldap.ResultSuccess)
+			})
+		})
+	})
+}
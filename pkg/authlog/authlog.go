@@ -0,0 +1,129 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package authlog
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	OutputStdout = "stdout"
+	OutputSyslog = "syslog"
+)
+
+// the reasons binds fail
+const (
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonLockedOut          = "locked_out"
+	ReasonUnauthenticated    = "unauthenticated"
+	ReasonInvalidOTP         = "invalid_otp"
+	ReasonNotEnrolled        = "not_enrolled"
+	ReasonMFADenied          = "mfa_denied"
+	ReasonAccountLocked      = "account_locked"
+	ReasonAccountDisabled    = "account_disabled"
+)
+
+type Config struct {
+	// stdout (default), syslog or the path of a file the failures are
+	// appended to.
+	Output string `json:"output"`
+}
+
+// A Logger writes every failed bind as a single line in a stable format for
+// fail2ban or CrowdSec:
+//
+//	2017-10-14T12:00:00Z ldap-proxy: authentication failure; reason=invalid_credentials rhost=192.0.2.1 dn="uid=jdoe,dc=example,dc=com"
+//
+// All methods may be called on a nil logger, which drops the failures.
+type Logger struct {
+	now func() time.Time
+
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func New(config *Config) (*Logger, error) {
+	logger := &Logger{now: time.Now}
+
+	switch config.Output {
+	case "", OutputStdout:
+		logger.writer = os.Stdout
+	case OutputSyslog:
+		writer, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_AUTH, "ldap-proxy")
+		if err != nil {
+			return nil, fmt.Errorf("authlog: connecting to syslog failed: %v", err)
+		}
+		logger.writer = writer
+	default:
+		file, err := os.OpenFile(config.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("authlog: opening '%s' failed: %v", config.Output, err)
+		}
+		logger.writer = file
+	}
+
+	return logger, nil
+}
+
+// Failure logs the failed bind of the dn from the address. The dn is quoted, so
+// a line never contains a line break of a client. The id of the request is
+// appended quoted if known, so the line still ends with a quote.
+func (logger *Logger) Failure(addr net.Addr, dn string, reason string, request string) {
+	if logger == nil {
+		return
+	}
+
+	line := fmt.Sprintf("%s ldap-proxy: authentication failure; reason=%s rhost=%s dn=%s",
+		logger.now().UTC().Format(time.RFC3339), reason, host(addr), strconv.Quote(dn))
+	if request != "" {
+		line += " request=" + strconv.Quote(request)
+	}
+	line += "\n"
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	io.WriteString(logger.writer, line)
+}
+
+// host returns the ip of the address without port, `-` if it's unknown
+func host(addr net.Addr) string {
+	if addr == nil {
+		return "-"
+	}
+
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+
+	if h, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return h
+	}
+
+	return addr.String()
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package authlog
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	Convey("Given a logger writing to a buffer", t, func() {
+		buffer := &bytes.Buffer{}
+		logger := &Logger{
+			writer: buffer,
+			now:    func() time.Time { return time.Date(2017, 10, 14, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60)) },
+		}
+
+		Convey("When a bind fails", func() {
+			logger.Failure(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50123}, "uid=jdoe,dc=example,dc=com", ReasonInvalidCredentials, "")
+
+			Convey("Then a line with the time in utc, the ip and the dn is written", func() {
+				So(buffer.String(), ShouldEqual, "2017-10-14T12:00:00Z ldap-proxy: authentication failure; reason=invalid_credentials rhost=192.0.2.1 dn=\"uid=jdoe,dc=example,dc=com\"\n")
+			})
+		})
+
+		Convey("When a bind of a request fails", func() {
+			logger.Failure(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50123}, "uid=jdoe,dc=example,dc=com", ReasonInvalidCredentials, "42-7")
+
+			Convey("Then the quoted request id ends the line", func() {
+				So(buffer.String(), ShouldEqual, "2017-10-14T12:00:00Z ldap-proxy: authentication failure; reason=invalid_credentials rhost=192.0.2.1 dn=\"uid=jdoe,dc=example,dc=com\" request=\"42-7\"\n")
+			})
+		})
+
+		Convey("When the dn contains a line break", func() {
+			logger.Failure(nil, "uid=a\n2017-10-14T12:00:00Z forged", ReasonLockedOut, "")
+
+			Convey("Then it is quoted on the same line", func() {
+				So(buffer.String(), ShouldEqual, "2017-10-14T12:00:00Z ldap-proxy: authentication failure; reason=locked_out rhost=- dn=\"uid=a\\n2017-10-14T12:00:00Z forged\"\n")
+			})
+		})
+	})
+
+	Convey("Given a nil logger", t, func() {
+		var logger *Logger
+
+		Convey("Then failures are dropped", func() {
+			So(func() { logger.Failure(nil, "", ReasonUnauthenticated, "") }, ShouldNotPanic)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"strings"
+)
+
+// An AuthzIdFormat defines how the whoami operation returns the
+// authorization identity of a session (RFC 4532). Anonymous sessions always
+// get an empty identity.
+type AuthzIdFormat string
+
+const (
+	// AuthzIdDN returns the bound dn prefixed with "dn:".
+	AuthzIdDN = AuthzIdFormat("dn")
+	// AuthzIdUser returns the value of the first rdn of the bound dn prefixed
+	// with "u:", e.g. "u:jdoe" for "uid=jdoe,ou=People,dc=example,dc=com".
+	AuthzIdUser = AuthzIdFormat("u")
+	// AuthzIdRaw returns the bound dn without prefix like former versions.
+	AuthzIdRaw = AuthzIdFormat("raw")
+)
+
+func ParseAuthzIdFormat(value string) (AuthzIdFormat, error) {
+	switch format := AuthzIdFormat(value); format {
+	case AuthzIdDN, AuthzIdUser, AuthzIdRaw:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("proxy: unknown authzId format '%s'", value)
+}
+
+// authzId returns the authorization identity of the bound dn
+func (format AuthzIdFormat) authzId(dn string) string {
+	if dn == "" {
+		return ""
+	}
+
+	switch format {
+	case AuthzIdUser:
+		rdn := util.SplitDN(dn)[0]
+		if i := strings.Index(rdn, "="); i >= 0 {
+			rdn = rdn[i+1:]
+		}
+		return "u:" + strings.TrimSpace(rdn)
+	case AuthzIdRaw:
+		return dn
+	}
+
+	return "dn:" + dn
+}
@@ -0,0 +1,57 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAuthzIdFormat(t *testing.T) {
+	Convey("Given a bound dn", t, func() {
+		dn := "uid=jdoe,ou=People,dc=example,dc=com"
+
+		Convey("Then the identity is formatted", func() {
+			So(AuthzIdDN.authzId(dn), ShouldEqual, "dn:uid=jdoe,ou=People,dc=example,dc=com")
+			So(AuthzIdUser.authzId(dn), ShouldEqual, "u:jdoe")
+			So(AuthzIdUser.authzId("jdoe"), ShouldEqual, "u:jdoe")
+			So(AuthzIdRaw.authzId(dn), ShouldEqual, dn)
+		})
+
+		Convey("Then anonymous sessions have an empty identity", func() {
+			So(AuthzIdDN.authzId(""), ShouldBeBlank)
+			So(AuthzIdUser.authzId(""), ShouldBeBlank)
+		})
+	})
+
+	Convey("Given the name of a format", t, func() {
+		Convey("Then known formats are parsed", func() {
+			format, err := ParseAuthzIdFormat("u")
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, AuthzIdUser)
+		})
+
+		Convey("Then unknown formats are rejected", func() {
+			_, err := ParseAuthzIdFormat("email")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
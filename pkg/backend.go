@@ -35,6 +35,19 @@ type User struct {
 
 var (
 	ErrInvalidConfigType = errors.New("ldap-proxy: invalid configuration object type")
+
+	// Returned when removing or replacing a backend the proxy doesn't have.
+	ErrUnknownBackend = errors.New("ldap-proxy: unknown backend")
+
+	// Returned by backends which currently refuse calls, e.g. because the
+	// upstream is known to be down. The proxy skips these backends.
+	ErrBackendUnavailable = errors.New("ldap-proxy: backend unavailable")
+
+	// Returned by writer backends refusing a write.
+	ErrEntryExists        = errors.New("ldap-proxy: entry already exists")
+	ErrNoSuchEntry        = errors.New("ldap-proxy: no such entry")
+	ErrUnwillingToPerform = errors.New("ldap-proxy: backend unwilling to perform")
+	ErrMoveUnsupported    = errors.New("ldap-proxy: backend can't move entries to another superior")
 )
 
 type BackendFactory interface {
@@ -49,6 +62,43 @@ type Backend interface {
 	GetUsers(ctx context.Context, f ldap.Filter) ([]*User, error)
 }
 
+// A PasswordBackend also changes the passwords of its users. The username is
+// the one passed to Authenticate.
+type PasswordBackend interface {
+	Backend
+	SetPassword(ctx context.Context, username string, password string) error
+}
+
+// An ErrorReportingBackend tells an unavailable upstream apart from refused
+// credentials, e.g. behind an open circuit. AuthenticateErr returns
+// ErrBackendUnavailable then, the proxy skips the backend like one which
+// timed out.
+type ErrorReportingBackend interface {
+	Backend
+	AuthenticateErr(ctx context.Context, username string, password string) (bool, error)
+}
+
+// Authenticate asks the backend to authenticate the user and returns the
+// error of an ErrorReportingBackend.
+func Authenticate(ctx context.Context, backend Backend, username string, password string) (bool, error) {
+	if reporting, ok := backend.(ErrorReportingBackend); ok {
+		return reporting.AuthenticateErr(ctx, username, password)
+	}
+
+	return backend.Authenticate(ctx, username, password), nil
+}
+
+// A WriterBackend also accepts writes of the entries below its naming
+// contexts. The proxy routes a write to the writer backend owning the
+// longest naming context of the dn.
+type WriterBackend interface {
+	Backend
+	Add(ctx context.Context, entry *User) error
+	Modify(ctx context.Context, dn string, mods []*ldap.Mod) error
+	Delete(ctx context.Context, dn string) error
+	ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error
+}
+
 type Config struct {
 	Name        string `json:"name"`
 	DNAttribute string `json:"dnAttribute"`
@@ -23,28 +23,63 @@ package pkg
 import (
 	"context"
 	"github.com/samuel/go-ldap/ldap"
+	"sync/atomic"
+	"time"
 )
 
 type testBackend struct {
+	name string
+
 	lastUsername string
 	lastPassword string
+	lastRequest  string
 
 	result bool
 
-	user []*User
+	user      []*User
+	delay     time.Duration
+	authDelay time.Duration
+	err       error
+	calls     int32
 }
 
 func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
 	backend.lastUsername = username
 	backend.lastPassword = password
+	backend.lastRequest = RequestId(ctx)
+
+	select {
+	case <-time.After(backend.authDelay):
+	case <-ctx.Done():
+		return false
+	}
 
 	return backend.result
 }
 
+func (backend *testBackend) SetPassword(ctx context.Context, username string, password string) error {
+	backend.lastUsername = username
+	backend.lastPassword = password
+
+	return backend.err
+}
+
 func (backend *testBackend) Name() (name string) {
+	if backend.name != "" {
+		return backend.name
+	}
+
 	return "test"
 }
 
 func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*User, error) {
-	return backend.user, nil
+	atomic.AddInt32(&backend.calls, 1)
+
+	select {
+	case <-time.After(backend.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return backend.user, backend.err
 }
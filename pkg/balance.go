@@ -0,0 +1,164 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"math/rand"
+)
+
+const (
+	replicaSuccess     = "success"
+	replicaFailure     = "failure"
+	replicaError       = "error"
+	replicaTimeout     = "timeout"
+	replicaUnavailable = "unavailable"
+)
+
+// chooses the replica of a group, replaced by tests
+var randomIntn = rand.Intn
+
+// searchTargets lists the enabled backends queried by a search. With session
+// affinity only the backend which authenticated the session is queried.
+// Otherwise backends without a replica group are a target on their own, the
+// replicas of a group form a single target ordered by weight.
+func (ldapProxy *LdapProxy) searchTargets(ctx context.Context) [][]Backend {
+	if ldapProxy.config.SessionAffinity {
+		if backend, ok := ldapProxy.backends[getBackend(ctx)]; ok && ldapProxy.isEnabled(backend.Name()) {
+			return [][]Backend{{backend}}
+		}
+	}
+
+	return ldapProxy.groupTargets(func(group string) bool { return true }, ldapProxy.weight)
+}
+
+// authTargets lists the enabled backends asked to authenticate a bind. The
+// replicas of a group splitting binds form a single target ordered by bind
+// weight, the replicas of other groups are asked one after another.
+func (ldapProxy *LdapProxy) authTargets() [][]Backend {
+	return ldapProxy.groupTargets(ldapProxy.splitsBinds, ldapProxy.bindWeight)
+}
+
+// groupTargets combines the enabled replicas of the grouped replica groups to
+// a single target ordered by weight.
+func (ldapProxy *LdapProxy) groupTargets(grouped func(group string) bool, weight func(backend Backend) int) [][]Backend {
+	var targets [][]Backend
+	groups := make(map[string]int)
+
+	for _, backend := range ldapProxy.ordered {
+		if !ldapProxy.isEnabled(backend.Name()) {
+			continue
+		}
+
+		replica, ok := ldapProxy.config.Replicas[backend.Name()]
+		if !ok || replica.Group == "" || !grouped(replica.Group) {
+			targets = append(targets, []Backend{backend})
+			continue
+		}
+
+		if i, ok := groups[replica.Group]; ok {
+			targets[i] = append(targets[i], backend)
+			continue
+		}
+
+		groups[replica.Group] = len(targets)
+		targets = append(targets, []Backend{backend})
+	}
+
+	for _, i := range groups {
+		targets[i] = weightedOrder(targets[i], weight)
+	}
+
+	return targets
+}
+
+// weightedOrder shuffles the replicas, a replica is chosen first with a
+// probability proportional to its weight
+func weightedOrder(replicas []Backend, weight func(backend Backend) int) []Backend {
+	remaining := append([]Backend(nil), replicas...)
+	ordered := make([]Backend, 0, len(replicas))
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, backend := range remaining {
+			total += weight(backend)
+		}
+
+		pick := randomIntn(total)
+		for i, backend := range remaining {
+			pick -= weight(backend)
+			if pick < 0 {
+				ordered = append(ordered, backend)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return ordered
+}
+
+func (ldapProxy *LdapProxy) weight(backend Backend) int {
+	if weight := ldapProxy.config.Replicas[backend.Name()].Weight; weight > 0 {
+		return weight
+	}
+
+	return 1
+}
+
+func (ldapProxy *LdapProxy) bindWeight(backend Backend) int {
+	if weight := ldapProxy.config.Replicas[backend.Name()].BindWeight; weight > 0 {
+		return weight
+	}
+
+	return 1
+}
+
+// splitsBinds reports whether the binds of the replica group are distributed
+// by weight, which is the case once a replica has a bind weight.
+func (ldapProxy *LdapProxy) splitsBinds(group string) bool {
+	for _, replica := range ldapProxy.config.Replicas {
+		if replica.Group == group && replica.BindWeight > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// observeReplica counts the outcome of a call of a replica, so the replicas of
+// a group (e.g. the old and the new directory during a migration) can be
+// compared.
+func (ldapProxy *LdapProxy) observeReplica(backend Backend, action string, result string, entries int) {
+	replica, ok := ldapProxy.config.Replicas[backend.Name()]
+	if !ok || replica.Group == "" {
+		return
+	}
+
+	labels := prometheus.Labels{"group": replica.Group, "backend": backend.Name(), "action": action}
+	labels["result"] = result
+	replicaRequestsTotal.With(labels).Inc()
+
+	if entries > 0 {
+		replicaEntriesTotal.With(prometheus.Labels{"group": replica.Group, "backend": backend.Name()}).Add(float64(entries))
+	}
+}
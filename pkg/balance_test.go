@@ -0,0 +1,195 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLdapProxy_SearchReplicas(t *testing.T) {
+	Convey("Given a ldap proxy with two weighted replicas and a standalone backend", t, func() {
+		a := &testBackend{name: "a", user: []*User{{DN: "cn=a"}}}
+		b := &testBackend{name: "b", user: []*User{{DN: "cn=b"}}}
+		c := &testBackend{name: "c", user: []*User{{DN: "cn=c"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(a, b, c)
+
+		config := DefaultProxyConfig()
+		config.Replicas = map[string]Replica{
+			"a": {Group: "corp", Weight: 3},
+			"b": {Group: "corp", Weight: 1},
+		}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		var totals []int
+		randomIntn = func(n int) int {
+			totals = append(totals, n)
+			return 3 % n
+		}
+		Reset(func() {
+			randomIntn = rand.Intn
+		})
+
+		Convey("When there is a search request", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the replica chosen by weight and the standalone backend are queried", func() {
+				So(err, ShouldBeNil)
+				So(totals[0], ShouldEqual, 4)
+				So(resultDns(res), ShouldResemble, map[string]bool{"cn=b": true, "cn=c": true})
+			})
+		})
+
+		Convey("When the chosen replica is unavailable", func() {
+			b.err = ErrBackendUnavailable
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the other replica answers", func() {
+				So(err, ShouldBeNil)
+				So(resultDns(res), ShouldResemble, map[string]bool{"cn=a": true, "cn=c": true})
+			})
+		})
+	})
+}
+
+func TestLdapProxy_BindReplicas(t *testing.T) {
+	Convey("Given a ldap proxy with two replicas splitting binds by weight", t, func() {
+		a := &testBackend{name: "a", result: false}
+		b := &testBackend{name: "b", result: true}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(a, b)
+
+		config := DefaultProxyConfig()
+		config.BackendTimeout = 20 * time.Millisecond
+		config.Replicas = map[string]Replica{
+			"a": {Group: "corp", BindWeight: 95},
+			"b": {Group: "corp", BindWeight: 5},
+		}
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		var totals []int
+		pick := 0
+		randomIntn = func(n int) int {
+			totals = append(totals, n)
+			return pick % n
+		}
+		Reset(func() {
+			randomIntn = rand.Intn
+		})
+
+		Convey("When the replica chosen by weight rejects the bind", func() {
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then its verdict is final", func() {
+				So(totals[0], ShouldEqual, 100)
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(b.lastUsername, ShouldEqual, "")
+			})
+		})
+
+		Convey("When the other replica is chosen", func() {
+			pick = 95
+
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then it authenticates the bind alone", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(a.lastUsername, ShouldEqual, "")
+			})
+		})
+
+		Convey("When the chosen replica times out", func() {
+			a.authDelay = time.Second
+
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the other replica decides", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_SearchAffinity(t *testing.T) {
+	Convey("Given a ldap proxy with session affinity and two backends", t, func() {
+		a := &testBackend{name: "a", result: false, user: []*User{{DN: "cn=a"}}}
+		b := &testBackend{name: "b", result: true, user: []*User{{DN: "cn=b"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(a, b)
+
+		config := DefaultProxyConfig()
+		config.SessionAffinity = true
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(context.Background())
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the session was authenticated by a backend", func() {
+			proxy.Bind(sess, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only this backend is searched", func() {
+				So(err, ShouldBeNil)
+				So(resultDns(res), ShouldResemble, map[string]bool{"cn=b": true})
+				So(a.calls, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the backend of the session was removed", func() {
+			sess.context = setBackend(setDn(sess.context, "cn=test"), "c")
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then all backends are searched", func() {
+				So(err, ShouldBeNil)
+				So(resultDns(res), ShouldResemble, map[string]bool{"cn=a": true, "cn=b": true})
+			})
+		})
+	})
+}
+
+func resultDns(res *ldap.SearchResponse) map[string]bool {
+	dns := make(map[string]bool)
+	for _, result := range res.Results {
+		dns[result.DN] = true
+	}
+
+	return dns
+}
@@ -0,0 +1,65 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_BindCache(t *testing.T) {
+	Convey("Given a ldap proxy with a bind cache and a cached bind", t, func() {
+		backend := &testBackend{result: true}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.BindCache, _ = bindcache.New("test", &bindcache.Config{})
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+		backend.lastUsername = ""
+
+		Convey("When the bind is repeated", func() {
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the backend isn't asked", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(backend.lastUsername, ShouldEqual, "")
+			})
+		})
+
+		Convey("When the password was modified", func() {
+			proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{})
+			backend.result = false
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the backend is asked again", func() {
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(backend.lastUsername, ShouldEqual, "cn=test")
+			})
+		})
+	})
+}
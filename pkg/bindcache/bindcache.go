@@ -0,0 +1,194 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package bindcache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/gob"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"golang.org/x/crypto/bcrypt"
+	"hash"
+)
+
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashBcrypt = "bcrypt"
+)
+
+type Config struct {
+	cache.Config
+
+	// The hash of the cached passwords: sha256 (default), sha512 or bcrypt.
+	Hash string `json:"hash"`
+}
+
+// A Cache remembers successful binds as the bind dn and a salted hash of the
+// password, so rapid re-binds don't reach the backends. All methods may be
+// called on a nil cache, which never verifies a bind.
+type Cache struct {
+	entries *cache.Cache
+	hash    string
+}
+
+// entry is exported to gob when the cache is shared.
+type entry struct {
+	Backend string
+	Salt    []byte
+	Sum     []byte
+}
+
+func init() {
+	gob.Register(&entry{})
+}
+
+// New creates a bind cache, the name labels its metrics.
+func New(name string, config *Config) (*Cache, error) {
+	if config.TTL == "" {
+		config.TTL = "30s"
+	}
+
+	entries, err := cache.New(name, &config.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	bindCache := &Cache{
+		entries: entries,
+		hash:    config.Hash,
+	}
+
+	switch bindCache.hash {
+	case "":
+		bindCache.hash = HashSHA256
+	case HashSHA256, HashSHA512, HashBcrypt:
+	default:
+		return nil, fmt.Errorf("bindcache: unknown hash '%s'", config.Hash)
+	}
+
+	return bindCache, nil
+}
+
+// Verify returns the backend which authenticated the dn with the password if
+// the bind is cached.
+func (bindCache *Cache) Verify(dn string, password string) (backend string, ok bool) {
+	if bindCache == nil {
+		return "", false
+	}
+
+	value, ok := bindCache.entries.Get(key(dn))
+	if !ok {
+		return "", false
+	}
+
+	cached := value.(*entry)
+	if bindCache.hash == HashBcrypt {
+		ok = bcrypt.CompareHashAndPassword(cached.Sum, []byte(password)) == nil
+	} else {
+		ok = subtle.ConstantTimeCompare(cached.Sum, bindCache.sum(cached.Salt, password)) == 1
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	return cached.Backend, true
+}
+
+// Add caches a successful bind.
+func (bindCache *Cache) Add(dn string, password string, backend string) {
+	if bindCache == nil {
+		return
+	}
+
+	cached := &entry{Backend: backend}
+	if bindCache.hash == HashBcrypt {
+		sum, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			return
+		}
+		cached.Sum = sum
+	} else {
+		cached.Salt = make([]byte, 16)
+		if _, err := rand.Read(cached.Salt); err != nil {
+			return
+		}
+		cached.Sum = bindCache.sum(cached.Salt, password)
+	}
+
+	bindCache.entries.Set(key(dn), cached)
+}
+
+// Invalidate drops the cached bind of the dn, e.g. after its password changed.
+func (bindCache *Cache) Invalidate(dn string) {
+	if bindCache == nil {
+		return
+	}
+
+	bindCache.entries.Delete(key(dn))
+}
+
+func (bindCache *Cache) Flush() {
+	if bindCache == nil {
+		return
+	}
+
+	bindCache.entries.Flush()
+}
+
+// Share keeps the cached binds in the store, see cache.Cache.Share.
+func (bindCache *Cache) Share(store cache.Store) {
+	if bindCache == nil {
+		return
+	}
+
+	bindCache.entries.Share(store)
+}
+
+func (bindCache *Cache) Stats() cache.Stats {
+	if bindCache == nil {
+		return cache.Stats{}
+	}
+
+	return bindCache.entries.Stats()
+}
+
+func (bindCache *Cache) sum(salt []byte, password string) []byte {
+	var h hash.Hash
+	if bindCache.hash == HashSHA512 {
+		h = sha512.New()
+	} else {
+		h = sha256.New()
+	}
+
+	h.Write(salt)
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
+
+func key(dn string) string {
+	return util.NormalizeDN(dn)
+}
@@ -0,0 +1,69 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package bindcache
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	Convey("Given a bind cache with a cached bind", t, func() {
+		bindCache, err := New("test", &Config{})
+		So(err, ShouldBeNil)
+
+		bindCache.Add("uid=user1,ou=People,dc=example,dc=com", "secure", "corp")
+
+		Convey("When the bind is repeated with the same password", func() {
+			backend, ok := bindCache.Verify("UID=user1,ou=People,dc=example,dc=com", "secure")
+
+			Convey("Then the bind is verified by the cache", func() {
+				So(ok, ShouldBeTrue)
+				So(backend, ShouldEqual, "corp")
+			})
+		})
+
+		Convey("When the bind is repeated with another password", func() {
+			_, ok := bindCache.Verify("uid=user1,ou=People,dc=example,dc=com", "wrong")
+
+			Convey("Then the bind isn't verified", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the bind is invalidated", func() {
+			bindCache.Invalidate("uid=user1,ou=People,dc=example,dc=com")
+			_, ok := bindCache.Verify("uid=user1,ou=People,dc=example,dc=com", "secure")
+
+			Convey("Then the bind isn't verified anymore", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given an unknown hash", t, func() {
+		_, err := New("test", &Config{Hash: "md5"})
+
+		Convey("Then the cache is rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,330 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"sync"
+	"time"
+)
+
+type state int
+
+const (
+	stateClosed = state(iota)
+	stateOpen
+	stateHalfOpen
+)
+
+func (s state) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+var (
+	circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "breaker",
+		Name:      "state",
+		Help:      "The state of the circuit breaker of a backend (0 closed, 1 open, 2 half-open)",
+	}, []string{"backend"})
+)
+
+func init() {
+	prometheus.MustRegister(circuitState)
+}
+
+// BreakerConfig defines when the circuit of a backend opens. Calls failing or
+// taking longer than slowCall are counted as failures. The circuit opens if at
+// least minRequests were made within the window and the failure rate reaches
+// the threshold. After the cooldown a single probe is let through.
+type BreakerConfig struct {
+	FailureRate float64 `json:"failureRate"`
+	MinRequests int     `json:"minRequests"`
+	Window      string  `json:"window"`
+	SlowCall    string  `json:"slowCall"`
+	Cooldown    string  `json:"cooldown"`
+}
+
+type Config struct {
+	pkg.Config
+
+	CircuitBreaker *BreakerConfig `json:"circuitBreaker"`
+}
+
+type breakerBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	failureRate float64
+	minRequests int
+	window      time.Duration
+	slowCall    time.Duration
+	cooldown    time.Duration
+
+	now func() time.Time
+
+	mutex       sync.Mutex
+	state       state
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+var _ pkg.ErrorReportingBackend = &breakerBackend{}
+var _ pkg.PasswordBackend = &breakerBackend{}
+var _ pkg.WriterBackend = &breakerBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *BreakerConfig) (pkg.Backend, error) {
+	backend := &breakerBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		failureRate:     config.FailureRate,
+		minRequests:     config.MinRequests,
+		window:          time.Minute,
+		cooldown:        30 * time.Second,
+		now:             time.Now,
+	}
+
+	if backend.failureRate <= 0 {
+		backend.failureRate = 0.5
+	}
+	if backend.minRequests <= 0 {
+		backend.minRequests = 10
+	}
+
+	var err error
+	if backend.window, err = parseDuration(config.Window, backend.window); err != nil {
+		return nil, err
+	}
+	if backend.slowCall, err = parseDuration(config.SlowCall, 0); err != nil {
+		return nil, err
+	}
+	if backend.cooldown, err = parseDuration(config.Cooldown, backend.cooldown); err != nil {
+		return nil, err
+	}
+
+	backend.windowStart = backend.now()
+	circuitState.With(prometheus.Labels{"backend": delegateBackend.Name()}).Set(float64(stateClosed))
+
+	return backend, nil
+}
+
+func (backend *breakerBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *breakerBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	authenticated, _ := backend.AuthenticateErr(ctx, username, password)
+	return authenticated
+}
+
+// AuthenticateErr returns ErrBackendUnavailable while the circuit is open, the
+// credentials are neither accepted nor refused then.
+func (backend *breakerBackend) AuthenticateErr(ctx context.Context, username string, password string) (bool, error) {
+	if !backend.allow() {
+		return false, pkg.ErrBackendUnavailable
+	}
+
+	start := backend.now()
+	authenticated, err := pkg.Authenticate(ctx, backend.delegateBackend, username, password)
+
+	// a failed authentication is most likely a wrong password, only count
+	// calls which didn't finish in time
+	backend.record(err != nil || ctx.Err() == context.DeadlineExceeded || backend.isSlow(start))
+
+	return authenticated, err
+}
+
+// SetPassword changes the password if the delegate backend changes
+// passwords, guarded like a write.
+func (backend *breakerBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return backend.write(func() error { return passwordBackend.SetPassword(ctx, username, password) })
+}
+
+func (backend *breakerBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	if !backend.allow() {
+		return nil, pkg.ErrBackendUnavailable
+	}
+
+	start := backend.now()
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+
+	backend.record(err != nil || backend.isSlow(start))
+
+	return users, err
+}
+
+func (backend *breakerBackend) Add(ctx context.Context, entry *pkg.User) error {
+	return backend.write(func() error { return backend.Forwarder.Add(ctx, entry) })
+}
+
+func (backend *breakerBackend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	return backend.write(func() error { return backend.Forwarder.Modify(ctx, dn, mods) })
+}
+
+func (backend *breakerBackend) Delete(ctx context.Context, dn string) error {
+	return backend.write(func() error { return backend.Forwarder.Delete(ctx, dn) })
+}
+
+func (backend *breakerBackend) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	return backend.write(func() error { return backend.Forwarder.ModifyDN(ctx, dn, newRDN, deleteOldRDN, newSuperior) })
+}
+
+// write guards a write like a search. A write the delegate refuses, e.g. of
+// an existing entry, isn't a failure of the delegate.
+func (backend *breakerBackend) write(write func() error) error {
+	if !backend.allow() {
+		return pkg.ErrBackendUnavailable
+	}
+
+	start := backend.now()
+	err := write()
+
+	refused := err == pkg.ErrEntryExists || err == pkg.ErrNoSuchEntry || err == pkg.ErrUnwillingToPerform || err == pkg.ErrMoveUnsupported
+	backend.record((err != nil && !refused) || backend.isSlow(start))
+
+	return err
+}
+
+// CheckHealth reports an open circuit as unavailable until the cooldown is
+// over, the delegate is checked otherwise.
+func (backend *breakerBackend) CheckHealth(ctx context.Context) error {
+	backend.mutex.Lock()
+	open := backend.state == stateOpen && backend.now().Sub(backend.openedAt) < backend.cooldown
+	backend.mutex.Unlock()
+
+	if open {
+		return pkg.ErrBackendUnavailable
+	}
+
+	return backend.Forwarder.CheckHealth(ctx)
+}
+
+func (backend *breakerBackend) isSlow(start time.Time) bool {
+	return backend.slowCall > 0 && backend.now().Sub(start) > backend.slowCall
+}
+
+// allow reports whether a call may reach the delegate
+func (backend *breakerBackend) allow() bool {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	switch backend.state {
+	case stateOpen:
+		if backend.now().Sub(backend.openedAt) < backend.cooldown {
+			return false
+		}
+
+		backend.setState(stateHalfOpen)
+		backend.probing = true
+		return true
+
+	case stateHalfOpen:
+		if backend.probing {
+			return false // only a single probe at a time
+		}
+
+		backend.probing = true
+		return true
+	}
+
+	return true
+}
+
+func (backend *breakerBackend) record(failed bool) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	if backend.state == stateHalfOpen {
+		backend.probing = false
+		if failed {
+			backend.open()
+		} else {
+			backend.reset()
+			backend.setState(stateClosed)
+		}
+		return
+	}
+
+	if backend.state == stateOpen {
+		return
+	}
+
+	if backend.now().Sub(backend.windowStart) > backend.window {
+		backend.reset()
+	}
+
+	backend.requests++
+	if failed {
+		backend.failures++
+	}
+
+	if backend.requests >= backend.minRequests && float64(backend.failures)/float64(backend.requests) >= backend.failureRate {
+		backend.open()
+	}
+}
+
+func (backend *breakerBackend) open() {
+	backend.openedAt = backend.now()
+	backend.setState(stateOpen)
+	log.ForBackend(backend.Name()).Printf("circuit of backend %s opened for %s", backend.Name(), backend.cooldown)
+}
+
+func (backend *breakerBackend) reset() {
+	backend.windowStart = backend.now()
+	backend.requests = 0
+	backend.failures = 0
+}
+
+func (backend *breakerBackend) setState(newState state) {
+	if backend.state != newState {
+		log.ForBackend(backend.Name()).Debugf("circuit of backend %s %s", backend.Name(), newState)
+	}
+
+	backend.state = newState
+	circuitState.With(prometheus.Labels{"backend": backend.Name()}).Set(float64(newState))
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(value)
+}
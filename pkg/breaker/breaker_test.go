@@ -0,0 +1,113 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type testBackend struct {
+	calls int
+	err   error
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.calls++
+
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.calls++
+
+	return []*pkg.User{}, backend.err
+}
+
+func TestBreakerBackend(t *testing.T) {
+	Convey("Given a circuit breaker around a failing backend", t, func() {
+		delegate := &testBackend{err: errors.New("connection reset")}
+		now := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+
+		wrapped, err := NewBackend(delegate, &BreakerConfig{MinRequests: 2, Cooldown: "10s"})
+		So(err, ShouldBeNil)
+		backend := wrapped.(*breakerBackend)
+		backend.now = func() time.Time { return now }
+
+		backend.GetUsers(context.Background(), nil)
+		backend.GetUsers(context.Background(), nil)
+
+		Convey("When the failure rate is reached", func() {
+			_, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the backend isn't called anymore", func() {
+				So(err, ShouldEqual, pkg.ErrBackendUnavailable)
+				So(delegate.calls, ShouldEqual, 2)
+				So(backend.Authenticate(context.Background(), "user1", "password"), ShouldBeFalse)
+			})
+
+			Convey("Then the backend is unhealthy", func() {
+				So(backend.CheckHealth(context.Background()), ShouldEqual, pkg.ErrBackendUnavailable)
+			})
+
+			Convey("Then the binds are reported unavailable, not refused", func() {
+				_, err := backend.AuthenticateErr(context.Background(), "user1", "password")
+				So(err, ShouldEqual, pkg.ErrBackendUnavailable)
+			})
+
+			Convey("Then the writes are refused as unavailable", func() {
+				So(backend.Delete(context.Background(), "uid=user1,dc=example,dc=com"), ShouldEqual, pkg.ErrBackendUnavailable)
+			})
+		})
+
+		Convey("When the cooldown is over and the probe succeeds", func() {
+			now = now.Add(11 * time.Second)
+			delegate.err = nil
+
+			_, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the circuit is closed again", func() {
+				So(err, ShouldBeNil)
+				So(backend.state, ShouldEqual, stateClosed)
+				So(delegate.calls, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the cooldown is over and the probe fails", func() {
+			now = now.Add(11 * time.Second)
+
+			backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the circuit opens again", func() {
+				So(backend.state, ShouldEqual, stateOpen)
+			})
+		})
+	})
+}
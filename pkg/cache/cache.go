@@ -0,0 +1,374 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	hitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "The total number of lookups answered by the cache",
+	}, []string{"cache"})
+
+	missesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "The total number of lookups not found in the cache",
+	}, []string{"cache"})
+
+	cacheLog = log.Component(log.Cache)
+)
+
+func init() {
+	prometheus.MustRegister(hitsTotal)
+	prometheus.MustRegister(missesTotal)
+}
+
+type Config struct {
+	// How long an entry is served from the cache e.g. `1m`.
+	TTL string `json:"ttl"`
+
+	// The number of entries kept, the least recently used entry is dropped
+	// first (default 10000).
+	MaxEntries int `json:"maxEntries"`
+}
+
+// A Store keeps the entries of a cache outside of the proxy, so several
+// proxies share the cache. Get returns nil for missing keys.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+	Keys(prefix string) ([]string, error)
+}
+
+// A Cache keeps values for a limited time. All methods are safe to be called
+// concurrently and on a nil cache, which never has an entry.
+type Cache struct {
+	// accessed atomically, first for 64 bit alignment
+	hits   uint64
+	misses uint64
+
+	name       string
+	ttl        time.Duration
+	maxEntries int
+
+	now   func() time.Time
+	store Store
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// Stats describe the current content and the lookups of a cache.
+type Stats struct {
+	Name       string
+	Entries    int
+	MaxEntries int
+	TTL        time.Duration
+	Hits       uint64
+	Misses     uint64
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// envelope wraps the values kept in a store, their types must be registered
+// with gob.
+type envelope struct {
+	Value interface{}
+}
+
+func New(name string, config *Config) (*Cache, error) {
+	cache := &Cache{
+		name:       name,
+		ttl:        time.Minute,
+		maxEntries: config.MaxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+
+	if config.TTL != "" {
+		ttl, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, err
+		}
+		cache.ttl = ttl
+	}
+	if cache.maxEntries <= 0 {
+		cache.maxEntries = 10000
+	}
+
+	return cache, nil
+}
+
+// Share keeps the entries in the store instead of the memory of the proxy. The
+// store expires the entries, the number of entries isn't limited.
+func (cache *Cache) Share(store Store) {
+	if cache == nil {
+		return
+	}
+
+	cache.store = store
+}
+
+func (cache *Cache) Get(key string) (interface{}, bool) {
+	if cache == nil {
+		return nil, false
+	}
+
+	if cache.store != nil {
+		value, ok := cache.getShared(key)
+		return value, cache.count(key, ok)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if ok && cache.now().After(element.Value.(*entry).expires) {
+		cache.remove(element)
+		ok = false
+	}
+
+	if !cache.count(key, ok) {
+		return nil, false
+	}
+
+	cache.lru.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+func (cache *Cache) count(key string, hit bool) bool {
+	cacheLog.Debugw("lookup", "cache", cache.name, "key", key, "hit", hit)
+
+	if !hit {
+		atomic.AddUint64(&cache.misses, 1)
+		missesTotal.With(prometheus.Labels{"cache": cache.name}).Inc()
+		return false
+	}
+
+	atomic.AddUint64(&cache.hits, 1)
+	hitsTotal.With(prometheus.Labels{"cache": cache.name}).Inc()
+	return true
+}
+
+func (cache *Cache) Set(key string, value interface{}) {
+	if cache == nil {
+		return
+	}
+
+	if cache.store != nil {
+		cache.setShared(key, value)
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&entry{
+		key:     key,
+		value:   value,
+		expires: cache.now().Add(cache.ttl),
+	})
+
+	for cache.lru.Len() > cache.maxEntries {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+func (cache *Cache) Delete(key string) {
+	if cache == nil {
+		return
+	}
+
+	if cache.store != nil {
+		cache.report(cache.store.Delete(cache.sharedKey(key)))
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+}
+
+// DeleteFunc drops the entries for which matches returns true and returns the
+// number of dropped entries.
+func (cache *Cache) DeleteFunc(matches func(key string, value interface{}) bool) int {
+	if cache == nil {
+		return 0
+	}
+
+	if cache.store != nil {
+		var keys []string
+		for _, key := range cache.sharedKeys() {
+			if value, ok := cache.getShared(key); ok && matches(key, value) {
+				keys = append(keys, cache.sharedKey(key))
+			}
+		}
+		cache.report(cache.store.Delete(keys...))
+		return len(keys)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	deleted := 0
+	for key, element := range cache.entries {
+		if matches(key, element.Value.(*entry).value) {
+			cache.remove(element)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Flush drops all entries.
+func (cache *Cache) Flush() {
+	if cache == nil {
+		return
+	}
+
+	if cache.store != nil {
+		var keys []string
+		for _, key := range cache.sharedKeys() {
+			keys = append(keys, cache.sharedKey(key))
+		}
+		cache.report(cache.store.Delete(keys...))
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = make(map[string]*list.Element)
+	cache.lru.Init()
+}
+
+func (cache *Cache) Len() int {
+	if cache == nil {
+		return 0
+	}
+
+	if cache.store != nil {
+		return len(cache.sharedKeys())
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.lru.Len()
+}
+
+// Stats returns the statistics of the cache. A nil cache has no name.
+func (cache *Cache) Stats() Stats {
+	if cache == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		Name:       cache.name,
+		Entries:    cache.Len(),
+		MaxEntries: cache.maxEntries,
+		TTL:        cache.ttl,
+		Hits:       atomic.LoadUint64(&cache.hits),
+		Misses:     atomic.LoadUint64(&cache.misses),
+	}
+}
+
+func (cache *Cache) remove(element *list.Element) {
+	cache.lru.Remove(element)
+	delete(cache.entries, element.Value.(*entry).key)
+}
+
+func (cache *Cache) sharedKey(key string) string {
+	return cache.name + ":" + key
+}
+
+// sharedKeys returns the keys of the cache in the store without the name of
+// the cache.
+func (cache *Cache) sharedKeys() []string {
+	keys, err := cache.store.Keys(cache.sharedKey(""))
+	cache.report(err)
+
+	for i := range keys {
+		keys[i] = keys[i][len(cache.sharedKey("")):]
+	}
+
+	return keys
+}
+
+func (cache *Cache) getShared(key string) (interface{}, bool) {
+	data, err := cache.store.Get(cache.sharedKey(key))
+	if err != nil || data == nil {
+		cache.report(err)
+		return nil, false
+	}
+
+	value := &envelope{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(value); err != nil {
+		cache.report(err)
+		return nil, false
+	}
+
+	return value.Value, true
+}
+
+func (cache *Cache) setShared(key string, value interface{}) {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(&envelope{Value: value}); err != nil {
+		cache.report(err)
+		return
+	}
+
+	cache.report(cache.store.Set(cache.sharedKey(key), data.Bytes(), cache.ttl))
+}
+
+// report logs failures of the store, a failing store is treated like an empty
+// cache.
+func (cache *Cache) report(err error) {
+	if err != nil {
+		cacheLog.Printf("shared cache %s: %s", cache.name, err)
+	}
+}
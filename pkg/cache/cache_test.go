@@ -0,0 +1,192 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cache
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStore struct {
+	values map[string][]byte
+}
+
+func (store *testStore) Get(key string) ([]byte, error) {
+	return store.values[key], nil
+}
+
+func (store *testStore) Set(key string, value []byte, ttl time.Duration) error {
+	store.values[key] = value
+	return nil
+}
+
+func (store *testStore) Delete(keys ...string) error {
+	for _, key := range keys {
+		delete(store.values, key)
+	}
+	return nil
+}
+
+func (store *testStore) Keys(prefix string) ([]string, error) {
+	var keys []string
+	for key := range store.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestCache(t *testing.T) {
+	Convey("Given a cache with two entries at most", t, func() {
+		cache, err := New("test", &Config{TTL: "1m", MaxEntries: 2})
+		So(err, ShouldBeNil)
+
+		now := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+		cache.now = func() time.Time { return now }
+
+		cache.Set("a", 1)
+
+		Convey("When an entry is looked up within the ttl", func() {
+			now = now.Add(59 * time.Second)
+			value, ok := cache.Get("a")
+
+			Convey("Then the value is returned", func() {
+				So(ok, ShouldBeTrue)
+				So(value, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When an entry is looked up after the ttl", func() {
+			now = now.Add(61 * time.Second)
+			_, ok := cache.Get("a")
+
+			Convey("Then the entry is gone", func() {
+				So(ok, ShouldBeFalse)
+				So(cache.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When more entries are added than fit", func() {
+			cache.Set("b", 2)
+			cache.Get("a")
+			cache.Set("c", 3)
+
+			Convey("Then the least recently used entry is dropped", func() {
+				_, ok := cache.Get("b")
+				So(ok, ShouldBeFalse)
+				So(cache.Len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When an entry is deleted", func() {
+			cache.Delete("a")
+
+			Convey("Then the entry is gone", func() {
+				_, ok := cache.Get("a")
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the entries matching a condition are deleted", func() {
+			cache.Set("b", 2)
+			deleted := cache.DeleteFunc(func(key string, value interface{}) bool {
+				return value.(int) > 1
+			})
+
+			Convey("Then only the matching entries are gone", func() {
+				So(deleted, ShouldEqual, 1)
+				_, ok := cache.Get("a")
+				So(ok, ShouldBeTrue)
+				_, ok = cache.Get("b")
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When entries are looked up", func() {
+			cache.Get("a")
+			cache.Get("b")
+
+			Convey("Then the lookups are counted in the stats", func() {
+				So(cache.Stats(), ShouldResemble, Stats{
+					Name:       "test",
+					Entries:    1,
+					MaxEntries: 2,
+					TTL:        time.Minute,
+					Hits:       1,
+					Misses:     1,
+				})
+			})
+		})
+
+		Convey("When the cache is flushed", func() {
+			cache.Flush()
+
+			Convey("Then all entries are gone", func() {
+				_, ok := cache.Get("a")
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given no cache", t, func() {
+		var cache *Cache
+
+		Convey("Then nothing is cached", func() {
+			cache.Set("a", 1)
+			_, ok := cache.Get("a")
+			So(ok, ShouldBeFalse)
+		})
+	})
+	Convey("Given two caches sharing a store", t, func() {
+		store := &testStore{values: make(map[string][]byte)}
+
+		first, _ := New("test", &Config{})
+		first.Share(store)
+		second, _ := New("test", &Config{})
+		second.Share(store)
+
+		first.Set("a", []string{"value"})
+
+		Convey("When the entry is read from the other cache", func() {
+			value, ok := second.Get("a")
+
+			Convey("Then the value is shared", func() {
+				So(ok, ShouldBeTrue)
+				So(value, ShouldResemble, []string{"value"})
+				So(second.Len(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the other cache is flushed", func() {
+			store.values["other:a"] = []byte{}
+			second.Flush()
+
+			Convey("Then the entry is gone for both, other caches are kept", func() {
+				_, ok := first.Get("a")
+				So(ok, ShouldBeFalse)
+				So(store.values, ShouldContainKey, "other:a")
+			})
+		})
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package changes
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"sync"
+	"time"
+)
+
+const (
+	TypeAdd    = "add"
+	TypeModify = "modify"
+	TypeDelete = "delete"
+)
+
+// A Change is a modification of a directory entry observed by the proxy.
+type Change struct {
+	Type       string              `json:"type"`
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	Time       time.Time           `json:"time"`
+}
+
+// DefaultHub distributes the changes observed by the backends of the process.
+var DefaultHub = NewHub()
+
+// A Hub distributes published changes to all matching subscriptions.
+type Hub struct {
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// A Subscription receives the changes below the base dn matching the filter.
+// Changes are dropped if the subscriber doesn't keep up.
+type Subscription struct {
+	C <-chan *Change
+
+	hub    *Hub
+	base   string
+	filter ldap.Filter
+	c      chan *Change
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+func (hub *Hub) Subscribe(base string, f ldap.Filter) *Subscription {
+	c := make(chan *Change, 64)
+	subscription := &Subscription{
+		C:      c,
+		hub:    hub,
+		base:   util.NormalizeDN(base),
+		filter: f,
+		c:      c,
+	}
+
+	hub.mutex.Lock()
+	hub.subscriptions[subscription] = struct{}{}
+	hub.mutex.Unlock()
+
+	return subscription
+}
+
+func (hub *Hub) Publish(change *Change) {
+	if change.Time.IsZero() {
+		change.Time = time.Now()
+	}
+
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	for subscription := range hub.subscriptions {
+		if !subscription.matches(change) {
+			continue
+		}
+
+		select {
+		case subscription.c <- change:
+		default:
+		}
+	}
+}
+
+func (subscription *Subscription) Close() {
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+
+	if _, ok := subscription.hub.subscriptions[subscription]; ok {
+		delete(subscription.hub.subscriptions, subscription)
+		close(subscription.c)
+	}
+}
+
+func (subscription *Subscription) matches(change *Change) bool {
+	if subscription.base != "" && !util.IsBelowDN(change.DN, subscription.base) {
+		return false
+	}
+
+	// deleted entries have no attributes left to match
+	return change.Type == TypeDelete || filter.Matches(change.Attributes, subscription.filter)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package changes
+
+import (
+	"bufio"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHub(t *testing.T) {
+	Convey("Given a hub with a subscription for admin groups", t, func() {
+		hub := NewHub()
+		subscription := hub.Subscribe("ou=Groups,dc=example,dc=com", &ldap.EqualityMatch{Attribute: "cn", Value: []byte("admins")})
+		defer subscription.Close()
+
+		Convey("When matching and other changes are published", func() {
+			hub.Publish(&Change{Type: TypeModify, DN: "cn=users,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"users"}}})
+			hub.Publish(&Change{Type: TypeModify, DN: "cn=admins,ou=People,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}}})
+			hub.Publish(&Change{Type: TypeModify, DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}}})
+
+			Convey("Then only the matching change is received", func() {
+				change := <-subscription.C
+				So(change.DN, ShouldEqual, "cn=admins,ou=Groups,dc=example,dc=com")
+				So(change.Time.IsZero(), ShouldBeFalse)
+				So(subscription.C, ShouldHaveLength, 0)
+			})
+		})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("Given a change stream", t, func() {
+		hub := NewHub()
+		server := httptest.NewServer(Handler(hub))
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "?filter=(cn=admins)")
+		So(err, ShouldBeNil)
+		defer res.Body.Close()
+
+		Convey("When a change is published", func() {
+			go func() {
+				for subscriptionCount(hub) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				hub.Publish(&Change{Type: TypeAdd, DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}}})
+			}()
+
+			reader := bufio.NewReader(res.Body)
+			event, _ := reader.ReadString('\n')
+			data, _ := reader.ReadString('\n')
+
+			Convey("Then it is streamed as event", func() {
+				So(res.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+				So(event, ShouldEqual, "event: add\n")
+				So(strings.HasPrefix(data, "data: {"), ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given an invalid filter", t, func() {
+		server := httptest.NewServer(Handler(NewHub()))
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "?filter=(cn=admins")
+
+		Convey("Then the request is rejected", func() {
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func subscriptionCount(hub *Hub) int {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	return len(hub.subscriptions)
+}
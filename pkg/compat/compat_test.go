@@ -0,0 +1,260 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build compat
+// +build compat
+
+package compat
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	serviceDn       = "cn=service,ou=Apps,dc=example,dc=com"
+	servicePassword = "service-secret"
+	aliceDn         = "uid=alice,ou=People,dc=example,dc=com"
+	alicePassword   = "alice-secret"
+	groupDn         = "cn=developers,ou=Groups,dc=example,dc=com"
+)
+
+type compatBackend struct {
+	passwords map[string]string
+	entries   []*pkg.User
+}
+
+var _ pkg.Backend = &compatBackend{}
+
+func newCompatBackend() *compatBackend {
+	return &compatBackend{
+		passwords: map[string]string{
+			serviceDn: servicePassword,
+			aliceDn:   alicePassword,
+		},
+		entries: []*pkg.User{
+			{
+				DN: aliceDn,
+				Attributes: map[string][]string{
+					"objectClass":   {"inetOrgPerson", "posixAccount"},
+					"uid":           {"alice"},
+					"cn":            {"Alice Example"},
+					"sn":            {"Example"},
+					"mail":          {"alice@example.com"},
+					"uidNumber":     {"1000"},
+					"gidNumber":     {"1000"},
+					"homeDirectory": {"/home/alice"},
+					"loginShell":    {"/bin/bash"},
+				},
+			},
+			{
+				DN: groupDn,
+				Attributes: map[string][]string{
+					"objectClass": {"groupOfNames", "posixGroup"},
+					"cn":          {"developers"},
+					"gidNumber":   {"1000"},
+					"member":      {aliceDn},
+					"memberUid":   {"alice"},
+				},
+			},
+		},
+	}
+}
+
+func (*compatBackend) Name() string {
+	return "compat"
+}
+
+func (backend *compatBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	expected, ok := backend.passwords[username]
+	return ok && expected == password
+}
+
+func (backend *compatBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users := []*pkg.User{}
+	for _, entry := range backend.entries {
+		if filter.Matches(entry.Attributes, f) {
+			users = append(users, entry)
+		}
+	}
+
+	return users, nil
+}
+
+// startProxy serves a proxy with the compat backend on a unix socket and
+// returns the ldapi url of the socket.
+func startProxy(t *testing.T) (string, func()) {
+	dirname, cleanupTmpDir := util.TmpDir(t)
+
+	unixSocketPath := filepath.Join(dirname, "ldap-proxy.sock")
+
+	proxy := pkg.NewLdapProxy()
+	proxy.AddBackend(newCompatBackend())
+	go proxy.ListenAndServe("unix", unixSocketPath)
+
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		conn, err := net.Dial("unix", unixSocketPath)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			cleanupTmpDir()
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return "ldapi://" + url.QueryEscape(unixSocketPath), cleanupTmpDir
+}
+
+// run executes one of the OpenLDAP client tools and returns its combined
+// output. The test is skipped if the tool is not installed.
+func run(t *testing.T, tool string, args ...string) (string, error) {
+	if _, err := exec.LookPath(tool); err != nil {
+		t.Skipf("%s is not installed", tool)
+	}
+
+	output, err := exec.Command(tool, args...).CombinedOutput()
+	return string(output), err
+}
+
+func ldapsearch(t *testing.T, uri string, bindDn string, password string, args ...string) (string, error) {
+	return run(t, "ldapsearch", append([]string{"-x", "-LLL", "-H", uri, "-D", bindDn, "-w", password}, args...)...)
+}
+
+func TestLdapsearch(t *testing.T) {
+	Convey("Given a proxy", t, func() {
+		uri, cleanup := startProxy(t)
+		defer cleanup()
+
+		Convey("When ldapsearch searches for a user", func() {
+			output, err := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "dc=example,dc=com", "(uid=alice)", "cn", "mail")
+
+			Convey("Then the entry is printed as ldif", func() {
+				So(err, ShouldBeNil)
+				So(output, ShouldContainSubstring, "dn: "+aliceDn)
+				So(output, ShouldContainSubstring, "mail: alice@example.com")
+			})
+		})
+
+		Convey("When ldapsearch binds with a wrong password", func() {
+			_, err := ldapsearch(t, uri, serviceDn, "wrong", "-b", "dc=example,dc=com", "(uid=alice)")
+
+			Convey("Then it fails", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When ldapwhoami is run", func() {
+			output, err := run(t, "ldapwhoami", "-x", "-H", uri, "-D", aliceDn, "-w", alicePassword)
+
+			Convey("Then the bound dn is returned", func() {
+				So(err, ShouldBeNil)
+				So(output, ShouldContainSubstring, aliceDn)
+			})
+		})
+	})
+}
+
+func TestKeycloakUserFederation(t *testing.T) {
+	Convey("Given a proxy", t, func() {
+		uri, cleanup := startProxy(t)
+		defer cleanup()
+
+		Convey("When the user is looked up like keycloak does", func() {
+			output, err := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "ou=People,dc=example,dc=com", "-s", "one",
+				"(&(uid=alice)(objectClass=inetOrgPerson))",
+				"uid", "cn", "sn", "mail", "createTimestamp", "modifyTimestamp")
+
+			Convey("Then the user is found and can bind with the password", func() {
+				So(err, ShouldBeNil)
+				So(output, ShouldContainSubstring, "dn: "+aliceDn)
+
+				_, err = ldapsearch(t, uri, aliceDn, alicePassword,
+					"-b", "ou=People,dc=example,dc=com", "(uid=alice)", "1.1")
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestJenkinsLdapPlugin(t *testing.T) {
+	Convey("Given a proxy", t, func() {
+		uri, cleanup := startProxy(t)
+		defer cleanup()
+
+		Convey("When the user and the groups are looked up like jenkins does", func() {
+			user, userErr := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "dc=example,dc=com", "-s", "sub", "(uid=alice)")
+			groups, groupsErr := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "dc=example,dc=com", "-s", "sub",
+				"(| (member="+aliceDn+") (uniqueMember="+aliceDn+") (memberUid=alice))", "cn")
+
+			Convey("Then the user and its groups are found", func() {
+				So(userErr, ShouldBeNil)
+				So(user, ShouldContainSubstring, "dn: "+aliceDn)
+
+				So(groupsErr, ShouldBeNil)
+				So(groups, ShouldContainSubstring, "cn: developers")
+			})
+		})
+	})
+}
+
+func TestSssd(t *testing.T) {
+	Convey("Given a proxy", t, func() {
+		uri, cleanup := startProxy(t)
+		defer cleanup()
+
+		Convey("When the passwd and group maps are looked up like sssd does", func() {
+			passwd, passwdErr := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "dc=example,dc=com",
+				"(&(uid=alice)(objectclass=posixAccount)(uid=*)(&(uidNumber=*)(!(uidNumber=0))))",
+				"objectClass", "uid", "uidNumber", "gidNumber", "homeDirectory", "loginShell")
+			group, groupErr := ldapsearch(t, uri, serviceDn, servicePassword,
+				"-b", "dc=example,dc=com",
+				"(&(memberUid=alice)(objectclass=posixGroup)(cn=*)(&(gidNumber=*)(!(gidNumber=0))))",
+				"cn", "gidNumber", "memberUid")
+
+			Convey("Then the posix attributes are returned", func() {
+				So(passwdErr, ShouldBeNil)
+				So(passwd, ShouldContainSubstring, "uidNumber: 1000")
+				So(passwd, ShouldContainSubstring, "homeDirectory: /home/alice")
+
+				So(groupErr, ShouldBeNil)
+				So(group, ShouldContainSubstring, "cn: developers")
+			})
+		})
+	})
+}
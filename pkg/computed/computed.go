@@ -0,0 +1,160 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package computed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+	"text/template"
+)
+
+// Config defines virtual attributes computed from the other attributes of an
+// entry with go templates, e.g. mail as {{.uid}}@example.com. The templates
+// see the first value of every attribute, by its name and its lower case
+// name, and the functions lower and upper.
+type Config struct {
+	pkg.Config
+
+	ComputedAttributes map[string]string `json:"computedAttributes"`
+}
+
+type computedBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	templates map[string]*template.Template
+}
+
+var _ pkg.PasswordBackend = &computedBackend{}
+var _ pkg.WriterBackend = &computedBackend{}
+
+var functions = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+func NewBackend(delegateBackend pkg.Backend, config *Config) (pkg.Backend, error) {
+	backend := &computedBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		templates:       make(map[string]*template.Template),
+	}
+
+	for name, text := range config.ComputedAttributes {
+		tmpl, err := template.New(name).Funcs(functions).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("computed: invalid template of %s: %v", name, err)
+		}
+		backend.templates[name] = tmpl
+	}
+
+	return backend, nil
+}
+
+func (backend *computedBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *computedBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *computedBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *computedBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	computed := make([]*pkg.User, len(users))
+	for i, user := range users {
+		computed[i] = backend.compute(user)
+	}
+
+	return computed, nil
+}
+
+// compute returns a copy of the entry with the computed attributes it lacks.
+// Attributes whose template references a missing attribute are left out.
+func (backend *computedBackend) compute(user *pkg.User) *pkg.User {
+	var data map[string]string
+	var attributes map[string][]string
+
+	for name, tmpl := range backend.templates {
+		if len(filter.Values(user.Attributes, name)) > 0 {
+			continue
+		}
+
+		if data == nil {
+			data = templateData(user.Attributes)
+		}
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil || value.Len() == 0 {
+			continue
+		}
+
+		if attributes == nil {
+			attributes = make(map[string][]string, len(user.Attributes)+len(backend.templates))
+			for name, values := range user.Attributes {
+				attributes[name] = values
+			}
+		}
+		attributes[name] = []string{value.String()}
+	}
+
+	if attributes == nil {
+		return user
+	}
+
+	return &pkg.User{DN: user.DN, Attributes: attributes}
+}
+
+func templateData(attributes map[string][]string) map[string]string {
+	data := make(map[string]string, 2*len(attributes))
+	for name, values := range attributes {
+		if len(values) == 0 {
+			continue
+		}
+		data[strings.ToLower(name)] = values[0]
+	}
+	for name, values := range attributes {
+		if len(values) > 0 {
+			data[name] = values[0]
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package computed
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.users, nil
+}
+
+func TestComputedBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend computing attributes", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"JDoe"}, "givenName": {"John"}, "sn": {"Doe"}}},
+			{DN: "uid=asmith,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"asmith"}, "Mail": {"alice@example.org"}}},
+		}}
+		backend, err := NewBackend(delegate, &Config{ComputedAttributes: map[string]string{
+			"mail":        "{{lower .uid}}@example.com",
+			"displayName": "{{.givenname}} {{.sn}}",
+		}})
+		So(err, ShouldBeNil)
+
+		users, err := backend.GetUsers(context.Background(), nil)
+		So(err, ShouldBeNil)
+
+		Convey("Then missing attributes are computed", func() {
+			So(users[0].Attributes["mail"], ShouldResemble, []string{"jdoe@example.com"})
+			So(users[0].Attributes["displayName"], ShouldResemble, []string{"John Doe"})
+		})
+
+		Convey("Then existing attributes are kept", func() {
+			So(users[1].Attributes["Mail"], ShouldResemble, []string{"alice@example.org"})
+			So(users[1].Attributes, ShouldNotContainKey, "mail")
+		})
+
+		Convey("Then attributes referencing missing attributes are left out", func() {
+			So(users[1].Attributes, ShouldNotContainKey, "displayName")
+			So(users[1], ShouldEqual, delegate.users[1])
+		})
+
+		Convey("Then the entries of the delegate are unchanged", func() {
+			So(delegate.users[0].Attributes, ShouldNotContainKey, "mail")
+		})
+	})
+
+	Convey("Given an invalid template", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{ComputedAttributes: map[string]string{"mail": "{{.uid"}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
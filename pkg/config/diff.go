@@ -0,0 +1,91 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// flatten returns the json of the scalars and the empty collections of a
+// document by their paths
+func flatten(data []byte) map[string]string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	var walk func(value interface{}, path string)
+	walk = func(value interface{}, path string) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if len(v) > 0 {
+				for key, item := range v {
+					walk(item, joinPath(path, key))
+				}
+				return
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				for i, item := range v {
+					walk(item, fmt.Sprintf("%s[%d]", path, i))
+				}
+				return
+			}
+		}
+
+		encoded, _ := json.Marshal(value)
+		values[path] = string(encoded)
+	}
+	walk(value, "")
+
+	return values
+}
+
+// Diff returns the keys added, removed and changed between two configs. The
+// values aren't part of the diff, as they may be credentials.
+func Diff(previous *Config, config *Config) []string {
+	var changes []string
+	for path, value := range config.values {
+		previousValue, ok := previous.values[path]
+		switch {
+		case !ok:
+			changes = append(changes, "added "+path)
+		case previousValue != value:
+			changes = append(changes, "changed "+path)
+		}
+	}
+	for path := range previous.values {
+		if _, ok := config.values[path]; !ok {
+			changes = append(changes, "removed "+path)
+		}
+	}
+
+	// ordered by path, after the added, changed or removed
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i][strings.Index(changes[i], " "):] < changes[j][strings.Index(changes[j], " "):]
+	})
+
+	return changes
+}
@@ -0,0 +1,56 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	Convey("Given two configs", t, func() {
+		os.Setenv("DIFF_SECRET", "secret")
+		defer os.Unsetenv("DIFF_SECRET")
+
+		loader := NewLoader()
+		loader.AddFactory(&testFactory{})
+
+		previous, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "a", "sizeLimit": 5}], "protectedSubtrees": ["dc=a"], "searchCache": {}}`))
+		So(err, ShouldBeNil)
+		config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "${env:DIFF_SECRET}", "sizeLimit": 5}, {"kind": "test"}], "searchCache": {"ttl": "1m"}}`))
+		So(err, ShouldBeNil)
+
+		Convey("Then the changed keys should be returned by path", func() {
+			So(Diff(previous, config), ShouldResemble, []string{
+				"changed backends[0].value",
+				"added backends[1].kind",
+				"removed protectedSubtrees[0]",
+				"removed searchCache",
+				"added searchCache.ttl",
+			})
+		})
+
+		Convey("Then the same config should have no changes", func() {
+			So(Diff(config, config), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// the value of redacted credentials
+const redacted = "***"
+
+// the parts of the keys holding credentials
+var credentialKeys = []string{"password", "secret", "token", "credential", "apikey", "integrationkey", "privatekey"}
+
+// Effective returns the configuration as loaded: the file with the
+// environment variables and the kubernetes resources, but without resolving
+// the secret references. The values of keys holding credentials and the
+// passwords of urls are redacted.
+func (config *Config) Effective() interface{} {
+	var value interface{}
+	if err := json.Unmarshal(config.document, &value); err != nil {
+		return nil
+	}
+
+	return redact(value, "")
+}
+
+func redact(value interface{}, key string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redact(item, key)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item, key)
+		}
+		return v
+	case string:
+		if isCredential(key) {
+			return redacted
+		}
+		return redactUrl(v)
+	case nil:
+		return nil
+	default:
+		if isCredential(key) {
+			return redacted
+		}
+		return v
+	}
+}
+
+func isCredential(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range credentialKeys {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactUrl replaces the password of an url like postgres://user:pw@host/db
+func redactUrl(value string) string {
+	scheme := strings.Index(value, "://")
+	if scheme < 0 {
+		return value
+	}
+
+	start := scheme + len("://")
+	authority := value[start:]
+	if end := strings.IndexAny(authority, "/?#"); end >= 0 {
+		authority = authority[:end]
+	}
+
+	at := strings.LastIndex(authority, "@")
+	colon := strings.Index(authority, ":")
+	if at < 0 || colon < 0 || colon > at {
+		return value
+	}
+
+	return value[:start+colon+1] + redacted + value[start+at:]
+}
@@ -0,0 +1,53 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestConfig_Effective(t *testing.T) {
+	Convey("Given a config with credentials", t, func() {
+		loader := NewLoader()
+		loader.AddFactory(&testFactory{})
+
+		config, err := loader.LoadConfig(toReader(`{
+			"backends": [{"kind": "test", "value": "postgres://proxy:pw@db:5432/auth", "sizeLimit": 5}],
+			"admin": {"tokens": [{"name": "ops", "token": "t0ps3cret", "role": "viewer"}]}
+		}`))
+		So(err, ShouldBeNil)
+
+		Convey("When the effective config is requested", func() {
+			effective := config.Effective().(map[string]interface{})
+
+			Convey("Then the credentials should be redacted", func() {
+				backend := effective["backends"].([]interface{})[0].(map[string]interface{})
+				So(backend["value"], ShouldEqual, "postgres://proxy:***@db:5432/auth")
+				So(backend["sizeLimit"], ShouldEqual, 5.0)
+
+				token := effective["admin"].(map[string]interface{})["tokens"].([]interface{})[0].(map[string]interface{})
+				So(token["name"], ShouldEqual, "ops")
+				So(token["token"], ShouldEqual, redacted)
+			})
+		})
+	})
+}
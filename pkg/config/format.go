@@ -0,0 +1,210 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// The formats of config files. Yaml and toml are converted to json before
+// loading, so the keys are the same in every format.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// FormatOf returns the format of a config file by its extension, defaulting
+// to json
+func FormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+
+	return FormatJSON
+}
+
+// document is a config file converted to json with the lines of its keys
+type document struct {
+	data      []byte
+	positions map[string]int
+}
+
+func parseDocument(data []byte, format string) (*document, error) {
+	var value interface{}
+	var positions map[string]int
+	var err error
+
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &value); err != nil {
+			if syntaxError, ok := err.(*json.SyntaxError); ok {
+				return nil, fmt.Errorf("config: line %d: %v", lineOf(data, syntaxError.Offset), err)
+			}
+			return nil, err
+		}
+		return &document{data: data, positions: jsonPositions(data)}, nil
+	case FormatYAML:
+		value, positions, err = parseYAML(data)
+	case FormatTOML:
+		value, positions, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("config: unknown format '%s'", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+
+	data, err = json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &document{data: data, positions: positions}, nil
+}
+
+// appendConfigs adds backend and listener configs to a document, turning a
+// list of backends into an object
+func appendConfigs(data []byte, backends []json.RawMessage, listeners []json.RawMessage) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	object, ok := value.(map[string]interface{})
+	if list, isList := value.([]interface{}); isList {
+		object, ok = map[string]interface{}{"backends": list}, true
+	}
+	if !ok {
+		return nil, errors.New("config: the config is neither an object nor a list of backends")
+	}
+
+	for key, configs := range map[string][]json.RawMessage{"backends": backends, "listeners": listeners} {
+		if len(configs) == 0 {
+			continue
+		}
+		existing, _ := object[key].([]interface{})
+		for _, config := range configs {
+			existing = append(existing, config)
+		}
+		object[key] = existing
+	}
+
+	return json.Marshal(object)
+}
+
+// describe prefixes a message on a key with the line of the key
+func (doc *document) describe(path string, message string) string {
+	if line, ok := doc.positions[path]; ok {
+		return fmt.Sprintf("line %d: %s", line, message)
+	}
+
+	return message
+}
+
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
+
+// countingReader counts the bytes read from the reader
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.read += int64(n)
+	return n, err
+}
+
+// inputOffset returns the offset behind the last token of the decoder reading
+// from the reader, Decoder.InputOffset needs go 1.14
+func inputOffset(decoder *json.Decoder, reader *countingReader) int64 {
+	buffered, _ := io.Copy(ioutil.Discard, decoder.Buffered())
+	return reader.read - buffered
+}
+
+// jsonPositions returns the lines of the keys and list items of a valid json
+// document
+func jsonPositions(data []byte) map[string]int {
+	positions := make(map[string]int)
+	reader := &countingReader{reader: bytes.NewReader(data)}
+	decoder := json.NewDecoder(reader)
+
+	var walk func(path string) (int, error)
+	walk = func(path string) (int, error) {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, err
+		}
+		line := lineOf(data, inputOffset(decoder, reader))
+
+		switch token {
+		case json.Delim('{'):
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return 0, err
+				}
+				keyPath := joinPath(path, key.(string))
+				positions[keyPath] = lineOf(data, inputOffset(decoder, reader))
+
+				if _, err := walk(keyPath); err != nil {
+					return 0, err
+				}
+			}
+			_, err = decoder.Token()
+		case json.Delim('['):
+			for i := 0; decoder.More(); i++ {
+				itemPath := fmt.Sprintf("%s[%d]", path, i)
+				itemLine, err := walk(itemPath)
+				if err != nil {
+					return 0, err
+				}
+				positions[itemPath] = itemLine
+			}
+			_, err = decoder.Token()
+		}
+
+		return line, err
+	}
+	walk("")
+
+	return positions
+}
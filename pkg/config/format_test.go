@@ -0,0 +1,79 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	Convey("Given config file names", t, func() {
+		Convey("Then the format should be chosen by the extension", func() {
+			So(FormatOf("/etc/ldap-proxy/config.json"), ShouldEqual, FormatJSON)
+			So(FormatOf("config.YAML"), ShouldEqual, FormatYAML)
+			So(FormatOf("config.yml"), ShouldEqual, FormatYAML)
+			So(FormatOf("config.toml"), ShouldEqual, FormatTOML)
+			So(FormatOf("config"), ShouldEqual, FormatJSON)
+		})
+	})
+}
+
+func TestParseDocument(t *testing.T) {
+	Convey("Given a json document", t, func() {
+		doc, err := parseDocument([]byte("{\n  \"backends\": [\n    {\"kind\": \"test\"},\n    {\n      \"kind\": \"test\"\n    }\n  ]\n}"), FormatJSON)
+
+		Convey("Then the lines of the keys should be returned", func() {
+			So(err, ShouldBeNil)
+			So(doc.positions["backends"], ShouldEqual, 2)
+			So(doc.positions["backends[0].kind"], ShouldEqual, 3)
+			So(doc.positions["backends[1]"], ShouldEqual, 4)
+			So(doc.positions["backends[1].kind"], ShouldEqual, 5)
+		})
+	})
+
+	Convey("Given an invalid json document", t, func() {
+		_, err := parseDocument([]byte("{\n  \"backends\": [\n    {\"kind\": \"test\",}\n  ]\n}"), FormatJSON)
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "config: line 3:")
+		})
+	})
+
+	Convey("Given a yaml document", t, func() {
+		doc, err := parseDocument([]byte("backends:\n  - kind: test\n"), FormatYAML)
+
+		Convey("Then it should be converted to json", func() {
+			So(err, ShouldBeNil)
+			So(string(doc.data), ShouldEqual, `{"backends":[{"kind":"test"}]}`)
+			So(doc.positions["backends[0].kind"], ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given an unknown format", t, func() {
+		_, err := parseDocument([]byte("{}"), "xml")
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"os"
+	"regexp"
+)
+
+// variablePattern matches ${VAR} and ${VAR:-default}
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate replaces the environment variables anywhere in a config file
+// before it's parsed, so they may also be numbers or booleans. The default is
+// used if the variable is unset or empty. Secrets referenced as
+// ${scheme:reference} don't match and are resolved in the values later.
+func interpolate(data []byte) []byte {
+	return variablePattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		groups := variablePattern.FindSubmatch(match)
+		name := string(groups[1])
+		if value := os.Getenv(name); value != "" {
+			return []byte(value)
+		}
+		if len(groups[2]) > 0 {
+			return groups[3]
+		}
+
+		log.Printf("Config: environment variable '%s' is not set, using an empty value", name)
+		return []byte{}
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	Convey("Given environment variables", t, func() {
+		os.Setenv("INTERPOLATE_HOST", "db.example.com")
+		os.Setenv("INTERPOLATE_EMPTY", "")
+		defer os.Unsetenv("INTERPOLATE_HOST")
+		defer os.Unsetenv("INTERPOLATE_EMPTY")
+
+		Convey("When a config references them", func() {
+			data := interpolate([]byte(`{"url": "postgres://${INTERPOLATE_HOST}:${INTERPOLATE_PORT:-5432}/auth", "sizeLimit": ${INTERPOLATE_EMPTY:-100}, "name": "${INTERPOLATE_UNSET}"}`))
+
+			Convey("Then they should be replaced, using the defaults of unset or empty variables", func() {
+				So(string(data), ShouldEqual, `{"url": "postgres://db.example.com:5432/auth", "sizeLimit": 100, "name": ""}`)
+			})
+		})
+
+		Convey("When a config references secrets", func() {
+			data := interpolate([]byte(`{"password": "${env:INTERPOLATE_HOST}", "hash": "$2a$04$LPQ"}`))
+
+			Convey("Then they should be kept for the secrets", func() {
+				So(string(data), ShouldEqual, `{"password": "${env:INTERPOLATE_HOST}", "hash": "$2a$04$LPQ"}`)
+			})
+		})
+	})
+}
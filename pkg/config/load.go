@@ -21,21 +21,201 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/acl"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/anomaly"
+	"github.com/gopenguin/ldap-proxy/pkg/approval"
+	"github.com/gopenguin/ldap-proxy/pkg/audit"
+	"github.com/gopenguin/ldap-proxy/pkg/authlog"
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/gopenguin/ldap-proxy/pkg/breaker"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/gopenguin/ldap-proxy/pkg/computed"
+	"github.com/gopenguin/ldap-proxy/pkg/geoip"
+	"github.com/gopenguin/ldap-proxy/pkg/ipfilter"
+	"github.com/gopenguin/ldap-proxy/pkg/join"
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
 	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/mapping"
+	"github.com/gopenguin/ldap-proxy/pkg/masking"
+	"github.com/gopenguin/ldap-proxy/pkg/memberof"
+	"github.com/gopenguin/ldap-proxy/pkg/members"
+	"github.com/gopenguin/ldap-proxy/pkg/mfa"
+	"github.com/gopenguin/ldap-proxy/pkg/objectclass"
+	"github.com/gopenguin/ldap-proxy/pkg/posix"
+	"github.com/gopenguin/ldap-proxy/pkg/ratelimit"
+	"github.com/gopenguin/ldap-proxy/pkg/redaction"
+	"github.com/gopenguin/ldap-proxy/pkg/redis"
+	"github.com/gopenguin/ldap-proxy/pkg/retry"
+	"github.com/gopenguin/ldap-proxy/pkg/rewrite"
+	"github.com/gopenguin/ldap-proxy/pkg/routing"
+	"github.com/gopenguin/ldap-proxy/pkg/schema"
+	"github.com/gopenguin/ldap-proxy/pkg/script"
+	"github.com/gopenguin/ldap-proxy/pkg/secrets"
 	"github.com/gopenguin/ldap-proxy/pkg/stripper"
+	"github.com/gopenguin/ldap-proxy/pkg/subschema"
+	"github.com/gopenguin/ldap-proxy/pkg/suffix"
+	"github.com/gopenguin/ldap-proxy/pkg/totp"
+	"github.com/gopenguin/ldap-proxy/pkg/valuerules"
+	"github.com/gopenguin/ldap-proxy/pkg/verify"
 	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoBackends = errors.New("config: no backends configured")
 )
 
 type Loader struct {
 	factories map[string]pkg.BackendFactory
 }
 
+// Config is the content of a configuration file. The file is either a list of
+// backend configurations or an object containing the backends and the
+// settings of the proxy.
+type Config struct {
+	Backends            []pkg.Backend
+	BackendTimeouts     map[string]pkg.Timeouts
+	BackendSizeLimits   map[string]int
+	FilterResults       map[string]bool
+	Replicas            map[string]pkg.Replica
+	NamingContexts      map[string][]string
+	Writable            map[string]bool
+	Subschema           *subschema.Schema
+	Referrals           []pkg.Referral
+	ProtectedSubtrees   []string
+	Anonymous           *pkg.AnonymousAccess
+	ACL                 *acl.Policy
+	Redaction           *redaction.Redactor
+	ValueRules          *valuerules.Policy
+	Approval            *approval.Guard
+	Anomaly             *anomaly.Detector
+	Lockout             *lockout.Guard
+	TOTP                *totp.Verifier
+	MFA                 *mfa.Guard
+	GeoIP               *geoip.Locator
+	MemberOf            *memberof.Resolver
+	Audit               *audit.Logger
+	AuthLog             *authlog.Logger
+	RateLimit           *ratelimit.Limiter
+	IPFilter            *ipfilter.Policy
+	SearchCache         *cache.Cache
+	BindCache           *bindcache.Cache
+	NegativeSearchCache *cache.Cache
+	NegativeBindCache   *bindcache.Cache
+	OfflineSearchCache  *cache.Cache
+	OfflineBindCache    *bindcache.Cache
+	Listeners           []Listener
+	Admin               *admin.Auth
+
+	// the file before expanding the secrets, for Diff and Effective
+	document []byte
+	values   map[string]string
+}
+
+// A Listener is an additional address the proxy is served on.
+type Listener struct {
+	Name       string
+	Address    string
+	Masking    *masking.Profile
+	IPFilter   *ipfilter.Policy
+	ValueRules *valuerules.Policy
+
+	// the json of the settings, for Equal
+	settings string
+}
+
+// Equal returns whether the listeners have the same settings, so a reload
+// doesn't restart unchanged listeners.
+func (listener Listener) Equal(other Listener) bool {
+	return listener.settings == other.settings
+}
+
+type fileConfig struct {
+	Backends      []*json.RawMessage `json:"backends"`
+	Approval      *approval.Config   `json:"approval"`
+	Anomaly       *anomaly.Config    `json:"anomaly"`
+	Lockout       *lockout.Config    `json:"lockout"`
+	TOTP          *totp.Config       `json:"totp"`
+	MFA           *mfa.Config        `json:"mfa"`
+	GeoIP         *geoip.Config      `json:"geoip"`
+	MemberOf      *memberof.Config   `json:"memberOf"`
+	Audit         *audit.Config      `json:"audit"`
+	AuthLog       *authlog.Config    `json:"authLog"`
+	RateLimit     *ratelimit.Config  `json:"rateLimit"`
+	SearchCache   *cache.Config      `json:"searchCache"`
+	BindCache     *bindcache.Config  `json:"bindCache"`
+	NegativeCache *cache.Config      `json:"negativeCache"`
+	Offline       *bindcache.Config  `json:"offlineFallback"`
+	SharedCache   *redis.Config      `json:"sharedCache"`
+	Listeners     []listenerConfig   `json:"listeners"`
+	Admin         *admin.AuthConfig  `json:"admin"`
+	Subschema     *subschema.Config  `json:"subschema"`
+	Referrals     []referralConfig   `json:"referrals"`
+	Protected     []string           `json:"protectedSubtrees"`
+	Anonymous     *anonymousConfig   `json:"anonymous"`
+	ACL           *acl.Config        `json:"acl"`
+	Redaction     *redaction.Config  `json:"redaction"`
+	ValueRules    []*valuerules.Rule `json:"valueRules"`
+	IPFilter      *ipfilter.Config   `json:"ipFilter"`
+}
+
+type listenerConfig struct {
+	Name       string             `json:"name"`
+	Address    string             `json:"address"`
+	Masking    *masking.Config    `json:"masking"`
+	IPFilter   *ipfilter.Config   `json:"ipFilter"`
+	ValueRules []*valuerules.Rule `json:"valueRules"`
+}
+
+type referralConfig struct {
+	Suffix string   `json:"suffix"`
+	URLs   []string `json:"urls"`
+}
+
+type anonymousConfig struct {
+	Subtrees   []string `json:"subtrees"`
+	Attributes []string `json:"attributes"`
+}
+
 type typedConfig struct {
 	Kind string `json:"kind"`
 }
 
+type replicaConfig struct {
+	ReplicaGroup string `json:"replicaGroup"`
+	Weight       int    `json:"weight"`
+	BindWeight   int    `json:"bindWeight"`
+}
+
+type namingContextConfig struct {
+	NamingContexts []string `json:"namingContexts"`
+}
+
+type writableConfig struct {
+	Writable bool `json:"writable"`
+}
+
+type sizeLimitConfig struct {
+	SizeLimit int `json:"sizeLimit"`
+}
+
+type filterResultsConfig struct {
+	FilterResults bool `json:"filterResults"`
+}
+
+type timeoutConfig struct {
+	AuthTimeout   string `json:"authTimeout"`
+	SearchTimeout string `json:"searchTimeout"`
+}
+
 func NewLoader() (loader *Loader) {
 	loader = &Loader{
 		factories: make(map[string]pkg.BackendFactory),
@@ -51,28 +231,385 @@ func (loader *Loader) AddFactory(factory pkg.BackendFactory) {
 }
 
 func (loader *Loader) Load(reader io.Reader) (backends []pkg.Backend, err error) {
-	var rawConfigs []*json.RawMessage
+	config, err := loader.LoadConfig(reader)
+	if err != nil {
+		return nil, err
+	}
 
-	decoder := json.NewDecoder(reader)
+	return config.Backends, nil
+}
+
+func (loader *Loader) LoadConfig(reader io.Reader) (config *Config, err error) {
+	return loader.LoadConfigFormat(reader, FormatJSON)
+}
+
+// LoadConfigFormat loads a config file in one of the formats. Unknown keys and
+// values of the wrong type fail yaml and toml configs, in json configs they
+// are logged to keep loading the configs of earlier versions.
+func (loader *Loader) LoadConfigFormat(reader io.Reader, format string) (config *Config, err error) {
+	return loader.LoadConfigWith(reader, format, nil, nil)
+}
 
-	if err = decoder.Decode(&rawConfigs); err != nil {
+// LoadConfigWith loads a config file with additional backend and listener
+// configs, e.g. of kubernetes resources, after the ones of the file.
+func (loader *Loader) LoadConfigWith(reader io.Reader, format string, backends []json.RawMessage, listeners []json.RawMessage) (config *Config, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseDocument(interpolate(data), format)
+	if err != nil {
 		return nil, err
 	}
+	if len(backends) > 0 || len(listeners) > 0 {
+		if doc.data, err = appendConfigs(doc.data, backends, listeners); err != nil {
+			return nil, err
+		}
+	}
 
-	backends = []pkg.Backend{}
+	problems := loader.checkKeys(doc)
+	if format != FormatJSON && len(problems) > 0 {
+		return nil, fmt.Errorf("config: %s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		log.Printf("Config: %s IGNORED", problem)
+	}
 
-	for _, rawConfig := range rawConfigs {
-		backend, err := loader.instantiateBackend(*rawConfig)
+	// credentials are referenced as ${env:NAME}, ${file:path} or ${vault:path#key}
+	data, err = secrets.ExpandJSON(doc.data)
+	if err != nil {
+		return nil, err
+	}
+
+	rawConfig := &fileConfig{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &rawConfig.Backends)
+	} else {
+		err = json.Unmarshal(data, rawConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rawConfig.Backends == nil {
+		return nil, ErrNoBackends
+	}
+
+	config = &Config{
+		Backends:          []pkg.Backend{},
+		BackendTimeouts:   make(map[string]pkg.Timeouts),
+		BackendSizeLimits: make(map[string]int),
+		FilterResults:     make(map[string]bool),
+		Replicas:          make(map[string]pkg.Replica),
+		NamingContexts:    make(map[string][]string),
+		Writable:          make(map[string]bool),
+
+		document: doc.data,
+		values:   flatten(doc.data),
+	}
+
+	for _, rawBackendConfig := range rawConfig.Backends {
+		backend, err := loader.instantiateBackend(*rawBackendConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Backends = append(config.Backends, backend)
+
+		timeouts, err := parseTimeouts(*rawBackendConfig)
 		if err != nil {
 			return nil, err
 		}
+		if timeouts != nil {
+			config.BackendTimeouts[backend.Name()] = *timeouts
+		}
+
+		replica := &replicaConfig{}
+		json.Unmarshal(*rawBackendConfig, replica)
+		if replica.ReplicaGroup != "" {
+			config.Replicas[backend.Name()] = pkg.Replica{Group: replica.ReplicaGroup, Weight: replica.Weight, BindWeight: replica.BindWeight}
+			log.Printf("Backend '%s' is a replica of group '%s' with weight %d and bind weight %d", backend.Name(), replica.ReplicaGroup, replica.Weight, replica.BindWeight)
+		}
+
+		namingContexts := &namingContextConfig{}
+		json.Unmarshal(*rawBackendConfig, namingContexts)
+		if len(namingContexts.NamingContexts) > 0 {
+			config.NamingContexts[backend.Name()] = namingContexts.NamingContexts
+		}
+
+		writable := &writableConfig{}
+		json.Unmarshal(*rawBackendConfig, writable)
+		if writable.Writable {
+			config.Writable[backend.Name()] = true
+			log.Printf("Backend '%s' is writable", backend.Name())
+		}
 
-		backends = append(backends, backend)
+		sizeLimit := &sizeLimitConfig{}
+		json.Unmarshal(*rawBackendConfig, sizeLimit)
+		if sizeLimit.SizeLimit > 0 {
+			config.BackendSizeLimits[backend.Name()] = sizeLimit.SizeLimit
+			log.Printf("Backend '%s' returns at most %d entries", backend.Name(), sizeLimit.SizeLimit)
+		}
+
+		filterResults := &filterResultsConfig{}
+		json.Unmarshal(*rawBackendConfig, filterResults)
+		if filterResults.FilterResults {
+			config.FilterResults[backend.Name()] = true
+			log.Printf("Filtering the entries of backend '%s'", backend.Name())
+		}
 	}
 
-	return
+	if rawConfig.Approval != nil {
+		config.Approval, err = approval.New(rawConfig.Approval)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Requiring approval for %d sensitive operation rules", len(rawConfig.Approval.Rules))
+	}
+
+	if rawConfig.Anomaly != nil {
+		config.Anomaly = anomaly.NewDetector(rawConfig.Anomaly)
+		log.Print("Detecting anomalous sessions")
+	}
+
+	if rawConfig.Audit != nil {
+		config.Audit, err = audit.New(rawConfig.Audit)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Writing the audit log to %s", rawConfig.Audit.Output)
+	}
+
+	if rawConfig.AuthLog != nil {
+		config.AuthLog, err = authlog.New(rawConfig.AuthLog)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Logging failed binds to %s", rawConfig.AuthLog.Output)
+	}
+
+	if rawConfig.IPFilter != nil {
+		config.IPFilter, err = ipfilter.New(rawConfig.IPFilter)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Filtering source ips, allowing %v and denying %v", rawConfig.IPFilter.Allow, rawConfig.IPFilter.Deny)
+	}
+
+	if rawConfig.Lockout != nil {
+		config.Lockout, err = lockout.New(rawConfig.Lockout)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Locking out repeated failed binds")
+	}
+
+	if rawConfig.TOTP != nil {
+		config.TOTP, err = totp.New(rawConfig.TOTP)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Requiring one-time passwords of the enrolled users")
+	}
+
+	if rawConfig.MFA != nil {
+		config.MFA, err = mfa.New(rawConfig.MFA)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Asking for a second factor of every bind, failing open: %t", rawConfig.MFA.FailOpen)
+	}
+
+	if rawConfig.GeoIP != nil {
+		config.GeoIP, err = geoip.New(rawConfig.GeoIP)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Locating the clients in the geoip databases")
+	}
+
+	if rawConfig.MemberOf != nil {
+		config.MemberOf, err = memberof.New(rawConfig.MemberOf)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Computing memberOf from the groups of the backends")
+	}
+
+	if rawConfig.RateLimit != nil {
+		config.RateLimit, err = ratelimit.New(rawConfig.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Limiting the rate of binds and searches")
+	}
+
+	if rawConfig.SearchCache != nil {
+		config.SearchCache, err = cache.New("search", rawConfig.SearchCache)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Caching search results")
+	}
+
+	if rawConfig.BindCache != nil {
+		config.BindCache, err = bindcache.New("bind", rawConfig.BindCache)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Caching successful binds")
+	}
+
+	if rawConfig.NegativeCache != nil {
+		if rawConfig.NegativeCache.TTL == "" {
+			rawConfig.NegativeCache.TTL = "10s"
+		}
+
+		config.NegativeSearchCache, err = cache.New("negative_search", rawConfig.NegativeCache)
+		if err != nil {
+			return nil, err
+		}
+		config.NegativeBindCache, err = bindcache.New("negative_bind", &bindcache.Config{Config: *rawConfig.NegativeCache})
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Caching empty searches and failed binds")
+	}
+
+	if rawConfig.Offline != nil {
+		if rawConfig.Offline.TTL == "" {
+			rawConfig.Offline.TTL = "24h"
+		}
+
+		config.OfflineSearchCache, err = cache.New("offline_search", &rawConfig.Offline.Config)
+		if err != nil {
+			return nil, err
+		}
+		config.OfflineBindCache, err = bindcache.New("offline_bind", rawConfig.Offline)
+		if err != nil {
+			return nil, err
+		}
+		log.Print("Serving from the offline cache while all backends are unreachable")
+	}
+
+	if rawConfig.SharedCache != nil {
+		store, err := redis.New(rawConfig.SharedCache)
+		if err != nil {
+			return nil, err
+		}
+
+		config.SearchCache.Share(store)
+		config.NegativeSearchCache.Share(store)
+		config.OfflineSearchCache.Share(store)
+		config.BindCache.Share(store)
+		config.NegativeBindCache.Share(store)
+		config.OfflineBindCache.Share(store)
+		config.Lockout.Share(store)
+		log.Printf("Sharing the caches and lockouts in redis at %s", rawConfig.SharedCache.Address)
+	}
+
+	for _, rawListener := range rawConfig.Listeners {
+		settings, _ := json.Marshal(rawListener)
+		listener := Listener{
+			Name:     rawListener.Name,
+			Address:  rawListener.Address,
+			settings: string(settings),
+		}
+
+		if rawListener.Masking != nil {
+			listener.Masking, err = masking.New(rawListener.Masking)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Masking personal data on listener '%s'", listener.Name)
+		}
+
+		if rawListener.IPFilter != nil {
+			listener.IPFilter, err = ipfilter.New(rawListener.IPFilter)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Filtering the source ips of listener '%s'", listener.Name)
+		}
+
+		if len(rawListener.ValueRules) > 0 {
+			listener.ValueRules, err = valuerules.New(rawListener.ValueRules)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Applying %d value rules on listener '%s'", len(rawListener.ValueRules), listener.Name)
+		}
+
+		config.Listeners = append(config.Listeners, listener)
+	}
+
+	if rawConfig.Subschema == nil {
+		config.Subschema = subschema.Default()
+	} else {
+		config.Subschema, err = subschema.New(rawConfig.Subschema)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Publishing a subschema with %d attribute types and %d object classes", len(rawConfig.Subschema.AttributeTypes), len(rawConfig.Subschema.ObjectClasses))
+	}
+
+	for _, rawReferral := range rawConfig.Referrals {
+		if len(rawReferral.URLs) == 0 {
+			return nil, fmt.Errorf("config: referral of '%s' has no urls", rawReferral.Suffix)
+		}
+
+		config.Referrals = append(config.Referrals, pkg.Referral{Suffix: rawReferral.Suffix, URLs: rawReferral.URLs})
+		log.Printf("Referring searches of '%s' to %v", rawReferral.Suffix, rawReferral.URLs)
+	}
+
+	if len(rawConfig.Protected) > 0 {
+		config.ProtectedSubtrees = rawConfig.Protected
+		log.Printf("Protecting %v from deletes", rawConfig.Protected)
+	}
+
+	if rawConfig.Anonymous != nil {
+		config.Anonymous = &pkg.AnonymousAccess{Subtrees: rawConfig.Anonymous.Subtrees, Attributes: rawConfig.Anonymous.Attributes}
+		log.Printf("Allowing anonymous searches of %v", rawConfig.Anonymous.Subtrees)
+	}
+
+	if rawConfig.ACL != nil {
+		config.ACL, err = acl.New(rawConfig.ACL)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Controlling access with %d rules", len(rawConfig.ACL.Rules))
+	}
+
+	if rawConfig.Redaction != nil {
+		config.Redaction, err = redaction.New(rawConfig.Redaction)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Redacting sensitive attributes except for %v", rawConfig.Redaction.Allow)
+	}
+
+	if len(rawConfig.ValueRules) > 0 {
+		config.ValueRules, err = valuerules.New(rawConfig.ValueRules)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Applying %d value rules", len(rawConfig.ValueRules))
+	}
+
+	if rawConfig.Admin != nil {
+		config.Admin, err = admin.NewAuth(rawConfig.Admin)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Authenticating %d tokens and %d client certificates on the admin api", len(rawConfig.Admin.Tokens), len(rawConfig.Admin.ClientCerts))
+	}
+
+	return config, nil
 }
 
+// instantiateBackend creates the backend of a config and its wrappers. The
+// configs decoded here are listed in backendConfigs for the key check.
 func (loader *Loader) instantiateBackend(data json.RawMessage) (backend pkg.Backend, err error) {
 	kindWrapper := &typedConfig{}
 	err = json.Unmarshal(data, kindWrapper)
@@ -80,7 +617,10 @@ func (loader *Loader) instantiateBackend(data json.RawMessage) (backend pkg.Back
 		return nil, err
 	}
 
-	factory := loader.factories[kindWrapper.Kind]
+	factory, ok := loader.factories[kindWrapper.Kind]
+	if !ok {
+		return nil, fmt.Errorf("config: unknown backend kind '%s'", kindWrapper.Kind)
+	}
 
 	decodedConfig := factory.NewConfig()
 	json.Unmarshal(data, decodedConfig)
@@ -90,6 +630,16 @@ func (loader *Loader) instantiateBackend(data json.RawMessage) (backend pkg.Back
 		return nil, err
 	}
 
+	verifyConfig := &verify.Config{}
+	json.Unmarshal(data, verifyConfig)
+	if len(verifyConfig.Verifiers) > 0 {
+		backend, err = verify.NewBackend(backend, verifyConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Verifying passwords of backend '%s' with %d verifiers", backend.Name(), len(verifyConfig.Verifiers))
+	}
+
 	stripperConfig := &stripper.Config{}
 	json.Unmarshal(data, stripperConfig)
 	if stripperConfig.BaseDn != nil || stripperConfig.PeopleRdn != nil || stripperConfig.UserRdnAttribute != nil {
@@ -107,5 +657,166 @@ func (loader *Loader) instantiateBackend(data json.RawMessage) (backend pkg.Back
 		backend = stripper.NewBackend(backend, stripperConfig)
 		log.Printf("Wrapping backend '%s' with stripper ('%s', '%s', '%s')", backend.Name(), *stripperConfig.UserRdnAttribute, *stripperConfig.PeopleRdn, *stripperConfig.BaseDn)
 	}
+
+	suffixConfig := &suffix.Config{}
+	json.Unmarshal(data, suffixConfig)
+	if len(suffixConfig.SuffixRewrite) > 0 {
+		backend, err = suffix.NewBackend(backend, suffixConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Rewriting %d suffixes of backend '%s'", len(suffixConfig.SuffixRewrite), backend.Name())
+	}
+
+	mappingConfig := &mapping.Config{}
+	json.Unmarshal(data, mappingConfig)
+	if len(mappingConfig.AttributeMap) > 0 {
+		backend, err = mapping.NewBackend(backend, mappingConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Mapping %d attributes of backend '%s'", len(mappingConfig.AttributeMap), backend.Name())
+	}
+
+	rewriteConfig := &rewrite.Config{}
+	json.Unmarshal(data, rewriteConfig)
+	if rewriteConfig.FilterRewrite != nil {
+		backend, err = rewrite.NewBackend(backend, rewriteConfig.FilterRewrite)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Rewriting the search filters of backend '%s' with %d replacements", backend.Name(), len(rewriteConfig.FilterRewrite.Replace))
+	}
+
+	joinConfig := &join.Config{}
+	json.Unmarshal(data, joinConfig)
+	if joinConfig.Join != nil {
+		if len(joinConfig.Join.Backend) == 0 {
+			return nil, fmt.Errorf("config: join of backend '%s' has no backend", backend.Name())
+		}
+		joined, err := loader.instantiateBackend(joinConfig.Join.Backend)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = join.NewBackend(backend, joined, joinConfig.Join)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Joining the entries of backend '%s' with backend '%s' on %s", backend.Name(), joined.Name(), joinConfig.Join.Key)
+	}
+
+	posixConfig := &posix.Config{}
+	json.Unmarshal(data, posixConfig)
+	if posixConfig.Posix != nil {
+		backend, err = posix.NewBackend(backend, posixConfig.Posix)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Synthesizing posix attributes of backend '%s'", backend.Name())
+	}
+
+	membersConfig := &members.Config{}
+	json.Unmarshal(data, membersConfig)
+	if membersConfig.GroupMembers != nil {
+		backend, err = members.NewBackend(backend, membersConfig.GroupMembers)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Converting the group members of backend '%s' to %s", backend.Name(), membersConfig.GroupMembers.Format)
+	}
+
+	computedConfig := &computed.Config{}
+	json.Unmarshal(data, computedConfig)
+	if len(computedConfig.ComputedAttributes) > 0 {
+		backend, err = computed.NewBackend(backend, computedConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Computing %d attributes of backend '%s'", len(computedConfig.ComputedAttributes), backend.Name())
+	}
+
+	objectClassConfig := &objectclass.Config{}
+	json.Unmarshal(data, objectClassConfig)
+	if len(objectClassConfig.ObjectClassMap) > 0 || len(objectClassConfig.AddObjectClasses) > 0 {
+		backend, err = objectclass.NewBackend(backend, objectClassConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Mapping %d and adding %d object classes of backend '%s'", len(objectClassConfig.ObjectClassMap), len(objectClassConfig.AddObjectClasses), backend.Name())
+	}
+
+	scriptConfig := &script.Config{}
+	json.Unmarshal(data, scriptConfig)
+	if scriptConfig.Hooks != nil {
+		backend, err = script.NewBackend(backend, scriptConfig.Hooks)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Applying the hooks of backend '%s'", backend.Name())
+	}
+
+	schemaConfig := &schema.Config{}
+	json.Unmarshal(data, schemaConfig)
+	if schemaConfig.Schema != nil {
+		backend, err = schema.NewBackend(backend, schemaConfig.Schema)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Validating the entries of backend '%s', invalid entries are %s", backend.Name(), schemaConfig.Schema.Invalid)
+	}
+
+	routingConfig := &routing.Config{}
+	json.Unmarshal(data, routingConfig)
+	if len(routingConfig.BindPatterns) > 0 {
+		backend, err = routing.NewBackend(backend, routingConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Routing binds matching %v to backend '%s'", routingConfig.BindPatterns, backend.Name())
+	}
+
+	breakerConfig := &breaker.Config{}
+	json.Unmarshal(data, breakerConfig)
+	if breakerConfig.CircuitBreaker != nil {
+		backend, err = breaker.NewBackend(backend, breakerConfig.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Wrapping backend '%s' with a circuit breaker", backend.Name())
+	}
+
+	retryConfig := &retry.Config{}
+	json.Unmarshal(data, retryConfig)
+	if retryConfig.Retry != nil {
+		backend, err = retry.NewBackend(backend, retryConfig.Retry)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Retrying transient failures of backend '%s'", backend.Name())
+	}
 	return backend, nil
 }
+
+func parseTimeouts(data json.RawMessage) (*pkg.Timeouts, error) {
+	rawTimeouts := &timeoutConfig{}
+	json.Unmarshal(data, rawTimeouts)
+	if rawTimeouts.AuthTimeout == "" && rawTimeouts.SearchTimeout == "" {
+		return nil, nil
+	}
+
+	timeouts := &pkg.Timeouts{}
+
+	var err error
+	if rawTimeouts.AuthTimeout != "" {
+		if timeouts.Authenticate, err = time.ParseDuration(rawTimeouts.AuthTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if rawTimeouts.SearchTimeout != "" {
+		if timeouts.GetUsers, err = time.ParseDuration(rawTimeouts.SearchTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeouts, nil
+}
@@ -23,16 +23,21 @@ package config
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/subschema"
 	"github.com/samuel/go-ldap/ldap"
 	. "github.com/smartystreets/goconvey/convey"
 	"io"
+	"os"
 	"testing"
+	"time"
 )
 
 type testFactory struct {
 	lastConfig *testConfig
+	lastWriter *testWriter
 }
 
 func (*testFactory) Name() (name string) {
@@ -48,6 +53,10 @@ func (factory *testFactory) New(generalConfig interface{}) (backend pkg.Backend,
 	if factory.lastConfig.TestValue == "fail" {
 		return nil, errors.New("config: test error")
 	}
+	if factory.lastConfig.TestValue == "writer" {
+		factory.lastWriter = &testWriter{}
+		return factory.lastWriter, nil
+	}
 	return &testBackend{}, nil
 }
 
@@ -69,6 +78,37 @@ func (testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, er
 	return []*pkg.User{}, nil
 }
 
+type testWriter struct {
+	testBackend
+
+	lastDN       string
+	lastMods     []*ldap.Mod
+	lastPassword string
+}
+
+func (backend *testWriter) SetPassword(ctx context.Context, username string, password string) error {
+	backend.lastDN, backend.lastPassword = username, password
+	return nil
+}
+
+func (*testWriter) Add(ctx context.Context, entry *pkg.User) error {
+	return nil
+}
+
+func (backend *testWriter) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	backend.lastDN, backend.lastMods = dn, mods
+	return nil
+}
+
+func (backend *testWriter) Delete(ctx context.Context, dn string) error {
+	backend.lastDN = dn
+	return nil
+}
+
+func (*testWriter) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	return nil
+}
+
 func TestNewLoader(t *testing.T) {
 	Convey("Given a loader", t, func() {
 		loader := NewLoader()
@@ -106,6 +146,357 @@ func TestLoader_Load(t *testing.T) {
 			})
 		})
 
+		Convey("When loading a config object", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "approval": {"rules": [{"operation": "delete", "dn": "ou=People,dc=example,dc=com"}]}}`))
+
+			Convey("Then the backends and the proxy settings should be loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Backends, ShouldHaveLength, 1)
+				So(config.Approval, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has a masking listener", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "listeners": [{"name": "staging", "address": ":10637", "masking": {"secret": "secret"}}]}`))
+
+			Convey("Then the listener should be loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Listeners, ShouldHaveLength, 1)
+				So(config.Listeners[0].Address, ShouldEqual, ":10637")
+				So(config.Listeners[0].Masking, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has ip filters", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "ipFilter": {"allow": ["10.0.0.0/8"]}, "listeners": [{"name": "partner", "address": ":10637", "ipFilter": {"deny": ["192.0.2.0/24"]}}]}`))
+
+			Convey("Then the ip filters of the proxy and the listener are loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.IPFilter, ShouldNotBeNil)
+				So(config.Listeners[0].IPFilter, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an ip filter has an invalid network", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "ipFilter": {"allow": ["10.0.0.0/33"]}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a masking listener has no secret", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "listeners": [{"name": "staging", "address": ":10637", "masking": {}}]}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config extends the subschema", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "subschema": {"attributeTypes": ["( 1.3.6.1.4.1.99999.1 NAME 'badgeNumber' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )"]}}`))
+
+			Convey("Then the definition is published with the defaults", func() {
+				So(err, ShouldBeNil)
+				So(config.Subschema.Attributes()["attributeTypes"], ShouldHaveLength, len(subschema.DefaultAttributeTypes)+1)
+			})
+		})
+
+		Convey("When the config has referrals", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "referrals": [{"suffix": "dc=partner,dc=com", "urls": ["ldap://ldap.partner.com/dc=partner,dc=com"]}]}`))
+
+			Convey("Then the referrals are loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Referrals, ShouldResemble, []pkg.Referral{{Suffix: "dc=partner,dc=com", URLs: []string{"ldap://ldap.partner.com/dc=partner,dc=com"}}})
+			})
+		})
+
+		Convey("When a referral has no urls", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "referrals": [{"suffix": "dc=partner,dc=com"}]}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has protected subtrees", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "protectedSubtrees": ["ou=system,dc=example,dc=com"]}`))
+
+			Convey("Then the protected subtrees are loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.ProtectedSubtrees, ShouldResemble, []string{"ou=system,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the config allows anonymous searches", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "anonymous": {"subtrees": ["ou=People,dc=example,dc=com"], "attributes": ["cn", "mail"]}}`))
+
+			Convey("Then the anonymous view is loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Anonymous, ShouldResemble, &pkg.AnonymousAccess{Subtrees: []string{"ou=People,dc=example,dc=com"}, Attributes: []string{"cn", "mail"}})
+			})
+		})
+
+		Convey("When the config has access control rules", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "acl": {"rules": [{"who": ["*"], "attributes": ["cn", "mail"], "access": ["read", "search"]}]}}`))
+
+			Convey("Then the policy is created", func() {
+				So(err, ShouldBeNil)
+				So(config.ACL, ShouldNotBeNil)
+				So(config.ACL.GroupAttribute(), ShouldEqual, "memberOf")
+			})
+		})
+
+		Convey("When an access control rule has an unknown access", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "acl": {"rules": [{"who": ["*"], "access": ["everything"]}]}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config redacts attributes", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "redaction": {"attributes": ["userPassword"], "mode": "mask", "allow": ["cn=admin,dc=example,dc=com"]}}`))
+
+			Convey("Then the redactor is created", func() {
+				So(err, ShouldBeNil)
+				So(config.Redaction.Redacts("userPassword"), ShouldBeTrue)
+				So(config.Redaction.Allowed("cn=admin,dc=example,dc=com", nil), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the config has value rules", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "valueRules": [{"attribute": "description", "maxLength": 100}], "listeners": [{"name": "partner", "address": ":10637", "valueRules": [{"attribute": "description", "replace": "[a-z0-9-]+\\.corp\\.example\\.com", "with": "[internal]"}]}]}`))
+
+			Convey("Then the value rules of the proxy and the listener are loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.ValueRules, ShouldNotBeNil)
+				So(config.Listeners[0].ValueRules, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a value rule has an invalid pattern", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "valueRules": [{"attribute": "description", "deny": "("}]}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the redaction has an unknown mode", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "redaction": {"mode": "hide"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has a lockout", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "lockout": {"maxFailures": 3, "window": "1m", "cooldown": "10m"}}`))
+
+			Convey("Then the lockout is created", func() {
+				So(err, ShouldBeNil)
+				So(config.Lockout, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has one-time passwords", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "totp": {"seeds": {"uid=jdoe,dc=example,dc=com": "GEZDGNBVGY3TQOJQ"}}}`))
+
+			Convey("Then the verifier is created", func() {
+				So(err, ShouldBeNil)
+				So(config.TOTP.Enrolled("uid=jdoe,dc=example,dc=com"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the config asks a webhook for the second factor", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "mfa": {"webhook": "https://mfa.example.com/approve", "timeout": "30s", "failOpen": true}}`))
+
+			Convey("Then the guard is created", func() {
+				So(err, ShouldBeNil)
+				So(config.MFA, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the mfa config has no service", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "mfa": {"timeout": "30s"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When memberOf is computed with an invalid ttl", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "memberOf": {"ttl": "soon"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the geoip database doesn't exist", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "geoip": {"countryDatabase": "/nonexistent/GeoLite2-Country.mmdb"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the lockout has an invalid window", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "lockout": {"window": "soon"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has an audit log", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "audit": {"output": "stdout"}}`))
+
+			Convey("Then the audit logger is created", func() {
+				So(err, ShouldBeNil)
+				So(config.Audit, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config references a secret", func() {
+			os.Setenv("LDAP_PROXY_TEST_VALUE", "secretValue")
+			defer os.Unsetenv("LDAP_PROXY_TEST_VALUE")
+
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "${env:LDAP_PROXY_TEST_VALUE}"}]}`))
+
+			Convey("Then the backend gets the secret", func() {
+				So(err, ShouldBeNil)
+				So(tf.lastConfig.TestValue, ShouldEqual, "secretValue")
+			})
+		})
+
+		Convey("When a referenced secret is missing", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "${env:LDAP_PROXY_TEST_MISSING}"}]}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has an auth log", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "authLog": {"output": "stdout"}}`))
+
+			Convey("Then the auth logger is created", func() {
+				So(err, ShouldBeNil)
+				So(config.AuthLog, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has rate limits", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "rateLimit": {"bind": {"perIp": {"rate": 10, "burst": 20}}, "search": {"perDn": {"rate": 50}}}}`))
+
+			Convey("Then the limiter is created", func() {
+				So(err, ShouldBeNil)
+				So(config.RateLimit, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has no subschema", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue"}]`))
+
+			Convey("Then the default subschema is published", func() {
+				So(err, ShouldBeNil)
+				So(config.Subschema, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config authenticates the admin api", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "admin": {"tokens": [{"name": "grafana", "token": "secret", "role": "viewer"}]}}`))
+
+			Convey("Then the admin auth should be created", func() {
+				So(err, ShouldBeNil)
+				So(config.Admin, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an admin token has an unknown role", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "admin": {"tokens": [{"name": "grafana", "token": "secret", "role": "root"}]}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a backend is a replica", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "replicaGroup": "corp", "weight": 2, "bindWeight": 5}]`))
+
+			Convey("Then the replica group is loaded by backend name", func() {
+				So(err, ShouldBeNil)
+				So(config.Replicas["test"].Group, ShouldEqual, "corp")
+				So(config.Replicas["test"].Weight, ShouldEqual, 2)
+				So(config.Replicas["test"].BindWeight, ShouldEqual, 5)
+			})
+		})
+
+		Convey("When a backend has naming contexts", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "namingContexts": ["dc=example,dc=com"]}]`))
+
+			Convey("Then the naming contexts are loaded by backend name", func() {
+				So(err, ShouldBeNil)
+				So(config.NamingContexts["test"], ShouldResemble, []string{"dc=example,dc=com"})
+			})
+		})
+
+		Convey("When a backend is writable", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "writable": true}]`))
+
+			Convey("Then the backend is marked by name", func() {
+				So(err, ShouldBeNil)
+				So(config.Writable["test"], ShouldBeTrue)
+			})
+		})
+
+		Convey("When a backend has a size limit", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "sizeLimit": 100}]`))
+
+			Convey("Then the size limit is loaded by backend name", func() {
+				So(err, ShouldBeNil)
+				So(config.BackendSizeLimits["test"], ShouldEqual, 100)
+			})
+		})
+
+		Convey("When the entries of a backend are filtered by the proxy", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "filterResults": true}]`))
+
+			Convey("Then the backend is marked by name", func() {
+				So(err, ShouldBeNil)
+				So(config.FilterResults["test"], ShouldBeTrue)
+			})
+		})
+
+		Convey("When the config has a search cache", func() {
+			config, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "searchCache": {"ttl": "30s", "maxEntries": 100}}`))
+
+			Convey("Then the cache should be created", func() {
+				So(err, ShouldBeNil)
+				So(config.SearchCache, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the config has a bind cache with an unknown hash", func() {
+			_, err := loader.LoadConfig(toReader(`{"backends": [{"kind": "test", "value": "testValue"}], "bindCache": {"hash": "md5"}}`))
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a backend has timeouts", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "authTimeout": "2s", "searchTimeout": "500ms"}]`))
+
+			Convey("Then the timeouts are loaded by backend name", func() {
+				So(err, ShouldBeNil)
+				So(config.BackendTimeouts["test"].Authenticate, ShouldEqual, 2*time.Second)
+				So(config.BackendTimeouts["test"].GetUsers, ShouldEqual, 500*time.Millisecond)
+			})
+		})
+
 		Convey("When the backend config is invalid", func() {
 			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "fail"}]`))
 
@@ -134,6 +525,324 @@ func TestLoader_Load(t *testing.T) {
 				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
 			})
 		})
+
+		Convey("When there are bind patterns", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "bindPatterns": ["*@contractors.example.com"]}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When there is an invalid bind pattern", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "bindPatterns": ["regex:("]}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When there is a suffix rewrite", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "suffixRewrite": [{"client": "dc=company,dc=internal", "backend": "dc=corp,dc=example"}]}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When there is an attribute map", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "attributeMap": {"uid": "sAMAccountName"}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When there is a filter rewrite", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "filterRewrite": {"replace": [{"match": "(objectClass=posixAccount)", "with": "(objectCategory=person)"}]}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When a filter rewrite has an invalid filter", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "filterRewrite": {"and": "(memberOf=cn=ldap-users"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the entries are joined with another backend", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "join": {"backend": {"kind": "test", "value": "hr"}, "key": "mail"}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When a join has no key", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "join": {"backend": {"kind": "test", "value": "hr"}}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a join has no backend", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "join": {"key": "mail"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When posix attributes are synthesized", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "posix": {"idBase": 200000}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When the group members are converted", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "groupMembers": {"format": "member", "peopleBase": "ou=People,dc=example,dc=com"}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When the group members are converted to an unknown format", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "groupMembers": {"format": "uniqueMember"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When there are computed attributes", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "computedAttributes": {"mail": "{{.uid}}@example.com"}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When a computed attribute has an invalid template", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "computedAttributes": {"mail": "{{.uid@example.com"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When object classes are mapped and added", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "objectClassMap": {"inetOrgPerson": "user"}, "addObjectClasses": ["person"]}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When two object classes are mapped to the same one", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "objectClassMap": {"inetOrgPerson": "user", "person": "User"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When there are hooks", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "hooks": {"bind": "lower(username)", "drop": "has(\"nsAccountLock\")"}}]`))
+
+			Convey("Then the backend will be wrapped", func() {
+				So(err, ShouldBeNil)
+				So(backends, ShouldHaveLength, 1)
+				So(backends[0], ShouldNotHaveSameTypeAs, &testBackend{})
+			})
+		})
+
+		Convey("When a hook has an invalid expression", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "hooks": {"drop": "unknown(dn)"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When two attributes are mapped to the same one", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "attributeMap": {"uid": "sAMAccountName", "login": "sAMAccountName"}}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When loading a yaml config", func() {
+			config, err := loader.LoadConfigFormat(toReader("backends:\n  - kind: test\n    value: testValue\n    sizeLimit: 5\n"), FormatYAML)
+
+			Convey("Then the backends should be loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Backends, ShouldHaveLength, 1)
+				So(tf.lastConfig.TestValue, ShouldEqual, "testValue")
+				So(config.BackendSizeLimits, ShouldContainKey, "test")
+			})
+		})
+
+		Convey("When loading a toml config", func() {
+			config, err := loader.LoadConfigFormat(toReader("[[backends]]\nkind = \"test\"\nvalue = \"testValue\"\n"), FormatTOML)
+
+			Convey("Then the backends should be loaded", func() {
+				So(err, ShouldBeNil)
+				So(config.Backends, ShouldHaveLength, 1)
+				So(tf.lastConfig.TestValue, ShouldEqual, "testValue")
+			})
+		})
+
+		Convey("When a config references environment variables", func() {
+			os.Setenv("LOAD_SIZE_LIMIT", "7")
+			defer os.Unsetenv("LOAD_SIZE_LIMIT")
+
+			config, err := loader.LoadConfigFormat(toReader("backends:\n  - kind: test\n    value: ${LOAD_VALUE:-testValue}\n    sizeLimit: ${LOAD_SIZE_LIMIT}\n"), FormatYAML)
+
+			Convey("Then they should be replaced before the config is parsed", func() {
+				So(err, ShouldBeNil)
+				So(tf.lastConfig.TestValue, ShouldEqual, "testValue")
+				So(config.BackendSizeLimits["test"], ShouldEqual, 7)
+			})
+		})
+
+		Convey("When loading a config with additional backends and listeners", func() {
+			config, err := loader.LoadConfigWith(toReader(`[{"kind": "test", "value": "testValue"}]`), FormatJSON,
+				[]json.RawMessage{[]byte(`{"kind": "test", "value": "resource", "sizeLimit": 3}`)},
+				[]json.RawMessage{[]byte(`{"name": "partners", "address": ":10637"}`)},
+			)
+
+			Convey("Then they should be added to the ones of the file", func() {
+				So(err, ShouldBeNil)
+				So(config.Backends, ShouldHaveLength, 2)
+				So(tf.lastConfig.TestValue, ShouldEqual, "resource")
+				So(config.BackendSizeLimits["test"], ShouldEqual, 3)
+				So(config.Listeners, ShouldHaveLength, 1)
+				So(config.Listeners[0].Name, ShouldEqual, "partners")
+			})
+		})
+
+		Convey("When the listeners of two configs are compared", func() {
+			previous, err := loader.LoadConfig(toReader(`{"backends": [], "listeners": [{"name": "a", "address": ":1"}, {"name": "b", "address": ":2"}]}`))
+			So(err, ShouldBeNil)
+			config, err := loader.LoadConfig(toReader(`{"backends": [], "listeners": [{"name": "a", "address": ":1"}, {"name": "b", "address": ":3"}]}`))
+			So(err, ShouldBeNil)
+
+			Convey("Then only the unchanged listeners should be equal", func() {
+				So(config.Listeners[0].Equal(previous.Listeners[0]), ShouldBeTrue)
+				So(config.Listeners[1].Equal(previous.Listeners[1]), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a yaml config has an unknown key", func() {
+			config, err := loader.LoadConfigFormat(toReader("backends:\n  - kind: test\n    serchTimeout: 1s\n"), FormatYAML)
+
+			Convey("Then an error with the line should be returned", func() {
+				So(config, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "config: line 3: unknown key 'backends[0].serchTimeout'")
+			})
+		})
+
+		Convey("When a json config has an unknown key", func() {
+			config, err := loader.LoadConfig(toReader(`[{"kind": "test", "value": "testValue", "serchTimeout": "1s"}]`))
+
+			Convey("Then the key should be ignored", func() {
+				So(err, ShouldBeNil)
+				So(config.Backends, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a backend has an unknown kind", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "other"}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a writer backend is wrapped", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "writer", "suffixRewrite": [{"client": "dc=company,dc=internal", "backend": "dc=corp,dc=example"}], "attributeMap": {"uid": "sAMAccountName"}, "filterRewrite": {"and": "(objectClass=person)"}, "bindPatterns": ["*"], "circuitBreaker": {}, "retry": {}}]`))
+			So(err, ShouldBeNil)
+			So(backends, ShouldHaveLength, 1)
+
+			writer, ok := backends[0].(pkg.WriterBackend)
+
+			Convey("Then the writes reach the backend with its dns and attributes", func() {
+				So(ok, ShouldBeTrue)
+				err := writer.Modify(context.Background(), "uid=jdoe,dc=company,dc=internal", []*ldap.Mod{
+					{Type: ldap.ModReplace, Name: "uid", Values: [][]byte{[]byte("john")}},
+				})
+
+				So(err, ShouldBeNil)
+				So(tf.lastWriter.lastDN, ShouldEqual, "uid=jdoe,dc=corp,dc=example")
+				So(tf.lastWriter.lastMods[0].Name, ShouldEqual, "sAMAccountName")
+			})
+
+			Convey("Then the passwords are changed in the backend", func() {
+				err := backends[0].(pkg.PasswordBackend).SetPassword(context.Background(), "uid=jdoe,dc=company,dc=internal", "secret")
+
+				So(err, ShouldBeNil)
+				So(tf.lastWriter.lastDN, ShouldEqual, "uid=jdoe,dc=corp,dc=example")
+				So(tf.lastWriter.lastPassword, ShouldEqual, "secret")
+			})
+		})
+
+		Convey("When a backend without writes is wrapped", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "suffixRewrite": [{"client": "dc=company,dc=internal", "backend": "dc=corp,dc=example"}], "retry": {}}]`))
+			So(err, ShouldBeNil)
+
+			Convey("Then the writes are refused", func() {
+				err := backends[0].(pkg.WriterBackend).Delete(context.Background(), "uid=jdoe,dc=company,dc=internal")
+
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+
+		Convey("When a suffix rewrite has no backend suffix", func() {
+			backends, err := loader.Load(toReader(`[{"kind": "test", "value": "testValue", "suffixRewrite": [{"client": "dc=company,dc=internal"}]}]`))
+
+			Convey("Then an error should be returned", func() {
+				So(backends, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
 	})
 }
 
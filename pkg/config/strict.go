@@ -0,0 +1,322 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/breaker"
+	"github.com/gopenguin/ldap-proxy/pkg/computed"
+	"github.com/gopenguin/ldap-proxy/pkg/join"
+	"github.com/gopenguin/ldap-proxy/pkg/mapping"
+	"github.com/gopenguin/ldap-proxy/pkg/members"
+	"github.com/gopenguin/ldap-proxy/pkg/objectclass"
+	"github.com/gopenguin/ldap-proxy/pkg/posix"
+	"github.com/gopenguin/ldap-proxy/pkg/retry"
+	"github.com/gopenguin/ldap-proxy/pkg/rewrite"
+	"github.com/gopenguin/ldap-proxy/pkg/routing"
+	"github.com/gopenguin/ldap-proxy/pkg/schema"
+	"github.com/gopenguin/ldap-proxy/pkg/script"
+	"github.com/gopenguin/ldap-proxy/pkg/stripper"
+	"github.com/gopenguin/ldap-proxy/pkg/suffix"
+	"github.com/gopenguin/ldap-proxy/pkg/verify"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// backendConfigs returns the configs every backend config is decoded into by
+// instantiateBackend besides the config of its factory
+func backendConfigs() []interface{} {
+	return []interface{}{
+		&typedConfig{},
+		&verify.Config{},
+		&stripper.Config{},
+		&suffix.Config{},
+		&mapping.Config{},
+		&rewrite.Config{},
+		&join.Config{},
+		&posix.Config{},
+		&members.Config{},
+		&computed.Config{},
+		&objectclass.Config{},
+		&script.Config{},
+		&schema.Config{},
+		&routing.Config{},
+		&breaker.Config{},
+		&retry.Config{},
+	}
+}
+
+// proxyBackendConfigs returns the settings of the proxy on the backends of the
+// config, which the backends of a join don't have
+func proxyBackendConfigs() []interface{} {
+	return []interface{}{
+		&replicaConfig{},
+		&namingContextConfig{},
+		&sizeLimitConfig{},
+		&filterResultsConfig{},
+		&timeoutConfig{},
+	}
+}
+
+// keyChecker finds the keys of a config no config type has a field for and
+// the values of the wrong type
+type keyChecker struct {
+	loader   *Loader
+	doc      *document
+	problems []string
+}
+
+// checkKeys returns the problems of the keys of the document, ordered by line
+func (loader *Loader) checkKeys(doc *document) []string {
+	checker := &keyChecker{loader: loader, doc: doc}
+
+	var value interface{}
+	if err := json.Unmarshal(doc.data, &value); err != nil {
+		return []string{err.Error()}
+	}
+
+	if backends, ok := value.([]interface{}); ok {
+		for i, backend := range backends {
+			checker.checkBackend(backend, fmt.Sprintf("[%d]", i), true)
+		}
+	} else {
+		checker.check(value, "", reflect.TypeOf(fileConfig{}))
+		if object, ok := value.(map[string]interface{}); ok {
+			if backends, ok := object["backends"].([]interface{}); ok {
+				for i, backend := range backends {
+					checker.checkBackend(backend, fmt.Sprintf("backends[%d]", i), true)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(checker.problems, func(i, j int) bool {
+		return lineOfProblem(checker.problems[i]) < lineOfProblem(checker.problems[j])
+	})
+
+	return checker.problems
+}
+
+func lineOfProblem(problem string) int {
+	var line int
+	fmt.Sscanf(problem, "line %d:", &line)
+
+	return line
+}
+
+func (checker *keyChecker) problem(path string, format string, args ...interface{}) {
+	checker.problems = append(checker.problems, checker.doc.describe(path, fmt.Sprintf(format, args...)))
+}
+
+// checkBackend checks a backend config against the configs of its kind and
+// of the wrappers, descending into the backend of a join
+func (checker *keyChecker) checkBackend(value interface{}, path string, proxy bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		checker.problem(path, "expected an object for the backend '%s'", path)
+		return
+	}
+
+	configs := backendConfigs()
+	if proxy {
+		configs = append(configs, proxyBackendConfigs()...)
+	}
+	if kind, ok := lookupKey(object, "kind").(string); ok {
+		if factory, ok := checker.loader.factories[kind]; ok {
+			configs = append(configs, factory.NewConfig())
+		}
+	}
+
+	var types []reflect.Type
+	for _, config := range configs {
+		types = append(types, reflect.TypeOf(config))
+	}
+	checker.check(value, path, types...)
+
+	if joinConfig, ok := lookupKey(object, "join").(map[string]interface{}); ok {
+		if backend := lookupKey(joinConfig, "backend"); backend != nil {
+			checker.checkBackend(backend, joinPath(path, "join.backend"), false)
+		}
+	}
+}
+
+// lookupKey returns the value of a key like encoding/json, preferring the
+// exact key over a case-insensitive match
+func lookupKey(object map[string]interface{}, key string) interface{} {
+	if value, ok := object[key]; ok {
+		return value
+	}
+	for k, value := range object {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+
+	return nil
+}
+
+// check checks a decoded json value against the types it is decoded into.
+// Like encoding/json, keys match the fields case-insensitively.
+func (checker *keyChecker) check(value interface{}, path string, types ...reflect.Type) {
+	if value == nil {
+		return
+	}
+
+	var accepted []reflect.Type
+	for _, t := range types {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Interface || t == rawMessageType || reflect.PtrTo(t).Implements(unmarshalerType) {
+			return
+		}
+		if accepts(t, value) {
+			accepted = append(accepted, t)
+		}
+	}
+
+	if len(accepted) == 0 {
+		if len(types) > 0 {
+			checker.problem(path, "expected %s for '%s'", describeType(types[0]), path)
+		}
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			var fieldTypes []reflect.Type
+			for _, t := range accepted {
+				fieldTypes = append(fieldTypes, fieldTypesOf(t, key)...)
+			}
+
+			keyPath := joinPath(path, key)
+			if len(fieldTypes) == 0 {
+				checker.problem(keyPath, "unknown key '%s'", keyPath)
+				continue
+			}
+			checker.check(v[key], keyPath, fieldTypes...)
+		}
+	case []interface{}:
+		var itemTypes []reflect.Type
+		for _, t := range accepted {
+			itemTypes = append(itemTypes, t.Elem())
+		}
+		for i, item := range v {
+			checker.check(item, fmt.Sprintf("%s[%d]", path, i), itemTypes...)
+		}
+	}
+}
+
+// accepts returns whether encoding/json decodes the value into the type
+func accepts(t reflect.Type, value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}:
+		return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+	case []interface{}:
+		return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+	case string:
+		return t.Kind() == reflect.String || t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+	case float64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case bool:
+		return t.Kind() == reflect.Bool
+	}
+
+	return false
+}
+
+func describeType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "a string"
+		}
+		return "a list"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	}
+
+	return "a number"
+}
+
+// fieldTypesOf returns the types of the fields of a struct the key is decoded
+// into, including the fields of embedded structs, or the values of a map
+func fieldTypesOf(t reflect.Type, key string) []reflect.Type {
+	if t.Kind() == reflect.Map {
+		return []reflect.Type{t.Elem()}
+	}
+
+	var types []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				types = append(types, fieldTypesOf(embedded, key)...)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			types = append(types, field.Type)
+		}
+	}
+
+	return types
+}
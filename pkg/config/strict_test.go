@@ -0,0 +1,88 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLoader_CheckKeys(t *testing.T) {
+	Convey("Given a loader", t, func() {
+		loader := NewLoader()
+		loader.AddFactory(&testFactory{})
+
+		check := func(data string) []string {
+			doc, err := parseDocument([]byte(data), FormatJSON)
+			So(err, ShouldBeNil)
+			return loader.checkKeys(doc)
+		}
+
+		Convey("When the keys are known", func() {
+			problems := check(`{"backends": [{"KIND": "test", "value": "a", "name": "b", "sizeLimit": 5, "retry": {"maxRetries": 2}}], "listeners": [{"name": "a", "valueRules": [{"attribute": "mail"}]}]}`)
+
+			Convey("Then no problems should be returned", func() {
+				So(problems, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When keys are unknown", func() {
+			problems := check("{\n  \"backends\": [\n    {\"kind\": \"test\", \"retry\": {\"maxRetris\": 2}}\n  ],\n  \"searchCash\": {}\n}")
+
+			Convey("Then they should be returned with their lines", func() {
+				So(problems, ShouldResemble, []string{
+					"line 3: unknown key 'backends[0].retry.maxRetris'",
+					"line 5: unknown key 'searchCash'",
+				})
+			})
+		})
+
+		Convey("When a value has the wrong type", func() {
+			problems := check(`[{"kind": "test", "sizeLimit": "5", "filterResults": 1}]`)
+
+			Convey("Then the expected type should be returned", func() {
+				So(problems, ShouldResemble, []string{
+					"line 1: expected true or false for '[0].filterResults'",
+					"line 1: expected a number for '[0].sizeLimit'",
+				})
+			})
+		})
+
+		Convey("When a joined backend has an unknown key", func() {
+			problems := check(`[{"kind": "test", "join": {"key": "uid", "backend": {"kind": "test", "valu": "a", "sizeLimit": 5}}}]`)
+
+			Convey("Then the keys of the joined backend should be checked without the proxy settings", func() {
+				So(problems, ShouldResemble, []string{
+					"line 1: unknown key '[0].join.backend.sizeLimit'",
+					"line 1: unknown key '[0].join.backend.valu'",
+				})
+			})
+		})
+
+		Convey("When the backend has an unknown kind", func() {
+			problems := check(`[{"kind": "other"}]`)
+
+			Convey("Then only the keys of the wrappers should be checked", func() {
+				So(problems, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,500 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlParser parses the subset of toml used by config files: tables, arrays
+// of tables, dotted keys, strings, integers, floats, booleans, arrays and
+// inline tables. Dates and times are refused.
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+
+	root map[string]interface{}
+	// the table the key values are added to and its path
+	table     map[string]interface{}
+	tablePath string
+	// the tables defined by a header, which may not be defined again
+	defined map[string]bool
+
+	// the lines of the keys by path
+	positions map[string]int
+}
+
+// parseTOML returns the document as the values of encoding/json and the
+// lines of its keys
+func parseTOML(data []byte) (interface{}, map[string]int, error) {
+	parser := &tomlParser{
+		data:      strings.Replace(string(data), "\r\n", "\n", -1),
+		line:      1,
+		root:      make(map[string]interface{}),
+		defined:   make(map[string]bool),
+		positions: make(map[string]int),
+	}
+	parser.table = parser.root
+
+	for {
+		parser.skipSpace(true)
+		if parser.pos >= len(parser.data) {
+			return parser.root, parser.positions, nil
+		}
+
+		var err error
+		if parser.data[parser.pos] == '[' {
+			err = parser.parseHeader()
+		} else {
+			err = parser.parseKeyValue(parser.table, parser.tablePath)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := parser.endOfLine(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func (parser *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", parser.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips the spaces and comments, and the line breaks if requested
+func (parser *tomlParser) skipSpace(newlines bool) {
+	for parser.pos < len(parser.data) {
+		switch parser.data[parser.pos] {
+		case ' ', '\t':
+		case '\n':
+			if !newlines {
+				return
+			}
+			parser.line++
+		case '#':
+			for parser.pos < len(parser.data) && parser.data[parser.pos] != '\n' {
+				parser.pos++
+			}
+			continue
+		default:
+			return
+		}
+		parser.pos++
+	}
+}
+
+func (parser *tomlParser) endOfLine() error {
+	parser.skipSpace(false)
+	if parser.pos < len(parser.data) && parser.data[parser.pos] != '\n' {
+		return parser.errorf("unexpected '%s' after the value", parser.rest())
+	}
+
+	return nil
+}
+
+// rest returns the remainder of the current line for error messages
+func (parser *tomlParser) rest() string {
+	rest := parser.data[parser.pos:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+
+	return rest
+}
+
+// parseHeader parses a [table] or an [[array of tables]] header
+func (parser *tomlParser) parseHeader() error {
+	array := strings.HasPrefix(parser.data[parser.pos:], "[[")
+	if array {
+		parser.pos += 2
+	} else {
+		parser.pos++
+	}
+
+	keys, err := parser.parseKey()
+	if err != nil {
+		return err
+	}
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	parser.skipSpace(false)
+	if !strings.HasPrefix(parser.data[parser.pos:], closing) {
+		return parser.errorf("expected '%s' after the table name", closing)
+	}
+	parser.pos += len(closing)
+
+	table, path, err := parser.descend(parser.root, "", keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	last := keys[len(keys)-1]
+	path = joinPath(path, last)
+	if array {
+		tables, ok := table[last].([]interface{})
+		if _, exists := table[last]; exists && !ok {
+			return parser.errorf("'%s' is not an array of tables", path)
+		}
+		parser.positions[path] = parser.line
+		path = fmt.Sprintf("%s[%d]", path, len(tables))
+
+		parser.table = make(map[string]interface{})
+		table[last] = append(tables, parser.table)
+	} else {
+		if parser.defined[path] {
+			return parser.errorf("table '%s' is defined twice", path)
+		}
+		parser.defined[path] = true
+
+		next, err := parser.subTable(table, last, path)
+		if err != nil {
+			return err
+		}
+		parser.table = next
+	}
+
+	parser.tablePath = path
+	parser.positions[path] = parser.line
+	return nil
+}
+
+// descend returns the table of the dotted keys below the table, creating the
+// missing ones and entering the last table of arrays of tables
+func (parser *tomlParser) descend(table map[string]interface{}, path string, keys []string) (map[string]interface{}, string, error) {
+	for _, key := range keys {
+		path = joinPath(path, key)
+		if tables, ok := table[key].([]interface{}); ok && len(tables) > 0 {
+			last, ok := tables[len(tables)-1].(map[string]interface{})
+			if !ok {
+				return nil, "", parser.errorf("'%s' is not a table", path)
+			}
+			path = fmt.Sprintf("%s[%d]", path, len(tables)-1)
+			table = last
+			continue
+		}
+
+		next, err := parser.subTable(table, key, path)
+		if err != nil {
+			return nil, "", err
+		}
+		table = next
+	}
+
+	return table, path, nil
+}
+
+func (parser *tomlParser) subTable(table map[string]interface{}, key string, path string) (map[string]interface{}, error) {
+	value, ok := table[key]
+	if !ok {
+		next := make(map[string]interface{})
+		table[key] = next
+		if _, ok := parser.positions[path]; !ok {
+			parser.positions[path] = parser.line
+		}
+		return next, nil
+	}
+
+	next, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, parser.errorf("'%s' is not a table", path)
+	}
+
+	return next, nil
+}
+
+// parseKeyValue parses a `key = value` pair into the table
+func (parser *tomlParser) parseKeyValue(table map[string]interface{}, path string) error {
+	line := parser.line
+	keys, err := parser.parseKey()
+	if err != nil {
+		return err
+	}
+
+	parser.skipSpace(false)
+	if parser.pos >= len(parser.data) || parser.data[parser.pos] != '=' {
+		return parser.errorf("expected '=' after the key")
+	}
+	parser.pos++
+
+	table, path, err = parser.descend(table, path, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	last := keys[len(keys)-1]
+	path = joinPath(path, last)
+	if _, ok := table[last]; ok {
+		return parser.errorf("duplicate key '%s'", path)
+	}
+	parser.positions[path] = line
+
+	value, err := parser.parseValue(path)
+	if err != nil {
+		return err
+	}
+	table[last] = value
+
+	return nil
+}
+
+// parseKey parses a bare, quoted or dotted key
+func (parser *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		parser.skipSpace(false)
+		if parser.pos >= len(parser.data) {
+			return nil, parser.errorf("expected a key")
+		}
+
+		var key string
+		switch parser.data[parser.pos] {
+		case '"':
+			value, err := parser.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		case '\'':
+			value, err := parser.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		default:
+			start := parser.pos
+			for parser.pos < len(parser.data) && isBareKey(parser.data[parser.pos]) {
+				parser.pos++
+			}
+			if start == parser.pos {
+				return nil, parser.errorf("expected a key instead of '%s'", parser.rest())
+			}
+			key = parser.data[start:parser.pos]
+		}
+		keys = append(keys, key)
+
+		parser.skipSpace(false)
+		if parser.pos >= len(parser.data) || parser.data[parser.pos] != '.' {
+			return keys, nil
+		}
+		parser.pos++
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (parser *tomlParser) parseValue(path string) (interface{}, error) {
+	parser.skipSpace(false)
+	if parser.pos >= len(parser.data) || parser.data[parser.pos] == '\n' {
+		return nil, parser.errorf("expected a value")
+	}
+
+	switch {
+	case strings.HasPrefix(parser.data[parser.pos:], `"""`):
+		return parser.parseMultilineString(`"""`)
+	case strings.HasPrefix(parser.data[parser.pos:], `'''`):
+		return parser.parseMultilineString(`'''`)
+	case parser.data[parser.pos] == '"':
+		return parser.parseBasicString()
+	case parser.data[parser.pos] == '\'':
+		return parser.parseLiteralString()
+	case parser.data[parser.pos] == '[':
+		return parser.parseArray(path)
+	case parser.data[parser.pos] == '{':
+		return parser.parseInlineTable(path)
+	}
+
+	start := parser.pos
+	for parser.pos < len(parser.data) && !strings.ContainsRune(" \t\n#,]}", rune(parser.data[parser.pos])) {
+		parser.pos++
+	}
+	raw := parser.data[start:parser.pos]
+
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, parser.errorf("infinite and nan floats are not supported")
+	}
+
+	number := strings.Replace(raw, "_", "", -1)
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil && (!strings.HasPrefix(strings.TrimLeft(number, "+-"), "0") || len(strings.TrimLeft(number, "+-")) == 1 || strings.ContainsAny(number, "xob")) {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil && !strings.ContainsAny(number, "xXpP") {
+		return f, nil
+	}
+	if len(raw) >= 10 && raw[4] == '-' && raw[7] == '-' || len(raw) >= 8 && raw[2] == ':' && raw[5] == ':' {
+		return nil, parser.errorf("dates and times are not supported, quote '%s'", raw)
+	}
+
+	return nil, parser.errorf("invalid value '%s'", raw)
+}
+
+func (parser *tomlParser) parseArray(path string) (interface{}, error) {
+	parser.pos++
+
+	array := []interface{}{}
+	for {
+		parser.skipSpace(true)
+		if parser.pos >= len(parser.data) {
+			return nil, parser.errorf("unterminated array")
+		}
+		if parser.data[parser.pos] == ']' {
+			parser.pos++
+			return array, nil
+		}
+
+		itemPath := fmt.Sprintf("%s[%d]", path, len(array))
+		parser.positions[itemPath] = parser.line
+		value, err := parser.parseValue(itemPath)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		parser.skipSpace(true)
+		if parser.pos < len(parser.data) && parser.data[parser.pos] == ',' {
+			parser.pos++
+		} else if parser.pos >= len(parser.data) || parser.data[parser.pos] != ']' {
+			return nil, parser.errorf("expected ',' or ']' in the array")
+		}
+	}
+}
+
+func (parser *tomlParser) parseInlineTable(path string) (interface{}, error) {
+	parser.pos++
+
+	table := make(map[string]interface{})
+	for {
+		parser.skipSpace(false)
+		if parser.pos < len(parser.data) && parser.data[parser.pos] == '}' {
+			parser.pos++
+			return table, nil
+		}
+
+		if err := parser.parseKeyValue(table, path); err != nil {
+			return nil, err
+		}
+
+		parser.skipSpace(false)
+		if parser.pos < len(parser.data) && parser.data[parser.pos] == ',' {
+			parser.pos++
+		} else if parser.pos >= len(parser.data) || parser.data[parser.pos] != '}' {
+			return nil, parser.errorf("expected ',' or '}' in the inline table")
+		}
+	}
+}
+
+func (parser *tomlParser) parseBasicString() (string, error) {
+	start := parser.pos
+	for parser.pos++; parser.pos < len(parser.data); parser.pos++ {
+		switch parser.data[parser.pos] {
+		case '\\':
+			parser.pos++
+		case '\n':
+			return "", parser.errorf("unterminated string")
+		case '"':
+			parser.pos++
+			value, err := strconv.Unquote(parser.data[start:parser.pos])
+			if err != nil {
+				return "", parser.errorf("invalid string %s", parser.data[start:parser.pos])
+			}
+			return value, nil
+		}
+	}
+
+	return "", parser.errorf("unterminated string")
+}
+
+func (parser *tomlParser) parseLiteralString() (string, error) {
+	start := parser.pos + 1
+	end := strings.IndexAny(parser.data[start:], "'\n")
+	if end < 0 || parser.data[start+end] != '\'' {
+		return "", parser.errorf("unterminated string")
+	}
+	parser.pos = start + end + 1
+
+	return parser.data[start : start+end], nil
+}
+
+// parseMultilineString parses the basic (""") and literal (”') multi-line
+// strings, dropping a line break right after the opening quotes
+func (parser *tomlParser) parseMultilineString(quotes string) (string, error) {
+	parser.pos += len(quotes)
+	end := strings.Index(parser.data[parser.pos:], quotes)
+	if end < 0 {
+		return "", parser.errorf("unterminated multi-line string")
+	}
+	raw := parser.data[parser.pos : parser.pos+end]
+	parser.line += strings.Count(raw, "\n")
+	parser.pos += end + len(quotes)
+
+	raw = strings.TrimPrefix(raw, "\n")
+	if quotes == `'''` {
+		return raw, nil
+	}
+
+	var value bytes.Buffer
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			value.WriteByte(raw[i])
+			continue
+		}
+
+		// a backslash at the end of a line trims the following whitespace
+		if trimmed := strings.TrimLeft(raw[i+1:], " \t"); strings.HasPrefix(trimmed, "\n") {
+			i = len(raw) - len(strings.TrimLeft(trimmed, " \t\n")) - 1
+			continue
+		}
+
+		length := 2
+		switch raw[i+1] {
+		case 'u':
+			length = 6
+		case 'U':
+			length = 10
+		}
+		if i+length > len(raw) {
+			return "", parser.errorf("invalid escape %s", raw[i:])
+		}
+		escape := raw[i : i+length]
+		unquoted, err := strconv.Unquote(`"` + escape + `"`)
+		if err != nil {
+			return "", parser.errorf("invalid escape %s", escape)
+		}
+		value.WriteString(unquoted)
+		i += len(escape) - 1
+	}
+
+	return value.String(), nil
+}
@@ -0,0 +1,125 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	Convey("Given a toml document", t, func() {
+		data := []byte(`# the proxy
+protectedSubtrees = [
+  "ou=Admins,dc=example,dc=com", # a comment
+  'ou=Services,dc=example,dc=com',
+]
+
+[searchCache]
+ttl = "1m"
+maxEntries = 1_000
+
+[[backends]]
+kind = "test"
+value = "quoted # not a comment"
+rewrite = { from = "a", to = 'it\s' }
+filterResults = true
+retry.attempts = 3
+
+[[backends]]
+kind = "other"
+description = """
+first
+second"""
+
+[backends.join]
+key = "uid"
+`)
+
+		value, positions, err := parseTOML(data)
+
+		Convey("Then the values should be parsed", func() {
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, map[string]interface{}{
+				"protectedSubtrees": []interface{}{"ou=Admins,dc=example,dc=com", "ou=Services,dc=example,dc=com"},
+				"searchCache":       map[string]interface{}{"ttl": "1m", "maxEntries": int64(1000)},
+				"backends": []interface{}{
+					map[string]interface{}{
+						"kind":          "test",
+						"value":         "quoted # not a comment",
+						"rewrite":       map[string]interface{}{"from": "a", "to": `it\s`},
+						"filterResults": true,
+						"retry":         map[string]interface{}{"attempts": int64(3)},
+					},
+					map[string]interface{}{
+						"kind":        "other",
+						"description": "first\nsecond",
+						"join":        map[string]interface{}{"key": "uid"},
+					},
+				},
+			})
+		})
+
+		Convey("Then the lines of the keys should be returned", func() {
+			So(positions["protectedSubtrees[1]"], ShouldEqual, 4)
+			So(positions["searchCache.maxEntries"], ShouldEqual, 9)
+			So(positions["backends[0].retry.attempts"], ShouldEqual, 16)
+			So(positions["backends[1].description"], ShouldEqual, 20)
+			So(positions["backends[1].join.key"], ShouldEqual, 25)
+		})
+	})
+
+	Convey("Given a toml document with a duplicate key", t, func() {
+		_, _, err := parseTOML([]byte("a = 1\n[b]\nc = 2\nc = 3\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 4: duplicate key 'b.c'")
+		})
+	})
+
+	Convey("Given a toml document defining a table twice", t, func() {
+		_, _, err := parseTOML([]byte("[a]\nb = 1\n[a]\nc = 2\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 3: table 'a' is defined twice")
+		})
+	})
+
+	Convey("Given a toml document with a date", t, func() {
+		_, _, err := parseTOML([]byte("a = 1\nb = 2017-01-01\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 2: dates and times are not supported")
+		})
+	})
+
+	Convey("Given a toml document with two values on a line", t, func() {
+		_, _, err := parseTOML([]byte("a = 1 b = 2\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 1:")
+		})
+	})
+}
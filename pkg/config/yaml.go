@@ -0,0 +1,551 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a yaml document without its indentation
+type yamlLine struct {
+	number  int
+	indent  int
+	content string
+}
+
+// yamlParser parses the subset of yaml used by config files: block mappings
+// and sequences, flow collections on a single line, plain, quoted and block
+// scalars and comments. Anchors, aliases, tags and multiple documents are
+// refused.
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+
+	// the lines of the keys by path
+	positions map[string]int
+}
+
+// parseYAML returns the document as the values of encoding/json and the
+// lines of its keys
+func parseYAML(data []byte) (interface{}, map[string]int, error) {
+	parser := &yamlParser{positions: make(map[string]int)}
+
+	for i, raw := range strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n") {
+		content := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(content, "\t") {
+			return nil, nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		parser.lines = append(parser.lines, &yamlLine{number: i + 1, indent: len(raw) - len(content), content: strings.TrimRight(content, " \t")})
+	}
+
+	parser.skipEmpty()
+	if parser.pos < len(parser.lines) && parser.lines[parser.pos].content == "---" {
+		parser.pos++
+		parser.skipEmpty()
+	}
+	if parser.pos >= len(parser.lines) {
+		return map[string]interface{}{}, parser.positions, nil
+	}
+
+	value, err := parser.parseBlock(parser.lines[parser.pos].indent, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parser.skipEmpty()
+	if parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		return nil, nil, fmt.Errorf("line %d: unexpected '%s'", line.number, line.content)
+	}
+
+	return value, parser.positions, nil
+}
+
+// skipEmpty skips the blank lines and the comments
+func (parser *yamlParser) skipEmpty() {
+	for parser.pos < len(parser.lines) {
+		content := parser.lines[parser.pos].content
+		if content != "" && !strings.HasPrefix(content, "#") {
+			return
+		}
+		parser.pos++
+	}
+}
+
+// current returns the next line with content, nil at the end
+func (parser *yamlParser) current() *yamlLine {
+	parser.skipEmpty()
+	if parser.pos >= len(parser.lines) {
+		return nil
+	}
+
+	return parser.lines[parser.pos]
+}
+
+func (parser *yamlParser) parseBlock(indent int, path string) (interface{}, error) {
+	line := parser.current()
+	if isSequenceItem(line.content) {
+		return parser.parseSequence(indent, path)
+	}
+	if _, _, ok := splitKey(line.content); ok {
+		return parser.parseMapping(indent, path)
+	}
+
+	parser.pos++
+	return parseYAMLValue(stripComment(line.content), line.number)
+}
+
+func (parser *yamlParser) parseMapping(indent int, path string) (interface{}, error) {
+	mapping := make(map[string]interface{})
+
+	for line := parser.current(); line != nil && line.indent == indent && !isSequenceItem(line.content); line = parser.current() {
+		rawKey, rest, ok := splitKey(line.content)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a key in '%s'", line.number, line.content)
+		}
+		key, err := parseYAMLKey(rawKey, line.number)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", line.number, key)
+		}
+
+		keyPath := joinPath(path, key)
+		parser.positions[keyPath] = line.number
+		parser.pos++
+
+		mapping[key], err = parser.parseNested(line, indent, stripComment(rest), keyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if line := parser.current(); line != nil && line.indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+	}
+
+	return mapping, nil
+}
+
+func (parser *yamlParser) parseSequence(indent int, path string) (interface{}, error) {
+	sequence := []interface{}{}
+
+	for line := parser.current(); line != nil && line.indent == indent && isSequenceItem(line.content); line = parser.current() {
+		itemPath := fmt.Sprintf("%s[%d]", path, len(sequence))
+		parser.positions[itemPath] = line.number
+
+		rest := strings.TrimLeft(line.content[1:], " ")
+		if _, _, isKey := splitKey(rest); rest != "" && (isKey || isSequenceItem(rest)) {
+			// the item is a block starting on the line of the dash
+			line.indent += len(line.content) - len(rest)
+			line.content = rest
+
+			item, err := parser.parseBlock(line.indent, itemPath)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, item)
+			continue
+		}
+
+		parser.pos++
+		item, err := parser.parseNested(line, indent, stripComment(rest), itemPath)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, item)
+	}
+
+	return sequence, nil
+}
+
+// parseNested parses the value of a key or an item: inline, a block scalar or
+// the block of the following lines
+func (parser *yamlParser) parseNested(line *yamlLine, indent int, rest string, path string) (interface{}, error) {
+	if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+		return parser.parseBlockScalar(indent, rest, line.number)
+	}
+	if rest != "" {
+		return parseYAMLValue(rest, line.number)
+	}
+
+	next := parser.current()
+	if next == nil {
+		return nil, nil
+	}
+	if next.indent > indent {
+		return parser.parseBlock(next.indent, path)
+	}
+	// sequences of mappings are often not indented below their key
+	if next.indent == indent && isSequenceItem(next.content) && !isSequenceItem(line.content) {
+		return parser.parseSequence(indent, path)
+	}
+
+	return nil, nil
+}
+
+// parseBlockScalar parses the literal (|) and folded (>) scalars, optionally
+// stripping (-) or keeping (+) the final line breaks
+func (parser *yamlParser) parseBlockScalar(indent int, header string, number int) (interface{}, error) {
+	style, chomping := header[0], header[1:]
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return nil, fmt.Errorf("line %d: unsupported block scalar '%s'", number, header)
+	}
+
+	var lines []string
+	blockIndent := -1
+	for parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		if line.content == "" {
+			lines = append(lines, "")
+			parser.pos++
+			continue
+		}
+		if line.indent <= indent || (blockIndent >= 0 && line.indent < blockIndent) {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-blockIndent)+line.content)
+		parser.pos++
+	}
+
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var value string
+	if style == '|' {
+		value = strings.Join(lines, "\n")
+	} else {
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || lines[i-1] == "":
+				value += "\n"
+			default:
+				value += " "
+			}
+			value += line
+		}
+	}
+
+	switch {
+	case len(lines) == 0:
+	case chomping == "-":
+	case chomping == "+":
+		value += strings.Repeat("\n", trailing+1)
+	default:
+		value += "\n"
+	}
+
+	return value, nil
+}
+
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// splitKey splits a `key: value` line at the colon outside of quotes
+func splitKey(content string) (key string, rest string, ok bool) {
+	if strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{") || strings.HasPrefix(content, "#") {
+		return "", "", false
+	}
+
+	quote := byte(0)
+	if content != "" && (content[0] == '"' || content[0] == '\'') {
+		quote = content[0]
+	}
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0 && i > 0 && c == quote:
+			if quote == '"' && content[i-1] == '\\' {
+				continue
+			}
+			if quote == '\'' && i+1 < len(content) && content[i+1] == '\'' {
+				i++
+				continue
+			}
+			quote = 0
+		case quote != 0:
+		case c == '#' && i > 0 && content[i-1] == ' ':
+			return "", "", false
+		case c == ':' && (i+1 == len(content) || content[i+1] == ' '):
+			return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// stripComment drops a comment after the value, outside of quotes
+func stripComment(content string) string {
+	quote := byte(0)
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || content[i-1] == ' '):
+			return strings.TrimSpace(content[:i])
+		}
+	}
+
+	return strings.TrimSpace(content)
+}
+
+func parseYAMLKey(key string, number int) (string, error) {
+	if strings.HasPrefix(key, "\"") || strings.HasPrefix(key, "'") {
+		value, err := parseYAMLValue(key, number)
+		if err != nil {
+			return "", err
+		}
+		return value.(string), nil
+	}
+
+	return key, nil
+}
+
+// parseYAMLValue parses an inline value: a flow collection or a scalar
+func parseYAMLValue(content string, number int) (interface{}, error) {
+	if strings.HasPrefix(content, "&") || strings.HasPrefix(content, "*") || strings.HasPrefix(content, "!") {
+		return nil, fmt.Errorf("line %d: anchors, aliases and tags are not supported", number)
+	}
+
+	flow := &yamlFlow{content: content, number: number}
+	value, err := flow.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	flow.skipSpace()
+	if flow.pos < len(flow.content) {
+		return nil, fmt.Errorf("line %d: unexpected '%s'", number, flow.content[flow.pos:])
+	}
+
+	return value, nil
+}
+
+// yamlFlow parses flow collections and scalars of a single line
+type yamlFlow struct {
+	content string
+	pos     int
+	number  int
+	depth   int
+}
+
+func (flow *yamlFlow) skipSpace() {
+	for flow.pos < len(flow.content) && flow.content[flow.pos] == ' ' {
+		flow.pos++
+	}
+}
+
+func (flow *yamlFlow) parseValue() (interface{}, error) {
+	flow.skipSpace()
+	if flow.pos >= len(flow.content) {
+		return nil, nil
+	}
+
+	switch flow.content[flow.pos] {
+	case '[':
+		return flow.parseSequence()
+	case '{':
+		return flow.parseMapping()
+	case '"':
+		return flow.parseDoubleQuoted()
+	case '\'':
+		return flow.parseSingleQuoted()
+	}
+
+	start := flow.pos
+	for flow.pos < len(flow.content) {
+		c := flow.content[flow.pos]
+		if flow.depth > 0 && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		if c == ':' && flow.depth > 0 && (flow.pos+1 == len(flow.content) || strings.ContainsRune(" ,]}", rune(flow.content[flow.pos+1]))) {
+			break
+		}
+		flow.pos++
+	}
+
+	return plainScalar(strings.TrimSpace(flow.content[start:flow.pos])), nil
+}
+
+func (flow *yamlFlow) parseSequence() (interface{}, error) {
+	flow.pos++
+	flow.depth++
+	defer func() { flow.depth-- }()
+
+	sequence := []interface{}{}
+	for {
+		flow.skipSpace()
+		if flow.pos >= len(flow.content) {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence, flow collections must end on their line", flow.number)
+		}
+		if flow.content[flow.pos] == ']' {
+			flow.pos++
+			return sequence, nil
+		}
+
+		item, err := flow.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, item)
+
+		if err := flow.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (flow *yamlFlow) parseMapping() (interface{}, error) {
+	flow.pos++
+	flow.depth++
+	defer func() { flow.depth-- }()
+
+	mapping := make(map[string]interface{})
+	for {
+		flow.skipSpace()
+		if flow.pos >= len(flow.content) {
+			return nil, fmt.Errorf("line %d: unterminated flow mapping, flow collections must end on their line", flow.number)
+		}
+		if flow.content[flow.pos] == '}' {
+			flow.pos++
+			return mapping, nil
+		}
+
+		key, err := flow.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		flow.skipSpace()
+		if flow.pos >= len(flow.content) || flow.content[flow.pos] != ':' {
+			return nil, fmt.Errorf("line %d: expected ':' after the key %v", flow.number, key)
+		}
+		flow.pos++
+
+		value, err := flow.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		mapping[fmt.Sprint(key)] = value
+
+		if err := flow.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the comma between the items, leaving the closing bracket
+func (flow *yamlFlow) separator(closing byte) error {
+	flow.skipSpace()
+	if flow.pos < len(flow.content) && flow.content[flow.pos] == ',' {
+		flow.pos++
+		return nil
+	}
+	if flow.pos < len(flow.content) && flow.content[flow.pos] == closing {
+		return nil
+	}
+
+	return fmt.Errorf("line %d: expected ',' or '%c'", flow.number, closing)
+}
+
+func (flow *yamlFlow) parseDoubleQuoted() (interface{}, error) {
+	start := flow.pos
+	for flow.pos++; flow.pos < len(flow.content); flow.pos++ {
+		switch flow.content[flow.pos] {
+		case '\\':
+			flow.pos++
+		case '"':
+			flow.pos++
+			value, err := strconv.Unquote(flow.content[start:flow.pos])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", flow.number, flow.content[start:flow.pos])
+			}
+			return value, nil
+		}
+	}
+
+	return nil, fmt.Errorf("line %d: unterminated string", flow.number)
+}
+
+func (flow *yamlFlow) parseSingleQuoted() (interface{}, error) {
+	var value bytes.Buffer
+	for flow.pos++; flow.pos < len(flow.content); flow.pos++ {
+		c := flow.content[flow.pos]
+		if c == '\'' {
+			if flow.pos+1 < len(flow.content) && flow.content[flow.pos+1] == '\'' {
+				value.WriteByte('\'')
+				flow.pos++
+				continue
+			}
+			flow.pos++
+			return value.String(), nil
+		}
+		value.WriteByte(c)
+	}
+
+	return nil, fmt.Errorf("line %d: unterminated string", flow.number)
+}
+
+// plainScalar resolves the plain scalars of the yaml core schema
+func plainScalar(value string) interface{} {
+	switch value {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	if i, err := strconv.ParseInt(value, 0, 64); err == nil && !strings.ContainsAny(value, "_") {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !strings.ContainsAny(value, "_xXpP") && !strings.HasPrefix(strings.ToLower(strings.TrimLeft(value, "+-")), "in") && !strings.HasPrefix(strings.ToLower(value), "nan") {
+		return f
+	}
+
+	return value
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,145 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	Convey("Given a yaml document", t, func() {
+		data := []byte(`# the proxy
+backends:
+- kind: test   # a comment
+  value: "quoted # not a comment"
+  sizeLimit: 10
+  filterResults: true
+  namingContexts: [dc=example, "dc=org"]
+  rewrite: {from: a, to: 'it''s'}
+-   kind: other
+    empty:
+listeners:
+  - name: internal
+    certificate: |
+      line 1
+        line 2
+    folded: >-
+      one
+      two
+`)
+
+		value, positions, err := parseYAML(data)
+
+		Convey("Then the values should be parsed", func() {
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, map[string]interface{}{
+				"backends": []interface{}{
+					map[string]interface{}{
+						"kind":           "test",
+						"value":          "quoted # not a comment",
+						"sizeLimit":      int64(10),
+						"filterResults":  true,
+						"namingContexts": []interface{}{"dc=example", "dc=org"},
+						"rewrite":        map[string]interface{}{"from": "a", "to": "it's"},
+					},
+					map[string]interface{}{
+						"kind":  "other",
+						"empty": nil,
+					},
+				},
+				"listeners": []interface{}{
+					map[string]interface{}{
+						"name":        "internal",
+						"certificate": "line 1\n  line 2\n",
+						"folded":      "one two",
+					},
+				},
+			})
+		})
+
+		Convey("Then the lines of the keys should be returned", func() {
+			So(positions["backends"], ShouldEqual, 2)
+			So(positions["backends[0]"], ShouldEqual, 3)
+			So(positions["backends[0].sizeLimit"], ShouldEqual, 5)
+			So(positions["backends[1].empty"], ShouldEqual, 10)
+			So(positions["listeners[0].folded"], ShouldEqual, 16)
+		})
+	})
+
+	Convey("Given an empty yaml document", t, func() {
+		value, _, err := parseYAML([]byte("---\n# nothing\n"))
+
+		Convey("Then an empty object should be returned", func() {
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, map[string]interface{}{})
+		})
+	})
+
+	Convey("Given a yaml document with a duplicate key", t, func() {
+		_, _, err := parseYAML([]byte("a: 1\nb: 2\na: 3\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 3: duplicate key 'a'")
+		})
+	})
+
+	Convey("Given a yaml document with a wrong indentation", t, func() {
+		_, _, err := parseYAML([]byte("a:\n  b: 1\n    c: 2\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 3:")
+		})
+	})
+
+	Convey("Given a yaml document with an alias", t, func() {
+		_, _, err := parseYAML([]byte("a: *b\n"))
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 1:")
+		})
+	})
+
+	Convey("Given a yaml document with an unterminated flow sequence", t, func() {
+		_, _, err := parseYAML([]byte("a: 1\nb: [1, 2\n"))
+
+		Convey("Then an error with the line should be returned", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 2:")
+		})
+	})
+}
+
+func TestPlainScalar(t *testing.T) {
+	Convey("Given plain scalars", t, func() {
+		Convey("Then they should be resolved like the yaml core schema", func() {
+			So(plainScalar("~"), ShouldBeNil)
+			So(plainScalar("False"), ShouldEqual, false)
+			So(plainScalar("0x10"), ShouldEqual, int64(16))
+			So(plainScalar("-1.5"), ShouldEqual, -1.5)
+			So(plainScalar("1m"), ShouldEqual, "1m")
+			So(plainScalar("infinity"), ShouldEqual, "infinity")
+		})
+	})
+}
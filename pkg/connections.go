@@ -0,0 +1,80 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"net"
+)
+
+// admit counts the connection against the connection limits and returns the
+// reason if it exceeds them.
+func (ldapProxy *LdapProxy) admit(remoteAddr net.Addr) (refused string, ok bool) {
+	ip := remoteIP(remoteAddr)
+
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	if max := ldapProxy.config.MaxConnections; max > 0 && ldapProxy.connections >= max {
+		return refusedMaxConnections, false
+	}
+	if max := ldapProxy.config.MaxConnectionsPerIP; max > 0 && ip != "" && ldapProxy.connectionsPerIP[ip] >= max {
+		return refusedMaxConnectionsPerIP, false
+	}
+
+	ldapProxy.connections++
+	if ip != "" {
+		ldapProxy.connectionsPerIP[ip]++
+	}
+
+	return "", true
+}
+
+// release frees the connection of a disconnected session
+func (ldapProxy *LdapProxy) release(remoteAddr net.Addr) {
+	ip := remoteIP(remoteAddr)
+
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	ldapProxy.connections--
+	if ip == "" {
+		return
+	}
+
+	if ldapProxy.connectionsPerIP[ip] <= 1 {
+		delete(ldapProxy.connectionsPerIP, ip)
+	} else {
+		ldapProxy.connectionsPerIP[ip]--
+	}
+}
+
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+)
+
+func TestLdapProxy_ConnectionLimits(t *testing.T) {
+	Convey("Given a ldap proxy allowing three connections and two per ip", t, func() {
+		proxy := NewLdapProxy()
+
+		config := DefaultProxyConfig()
+		config.MaxConnections = 3
+		config.MaxConnectionsPerIP = 2
+		proxy.Configure(config)
+
+		client := &net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}
+		first, _ := proxy.Connect(client)
+		_, err := proxy.Connect(client)
+		So(err, ShouldBeNil)
+
+		Convey("When the ip opens a third connection", func() {
+			ctx, err := proxy.Connect(client)
+
+			Convey("Then the connection is refused", func() {
+				So(err, ShouldEqual, errConnectionRefused)
+				So(ctx, ShouldBeNil)
+			})
+		})
+
+		Convey("When the ip closed a connection", func() {
+			proxy.Disconnect(first)
+			_, err := proxy.Connect(client)
+
+			Convey("Then it may connect again", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When other ips exceed the total", func() {
+			_, err := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.13"), Port: 40000})
+			So(err, ShouldBeNil)
+			_, err = proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.14"), Port: 40000})
+
+			Convey("Then the connection is refused", func() {
+				So(err, ShouldEqual, errConnectionRefused)
+			})
+		})
+	})
+}
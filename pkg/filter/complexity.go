@@ -0,0 +1,71 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// Complexity describes the size of a filter: the nesting depth of its and, or
+// and not filters, the number of its components and the most wildcards of
+// any of its substring components.
+type Complexity struct {
+	Depth      int
+	Components int
+	Wildcards  int
+}
+
+// Measure returns the complexity of the filter, a single component has the
+// depth one. A nil filter has no complexity.
+func Measure(f ldap.Filter) Complexity {
+	var complexity Complexity
+	measure(f, 1, &complexity)
+	return complexity
+}
+
+func measure(f ldap.Filter, depth int, complexity *Complexity) {
+	if f == nil {
+		return
+	}
+
+	complexity.Components++
+	if depth > complexity.Depth {
+		complexity.Depth = depth
+	}
+
+	switch f := f.(type) {
+	case *ldap.AND:
+		for _, filter := range f.Filters {
+			measure(filter, depth+1, complexity)
+		}
+	case *ldap.OR:
+		for _, filter := range f.Filters {
+			measure(filter, depth+1, complexity)
+		}
+	case *ldap.NOT:
+		measure(f.Filter, depth+1, complexity)
+	case *ldap.Substrings:
+		// (cn=a*b*c) has a wildcard more than middle parts
+		if wildcards := len(f.Any) + 1; wildcards > complexity.Wildcards {
+			complexity.Wildcards = wildcards
+		}
+	}
+}
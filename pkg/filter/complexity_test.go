@@ -0,0 +1,51 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	Convey("Given filters of different complexity", t, func() {
+		cases := map[string]Complexity{
+			"(cn=a)":                          {Depth: 1, Components: 1},
+			"(cn=a*)":                         {Depth: 1, Components: 1, Wildcards: 1},
+			"(cn=*a*b*c*)":                    {Depth: 1, Components: 1, Wildcards: 4},
+			"(&(cn=a)(sn=b))":                 {Depth: 2, Components: 3},
+			"(|(cn=a)(&(sn=b)(!(mail=*x*))))": {Depth: 4, Components: 6, Wildcards: 2},
+		}
+
+		for raw, expected := range cases {
+			f, err := Parse(raw)
+			So(err, ShouldBeNil)
+
+			Convey("Then "+raw+" is measured", func() {
+				So(Measure(f), ShouldResemble, expected)
+			})
+		}
+
+		Convey("Then a nil filter has no complexity", func() {
+			So(Measure(nil), ShouldResemble, Complexity{})
+		})
+	})
+}
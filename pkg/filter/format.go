@@ -0,0 +1,126 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// Redaction replaces the values of redacted attributes.
+const Redaction = "***"
+
+// String renders the filter in the string representation of RFC 4515, the
+// inverse of Parse.
+func String(f ldap.Filter) string {
+	return format(f, nil)
+}
+
+// Redacted renders the filter like String, replacing the asserted values of
+// the attributes with Redaction, e.g. for (userPassword=secret).
+func Redacted(f ldap.Filter, attributes []string) string {
+	return format(f, func(attribute string) bool {
+		for _, redacted := range attributes {
+			if strings.EqualFold(redacted, attribute) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func format(f ldap.Filter, redacted func(attribute string) bool) string {
+	value := func(attribute string, v string) string {
+		if redacted != nil && redacted(attribute) {
+			return Redaction
+		}
+		return escape(v)
+	}
+
+	switch f := f.(type) {
+	case *ldap.AND:
+		return "(&" + formatList(f.Filters, redacted) + ")"
+	case *ldap.OR:
+		return "(|" + formatList(f.Filters, redacted) + ")"
+	case *ldap.NOT:
+		return "(!" + format(f.Filter, redacted) + ")"
+	case *ldap.EqualityMatch:
+		return "(" + f.Attribute + "=" + value(f.Attribute, string(f.Value)) + ")"
+	case *ldap.ApproxMatch:
+		return "(" + f.Attribute + "~=" + value(f.Attribute, string(f.Value)) + ")"
+	case *ldap.GreaterOrEqual:
+		return "(" + f.Attribute + ">=" + value(f.Attribute, string(f.Value)) + ")"
+	case *ldap.LessOrEqual:
+		return "(" + f.Attribute + "<=" + value(f.Attribute, string(f.Value)) + ")"
+	case *ldap.Present:
+		return "(" + f.Attribute + "=*)"
+	case *ldap.Substrings:
+		if redacted != nil && redacted(f.Attribute) {
+			return "(" + f.Attribute + "=" + Redaction + ")"
+		}
+		parts := []string{escape(f.Initial)}
+		for _, part := range f.Any {
+			parts = append(parts, escape(part))
+		}
+		parts = append(parts, escape(f.Final))
+		return "(" + f.Attribute + "=" + strings.Join(parts, "*") + ")"
+	case *ldap.ExtensibleMatch:
+		description := f.Attribute
+		if f.DNAttributes {
+			description += ":dn"
+		}
+		if f.MatchingRule != "" {
+			description += ":" + f.MatchingRule
+		}
+		return "(" + description + ":=" + value(f.Attribute, string(f.Value)) + ")"
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprintf("%s", f)
+}
+
+func formatList(filters []ldap.Filter, redacted func(attribute string) bool) string {
+	var formatted string
+	for _, f := range filters {
+		formatted += format(f, redacted)
+	}
+
+	return formatted
+}
+
+// escape encodes the characters of a value which are special in filters
+func escape(value string) string {
+	var escaped bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&escaped, "\\%02x", c)
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+
+	return escaped.String()
+}
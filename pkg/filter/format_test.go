@@ -0,0 +1,49 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	Convey("Given a parsed nested filter", t, func() {
+		value := `(&(objectClass=person)(|(uid=j*n)(!(mail=*)))(cn~=a\2ab)(age>=18)(userAccountControl:1.2.840.113556.1.4.803:=2))`
+		f, err := Parse(value)
+		So(err, ShouldBeNil)
+
+		Convey("Then it is rendered like it was parsed", func() {
+			So(String(f), ShouldEqual, value)
+		})
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	Convey("Given a filter asserting a password", t, func() {
+		f, err := Parse("(&(uid=jdoe)(|(userPassword=secret)(userPassword=sec*)))")
+		So(err, ShouldBeNil)
+
+		Convey("Then the values of the password are redacted", func() {
+			So(Redacted(f, []string{"userpassword"}), ShouldEqual, "(&(uid=jdoe)(|(userPassword=***)(userPassword=***)))")
+		})
+	})
+}
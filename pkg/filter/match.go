@@ -0,0 +1,269 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// The matching rules of Active Directory comparing the bits of integer
+// attributes like userAccountControl or groupType.
+const (
+	MatchingRuleBitAnd = "1.2.840.113556.1.4.803"
+	MatchingRuleBitOr  = "1.2.840.113556.1.4.804"
+)
+
+// Matches evaluates the filter against the attributes of an entry. Attribute
+// names and values are compared case insensitive, ordering matches compare
+// integers numerically. Extensible matches support the equality rules and the
+// bitwise rules of Active Directory, the dn attributes aren't matched. A nil
+// filter matches every entry.
+func Matches(attributes map[string][]string, f ldap.Filter) bool {
+	switch f.(type) {
+	case nil:
+		return true
+
+	case *ldap.AND:
+		a := f.(*ldap.AND)
+
+		for _, filter := range a.Filters {
+			if !Matches(attributes, filter) {
+				return false
+			}
+		}
+		return true
+
+	case *ldap.OR:
+		o := f.(*ldap.OR)
+
+		for _, filter := range o.Filters {
+			if Matches(attributes, filter) {
+				return true
+			}
+		}
+		return false
+
+	case *ldap.NOT:
+		n := f.(*ldap.NOT)
+
+		return !Matches(attributes, n.Filter)
+
+	case *ldap.EqualityMatch:
+		e := f.(*ldap.EqualityMatch)
+
+		return hasValue(attributes, e.Attribute, string(e.Value))
+
+	case *ldap.ApproxMatch:
+		a := f.(*ldap.ApproxMatch)
+
+		return hasValue(attributes, a.Attribute, string(a.Value))
+
+	case *ldap.Present:
+		p := f.(*ldap.Present)
+
+		return strings.EqualFold(p.Attribute, "objectClass") || len(Values(attributes, p.Attribute)) > 0
+
+	case *ldap.Substrings:
+		s := f.(*ldap.Substrings)
+
+		for _, v := range Values(attributes, s.Attribute) {
+			if matchesSubstrings(v, s) {
+				return true
+			}
+		}
+		return false
+
+	case *ldap.GreaterOrEqual:
+		g := f.(*ldap.GreaterOrEqual)
+
+		for _, v := range Values(attributes, g.Attribute) {
+			if compare(v, string(g.Value)) >= 0 {
+				return true
+			}
+		}
+		return false
+
+	case *ldap.LessOrEqual:
+		l := f.(*ldap.LessOrEqual)
+
+		for _, v := range Values(attributes, l.Attribute) {
+			if compare(v, string(l.Value)) <= 0 {
+				return true
+			}
+		}
+		return false
+
+	case *ldap.ExtensibleMatch:
+		e := f.(*ldap.ExtensibleMatch)
+
+		if e.Attribute != "" {
+			return matchesRule(Values(attributes, e.Attribute), e.MatchingRule, string(e.Value))
+		}
+
+		// without attribute every attribute is matched with the rule
+		for _, values := range attributes {
+			if matchesRule(values, e.MatchingRule, string(e.Value)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+// Attributes returns the attributes the filter asserts on. An extensible
+// match without attribute matches every attribute and is returned as "".
+func Attributes(f ldap.Filter) []string {
+	switch f := f.(type) {
+	case *ldap.AND:
+		var attributes []string
+		for _, filter := range f.Filters {
+			attributes = append(attributes, Attributes(filter)...)
+		}
+		return attributes
+	case *ldap.OR:
+		var attributes []string
+		for _, filter := range f.Filters {
+			attributes = append(attributes, Attributes(filter)...)
+		}
+		return attributes
+	case *ldap.NOT:
+		return Attributes(f.Filter)
+	case *ldap.EqualityMatch:
+		return []string{f.Attribute}
+	case *ldap.ApproxMatch:
+		return []string{f.Attribute}
+	case *ldap.Present:
+		return []string{f.Attribute}
+	case *ldap.Substrings:
+		return []string{f.Attribute}
+	case *ldap.GreaterOrEqual:
+		return []string{f.Attribute}
+	case *ldap.LessOrEqual:
+		return []string{f.Attribute}
+	case *ldap.ExtensibleMatch:
+		return []string{f.Attribute}
+	}
+
+	return nil
+}
+
+// Values returns the values of the attribute, looked up case insensitive.
+func Values(attributes map[string][]string, attribute string) []string {
+	if values, ok := attributes[attribute]; ok {
+		return values
+	}
+
+	for name, values := range attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func hasValue(attributes map[string][]string, attribute string, value string) bool {
+	for _, v := range Values(attributes, attribute) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesSubstrings checks that the value starts with the initial, contains
+// the any parts in order and ends with the final part of the filter.
+func matchesSubstrings(value string, s *ldap.Substrings) bool {
+	value = strings.ToLower(value)
+
+	initial := strings.ToLower(s.Initial)
+	if !strings.HasPrefix(value, initial) {
+		return false
+	}
+	value = value[len(initial):]
+
+	for _, part := range s.Any {
+		i := strings.Index(value, strings.ToLower(part))
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	return strings.HasSuffix(value, strings.ToLower(s.Final))
+}
+
+// compare orders two values, numerically if both are integers
+func compare(a string, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// matchesRule checks if one of the values matches the assertion with the
+// matching rule. Unknown rules never match.
+func matchesRule(values []string, rule string, assertion string) bool {
+	for _, v := range values {
+		switch rule {
+		case "", "2.5.13.2", "caseIgnoreMatch":
+			if strings.EqualFold(v, assertion) {
+				return true
+			}
+
+		case "2.5.13.5", "caseExactMatch":
+			if v == assertion {
+				return true
+			}
+
+		case MatchingRuleBitAnd, MatchingRuleBitOr:
+			value, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			mask, err := strconv.ParseInt(assertion, 10, 64)
+			if err != nil {
+				return false
+			}
+
+			if rule == MatchingRuleBitAnd && value&mask == mask || rule == MatchingRuleBitOr && value&mask != 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
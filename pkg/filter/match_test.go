@@ -0,0 +1,50 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	Convey("Given a nested filter", t, func() {
+		f, err := Parse("(&(objectClass=person)(|(uid=j*n)(!(mail=*)))(age>=18))")
+		So(err, ShouldBeNil)
+
+		Convey("When the attributes are collected", func() {
+			attributes := Attributes(f)
+
+			Convey("Then every asserted attribute is returned", func() {
+				So(attributes, ShouldResemble, []string{"objectClass", "uid", "mail", "age"})
+			})
+		})
+	})
+
+	Convey("Given an extensible match without attribute", t, func() {
+		f := &ldap.ExtensibleMatch{MatchingRule: "caseIgnoreMatch", Value: []byte("doe")}
+
+		Convey("Then an empty attribute is returned", func() {
+			So(Attributes(f), ShouldResemble, []string{""})
+		})
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-ldap/ldap"
+)
+
+var (
+	ErrUnexpectedEnd = errors.New("filter: unexpected end of filter")
+)
+
+// Parse converts the string representation of a filter (RFC 4515) like
+// `(&(objectClass=person)(uid=j*))` into its ldap.Filter form.
+func Parse(value string) (ldap.Filter, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, ErrUnexpectedEnd
+	}
+	if !strings.HasPrefix(value, "(") {
+		value = "(" + value + ")"
+	}
+
+	p := &parser{input: value}
+	f, err := p.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("filter: unexpected '%s' at %d", p.input[p.pos:], p.pos)
+	}
+
+	return f, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) parseFilter() (ldap.Filter, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.input) {
+		return nil, ErrUnexpectedEnd
+	}
+
+	var f ldap.Filter
+	var err error
+
+	switch p.input[p.pos] {
+	case '&':
+		p.pos++
+		var filters []ldap.Filter
+		filters, err = p.parseList()
+		f = &ldap.AND{Filters: filters}
+	case '|':
+		p.pos++
+		var filters []ldap.Filter
+		filters, err = p.parseList()
+		f = &ldap.OR{Filters: filters}
+	case '!':
+		p.pos++
+		var inner ldap.Filter
+		inner, err = p.parseFilter()
+		f = &ldap.NOT{Filter: inner}
+	default:
+		f, err = p.parseItem()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (p *parser) parseList() ([]ldap.Filter, error) {
+	filters := []ldap.Filter{}
+	for p.pos < len(p.input) && p.input[p.pos] == '(' {
+		f, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	return filters, nil
+}
+
+func (p *parser) parseItem() (ldap.Filter, error) {
+	end := strings.IndexByte(p.input[p.pos:], ')')
+	if end < 0 {
+		return nil, ErrUnexpectedEnd
+	}
+	item := p.input[p.pos : p.pos+end]
+	p.pos += end
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("filter: invalid item '%s'", item)
+	}
+
+	attribute, rawValue := item[:eq], item[eq+1:]
+
+	switch {
+	case strings.HasSuffix(attribute, ">"):
+		value, err := unescape(rawValue)
+		return &ldap.GreaterOrEqual{Attribute: strings.TrimSuffix(attribute, ">"), Value: value}, err
+	case strings.HasSuffix(attribute, "<"):
+		value, err := unescape(rawValue)
+		return &ldap.LessOrEqual{Attribute: strings.TrimSuffix(attribute, "<"), Value: value}, err
+	case strings.HasSuffix(attribute, "~"):
+		value, err := unescape(rawValue)
+		return &ldap.ApproxMatch{Attribute: strings.TrimSuffix(attribute, "~"), Value: value}, err
+	case strings.HasSuffix(attribute, ":"):
+		return parseExtensible(strings.TrimSuffix(attribute, ":"), rawValue)
+	}
+
+	if rawValue == "*" {
+		return &ldap.Present{Attribute: attribute}, nil
+	}
+
+	if strings.Contains(rawValue, "*") {
+		return parseSubstrings(attribute, rawValue)
+	}
+
+	value, err := unescape(rawValue)
+	return &ldap.EqualityMatch{Attribute: attribute, Value: value}, err
+}
+
+func parseSubstrings(attribute string, rawValue string) (ldap.Filter, error) {
+	parts := strings.Split(rawValue, "*")
+
+	decoded := make([]string, len(parts))
+	for i, part := range parts {
+		value, err := unescape(part)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = string(value)
+	}
+
+	f := &ldap.Substrings{
+		Attribute: attribute,
+		Initial:   decoded[0],
+		Final:     decoded[len(decoded)-1],
+	}
+	for _, any := range decoded[1 : len(decoded)-1] {
+		if any != "" {
+			f.Any = append(f.Any, any)
+		}
+	}
+
+	return f, nil
+}
+
+// parseExtensible handles `attr:dn:rule:=value`, `attr:rule:=value` and
+// `:rule:=value`
+func parseExtensible(description string, rawValue string) (ldap.Filter, error) {
+	value, err := unescape(rawValue)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ldap.ExtensibleMatch{Value: value}
+
+	parts := strings.Split(description, ":")
+	f.Attribute = parts[0]
+	for _, part := range parts[1:] {
+		if strings.EqualFold(part, "dn") {
+			f.DNAttributes = true
+		} else if part != "" {
+			f.MatchingRule = part
+		}
+	}
+
+	if f.Attribute == "" && f.MatchingRule == "" {
+		return nil, fmt.Errorf("filter: extensible match without attribute and matching rule")
+	}
+
+	return f, nil
+}
+
+// unescape decodes the \XX escapes of a filter value
+func unescape(value string) ([]byte, error) {
+	if !strings.Contains(value, "\\") {
+		return []byte(value), nil
+	}
+
+	decoded := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			decoded = append(decoded, value[i])
+			continue
+		}
+
+		if i+2 >= len(value) {
+			return nil, fmt.Errorf("filter: invalid escape in '%s'", value)
+		}
+
+		b, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid escape in '%s'", value)
+		}
+
+		decoded = append(decoded, byte(b))
+		i += 2
+	}
+
+	return decoded, nil
+}
+
+func (p *parser) expect(c byte) error {
+	if p.pos >= len(p.input) {
+		return ErrUnexpectedEnd
+	}
+
+	if p.input[p.pos] != c {
+		return fmt.Errorf("filter: expected '%c' at %d", c, p.pos)
+	}
+
+	p.pos++
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Given a nested filter", t, func() {
+		f, err := Parse("(&(objectClass=person)(|(uid=j*n)(!(mail=*)))(cn~=doe)(age>=18)(age<=65))")
+
+		Convey("Then it is parsed into its components", func() {
+			So(err, ShouldBeNil)
+
+			and, ok := f.(*ldap.AND)
+			So(ok, ShouldBeTrue)
+			So(and.Filters, ShouldHaveLength, 5)
+			So(and.Filters[0], ShouldResemble, &ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("person")})
+
+			or := and.Filters[1].(*ldap.OR)
+			So(or.Filters[0], ShouldResemble, &ldap.Substrings{Attribute: "uid", Initial: "j", Final: "n"})
+			So(or.Filters[1], ShouldResemble, &ldap.NOT{Filter: &ldap.Present{Attribute: "mail"}})
+
+			So(and.Filters[2], ShouldResemble, &ldap.ApproxMatch{Attribute: "cn", Value: []byte("doe")})
+			So(and.Filters[3], ShouldResemble, &ldap.GreaterOrEqual{Attribute: "age", Value: []byte("18")})
+			So(and.Filters[4], ShouldResemble, &ldap.LessOrEqual{Attribute: "age", Value: []byte("65")})
+		})
+	})
+
+	Convey("Given a filter with escaped values and without parentheses", t, func() {
+		f, err := Parse(`cn=a\2ab\29`)
+
+		Convey("Then the value is unescaped", func() {
+			So(err, ShouldBeNil)
+			So(f, ShouldResemble, &ldap.EqualityMatch{Attribute: "cn", Value: []byte("a*b)")})
+		})
+	})
+
+	Convey("Given an extensible match", t, func() {
+		f, err := Parse("(userAccountControl:1.2.840.113556.1.4.803:=2)")
+
+		Convey("Then the matching rule is parsed", func() {
+			So(err, ShouldBeNil)
+			So(f, ShouldResemble, &ldap.ExtensibleMatch{Attribute: "userAccountControl", MatchingRule: "1.2.840.113556.1.4.803", Value: []byte("2")})
+		})
+	})
+
+	Convey("Given invalid filters", t, func() {
+		for _, value := range []string{"", "(cn=a", "(&(cn=a)", "(cn=a))", "(=a)", `(cn=\2)`} {
+			_, err := Parse(value)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestMatches(t *testing.T) {
+	Convey("Given an entry", t, func() {
+		attributes := map[string][]string{
+			"objectClass": {"top", "person"},
+			"cn":          {"John Doe"},
+			"uidNumber":   {"1000"},
+		}
+
+		Convey("Then filters are evaluated case insensitive", func() {
+			So(Matches(attributes, nil), ShouldBeTrue)
+			So(Matches(attributes, &ldap.EqualityMatch{Attribute: "CN", Value: []byte("john doe")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.Present{Attribute: "mail"}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.NOT{Filter: &ldap.Present{Attribute: "mail"}}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.AND{Filters: []ldap.Filter{
+				&ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("person")},
+				&ldap.Present{Attribute: "mail"},
+			}}), ShouldBeFalse)
+		})
+
+		Convey("Then substrings are matched in order", func() {
+			So(Matches(attributes, &ldap.Substrings{Attribute: "cn", Initial: "jo", Final: "DOE"}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.Substrings{Attribute: "cn", Any: []string{"n", "d"}}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.Substrings{Attribute: "cn", Any: []string{"d", "n"}}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.Substrings{Attribute: "cn", Initial: "john d", Final: "doe"}), ShouldBeFalse)
+		})
+
+		Convey("Then integers are ordered numerically", func() {
+			So(Matches(attributes, &ldap.GreaterOrEqual{Attribute: "uidNumber", Value: []byte("999")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.LessOrEqual{Attribute: "uidNumber", Value: []byte("999")}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.GreaterOrEqual{Attribute: "cn", Value: []byte("jane")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.LessOrEqual{Attribute: "mail", Value: []byte("z")}), ShouldBeFalse)
+		})
+
+		Convey("Then extensible matches apply their matching rule", func() {
+			attributes["userAccountControl"] = []string{"514"}
+
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "userAccountControl", MatchingRule: MatchingRuleBitAnd, Value: []byte("2")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "userAccountControl", MatchingRule: MatchingRuleBitAnd, Value: []byte("3")}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "userAccountControl", MatchingRule: MatchingRuleBitOr, Value: []byte("3")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "userAccountControl", MatchingRule: MatchingRuleBitOr, Value: []byte("1")}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "cn", MatchingRule: "caseExactMatch", Value: []byte("john doe")}), ShouldBeFalse)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Value: []byte("john doe")}), ShouldBeTrue)
+			So(Matches(attributes, &ldap.ExtensibleMatch{Attribute: "cn", MatchingRule: "1.2.3.4", Value: []byte("John Doe")}), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// Rewrite returns a copy of the filter with every assertion replaced by the
+// result of the function. The and, or and not filters are copied with their
+// rewritten children, the filter passed in is left unchanged.
+func Rewrite(f ldap.Filter, rewrite func(assertion ldap.Filter) ldap.Filter) ldap.Filter {
+	switch f := f.(type) {
+	case *ldap.AND:
+		return &ldap.AND{Filters: rewriteList(f.Filters, rewrite)}
+	case *ldap.OR:
+		return &ldap.OR{Filters: rewriteList(f.Filters, rewrite)}
+	case *ldap.NOT:
+		return &ldap.NOT{Filter: Rewrite(f.Filter, rewrite)}
+	case nil:
+		return nil
+	}
+
+	return rewrite(f)
+}
+
+func rewriteList(filters []ldap.Filter, rewrite func(assertion ldap.Filter) ldap.Filter) []ldap.Filter {
+	rewritten := make([]ldap.Filter, len(filters))
+	for i, filter := range filters {
+		rewritten[i] = Rewrite(filter, rewrite)
+	}
+
+	return rewritten
+}
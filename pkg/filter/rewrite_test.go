@@ -0,0 +1,55 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filter
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	Convey("Given a nested filter", t, func() {
+		f, err := Parse("(&(objectClass=person)(|(uid=jdoe)(!(cn=John*))))")
+		So(err, ShouldBeNil)
+
+		Convey("When the assertions are rewritten", func() {
+			rewritten := Rewrite(f, func(assertion ldap.Filter) ldap.Filter {
+				if equality, ok := assertion.(*ldap.EqualityMatch); ok && equality.Attribute == "uid" {
+					return &ldap.EqualityMatch{Attribute: "sAMAccountName", Value: []byte(strings.ToUpper(string(equality.Value)))}
+				}
+				return assertion
+			})
+
+			Convey("Then the copy has the new assertions and the filter is unchanged", func() {
+				So(String(rewritten), ShouldEqual, "(&(objectClass=person)(|(sAMAccountName=JDOE)(!(cn=John*))))")
+				So(String(f), ShouldEqual, "(&(objectClass=person)(|(uid=jdoe)(!(cn=John*))))")
+			})
+		})
+
+		Convey("When there is no filter", func() {
+			Convey("Then nil is returned", func() {
+				So(Rewrite(nil, func(assertion ldap.Filter) ldap.Filter { return assertion }), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_FilterResults(t *testing.T) {
+	Convey("Given a ldap proxy with a backend ignoring the filter", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{
+			{DN: "uid=jdoe", Attributes: map[string][]string{"uid": {"jdoe"}, "uidNumber": {"1000"}}},
+			{DN: "uid=asmith", Attributes: map[string][]string{"uid": {"asmith"}, "uidNumber": {"20"}}},
+		}})
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		req := &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree, Filter: &ldap.AND{Filters: []ldap.Filter{
+			&ldap.Substrings{Attribute: "uid", Initial: "j"},
+			&ldap.GreaterOrEqual{Attribute: "uidNumber", Value: []byte("500")},
+		}}}
+
+		Convey("When the proxy doesn't filter the entries of the backend", func() {
+			res, err := proxy.Search(sess, req)
+
+			Convey("Then all entries are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When the proxy filters the entries of the backend", func() {
+			config := DefaultProxyConfig()
+			config.FilterResults = map[string]bool{"a": true}
+			proxy.Configure(config)
+
+			res, err := proxy.Search(sess, req)
+
+			Convey("Then only the matching entries are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "uid=jdoe")
+			})
+		})
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// flightGroup coalesces concurrent identical backend searches into a single
+// call whose result is shared by all waiters. The call is made with the
+// request id of the first waiter.
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	result  flightResult
+	waiters int
+	cancel  context.CancelFunc
+	request string
+}
+
+type flightResult struct {
+	users    []*User
+	err      error
+	timedOut bool
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*flight),
+	}
+}
+
+// do calls search unless a call with the same key is already running, in which
+// case its result is awaited instead. The call isn't bound to the context of
+// a single waiter but to parent, a waiter giving up returns the error of its
+// context. Once all waiters gave up the call is cancelled. shared reports
+// whether the result was coalesced from another call, request is the id of
+// the request the call is made for.
+func (group *flightGroup) do(ctx context.Context, parent context.Context, key string, search func(ctx context.Context) flightResult) (result flightResult, shared bool, request string, err error) {
+	group.mutex.Lock()
+	call, shared := group.calls[key]
+	if !shared {
+		id := RequestId(ctx)
+		callCtx, cancel := context.WithCancel(setRequestId(parent, id))
+		call = &flight{done: make(chan struct{}), cancel: cancel, request: id}
+		group.calls[key] = call
+
+		go func() {
+			call.result = search(callCtx)
+			cancel()
+
+			group.mutex.Lock()
+			group.forget(key, call)
+			group.mutex.Unlock()
+
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	group.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result, shared, call.request, nil
+	case <-ctx.Done():
+		group.leave(key, call)
+		return flightResult{}, shared, call.request, ctx.Err()
+	}
+}
+
+// leave cancels the call if the last waiter gave up, so no backend keeps
+// working on a result nobody waits for.
+func (group *flightGroup) leave(key string, call *flight) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		group.forget(key, call)
+	}
+}
+
+// forget removes the call unless it was already replaced by a new call with
+// the same key.
+func (group *flightGroup) forget(key string, call *flight) {
+	if group.calls[key] == call {
+		delete(group.calls, key)
+	}
+}
+
+func flightKey(backend Backend, f ldap.Filter, scope SearchScope) string {
+	filter := ""
+	if f != nil {
+		filter = f.String()
+	}
+
+	return strings.Join([]string{backend.Name(), util.NormalizeDN(scope.BaseDN), strconv.Itoa(int(scope.Scope)), filter}, "\x00")
+}
@@ -0,0 +1,127 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	Convey("Given a flight group with a running call", t, func() {
+		group := newFlightGroup()
+
+		started := make(chan struct{})
+		cancelled := make(chan struct{})
+		search := func(ctx context.Context) flightResult {
+			close(started)
+			select {
+			case <-ctx.Done():
+				close(cancelled)
+				return flightResult{err: ctx.Err()}
+			case <-time.After(time.Second):
+				return flightResult{users: []*User{{DN: "cn=a"}}}
+			}
+		}
+
+		firstCtx, cancelFirst := context.WithCancel(context.Background())
+		secondCtx, cancelSecond := context.WithCancel(context.Background())
+		defer cancelSecond()
+		waiting := newWaitingContext(secondCtx)
+
+		firstErr := make(chan error, 1)
+		go func() {
+			_, _, _, err := group.do(firstCtx, context.Background(), "key", search)
+			firstErr <- err
+		}()
+		<-started
+
+		Convey("When one of two waiters gives up", func() {
+			go group.do(waiting, context.Background(), "key", search)
+			<-waiting.waiting
+			cancelFirst()
+
+			Convey("Then the call keeps running for the other waiter", func() {
+				So(<-firstErr, ShouldEqual, context.Canceled)
+				So(closedWithin(cancelled, 20*time.Millisecond), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the only waiter gives up", func() {
+			cancelFirst()
+
+			Convey("Then the call is cancelled", func() {
+				So(<-firstErr, ShouldEqual, context.Canceled)
+				So(closedWithin(cancelled, time.Second), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestFlightGroup_RequestId(t *testing.T) {
+	Convey("Given a flight group", t, func() {
+		group := newFlightGroup()
+
+		Convey("When a request starts a call", func() {
+			var called string
+			_, shared, request, err := group.do(setRequestId(context.Background(), "42-7"), context.Background(), "key", func(ctx context.Context) flightResult {
+				called = RequestId(ctx)
+				return flightResult{}
+			})
+
+			Convey("Then the call is made with the id of the request", func() {
+				So(err, ShouldBeNil)
+				So(shared, ShouldBeFalse)
+				So(request, ShouldEqual, "42-7")
+				So(called, ShouldEqual, "42-7")
+			})
+		})
+	})
+}
+
+// waitingContext closes waiting once a waiter awaits its Done channel, i.e.
+// joined the call
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting chan struct{}
+}
+
+func newWaitingContext(ctx context.Context) *waitingContext {
+	return &waitingContext{Context: ctx, waiting: make(chan struct{})}
+}
+
+func (ctx *waitingContext) Done() <-chan struct{} {
+	ctx.once.Do(func() { close(ctx.waiting) })
+	return ctx.Context.Done()
+}
+
+func closedWithin(ch chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// A Forwarder forwards the optional methods of a wrapper unchanged to its
+// delegate backend: the writes, the health check and Close. Wrappers embed it,
+// those changing the dns or attributes of the entries override the writes. A
+// delegate which isn't a writer backend refuses the writes.
+type Forwarder struct {
+	delegate Backend
+}
+
+func Forward(delegate Backend) Forwarder {
+	return Forwarder{delegate: delegate}
+}
+
+func (forwarder Forwarder) Add(ctx context.Context, entry *User) error {
+	writer, ok := forwarder.delegate.(WriterBackend)
+	if !ok {
+		return ErrUnwillingToPerform
+	}
+
+	return writer.Add(ctx, entry)
+}
+
+func (forwarder Forwarder) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	writer, ok := forwarder.delegate.(WriterBackend)
+	if !ok {
+		return ErrUnwillingToPerform
+	}
+
+	return writer.Modify(ctx, dn, mods)
+}
+
+func (forwarder Forwarder) Delete(ctx context.Context, dn string) error {
+	writer, ok := forwarder.delegate.(WriterBackend)
+	if !ok {
+		return ErrUnwillingToPerform
+	}
+
+	return writer.Delete(ctx, dn)
+}
+
+func (forwarder Forwarder) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	writer, ok := forwarder.delegate.(WriterBackend)
+	if !ok {
+		return ErrUnwillingToPerform
+	}
+
+	return writer.ModifyDN(ctx, dn, newRDN, deleteOldRDN, newSuperior)
+}
+
+// CheckHealth checks the delegate if it checks its health itself, it returns
+// ErrNoHealthCheck otherwise.
+func (forwarder Forwarder) CheckHealth(ctx context.Context) error {
+	return CheckHealth(ctx, forwarder.delegate)
+}
+
+// Close closes the delegate if it holds connections.
+func (forwarder Forwarder) Close() {
+	if closer, ok := forwarder.delegate.(closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// The country of addresses the databases don't know
+const UnknownCountry = "unknown"
+
+// Config names the maxmind databases, e.g. GeoLite2-Country.mmdb or
+// GeoLite2-City.mmdb for the country and GeoLite2-ASN.mmdb for the
+// autonomous system. Either may be omitted.
+type Config struct {
+	CountryDatabase string `json:"countryDatabase"`
+	ASNDatabase     string `json:"asnDatabase"`
+}
+
+// The Location of a client address. Fields the databases don't know are
+// empty.
+type Location struct {
+	Country      string
+	ASN          uint
+	Organization string
+}
+
+func (location *Location) String() string {
+	if location == nil {
+		return UnknownCountry
+	}
+
+	var parts []string
+	if location.Country != "" {
+		parts = append(parts, location.Country)
+	}
+	if location.ASN != 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", location.ASN))
+	}
+	if location.Organization != "" {
+		parts = append(parts, location.Organization)
+	}
+	if len(parts) == 0 {
+		return UnknownCountry
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// CountryOf returns the iso code of the country of the location, suitable as
+// metric label.
+func CountryOf(location *Location) string {
+	if location == nil || location.Country == "" {
+		return UnknownCountry
+	}
+
+	return location.Country
+}
+
+// A Locator looks up the location of client addresses in the databases read
+// into memory. All methods may be called on a nil locator, which knows no
+// locations.
+type Locator struct {
+	country *database
+	asn     *database
+}
+
+func New(config *Config) (*Locator, error) {
+	locator := &Locator{}
+
+	var err error
+	if config.CountryDatabase != "" {
+		locator.country, err = openDatabase(config.CountryDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: country database %s: %v", config.CountryDatabase, err)
+		}
+	}
+	if config.ASNDatabase != "" {
+		locator.asn, err = openDatabase(config.ASNDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: asn database %s: %v", config.ASNDatabase, err)
+		}
+	}
+
+	return locator, nil
+}
+
+// Lookup returns the location of the address of a client or nil if the
+// databases don't know it.
+func (locator *Locator) Lookup(addr net.Addr) *Location {
+	if locator == nil {
+		return nil
+	}
+
+	ip := ipOf(addr)
+	if ip == nil {
+		return nil
+	}
+
+	location := &Location{}
+	if record, err := locator.country.lookup(ip); err == nil {
+		location.Country, _ = field(record, "country", "iso_code").(string)
+	}
+	if record, err := locator.asn.lookup(ip); err == nil {
+		location.ASN = uintOf(field(record, "autonomous_system_number"))
+		location.Organization, _ = field(record, "autonomous_system_organization").(string)
+	}
+
+	if *location == (Location{}) {
+		return nil
+	}
+
+	return location
+}
+
+// field returns the value below the keys of nested maps
+func field(record interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = fields[key]
+	}
+
+	return record
+}
+
+func ipOf(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return net.ParseIP(host)
+}
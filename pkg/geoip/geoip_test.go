@@ -0,0 +1,228 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package geoip
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestLocator_Lookup(t *testing.T) {
+	Convey("Given country and asn databases", t, func() {
+		dir, err := ioutil.TempDir("", "geoip")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		country := filepath.Join(dir, "country.mmdb")
+		So(ioutil.WriteFile(country, buildDatabase(6, 28, map[string]interface{}{
+			"192.0.2.0/24":    map[string]interface{}{"country": map[string]interface{}{"iso_code": "DE"}},
+			"198.51.100.0/24": map[string]interface{}{"country": map[string]interface{}{"iso_code": "FR"}},
+			"2001:db8::/32":   map[string]interface{}{"country": map[string]interface{}{"iso_code": "NL"}},
+		}), 0600), ShouldBeNil)
+		asn := filepath.Join(dir, "asn.mmdb")
+		So(ioutil.WriteFile(asn, buildDatabase(4, 24, map[string]interface{}{
+			"192.0.2.0/25": map[string]interface{}{"autonomous_system_number": uint32(64496), "autonomous_system_organization": "Example Net"},
+		}), 0600), ShouldBeNil)
+
+		locator, err := New(&Config{CountryDatabase: country, ASNDatabase: asn})
+		So(err, ShouldBeNil)
+
+		Convey("Then known addresses are located", func() {
+			location := locator.Lookup(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000})
+			So(location, ShouldResemble, &Location{Country: "DE", ASN: 64496, Organization: "Example Net"})
+			So(location.String(), ShouldEqual, "DE AS64496 Example Net")
+
+			So(locator.Lookup(&net.TCPAddr{IP: net.ParseIP("192.0.2.200")}), ShouldResemble, &Location{Country: "DE"})
+			So(locator.Lookup(&net.TCPAddr{IP: net.ParseIP("198.51.100.7")}), ShouldResemble, &Location{Country: "FR"})
+			So(locator.Lookup(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")}), ShouldResemble, &Location{Country: "NL"})
+		})
+
+		Convey("Then unknown addresses have no location", func() {
+			So(locator.Lookup(&net.TCPAddr{IP: net.ParseIP("203.0.113.1")}), ShouldBeNil)
+			So(locator.Lookup(&net.UnixAddr{Name: "/run/ldap.sock", Net: "unix"}), ShouldBeNil)
+			So(locator.Lookup(nil), ShouldBeNil)
+			So(CountryOf(nil), ShouldEqual, UnknownCountry)
+		})
+	})
+
+	Convey("Given a file which isn't a maxmind database", t, func() {
+		dir, err := ioutil.TempDir("", "geoip")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "country.mmdb")
+		So(ioutil.WriteFile(path, []byte("not a database"), 0600), ShouldBeNil)
+
+		Convey("Then an error should be returned", func() {
+			_, err := New(&Config{CountryDatabase: path})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a nil locator", t, func() {
+		var locator *Locator
+
+		Convey("Then no address is located", func() {
+			So(locator.Lookup(&net.TCPAddr{IP: net.ParseIP("192.0.2.1")}), ShouldBeNil)
+		})
+	})
+}
+
+func TestDecode(t *testing.T) {
+	Convey("Given data with a pointer to a previous value", t, func() {
+		data := append(encode("shared"), 0x20, 0x00)
+
+		Convey("Then the pointer is followed", func() {
+			value, next, err := decode(data, 7)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "shared")
+			So(next, ShouldEqual, 9)
+		})
+	})
+
+	Convey("Given extended types", t, func() {
+		data := append([]byte{0x02, 0x02, 0x01, 0x00}, 0x01, 0x07)
+
+		Convey("Then they are decoded", func() {
+			value, next, err := decode(data, 0)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, uint64(256))
+
+			value, _, err = decode(data, next)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, true)
+		})
+	})
+}
+
+// buildDatabase writes a maxmind database mapping the networks to the values
+func buildDatabase(ipVersion int, recordSize int, networks map[string]interface{}) []byte {
+	type node struct{ records [2]int }
+	const empty, data = -1, -2
+
+	nodes := []*node{{records: [2]int{empty, empty}}}
+	var section []byte
+	values := make(map[int]int)
+
+	var cidrs []string
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ip := []byte(network.IP)
+		ones, _ := network.Mask.Size()
+		if ipVersion == 6 && len(ip) == net.IPv4len {
+			ip = append(make([]byte, 12), ip...)
+			ones += 96
+		}
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[current].records[bit] = data - len(section)
+				values[data-len(section)] = len(section)
+				section = append(section, encode(networks[cidr])...)
+				break
+			}
+			if nodes[current].records[bit] == empty {
+				nodes = append(nodes, &node{records: [2]int{empty, empty}})
+				nodes[current].records[bit] = len(nodes) - 1
+			}
+			current = nodes[current].records[bit]
+		}
+	}
+
+	var content []byte
+	for _, n := range nodes {
+		var records [2]uint
+		for i, record := range n.records {
+			switch {
+			case record == empty:
+				records[i] = uint(len(nodes))
+			case record <= data:
+				records[i] = uint(len(nodes) + 16 + values[record])
+			default:
+				records[i] = uint(record)
+			}
+		}
+
+		if recordSize == 24 {
+			for _, record := range records {
+				content = append(content, byte(record>>16), byte(record>>8), byte(record))
+			}
+		} else {
+			content = append(content, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte(records[0]>>20&0xf0|records[1]>>24&0x0f), byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		}
+	}
+
+	content = append(content, make([]byte, 16)...)
+	content = append(content, section...)
+	content = append(content, metadataMarker...)
+	content = append(content, encode(map[string]interface{}{
+		"node_count":  uint32(len(nodes)),
+		"record_size": uint16(recordSize),
+		"ip_version":  uint16(ipVersion),
+	})...)
+
+	return content
+}
+
+func encode(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		if len(v) >= 29 {
+			return append([]byte{byte(typeString<<5 | 29), byte(len(v) - 29)}, v...)
+		}
+		return append([]byte{byte(typeString<<5 | len(v))}, v...)
+	case uint16:
+		return []byte{byte(typeUint16<<5 | 2), byte(v >> 8), byte(v)}
+	case uint32:
+		return []byte{byte(typeUint32<<5 | 4), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	case map[string]interface{}:
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b := []byte{byte(typeMap<<5 | len(v))}
+		for _, key := range keys {
+			b = append(b, encode(key)...)
+			b = append(b, encode(v[key])...)
+		}
+		return b
+	}
+
+	panic("unsupported value")
+}
@@ -0,0 +1,341 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+var (
+	ErrInvalidDatabase = errors.New("geoip: invalid maxmind database")
+
+	metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+)
+
+// The data types of the maxmind db format
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// A database is a maxmind db file (https://maxmind.github.io/MaxMind-DB/)
+// read into memory.
+type database struct {
+	tree []byte
+	data []byte
+
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+
+	// the node the ipv4 addresses start at in ipv6 trees
+	ipv4Start uint
+}
+
+func openDatabase(path string) (*database, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDatabase(content)
+}
+
+func parseDatabase(content []byte) (*database, error) {
+	start := bytes.LastIndex(content, metadataMarker)
+	if start < 0 {
+		return nil, ErrInvalidDatabase
+	}
+
+	metadata := content[start+len(metadataMarker):]
+	value, _, err := decode(metadata, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	db := &database{
+		nodeCount:  uintOf(fields["node_count"]),
+		recordSize: uintOf(fields["record_size"]),
+		ipVersion:  uintOf(fields["ip_version"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, ErrInvalidDatabase
+	}
+	db.tree = content[:treeSize]
+	db.data = content[treeSize+16 : start]
+
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+
+	return db, nil
+}
+
+// lookup returns the record of the network containing the ip, nil if the
+// database doesn't know it
+func (db *database) lookup(ip net.IP) (interface{}, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		node = db.ipv4Start
+	} else if db.ipVersion == 6 {
+		bits = ip.To16()
+	}
+	if bits == nil {
+		return nil, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+
+	if node == db.nodeCount {
+		// no data for the network
+		return nil, nil
+	} else if node < db.nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, ErrInvalidDatabase
+	}
+	value, _, err := decode(db.data, offset)
+
+	return value, err
+}
+
+// record returns the left (0) or right (1) record of the node
+func (db *database) record(node uint, bit uint) uint {
+	b := db.tree[node*db.recordSize/4:]
+
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decode decodes the value at the offset of the data section and returns the
+// offset following it
+func decode(data []byte, offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+
+	control := data[offset]
+	offset++
+	kind := uint(control >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := decodePointer(data, offset, control)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := decode(data, pointer)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+
+	size, offset, err := decodeSize(data, offset, control)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		value := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			value[name], offset, err = decode(data, next)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return value, offset, nil
+	case typeArray:
+		value := make([]interface{}, size)
+		for i := range value {
+			value[i], offset, err = decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return value, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := data[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var value uint64
+		for _, c := range b {
+			value = value<<8 | uint64(c)
+		}
+		return value, offset, nil
+	case typeInt32:
+		var value uint32
+		for _, c := range b {
+			value = value<<8 | uint32(c)
+		}
+		return int64(int32(value)), offset, nil
+	}
+
+	return nil, 0, fmt.Errorf("geoip: unknown data type %d", kind)
+}
+
+func decodeSize(data []byte, offset uint, control byte) (uint, uint, error) {
+	size := uint(control & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(data)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	var value uint
+	for _, c := range data[offset : offset+n] {
+		value = value<<8 | uint(c)
+	}
+
+	switch size {
+	case 29:
+		value += 29
+	case 30:
+		value += 285
+	default:
+		value += 65821
+	}
+
+	return value, offset + n, nil
+}
+
+func decodePointer(data []byte, offset uint, control byte) (uint, uint, error) {
+	n := uint(control>>3&0x3) + 1
+	if offset+n > uint(len(data)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+
+	var value uint
+	if n < 4 {
+		value = uint(control & 0x7)
+	}
+	for _, c := range data[offset : offset+n] {
+		value = value<<8 | uint(c)
+	}
+
+	switch n {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+
+	return value, offset + n, nil
+}
+
+func uintOf(value interface{}) uint {
+	if v, ok := value.(uint64); ok {
+		return uint(v)
+	}
+
+	return 0
+}
@@ -0,0 +1,234 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/changes"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrGroupExists   = errors.New("group: group already exists")
+	ErrGroupNotFound = errors.New("group: group not found")
+)
+
+// A proxy local group. The members reference entries served by other backends.
+type Group struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"`
+}
+
+type Config struct {
+	pkg.Config
+	GroupsDn string `json:"groupsDn"`
+	File     string `json:"file"`
+}
+
+// Backend serves the proxy local groups as groupOfNames entries below the
+// configured groups dn.
+type Backend struct {
+	config *Config
+	store  Store
+	hub    *changes.Hub
+
+	mutex  sync.RWMutex
+	groups []*Group
+}
+
+var _ pkg.Backend = &Backend{}
+
+func NewBackend(config *Config, store Store) (*Backend, error) {
+	groups, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		config: config,
+		store:  store,
+		hub:    changes.DefaultHub,
+		groups: groups,
+	}, nil
+}
+
+func (backend *Backend) Name() (name string) {
+	return backend.config.Name
+}
+
+// Authenticate always fails, groups can't bind.
+func (backend *Backend) Authenticate(ctx context.Context, username string, password string) bool {
+	return false
+}
+
+func (backend *Backend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.mutex.RLock()
+	defer backend.mutex.RUnlock()
+
+	scope, scoped := pkg.GetSearchScope(ctx)
+
+	entries := []*pkg.User{}
+	for _, group := range backend.groups {
+		entry := backend.toEntry(group)
+		if scoped && !scope.Contains(entry.DN) {
+			continue
+		}
+
+		if filter.Matches(entry.Attributes, f) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Groups returns a copy of all groups.
+func (backend *Backend) Groups() []*Group {
+	backend.mutex.RLock()
+	defer backend.mutex.RUnlock()
+
+	return copyGroups(backend.groups)
+}
+
+func (backend *Backend) AddGroup(name string, description string) error {
+	return backend.update(changes.TypeAdd, name, func(groups []*Group) ([]*Group, error) {
+		if indexOf(groups, name) >= 0 {
+			return nil, ErrGroupExists
+		}
+
+		return append(groups, &Group{Name: name, Description: description, Members: []string{}}), nil
+	})
+}
+
+func (backend *Backend) DeleteGroup(name string) error {
+	return backend.update(changes.TypeDelete, name, func(groups []*Group) ([]*Group, error) {
+		i := indexOf(groups, name)
+		if i < 0 {
+			return nil, ErrGroupNotFound
+		}
+
+		return append(groups[:i], groups[i+1:]...), nil
+	})
+}
+
+func (backend *Backend) AddMember(name string, memberDn string) error {
+	return backend.update(changes.TypeModify, name, func(groups []*Group) ([]*Group, error) {
+		i := indexOf(groups, name)
+		if i < 0 {
+			return nil, ErrGroupNotFound
+		}
+
+		for _, member := range groups[i].Members {
+			if util.EqualDN(member, memberDn) {
+				return groups, nil
+			}
+		}
+
+		groups[i].Members = append(groups[i].Members, memberDn)
+		return groups, nil
+	})
+}
+
+func (backend *Backend) RemoveMember(name string, memberDn string) error {
+	return backend.update(changes.TypeModify, name, func(groups []*Group) ([]*Group, error) {
+		i := indexOf(groups, name)
+		if i < 0 {
+			return nil, ErrGroupNotFound
+		}
+
+		members := []string{}
+		for _, member := range groups[i].Members {
+			if !util.EqualDN(member, memberDn) {
+				members = append(members, member)
+			}
+		}
+
+		groups[i].Members = members
+		return groups, nil
+	})
+}
+
+// update applies the modification to a copy of the groups and only replaces
+// the served groups if they could be persisted. The change of the named group
+// is published afterwards.
+func (backend *Backend) update(changeType string, name string, modify func(groups []*Group) ([]*Group, error)) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	groups, err := modify(copyGroups(backend.groups))
+	if err != nil {
+		return err
+	}
+
+	if err = backend.store.Save(groups); err != nil {
+		return err
+	}
+
+	backend.groups = groups
+
+	change := &changes.Change{Type: changeType, DN: backend.groupDn(name)}
+	if i := indexOf(groups, name); i >= 0 {
+		entry := backend.toEntry(groups[i])
+		change.DN, change.Attributes = entry.DN, entry.Attributes
+	}
+	backend.hub.Publish(change)
+
+	return nil
+}
+
+func (backend *Backend) groupDn(name string) string {
+	return fmt.Sprintf("cn=%s,%s", name, backend.config.GroupsDn)
+}
+
+func (backend *Backend) toEntry(group *Group) *pkg.User {
+	entry := &pkg.User{
+		DN: backend.groupDn(group.Name),
+		Attributes: map[string][]string{
+			"cn":          {group.Name},
+			"objectClass": {"top", "groupOfNames"},
+			"member":      append([]string{}, group.Members...),
+		},
+	}
+
+	if group.Description != "" {
+		entry.Attributes["description"] = []string{group.Description}
+	}
+
+	return entry
+}
+
+func indexOf(groups []*Group, name string) int {
+	for i, group := range groups {
+		if strings.EqualFold(group.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
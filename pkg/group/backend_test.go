@@ -0,0 +1,164 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/changes"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNewBackend(t *testing.T) {
+	Convey("Given a group backend", t, func() {
+		backend, err := NewBackend(&Config{}, NewMemoryStore())
+
+		Convey("Expect the backend to implement the backend interface", func() {
+			So(err, ShouldBeNil)
+			converted := pkg.Backend(backend)
+			So(converted, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBackend_Authenticate(t *testing.T) {
+	Convey("Given a group backend with a group", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+		backend.AddGroup("admins", "")
+
+		Convey("When the group tries to authenticate", func() {
+			result := backend.Authenticate(context.Background(), "cn=admins,ou=Groups,dc=example,dc=com", "")
+
+			Convey("Then authentication fails", func() {
+				So(result, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestBackend_Manage(t *testing.T) {
+	Convey("Given a group backend", t, func() {
+		store := NewMemoryStore()
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, store)
+
+		Convey("When a group with members is added", func() {
+			So(backend.AddGroup("admins", "application admins"), ShouldBeNil)
+			So(backend.AddMember("admins", "uid=user1,ou=People,dc=example,dc=com"), ShouldBeNil)
+			So(backend.AddMember("admins", "uid=user1,ou=People,dc=example,dc=com"), ShouldBeNil)
+
+			Convey("Then the group is persisted in the store", func() {
+				groups, err := store.Load()
+				So(err, ShouldBeNil)
+				So(groups, ShouldHaveLength, 1)
+				So(groups[0].Name, ShouldEqual, "admins")
+				So(groups[0].Members, ShouldResemble, []string{"uid=user1,ou=People,dc=example,dc=com"})
+			})
+
+			Convey("Then the same group can't be added again", func() {
+				So(backend.AddGroup("Admins", ""), ShouldEqual, ErrGroupExists)
+			})
+
+			Convey("Then the member can be removed", func() {
+				So(backend.RemoveMember("admins", "UID=user1,ou=People,dc=example,dc=com"), ShouldBeNil)
+				So(backend.Groups()[0].Members, ShouldHaveLength, 0)
+			})
+
+			Convey("Then the group can be deleted", func() {
+				So(backend.DeleteGroup("admins"), ShouldBeNil)
+				So(backend.Groups(), ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When a change is subscribed to and a member is added", func() {
+			backend.hub = changes.NewHub()
+			subscription := backend.hub.Subscribe("ou=Groups,dc=example,dc=com", nil)
+			defer subscription.Close()
+
+			backend.AddGroup("admins", "")
+			backend.AddMember("admins", "uid=user1,ou=People,dc=example,dc=com")
+
+			Convey("Then the changes are published", func() {
+				So((<-subscription.C).Type, ShouldEqual, changes.TypeAdd)
+
+				change := <-subscription.C
+				So(change.Type, ShouldEqual, changes.TypeModify)
+				So(change.DN, ShouldEqual, "cn=admins,ou=Groups,dc=example,dc=com")
+				So(change.Attributes["member"], ShouldResemble, []string{"uid=user1,ou=People,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When a member is added to an unknown group", func() {
+			err := backend.AddMember("unknown", "uid=user1,ou=People,dc=example,dc=com")
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldEqual, ErrGroupNotFound)
+			})
+		})
+	})
+}
+
+func TestBackend_GetUsers(t *testing.T) {
+	Convey("Given a group backend with two groups", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+		backend.AddGroup("admins", "")
+		backend.AddGroup("users", "")
+		backend.AddMember("admins", "uid=user1,ou=People,dc=example,dc=com")
+
+		Convey("When all groups are requested", func() {
+			entries, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then both groups are returned as groupOfNames", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 2)
+				So(entries[0].DN, ShouldEqual, "cn=admins,ou=Groups,dc=example,dc=com")
+				So(entries[0].Attributes["objectClass"], ShouldContain, "groupOfNames")
+				So(entries[0].Attributes["member"], ShouldResemble, []string{"uid=user1,ou=People,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the groups are searched below another base", func() {
+			ctx := pkg.WithSearchScope(context.Background(), pkg.SearchScope{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+			entries, err := backend.GetUsers(ctx, nil)
+
+			Convey("Then no group is returned", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When the groups of a member are requested", func() {
+			entries, err := backend.GetUsers(context.Background(), &ldap.AND{
+				Filters: []ldap.Filter{
+					&ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("groupOfNames")},
+					&ldap.EqualityMatch{Attribute: "member", Value: []byte("uid=user1,ou=People,dc=example,dc=com")},
+				},
+			})
+
+			Convey("Then only the matching group is returned", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 1)
+				So(entries[0].Attributes["cn"][0], ShouldEqual, "admins")
+			})
+		})
+	})
+}
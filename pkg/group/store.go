@@ -0,0 +1,119 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// A Store persists the groups managed by the group backend.
+type Store interface {
+	Load() ([]*Group, error)
+	Save(groups []*Group) error
+}
+
+// NewFileStore returns a store which keeps the groups as json in the given
+// file. A missing file is treated as an empty set of groups.
+func NewFileStore(path string) Store {
+	return &fileStore{
+		path: path,
+	}
+}
+
+type fileStore struct {
+	path string
+}
+
+func (store *fileStore) Load() ([]*Group, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return []*Group{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*Group{}
+	if err = json.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (store *fileStore) Save(groups []*Group) error {
+	data, err := json.MarshalIndent(groups, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash never leaves a truncated store
+	tmpPath := store.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, store.path)
+}
+
+// NewMemoryStore returns a store which keeps the groups only as long as the
+// process is running.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		groups: []*Group{},
+	}
+}
+
+type memoryStore struct {
+	mutex  sync.Mutex
+	groups []*Group
+}
+
+func (store *memoryStore) Load() ([]*Group, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return copyGroups(store.groups), nil
+}
+
+func (store *memoryStore) Save(groups []*Group) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.groups = copyGroups(groups)
+	return nil
+}
+
+func copyGroups(groups []*Group) []*Group {
+	copied := make([]*Group, len(groups))
+	for i, group := range groups {
+		copied[i] = &Group{
+			Name:        group.Name,
+			Description: group.Description,
+			Members:     append([]string{}, group.Members...),
+		}
+	}
+
+	return copied
+}
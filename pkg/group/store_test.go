@@ -0,0 +1,59 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	Convey("Given a file store in an empty directory", t, func() {
+		dirname, cleanupTmpDir := util.TmpDir(t)
+		defer cleanupTmpDir()
+
+		store := NewFileStore(filepath.Join(dirname, "groups.json"))
+
+		Convey("When the groups are loaded", func() {
+			groups, err := store.Load()
+
+			Convey("Then no groups are returned", func() {
+				So(err, ShouldBeNil)
+				So(groups, ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When groups are saved", func() {
+			err := store.Save([]*Group{{Name: "admins", Members: []string{"uid=user1,ou=People,dc=example,dc=com"}}})
+			So(err, ShouldBeNil)
+
+			Convey("Then they can be loaded again", func() {
+				groups, err := store.Load()
+				So(err, ShouldBeNil)
+				So(groups, ShouldHaveLength, 1)
+				So(groups[0].Name, ShouldEqual, "admins")
+				So(groups[0].Members, ShouldResemble, []string{"uid=user1,ou=People,dc=example,dc=com"})
+			})
+		})
+	})
+}
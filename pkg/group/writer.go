@@ -0,0 +1,225 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/changes"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+var _ pkg.WriterBackend = &Backend{}
+
+// Add creates a group from a groupOfNames entry directly below the groups dn.
+func (backend *Backend) Add(ctx context.Context, entry *pkg.User) error {
+	name, ok := backend.groupName(entry.DN)
+	if !ok || !hasValue(filter.Values(entry.Attributes, "objectClass"), "groupOfNames") {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	group := &Group{Name: name, Members: append([]string{}, filter.Values(entry.Attributes, "member")...)}
+	if descriptions := filter.Values(entry.Attributes, "description"); len(descriptions) > 0 {
+		group.Description = descriptions[0]
+	}
+
+	err := backend.update(changes.TypeAdd, name, func(groups []*Group) ([]*Group, error) {
+		if indexOf(groups, name) >= 0 {
+			return nil, ErrGroupExists
+		}
+
+		return append(groups, group), nil
+	})
+
+	return toWriteError(err)
+}
+
+// Modify changes the members and the description of a group. The name is
+// changed by renaming the group.
+func (backend *Backend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	name, ok := backend.groupName(dn)
+	if !ok {
+		return pkg.ErrNoSuchEntry
+	}
+
+	err := backend.update(changes.TypeModify, name, func(groups []*Group) ([]*Group, error) {
+		i := indexOf(groups, name)
+		if i < 0 {
+			return nil, ErrGroupNotFound
+		}
+
+		for _, mod := range mods {
+			switch strings.ToLower(mod.Name) {
+			case "member":
+				groups[i].Members = modifyValues(groups[i].Members, mod)
+			case "description":
+				descriptions := []string{}
+				if groups[i].Description != "" {
+					descriptions = append(descriptions, groups[i].Description)
+				}
+				descriptions = modifyValues(descriptions, mod)
+				if len(descriptions) > 1 {
+					return nil, pkg.ErrUnwillingToPerform
+				}
+
+				groups[i].Description = ""
+				if len(descriptions) == 1 {
+					groups[i].Description = descriptions[0]
+				}
+			default:
+				return nil, pkg.ErrUnwillingToPerform
+			}
+		}
+
+		return groups, nil
+	})
+
+	return toWriteError(err)
+}
+
+func (backend *Backend) Delete(ctx context.Context, dn string) error {
+	name, ok := backend.groupName(dn)
+	if !ok {
+		return pkg.ErrNoSuchEntry
+	}
+
+	return toWriteError(backend.DeleteGroup(name))
+}
+
+// ModifyDN renames a group. Groups stay directly below the groups dn, their
+// cn is single valued and always replaced by the new name.
+func (backend *Backend) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	name, ok := backend.groupName(dn)
+	if !ok {
+		return pkg.ErrNoSuchEntry
+	}
+
+	if newSuperior != "" && !strings.EqualFold(newSuperior, backend.config.GroupsDn) {
+		return pkg.ErrMoveUnsupported
+	}
+
+	newName, ok := backend.groupName(pkg.RenamedDN(dn, newRDN, ""))
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	err := backend.update(changes.TypeAdd, newName, func(groups []*Group) ([]*Group, error) {
+		i := indexOf(groups, name)
+		if i < 0 {
+			return nil, ErrGroupNotFound
+		}
+		if j := indexOf(groups, newName); j >= 0 && j != i {
+			return nil, ErrGroupExists
+		}
+
+		groups[i].Name = newName
+		return groups, nil
+	})
+	if err != nil {
+		return toWriteError(err)
+	}
+
+	// the entry of the old name is gone
+	if !strings.EqualFold(name, newName) {
+		backend.hub.Publish(&changes.Change{Type: changes.TypeDelete, DN: backend.groupDn(name)})
+	}
+
+	return nil
+}
+
+// modifyValues applies the modification to the values. Deleting without
+// values removes all values.
+func modifyValues(values []string, mod *ldap.Mod) []string {
+	switch mod.Type {
+	case ldap.ModAdd:
+		for _, value := range mod.Values {
+			if !hasValue(values, string(value)) {
+				values = append(values, string(value))
+			}
+		}
+		return values
+
+	case ldap.ModDelete:
+		if len(mod.Values) == 0 {
+			return []string{}
+		}
+
+		remaining := []string{}
+		for _, v := range values {
+			deleted := false
+			for _, value := range mod.Values {
+				deleted = deleted || strings.EqualFold(v, string(value))
+			}
+			if !deleted {
+				remaining = append(remaining, v)
+			}
+		}
+		return remaining
+	}
+
+	replaced := []string{}
+	for _, value := range mod.Values {
+		replaced = append(replaced, string(value))
+	}
+	return replaced
+}
+
+// groupName returns the name of the group of a dn like cn=admins,<groups dn>
+func (backend *Backend) groupName(dn string) (string, bool) {
+	suffix := "," + backend.config.GroupsDn
+	if len(dn) <= len("cn=")+len(suffix) ||
+		!strings.EqualFold(dn[:len("cn=")], "cn=") ||
+		!strings.EqualFold(dn[len(dn)-len(suffix):], suffix) {
+		return "", false
+	}
+
+	name := dn[len("cn=") : len(dn)-len(suffix)]
+	if strings.ContainsAny(name, ",+=") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// toWriteError converts the errors of the group backend to the errors of a
+// writer backend
+func toWriteError(err error) error {
+	switch err {
+	case ErrGroupExists:
+		return pkg.ErrEntryExists
+	case ErrGroupNotFound:
+		return pkg.ErrNoSuchEntry
+	}
+
+	return err
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
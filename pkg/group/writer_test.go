@@ -0,0 +1,199 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package group
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestBackend_Add(t *testing.T) {
+	Convey("Given a group backend", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+
+		Convey("When a groupOfNames entry is added below the groups dn", func() {
+			err := backend.Add(context.Background(), &pkg.User{
+				DN: "cn=admins,ou=Groups,dc=example,dc=com",
+				Attributes: map[string][]string{
+					"objectClass": {"top", "groupOfNames"},
+					"cn":          {"admins"},
+					"description": {"application admins"},
+					"member":      {"uid=user1,ou=People,dc=example,dc=com"},
+				},
+			})
+
+			Convey("Then the group is created with its members", func() {
+				So(err, ShouldBeNil)
+				groups := backend.Groups()
+				So(groups, ShouldHaveLength, 1)
+				So(groups[0].Name, ShouldEqual, "admins")
+				So(groups[0].Description, ShouldEqual, "application admins")
+				So(groups[0].Members, ShouldResemble, []string{"uid=user1,ou=People,dc=example,dc=com"})
+			})
+
+			Convey("Then the same group can't be added again", func() {
+				err := backend.Add(context.Background(), &pkg.User{
+					DN:         "CN=Admins,ou=groups,dc=example,dc=com",
+					Attributes: map[string][]string{"objectClass": {"groupOfNames"}},
+				})
+				So(err, ShouldEqual, pkg.ErrEntryExists)
+			})
+		})
+
+		Convey("When an entry outside the groups dn is added", func() {
+			err := backend.Add(context.Background(), &pkg.User{
+				DN:         "cn=admins,ou=Roles,dc=example,dc=com",
+				Attributes: map[string][]string{"objectClass": {"groupOfNames"}},
+			})
+
+			Convey("Then the backend is unwilling to add it", func() {
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+
+		Convey("When an entry which isn't a group is added", func() {
+			err := backend.Add(context.Background(), &pkg.User{
+				DN:         "cn=admins,ou=Groups,dc=example,dc=com",
+				Attributes: map[string][]string{"objectClass": {"person"}},
+			})
+
+			Convey("Then the backend is unwilling to add it", func() {
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+	})
+}
+
+func TestBackend_Modify(t *testing.T) {
+	Convey("Given a group backend with a group", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+		backend.AddGroup("admins", "application admins")
+		backend.AddMember("admins", "uid=user1,ou=People,dc=example,dc=com")
+		dn := "cn=admins,ou=Groups,dc=example,dc=com"
+
+		Convey("When members are added and deleted", func() {
+			err := backend.Modify(context.Background(), dn, []*ldap.Mod{
+				{Type: ldap.ModAdd, Name: "member", Values: [][]byte{[]byte("uid=user2,ou=People,dc=example,dc=com")}},
+				{Type: ldap.ModDelete, Name: "Member", Values: [][]byte{[]byte("UID=user1,ou=People,dc=example,dc=com")}},
+			})
+
+			Convey("Then the members of the group are changed", func() {
+				So(err, ShouldBeNil)
+				So(backend.Groups()[0].Members, ShouldResemble, []string{"uid=user2,ou=People,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the description is replaced", func() {
+			err := backend.Modify(context.Background(), dn, []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "description", Values: [][]byte{[]byte("admins")}},
+			})
+
+			Convey("Then the group has the new description", func() {
+				So(err, ShouldBeNil)
+				So(backend.Groups()[0].Description, ShouldEqual, "admins")
+			})
+		})
+
+		Convey("When a second description is added", func() {
+			err := backend.Modify(context.Background(), dn, []*ldap.Mod{
+				{Type: ldap.ModAdd, Name: "description", Values: [][]byte{[]byte("admins")}},
+			})
+
+			Convey("Then the backend is unwilling to perform it", func() {
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+				So(backend.Groups()[0].Description, ShouldEqual, "application admins")
+			})
+		})
+
+		Convey("When an unknown group is modified", func() {
+			err := backend.Modify(context.Background(), "cn=users,ou=Groups,dc=example,dc=com", nil)
+
+			Convey("Then the group is not found", func() {
+				So(err, ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+	})
+}
+
+func TestBackend_Delete(t *testing.T) {
+	Convey("Given a group backend with a group", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+		backend.AddGroup("admins", "")
+
+		Convey("When the group is deleted", func() {
+			err := backend.Delete(context.Background(), "cn=admins,ou=Groups,dc=example,dc=com")
+
+			Convey("Then the group is removed", func() {
+				So(err, ShouldBeNil)
+				So(backend.Groups(), ShouldBeEmpty)
+			})
+
+			Convey("Then it can't be deleted again", func() {
+				So(backend.Delete(context.Background(), "cn=admins,ou=Groups,dc=example,dc=com"), ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+	})
+}
+
+func TestBackend_ModifyDN(t *testing.T) {
+	Convey("Given a group backend with two groups", t, func() {
+		backend, _ := NewBackend(&Config{GroupsDn: "ou=Groups,dc=example,dc=com"}, NewMemoryStore())
+		backend.AddGroup("admins", "")
+		backend.AddGroup("users", "")
+		dn := "cn=admins,ou=Groups,dc=example,dc=com"
+
+		Convey("When a group is renamed", func() {
+			err := backend.ModifyDN(context.Background(), dn, "cn=operators", true, "")
+
+			Convey("Then the group has the new name", func() {
+				So(err, ShouldBeNil)
+				So(backend.Groups()[0].Name, ShouldEqual, "operators")
+			})
+		})
+
+		Convey("When a group is renamed to an existing group", func() {
+			err := backend.ModifyDN(context.Background(), dn, "cn=users", true, "")
+
+			Convey("Then the group already exists", func() {
+				So(err, ShouldEqual, pkg.ErrEntryExists)
+			})
+		})
+
+		Convey("When a group is moved below another dn", func() {
+			err := backend.ModifyDN(context.Background(), dn, "cn=admins", true, "ou=Roles,dc=example,dc=com")
+
+			Convey("Then moving is unsupported", func() {
+				So(err, ShouldEqual, pkg.ErrMoveUnsupported)
+			})
+		})
+
+		Convey("When a group is renamed to another rdn attribute", func() {
+			err := backend.ModifyDN(context.Background(), dn, "ou=admins", true, "")
+
+			Convey("Then the backend is unwilling to perform it", func() {
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+	})
+}
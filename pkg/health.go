@@ -0,0 +1,153 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A HealthCheckBackend checks its upstream itself, e.g. by pinging the
+// database. The other backends are healthy as long as they answer a search
+// matching no entry.
+type HealthCheckBackend interface {
+	Backend
+	CheckHealth(ctx context.Context) error
+}
+
+// Returned by the health check of a wrapper whose delegate doesn't check its
+// health itself, the wrapper is checked with a search then.
+var ErrNoHealthCheck = errors.New("ldap-proxy: backend has no health check")
+
+// CheckHealth checks the health of the backend if it checks it itself, it
+// returns ErrNoHealthCheck otherwise.
+func CheckHealth(ctx context.Context, backend Backend) error {
+	if checker, ok := backend.(HealthCheckBackend); ok {
+		return checker.CheckHealth(ctx)
+	}
+
+	return ErrNoHealthCheck
+}
+
+// the search of the health checks of backends without own check
+var healthCheckFilter = &ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("ldapProxyHealthCheck")}
+
+// CheckHealth checks the enabled backends concurrently with the backend
+// timeouts.
+func (ldapProxy *LdapProxy) CheckHealth(ctx context.Context) []admin.BackendHealth {
+	ldapProxy = ldapProxy.current()
+
+	var backends []Backend
+	for _, backend := range ldapProxy.ordered {
+		if ldapProxy.isEnabled(backend.Name()) {
+			backends = append(backends, backend)
+		}
+	}
+
+	health := make([]admin.BackendHealth, len(backends))
+	wg := sync.WaitGroup{}
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend Backend) {
+			defer wg.Done()
+			health[i] = ldapProxy.checkHealth(ctx, backend)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	return health
+}
+
+func (ldapProxy *LdapProxy) checkHealth(ctx context.Context, backend Backend) admin.BackendHealth {
+	backendCtx, cancelBackend := ldapProxy.backendContext(ctx, backend, actionSearch)
+	defer cancelBackend()
+
+	start := time.Now()
+	err := CheckHealth(backendCtx, backend)
+	if err == ErrNoHealthCheck {
+		_, err = backend.GetUsers(backendCtx, healthCheckFilter)
+	}
+
+	health := admin.BackendHealth{
+		Name:     backend.Name(),
+		Healthy:  err == nil,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		health.Error = err.Error()
+		log.Debugf("health check of backend %s failed: %v", backend.Name(), err)
+	}
+
+	return health
+}
+
+// Ready reports whether the proxy accepts connections and at least one
+// backend, or all with ReadyAllBackends, is healthy.
+func (ldapProxy *LdapProxy) Ready(ctx context.Context) (bool, []admin.BackendHealth) {
+	health := ldapProxy.CheckHealth(ctx)
+	if ldapProxy.isDraining() {
+		return false, health
+	}
+
+	healthy := 0
+	for _, backend := range health {
+		if backend.Healthy {
+			healthy++
+		}
+	}
+
+	if ldapProxy.current().config.ReadyAllBackends {
+		return len(health) > 0 && healthy == len(health), health
+	}
+	return healthy > 0, health
+}
+
+// LivenessHandler answers as long as the proxy runs, e.g. for /healthz
+func (ldapProxy *LdapProxy) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadinessHandler answers 200 while the proxy is ready and 503 otherwise,
+// with the health of the backends, e.g. for /readyz
+func (ldapProxy *LdapProxy) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready, health := ldapProxy.Ready(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(struct {
+			Ready    bool                  `json:"ready"`
+			Backends []admin.BackendHealth `json:"backends"`
+		}{ready, health})
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type healthCheckBackend struct {
+	*testBackend
+	health error
+}
+
+func (backend *healthCheckBackend) CheckHealth(ctx context.Context) error {
+	return backend.health
+}
+
+// wrappingBackend wraps a backend like the backend wrappers
+type wrappingBackend struct {
+	Forwarder
+	Backend
+}
+
+func wrap(backend Backend) Backend {
+	return &wrappingBackend{Forwarder: Forward(backend), Backend: backend}
+}
+
+func TestLdapProxy_Ready(t *testing.T) {
+	Convey("Given a ldap proxy with a healthy and a failing backend", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(
+			&testBackend{name: "a"},
+			&testBackend{name: "b", err: errors.New("connection refused")},
+		)
+
+		Convey("When the readiness is checked", func() {
+			ready, health := proxy.Ready(context.Background())
+
+			Convey("Then the proxy should be ready with the health of both backends", func() {
+				So(ready, ShouldBeTrue)
+				So(health, ShouldHaveLength, 2)
+				So(health[0].Healthy, ShouldBeTrue)
+				So(health[1].Healthy, ShouldBeFalse)
+				So(health[1].Error, ShouldEqual, "connection refused")
+			})
+		})
+
+		Convey("When all backends must be healthy", func() {
+			config := DefaultProxyConfig()
+			config.ReadyAllBackends = true
+			proxy.Configure(config)
+
+			Convey("Then the proxy should not be ready", func() {
+				ready, _ := proxy.Ready(context.Background())
+				So(ready, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the healthy backend is disabled", func() {
+			So(proxy.SetBackendEnabled("a", false), ShouldBeNil)
+
+			Convey("Then the proxy should not be ready", func() {
+				ready, health := proxy.Ready(context.Background())
+				So(ready, ShouldBeFalse)
+				So(health, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the readiness is requested over http", func() {
+			recorder := httptest.NewRecorder()
+			proxy.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			Convey("Then it should answer ok with the backends", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+
+				var body struct {
+					Ready    bool
+					Backends []admin.BackendHealth
+				}
+				So(json.Unmarshal(recorder.Body.Bytes(), &body), ShouldBeNil)
+				So(body.Ready, ShouldBeTrue)
+				So(body.Backends, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When the proxy shuts down", func() {
+			proxy.Shutdown(context.Background())
+
+			Convey("Then the readiness should fail while the proxy stays alive", func() {
+				recorder := httptest.NewRecorder()
+				proxy.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+				So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+				recorder = httptest.NewRecorder()
+				proxy.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+
+	Convey("Given a ldap proxy with a backend checking its health itself", t, func() {
+		backend := &healthCheckBackend{testBackend: &testBackend{name: "a"}, health: errors.New("ping failed")}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		Convey("When the readiness is checked", func() {
+			ready, health := proxy.Ready(context.Background())
+
+			Convey("Then its own check should decide", func() {
+				So(ready, ShouldBeFalse)
+				So(health[0].Error, ShouldEqual, "ping failed")
+			})
+		})
+	})
+
+	Convey("Given a ldap proxy with wrapped backends", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(
+			wrap(&healthCheckBackend{testBackend: &testBackend{name: "a"}, health: errors.New("ping failed")}),
+			wrap(&testBackend{name: "b", err: errors.New("connection refused")}),
+		)
+
+		Convey("When the readiness is checked", func() {
+			_, health := proxy.Ready(context.Background())
+
+			Convey("Then the own check of the wrapped backend decides", func() {
+				So(health[0].Error, ShouldEqual, "ping failed")
+			})
+
+			Convey("Then the others are searched through the wrapper", func() {
+				So(health[1].Error, ShouldEqual, "connection refused")
+			})
+		})
+	})
+
+	Convey("Given a ldap proxy without backends", t, func() {
+		proxy := NewLdapProxy()
+
+		Convey("Then it should not be ready", func() {
+			ready, _ := proxy.Ready(context.Background())
+			So(ready, ShouldBeFalse)
+		})
+	})
+}
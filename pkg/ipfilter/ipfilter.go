@@ -0,0 +1,124 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Config lists the networks as cidrs or single ips.
+type Config struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// A Policy decides which source ips may connect. Denied networks are refused
+// even if they are allowed, without allowed networks every other ip may
+// connect. All methods may be called on a nil policy, which allows every
+// address.
+type Policy struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func New(config *Config) (*Policy, error) {
+	allow, err := parseNetworks(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parseNetworks(config.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Policy{allow: allow, deny: deny}, nil
+}
+
+// Allows checks the source ip of the address. Addresses without ip, e.g. of
+// unix sockets, are only allowed if no networks are allowed explicitly.
+func (policy *Policy) Allows(addr net.Addr) bool {
+	if policy == nil {
+		return true
+	}
+
+	ip := ipOf(addr)
+	if ip == nil {
+		return len(policy.allow) == 0
+	}
+
+	if contains(policy.deny, ip) {
+		return false
+	}
+
+	return len(policy.allow) == 0 || contains(policy.allow, ip)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("ipfilter: invalid ip '%s'", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("ipfilter: invalid network '%s'", value)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func ipOf(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return net.ParseIP(host)
+}
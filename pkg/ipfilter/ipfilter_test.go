@@ -0,0 +1,67 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ipfilter
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	Convey("Given a policy allowing the internal network except a subnet", t, func() {
+		policy, err := New(&Config{Allow: []string{"10.0.0.0/8", "2001:db8::1"}, Deny: []string{"10.1.0.0/16"}})
+		So(err, ShouldBeNil)
+
+		Convey("Then internal ips may connect", func() {
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}), ShouldBeTrue)
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}), ShouldBeTrue)
+		})
+
+		Convey("Then denied and other ips are refused", func() {
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 40000}), ShouldBeFalse)
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}), ShouldBeFalse)
+		})
+
+		Convey("Then addresses without ip are refused", func() {
+			So(policy.Allows(&net.UnixAddr{Name: "/run/ldap.sock", Net: "unix"}), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a policy only denying a network", t, func() {
+		policy, err := New(&Config{Deny: []string{"192.0.2.0/24"}})
+		So(err, ShouldBeNil)
+
+		Convey("Then every other ip may connect", func() {
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}), ShouldBeTrue)
+			So(policy.Allows(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}), ShouldBeFalse)
+			So(policy.Allows(nil), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an invalid network", t, func() {
+		_, err := New(&Config{Allow: []string{"10.0.0.0/33"}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
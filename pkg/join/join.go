@@ -0,0 +1,227 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package join
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// the number of keys asked from the joined backend with a single search
+const batchSize = 100
+
+var ErrNoKey = errors.New("join: the key attribute is missing")
+
+// JoinConfig adds the attributes of the entries of a second backend, e.g. a
+// hr database, to the entries referring to the same person. The entries are
+// matched on the key attribute of the entries and the join key attribute of
+// the entries of the joined backend.
+type JoinConfig struct {
+	// The config of the joined backend, like an entry of the backends.
+	Backend json.RawMessage `json:"backend"`
+
+	Key     string `json:"key"`
+	JoinKey string `json:"joinKey"`
+
+	// The attributes taken from the joined entries, all if empty.
+	Attributes []string `json:"attributes"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Join *JoinConfig `json:"join"`
+}
+
+type joinBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+	joinedBackend   pkg.Backend
+
+	key        string
+	joinKey    string
+	attributes []string
+}
+
+var _ pkg.PasswordBackend = &joinBackend{}
+var _ pkg.WriterBackend = &joinBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, joinedBackend pkg.Backend, config *JoinConfig) (pkg.Backend, error) {
+	if config.Key == "" {
+		return nil, ErrNoKey
+	}
+
+	backend := &joinBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		joinedBackend:   joinedBackend,
+		key:             config.Key,
+		joinKey:         config.JoinKey,
+		attributes:      config.Attributes,
+	}
+	if backend.joinKey == "" {
+		backend.joinKey = backend.key
+	}
+
+	return backend, nil
+}
+
+// Close closes the delegate and the joined backend if they hold connections.
+func (backend *joinBackend) Close() {
+	backend.Forwarder.Close()
+	if closer, ok := backend.joinedBackend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (backend *joinBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+// Authenticate only asks the delegate backend, the joined backend adds
+// attributes only.
+func (backend *joinBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *joinBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+// GetUsers returns the entries of the delegate backend joined with the
+// entries of the joined backend. If the joined backend fails the entries are
+// returned without its attributes.
+func (backend *joinBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+	if err != nil || len(users) == 0 {
+		return users, err
+	}
+
+	joined, err := backend.joinedEntries(ctx, users)
+	if err != nil {
+		log.ForBackend(backend.Name()).Printf("joining the entries of backend %s with backend %s failed: %v", backend.Name(), backend.joinedBackend.Name(), err)
+		return users, nil
+	}
+
+	result := make([]*pkg.User, len(users))
+	for i, user := range users {
+		result[i] = user
+		if key := first(user.Attributes, backend.key); key != "" {
+			if entry, ok := joined[strings.ToLower(key)]; ok {
+				result[i] = backend.join(user, entry)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// joinedEntries searches the joined entries of the users by key, in batches
+func (backend *joinBackend) joinedEntries(ctx context.Context, users []*pkg.User) (map[string]*pkg.User, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, user := range users {
+		key := first(user.Attributes, backend.key)
+		if key != "" && !seen[strings.ToLower(key)] {
+			seen[strings.ToLower(key)] = true
+			keys = append(keys, key)
+		}
+	}
+
+	joined := make(map[string]*pkg.User)
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var assertions []ldap.Filter
+		for _, key := range keys[start:end] {
+			assertions = append(assertions, &ldap.EqualityMatch{Attribute: backend.joinKey, Value: []byte(key)})
+		}
+
+		entries, err := backend.joinedBackend.GetUsers(ctx, &ldap.OR{Filters: assertions})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			for _, key := range filter.Values(entry.Attributes, backend.joinKey) {
+				if seen[strings.ToLower(key)] {
+					joined[strings.ToLower(key)] = entry
+				}
+			}
+		}
+	}
+
+	return joined, nil
+}
+
+// join returns a copy of the user with the attributes of the joined entry it
+// lacks. The attributes of the user win, the dn is the one of the user.
+func (backend *joinBackend) join(user *pkg.User, entry *pkg.User) *pkg.User {
+	attributes := make(map[string][]string, len(user.Attributes)+len(entry.Attributes))
+	for name, values := range user.Attributes {
+		attributes[name] = values
+	}
+
+	for name, values := range entry.Attributes {
+		if len(backend.attributes) > 0 && !containsFold(backend.attributes, name) {
+			continue
+		}
+		if len(filter.Values(attributes, name)) == 0 {
+			attributes[name] = values
+		}
+	}
+
+	return &pkg.User{DN: user.DN, Attributes: attributes}
+}
+
+func first(attributes map[string][]string, attribute string) string {
+	if values := filter.Values(attributes, attribute); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
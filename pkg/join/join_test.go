@@ -0,0 +1,158 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package join
+
+import (
+	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+	err   error
+
+	lastFilter ldap.Filter
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return username == "jdoe"
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+	return backend.users, backend.err
+}
+
+func TestJoinBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend joined with a hr backend", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "cn=John Doe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"mail": {"JDoe@example.com"}, "title": {"Engineer"}}},
+			{DN: "cn=Alice Smith,ou=People,dc=example,dc=com", Attributes: map[string][]string{"mail": {"asmith@example.com"}}},
+			{DN: "cn=Service,ou=People,dc=example,dc=com", Attributes: map[string][]string{"cn": {"Service"}}},
+		}}
+		hr := &testBackend{users: []*pkg.User{
+			{DN: "id=1", Attributes: map[string][]string{"email": {"jdoe@example.com"}, "department": {"R&D"}, "title": {"Senior Engineer"}, "salary": {"1"}}},
+		}}
+		config := &JoinConfig{Key: "mail", JoinKey: "email"}
+
+		Convey("When the users are searched", func() {
+			backend, err := NewBackend(delegate, hr, config)
+			So(err, ShouldBeNil)
+
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+			So(users, ShouldHaveLength, 3)
+
+			Convey("Then the joined backend is searched for the keys", func() {
+				So(hr.lastFilter, ShouldResemble, &ldap.OR{Filters: []ldap.Filter{
+					&ldap.EqualityMatch{Attribute: "email", Value: []byte("JDoe@example.com")},
+					&ldap.EqualityMatch{Attribute: "email", Value: []byte("asmith@example.com")},
+				}})
+			})
+
+			Convey("Then the attributes of the joined entries are added", func() {
+				So(users[0].DN, ShouldEqual, "cn=John Doe,ou=People,dc=example,dc=com")
+				So(users[0].Attributes["department"], ShouldResemble, []string{"R&D"})
+			})
+
+			Convey("Then the attributes of the backend win", func() {
+				So(users[0].Attributes["title"], ShouldResemble, []string{"Engineer"})
+			})
+
+			Convey("Then entries without a joined entry are unchanged", func() {
+				So(users[1], ShouldEqual, delegate.users[1])
+				So(users[2], ShouldEqual, delegate.users[2])
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].Attributes, ShouldNotContainKey, "department")
+			})
+		})
+
+		Convey("When only some attributes are joined", func() {
+			config.Attributes = []string{"Department"}
+			backend, err := NewBackend(delegate, hr, config)
+			So(err, ShouldBeNil)
+
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then only those attributes are added", func() {
+				So(users[0].Attributes["department"], ShouldResemble, []string{"R&D"})
+				So(users[0].Attributes, ShouldNotContainKey, "salary")
+				So(users[0].Attributes, ShouldNotContainKey, "email")
+			})
+		})
+
+		Convey("When the joined backend fails", func() {
+			hr.err = errors.New("database unavailable")
+			backend, err := NewBackend(delegate, hr, config)
+			So(err, ShouldBeNil)
+
+			users, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the entries are returned without the joined attributes", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldResemble, delegate.users)
+			})
+		})
+
+		Convey("When there is no join key", func() {
+			config.JoinKey = ""
+			hr.users[0].Attributes["mail"] = hr.users[0].Attributes["email"]
+			backend, err := NewBackend(delegate, hr, config)
+			So(err, ShouldBeNil)
+
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then the key is used for the joined entries", func() {
+				So(users[0].Attributes["department"], ShouldResemble, []string{"R&D"})
+			})
+		})
+
+		Convey("When users authenticate", func() {
+			backend, err := NewBackend(delegate, hr, config)
+			So(err, ShouldBeNil)
+
+			Convey("Then only the delegate is asked", func() {
+				So(backend.Authenticate(context.Background(), "jdoe", "secret"), ShouldBeTrue)
+				So(hr.lastFilter, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a join without a key", t, func() {
+		_, err := NewBackend(&testBackend{}, &testBackend{}, &JoinConfig{})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldEqual, ErrNoKey)
+		})
+	})
+}
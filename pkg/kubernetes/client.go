@@ -0,0 +1,221 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The api of the custom resources
+const (
+	Group   = "ldap-proxy.gopenguin.github.io"
+	Version = "v1alpha1"
+
+	BackendsResource  = "ldapproxybackends"
+	ListenersResource = "ldapproxylisteners"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	ErrNotInCluster = errors.New("kubernetes: not running in a cluster")
+
+	// errExpired is returned by a watch of a resource version which is gone
+	errExpired = errors.New("kubernetes: resource version expired")
+)
+
+// A Client reads the custom resources of a namespace from the api server.
+type Client struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// Object is a custom resource with the spec kept as json.
+type Object struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+// ObjectList is the result of a list.
+type ObjectList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []*Object `json:"items"`
+}
+
+// Event is an object added, modified or deleted while watching.
+type Event struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// InClusterClient returns a client with the service account of the pod,
+// watching its own namespace unless another one is given.
+func InClusterClient(namespace string) (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		ownNamespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ownNamespace))
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("kubernetes: no certificates in %s/ca.crt", serviceAccountDir)
+	}
+
+	return &Client{
+		Address:   "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: namespace,
+		Client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (client *Client) url(resource string) string {
+	return fmt.Sprintf("%s/apis/%s/%s/namespaces/%s/%s", strings.TrimRight(client.Address, "/"), Group, Version, client.Namespace, resource)
+}
+
+func (client *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if client.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+
+	httpClient := client.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusGone {
+		res.Body.Close()
+		return nil, errExpired
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("kubernetes: reading %s failed: %s", url, res.Status)
+	}
+
+	return res, nil
+}
+
+// List returns the objects of the resource.
+func (client *Client) List(ctx context.Context, resource string) (*ObjectList, error) {
+	res, err := client.get(ctx, client.url(resource))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	list := &ObjectList{}
+	if err := json.NewDecoder(res.Body).Decode(list); err != nil {
+		return nil, fmt.Errorf("kubernetes: decoding %s failed: %v", resource, err)
+	}
+
+	return list, nil
+}
+
+// Watch calls the handler with the changes of the resource after the
+// resource version until the api server closes the watch or the context is
+// done. It returns the resource version to continue watching from.
+func (client *Client) Watch(ctx context.Context, resource string, resourceVersion string, handle func(eventType string, object *Object)) (string, error) {
+	res, err := client.get(ctx, client.url(resource)+"?watch=true&allowWatchBookmarks=true&resourceVersion="+resourceVersion)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(res.Body))
+	for {
+		event := &Event{}
+		if err := decoder.Decode(event); err != nil {
+			if ctx.Err() != nil {
+				return resourceVersion, ctx.Err()
+			}
+			// the api server closes watches after a while
+			return resourceVersion, nil
+		}
+
+		if event.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return resourceVersion, errExpired
+			}
+			return resourceVersion, fmt.Errorf("kubernetes: watching %s failed: %s", resource, status.Message)
+		}
+
+		object := &Object{}
+		if err := json.Unmarshal(event.Object, object); err != nil {
+			return resourceVersion, fmt.Errorf("kubernetes: decoding %s failed: %v", resource, err)
+		}
+		resourceVersion = object.Metadata.ResourceVersion
+
+		if event.Type != "BOOKMARK" {
+			handle(event.Type, object)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_List(t *testing.T) {
+	Convey("Given an api server with backends", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/apis/"+Group+"/"+Version+"/namespaces/ldap/"+BackendsResource || r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "7"}, "items": [{"metadata": {"name": "apps", "resourceVersion": "5"}, "spec": {"kind": "in-memory"}}]}`)
+		}))
+		defer server.Close()
+
+		client := &Client{Address: server.URL, Token: "token", Namespace: "ldap"}
+
+		Convey("When the backends are listed", func() {
+			list, err := client.List(context.Background(), BackendsResource)
+
+			Convey("Then the objects and the resource version should be returned", func() {
+				So(err, ShouldBeNil)
+				So(list.Metadata.ResourceVersion, ShouldEqual, "7")
+				So(list.Items, ShouldHaveLength, 1)
+				So(list.Items[0].Metadata.Name, ShouldEqual, "apps")
+				So(string(list.Items[0].Spec), ShouldEqual, `{"kind": "in-memory"}`)
+			})
+		})
+
+		Convey("When the client isn't allowed to list", func() {
+			client.Token = "other"
+			_, err := client.List(context.Background(), BackendsResource)
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestClient_Watch(t *testing.T) {
+	Convey("Given an api server streaming changes", t, func() {
+		var query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			fmt.Fprintln(w, `{"type": "ADDED", "object": {"metadata": {"name": "a", "resourceVersion": "8"}, "spec": {}}}`)
+			fmt.Fprintln(w, `{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "9"}}}`)
+			fmt.Fprintln(w, `{"type": "DELETED", "object": {"metadata": {"name": "b", "resourceVersion": "10"}}}`)
+		}))
+		defer server.Close()
+
+		client := &Client{Address: server.URL, Namespace: "ldap"}
+
+		Convey("When the backends are watched", func() {
+			var events []string
+			resourceVersion, err := client.Watch(context.Background(), BackendsResource, "7", func(eventType string, object *Object) {
+				events = append(events, eventType+" "+object.Metadata.Name)
+			})
+
+			Convey("Then the changes after the resource version should be handled", func() {
+				So(err, ShouldBeNil)
+				So(query, ShouldContainSubstring, "resourceVersion=7")
+				So(events, ShouldResemble, []string{"ADDED a", "DELETED b"})
+				So(resourceVersion, ShouldEqual, "10")
+			})
+		})
+	})
+
+	Convey("Given an api server with an expired resource version", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"type": "ERROR", "object": {"kind": "Status", "code": 410, "message": "too old resource version"}}`)
+		}))
+		defer server.Close()
+
+		client := &Client{Address: server.URL, Namespace: "ldap"}
+
+		Convey("When the backends are watched", func() {
+			_, err := client.Watch(context.Background(), BackendsResource, "1", func(string, *Object) {})
+
+			Convey("Then the watch should be expired", func() {
+				So(err, ShouldEqual, errExpired)
+			})
+		})
+	})
+}
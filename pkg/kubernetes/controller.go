@@ -0,0 +1,211 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resources are the specs of the custom resources ordered by name, in the
+// format of the backends and listeners of the config file. The name of the
+// object is the name of the backend or listener unless the spec has one.
+type Resources struct {
+	Backends  []json.RawMessage
+	Listeners []json.RawMessage
+}
+
+// A Controller watches the LdapProxyBackend and LdapProxyListener resources
+// of a namespace and applies them on changes.
+type Controller struct {
+	client *Client
+	apply  func(resources *Resources)
+
+	// Debounce coalesces the changes applied, e.g. of kubectl apply on a
+	// directory. Backoff is the wait after a failed list or watch.
+	Debounce time.Duration
+	Backoff  time.Duration
+
+	mutex   sync.Mutex
+	objects map[string]map[string]*Object
+	synced  map[string]bool
+	timer   *time.Timer
+}
+
+func NewController(client *Client, apply func(resources *Resources)) *Controller {
+	return &Controller{
+		client:   client,
+		apply:    apply,
+		Debounce: time.Second,
+		Backoff:  5 * time.Second,
+		objects: map[string]map[string]*Object{
+			BackendsResource:  make(map[string]*Object),
+			ListenersResource: make(map[string]*Object),
+		},
+		synced: make(map[string]bool),
+	}
+}
+
+// Run watches the resources until the context is done. They are applied after
+// both have been listed and then after every change.
+func (controller *Controller) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, resource := range []string{BackendsResource, ListenersResource} {
+		wg.Add(1)
+		go func(resource string) {
+			defer wg.Done()
+			controller.watch(ctx, resource)
+		}(resource)
+	}
+	wg.Wait()
+
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	if controller.timer != nil {
+		controller.timer.Stop()
+	}
+}
+
+// watch lists the objects of the resource and watches their changes, listing
+// them again if the watch fails
+func (controller *Controller) watch(ctx context.Context, resource string) {
+	for ctx.Err() == nil {
+		list, err := controller.client.List(ctx, resource)
+		if err != nil {
+			log.Printf("Listing %s failed: %v", resource, err)
+			controller.wait(ctx)
+			continue
+		}
+		controller.replace(resource, list.Items)
+
+		resourceVersion := list.Metadata.ResourceVersion
+		for ctx.Err() == nil {
+			resourceVersion, err = controller.client.Watch(ctx, resource, resourceVersion, func(eventType string, object *Object) {
+				controller.update(resource, eventType, object)
+			})
+			if err == errExpired {
+				break
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Watching %s failed: %v", resource, err)
+				controller.wait(ctx)
+				break
+			}
+		}
+	}
+}
+
+func (controller *Controller) wait(ctx context.Context) {
+	select {
+	case <-time.After(controller.Backoff):
+	case <-ctx.Done():
+	}
+}
+
+func (controller *Controller) replace(resource string, items []*Object) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	objects := make(map[string]*Object)
+	for _, object := range items {
+		objects[object.Metadata.Name] = object
+	}
+	controller.objects[resource] = objects
+	controller.synced[resource] = true
+
+	controller.changed()
+}
+
+func (controller *Controller) update(resource string, eventType string, object *Object) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	switch eventType {
+	case "ADDED", "MODIFIED":
+		controller.objects[resource][object.Metadata.Name] = object
+	case "DELETED":
+		delete(controller.objects[resource], object.Metadata.Name)
+	default:
+		return
+	}
+	log.Printf("%s %s '%s'", eventType, resource, object.Metadata.Name)
+
+	controller.changed()
+}
+
+// changed schedules applying the resources once all are synced. It must be
+// called with the mutex held.
+func (controller *Controller) changed() {
+	if len(controller.synced) < len(controller.objects) {
+		return
+	}
+
+	if controller.timer != nil {
+		controller.timer.Stop()
+	}
+	controller.timer = time.AfterFunc(controller.Debounce, func() {
+		controller.apply(controller.resources())
+	})
+}
+
+func (controller *Controller) resources() *Resources {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	return &Resources{
+		Backends:  specsOf(controller.objects[BackendsResource]),
+		Listeners: specsOf(controller.objects[ListenersResource]),
+	}
+}
+
+// specsOf returns the specs of the objects ordered by name, named after their
+// objects unless they have a name
+func specsOf(objects map[string]*Object) []json.RawMessage {
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	specs := make([]json.RawMessage, 0, len(names))
+	for _, name := range names {
+		var spec map[string]interface{}
+		if err := json.Unmarshal(objects[name].Spec, &spec); err != nil && len(objects[name].Spec) > 0 {
+			log.Printf("The spec of '%s' is no object IGNORED", name)
+			continue
+		}
+		if spec == nil {
+			spec = make(map[string]interface{})
+		}
+		if _, ok := spec["name"]; !ok {
+			spec["name"] = name
+		}
+
+		data, _ := json.Marshal(spec)
+		specs = append(specs, data)
+	}
+
+	return specs
+}
@@ -0,0 +1,103 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestController_Run(t *testing.T) {
+	Convey("Given an api server with backends and listeners", t, func() {
+		changes := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasSuffix(r.URL.Path, BackendsResource) && r.URL.Query().Get("watch") == "":
+				fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{"metadata": {"name": "b"}, "spec": {"kind": "in-memory"}}, {"metadata": {"name": "a"}, "spec": {"kind": "static", "name": "custom"}}]}`)
+			case strings.HasSuffix(r.URL.Path, BackendsResource):
+				w.(http.Flusher).Flush()
+				select {
+				case change := <-changes:
+					fmt.Fprintln(w, change)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+				<-r.Context().Done()
+			case r.URL.Query().Get("watch") == "":
+				fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{"metadata": {"name": "partners"}, "spec": null}]}`)
+			default:
+				<-r.Context().Done()
+			}
+		}))
+		defer server.Close()
+
+		applied := make(chan *Resources, 10)
+		controller := NewController(&Client{Address: server.URL, Namespace: "ldap"}, func(resources *Resources) {
+			applied <- resources
+		})
+		controller.Debounce = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			controller.Run(ctx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			server.CloseClientConnections()
+			<-done
+		}()
+
+		Convey("When the resources are listed", func() {
+			resources := <-applied
+
+			Convey("Then the specs should be applied by name", func() {
+				So(resources.Backends, ShouldHaveLength, 2)
+				So(string(resources.Backends[0]), ShouldEqual, `{"kind":"static","name":"custom"}`)
+				So(string(resources.Backends[1]), ShouldEqual, `{"kind":"in-memory","name":"b"}`)
+				So(resources.Listeners, ShouldHaveLength, 1)
+				So(string(resources.Listeners[0]), ShouldEqual, `{"name":"partners"}`)
+			})
+
+			Convey("When a backend is deleted", func() {
+				changes <- `{"type": "DELETED", "object": {"metadata": {"name": "b", "resourceVersion": "2"}}}`
+
+				Convey("Then the remaining specs should be applied", func() {
+					select {
+					case resources := <-applied:
+						So(resources.Backends, ShouldHaveLength, 1)
+						So(string(resources.Backends[0]), ShouldEqual, `{"kind":"static","name":"custom"}`)
+					case <-time.After(time.Second):
+						t.Fatal("the change wasn't applied")
+					}
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"time"
+)
+
+const (
+	limitSize = "size"
+	limitTime = "time"
+
+	limitFilterDepth      = "depth"
+	limitFilterComponents = "components"
+	limitFilterWildcards  = "wildcards"
+)
+
+// searchLimits returns the size and time limit of the search, the lower one
+// of the limit requested by the client and the limit of the proxy. Zero
+// doesn't limit the search.
+func (ldapProxy *LdapProxy) searchLimits(sizeLimit int, timeLimit int) (int, time.Duration) {
+	size := sizeLimit
+	if max := ldapProxy.config.SizeLimit; max > 0 && (size <= 0 || size > max) {
+		size = max
+	}
+
+	duration := time.Duration(timeLimit) * time.Second
+	if max := ldapProxy.config.TimeLimit; max > 0 && (duration <= 0 || duration > max) {
+		duration = max
+	}
+
+	return size, duration
+}
+
+// exceededFilterLimit returns the filter limit the filter exceeds, if any.
+// Zero or less doesn't limit the filters.
+func (ldapProxy *LdapProxy) exceededFilterLimit(f ldap.Filter) (string, bool) {
+	complexity := filter.Measure(f)
+
+	switch config := ldapProxy.config; {
+	case config.MaxFilterDepth > 0 && complexity.Depth > config.MaxFilterDepth:
+		return limitFilterDepth, true
+	case config.MaxFilterComponents > 0 && complexity.Components > config.MaxFilterComponents:
+		return limitFilterComponents, true
+	case config.MaxFilterWildcards > 0 && complexity.Wildcards > config.MaxFilterWildcards:
+		return limitFilterWildcards, true
+	}
+
+	return "", false
+}
+
+// limitBackend keeps at most the configured number of entries of a backend
+func (ldapProxy *LdapProxy) limitBackend(backend Backend, users []*User) []*User {
+	limit := ldapProxy.config.BackendSizeLimits[backend.Name()]
+	if limit <= 0 || len(users) <= limit {
+		return users
+	}
+
+	backendSizeLimitsTotal.With(prometheus.Labels{"backend": backend.Name()}).Inc()
+	log.Printf("backend %s returned %d entries, only %d taken", backend.Name(), len(users), limit)
+
+	return users[:limit]
+}
@@ -0,0 +1,206 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestLdapProxy_SearchLimits(t *testing.T) {
+	Convey("Given a ldap proxy with a backend of three entries", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{{DN: "cn=a"}, {DN: "cn=b"}, {DN: "cn=c"}}})
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the search requests a size limit of two", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree, SizeLimit: 2})
+
+			Convey("Then the first two entries are returned with sizeLimitExceeded", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSizeLimitExceeded)
+				So(res.Results, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When the size limit isn't exceeded", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree, SizeLimit: 3})
+
+			Convey("Then all entries are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When the proxy limits the size below the requested limit", func() {
+			config := DefaultProxyConfig()
+			config.SizeLimit = 1
+			proxy.Configure(config)
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the limit of the proxy applies", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSizeLimitExceeded)
+				So(res.Results, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the backend has a size limit", func() {
+			config := DefaultProxyConfig()
+			config.BackendSizeLimits = map[string]int{"a": 2}
+			proxy.Configure(config)
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the first entries of the backend are taken", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 2)
+			})
+		})
+	})
+
+	Convey("Given a ldap proxy with a slow backend", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", delay: 200 * time.Millisecond, user: []*User{{DN: "cn=a"}}})
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the proxy limits the duration of searches", func() {
+			config := DefaultProxyConfig()
+			config.TimeLimit = 10 * time.Millisecond
+			proxy.Configure(config)
+
+			start := time.Now()
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree, TimeLimit: 60})
+
+			Convey("Then timeLimitExceeded is returned once the limit passed", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultTimeLimitExceeded)
+				So(res.Results, ShouldBeEmpty)
+				So(time.Since(start), ShouldBeLessThan, 150*time.Millisecond)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_searchLimits(t *testing.T) {
+	Convey("Given a ldap proxy with limits", t, func() {
+		proxy := NewLdapProxy()
+		config := DefaultProxyConfig()
+		config.SizeLimit = 100
+		config.TimeLimit = 30 * time.Second
+		proxy.Configure(config)
+
+		Convey("When the request has no limits", func() {
+			size, duration := proxy.searchLimits(0, 0)
+
+			Convey("Then the limits of the proxy apply", func() {
+				So(size, ShouldEqual, 100)
+				So(duration, ShouldEqual, 30*time.Second)
+			})
+		})
+
+		Convey("When the request has lower limits", func() {
+			size, duration := proxy.searchLimits(10, 5)
+
+			Convey("Then the limits of the request apply", func() {
+				So(size, ShouldEqual, 10)
+				So(duration, ShouldEqual, 5*time.Second)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_FilterLimits(t *testing.T) {
+	Convey("Given a ldap proxy with filter limits", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{{DN: "cn=a", Attributes: map[string][]string{"cn": {"a"}}}}})
+
+		config := DefaultProxyConfig()
+		config.MaxFilterDepth = 2
+		config.MaxFilterComponents = 3
+		config.MaxFilterWildcards = 2
+		proxy.Configure(config)
+
+		sess := &session{context: setDn(context.Background(), "cn=test")}
+
+		search := func(raw string) *ldap.SearchResponse {
+			f, err := filter.Parse(raw)
+			So(err, ShouldBeNil)
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree, Filter: f})
+			So(err, ShouldBeNil)
+			return res
+		}
+
+		Convey("When the filter is within the limits", func() {
+			res := search("(&(cn=a)(cn=*a*))")
+
+			Convey("Then the search is passed on", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the filter is nested too deep", func() {
+			res := search("(&(!(cn=b)))")
+
+			Convey("Then unwillingToPerform is returned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(res.Message, ShouldContainSubstring, limitFilterDepth)
+			})
+		})
+
+		Convey("When the filter has too many components", func() {
+			res := search("(|(cn=a)(cn=b)(cn=c))")
+
+			Convey("Then unwillingToPerform is returned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(res.Message, ShouldContainSubstring, limitFilterComponents)
+			})
+		})
+
+		Convey("When a substring filter has too many wildcards", func() {
+			res := search("(cn=*a*b*)")
+
+			Convey("Then unwillingToPerform is returned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(res.Message, ShouldContainSubstring, limitFilterWildcards)
+			})
+		})
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"crypto/tls"
+	"github.com/gopenguin/ldap-proxy/pkg/ipfilter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/masking"
+	"github.com/gopenguin/ldap-proxy/pkg/valuerules"
+	"github.com/samuel/go-ldap/ldap"
+	"net"
+)
+
+// ListenerConfig contains the settings of an additional listener of the
+// proxy. All listeners share the backends and the proxy config.
+type ListenerConfig struct {
+	Name string
+
+	// Pseudonymizes personal data in the search results of this listener,
+	// e.g. for staging environments. Nil returns the real data.
+	Masking *masking.Profile
+
+	// Decides which source ips may connect to this listener. Nil uses the ip
+	// filter of the proxy.
+	IPFilter *ipfilter.Policy
+
+	// Changes the values of the search results of this listener after the
+	// value rules of the proxy, e.g. for partners. Nil changes nothing.
+	ValueRules *valuerules.Policy
+}
+
+// A Listener serves the proxy on an additional address with its own
+// settings.
+type Listener struct {
+	config ListenerConfig
+	server *ldap.Server
+	proxy  *LdapProxy
+}
+
+// listenerBackend marks the sessions with the listener they were accepted by
+type listenerBackend struct {
+	*LdapProxy
+	listener *Listener
+}
+
+func (ldapProxy *LdapProxy) NewListener(config ListenerConfig) *Listener {
+	listener := &Listener{
+		config: config,
+		proxy:  ldapProxy,
+	}
+
+	listener.server, _ = ldap.NewServer(LogBackend(ldapProxy.audited(ldapProxy.drained(&listenerBackend{
+		LdapProxy: ldapProxy,
+		listener:  listener,
+	}))), nil)
+	ldapProxy.addServer(listener.server)
+
+	return listener
+}
+
+func (listener *Listener) ListenAndServe(network, addr string) {
+	log.Printf("Start listener '%s' on %s", listener.config.Name, addr)
+	listener.server.Serve(network, addr)
+}
+
+func (listener *Listener) ListenAndServeTLS(network, addr string, tlsConfig *tls.Config) {
+	log.Printf("Start listener '%s' securely on %s", listener.config.Name, addr)
+	listener.server.ServeTLS(network, addr, tlsConfig)
+}
+
+// Close stops the listener, e.g. when a reload removes or changes it.
+func (listener *Listener) Close() error {
+	log.Printf("Stop listener '%s'", listener.config.Name)
+	listener.proxy.removeServer(listener.server)
+	return listener.server.Close()
+}
+
+func (backend *listenerBackend) Connect(remoteAddr net.Addr) (ldap.Context, error) {
+	sess, err := backend.LdapProxy.current().connect(remoteAddr, backend.listener)
+	if err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+func (sess *session) masking() *masking.Profile {
+	if sess.listener == nil {
+		return nil
+	}
+
+	return sess.listener.config.Masking
+}
+
+func (sess *session) valueRules() *valuerules.Policy {
+	if sess.listener == nil {
+		return nil
+	}
+
+	return sess.listener.config.ValueRules
+}
@@ -0,0 +1,170 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/ipfilter"
+	"github.com/gopenguin/ldap-proxy/pkg/masking"
+	"github.com/gopenguin/ldap-proxy/pkg/valuerules"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+)
+
+func TestListener_Search(t *testing.T) {
+	Convey("Given a ldap proxy with a masking listener", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{user: []*User{{DN: "cn=John Doe,ou=people", Attributes: map[string][]string{"cn": {"John Doe"}, "uid": {"jdoe"}}}}})
+
+		profile, _ := masking.New(&masking.Config{Secret: "secret"})
+		backend := &listenerBackend{
+			LdapProxy: proxy,
+			listener:  proxy.NewListener(ListenerConfig{Name: "staging", Masking: profile}),
+		}
+
+		Convey("When a session of the listener searches", func() {
+			ctx, _ := backend.Connect(&net.TCPAddr{})
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			res, err := backend.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the personal data is masked", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn="+profile.Value(masking.KindName, "John Doe")+",ou=people")
+				So(string(res.Results[0].Attributes["cn"][0]), ShouldEqual, profile.Value(masking.KindName, "John Doe"))
+				So(string(res.Results[0].Attributes["uid"][0]), ShouldEqual, "jdoe")
+			})
+		})
+
+		Convey("When a session of the main listener searches", func() {
+			ctx, _ := proxy.Connect(&net.TCPAddr{})
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			res, _ := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the real data is returned", func() {
+				So(res.Results[0].DN, ShouldEqual, "cn=John Doe,ou=people")
+			})
+		})
+	})
+}
+
+func TestListener_SearchValueRules(t *testing.T) {
+	Convey("Given a ldap proxy with value rules and a partner listener with own rules", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{user: []*User{{DN: "cn=John Doe,ou=people", Attributes: map[string][]string{
+			"cn":          {"John Doe"},
+			"description": {"admin of db-01.corp.example.com and more"},
+		}}}})
+
+		config := DefaultProxyConfig()
+		config.ValueRules, _ = valuerules.New([]*valuerules.Rule{{Attribute: "description", MaxLength: 35}})
+		proxy.Configure(config)
+
+		partner, _ := valuerules.New([]*valuerules.Rule{{Attribute: "description", Replace: `[a-z0-9-]+\.corp\.example\.com`, With: "[internal]"}})
+		backend := &listenerBackend{
+			LdapProxy: proxy,
+			listener:  proxy.NewListener(ListenerConfig{Name: "partner", ValueRules: partner}),
+		}
+
+		Convey("When a session of the listener searches", func() {
+			ctx, _ := backend.Connect(&net.TCPAddr{})
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			res, err := backend.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the rules of the proxy and of the listener apply", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(string(res.Results[0].Attributes["description"][0]), ShouldEqual, "admin of [internal] and")
+			})
+		})
+
+		Convey("When a session of the main listener searches", func() {
+			ctx, _ := proxy.Connect(&net.TCPAddr{})
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			res, _ := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the rules of the proxy apply", func() {
+				So(string(res.Results[0].Attributes["description"][0]), ShouldEqual, "admin of db-01.corp.example.com and")
+			})
+		})
+	})
+}
+
+func TestListener_Connect(t *testing.T) {
+	Convey("Given a ldap proxy allowing the internal network and a listener with its own ip filter", t, func() {
+		proxy := NewLdapProxy()
+
+		internal, _ := ipfilter.New(&ipfilter.Config{Allow: []string{"10.0.0.0/8"}})
+		config := DefaultProxyConfig()
+		config.IPFilter = internal
+		proxy.Configure(config)
+
+		partner, _ := ipfilter.New(&ipfilter.Config{Allow: []string{"192.0.2.0/24"}})
+		backend := &listenerBackend{
+			LdapProxy: proxy,
+			listener:  proxy.NewListener(ListenerConfig{Name: "partner", IPFilter: partner}),
+		}
+
+		Convey("When an internal ip connects to the main listener", func() {
+			ctx, err := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000})
+
+			Convey("Then the connection is accepted", func() {
+				So(err, ShouldBeNil)
+				So(ctx, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an external ip connects to the main listener", func() {
+			ctx, err := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000})
+
+			Convey("Then the connection is refused", func() {
+				So(err, ShouldEqual, errConnectionRefused)
+				So(ctx, ShouldBeNil)
+			})
+		})
+
+		Convey("When the partner connects to its listener", func() {
+			ctx, err := backend.Connect(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000})
+
+			Convey("Then the ip filter of the listener applies", func() {
+				So(err, ShouldBeNil)
+				So(ctx, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an internal ip connects to the partner listener", func() {
+			_, err := backend.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000})
+
+			Convey("Then the connection is refused", func() {
+				So(err, ShouldEqual, errConnectionRefused)
+			})
+		})
+	})
+}
@@ -0,0 +1,356 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lockout
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindDN = "dn"
+	KindIP = "ip"
+)
+
+var lockoutLog = log.Component(log.Cache)
+
+// Config defines when binds are locked out: after maxFailures failed binds of
+// a dn or from a source ip within the window, further binds are refused for
+// the cooldown.
+type Config struct {
+	MaxFailures int    `json:"maxFailures"`
+	Window      string `json:"window"`
+	Cooldown    string `json:"cooldown"`
+}
+
+// A Store keeps the failures and cooldowns outside of the proxy, so several
+// proxies share the lockouts. Get returns nil for missing keys, Incr returns
+// the incremented counter, a new counter expires after the ttl.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+	Incr(key string, ttl time.Duration) (int64, error)
+}
+
+// A Lockout is the start of a cooldown of a dn or source ip.
+type Lockout struct {
+	Kind     string
+	Key      string
+	Failures int
+	Until    time.Time
+}
+
+// A Guard counts the failed binds per dn and per source ip in a sliding
+// window. All methods may be called on a nil guard, which never locks out.
+type Guard struct {
+	maxFailures int
+	window      time.Duration
+	cooldown    time.Duration
+
+	now   func() time.Time
+	store Store
+
+	mutex     sync.Mutex
+	attempts  map[string]*attempts
+	lastSweep time.Time
+}
+
+type attempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+func New(config *Config) (*Guard, error) {
+	guard := &Guard{
+		maxFailures: config.MaxFailures,
+		window:      5 * time.Minute,
+		cooldown:    15 * time.Minute,
+		now:         time.Now,
+		attempts:    make(map[string]*attempts),
+	}
+
+	if guard.maxFailures <= 0 {
+		guard.maxFailures = 5
+	}
+
+	var err error
+	if guard.window, err = parseDuration(config.Window, guard.window); err != nil {
+		return nil, err
+	}
+	if guard.cooldown, err = parseDuration(config.Cooldown, guard.cooldown); err != nil {
+		return nil, err
+	}
+
+	guard.lastSweep = guard.now()
+
+	return guard, nil
+}
+
+// Share keeps the failures and cooldowns in the store instead of the memory of
+// the proxy. The failures are counted in a window starting with the first
+// failure instead of a sliding window.
+func (guard *Guard) Share(store Store) {
+	if guard == nil {
+		return
+	}
+
+	guard.store = store
+}
+
+// Locked reports whether binds of the dn or from the address are in their
+// cooldown.
+func (guard *Guard) Locked(dn string, addr net.Addr) bool {
+	if guard == nil {
+		return false
+	}
+
+	if guard.store != nil {
+		return guard.lockedShared(dn, addr)
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	now := guard.now()
+	for _, key := range keys(dn, addr) {
+		if a, ok := guard.attempts[key]; ok && now.Before(a.lockedUntil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Failure records a failed bind of the dn from the address and returns the
+// lockouts it started.
+func (guard *Guard) Failure(dn string, addr net.Addr) []*Lockout {
+	if guard == nil {
+		return nil
+	}
+
+	if guard.store != nil {
+		return guard.failureShared(dn, addr)
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	now := guard.now()
+	guard.sweep(now)
+
+	var lockouts []*Lockout
+	for _, key := range keys(dn, addr) {
+		a, ok := guard.attempts[key]
+		if !ok {
+			a = &attempts{}
+			guard.attempts[key] = a
+		}
+
+		a.failures = append(guard.recent(a.failures, now), now)
+		if len(a.failures) >= guard.maxFailures && !now.Before(a.lockedUntil) {
+			a.lockedUntil = now.Add(guard.cooldown)
+			kind, value := splitKey(key)
+			lockouts = append(lockouts, &Lockout{Kind: kind, Key: value, Failures: len(a.failures), Until: a.lockedUntil})
+			a.failures = nil
+		}
+	}
+
+	return lockouts
+}
+
+// Success forgets the failed binds of the dn. The failures of the source ip
+// are kept, a single valid account mustn't reset them.
+func (guard *Guard) Success(dn string) {
+	if guard == nil {
+		return
+	}
+
+	if guard.store != nil {
+		guard.resetShared(dn)
+		return
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	delete(guard.attempts, KindDN+":"+util.NormalizeDN(dn))
+}
+
+// Reset forgets the failed binds of the dn and ends its cooldown, e.g. for a
+// support call. It reports whether any were recorded.
+func (guard *Guard) Reset(dn string) bool {
+	if guard == nil {
+		return false
+	}
+
+	if guard.store != nil {
+		return guard.resetShared(dn)
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	key := KindDN + ":" + util.NormalizeDN(dn)
+	_, ok := guard.attempts[key]
+	delete(guard.attempts, key)
+
+	return ok
+}
+
+// recent drops the failures outside of the window
+func (guard *Guard) recent(failures []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) > guard.window {
+		i++
+	}
+
+	return failures[i:]
+}
+
+// sweep forgets the keys without recent failures or cooldown once per window,
+// so binds of random dns don't grow the guard
+func (guard *Guard) sweep(now time.Time) {
+	if now.Sub(guard.lastSweep) < guard.window {
+		return
+	}
+	guard.lastSweep = now
+
+	for key, a := range guard.attempts {
+		a.failures = guard.recent(a.failures, now)
+		if len(a.failures) == 0 && !now.Before(a.lockedUntil) {
+			delete(guard.attempts, key)
+		}
+	}
+}
+
+func (guard *Guard) lockedShared(dn string, addr net.Addr) bool {
+	for _, key := range keys(dn, addr) {
+		until, err := guard.store.Get(lockedKey(key))
+		guard.report(err)
+		if until != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (guard *Guard) failureShared(dn string, addr net.Addr) []*Lockout {
+	now := guard.now()
+
+	var lockouts []*Lockout
+	for _, key := range keys(dn, addr) {
+		failures, err := guard.store.Incr(failuresKey(key), guard.window)
+		if err != nil {
+			guard.report(err)
+			continue
+		}
+		if failures < int64(guard.maxFailures) {
+			continue
+		}
+
+		locked, err := guard.store.Get(lockedKey(key))
+		if err != nil || locked != nil {
+			guard.report(err)
+			continue
+		}
+
+		until := now.Add(guard.cooldown)
+		guard.report(guard.store.Set(lockedKey(key), []byte(until.Format(time.RFC3339)), guard.cooldown))
+		guard.report(guard.store.Delete(failuresKey(key)))
+
+		kind, value := splitKey(key)
+		lockouts = append(lockouts, &Lockout{Kind: kind, Key: value, Failures: int(failures), Until: until})
+	}
+
+	return lockouts
+}
+
+// resetShared forgets the failures and the cooldown of the dn and reports
+// whether any were recorded
+func (guard *Guard) resetShared(dn string) bool {
+	key := KindDN + ":" + util.NormalizeDN(dn)
+
+	recorded := false
+	for _, sharedKey := range []string{failuresKey(key), lockedKey(key)} {
+		value, err := guard.store.Get(sharedKey)
+		guard.report(err)
+		recorded = recorded || value != nil
+	}
+	guard.report(guard.store.Delete(failuresKey(key), lockedKey(key)))
+
+	return recorded
+}
+
+// report logs failures of the store, a failing store doesn't lock out
+func (guard *Guard) report(err error) {
+	if err != nil {
+		lockoutLog.Printf("shared lockout: %s", err)
+	}
+}
+
+func failuresKey(key string) string {
+	return "lockout:failures:" + key
+}
+
+func lockedKey(key string) string {
+	return "lockout:locked:" + key
+}
+
+func keys(dn string, addr net.Addr) []string {
+	keys := []string{KindDN + ":" + util.NormalizeDN(dn)}
+	if ip := ipOf(addr); ip != "" {
+		keys = append(keys, KindIP+":"+ip)
+	}
+
+	return keys
+}
+
+func splitKey(key string) (kind string, value string) {
+	i := strings.Index(key, ":")
+	return key[:i], key[i+1:]
+}
+
+func ipOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return host
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,179 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lockout
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testStore struct {
+	values map[string][]byte
+}
+
+func (store *testStore) Get(key string) ([]byte, error) {
+	return store.values[key], nil
+}
+
+func (store *testStore) Set(key string, value []byte, ttl time.Duration) error {
+	store.values[key] = value
+	return nil
+}
+
+func (store *testStore) Delete(keys ...string) error {
+	for _, key := range keys {
+		delete(store.values, key)
+	}
+	return nil
+}
+
+func (store *testStore) Incr(key string, ttl time.Duration) (int64, error) {
+	count, _ := strconv.ParseInt(string(store.values[key]), 10, 64)
+	store.values[key] = []byte(strconv.FormatInt(count+1, 10))
+	return count + 1, nil
+}
+
+func TestGuard(t *testing.T) {
+	Convey("Given a guard locking out after three failures within a minute", t, func() {
+		guard, err := New(&Config{MaxFailures: 3, Window: "1m", Cooldown: "10m"})
+		So(err, ShouldBeNil)
+
+		now := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+		guard.now = func() time.Time { return now }
+		guard.lastSweep = now
+		attacker := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+
+		Convey("When a dn fails to bind three times", func() {
+			So(guard.Failure("uid=user1", attacker), ShouldBeEmpty)
+			So(guard.Failure("uid=user1", attacker), ShouldBeEmpty)
+			lockouts := guard.Failure("uid=user1", attacker)
+
+			Convey("Then the dn and the source ip are locked out", func() {
+				So(lockouts, ShouldHaveLength, 2)
+				So(lockouts[0].Kind, ShouldEqual, KindDN)
+				So(lockouts[0].Key, ShouldEqual, "uid=user1")
+				So(lockouts[1].Kind, ShouldEqual, KindIP)
+				So(lockouts[1].Key, ShouldEqual, "192.0.2.1")
+				So(guard.Locked("UID=user1", nil), ShouldBeTrue)
+				So(guard.Locked("uid=user2", attacker), ShouldBeTrue)
+			})
+
+			Convey("Then the lockout ends after the cooldown", func() {
+				now = now.Add(11 * time.Minute)
+				So(guard.Locked("uid=user1", attacker), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the lockout of a locked out dn is reset", func() {
+			guard.Failure("uid=user1", nil)
+			guard.Failure("uid=user1", nil)
+			guard.Failure("uid=user1", nil)
+
+			Convey("Then the dn may bind again", func() {
+				So(guard.Reset("UID=user1"), ShouldBeTrue)
+				So(guard.Locked("uid=user1", nil), ShouldBeFalse)
+				So(guard.Reset("uid=user1"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the failures are spread over more than the window", func() {
+			guard.Failure("uid=user1", nil)
+			now = now.Add(40 * time.Second)
+			guard.Failure("uid=user1", nil)
+			now = now.Add(40 * time.Second)
+			lockouts := guard.Failure("uid=user1", nil)
+
+			Convey("Then the dn isn't locked out", func() {
+				So(lockouts, ShouldBeEmpty)
+				So(guard.Locked("uid=user1", nil), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a dn binds successfully after failures", func() {
+			guard.Failure("uid=user1", attacker)
+			guard.Failure("uid=user1", attacker)
+			guard.Success("uid=user1")
+			lockouts := guard.Failure("uid=user1", attacker)
+
+			Convey("Then only the failures of the source ip are kept", func() {
+				So(lockouts, ShouldHaveLength, 1)
+				So(lockouts[0].Kind, ShouldEqual, KindIP)
+				So(guard.Locked("uid=user1", nil), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the window passed", func() {
+			guard.Failure("uid=user1", nil)
+			now = now.Add(2 * time.Minute)
+			guard.Failure("uid=user2", nil)
+
+			Convey("Then the stale dns are forgotten", func() {
+				So(guard.attempts, ShouldHaveLength, 1)
+			})
+		})
+	})
+
+	Convey("Given two guards sharing a store", t, func() {
+		store := &testStore{values: make(map[string][]byte)}
+
+		first, _ := New(&Config{MaxFailures: 3})
+		first.Share(store)
+		second, _ := New(&Config{MaxFailures: 3})
+		second.Share(store)
+
+		Convey("When the failures of a dn are spread over both guards", func() {
+			So(first.Failure("uid=user1", nil), ShouldBeEmpty)
+			So(second.Failure("uid=user1", nil), ShouldBeEmpty)
+			lockouts := first.Failure("uid=user1", nil)
+
+			Convey("Then the dn is locked out by both", func() {
+				So(lockouts, ShouldHaveLength, 1)
+				So(lockouts[0].Failures, ShouldEqual, 3)
+				So(first.Locked("uid=user1", nil), ShouldBeTrue)
+				So(second.Locked("UID=user1", nil), ShouldBeTrue)
+			})
+
+			Convey("Then further failures don't start another lockout", func() {
+				second.Failure("uid=user1", nil)
+				second.Failure("uid=user1", nil)
+				So(second.Failure("uid=user1", nil), ShouldBeEmpty)
+			})
+
+			Convey("Then a reset on the other guard ends the lockout", func() {
+				So(second.Reset("uid=user1"), ShouldBeTrue)
+				So(first.Locked("uid=user1", nil), ShouldBeFalse)
+				So(store.values, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a nil guard", t, func() {
+		var guard *Guard
+
+		Convey("Then binds are never locked out", func() {
+			So(guard.Failure("uid=user1", nil), ShouldBeNil)
+			So(guard.Locked("uid=user1", nil), ShouldBeFalse)
+		})
+	})
+}
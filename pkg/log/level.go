@@ -0,0 +1,276 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level is the lowest level of the records a component logs.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelOff
+)
+
+const (
+	// Core is the component of the package level functions.
+	Core = "core"
+	// Backend is the parent of the components of the backends, a backend
+	// logs as "backend.<name>".
+	Backend = "backend"
+	// Cache is the component of the search, bind and shared caches.
+	Cache = "cache"
+	// Audit is the component of the audit trail.
+	Audit = "audit"
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelOff:   "off",
+}
+
+func (level Level) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Level(%d)", int(level))
+}
+
+// ParseLevel returns the level with the name.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+var (
+	levelsMutex sync.RWMutex
+	levels      = make(map[string]Level)
+
+	// verbose writes the debug records of the components logging with
+	// debug level while debug logging is disabled
+	verbose = newVerboseLogger()
+)
+
+// SetLevel overrides the level of the component and its children.
+func SetLevel(component string, level Level) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	levels[component] = level
+}
+
+// ResetLevel removes the override of the level of the component.
+func ResetLevel(component string) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	delete(levels, component)
+}
+
+// Levels returns the overridden levels by component.
+func Levels() map[string]Level {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	result := make(map[string]Level, len(levels))
+	for component, level := range levels {
+		result[component] = level
+	}
+
+	return result
+}
+
+// LevelOf returns the level of the component, that of the nearest parent if
+// it isn't overridden, e.g. backend for backend.ad, and the level of the
+// debug flag otherwise.
+func LevelOf(component string) Level {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	for name := component; ; {
+		if level, ok := levels[name]; ok {
+			return level
+		}
+
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	return DefaultLevel()
+}
+
+// DefaultLevel returns the level of the components without override, debug
+// with the debug flag and info otherwise.
+func DefaultLevel() Level {
+	if DebugEnabled {
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// SetLevels overrides the levels given as component=level, e.g.
+// backend.ad=debug.
+func SetLevels(specs []string) error {
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return fmt.Errorf("log level %q isn't given as component=level", spec)
+		}
+
+		level, err := ParseLevel(spec[i+1:])
+		if err != nil {
+			return err
+		}
+		SetLevel(spec[:i], level)
+	}
+
+	return nil
+}
+
+// Component returns the logger of the component. The records are filtered
+// by the level of the component.
+func Component(name string) Logger {
+	return &componentLogger{name: name}
+}
+
+var core = Component(Core)
+
+type componentLogger struct {
+	name string
+}
+
+var _ Logger = &componentLogger{}
+
+func (cl *componentLogger) enabled(level Level) bool {
+	return LevelOf(cl.name) <= level
+}
+
+// fields adds the name of the component to the fields of a record, the core
+// doesn't name itself to keep the lines of the proxy as they are
+func (cl *componentLogger) fields(keyvals []interface{}) []interface{} {
+	if cl.name == Core {
+		return keyvals
+	}
+
+	return append([]interface{}{"component", cl.name}, keyvals...)
+}
+
+func (cl *componentLogger) Print(v ...interface{}) {
+	if cl.enabled(LevelInfo) {
+		cl.info(fmt.Sprint(v...))
+	}
+}
+
+func (cl *componentLogger) Println(v ...interface{}) {
+	if cl.enabled(LevelInfo) {
+		cl.info(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+	}
+}
+
+func (cl *componentLogger) Printf(format string, v ...interface{}) {
+	if cl.enabled(LevelInfo) {
+		cl.info(fmt.Sprintf(format, v...))
+	}
+}
+
+func (cl *componentLogger) Infow(msg string, keyvals ...interface{}) {
+	if cl.enabled(LevelInfo) {
+		internal.Infow(msg, cl.fields(keyvals)...)
+	}
+}
+
+func (cl *componentLogger) info(msg string) {
+	if cl.name == Core {
+		internal.Print(msg)
+	} else {
+		internal.Infow(msg, cl.fields(nil)...)
+	}
+}
+
+func (cl *componentLogger) Debug(v ...interface{}) {
+	if cl.enabled(LevelDebug) {
+		cl.debug(fmt.Sprint(v...))
+	}
+}
+
+func (cl *componentLogger) Debugln(v ...interface{}) {
+	if cl.enabled(LevelDebug) {
+		cl.debug(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+	}
+}
+
+func (cl *componentLogger) Debugf(format string, v ...interface{}) {
+	if cl.enabled(LevelDebug) {
+		cl.debug(fmt.Sprintf(format, v...))
+	}
+}
+
+func (cl *componentLogger) Debugw(msg string, keyvals ...interface{}) {
+	if cl.enabled(LevelDebug) {
+		verbose.Debugw(msg, cl.fields(keyvals)...)
+	}
+}
+
+func (cl *componentLogger) debug(msg string) {
+	if cl.name == Core {
+		verbose.Debug(msg)
+	} else {
+		verbose.Debugw(msg, cl.fields(nil)...)
+	}
+}
+
+// newVerboseLogger returns a logger of the current format with debug records
+func newVerboseLogger() Logger {
+	return newFormatLogger(os.Stdout, log.LstdFlags, true)
+}
+
+func newFormatLogger(out io.Writer, flags int, debug bool) Logger {
+	if Format == FormatJSON {
+		return NewJSONLogger(out, debug)
+	}
+	if debug {
+		return newDebugLogger(out, flags)
+	}
+	return NewProdLogger(out, flags)
+}
+
+// ForBackend returns the logger of the backend with the name.
+func ForBackend(name string) Logger {
+	return Component(Backend + "." + name)
+}
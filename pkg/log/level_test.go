@@ -0,0 +1,139 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLevelOf(t *testing.T) {
+	convey.Convey("Given the level of the backends overridden", t, func() {
+		DebugEnabled = false
+		SetLevel(Backend, LevelOff)
+		SetLevel("backend.ad", LevelDebug)
+		convey.Reset(func() {
+			ResetLevel(Backend)
+			ResetLevel("backend.ad")
+		})
+
+		convey.Convey("Then a backend with an own level uses it", func() {
+			convey.So(LevelOf("backend.ad"), convey.ShouldEqual, LevelDebug)
+		})
+
+		convey.Convey("Then the other backends use the level of the backends", func() {
+			convey.So(LevelOf("backend.db"), convey.ShouldEqual, LevelOff)
+		})
+
+		convey.Convey("Then the other components use the default level", func() {
+			convey.So(LevelOf(Cache), convey.ShouldEqual, LevelInfo)
+		})
+
+		convey.Convey("Then the overridden levels are listed", func() {
+			convey.So(Levels(), convey.ShouldResemble, map[string]Level{Backend: LevelOff, "backend.ad": LevelDebug})
+		})
+	})
+}
+
+func TestSetLevels(t *testing.T) {
+	convey.Convey("Given levels as component=level", t, func() {
+		convey.Reset(func() {
+			ResetLevel("backend.ad")
+			ResetLevel(Cache)
+		})
+
+		convey.Convey("When they are valid", func() {
+			err := SetLevels([]string{"backend.ad=debug", "cache=OFF"})
+
+			convey.Convey("Then the components have the levels", func() {
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(LevelOf("backend.ad"), convey.ShouldEqual, LevelDebug)
+				convey.So(LevelOf(Cache), convey.ShouldEqual, LevelOff)
+			})
+		})
+
+		convey.Convey("When a level is unknown", func() {
+			err := SetLevels([]string{"cache=verbose"})
+
+			convey.Convey("Then an error is returned", func() {
+				convey.So(err, convey.ShouldNotBeNil)
+			})
+		})
+
+		convey.Convey("When the component is missing", func() {
+			err := SetLevels([]string{"debug"})
+
+			convey.Convey("Then an error is returned", func() {
+				convey.So(err, convey.ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestComponent(t *testing.T) {
+	convey.Convey("Given a component with debug level while debug logging is disabled", t, func() {
+		DebugEnabled = false
+		out := &bytes.Buffer{}
+		previous, previousVerbose := internal, verbose
+		internal, verbose = NewProdLogger(out, 0), newDebugLogger(out, 0)
+		SetLevel("backend.ad", LevelDebug)
+		convey.Reset(func() {
+			internal, verbose = previous, previousVerbose
+			ResetLevel("backend.ad")
+		})
+
+		convey.Convey("When the component logs a debug record", func() {
+			ForBackend("ad").Debugf("search of %s", "ou=People")
+
+			convey.Convey("Then the record is written with the component", func() {
+				convey.So(out.String(), convey.ShouldEqual, "D search of ou=People component=backend.ad\n")
+			})
+		})
+
+		convey.Convey("When another component logs a debug record", func() {
+			ForBackend("db").Debugf("search of %s", "ou=People")
+			Debug("core details")
+
+			convey.Convey("Then nothing is written", func() {
+				convey.So(out.String(), convey.ShouldEqual, "")
+			})
+		})
+
+		convey.Convey("When the core logs a record", func() {
+			Printf("listening on %s", ":389")
+
+			convey.Convey("Then the line is unchanged", func() {
+				convey.So(out.String(), convey.ShouldEqual, "listening on :389\n")
+			})
+		})
+
+		convey.Convey("When the core is turned off", func() {
+			SetLevel(Core, LevelOff)
+			defer ResetLevel(Core)
+			Print("listening")
+
+			convey.Convey("Then nothing is written", func() {
+				convey.So(out.String(), convey.ShouldEqual, "")
+			})
+		})
+	})
+}
@@ -27,11 +27,15 @@ import (
 
 var (
 	DebugEnabled = false
-	internal     = NewLogger()
+	// Format is either FormatText or FormatJSON
+	Format   = FormatText
+	internal = NewLogger()
 )
 
 func NewLogger() Logger {
-	if !DebugEnabled {
+	if Format == FormatJSON {
+		return NewJSONLogger(os.Stdout, DebugEnabled)
+	} else if !DebugEnabled {
 		return NewProdLogger(os.Stdout, log.LstdFlags)
 	} else {
 		return NewDebugLogger(os.Stdout, log.LstdFlags)
@@ -40,34 +44,48 @@ func NewLogger() Logger {
 
 func Reinit() {
 	internal = NewLogger()
+	verbose = newVerboseLogger()
 }
 
 func Print(v ...interface{}) {
-	internal.Print(v...)
+	core.Print(v...)
 }
 func Println(v ...interface{}) {
-	internal.Println(v...)
+	core.Println(v...)
 }
 func Printf(format string, v ...interface{}) {
-	internal.Printf(format, v...)
+	core.Printf(format, v...)
+}
+
+// Infow logs the message with the key value pairs as fields
+func Infow(msg string, keyvals ...interface{}) {
+	core.Infow(msg, keyvals...)
 }
 
 func Debug(v ...interface{}) {
-	internal.Debug(v...)
+	core.Debug(v...)
 }
 func Debugln(v ...interface{}) {
-	internal.Debugln(v...)
+	core.Debugln(v...)
 }
 func Debugf(format string, v ...interface{}) {
-	internal.Debugf(format, v...)
+	core.Debugf(format, v...)
+}
+
+// Debugw logs the message with the key value pairs as fields when debug
+// logging is enabled
+func Debugw(msg string, keyvals ...interface{}) {
+	core.Debugw(msg, keyvals...)
 }
 
 type Logger interface {
 	Print(v ...interface{})
 	Println(v ...interface{})
 	Printf(format string, v ...interface{})
+	Infow(msg string, keyvals ...interface{})
 
 	Debug(v ...interface{})
 	Debugln(v ...interface{})
 	Debugf(format string, v ...interface{})
+	Debugw(msg string, keyvals ...interface{})
 }
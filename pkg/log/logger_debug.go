@@ -26,16 +26,20 @@ import (
 )
 
 func NewDebugLogger(out io.Writer, flags int) Logger {
-	logger := &debugLogger{
-		logger:      log.New(out, "N ", flags),
-		debugLogger: log.New(out, "D ", flags),
-	}
+	logger := newDebugLogger(out, flags)
 
 	logger.Debug("Debug logging enabled")
 
 	return logger
 }
 
+func newDebugLogger(out io.Writer, flags int) *debugLogger {
+	return &debugLogger{
+		logger:      log.New(out, "N ", flags),
+		debugLogger: log.New(out, "D ", flags),
+	}
+}
+
 type debugLogger struct {
 	logger      *log.Logger
 	debugLogger *log.Logger
@@ -55,6 +59,10 @@ func (dl *debugLogger) Printf(format string, v ...interface{}) {
 	dl.logger.Printf(format, v...)
 }
 
+func (dl *debugLogger) Infow(msg string, keyvals ...interface{}) {
+	dl.logger.Print(textFields(msg, keyvals))
+}
+
 func (dl *debugLogger) Debug(v ...interface{}) {
 	dl.debugLogger.Print(v...)
 }
@@ -66,3 +74,7 @@ func (dl *debugLogger) Debugln(v ...interface{}) {
 func (dl *debugLogger) Debugf(format string, v ...interface{}) {
 	dl.debugLogger.Printf(format, v...)
 }
+
+func (dl *debugLogger) Debugw(msg string, keyvals ...interface{}) {
+	dl.debugLogger.Print(textFields(msg, keyvals))
+}
@@ -49,6 +49,10 @@ func (pl *productionLogger) Printf(format string, v ...interface{}) {
 	pl.logger.Printf(format, v...)
 }
 
+func (pl *productionLogger) Infow(msg string, keyvals ...interface{}) {
+	pl.logger.Print(textFields(msg, keyvals))
+}
+
 func (*productionLogger) Debug(v ...interface{}) {
 }
 
@@ -57,3 +61,6 @@ func (*productionLogger) Debugln(v ...interface{}) {
 
 func (*productionLogger) Debugf(format string, v ...interface{}) {
 }
+
+func (*productionLogger) Debugw(msg string, keyvals ...interface{}) {
+}
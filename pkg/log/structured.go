@@ -0,0 +1,196 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FormatText writes one human readable line per record
+	FormatText = "text"
+	// FormatJSON writes one json object per record
+	FormatJSON = "json"
+
+	// badKey is the key of a trailing value without a key, same as log/slog
+	badKey = "!BADKEY"
+)
+
+// ValidFormat reports whether format is a known log format
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// NewJSONLogger writes every record as json object with the time, the level
+// and the message, followed by the fields of the record. The keys follow
+// log/slog so that the lines can be ingested like those of other services.
+func NewJSONLogger(out io.Writer, debug bool) Logger {
+	return &jsonLogger{
+		out:   out,
+		debug: debug,
+		now:   time.Now,
+	}
+}
+
+type jsonLogger struct {
+	mutex sync.Mutex
+	out   io.Writer
+	debug bool
+	now   func() time.Time
+}
+
+var _ Logger = &jsonLogger{}
+
+func (jl *jsonLogger) Print(v ...interface{}) {
+	jl.write("INFO", fmt.Sprint(v...), nil)
+}
+
+func (jl *jsonLogger) Println(v ...interface{}) {
+	jl.write("INFO", fmt.Sprintln(v...), nil)
+}
+
+func (jl *jsonLogger) Printf(format string, v ...interface{}) {
+	jl.write("INFO", fmt.Sprintf(format, v...), nil)
+}
+
+func (jl *jsonLogger) Infow(msg string, keyvals ...interface{}) {
+	jl.write("INFO", msg, keyvals)
+}
+
+func (jl *jsonLogger) Debug(v ...interface{}) {
+	if jl.debug {
+		jl.write("DEBUG", fmt.Sprint(v...), nil)
+	}
+}
+
+func (jl *jsonLogger) Debugln(v ...interface{}) {
+	if jl.debug {
+		jl.write("DEBUG", fmt.Sprintln(v...), nil)
+	}
+}
+
+func (jl *jsonLogger) Debugf(format string, v ...interface{}) {
+	if jl.debug {
+		jl.write("DEBUG", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (jl *jsonLogger) Debugw(msg string, keyvals ...interface{}) {
+	if jl.debug {
+		jl.write("DEBUG", msg, keyvals)
+	}
+}
+
+func (jl *jsonLogger) write(level string, msg string, keyvals []interface{}) {
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeJSON(&line, jl.now().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeJSON(&line, level)
+	line.WriteString(`,"msg":`)
+	writeJSON(&line, strings.TrimSuffix(msg, "\n"))
+
+	eachField(keyvals, func(key string, value interface{}) {
+		line.WriteByte(',')
+		writeJSON(&line, key)
+		line.WriteByte(':')
+		writeJSON(&line, jsonValue(value))
+	})
+	line.WriteString("}\n")
+
+	jl.mutex.Lock()
+	defer jl.mutex.Unlock()
+
+	jl.out.Write(line.Bytes())
+}
+
+// writeJSON appends the encoded value, values which can't be encoded are
+// written as their string representation
+func writeJSON(line *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(encoded)
+}
+
+// jsonValue converts the values which json would encode as object or not at
+// all into their text
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Marshaler:
+		return value
+	case time.Duration:
+		// nanoseconds, same as log/slog
+		return int64(value)
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	return value
+}
+
+// eachField calls f for every key value pair, a trailing value without key is
+// reported with badKey
+func eachField(keyvals []interface{}, f func(key string, value interface{})) {
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			f(badKey, keyvals[i])
+			return
+		}
+
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		f(key, keyvals[i+1])
+	}
+}
+
+// textFields formats the message and the fields as key=value pairs, values
+// containing spaces or quotes are quoted
+func textFields(msg string, keyvals []interface{}) string {
+	var line bytes.Buffer
+	line.WriteString(msg)
+
+	eachField(keyvals, func(key string, value interface{}) {
+		line.WriteByte(' ')
+		line.WriteString(key)
+		line.WriteByte('=')
+
+		text := fmt.Sprint(value)
+		if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+			text = strconv.Quote(text)
+		}
+		line.WriteString(text)
+	})
+
+	return line.String()
+}
@@ -0,0 +1,115 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestJSONLogger(t *testing.T) {
+	convey.Convey("Given a json logger", t, func() {
+		out := &bytes.Buffer{}
+		logger := NewJSONLogger(out, false).(*jsonLogger)
+		logger.now = func() time.Time {
+			return time.Date(2017, 10, 14, 12, 0, 0, 0, time.UTC)
+		}
+
+		record := func() map[string]interface{} {
+			fields := map[string]interface{}{}
+			convey.So(json.Unmarshal(out.Bytes(), &fields), convey.ShouldBeNil)
+			return fields
+		}
+
+		convey.Convey("When a record with fields is logged", func() {
+			logger.Infow("operation", "op", "SEARCH", "session", 42, "duration", 3*time.Millisecond, "error", errors.New("failed"))
+
+			convey.Convey("Then the line is a single json object", func() {
+				convey.So(bytes.Count(out.Bytes(), []byte("\n")), convey.ShouldEqual, 1)
+				fields := record()
+				convey.So(fields["time"], convey.ShouldEqual, "2017-10-14T12:00:00Z")
+				convey.So(fields["level"], convey.ShouldEqual, "INFO")
+				convey.So(fields["msg"], convey.ShouldEqual, "operation")
+				convey.So(fields["op"], convey.ShouldEqual, "SEARCH")
+				convey.So(fields["session"], convey.ShouldEqual, 42.0)
+				convey.So(fields["duration"], convey.ShouldEqual, 3e6)
+				convey.So(fields["error"], convey.ShouldEqual, "failed")
+			})
+		})
+
+		convey.Convey("When a printf record is logged", func() {
+			logger.Printf("listening on %s\n", ":389")
+
+			convey.Convey("Then the text is the message", func() {
+				convey.So(record()["msg"], convey.ShouldEqual, "listening on :389")
+			})
+		})
+
+		convey.Convey("When a value has no key", func() {
+			logger.Infow("operation", "op", "BIND", "orphan")
+
+			convey.Convey("Then it is logged with the bad key", func() {
+				convey.So(record()[badKey], convey.ShouldEqual, "orphan")
+			})
+		})
+
+		convey.Convey("When debug logging is disabled", func() {
+			logger.Debugw("details", "op", "BIND")
+			logger.Debugf("details %d", 1)
+
+			convey.Convey("Then nothing is written", func() {
+				convey.So(out.Len(), convey.ShouldEqual, 0)
+			})
+		})
+
+		convey.Convey("When debug logging is enabled", func() {
+			logger.debug = true
+			logger.Debugw("details", "op", "BIND")
+
+			convey.Convey("Then the record has the debug level", func() {
+				convey.So(record()["level"], convey.ShouldEqual, "DEBUG")
+			})
+		})
+	})
+
+	convey.Convey("Given that the json format is selected", t, func() {
+		Format = FormatJSON
+		defer func() { Format = FormatText }()
+
+		convey.Convey("Then the factory returns the json logger", func() {
+			convey.So(NewLogger(), convey.ShouldHaveSameTypeAs, &jsonLogger{})
+		})
+	})
+}
+
+func TestTextFields(t *testing.T) {
+	convey.Convey("Given a message with fields", t, func() {
+		line := textFields("operation", []interface{}{"op", "SEARCH", "dn", "cn=John Doe,dc=example", "empty", "", "result", 0})
+
+		convey.Convey("Then the fields follow the message as key value pairs", func() {
+			convey.So(line, convey.ShouldEqual, `operation op=SEARCH dn="cn=John Doe,dc=example" empty="" result=0`)
+		})
+	})
+}
@@ -24,7 +24,6 @@ import (
 	"github.com/gopenguin/ldap-proxy/pkg/log"
 	"github.com/samuel/go-ldap/ldap"
 	"net"
-	"strings"
 	"time"
 )
 
@@ -40,114 +39,194 @@ type logBackend struct {
 
 var _ ldap.Backend = &logBackend{}
 
-func (l *logBackend) logCtx(name string, ctx ldap.Context, start time.Time) {
-	duration := time.Since(start)
-
-	sess := ctx.(*session)
-	if getDn(sess.context) != "" {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", getDn(sess.context), " ", duration)
-	} else {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", duration)
+// begin starts a request of the session, the other backends are called with
+// the request
+func (l *logBackend) begin(ctx ldap.Context) ldap.Context {
+	if sess, ok := ctx.(*session); ok {
+		return newRequest(sess)
 	}
-}
 
-func (l *logBackend) logCtxAuth(name string, ctx ldap.Context, authenticated bool, start time.Time) {
-	duration := time.Since(start)
+	return ctx
+}
 
-	sess := ctx.(*session)
-	if getDn(sess.context) != "" {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", getDn(sess.context), " ", authenticated, " ", duration)
-	} else {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", authenticated, " ", duration)
+// identify adds the request id to the diagnostic message of an error response
+func (l *logBackend) identify(ctx ldap.Context, res *ldap.BaseResponse, err error) error {
+	id := requestId(ctx)
+	withRequestId(res, id)
+	if response, ok := err.(*ldap.BaseResponse); ok {
+		withRequestId(response, id)
 	}
+
+	return err
 }
 
-func (l *logBackend) logCtxFilter(name string, ctx ldap.Context, filter ldap.Filter, start time.Time) {
+// logCtx logs the operation with the fields of the session, the fields are
+// followed by the additional key value pairs
+func (l *logBackend) logCtx(name string, ctx ldap.Context, code ldap.ResultCode, start time.Time, keyvals ...interface{}) {
 	duration := time.Since(start)
 
-	sess := ctx.(*session)
-	if getDn(sess.context) != "" {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", getDn(sess.context), " ", filter, " ", duration)
-	} else {
-		log.Print(getId(sess.context), " ", rightPad(10, name), " ", filter, " ", duration)
+	sess, _ := sessionOf(ctx)
+	fields := []interface{}{"op", name, "session", getId(sess.context)}
+	if id := requestId(ctx); id != "" {
+		fields = append(fields, "request", id)
+	}
+	if addr := getRemoteAddr(sess.context); addr != nil {
+		fields = append(fields, "client", addr.String())
 	}
+	if dn := getDn(sess.context); dn != "" {
+		fields = append(fields, "dn", dn)
+	}
+	fields = append(fields, keyvals...)
+	fields = append(fields, "result", int(code), "duration", duration)
+
+	log.Infow("operation", fields...)
 }
 
 func (l *logBackend) Add(ctx ldap.Context, req *ldap.AddRequest) (*ldap.AddResponse, error) {
-	defer l.logCtx("ADD", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
 
-	return l.backend.Add(ctx, req)
+	res, err := l.backend.Add(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("ADD", ctx, resultCode(base, err), start, "entry", req.DN)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) Bind(ctx ldap.Context, req *ldap.BindRequest) (*ldap.BindResponse, error) {
 	start := time.Now()
+	ctx = l.begin(ctx)
 
 	res, err := l.backend.Bind(ctx, req)
 
-	l.logCtxAuth("BIND", ctx, err == nil && res.BaseResponse.Code == ldap.ResultSuccess, start)
-	return res, err
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("BIND", ctx, resultCode(base, err), start)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) Connect(remoteAddr net.Addr) (ldap.Context, error) {
 	start := time.Now()
 
 	ctx, err := l.backend.Connect(remoteAddr)
+	if err != nil {
+		return nil, err
+	}
 
 	sess := ctx.(*session)
-	sess.context = setId(sess.context)
+	if getId(sess.context) == -1 {
+		sess.context = setId(sess.context)
+	}
 
-	l.logCtx("CONNECT", ctx, start)
-	return ctx, err
+	l.logCtx("CONNECT", ctx, ldap.ResultSuccess, start)
+	return ctx, nil
 }
 
 func (l *logBackend) Delete(ctx ldap.Context, req *ldap.DeleteRequest) (*ldap.DeleteResponse, error) {
-	defer l.logCtx("DELETE", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
 
-	return l.backend.Delete(ctx, req)
+	res, err := l.backend.Delete(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("DELETE", ctx, resultCode(base, err), start, "entry", req.DN)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) Disconnect(ctx ldap.Context) {
-	defer l.logCtx("DISCONNECT", ctx, time.Now())
+	defer l.logCtx("DISCONNECT", ctx, ldap.ResultSuccess, time.Now())
 
 	l.backend.Disconnect(ctx)
 }
 
 func (l *logBackend) ExtendedRequest(ctx ldap.Context, req *ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
-	defer l.logCtx("EXTENDED", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
 
-	return l.backend.ExtendedRequest(ctx, req)
+	res, err := l.backend.ExtendedRequest(ctx, req)
+
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("EXTENDED", ctx, resultCode(base, err), start, "name", req.Name)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) Modify(ctx ldap.Context, req *ldap.ModifyRequest) (*ldap.ModifyResponse, error) {
-	defer l.logCtx("MODIFY", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
+
+	res, err := l.backend.Modify(ctx, req)
 
-	return l.backend.Modify(ctx, req)
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("MODIFY", ctx, resultCode(base, err), start, "entry", req.DN)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) ModifyDN(ctx ldap.Context, req *ldap.ModifyDNRequest) (*ldap.ModifyDNResponse, error) {
-	defer l.logCtx("MODIFYDN", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
+
+	res, err := l.backend.ModifyDN(ctx, req)
 
-	return l.backend.ModifyDN(ctx, req)
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+	}
+	l.logCtx("MODIFYDN", ctx, resultCode(base, err), start, "entry", req.DN)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) PasswordModify(ctx ldap.Context, req *ldap.PasswordModifyRequest) ([]byte, error) {
-	defer l.logCtx("PWMODIFY", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
+
+	res, err := l.backend.PasswordModify(ctx, req)
 
-	return l.backend.PasswordModify(ctx, req)
+	// the library answers every error with resultCode other, the code of the
+	// refusal is logged besides
+	code, fields := resultCode(nil, err), []interface{}{}
+	if err != nil {
+		code, fields = ldap.ResultOther, append(fields, "refused", code)
+	}
+	l.logCtx("PWMODIFY", ctx, code, start, fields...)
+	return res, l.identify(ctx, nil, err)
 }
 
 func (l *logBackend) Search(ctx ldap.Context, req *ldap.SearchRequest) (*ldap.SearchResponse, error) {
-	defer l.logCtxFilter("SEARCH", ctx, req.Filter, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
 
-	return l.backend.Search(ctx, req)
+	res, err := l.backend.Search(ctx, req)
+
+	fields := []interface{}{"base", req.BaseDN, "filter", req.Filter}
+	var base *ldap.BaseResponse
+	if res != nil {
+		base = &res.BaseResponse
+		fields = append(fields, "entries", len(res.Results))
+	}
+	l.logCtx("SEARCH", ctx, resultCode(base, err), start, fields...)
+	return res, l.identify(ctx, base, err)
 }
 
 func (l *logBackend) Whoami(ctx ldap.Context) (string, error) {
-	defer l.logCtx("WHOAMI", ctx, time.Now())
+	start := time.Now()
+	ctx = l.begin(ctx)
 
-	return l.backend.Whoami(ctx)
-}
+	res, err := l.backend.Whoami(ctx)
 
-func rightPad(length int, value string) string {
-	return value + strings.Repeat(" ", length-len(value))
+	l.logCtx("WHOAMI", ctx, resultCode(nil, err), start)
+	return res, l.identify(ctx, nil, err)
 }
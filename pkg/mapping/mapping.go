@@ -0,0 +1,187 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mapping
+
+import (
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// Config maps the attribute names the clients use to the names of the
+// backend, e.g. uid to sAMAccountName, so backends with different schemas
+// look alike.
+type Config struct {
+	pkg.Config
+
+	AttributeMap map[string]string `json:"attributeMap"`
+}
+
+type mappingBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	// the lower case names of the clients and of the backend
+	toBackend map[string]string
+	toClient  map[string]string
+}
+
+var _ pkg.PasswordBackend = &mappingBackend{}
+var _ pkg.WriterBackend = &mappingBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *Config) (pkg.Backend, error) {
+	backend := &mappingBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		toBackend:       make(map[string]string),
+		toClient:        make(map[string]string),
+	}
+
+	for client, name := range config.AttributeMap {
+		if client == "" || name == "" {
+			return nil, fmt.Errorf("mapping: attribute '%s' mapped to '%s'", client, name)
+		}
+		if existing, ok := backend.toClient[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("mapping: attributes '%s' and '%s' both mapped to '%s'", existing, client, name)
+		}
+
+		backend.toBackend[strings.ToLower(client)] = name
+		backend.toClient[strings.ToLower(name)] = client
+	}
+
+	return backend, nil
+}
+
+func (backend *mappingBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *mappingBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *mappingBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *mappingBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, backend.mapFilter(f))
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make([]*pkg.User, len(users))
+	for i, user := range users {
+		mapped[i] = backend.mapUser(user)
+	}
+
+	return mapped, nil
+}
+
+// Add writes the entry with the attributes renamed to the names of the
+// backend.
+func (backend *mappingBackend) Add(ctx context.Context, entry *pkg.User) error {
+	mapped := &pkg.User{
+		DN:         entry.DN,
+		Attributes: make(map[string][]string, len(entry.Attributes)),
+	}
+	for name, values := range entry.Attributes {
+		mapped.Attributes[backend.backendName(name)] = values
+	}
+
+	return backend.Forwarder.Add(ctx, mapped)
+}
+
+// Modify writes the modifications with the attributes renamed to the names
+// of the backend.
+func (backend *mappingBackend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	mapped := make([]*ldap.Mod, len(mods))
+	for i, mod := range mods {
+		mapped[i] = &ldap.Mod{Type: mod.Type, Name: backend.backendName(mod.Name), Values: mod.Values}
+	}
+
+	return backend.Forwarder.Modify(ctx, dn, mapped)
+}
+
+// mapFilter renames the asserted attributes to the names of the backend
+func (backend *mappingBackend) mapFilter(f ldap.Filter) ldap.Filter {
+	return filter.Rewrite(f, func(assertion ldap.Filter) ldap.Filter {
+		switch assertion := assertion.(type) {
+		case *ldap.EqualityMatch:
+			return &ldap.EqualityMatch{Attribute: backend.backendName(assertion.Attribute), Value: assertion.Value}
+		case *ldap.ApproxMatch:
+			return &ldap.ApproxMatch{Attribute: backend.backendName(assertion.Attribute), Value: assertion.Value}
+		case *ldap.GreaterOrEqual:
+			return &ldap.GreaterOrEqual{Attribute: backend.backendName(assertion.Attribute), Value: assertion.Value}
+		case *ldap.LessOrEqual:
+			return &ldap.LessOrEqual{Attribute: backend.backendName(assertion.Attribute), Value: assertion.Value}
+		case *ldap.Present:
+			return &ldap.Present{Attribute: backend.backendName(assertion.Attribute)}
+		case *ldap.Substrings:
+			mapped := *assertion
+			mapped.Attribute = backend.backendName(assertion.Attribute)
+			return &mapped
+		case *ldap.ExtensibleMatch:
+			mapped := *assertion
+			mapped.Attribute = backend.backendName(assertion.Attribute)
+			return &mapped
+		}
+		return assertion
+	})
+}
+
+// mapUser returns a copy of the entry with the attributes renamed to the
+// names of the clients. Attributes of the backend named like a mapped
+// attribute of the clients are dropped, the mapped attribute wins.
+func (backend *mappingBackend) mapUser(user *pkg.User) *pkg.User {
+	mapped := &pkg.User{
+		DN:         user.DN,
+		Attributes: make(map[string][]string, len(user.Attributes)),
+	}
+
+	for name, values := range user.Attributes {
+		if client, ok := backend.toClient[strings.ToLower(name)]; ok {
+			mapped.Attributes[client] = values
+		} else if _, shadowed := backend.toBackend[strings.ToLower(name)]; !shadowed {
+			mapped.Attributes[name] = values
+		}
+	}
+
+	return mapped
+}
+
+func (backend *mappingBackend) backendName(attribute string) string {
+	if name, ok := backend.toBackend[strings.ToLower(attribute)]; ok {
+		return name
+	}
+
+	return attribute
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mapping
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	lastFilter ldap.Filter
+
+	users []*pkg.User
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+
+	return backend.users, nil
+}
+
+func TestMappingBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend mapping attributes", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "cn=John Doe,ou=People,dc=example,dc=com", Attributes: map[string][]string{
+				"sAMAccountName": {"jdoe"},
+				"mail":           {"jdoe@example.com"},
+				"uid":            {"1000"},
+				"cn":             {"John Doe"},
+			}},
+		}}
+		backend, err := NewBackend(delegate, &Config{AttributeMap: map[string]string{"uid": "sAMAccountName", "email": "mail"}})
+		So(err, ShouldBeNil)
+
+		Convey("When a client searches with its names", func() {
+			f, err := filter.Parse("(&(UID=jdoe)(email=*@example.com)(!(cn=admin))(email=*))")
+			So(err, ShouldBeNil)
+			users, err := backend.GetUsers(context.Background(), f)
+
+			Convey("Then the backend is searched with its names", func() {
+				So(err, ShouldBeNil)
+				So(filter.String(delegate.lastFilter), ShouldEqual, "(&(sAMAccountName=jdoe)(mail=*@example.com)(!(cn=admin))(mail=*))")
+			})
+
+			Convey("Then the entries carry the names of the clients", func() {
+				So(users, ShouldHaveLength, 1)
+				So(users[0].DN, ShouldEqual, "cn=John Doe,ou=People,dc=example,dc=com")
+				So(users[0].Attributes, ShouldResemble, map[string][]string{
+					"uid":   {"jdoe"},
+					"email": {"jdoe@example.com"},
+					"cn":    {"John Doe"},
+				})
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].Attributes, ShouldContainKey, "sAMAccountName")
+			})
+		})
+	})
+
+	Convey("Given two attributes mapped to the same one", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{AttributeMap: map[string]string{"uid": "sAMAccountName", "login": "samaccountname"}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
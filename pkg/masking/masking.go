@@ -0,0 +1,176 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	KindName  = "name"
+	KindEmail = "email"
+	KindPhone = "phone"
+	KindHash  = "hash"
+)
+
+var (
+	ErrNoSecret    = errors.New("masking: a secret is required")
+	ErrUnknownKind = errors.New("masking: unknown attribute kind")
+
+	// The attributes masked when a profile does not list its own.
+	DefaultAttributes = map[string]string{
+		"cn":              KindName,
+		"sn":              KindName,
+		"givenName":       KindName,
+		"displayName":     KindName,
+		"mail":            KindEmail,
+		"telephoneNumber": KindPhone,
+		"mobile":          KindPhone,
+	}
+)
+
+type Config struct {
+	// The key of the pseudonymization. Equal values are replaced by equal
+	// pseudonyms as long as the secret stays the same.
+	Secret string `json:"secret"`
+
+	// The masked attributes with their kind (name, email, phone or hash).
+	Attributes map[string]string `json:"attributes"`
+}
+
+// A Profile consistently replaces personal data with pseudonyms. The
+// pseudonym only depends on the secret and the original value, so references
+// between entries stay intact while the real data is not exposed.
+type Profile struct {
+	secret     []byte
+	attributes map[string]string
+}
+
+func New(config *Config) (*Profile, error) {
+	if config.Secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	attributes := config.Attributes
+	if len(attributes) == 0 {
+		attributes = DefaultAttributes
+	}
+
+	profile := &Profile{
+		secret:     []byte(config.Secret),
+		attributes: make(map[string]string),
+	}
+	for name, kind := range attributes {
+		switch kind {
+		case KindName, KindEmail, KindPhone, KindHash:
+		default:
+			return nil, fmt.Errorf("%v: %s", ErrUnknownKind, kind)
+		}
+		profile.attributes[strings.ToLower(name)] = kind
+	}
+
+	return profile, nil
+}
+
+// Mask returns a copy of the attributes with all configured attributes
+// pseudonymized. A nil profile returns the attributes unchanged.
+func (profile *Profile) Mask(attributes map[string][]string) map[string][]string {
+	if profile == nil {
+		return attributes
+	}
+
+	masked := make(map[string][]string, len(attributes))
+	for name, values := range attributes {
+		kind, ok := profile.attributes[strings.ToLower(name)]
+		if !ok {
+			masked[name] = values
+			continue
+		}
+
+		maskedValues := make([]string, len(values))
+		for i, value := range values {
+			maskedValues[i] = profile.Value(kind, value)
+		}
+		masked[name] = maskedValues
+	}
+
+	return masked
+}
+
+// Value returns the pseudonym of a single value of the given kind.
+func (profile *Profile) Value(kind string, value string) string {
+	sum := profile.sum(kind, value)
+	id := hex.EncodeToString(sum[:4])
+
+	switch kind {
+	case KindName:
+		return "Person " + id
+	case KindEmail:
+		return "user-" + id + "@example.invalid"
+	case KindPhone:
+		// 555-01xx numbers are reserved for fictional use
+		return fmt.Sprintf("+1 %03d 555 01%02d", 200+binary.BigEndian.Uint16(sum[4:6])%800, sum[6]%100)
+	default:
+		return hex.EncodeToString(sum[:16])
+	}
+}
+
+func (profile *Profile) sum(kind string, value string) []byte {
+	mac := hmac.New(sha256.New, profile.secret)
+	// names are case insensitive in a directory, emails mostly too
+	if kind != KindHash {
+		value = strings.ToLower(strings.TrimSpace(value))
+	}
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// MaskDN pseudonymizes the value of the leading rdn if its attribute is
+// masked, e.g. a dn starting with the common name of a person.
+func (profile *Profile) MaskDN(dn string) string {
+	if profile == nil {
+		return dn
+	}
+
+	rdn, rest := dn, ""
+	if i := strings.Index(dn, ","); i >= 0 {
+		rdn, rest = dn[:i], dn[i:]
+	}
+
+	parts := strings.SplitN(rdn, "=", 2)
+	if len(parts) != 2 {
+		return dn
+	}
+
+	kind, ok := profile.attributes[strings.ToLower(strings.TrimSpace(parts[0]))]
+	if !ok {
+		return dn
+	}
+
+	value := strings.Replace(profile.Value(kind, parts[1]), "+", "\\+", -1)
+	return parts[0] + "=" + value + rest
+}
@@ -0,0 +1,109 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package masking
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestProfile_Mask(t *testing.T) {
+	Convey("Given a profile with the default attributes", t, func() {
+		profile, err := New(&Config{Secret: "secret"})
+		So(err, ShouldBeNil)
+
+		attributes := map[string][]string{
+			"uid":             {"jdoe"},
+			"cn":              {"John Doe"},
+			"mail":            {"john.doe@example.com"},
+			"telephoneNumber": {"+49 89 1234567"},
+		}
+
+		Convey("When the attributes are masked", func() {
+			masked := profile.Mask(attributes)
+
+			Convey("Then the personal data is replaced", func() {
+				So(masked["uid"], ShouldResemble, []string{"jdoe"})
+				So(masked["cn"][0], ShouldStartWith, "Person ")
+				So(masked["mail"][0], ShouldEndWith, "@example.invalid")
+				So(masked["telephoneNumber"][0], ShouldStartWith, "+1 ")
+				So(strings.Join(masked["cn"], ""), ShouldNotContainSubstring, "Doe")
+			})
+
+			Convey("Then the original attributes are untouched", func() {
+				So(attributes["cn"], ShouldResemble, []string{"John Doe"})
+			})
+
+			Convey("Then the pseudonyms are consistent", func() {
+				again := profile.Mask(map[string][]string{"displayName": {"john doe"}})
+				So(again["displayName"], ShouldResemble, masked["cn"])
+			})
+		})
+
+		Convey("When a dn starting with a masked attribute is masked", func() {
+			dn := profile.MaskDN("cn=John Doe,ou=people,dc=example,dc=com")
+
+			Convey("Then only the rdn value is replaced", func() {
+				So(dn, ShouldEqual, "cn="+profile.Value(KindName, "John Doe")+",ou=people,dc=example,dc=com")
+			})
+		})
+
+		Convey("When a dn starting with another attribute is masked", func() {
+			dn := profile.MaskDN("uid=jdoe,ou=people")
+
+			Convey("Then the dn is unchanged", func() {
+				So(dn, ShouldEqual, "uid=jdoe,ou=people")
+			})
+		})
+	})
+
+	Convey("Given two profiles with different secrets", t, func() {
+		first, _ := New(&Config{Secret: "first"})
+		second, _ := New(&Config{Secret: "second"})
+
+		Convey("Then the pseudonyms differ", func() {
+			So(first.Value(KindEmail, "a@example.com"), ShouldNotEqual, second.Value(KindEmail, "a@example.com"))
+		})
+	})
+
+	Convey("Given an invalid config", t, func() {
+		Convey("Then a missing secret is rejected", func() {
+			_, err := New(&Config{})
+			So(err, ShouldEqual, ErrNoSecret)
+		})
+
+		Convey("Then an unknown kind is rejected", func() {
+			_, err := New(&Config{Secret: "secret", Attributes: map[string]string{"cn": "address"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given no profile", t, func() {
+		var profile *Profile
+
+		Convey("Then the attributes are returned unchanged", func() {
+			attributes := map[string][]string{"cn": {"John Doe"}}
+			So(profile.Mask(attributes), ShouldResemble, attributes)
+			So(profile.MaskDN("cn=John Doe"), ShouldEqual, "cn=John Doe")
+		})
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/memberof"
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// addMemberOf returns the users with the memberOf attribute computed from the
+// groups of the backends. Users which already have memberOf keep it, the
+// users passed in are left unchanged.
+func (ldapProxy *LdapProxy) addMemberOf(ctx context.Context, users []*User) []*User {
+	if ldapProxy.config.MemberOf == nil {
+		return users
+	}
+
+	withMemberOf := make([]*User, len(users))
+	for i, user := range users {
+		withMemberOf[i] = user
+		if len(filter.Values(user.Attributes, memberof.Attribute)) > 0 {
+			continue
+		}
+
+		groups, err := ldapProxy.memberOf(ctx, user.DN, user.Attributes)
+		if err != nil {
+			log.Printf("computing memberOf of %s failed: %v", user.DN, err)
+			return users
+		}
+		if len(groups) == 0 {
+			continue
+		}
+
+		attributes := make(map[string][]string, len(user.Attributes)+1)
+		for name, values := range user.Attributes {
+			attributes[name] = values
+		}
+		attributes[memberof.Attribute] = groups
+		withMemberOf[i] = &User{DN: user.DN, Attributes: attributes}
+	}
+
+	return withMemberOf
+}
+
+// memberOf returns the groups listing the dn or the uid of the entry as
+// member
+func (ldapProxy *LdapProxy) memberOf(ctx context.Context, dn string, attributes map[string][]string) ([]string, error) {
+	var uid string
+	if uids := filter.Values(attributes, "uid"); len(uids) > 0 {
+		uid = uids[0]
+	}
+
+	return ldapProxy.config.MemberOf.MemberOf(ctx, dn, uid, ldapProxy.searchGroups)
+}
+
+// searchGroups searches the groups of all backends for the memberOf index
+func (ldapProxy *LdapProxy) searchGroups(ctx context.Context, f ldap.Filter) ([]*memberof.Entry, error) {
+	users, err := ldapProxy.searchBackends(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*memberof.Entry, len(users))
+	for i, user := range users {
+		groups[i] = &memberof.Entry{DN: user.DN, Attributes: user.Attributes}
+	}
+
+	return groups, nil
+}
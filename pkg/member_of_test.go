@@ -0,0 +1,75 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/memberof"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_MemberOf(t *testing.T) {
+	Convey("Given a ldap proxy computing memberOf", t, func() {
+		backend := &testBackend{result: true, user: []*User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"jdoe"}}},
+			{DN: "uid=asmith,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"asmith"}, "memberOf": {"cn=native,ou=Groups,dc=example,dc=com"}}},
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"cn": {"admins"}, "member": {"uid=jdoe,ou=People,dc=example,dc=com", "uid=asmith,ou=People,dc=example,dc=com"}}},
+		}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		resolver, err := memberof.New(&memberof.Config{})
+		So(err, ShouldBeNil)
+		config := DefaultProxyConfig()
+		config.MemberOf = resolver
+		config.SessionAttributes = []string{"memberOf"}
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When a user binds", func() {
+			res, err := proxy.Bind(ctx, &ldap.BindRequest{DN: "uid=jdoe,ou=People,dc=example,dc=com", Password: []byte("secure")})
+			So(err, ShouldBeNil)
+			So(res.Code, ShouldEqual, ldap.ResultSuccess)
+
+			Convey("Then the computed memberOf is a session attribute", func() {
+				So(getAttributes(ctx.(*session).context)["memberOf"], ShouldResemble, []string{"cn=admins,ou=Groups,dc=example,dc=com"})
+			})
+
+			Convey("When the users are searched", func() {
+				res, err := proxy.Search(ctx, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: &ldap.Present{Attribute: "uid"}})
+
+				Convey("Then users without memberOf get the computed one", func() {
+					So(err, ShouldBeNil)
+					So(res.Results, ShouldHaveLength, 2)
+					So(res.Results[0].Attributes["memberOf"], ShouldResemble, [][]byte{[]byte("cn=admins,ou=Groups,dc=example,dc=com")})
+					So(res.Results[1].Attributes["memberOf"], ShouldResemble, [][]byte{[]byte("cn=native,ou=Groups,dc=example,dc=com")})
+				})
+
+				Convey("Then the entries of the backend are unchanged", func() {
+					So(backend.user[0].Attributes, ShouldNotContainKey, "memberOf")
+				})
+			})
+		})
+	})
+}
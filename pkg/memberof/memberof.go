@@ -0,0 +1,224 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package memberof
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The attribute computed for the entries
+const Attribute = "memberOf"
+
+var (
+	DefaultMemberAttributes = []string{"member", "uniqueMember"}
+	DefaultGroupFilter      = "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup))"
+)
+
+// Config defines how the groups are found: the entries matching the group
+// filter list their members by dn in the member attributes and by uid in the
+// member uid attribute. The memberships are looked up again after the ttl.
+type Config struct {
+	GroupFilter        string   `json:"groupFilter"`
+	MemberAttributes   []string `json:"memberAttributes"`
+	MemberUidAttribute string   `json:"memberUidAttribute"`
+	TTL                string   `json:"ttl"`
+}
+
+// An Entry is a group returned by the search.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// A Search returns the groups matching the filter from the backends.
+type Search func(ctx context.Context, f ldap.Filter) ([]*Entry, error)
+
+// A Resolver computes memberOf for entries of backends which don't maintain
+// it. It keeps an index of all memberships which is built by a single search
+// and rebuilt once it is older than the ttl. All methods may be called on a
+// nil resolver, which knows no groups.
+type Resolver struct {
+	groupFilter        ldap.Filter
+	memberAttributes   []string
+	memberUidAttribute string
+	ttl                time.Duration
+
+	now func() time.Time
+
+	mutex   sync.Mutex
+	built   time.Time
+	byDN    map[string][]string
+	byUid   map[string][]string
+	pending chan struct{}
+}
+
+func New(config *Config) (*Resolver, error) {
+	resolver := &Resolver{
+		memberAttributes:   config.MemberAttributes,
+		memberUidAttribute: config.MemberUidAttribute,
+		ttl:                5 * time.Minute,
+		now:                time.Now,
+	}
+
+	groupFilter := config.GroupFilter
+	if groupFilter == "" {
+		groupFilter = DefaultGroupFilter
+	}
+	var err error
+	if resolver.groupFilter, err = filter.Parse(groupFilter); err != nil {
+		return nil, err
+	}
+
+	if len(resolver.memberAttributes) == 0 {
+		resolver.memberAttributes = DefaultMemberAttributes
+	}
+	if resolver.memberUidAttribute == "" {
+		resolver.memberUidAttribute = "memberUid"
+	}
+	if config.TTL != "" {
+		if resolver.ttl, err = time.ParseDuration(config.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolver, nil
+}
+
+// MemberOf returns the dns of the groups listing the dn or the uid as
+// member. The index of the memberships is rebuilt with the search if it is
+// missing or expired; concurrent callers wait for a single rebuild. If the
+// rebuild fails the previous index is kept for another ttl.
+func (resolver *Resolver) MemberOf(ctx context.Context, dn string, uid string, search Search) ([]string, error) {
+	if resolver == nil {
+		return nil, nil
+	}
+
+	if err := resolver.refresh(ctx, search); err != nil {
+		return nil, err
+	}
+
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	groups := append([]string{}, resolver.byDN[util.NormalizeDN(dn)]...)
+	if uid != "" {
+		for _, group := range resolver.byUid[strings.ToLower(uid)] {
+			if !containsFold(groups, group) {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// Flush drops the index, the next lookup rebuilds it.
+func (resolver *Resolver) Flush() {
+	if resolver == nil {
+		return
+	}
+
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	resolver.built = time.Time{}
+}
+
+func (resolver *Resolver) refresh(ctx context.Context, search Search) error {
+	resolver.mutex.Lock()
+	for resolver.pending != nil {
+		pending := resolver.pending
+		resolver.mutex.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		resolver.mutex.Lock()
+	}
+
+	if !resolver.built.IsZero() && resolver.now().Sub(resolver.built) < resolver.ttl {
+		resolver.mutex.Unlock()
+		return nil
+	}
+
+	pending := make(chan struct{})
+	resolver.pending = pending
+	resolver.mutex.Unlock()
+
+	groups, err := search(ctx, resolver.groupFilter)
+
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+	resolver.pending = nil
+	close(pending)
+
+	if err != nil {
+		if resolver.byDN != nil {
+			// keep serving the expired index instead of searching on every
+			// lookup while the backends fail
+			resolver.built = resolver.now()
+			return nil
+		}
+		return err
+	}
+
+	resolver.byDN, resolver.byUid = resolver.index(groups)
+	resolver.built = resolver.now()
+
+	return nil
+}
+
+func (resolver *Resolver) index(groups []*Entry) (byDN map[string][]string, byUid map[string][]string) {
+	byDN = make(map[string][]string)
+	byUid = make(map[string][]string)
+
+	for _, group := range groups {
+		for _, attribute := range resolver.memberAttributes {
+			for _, member := range filter.Values(group.Attributes, attribute) {
+				key := util.NormalizeDN(member)
+				byDN[key] = append(byDN[key], group.DN)
+			}
+		}
+		for _, member := range filter.Values(group.Attributes, resolver.memberUidAttribute) {
+			key := strings.ToLower(member)
+			byUid[key] = append(byUid[key], group.DN)
+		}
+	}
+
+	return byDN, byUid
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package memberof
+
+import (
+	"context"
+	"errors"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestResolver_MemberOf(t *testing.T) {
+	Convey("Given a resolver and the groups of the backends", t, func() {
+		resolver, err := New(&Config{TTL: "1m"})
+		So(err, ShouldBeNil)
+
+		now := time.Date(2017, 10, 14, 12, 0, 0, 0, time.UTC)
+		resolver.now = func() time.Time { return now }
+
+		searches := 0
+		var searchErr error
+		groups := []*Entry{
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"member": {"uid=jdoe,ou=People,dc=example,dc=com"}}},
+			{DN: "cn=devs,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"uniqueMember": {"UID=JDOE,ou=People,dc=example,dc=com"}, "memberUid": {"asmith"}}},
+			{DN: "cn=users,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"memberUid": {"jdoe", "asmith"}}},
+		}
+		search := func(ctx context.Context, f ldap.Filter) ([]*Entry, error) {
+			searches++
+			return groups, searchErr
+		}
+
+		Convey("Then the groups listing the dn or the uid are returned", func() {
+			memberOf, err := resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+			So(err, ShouldBeNil)
+			So(memberOf, ShouldResemble, []string{"cn=admins,ou=Groups,dc=example,dc=com", "cn=devs,ou=Groups,dc=example,dc=com", "cn=users,ou=Groups,dc=example,dc=com"})
+
+			memberOf, err = resolver.MemberOf(context.Background(), "uid=asmith,ou=People,dc=example,dc=com", "asmith", search)
+			So(err, ShouldBeNil)
+			So(memberOf, ShouldResemble, []string{"cn=devs,ou=Groups,dc=example,dc=com", "cn=users,ou=Groups,dc=example,dc=com"})
+
+			memberOf, err = resolver.MemberOf(context.Background(), "uid=nobody,ou=People,dc=example,dc=com", "", search)
+			So(err, ShouldBeNil)
+			So(memberOf, ShouldBeEmpty)
+		})
+
+		Convey("Then the groups are searched once within the ttl", func() {
+			resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+			now = now.Add(30 * time.Second)
+			resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+			So(searches, ShouldEqual, 1)
+
+			now = now.Add(time.Minute)
+			resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+			So(searches, ShouldEqual, 2)
+
+			resolver.Flush()
+			resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+			So(searches, ShouldEqual, 3)
+		})
+
+		Convey("When the search fails", func() {
+			searchErr = errors.New("backend down")
+
+			Convey("Then the error is returned without index", func() {
+				_, err := resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Then an expired index is kept", func() {
+				searchErr = nil
+				resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+				searchErr = errors.New("backend down")
+				now = now.Add(2 * time.Minute)
+
+				memberOf, err := resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", search)
+				So(err, ShouldBeNil)
+				So(memberOf, ShouldHaveLength, 3)
+			})
+		})
+	})
+
+	Convey("Given a nil resolver", t, func() {
+		var resolver *Resolver
+
+		Convey("Then no groups are returned", func() {
+			memberOf, err := resolver.MemberOf(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "jdoe", nil)
+			So(err, ShouldBeNil)
+			So(memberOf, ShouldBeNil)
+		})
+	})
+
+	Convey("Given an invalid group filter", t, func() {
+		_, err := New(&Config{GroupFilter: "(objectClass=group"})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package members
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+const (
+	// FormatMember adds the dns of the members, like groupOfNames
+	FormatMember = "member"
+	// FormatMemberUid adds the names of the members, like posixGroup
+	FormatMemberUid = "memberUid"
+)
+
+// GroupMembersConfig converts the members of the groups to the format the
+// clients expect: the member dns of groupOfNames are built from the
+// memberUid names of posixGroup as the uid rdn below the people base, the
+// names are taken from the uid rdn of the member dns.
+type GroupMembersConfig struct {
+	Format       string `json:"format"`
+	PeopleBase   string `json:"peopleBase"`
+	UidAttribute string `json:"uidAttribute"`
+}
+
+type Config struct {
+	pkg.Config
+
+	GroupMembers *GroupMembersConfig `json:"groupMembers"`
+}
+
+type membersBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	format       string
+	peopleBase   string
+	uidAttribute string
+}
+
+var _ pkg.PasswordBackend = &membersBackend{}
+var _ pkg.WriterBackend = &membersBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *GroupMembersConfig) (pkg.Backend, error) {
+	if config.Format != FormatMember && config.Format != FormatMemberUid {
+		return nil, fmt.Errorf("members: unknown format '%s'", config.Format)
+	}
+	if config.Format == FormatMember && strings.TrimSpace(config.PeopleBase) == "" {
+		return nil, fmt.Errorf("members: format '%s' needs the peopleBase", config.Format)
+	}
+
+	backend := &membersBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		format:          config.Format,
+		peopleBase:      strings.TrimSpace(config.PeopleBase),
+		uidAttribute:    config.UidAttribute,
+	}
+	if backend.uidAttribute == "" {
+		backend.uidAttribute = "uid"
+	}
+
+	return backend, nil
+}
+
+func (backend *membersBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *membersBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *membersBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+// GetUsers adds the members in the format of the clients to copies of the
+// groups lacking them.
+func (backend *membersBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, backend.mapFilter(f))
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]*pkg.User, len(users))
+	for i, user := range users {
+		converted[i] = backend.convert(user)
+	}
+
+	return converted, nil
+}
+
+// mapFilter also asks for the members in the format of the backend, e.g.
+// (memberUid=jdoe) becomes (|(memberUid=jdoe)(member=uid=jdoe,<peopleBase>))
+func (backend *membersBackend) mapFilter(f ldap.Filter) ldap.Filter {
+	return filter.Rewrite(f, func(assertion ldap.Filter) ldap.Filter {
+		match, ok := assertion.(*ldap.EqualityMatch)
+		if !ok || !strings.EqualFold(match.Attribute, backend.format) {
+			return assertion
+		}
+
+		var other *ldap.EqualityMatch
+		if backend.format == FormatMember {
+			if name, ok := backend.name(string(match.Value)); ok {
+				other = &ldap.EqualityMatch{Attribute: FormatMemberUid, Value: []byte(name)}
+			}
+		} else {
+			other = &ldap.EqualityMatch{Attribute: FormatMember, Value: []byte(backend.dn(string(match.Value)))}
+		}
+		if other == nil {
+			return assertion
+		}
+
+		return &ldap.OR{Filters: []ldap.Filter{assertion, other}}
+	})
+}
+
+// convert returns a copy of the group with the members in the format of the
+// clients, the group itself if it has them already or has no members
+func (backend *membersBackend) convert(user *pkg.User) *pkg.User {
+	if len(filter.Values(user.Attributes, backend.format)) > 0 {
+		return user
+	}
+
+	var values []string
+	if backend.format == FormatMember {
+		for _, name := range filter.Values(user.Attributes, FormatMemberUid) {
+			values = append(values, backend.dn(name))
+		}
+	} else {
+		for _, dn := range filter.Values(user.Attributes, FormatMember) {
+			if name, ok := backend.name(dn); ok {
+				values = append(values, name)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return user
+	}
+
+	converted := &pkg.User{DN: user.DN, Attributes: make(map[string][]string, len(user.Attributes)+1)}
+	for attribute, attributeValues := range user.Attributes {
+		converted.Attributes[attribute] = attributeValues
+	}
+	converted.Attributes[backend.format] = values
+
+	return converted
+}
+
+// dn returns the dn of the member with the name
+func (backend *membersBackend) dn(name string) string {
+	return backend.uidAttribute + "=" + escape(name) + "," + backend.peopleBase
+}
+
+// name returns the name of the member with the dn if it's the uid rdn of an
+// entry below the people base
+func (backend *membersBackend) name(dn string) (string, bool) {
+	rdns := util.SplitDN(dn)
+	if len(rdns) < 2 || (backend.peopleBase != "" && !util.IsBelowDN(dn, backend.peopleBase)) {
+		return "", false
+	}
+
+	parts := strings.SplitN(rdns[0], "=", 2)
+	if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), backend.uidAttribute) {
+		return "", false
+	}
+
+	return unescape(strings.TrimSpace(parts[1])), true
+}
+
+// escape escapes the special characters of a dn value
+func escape(value string) string {
+	var escaped bytes.Buffer
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;=", c),
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(value)-1):
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(c)
+	}
+
+	return escaped.String()
+}
+
+// unescape drops the backslashes escaping the special characters
+func unescape(value string) string {
+	var unescaped bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		unescaped.WriteByte(value[i])
+	}
+
+	return unescaped.String()
+}
@@ -0,0 +1,126 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package members
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+
+	lastFilter ldap.Filter
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+	return backend.users, nil
+}
+
+func TestMembersBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend with posix groups converted to member dns", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "cn=staff,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"memberUid": {"jdoe", "Smith, A"}}},
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"member": {"uid=root,ou=People,dc=example,dc=com"}, "memberUid": {"jdoe"}}},
+		}}
+		backend, err := NewBackend(delegate, &GroupMembersConfig{Format: FormatMember, PeopleBase: "ou=People,dc=example,dc=com"})
+		So(err, ShouldBeNil)
+
+		Convey("When the groups of a member are searched", func() {
+			users, err := backend.GetUsers(context.Background(), &ldap.EqualityMatch{Attribute: "member", Value: []byte("UID=jdoe, OU=People,dc=example,dc=com")})
+			So(err, ShouldBeNil)
+
+			Convey("Then the backend is also asked for the name of the member", func() {
+				So(delegate.lastFilter, ShouldResemble, &ldap.OR{Filters: []ldap.Filter{
+					&ldap.EqualityMatch{Attribute: "member", Value: []byte("UID=jdoe, OU=People,dc=example,dc=com")},
+					&ldap.EqualityMatch{Attribute: "memberUid", Value: []byte("jdoe")},
+				}})
+			})
+
+			Convey("Then the member dns are added to the groups lacking them", func() {
+				So(users[0].Attributes["member"], ShouldResemble, []string{"uid=jdoe,ou=People,dc=example,dc=com", `uid=Smith\, A,ou=People,dc=example,dc=com`})
+				So(users[0].Attributes["memberUid"], ShouldResemble, []string{"jdoe", "Smith, A"})
+				So(delegate.users[0].Attributes, ShouldNotContainKey, "member")
+			})
+
+			Convey("Then groups with member dns are unchanged", func() {
+				So(users[1], ShouldEqual, delegate.users[1])
+			})
+		})
+	})
+
+	Convey("Given a backend with member dns converted to posix groups", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "cn=staff,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{"member": {
+				"uid=jdoe,ou=People,dc=example,dc=com",
+				`uid=Smith\, A,ou=People,dc=example,dc=com`,
+				"cn=John Doe,ou=People,dc=example,dc=com",
+				"uid=svc,ou=Apps,dc=example,dc=com",
+			}}},
+		}}
+		backend, err := NewBackend(delegate, &GroupMembersConfig{Format: FormatMemberUid, PeopleBase: "ou=People,dc=example,dc=com"})
+		So(err, ShouldBeNil)
+
+		Convey("When the groups of a member are searched", func() {
+			users, err := backend.GetUsers(context.Background(), &ldap.EqualityMatch{Attribute: "memberUid", Value: []byte("jdoe")})
+			So(err, ShouldBeNil)
+
+			Convey("Then the backend is also asked for the dn of the member", func() {
+				So(delegate.lastFilter, ShouldResemble, &ldap.OR{Filters: []ldap.Filter{
+					&ldap.EqualityMatch{Attribute: "memberUid", Value: []byte("jdoe")},
+					&ldap.EqualityMatch{Attribute: "member", Value: []byte("uid=jdoe,ou=People,dc=example,dc=com")},
+				}})
+			})
+
+			Convey("Then the names of the uid rdns below the people base are added", func() {
+				So(users[0].Attributes["memberUid"], ShouldResemble, []string{"jdoe", "Smith, A"})
+			})
+		})
+	})
+
+	Convey("Given an unknown format", t, func() {
+		_, err := NewBackend(&testBackend{}, &GroupMembersConfig{Format: "uniqueMember"})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given member dns without people base", t, func() {
+		_, err := NewBackend(&testBackend{}, &GroupMembersConfig{Format: FormatMember})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
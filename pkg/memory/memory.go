@@ -23,8 +23,10 @@ package memory
 import (
 	"context"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
 	"github.com/gopenguin/ldap-proxy/pkg/util"
 	"github.com/samuel/go-ldap/ldap"
+	"sync"
 )
 
 type backendFactory struct{}
@@ -53,9 +55,13 @@ func (backendFactory) New(untypedConfig interface{}) (bknd pkg.Backend, err erro
 
 type backend struct {
 	config *Config
-	users  map[string]User
+
+	mutex sync.RWMutex
+	users map[string]User
 }
 
+var _ pkg.PasswordBackend = &backend{}
+
 type Config struct {
 	pkg.Config
 	ListUsers bool   `json:"listUsers"`
@@ -86,7 +92,9 @@ func (backend *backend) Name() (name string) {
 }
 
 func (backend *backend) Authenticate(ctx context.Context, username string, password string) (successful bool) {
+	backend.mutex.RLock()
 	user, ok := backend.users[username]
+	backend.mutex.RUnlock()
 	if !ok {
 		return false
 	}
@@ -94,70 +102,39 @@ func (backend *backend) Authenticate(ctx context.Context, username string, passw
 	return util.VerifyPasswordCtx(ctx, user.Password, password)
 }
 
-func (backend *backend) GetUsers(ctx context.Context, f ldap.Filter) (users []*pkg.User, err error) {
-	users = []*pkg.User{}
+// SetPassword replaces the password of the user until the proxy is restarted.
+func (backend *backend) SetPassword(ctx context.Context, username string, password string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
 
-	if backend.config.ListUsers {
-		for _, user := range backend.config.Users {
-			if f == nil || backend.filterUser(user, f) {
-				users = append(users,
-					&pkg.User{
-						DN: user.Name,
-						Attributes: map[string][]string{
-							"cn": {user.Name},
-						},
-					})
-			}
-		}
+	user, ok := backend.users[username]
+	if !ok {
+		return pkg.ErrNoSuchEntry
 	}
 
-	return
-}
-
-func (backend *backend) filterUser(user User, f ldap.Filter) bool {
-	switch f.(type) {
-	case *ldap.AND:
-		a := f.(*ldap.AND)
-		res := true
-
-		for _, filter := range a.Filters {
-			res = res && backend.filterUser(user, filter)
-		}
-		return res
-
-	case *ldap.OR:
-		a := f.(*ldap.OR)
-		res := false
-
-		for _, filter := range a.Filters {
-			res = res || backend.filterUser(user, filter)
-		}
-		return res
-
-	case *ldap.EqualityMatch:
-		e := f.(*ldap.EqualityMatch)
+	user.Password = util.HashPassword(password, 12)
+	backend.users[username] = user
 
-		switch e.Attribute {
-		case "cn":
-			return string(e.Value) == user.Name
-		}
-
-	case *ldap.ApproxMatch:
-		a := f.(*ldap.ApproxMatch)
+	return nil
+}
 
-		switch a.Attribute {
-		case "cn":
-			return string(a.Value) == user.Name
-		}
+func (backend *backend) GetUsers(ctx context.Context, f ldap.Filter) (users []*pkg.User, err error) {
+	users = []*pkg.User{}
 
-	case *ldap.Present:
-		p := f.(*ldap.Present)
+	if backend.config.ListUsers {
+		for _, user := range backend.config.Users {
+			entry := &pkg.User{
+				DN: user.Name,
+				Attributes: map[string][]string{
+					"cn": {user.Name},
+				},
+			}
 
-		switch p.Attribute {
-		case "cn":
-			return true
+			if filter.Matches(entry.Attributes, f) {
+				users = append(users, entry)
+			}
 		}
 	}
 
-	return false
+	return
 }
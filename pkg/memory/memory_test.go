@@ -23,6 +23,7 @@ package memory
 import (
 	"context"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
@@ -87,6 +88,16 @@ func TestBackend_GetUsers(t *testing.T) {
 					So(users[0].Attributes["cn"][0], ShouldEqual, "user1")
 				})
 			})
+
+			Convey("When the users are searched with a substring filter", func() {
+				matching, _ := backend.GetUsers(context.Background(), &ldap.Substrings{Attribute: "cn", Initial: "user"})
+				other, _ := backend.GetUsers(context.Background(), &ldap.Substrings{Attribute: "cn", Final: "2"})
+
+				Convey("Then only the matching users are returned", func() {
+					So(matching, ShouldHaveLength, 1)
+					So(other, ShouldHaveLength, 0)
+				})
+			})
 		})
 
 		Convey("Given the config is set to not list users", func() {
@@ -103,3 +114,31 @@ func TestBackend_GetUsers(t *testing.T) {
 		})
 	})
 }
+
+func TestBackend_SetPassword(t *testing.T) {
+	Convey("Given a memory backend", t, func() {
+		backend := NewBackend(&Config{
+			Users: []User{
+				{Name: "user1", Password: "$2a$04$7aS0AmbLn./PTc0DpX2XeOpKV2VPM6RRrooSHsG/n.zolLV78BGny"},
+			},
+		})
+
+		Convey("When the password of user1 is changed", func() {
+			err := backend.SetPassword(context.Background(), "user1", "secret")
+
+			Convey("Then user1 authenticates with the new password only", func() {
+				So(err, ShouldBeNil)
+				So(backend.Authenticate(context.Background(), "user1", "secret"), ShouldBeTrue)
+				So(backend.Authenticate(context.Background(), "user1", "test123"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the password of an unknown user is changed", func() {
+			err := backend.SetPassword(context.Background(), "user2", "secret")
+
+			Convey("Then the user is not found", func() {
+				So(err, ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+)
+
+// A MergeStrategy defines how the entries returned by multiple backends are
+// combined into a single search result.
+type MergeStrategy string
+
+const (
+	// MergeAll returns all entries in the order they arrive, even if the
+	// backends return entries with the same dn.
+	MergeAll = MergeStrategy("merge-all")
+	// MergeFirstBackendWins keeps only the entry of the first configured
+	// backend if several backends return the same dn.
+	MergeFirstBackendWins = MergeStrategy("first-backend-wins")
+	// MergeDeduplicate combines the attributes of all entries with the same dn.
+	MergeDeduplicate = MergeStrategy("merge-and-deduplicate")
+	// MergeFailOnConflict fails the search if several backends return the
+	// same dn.
+	MergeFailOnConflict = MergeStrategy("fail-on-conflict")
+)
+
+func ParseMergeStrategy(value string) (MergeStrategy, error) {
+	switch strategy := MergeStrategy(value); strategy {
+	case MergeAll, MergeFirstBackendWins, MergeDeduplicate, MergeFailOnConflict:
+		return strategy, nil
+	}
+
+	return "", fmt.Errorf("proxy: unknown merge strategy '%s'", value)
+}
+
+// merge combines the users returned by the backends. The results are ordered
+// like the configured backends, arrival lists the indices of the results in the
+// order they were received.
+func (strategy MergeStrategy) merge(results [][]*User, arrival []int) ([]*User, error) {
+	if strategy == MergeAll || strategy == "" {
+		var users []*User
+		for _, i := range arrival {
+			users = append(users, results[i]...)
+		}
+		return users, nil
+	}
+
+	var users []*User
+	byDn := make(map[string]*User)
+
+	for _, backendUsers := range results {
+		for _, user := range backendUsers {
+			key := util.NormalizeDN(user.DN)
+
+			existing, ok := byDn[key]
+			if !ok {
+				if strategy == MergeDeduplicate {
+					// the merge modifies the entry, which may be shared
+					// with the backend or other coalesced searches
+					user = copyUser(user)
+				}
+				byDn[key] = user
+				users = append(users, user)
+				continue
+			}
+
+			switch strategy {
+			case MergeFailOnConflict:
+				return nil, fmt.Errorf("proxy: conflicting entries for %s", user.DN)
+			case MergeDeduplicate:
+				mergeAttributes(existing, user)
+			}
+		}
+	}
+
+	return users, nil
+}
+
+func mergeAttributes(target *User, source *User) {
+	if target.Attributes == nil {
+		target.Attributes = map[string][]string{}
+	}
+
+	for name, values := range source.Attributes {
+		for _, value := range values {
+			if !containsValue(target.Attributes[name], value) {
+				target.Attributes[name] = append(target.Attributes[name], value)
+			}
+		}
+	}
+}
+
+func copyUser(user *User) *User {
+	attributes := make(map[string][]string, len(user.Attributes))
+	for name, values := range user.Attributes {
+		attributes[name] = append([]string(nil), values...)
+	}
+
+	return &User{
+		DN:         user.DN,
+		Attributes: attributes,
+	}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMergeStrategy_merge(t *testing.T) {
+	Convey("Given two backends returning the same dn", t, func() {
+		results := func() [][]*User {
+			return [][]*User{
+				{{DN: "uid=user1,dc=example,dc=com", Attributes: map[string][]string{"mail": {"user1@example.com"}}}},
+				{
+					{DN: "UID=user1,dc=example,dc=com", Attributes: map[string][]string{"mail": {"u1@example.com"}}},
+					{DN: "uid=user2,dc=example,dc=com"},
+				},
+			}
+		}
+		arrival := []int{1, 0}
+
+		Convey("When all entries are merged", func() {
+			users, err := MergeAll.merge(results(), arrival)
+
+			Convey("Then all entries are returned in arrival order", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 3)
+				So(users[0].DN, ShouldEqual, "UID=user1,dc=example,dc=com")
+			})
+		})
+
+		Convey("When the first backend wins", func() {
+			users, err := MergeFirstBackendWins.merge(results(), arrival)
+
+			Convey("Then the entry of the first backend is returned", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 2)
+				So(users[0].Attributes["mail"], ShouldResemble, []string{"user1@example.com"})
+			})
+		})
+
+		Convey("When the entries are deduplicated", func() {
+			users, err := MergeDeduplicate.merge(results(), arrival)
+
+			Convey("Then the attributes are combined", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 2)
+				So(users[0].Attributes["mail"], ShouldResemble, []string{"user1@example.com", "u1@example.com"})
+			})
+		})
+
+		Convey("When conflicts are not allowed", func() {
+			users, err := MergeFailOnConflict.merge(results(), arrival)
+
+			Convey("Then an error is returned", func() {
+				So(err, ShouldNotBeNil)
+				So(users, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an unknown strategy", t, func() {
+		_, err := ParseMergeStrategy("unknown")
+
+		Convey("Then it can't be parsed", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DuoConfig struct {
+	// The api hostname of the application, e.g. api-xxxxxxxx.duosecurity.com
+	Host           string `json:"host"`
+	IntegrationKey string `json:"integrationKey"`
+	SecretKey      string `json:"secretKey"`
+
+	// The factor of the authentication, `push` by default
+	Factor string `json:"factor"`
+}
+
+// NewDuoApprover returns an approver sending a push of the Duo Auth API to the
+// user and waiting for the answer.
+func NewDuoApprover(config *DuoConfig) Approver {
+	factor := config.Factor
+	if factor == "" {
+		factor = "push"
+	}
+
+	return &duoApprover{
+		baseURL:        "https://" + config.Host,
+		host:           strings.ToLower(config.Host),
+		integrationKey: config.IntegrationKey,
+		secretKey:      config.SecretKey,
+		factor:         factor,
+		client:         &http.Client{},
+		now:            time.Now,
+	}
+}
+
+type duoApprover struct {
+	baseURL        string
+	host           string
+	integrationKey string
+	secretKey      string
+	factor         string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+type duoResponse struct {
+	Stat     string `json:"stat"`
+	Message  string `json:"message"`
+	Response struct {
+		Result string `json:"result"`
+	} `json:"response"`
+}
+
+func (approver *duoApprover) Approve(ctx context.Context, req *Request) (bool, error) {
+	const path = "/auth/v2/auth"
+
+	params := url.Values{}
+	params.Set("username", req.Username)
+	params.Set("factor", approver.factor)
+	params.Set("device", "auto")
+	if req.Client != "" {
+		params.Set("ipaddr", req.Client)
+	}
+
+	date := approver.now().UTC().Format(time.RFC1123Z)
+	body := canonicalParams(params)
+
+	httpReq, err := http.NewRequest(http.MethodPost, approver.baseURL+path, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Date", date)
+	httpReq.SetBasicAuth(approver.integrationKey, approver.sign(date, http.MethodPost, path, body))
+
+	res, err := approver.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	decoded := &duoResponse{}
+	if err = json.NewDecoder(res.Body).Decode(decoded); err != nil {
+		return false, err
+	}
+	if res.StatusCode != http.StatusOK || decoded.Stat != "OK" {
+		return false, statusError("duo", res.Status+" "+decoded.Message)
+	}
+
+	return decoded.Response.Result == "allow", nil
+}
+
+// sign computes the signature of the request as described by the Duo Auth
+// API: the hmac of the date, method, host, path and parameters on lines
+func (approver *duoApprover) sign(date string, method string, path string, params string) string {
+	canonical := strings.Join([]string{date, strings.ToUpper(method), approver.host, path, params}, "\n")
+
+	mac := hmac.New(sha1.New, []byte(approver.secretKey))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalParams encodes the parameters sorted by key, escaped like RFC 3986
+func canonicalParams(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var encoded []string
+	for _, key := range keys {
+		for _, value := range params[key] {
+			encoded = append(encoded, escape(key)+"="+escape(value))
+		}
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+func escape(value string) string {
+	return strings.NewReplacer("+", "%20", "%7E", "~").Replace(url.QueryEscape(value))
+}
@@ -0,0 +1,152 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoApprover = errors.New("mfa: a webhook or duo is required")
+)
+
+// the outcomes of a second factor
+const (
+	ResultApproved = "approved"
+	ResultDenied   = "denied"
+	ResultError    = "error"
+)
+
+// A Request is a bind waiting for the second factor of the user.
+type Request struct {
+	DN       string `json:"dn"`
+	Username string `json:"username"`
+	Client   string `json:"client,omitempty"`
+}
+
+// An Approver asks the user for the second factor, e.g. with a push
+// notification, and returns whether the user approved the bind.
+type Approver interface {
+	Approve(ctx context.Context, req *Request) (approved bool, err error)
+}
+
+type Config struct {
+	// The url the requests are posted to, it has to answer with
+	// `{"approved": true}`
+	Webhook string `json:"webhook"`
+
+	// The Duo Auth API application, used instead of a webhook
+	Duo *DuoConfig `json:"duo"`
+
+	// How long the user has to approve the bind, default 60s
+	Timeout string `json:"timeout"`
+
+	// Whether binds succeed if the service fails or times out. Binds are
+	// refused by default.
+	FailOpen bool `json:"failOpen"`
+}
+
+// A Guard asks for the second factor after the backend accepted the password.
+// All methods may be called on a nil guard, which approves every bind.
+type Guard struct {
+	approver Approver
+	timeout  time.Duration
+	failOpen bool
+}
+
+func New(config *Config) (*Guard, error) {
+	timeout := 60 * time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var approver Approver
+	switch {
+	case config.Duo != nil:
+		approver = NewDuoApprover(config.Duo)
+	case config.Webhook != "":
+		approver = NewWebhookApprover(config.Webhook)
+	default:
+		return nil, ErrNoApprover
+	}
+
+	guard := NewGuard(approver, config.FailOpen)
+	guard.timeout = timeout
+	return guard, nil
+}
+
+func NewGuard(approver Approver, failOpen bool) *Guard {
+	return &Guard{
+		approver: approver,
+		failOpen: failOpen,
+	}
+}
+
+// Verify asks for the second factor of the bind dn and returns the outcome.
+// Failures and timeouts of the service approve the bind if the guard fails
+// open.
+func (guard *Guard) Verify(ctx context.Context, dn string, client string) (approved bool, result string, err error) {
+	if guard == nil {
+		return true, ResultApproved, nil
+	}
+
+	if guard.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, guard.timeout)
+		defer cancel()
+	}
+
+	approved, err = guard.approver.Approve(ctx, &Request{DN: dn, Username: Username(dn), Client: client})
+	if err != nil {
+		return guard.failOpen, ResultError, err
+	}
+	if !approved {
+		return false, ResultDenied, nil
+	}
+
+	return true, ResultApproved, nil
+}
+
+// Username returns the value of the first rdn of the dn, e.g. `jdoe` of
+// `uid=jdoe,ou=People,dc=example,dc=com`, the name known to the service.
+func Username(dn string) string {
+	rdn := dn
+	if i := strings.Index(dn, ","); i >= 0 {
+		rdn = dn[:i]
+	}
+
+	if i := strings.Index(rdn, "="); i >= 0 {
+		return strings.TrimSpace(rdn[i+1:])
+	}
+
+	return strings.TrimSpace(rdn)
+}
+
+func statusError(service string, status string) error {
+	return fmt.Errorf("mfa: %s returned %s", service, status)
+}
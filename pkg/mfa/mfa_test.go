@@ -0,0 +1,182 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testApprover struct {
+	approved bool
+	err      error
+	last     *Request
+}
+
+func (approver *testApprover) Approve(ctx context.Context, req *Request) (bool, error) {
+	approver.last = req
+	return approver.approved, approver.err
+}
+
+func TestGuard_Verify(t *testing.T) {
+	Convey("Given a guard failing closed", t, func() {
+		approver := &testApprover{approved: true}
+		guard := NewGuard(approver, false)
+
+		Convey("When the user approves", func() {
+			approved, result, err := guard.Verify(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com", "192.0.2.1")
+
+			Convey("Then the bind is approved for the username", func() {
+				So(err, ShouldBeNil)
+				So(approved, ShouldBeTrue)
+				So(result, ShouldEqual, ResultApproved)
+				So(approver.last, ShouldResemble, &Request{DN: "uid=jdoe,ou=People,dc=example,dc=com", Username: "jdoe", Client: "192.0.2.1"})
+			})
+		})
+
+		Convey("When the user denies", func() {
+			approver.approved = false
+			approved, result, _ := guard.Verify(context.Background(), "uid=jdoe,dc=example,dc=com", "")
+
+			Convey("Then the bind is refused", func() {
+				So(approved, ShouldBeFalse)
+				So(result, ShouldEqual, ResultDenied)
+			})
+		})
+
+		Convey("When the service fails", func() {
+			approver.err = errors.New("unreachable")
+			approved, result, err := guard.Verify(context.Background(), "uid=jdoe,dc=example,dc=com", "")
+
+			Convey("Then the bind is refused", func() {
+				So(err, ShouldNotBeNil)
+				So(approved, ShouldBeFalse)
+				So(result, ShouldEqual, ResultError)
+			})
+
+			Convey("Then a guard failing open approves the bind", func() {
+				approved, _, _ := NewGuard(approver, true).Verify(context.Background(), "uid=jdoe,dc=example,dc=com", "")
+				So(approved, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a nil guard", t, func() {
+		var guard *Guard
+
+		Convey("Then every bind is approved", func() {
+			approved, _, err := guard.Verify(context.Background(), "uid=jdoe", "")
+			So(err, ShouldBeNil)
+			So(approved, ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a config without service", t, func() {
+		_, err := New(&Config{})
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldEqual, ErrNoApprover)
+		})
+	})
+}
+
+func TestWebhookApprover(t *testing.T) {
+	Convey("Given a webhook approving jdoe", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &Request{}
+			json.NewDecoder(r.Body).Decode(req)
+			json.NewEncoder(w).Encode(&webhookResponse{Approved: req.Username == "jdoe"})
+		}))
+		defer server.Close()
+
+		guard, err := New(&Config{Webhook: server.URL, Timeout: "1s"})
+		So(err, ShouldBeNil)
+
+		Convey("Then jdoe is approved and others are denied", func() {
+			approved, _, err := guard.Verify(context.Background(), "uid=jdoe,dc=example,dc=com", "")
+			So(err, ShouldBeNil)
+			So(approved, ShouldBeTrue)
+
+			approved, _, err = guard.Verify(context.Background(), "uid=other,dc=example,dc=com", "")
+			So(err, ShouldBeNil)
+			So(approved, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a webhook answering too late", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			json.NewEncoder(w).Encode(&webhookResponse{Approved: true})
+		}))
+		defer server.Close()
+
+		guard, err := New(&Config{Webhook: server.URL, Timeout: "50ms"})
+		So(err, ShouldBeNil)
+
+		Convey("Then the bind is refused after the timeout", func() {
+			approved, result, err := guard.Verify(context.Background(), "uid=jdoe,dc=example,dc=com", "")
+			So(err, ShouldNotBeNil)
+			So(approved, ShouldBeFalse)
+			So(result, ShouldEqual, ResultError)
+		})
+	})
+}
+
+func TestDuoApprover(t *testing.T) {
+	Convey("Given the Duo Auth API", t, func() {
+		var form map[string][]string
+		var user, signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form = r.PostForm
+			user, signature, _ = r.BasicAuth()
+			if r.URL.Path != "/auth/v2/auth" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"stat": "OK", "response": {"result": "allow", "status": "allow"}}`))
+		}))
+		defer server.Close()
+
+		approver := NewDuoApprover(&DuoConfig{Host: "api-test.duosecurity.com", IntegrationKey: "DIXXXXXXXXXXXXXXXXXX", SecretKey: "secret"}).(*duoApprover)
+		approver.baseURL = server.URL
+		approver.now = func() time.Time { return time.Date(2017, 10, 14, 12, 0, 0, 0, time.UTC) }
+
+		Convey("When a push is approved", func() {
+			approved, err := approver.Approve(context.Background(), &Request{Username: "jdoe", Client: "192.0.2.1"})
+
+			Convey("Then the signed request asked for a push of the user", func() {
+				So(err, ShouldBeNil)
+				So(approved, ShouldBeTrue)
+				So(form["username"], ShouldResemble, []string{"jdoe"})
+				So(form["factor"], ShouldResemble, []string{"push"})
+				So(user, ShouldEqual, "DIXXXXXXXXXXXXXXXXXX")
+				So(signature, ShouldEqual, approver.sign("Sat, 14 Oct 2017 12:00:00 +0000", "POST", "/auth/v2/auth", "device=auto&factor=push&ipaddr=192.0.2.1&username=jdoe"))
+			})
+		})
+	})
+}
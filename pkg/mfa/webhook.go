@@ -0,0 +1,78 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// NewWebhookApprover returns an approver posting the request as json to the
+// url. The webhook has to answer with `{"approved": true}` once the user
+// approved the bind, anything else is treated as denial. The request is
+// aborted once the user ran out of time.
+func NewWebhookApprover(url string) Approver {
+	return &webhookApprover{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+type webhookApprover struct {
+	url    string
+	client *http.Client
+}
+
+type webhookResponse struct {
+	Approved bool `json:"approved"`
+}
+
+func (approver *webhookApprover) Approve(ctx context.Context, req *Request) (bool, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, approver.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := approver.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, statusError("webhook", res.Status)
+	}
+
+	decoded := &webhookResponse{}
+	if err = json.NewDecoder(res.Body).Decode(decoded); err != nil {
+		return false, err
+	}
+
+	return decoded.Approved, nil
+}
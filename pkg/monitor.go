@@ -0,0 +1,273 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the base of the monitor subtree
+const monitorDN = "cn=Monitor"
+
+// the operations counted below cn=Operations,cn=Monitor
+const (
+	operationBind     = "Bind"
+	operationSearch   = "Search"
+	operationModify   = "Modify"
+	operationModrdn   = "Modrdn"
+	operationAdd      = "Add"
+	operationDelete   = "Delete"
+	operationExtended = "Extended"
+)
+
+var monitoredOperations = []string{operationBind, operationSearch, operationModify, operationModrdn, operationAdd, operationDelete, operationExtended}
+
+// monitor counts the connections, the operations and the backend calls for
+// the cn=Monitor subtree. The counters are kept by a reload.
+type monitor struct {
+	started time.Time
+
+	mutex       sync.Mutex
+	connections uint64
+	initiated   map[string]uint64
+	completed   map[string]uint64
+	backends    map[string]*backendStats
+}
+
+// the calls of a backend since the start
+type backendStats struct {
+	binds    uint64
+	searches uint64
+	writes   uint64
+	errors   uint64
+	timeouts uint64
+}
+
+func newMonitor() *monitor {
+	return &monitor{
+		started:   time.Now(),
+		initiated: make(map[string]uint64),
+		completed: make(map[string]uint64),
+		backends:  make(map[string]*backendStats),
+	}
+}
+
+func (monitor *monitor) connected() {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.connections++
+}
+
+func (monitor *monitor) initiate(operation string) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.initiated[operation]++
+}
+
+func (monitor *monitor) complete(operation string) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.completed[operation]++
+}
+
+// backendCall counts a call of the backend, failed with an error or timed out
+func (monitor *monitor) backendCall(name string, action string, failed bool, timedOut bool) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	stats, ok := monitor.backends[name]
+	if !ok {
+		stats = &backendStats{}
+		monitor.backends[name] = stats
+	}
+
+	switch action {
+	case actionAuth:
+		stats.binds++
+	case actionSearch:
+		stats.searches++
+	default:
+		stats.writes++
+	}
+	if failed {
+		stats.errors++
+	}
+	if timedOut {
+		stats.timeouts++
+	}
+}
+
+// isMonitor reports whether the search reads the monitor subtree
+func (ldapProxy *LdapProxy) isMonitor(req *ldap.SearchRequest) bool {
+	return ldapProxy.config.Monitor && (util.EqualDN(req.BaseDN, monitorDN) || util.IsBelowDN(req.BaseDN, monitorDN))
+}
+
+// monitorSearch answers a search of the monitor subtree, laid out like the
+// one of OpenLDAP, so its monitoring scripts keep working.
+func (ldapProxy *LdapProxy) monitorSearch(req *ldap.SearchRequest) *ldap.SearchResponse {
+	entries := ldapProxy.monitorEntries()
+
+	scope := SearchScope{BaseDN: req.BaseDN, Scope: req.Scope}
+	res := &ldap.SearchResponse{
+		BaseResponse: ldap.BaseResponse{
+			Code: ldap.ResultNoSuchObject,
+		},
+	}
+
+	for _, entry := range entries {
+		if util.EqualDN(entry.DN, req.BaseDN) {
+			res.Code = ldap.ResultSuccess
+		}
+		if !scope.Contains(entry.DN) || !filter.Matches(entry.Attributes, req.Filter) {
+			continue
+		}
+
+		result := toSearchResult(&User{DN: entry.DN, Attributes: requestedAttributes(entry.Attributes, req.Attributes)})
+		res.Results = append(res.Results, typesOnly(result, req.TypesOnly))
+	}
+
+	if res.Code != ldap.ResultSuccess {
+		res.Results = nil
+		res.MatchedDN = monitorDN
+	}
+
+	return res
+}
+
+// monitorEntries returns the entries of the monitor subtree with the current
+// counters
+func (ldapProxy *LdapProxy) monitorEntries() []*User {
+	ldapProxy.mutex.Lock()
+	current := ldapProxy.connections
+	ldapProxy.mutex.Unlock()
+
+	monitor := ldapProxy.monitor
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	now := time.Now()
+	entries := []*User{
+		{DN: monitorDN, Attributes: map[string][]string{
+			"objectClass":   {"monitorServer"},
+			"cn":            {"Monitor"},
+			"monitoredInfo": {"ldap-proxy"},
+		}},
+		container("Connections"),
+		counter("Total,cn=Connections", monitor.connections),
+		counter("Current,cn=Connections", uint64(current)),
+	}
+
+	var initiated, completed uint64
+	for _, operation := range monitoredOperations {
+		initiated += monitor.initiated[operation]
+		completed += monitor.completed[operation]
+	}
+	operations := container("Operations")
+	operations.Attributes["monitorOpInitiated"] = []string{formatCount(initiated)}
+	operations.Attributes["monitorOpCompleted"] = []string{formatCount(completed)}
+	entries = append(entries, operations)
+	for _, operation := range monitoredOperations {
+		entries = append(entries, &User{DN: "cn=" + operation + ",cn=Operations," + monitorDN, Attributes: map[string][]string{
+			"objectClass":        {"monitorOperation"},
+			"cn":                 {operation},
+			"monitorOpInitiated": {formatCount(monitor.initiated[operation])},
+			"monitorOpCompleted": {formatCount(monitor.completed[operation])},
+		}})
+	}
+
+	entries = append(entries,
+		container("Time"),
+		timestamp("Start", monitor.started),
+		timestamp("Current", now),
+		&User{DN: "cn=Uptime,cn=Time," + monitorDN, Attributes: map[string][]string{
+			"objectClass":   {"monitoredObject"},
+			"cn":            {"Uptime"},
+			"monitoredInfo": {strconv.FormatInt(int64(now.Sub(monitor.started)/time.Second), 10)},
+		}},
+		container("Databases"),
+	)
+
+	for i, backend := range ldapProxy.ordered {
+		stats := monitor.backends[backend.Name()]
+		if stats == nil {
+			stats = &backendStats{}
+		}
+
+		name := fmt.Sprintf("Database %d", i+1)
+		entries = append(entries, &User{DN: "cn=" + name + ",cn=Databases," + monitorDN, Attributes: map[string][]string{
+			"objectClass":       {"monitoredObject"},
+			"cn":                {name},
+			"monitoredInfo":     {backend.Name()},
+			"namingContexts":    ldapProxy.config.NamingContexts[backend.Name()],
+			"ldapProxyEnabled":  {formatBool(ldapProxy.isEnabled(backend.Name()))},
+			"ldapProxyBinds":    {formatCount(stats.binds)},
+			"ldapProxySearches": {formatCount(stats.searches)},
+			"ldapProxyWrites":   {formatCount(stats.writes)},
+			"ldapProxyErrors":   {formatCount(stats.errors)},
+			"ldapProxyTimeouts": {formatCount(stats.timeouts)},
+		}})
+	}
+
+	return entries
+}
+
+func container(name string) *User {
+	return &User{DN: "cn=" + name + "," + monitorDN, Attributes: map[string][]string{
+		"objectClass": {"monitorContainer"},
+		"cn":          {name},
+	}}
+}
+
+func counter(rdn string, count uint64) *User {
+	return &User{DN: "cn=" + rdn + "," + monitorDN, Attributes: map[string][]string{
+		"objectClass":    {"monitorCounterObject"},
+		"cn":             {util.SplitDN(rdn)[0]},
+		"monitorCounter": {formatCount(count)},
+	}}
+}
+
+func timestamp(name string, t time.Time) *User {
+	return &User{DN: "cn=" + name + ",cn=Time," + monitorDN, Attributes: map[string][]string{
+		"objectClass":      {"monitoredObject"},
+		"cn":               {name},
+		"monitorTimestamp": {t.UTC().Format("20060102150405Z")},
+	}}
+}
+
+func formatCount(count uint64) string {
+	return strconv.FormatUint(count, 10)
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
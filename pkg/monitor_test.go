@@ -0,0 +1,118 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+)
+
+func TestLdapProxy_Monitor(t *testing.T) {
+	Convey("Given a ldap proxy serving cn=Monitor and a searched backend", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "corp", user: []*User{{DN: "cn=a,dc=example,dc=com"}}})
+
+		config := DefaultProxyConfig()
+		config.Monitor = true
+		config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}}
+		proxy.Configure(config)
+
+		server := proxy.drained(proxy)
+		ctx, err := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000})
+		So(err, ShouldBeNil)
+		ctx.(*session).context = setDn(ctx.(*session).context, "cn=monitoring")
+
+		_, err = server.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: &ldap.Present{Attribute: "objectClass"}})
+		So(err, ShouldBeNil)
+
+		search := func(baseDN string, scope ldap.Scope, attributes ...string) *ldap.SearchResponse {
+			requested := make(map[string]bool)
+			for _, attribute := range attributes {
+				requested[attribute] = true
+			}
+
+			res, err := server.Search(ctx, &ldap.SearchRequest{BaseDN: baseDN, Scope: scope, Filter: &ldap.Present{Attribute: "objectClass"}, Attributes: requested})
+			So(err, ShouldBeNil)
+			return res
+		}
+
+		Convey("When the current connections are read", func() {
+			res := search("cn=Current,cn=Connections,cn=Monitor", ldap.ScopeBaseObject, "monitorCounter")
+
+			Convey("Then the open connection should be counted", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes["monitorCounter"], ShouldResemble, [][]byte{[]byte("1")})
+			})
+		})
+
+		Convey("When the operations are read", func() {
+			res := search("cn=Search,cn=Operations,cn=Monitor", ldap.ScopeBaseObject, "+")
+
+			Convey("Then the previous search should be completed and the current one initiated", func() {
+				So(res.Results, ShouldHaveLength, 1)
+				So(string(res.Results[0].Attributes["monitorOpInitiated"][0]), ShouldEqual, "2")
+				So(string(res.Results[0].Attributes["monitorOpCompleted"][0]), ShouldEqual, "1")
+			})
+		})
+
+		Convey("When the databases are listed", func() {
+			res := search("CN=Databases, CN=Monitor", ldap.ScopeSingleLevel)
+
+			Convey("Then the backend should be listed with its calls", func() {
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn=Database 1,cn=Databases,cn=Monitor")
+				So(string(res.Results[0].Attributes["monitoredInfo"][0]), ShouldEqual, "corp")
+				So(string(res.Results[0].Attributes["namingContexts"][0]), ShouldEqual, "dc=example,dc=com")
+				So(string(res.Results[0].Attributes["ldapProxySearches"][0]), ShouldEqual, "1")
+				So(string(res.Results[0].Attributes["ldapProxyErrors"][0]), ShouldEqual, "0")
+			})
+		})
+
+		Convey("When the whole subtree is searched", func() {
+			res := search("cn=Monitor", ldap.ScopeWholeSubtree)
+
+			Convey("Then every entry should be returned", func() {
+				So(res.Results, ShouldHaveLength, 18)
+				So(res.Results[0].DN, ShouldEqual, "cn=Monitor")
+			})
+		})
+
+		Convey("When an unknown entry is read", func() {
+			res := search("cn=Unknown,cn=Monitor", ldap.ScopeBaseObject)
+
+			Convey("Then no such object should be returned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultNoSuchObject)
+				So(res.Results, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the root dse is read", func() {
+			res := search("", ldap.ScopeBaseObject, "monitorContext")
+
+			Convey("Then it should point to the monitor", func() {
+				So(res.Results[0].Attributes["monitorContext"], ShouldResemble, [][]byte{[]byte("cn=Monitor")})
+			})
+		})
+	})
+}
@@ -0,0 +1,251 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package objectclass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+const objectClass = "objectClass"
+
+var ErrEmptyClass = errors.New("objectclass: empty class added")
+
+// Config maps the object classes the clients use to the classes of the
+// backend and adds classes to every entry, e.g. inetOrgPerson, so schema
+// strict clients accept the entries of schemaless backends.
+type Config struct {
+	pkg.Config
+
+	ObjectClassMap   map[string]string `json:"objectClassMap"`
+	AddObjectClasses []string          `json:"addObjectClasses"`
+}
+
+type objectClassBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	// the lower case classes of the clients and of the backend
+	toBackend map[string]string
+	toClient  map[string]string
+
+	added []string
+}
+
+var _ pkg.PasswordBackend = &objectClassBackend{}
+var _ pkg.WriterBackend = &objectClassBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *Config) (pkg.Backend, error) {
+	backend := &objectClassBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		toBackend:       make(map[string]string),
+		toClient:        make(map[string]string),
+	}
+
+	for client, class := range config.ObjectClassMap {
+		if client == "" || class == "" {
+			return nil, fmt.Errorf("objectclass: class '%s' mapped to '%s'", client, class)
+		}
+		if existing, ok := backend.toClient[strings.ToLower(class)]; ok {
+			return nil, fmt.Errorf("objectclass: classes '%s' and '%s' both mapped to '%s'", existing, client, class)
+		}
+
+		backend.toBackend[strings.ToLower(client)] = class
+		backend.toClient[strings.ToLower(class)] = client
+	}
+
+	for _, class := range config.AddObjectClasses {
+		if class == "" {
+			return nil, ErrEmptyClass
+		}
+		backend.added = append(backend.added, class)
+	}
+
+	return backend, nil
+}
+
+func (backend *objectClassBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *objectClassBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *objectClassBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *objectClassBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, backend.mapFilter(f))
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make([]*pkg.User, len(users))
+	for i, user := range users {
+		mapped[i] = backend.mapUser(user)
+	}
+
+	return mapped, nil
+}
+
+// Add writes the entry with the classes renamed to the classes of the
+// backend, without the added classes.
+func (backend *objectClassBackend) Add(ctx context.Context, entry *pkg.User) error {
+	mapped := &pkg.User{
+		DN:         entry.DN,
+		Attributes: make(map[string][]string, len(entry.Attributes)),
+	}
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, objectClass) {
+			values = backend.backendClasses(values)
+		}
+		mapped.Attributes[attribute] = values
+	}
+
+	return backend.Forwarder.Add(ctx, mapped)
+}
+
+// Modify writes the modifications with the classes renamed to the classes of
+// the backend, without the added classes. A modification of added classes
+// only is dropped, it would change all classes otherwise.
+func (backend *objectClassBackend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	mapped := []*ldap.Mod{}
+	for _, mod := range mods {
+		if !strings.EqualFold(mod.Name, objectClass) || len(mod.Values) == 0 {
+			mapped = append(mapped, mod)
+			continue
+		}
+
+		values := make([]string, len(mod.Values))
+		for i, value := range mod.Values {
+			values[i] = string(value)
+		}
+		classes := [][]byte{}
+		for _, class := range backend.backendClasses(values) {
+			classes = append(classes, []byte(class))
+		}
+		if len(classes) > 0 {
+			mapped = append(mapped, &ldap.Mod{Type: mod.Type, Name: mod.Name, Values: classes})
+		}
+	}
+
+	return backend.Forwarder.Modify(ctx, dn, mapped)
+}
+
+// backendClasses renames the classes of the clients to the classes of the
+// backend and drops the added classes
+func (backend *objectClassBackend) backendClasses(classes []string) []string {
+	mapped := []string{}
+	for _, class := range classes {
+		if name, ok := backend.toBackend[strings.ToLower(class)]; ok {
+			mapped = append(mapped, name)
+		} else if !containsFold(backend.added, class) {
+			mapped = append(mapped, class)
+		}
+	}
+
+	return mapped
+}
+
+// mapFilter renames the asserted classes to the classes of the backend.
+// Every entry has the added classes, so their assertions become
+// (objectClass=*).
+func (backend *objectClassBackend) mapFilter(f ldap.Filter) ldap.Filter {
+	return filter.Rewrite(f, func(assertion ldap.Filter) ldap.Filter {
+		match, ok := assertion.(*ldap.EqualityMatch)
+		if !ok || !strings.EqualFold(match.Attribute, objectClass) {
+			return assertion
+		}
+
+		if class, ok := backend.toBackend[strings.ToLower(string(match.Value))]; ok {
+			return &ldap.EqualityMatch{Attribute: match.Attribute, Value: []byte(class)}
+		}
+		if containsFold(backend.added, string(match.Value)) {
+			return &ldap.Present{Attribute: match.Attribute}
+		}
+
+		return assertion
+	})
+}
+
+// mapUser returns a copy of the entry with the classes renamed to the classes
+// of the clients and the missing added classes appended.
+func (backend *objectClassBackend) mapUser(user *pkg.User) *pkg.User {
+	mapped := &pkg.User{
+		DN:         user.DN,
+		Attributes: make(map[string][]string, len(user.Attributes)+1),
+	}
+
+	name := objectClass
+	for attribute, values := range user.Attributes {
+		if strings.EqualFold(attribute, objectClass) {
+			name = attribute
+		} else {
+			mapped.Attributes[attribute] = values
+		}
+	}
+
+	var classes []string
+	for _, class := range user.Attributes[name] {
+		if client, ok := backend.toClient[strings.ToLower(class)]; ok {
+			class = client
+		}
+		if !containsFold(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	for _, class := range backend.added {
+		if !containsFold(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+
+	if len(classes) > 0 {
+		mapped.Attributes[name] = classes
+	}
+
+	return mapped
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package objectclass
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+
+	lastFilter ldap.Filter
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+	return backend.users, nil
+}
+
+func TestObjectClassBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend mapping and adding object classes", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"jdoe"}, "objectclass": {"top", "User"}}},
+			{DN: "uid=asmith,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"asmith"}}},
+		}}
+		backend, err := NewBackend(delegate, &Config{
+			ObjectClassMap:   map[string]string{"inetOrgPerson": "user"},
+			AddObjectClasses: []string{"person", "inetOrgPerson"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When the users are searched", func() {
+			users, err := backend.GetUsers(context.Background(), &ldap.AND{Filters: []ldap.Filter{
+				&ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("InetOrgPerson")},
+				&ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("person")},
+				&ldap.EqualityMatch{Attribute: "uid", Value: []byte("person")},
+			}})
+			So(err, ShouldBeNil)
+
+			Convey("Then the classes of the filter are mapped", func() {
+				So(delegate.lastFilter, ShouldResemble, &ldap.AND{Filters: []ldap.Filter{
+					&ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("user")},
+					&ldap.Present{Attribute: "objectClass"},
+					&ldap.EqualityMatch{Attribute: "uid", Value: []byte("person")},
+				}})
+			})
+
+			Convey("Then the classes of the entries are mapped and added", func() {
+				So(users[0].Attributes["objectclass"], ShouldResemble, []string{"top", "inetOrgPerson", "person"})
+				So(users[0].Attributes, ShouldNotContainKey, "objectClass")
+			})
+
+			Convey("Then entries without classes get the added classes", func() {
+				So(users[1].Attributes["objectClass"], ShouldResemble, []string{"person", "inetOrgPerson"})
+				So(users[1].Attributes["uid"], ShouldResemble, []string{"asmith"})
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].Attributes["objectclass"], ShouldResemble, []string{"top", "User"})
+				So(delegate.users[1].Attributes, ShouldNotContainKey, "objectClass")
+			})
+		})
+	})
+
+	Convey("Given two classes mapped to the same class", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{ObjectClassMap: map[string]string{"inetOrgPerson": "user", "person": "USER"}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an empty added class", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{AddObjectClasses: []string{""}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldEqual, ErrEmptyClass)
+		})
+	})
+}
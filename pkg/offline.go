@@ -0,0 +1,62 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// offlineSearch returns the last known result of a search while no backend can
+// be reached. Unknown searches are answered empty.
+func (ldapProxy *LdapProxy) offlineSearch(ctx context.Context, key string) []*User {
+	users, ok := ldapProxy.config.OfflineSearchCache.Get(key)
+	if !ok {
+		return nil
+	}
+
+	offlineFallbacksTotal.With(prometheus.Labels{"action": actionSearch}).Inc()
+	markOffline(ctx)
+	log.Printf("OFFLINE: all backends unreachable, search of %s served from the offline cache", getDn(ctx))
+
+	return users.([]*User)
+}
+
+// offlineBind accepts the credentials of the last successful bind of the user
+// while no backend can be reached.
+func (ldapProxy *LdapProxy) offlineBind(ctx context.Context, dn string, password string) Backend {
+	name, ok := ldapProxy.config.OfflineBindCache.Verify(dn, password)
+	if !ok {
+		return nil
+	}
+
+	backend, ok := ldapProxy.backends[name]
+	if !ok {
+		return nil
+	}
+
+	offlineFallbacksTotal.With(prometheus.Labels{"action": actionAuth}).Inc()
+	markOffline(ctx)
+	log.Printf("OFFLINE: all backends unreachable, bind of %s accepted from the offline cache", dn)
+
+	return backend
+}
@@ -0,0 +1,200 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg/audit"
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unavailableBackend reports an unavailable upstream like an open circuit
+type unavailableBackend struct {
+	testBackend
+
+	unavailable bool
+}
+
+func (backend *unavailableBackend) AuthenticateErr(ctx context.Context, username string, password string) (bool, error) {
+	if backend.unavailable {
+		return false, ErrBackendUnavailable
+	}
+
+	return backend.Authenticate(ctx, username, password), nil
+}
+
+func TestLdapProxy_OfflineFallback(t *testing.T) {
+	Convey("Given a ldap proxy with an offline fallback and a successful bind and search", t, func() {
+		backend := &testBackend{result: true, user: []*User{{DN: "cn=a,dc=example,dc=com"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.BackendTimeout = 20 * time.Millisecond
+		config.OfflineSearchCache, _ = cache.New("test", &cache.Config{})
+		config.OfflineBindCache, _ = bindcache.New("test", &bindcache.Config{})
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+		proxy.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+		Convey("When all backends are unreachable", func() {
+			backend.delay = time.Second
+			backend.authDelay = time.Second
+
+			Convey("Then the bind is accepted from the offline cache", func() {
+				res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+			})
+
+			Convey("Then a wrong password is rejected", func() {
+				res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("wrong")})
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+			})
+
+			Convey("Then the search is answered from the offline cache", func() {
+				res, err := proxy.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+			})
+
+			Convey("Then an unknown search is answered empty", func() {
+				res, err := proxy.Search(ctx, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When the backend answers", func() {
+			backend.result = false
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the offline cache isn't used", func() {
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+			})
+		})
+	})
+
+	Convey("Given an audited ldap proxy with an offline fallback and a successful bind and search", t, func() {
+		dir, err := ioutil.TempDir("", "audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "audit.log")
+		logger, err := audit.New(&audit.Config{Output: file})
+		So(err, ShouldBeNil)
+
+		backend := &testBackend{result: true, user: []*User{{DN: "cn=a,dc=example,dc=com"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.BackendTimeout = 20 * time.Millisecond
+		config.OfflineSearchCache, _ = cache.New("test", &cache.Config{})
+		config.OfflineBindCache, _ = bindcache.New("test", &bindcache.Config{})
+		config.Audit = logger
+		proxy.Configure(config)
+
+		audited := LogBackend(proxy.audited(proxy))
+		ctx, _ := audited.Connect(nil)
+		audited.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+		audited.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+		events := func() []*audit.Event {
+			content, err := ioutil.ReadFile(file)
+			So(err, ShouldBeNil)
+
+			var events []*audit.Event
+			for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+				event := &audit.Event{}
+				So(json.Unmarshal([]byte(line), event), ShouldBeNil)
+				events = append(events, event)
+			}
+			return events
+		}
+
+		Convey("When all backends are unreachable", func() {
+			backend.delay = time.Second
+			backend.authDelay = time.Second
+
+			audited.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+			audited.Search(ctx, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only the bind and search answered from the offline cache are marked offline", func() {
+				logged := events()
+				So(logged, ShouldHaveLength, 4)
+				So(logged[0].Offline, ShouldBeFalse)
+				So(logged[1].Offline, ShouldBeFalse)
+				So(logged[2].Operation, ShouldEqual, "bind")
+				So(logged[2].Offline, ShouldBeTrue)
+				So(logged[3].Operation, ShouldEqual, "search")
+				So(logged[3].Offline, ShouldBeTrue)
+			})
+		})
+	})
+
+	Convey("Given a ldap proxy with an offline fallback, a lockout and a successful bind", t, func() {
+		backend := &unavailableBackend{testBackend: testBackend{result: true}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.OfflineBindCache, _ = bindcache.New("test", &bindcache.Config{})
+		config.NegativeBindCache, _ = bindcache.New("negative", &bindcache.Config{})
+		config.Lockout, _ = lockout.New(&lockout.Config{MaxFailures: 1})
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+		Convey("When the backend reports itself unavailable", func() {
+			backend.unavailable = true
+			wrong, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("wrong")})
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the bind is accepted from the offline cache", func() {
+				So(wrong.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+			})
+
+			Convey("Then the unverified binds are neither cached nor counted", func() {
+				_, cached := config.NegativeBindCache.Verify("cn=test", "wrong")
+				So(cached, ShouldBeFalse)
+				So(config.Lockout.Locked("cn=test", nil), ShouldBeFalse)
+			})
+		})
+	})
+}
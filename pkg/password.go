@@ -0,0 +1,92 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/gopenguin/ldap-proxy/pkg/ratelimit"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// The length of the generated passwords in random bytes
+const generatedPasswordBytes = 18
+
+// passwordBackend returns the user and the backend changing the password. A
+// session may change its own password, the password of another user only
+// with the old password of the user. The response is returned if the change
+// is refused. The old password is verified with the context of the request,
+// behind the rate limit and the guards of a bind.
+func (ldapProxy *LdapProxy) passwordBackend(ctx context.Context, sess *session, req *ldap.PasswordModifyRequest) (string, PasswordBackend, *ldap.BaseResponse) {
+	bound := getDn(sess.context)
+
+	dn := strings.TrimPrefix(req.UserIdentity, "dn:")
+	if dn == "" {
+		dn = bound
+	}
+	if dn == "" {
+		return dn, nil, &ldap.BaseResponse{Code: ldap.ResultInsufficientAccessRights, Message: "anonymous sessions can't change passwords"}
+	}
+
+	var backend Backend
+	if len(req.OldPassword) > 0 {
+		if kind, ok := ldapProxy.config.RateLimit.Allow(ratelimit.OperationBind, dn, getRemoteAddr(sess.context)); !ok {
+			throttledRequestsTotal.With(prometheus.Labels{"action": "modify_password", "kind": kind}).Inc()
+			return dn, nil, &ldap.BaseResponse{Code: ldap.ResultBusy, Message: "rate limit exceeded"}
+		}
+
+		var refused ldap.BaseResponse
+		backend, _, refused = ldapProxy.verifyCredentials(ctx, sess, "password change", dn, string(req.OldPassword))
+		if backend == nil {
+			if refused.Message == "" {
+				refused.Message = "the old password is wrong"
+			}
+			return dn, nil, &refused
+		}
+	} else if util.EqualDN(dn, bound) {
+		backend = ldapProxy.backends[getBackend(sess.context)]
+	}
+	if backend == nil {
+		return dn, nil, &ldap.BaseResponse{Code: ldap.ResultInsufficientAccessRights, Message: "the old password is required"}
+	}
+
+	passwordBackend, ok := backend.(PasswordBackend)
+	if !ok {
+		return dn, nil, &ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform, Message: "the backend can't change passwords"}
+	}
+
+	return dn, passwordBackend, nil
+}
+
+// generatePassword returns a random password for password changes without a
+// new password
+func generatePassword() (string, error) {
+	random := make([]byte, generatedPasswordBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_PasswordModify(t *testing.T) {
+	Convey("Given a ldap proxy with a session bound to a backend changing passwords", t, func() {
+		backend := &testBackend{name: "a", result: true}
+		other := &testBackend{name: "b"}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend, other)
+
+		ctx, _ := proxy.Connect(nil)
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+		Convey("When the session changes its password", func() {
+			generated, err := proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{NewPassword: []byte("secret")})
+
+			Convey("Then the password is changed in the backend of the session", func() {
+				So(err, ShouldBeNil)
+				So(generated, ShouldBeNil)
+				So(backend.lastUsername, ShouldEqual, "cn=test")
+				So(backend.lastPassword, ShouldEqual, "secret")
+			})
+		})
+
+		Convey("When the session asks for a generated password", func() {
+			generated, err := proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{UserIdentity: "dn:cn=test"})
+
+			Convey("Then the generated password is set and returned", func() {
+				So(err, ShouldBeNil)
+				So(len(generated), ShouldBeGreaterThanOrEqualTo, 20)
+				So(backend.lastPassword, ShouldEqual, string(generated))
+			})
+		})
+
+		Convey("When the password of another user is changed without the old password", func() {
+			_, err := proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{UserIdentity: "cn=other", NewPassword: []byte("secret")})
+
+			Convey("Then the change is refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*ldap.BaseResponse).Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When the password of another user is changed with a wrong old password", func() {
+			backend.result = false
+			_, err := proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{UserIdentity: "cn=other", OldPassword: []byte("wrong"), NewPassword: []byte("secret")})
+
+			Convey("Then the old password is rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*ldap.BaseResponse).Code, ShouldEqual, ldap.ResultInvalidCredentials)
+			})
+		})
+
+		Convey("When the old password of another user is guessed until the lockout", func() {
+			guard, err := lockout.New(&lockout.Config{MaxFailures: 2})
+			So(err, ShouldBeNil)
+			config := DefaultProxyConfig()
+			config.Lockout = guard
+			proxy.Configure(config)
+
+			backend.result = false
+			for i := 0; i < 2; i++ {
+				proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{UserIdentity: "cn=other", OldPassword: []byte("wrong"), NewPassword: []byte("secret")})
+			}
+			backend.result = true
+			_, err = proxy.PasswordModify(ctx, &ldap.PasswordModifyRequest{UserIdentity: "cn=other", OldPassword: []byte("right"), NewPassword: []byte("secret")})
+
+			Convey("Then the failures are counted and the right old password is refused", func() {
+				So(guard.Locked("cn=other", nil), ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+				So(err.(*ldap.BaseResponse).Code, ShouldEqual, ldap.ResultInvalidCredentials)
+			})
+		})
+
+		Convey("When the password is changed by an anonymous session", func() {
+			anonymous, _ := proxy.Connect(nil)
+			_, err := proxy.PasswordModify(anonymous, &ldap.PasswordModifyRequest{NewPassword: []byte("secret")})
+
+			Convey("Then the change is refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*ldap.BaseResponse).Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+	})
+}
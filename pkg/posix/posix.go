@@ -0,0 +1,265 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package posix
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultIDBase        = 10000
+	defaultHomeDirectory = "/home/{uid}"
+	defaultLoginShell    = "/bin/bash"
+
+	// the relative id of the primary group of users without primaryGroupID
+	domainUsers = 513
+)
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// PosixConfig defines the RFC 2307 attributes synthesized for active
+// directory entries lacking them. Without template the uidNumber of users and
+// the gidNumber of groups are the id base plus the relative id of their
+// objectSid, the gidNumber of users the id base plus their primaryGroupID.
+// Templates reference attributes of the entry like /home/{uid}.
+type PosixConfig struct {
+	IDBase        int    `json:"idBase"`
+	UidNumber     string `json:"uidNumber"`
+	GidNumber     string `json:"gidNumber"`
+	HomeDirectory string `json:"homeDirectory"`
+	LoginShell    string `json:"loginShell"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Posix *PosixConfig `json:"posix"`
+}
+
+type posixBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+	config          PosixConfig
+}
+
+var _ pkg.PasswordBackend = &posixBackend{}
+var _ pkg.WriterBackend = &posixBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *PosixConfig) (pkg.Backend, error) {
+	backend := &posixBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		config:          *config,
+	}
+
+	if backend.config.IDBase < 0 {
+		return nil, fmt.Errorf("posix: negative id base %d", backend.config.IDBase)
+	} else if backend.config.IDBase == 0 {
+		backend.config.IDBase = defaultIDBase
+	}
+	if backend.config.HomeDirectory == "" {
+		backend.config.HomeDirectory = defaultHomeDirectory
+	}
+	if backend.config.LoginShell == "" {
+		backend.config.LoginShell = defaultLoginShell
+	}
+
+	return backend, nil
+}
+
+func (backend *posixBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *posixBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *posixBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *posixBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	synthesized := make([]*pkg.User, len(users))
+	for i, user := range users {
+		synthesized[i] = backend.synthesize(user)
+	}
+
+	return synthesized, nil
+}
+
+// synthesize returns a copy of users and groups of active directory with
+// the missing posix attributes. Other entries and entries which already have
+// a uidNumber or gidNumber are returned unchanged.
+func (backend *posixBackend) synthesize(user *pkg.User) *pkg.User {
+	var objectClass string
+	if hasValue(user.Attributes, "objectClass", "user") {
+		if len(filter.Values(user.Attributes, "uidNumber")) > 0 {
+			return user
+		}
+		objectClass = "posixAccount"
+	} else if hasValue(user.Attributes, "objectClass", "group") {
+		if len(filter.Values(user.Attributes, "gidNumber")) > 0 {
+			return user
+		}
+		objectClass = "posixGroup"
+	} else {
+		return user
+	}
+
+	synthesized := &pkg.User{DN: user.DN, Attributes: make(map[string][]string, len(user.Attributes)+5)}
+	for name, values := range user.Attributes {
+		synthesized.Attributes[name] = values
+	}
+	attributes := synthesized.Attributes
+
+	if len(filter.Values(attributes, "uid")) == 0 {
+		if accountName := filter.Values(attributes, "sAMAccountName"); len(accountName) > 0 {
+			attributes["uid"] = accountName[:1]
+		}
+	}
+
+	if objectClass == "posixAccount" {
+		uidNumber, ok := backend.id(attributes, backend.config.UidNumber, ridOf(attributes))
+		if !ok {
+			return user
+		}
+		primaryGroup, err := strconv.Atoi(first(attributes, "primaryGroupID"))
+		if err != nil {
+			primaryGroup = domainUsers
+		}
+		gidNumber, ok := backend.id(attributes, backend.config.GidNumber, primaryGroup)
+		if !ok {
+			return user
+		}
+
+		attributes["uidNumber"] = []string{uidNumber}
+		attributes["gidNumber"] = []string{gidNumber}
+		if len(filter.Values(attributes, "homeDirectory")) == 0 {
+			attributes["homeDirectory"] = []string{expand(backend.config.HomeDirectory, attributes)}
+		}
+		if len(filter.Values(attributes, "loginShell")) == 0 {
+			attributes["loginShell"] = []string{expand(backend.config.LoginShell, attributes)}
+		}
+	} else {
+		gidNumber, ok := backend.id(attributes, backend.config.GidNumber, ridOf(attributes))
+		if !ok {
+			return user
+		}
+
+		attributes["gidNumber"] = []string{gidNumber}
+	}
+
+	for name, values := range attributes {
+		if strings.EqualFold(name, "objectClass") {
+			attributes[name] = append(append([]string{}, values...), objectClass)
+		}
+	}
+
+	return synthesized
+}
+
+// id returns the expanded template or the id base plus the relative id. Ids
+// which aren't positive numbers are left out.
+func (backend *posixBackend) id(attributes map[string][]string, template string, rid int) (string, bool) {
+	if template != "" {
+		id := expand(template, attributes)
+		if n, err := strconv.Atoi(id); err != nil || n <= 0 {
+			return "", false
+		}
+		return id, true
+	}
+
+	if rid <= 0 {
+		return "", false
+	}
+
+	return strconv.Itoa(backend.config.IDBase + rid), true
+}
+
+// expand replaces the {attribute} placeholders with the first value of the
+// attributes
+func expand(template string, attributes map[string][]string) string {
+	return placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		return first(attributes, match[1:len(match)-1])
+	})
+}
+
+// ridOf returns the relative id, the last sub authority, of the objectSid
+// in the binary or in the S-1-5-21-... form. Zero if there is none.
+func ridOf(attributes map[string][]string) int {
+	sid := first(attributes, "objectSid")
+
+	if strings.HasPrefix(strings.ToUpper(sid), "S-") {
+		parts := strings.Split(sid, "-")
+		rid, err := strconv.ParseUint(parts[len(parts)-1], 10, 32)
+		if err != nil || len(parts) < 4 {
+			return 0
+		}
+		return int(rid)
+	}
+
+	// revision, count of sub authorities, 48 bit authority, sub authorities
+	b := []byte(sid)
+	if len(b) < 8 || len(b) != 8+4*int(b[1]) || b[1] == 0 {
+		return 0
+	}
+
+	return int(binary.LittleEndian.Uint32(b[len(b)-4:]))
+}
+
+func first(attributes map[string][]string, attribute string) string {
+	if values := filter.Values(attributes, attribute); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func hasValue(attributes map[string][]string, attribute string, value string) bool {
+	for _, v := range filter.Values(attributes, attribute) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
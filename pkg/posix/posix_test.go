@@ -0,0 +1,134 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package posix
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.users, nil
+}
+
+func TestPosixBackend_GetUsers(t *testing.T) {
+	Convey("Given active directory entries", t, func() {
+		// S-1-5-21-1004336348-1177238915-682003330-1105 in the binary form
+		binarySid := string([]byte{1, 5, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 0xdc, 0xf4, 0xdc, 0x3b, 0x83, 0x3d, 0x2b, 0x46, 0x82, 0x8b, 0xa6, 0x28, 0x51, 0x04, 0, 0})
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "CN=John Doe,CN=Users,DC=example,DC=com", Attributes: map[string][]string{
+				"objectClass":    {"top", "person", "organizationalPerson", "user"},
+				"sAMAccountName": {"jdoe"},
+				"objectSid":      {binarySid},
+				"primaryGroupID": {"513"},
+			}},
+			{DN: "CN=Admins,CN=Users,DC=example,DC=com", Attributes: map[string][]string{
+				"objectClass": {"top", "group"},
+				"objectSid":   {"S-1-5-21-1004336348-1177238915-682003330-1106"},
+			}},
+			{DN: "CN=Jane Roe,CN=Users,DC=example,DC=com", Attributes: map[string][]string{
+				"objectClass": {"user"},
+				"uid":         {"jroe"},
+				"uidNumber":   {"4242"},
+			}},
+			{DN: "ou=People,DC=example,DC=com", Attributes: map[string][]string{
+				"objectClass": {"organizationalUnit"},
+			}},
+		}}
+
+		Convey("When the default ids are synthesized", func() {
+			backend, err := NewBackend(delegate, &PosixConfig{})
+			So(err, ShouldBeNil)
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then users get a posix account from the relative ids", func() {
+				So(users[0].Attributes["objectClass"], ShouldResemble, []string{"top", "person", "organizationalPerson", "user", "posixAccount"})
+				So(users[0].Attributes["uid"], ShouldResemble, []string{"jdoe"})
+				So(users[0].Attributes["uidNumber"], ShouldResemble, []string{"11105"})
+				So(users[0].Attributes["gidNumber"], ShouldResemble, []string{"10513"})
+				So(users[0].Attributes["homeDirectory"], ShouldResemble, []string{"/home/jdoe"})
+				So(users[0].Attributes["loginShell"], ShouldResemble, []string{"/bin/bash"})
+			})
+
+			Convey("Then groups get a posix group", func() {
+				So(users[1].Attributes["objectClass"], ShouldResemble, []string{"top", "group", "posixGroup"})
+				So(users[1].Attributes["gidNumber"], ShouldResemble, []string{"11106"})
+			})
+
+			Convey("Then entries with posix attributes and other entries are unchanged", func() {
+				So(users[2], ShouldEqual, delegate.users[2])
+				So(users[3], ShouldEqual, delegate.users[3])
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].Attributes, ShouldNotContainKey, "uidNumber")
+				So(delegate.users[0].Attributes["objectClass"], ShouldHaveLength, 4)
+			})
+		})
+
+		Convey("When the ids are templates", func() {
+			delegate.users[0].Attributes["employeeNumber"] = []string{"7001"}
+			backend, err := NewBackend(delegate, &PosixConfig{UidNumber: "{employeeNumber}", GidNumber: "100", HomeDirectory: "/srv/home/{sAMAccountName}", LoginShell: "/bin/zsh"})
+			So(err, ShouldBeNil)
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then the templates are expanded", func() {
+				So(users[0].Attributes["uidNumber"], ShouldResemble, []string{"7001"})
+				So(users[0].Attributes["gidNumber"], ShouldResemble, []string{"100"})
+				So(users[0].Attributes["homeDirectory"], ShouldResemble, []string{"/srv/home/jdoe"})
+				So(users[0].Attributes["loginShell"], ShouldResemble, []string{"/bin/zsh"})
+			})
+
+			Convey("Then entries without the template attribute are unchanged", func() {
+				So(users[1].Attributes["gidNumber"], ShouldResemble, []string{"100"})
+				delete(delegate.users[0].Attributes, "employeeNumber")
+				users, err := backend.GetUsers(context.Background(), nil)
+				So(err, ShouldBeNil)
+				So(users[0], ShouldEqual, delegate.users[0])
+			})
+		})
+	})
+
+	Convey("Given a negative id base", t, func() {
+		_, err := NewBackend(&testBackend{}, &PosixConfig{IDBase: -1})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -29,6 +29,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
 	"github.com/gopenguin/ldap-proxy/pkg/log"
 	"github.com/gopenguin/ldap-proxy/pkg/util"
 	"github.com/samuel/go-ldap/ldap"
@@ -51,6 +52,7 @@ type Backend struct {
 }
 
 var _ pkg.Backend = &Backend{}
+var _ pkg.HealthCheckBackend = &Backend{}
 
 type Config struct {
 	pkg.Config
@@ -116,7 +118,7 @@ func (backend *Backend) Authenticate(ctx context.Context, username string, passw
 		return false
 	}
 
-	log.Debugf("[auth] found user %s", username)
+	log.ForBackend(backend.Name()).Debugw("found user", "request", pkg.RequestId(ctx), "user", username)
 
 	return util.VerifyPasswordCtx(ctx, hashedPassword, password)
 }
@@ -127,7 +129,7 @@ func (backend *Backend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.Use
 		return nil, err
 	}
 
-	log.Debug(query)
+	log.ForBackend(backend.Name()).Debugw("query", "request", pkg.RequestId(ctx), "sql", query)
 
 	rows, err := backend.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -168,6 +170,11 @@ func (backend *Backend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.Use
 		users = append(users, user)
 	}
 
+	// a cancelled query ends the iteration early
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return users, nil
 }
 
@@ -175,6 +182,11 @@ func (backend *Backend) Close() {
 	backend.db.Close()
 }
 
+// CheckHealth pings the database
+func (backend *Backend) CheckHealth(ctx context.Context) error {
+	return backend.db.PingContext(ctx)
+}
+
 func (backend *Backend) createQuery(f ldap.Filter) (sql string, args []interface{}, err error) {
 	log.Debug("convert ldap filter to query")
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
@@ -247,11 +259,43 @@ func (backend *Backend) createCondition(f ldap.Filter) (cond sq.Sqlizer, err err
 		_, ok := backend.attrCol[p.Attribute]
 		return toSqlBool(strings.ToLower(p.Attribute) == "objectclass" || ok), nil
 
+	case *ldap.ExtensibleMatch:
+		e := f.(*ldap.ExtensibleMatch)
+
+		return backend.extensibleMatch(e)
+
 	default:
 		return nil, errors.New("unsupported condition type")
 	}
 }
 
+// extensibleMatch supports the equality and the bitwise matching rules of
+// Active Directory on a single attribute
+func (backend *Backend) extensibleMatch(e *ldap.ExtensibleMatch) (sq.Sqlizer, error) {
+	col, ok := backend.attrCol[e.Attribute]
+	if !ok || e.DNAttributes {
+		return nil, errors.New("unsupported extensible match")
+	}
+
+	switch e.MatchingRule {
+	case "", "2.5.13.2", "caseIgnoreMatch", "2.5.13.5", "caseExactMatch":
+		return backend.equalMatch(e.Attribute, string(e.Value))
+
+	case filter.MatchingRuleBitAnd, filter.MatchingRuleBitOr:
+		mask, err := strconv.ParseInt(string(e.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.MatchingRule == filter.MatchingRuleBitAnd {
+			return sq.Expr(fmt.Sprintf("(%s & ?) = ?", col), mask, mask), nil
+		}
+		return sq.Expr(fmt.Sprintf("(%s & ?) <> 0", col), mask), nil
+	}
+
+	return nil, fmt.Errorf("unsupported matching rule %s", e.MatchingRule)
+}
+
 func (backend *Backend) equalMatch(attr, value string) (sq.Sqlizer, error) {
 	log.Debugf("EQ: %s = %s", attr, value)
 	if value == "*" {
@@ -21,6 +21,7 @@
 package postgres
 
 import (
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
 	"github.com/samuel/go-ldap/ldap"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
@@ -85,6 +86,37 @@ func TestCreateCondition(t *testing.T) {
 		})
 	})
 
+	Convey("Given a bitwise extensible match", t, func() {
+		f := &ldap.ExtensibleMatch{
+			Attribute:    "l",
+			MatchingRule: filter.MatchingRuleBitAnd,
+			Value:        []byte("2"),
+		}
+
+		Convey("Expect a query comparing the bits", func() {
+			cond, err := testBackend.createCondition(f)
+			sql, params, _ := cond.ToSql()
+
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `(l & ?) = ?`)
+			So(params, ShouldHaveLength, 2)
+		})
+	})
+
+	Convey("Given an extensible match of an unknown matching rule", t, func() {
+		f := &ldap.ExtensibleMatch{
+			Attribute:    "cn",
+			MatchingRule: "1.2.3.4",
+			Value:        []byte("test"),
+		}
+
+		Convey("Expect an error", func() {
+			_, err := testBackend.createCondition(f)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
 	Convey("Given an AND conjecture", t, func() {
 		f := &ldap.AND{
 			Filters: []ldap.Filter{
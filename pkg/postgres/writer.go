@@ -0,0 +1,137 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package postgres
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	sq "gopkg.in/Masterminds/squirrel.v1"
+	"strings"
+)
+
+var _ pkg.WriterBackend = &Backend{}
+var _ pkg.PasswordBackend = &Backend{}
+
+// SetPassword stores the bcrypt hash of the password of the user.
+func (backend *Backend) SetPassword(ctx context.Context, username string, password string) error {
+	return backend.exec(ctx, sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update("users").
+		Set("password", util.HashPassword(password, 12)).
+		Where(sq.Eq{"name": username}))
+}
+
+func (backend *Backend) Add(ctx context.Context, entry *pkg.User) error {
+	return pkg.ErrUnwillingToPerform
+}
+
+// Modify updates the columns of the modified attributes of the user with the
+// dn, mapped like for searches. Columns are single valued, a modification
+// sets at most one value. Deleting an attribute sets its column to null.
+func (backend *Backend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	dnCol, ok := backend.column(backend.config.DNAttribute)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update("users").
+		Where(sq.Eq{dnCol: dn})
+
+	for _, mod := range mods {
+		col, ok := backend.column(mod.Name)
+		if !ok || col == dnCol || len(mod.Values) > 1 {
+			return pkg.ErrUnwillingToPerform
+		}
+
+		var value interface{}
+		if mod.Type != ldap.ModDelete && len(mod.Values) == 1 {
+			value = string(mod.Values[0])
+		}
+		query = query.Set(col, value)
+	}
+
+	return backend.exec(ctx, query)
+}
+
+// Delete removes the row of the user with the dn.
+func (backend *Backend) Delete(ctx context.Context, dn string) error {
+	dnCol, ok := backend.column(backend.config.DNAttribute)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return backend.exec(ctx, sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete("users").
+		Where(sq.Eq{dnCol: dn}))
+}
+
+// ModifyDN changes the dn column of the user with the dn. The rows have no
+// hierarchy, a new superior only changes the dn.
+func (backend *Backend) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	dnCol, ok := backend.column(backend.config.DNAttribute)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return backend.exec(ctx, sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update("users").
+		Set(dnCol, pkg.RenamedDN(dn, newRDN, newSuperior)).
+		Where(sq.Eq{dnCol: dn}))
+}
+
+// exec runs the statement changing a single user
+func (backend *Backend) exec(ctx context.Context, statement sq.Sqlizer) error {
+	query, args, err := statement.ToSql()
+	if err != nil {
+		return err
+	}
+
+	log.ForBackend(backend.Name()).Debugw("query", "request", pkg.RequestId(ctx), "sql", query)
+
+	result, err := backend.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return pkg.ErrNoSuchEntry
+	}
+
+	return nil
+}
+
+// column returns the column of the attribute, looked up case insensitive
+func (backend *Backend) column(attribute string) (string, bool) {
+	for attr, col := range backend.attrCol {
+		if strings.EqualFold(attr, attribute) {
+			return col, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,127 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package postgres
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"testing"
+)
+
+func TestBackend_Modify(t *testing.T) {
+	Convey("Given a mocked database with a user 'userA'", t, backendWithMockedDatabase(func(backend *Backend, mock sqlmock.Sqlmock) {
+		Convey("When the mail and the first name of the user are modified", func() {
+			mock.ExpectExec("^UPDATE users SET email = \\$1, firstname = \\$2 WHERE user = \\$3$").
+				WithArgs("a@example.com", nil, "userA").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := backend.Modify(context.Background(), "userA", []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "EMAIL", Values: [][]byte{[]byte("a@example.com")}},
+				{Type: ldap.ModDelete, Name: "gn"},
+			})
+
+			Convey("Then the columns of the attributes are updated", func() {
+				So(err, ShouldBeNil)
+				So(mock.ExpectationsWereMet(), ShouldBeNil)
+			})
+		})
+
+		Convey("When an unknown user is modified", func() {
+			mock.ExpectExec("^UPDATE users").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := backend.Modify(context.Background(), "userB", []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "sn", Values: [][]byte{[]byte("b")}},
+			})
+
+			Convey("Then the user is not found", func() {
+				So(err, ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+
+		Convey("When an unmapped or multi valued attribute is modified", func() {
+			unmapped := backend.Modify(context.Background(), "userA", []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "telephoneNumber", Values: [][]byte{[]byte("1")}},
+			})
+			multiValued := backend.Modify(context.Background(), "userA", []*ldap.Mod{
+				{Type: ldap.ModAdd, Name: "sn", Values: [][]byte{[]byte("a"), []byte("b")}},
+			})
+
+			Convey("Then the backend is unwilling to perform it", func() {
+				So(unmapped, ShouldEqual, pkg.ErrUnwillingToPerform)
+				So(multiValued, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+	}))
+}
+
+func TestBackend_Delete(t *testing.T) {
+	Convey("Given a mocked database with a user 'userA'", t, backendWithMockedDatabase(func(backend *Backend, mock sqlmock.Sqlmock) {
+		Convey("When the user is deleted", func() {
+			mock.ExpectExec("^DELETE FROM users WHERE user = \\$1$").
+				WithArgs("userA").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := backend.Delete(context.Background(), "userA")
+
+			Convey("Then the row of the user is deleted", func() {
+				So(err, ShouldBeNil)
+				So(mock.ExpectationsWereMet(), ShouldBeNil)
+			})
+		})
+	}))
+}
+
+func TestBackend_ModifyDN(t *testing.T) {
+	Convey("Given a mocked database with a user 'userA'", t, backendWithMockedDatabase(func(backend *Backend, mock sqlmock.Sqlmock) {
+		Convey("When the user is renamed", func() {
+			mock.ExpectExec("^UPDATE users SET user = \\$1 WHERE user = \\$2$").
+				WithArgs("userB", "userA").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := backend.ModifyDN(context.Background(), "userA", "userB", true, "")
+
+			Convey("Then the dn column is updated", func() {
+				So(err, ShouldBeNil)
+				So(mock.ExpectationsWereMet(), ShouldBeNil)
+			})
+		})
+	}))
+}
+
+func TestBackend_SetPassword(t *testing.T) {
+	Convey("Given a mocked database with a user 'userA'", t, backendWithMockedDatabase(func(backend *Backend, mock sqlmock.Sqlmock) {
+		Convey("When the password of the user is changed", func() {
+			mock.ExpectExec("^UPDATE users SET password = \\$1 WHERE name = \\$2$").
+				WithArgs(sqlmock.AnyArg(), "userA").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err := backend.SetPassword(context.Background(), "userA", "secret")
+
+			Convey("Then the hash of the password is stored", func() {
+				So(err, ShouldBeNil)
+				So(mock.ExpectationsWereMet(), ShouldBeNil)
+			})
+		})
+	}))
+}
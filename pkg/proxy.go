@@ -24,14 +24,50 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/anomaly"
+	"github.com/gopenguin/ldap-proxy/pkg/approval"
+	"github.com/gopenguin/ldap-proxy/pkg/authlog"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/geoip"
 	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/masking"
+	"github.com/gopenguin/ldap-proxy/pkg/ratelimit"
+	"github.com/gopenguin/ldap-proxy/pkg/valuerules"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samuel/go-ldap/ldap"
 	"net"
+	"sync"
+	"time"
 )
 
 var (
 	errInvalidSessionType = errors.New("proxy: Invalid session type")
+	errSessionKilled      = errors.New("proxy: Session killed")
+
+	errBackendsUnreachable = errors.New("proxy: All backends unreachable")
+	errConnectionRefused   = errors.New("proxy: Connection refused")
+
+	// auditLog writes the audit trail of refused and security relevant
+	// operations
+	auditLog = log.Component(log.Audit)
+)
+
+// the reasons connections are refused
+const (
+	refusedIPFilter            = "ip_filter"
+	refusedMaxConnections      = "max_connections"
+	refusedMaxConnectionsPerIP = "max_connections_per_ip"
+	refusedShutdown            = "shutdown"
+)
+
+const (
+	actionAuth     = "auth"
+	actionSearch   = "search"
+	actionAdd      = "add"
+	actionModify   = "modify"
+	actionDelete   = "delete"
+	actionModifyDN = "modify_dn"
 )
 
 var (
@@ -47,135 +83,625 @@ var (
 		Help:      "The time spent by the backend searching",
 		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
 	}, []string{"action", "backend"})
+
+	backendTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "backend_timeouts_total",
+		Help:      "The total number of backend calls skipped because of a timeout",
+	}, []string{"action", "backend"})
+
+	backendSizeLimitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "backend_size_limits_total",
+		Help:      "The total number of backend searches truncated to the size limit of the backend",
+	}, []string{"backend"})
+
+	searchLimitsExceededTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "search_limits_exceeded_total",
+		Help:      "The total number of searches exceeding their size or time limit",
+	}, []string{"limit"})
+
+	rejectedFiltersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "rejected_filters_total",
+		Help:      "The total number of searches refused because their filter exceeded a filter limit",
+	}, []string{"limit"})
+
+	coalescedSearchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "coalesced_searches_total",
+		Help:      "The total number of backend searches answered by an identical concurrent search",
+	}, []string{"backend"})
+
+	anomaliesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "anomalies_total",
+		Help:      "The total number of sessions deviating from the behavior of the bound identity",
+	}, []string{"kind"})
+
+	replicaRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "replica_requests_total",
+		Help:      "The total number of calls of the replicas of a group by result",
+	}, []string{"group", "backend", "action", "result"})
+
+	replicaEntriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "replica_entries_total",
+		Help:      "The total number of entries returned by the replicas of a group",
+	}, []string{"group", "backend"})
+
+	connectionsRefusedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "connections_refused_total",
+		Help:      "The total number of connections refused by the proxy",
+	}, []string{"reason"})
+
+	throttledRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "throttled_requests_total",
+		Help:      "The total number of requests refused by a rate limit",
+	}, []string{"action", "kind"})
+
+	mfaRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "mfa_requests_total",
+		Help:      "The total number of binds asking the mfa service for the second factor by result",
+	}, []string{"result"})
+
+	connectionsByCountryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "connections_by_country_total",
+		Help:      "The total number of connections accepted by the proxy by country of the client",
+	}, []string{"country"})
+
+	bindsByCountryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "binds_by_country_total",
+		Help:      "The total number of binds by country of the client and result",
+	}, []string{"country", "result"})
+
+	accountStatusBindsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "bind_account_status_total",
+		Help:      "The total number of binds refused because the backend reported the account as locked or disabled by status",
+	}, []string{"status"})
+
+	lockoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "bind_lockouts_total",
+		Help:      "The total number of dns and source ips locked out after repeated failed binds",
+	}, []string{"kind"})
+
+	offlineFallbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "proxy",
+		Name:      "offline_fallbacks_total",
+		Help:      "The total number of requests answered from the offline cache because all backends were unreachable",
+	}, []string{"action"})
 )
 
 func init() {
 	prometheus.MustRegister(requestsTotal)
 	prometheus.MustRegister(backendActionDuration)
+	prometheus.MustRegister(backendTimeoutsTotal)
+	prometheus.MustRegister(backendSizeLimitsTotal)
+	prometheus.MustRegister(searchLimitsExceededTotal)
+	prometheus.MustRegister(rejectedFiltersTotal)
+	prometheus.MustRegister(coalescedSearchesTotal)
+	prometheus.MustRegister(anomaliesTotal)
+	prometheus.MustRegister(replicaRequestsTotal)
+	prometheus.MustRegister(replicaEntriesTotal)
+	prometheus.MustRegister(offlineFallbacksTotal)
+	prometheus.MustRegister(lockoutsTotal)
+	prometheus.MustRegister(mfaRequestsTotal)
+	prometheus.MustRegister(accountStatusBindsTotal)
+	prometheus.MustRegister(connectionsByCountryTotal)
+	prometheus.MustRegister(bindsByCountryTotal)
+	prometheus.MustRegister(throttledRequestsTotal)
+	prometheus.MustRegister(connectionsRefusedTotal)
 }
 
+// LdapProxy serves the ldap requests. Every operation works on a copy with the
+// backends and the config of its start, so a reload doesn't change them while
+// the operation is in flight.
 type LdapProxy struct {
 	backends map[string]Backend
+	ordered  []Backend
+	config   ProxyConfig
+	flights  *flightGroup
+
+	// the operations in flight on the backends and the config
+	operations *sync.WaitGroup
 
+	*proxyRuntime
+}
+
+// proxyRuntime is the state shared by the copies of a proxy and kept by a
+// reload
+type proxyRuntime struct {
 	server *ldap.Server
 
 	context context.Context
+
+	// guards the backends and the config against a reload
+	reloadMutex sync.RWMutex
+
+	// the runtime state changed by the admin api
+	mutex    sync.Mutex
+	sessions map[*session]*admin.Session
+	disabled map[string]bool
+
+	// the servers of the proxy and its listeners, publishing the root dse
+	servers map[*ldap.Server]bool
+
+	// the open connections, in total and by source ip
+	connections      int
+	connectionsPerIP map[string]int
+
+	// the counters of the cn=Monitor subtree
+	monitor *monitor
+
+	// set by a shutdown, which waits for the requests in flight and closes
+	// stopped when done
+	draining bool
+	inFlight sync.WaitGroup
+	stopped  chan struct{}
 }
 
 type session struct {
 	context context.Context
 	cancle  context.CancelFunc
+
+	// The additional listener which accepted the session, nil for the main one
+	listener *Listener
+
+	// The number of requests of the session, numbering the request ids
+	requests int64
 }
 
 func NewLdapProxy() *LdapProxy {
 	proxy := &LdapProxy{
-		backends: make(map[string]Backend),
+		backends:   make(map[string]Backend),
+		config:     DefaultProxyConfig(),
+		flights:    newFlightGroup(),
+		operations: &sync.WaitGroup{},
+
+		proxyRuntime: &proxyRuntime{
+			sessions: make(map[*session]*admin.Session),
+			disabled: make(map[string]bool),
+			servers:  make(map[*ldap.Server]bool),
+
+			connectionsPerIP: make(map[string]int),
 
-		context: context.Background(),
+			context: context.Background(),
+			monitor: newMonitor(),
+			stopped: make(chan struct{}),
+		},
 	}
 
-	proxy.server, _ = ldap.NewServer(LogBackend(proxy), nil)
+	proxy.server, _ = ldap.NewServer(LogBackend(proxy.audited(proxy.drained(proxy))), nil)
+	proxy.addServer(proxy.server)
 
 	return proxy
 }
 
+// AddBackend adds the backends, also while the proxy is serving. A backend
+// with the name of an existing one replaces it.
 func (ldapProxy *LdapProxy) AddBackend(backends ...Backend) {
 	log.Printf("Adding %d backends", len(backends))
+	ldapProxy.update(func(current *LdapProxy) (ProxyConfig, []Backend, error) {
+		return current.config, append(append([]Backend{}, current.ordered...), backends...), nil
+	})
+}
+
+// addBackends adds the backends to the new maps of an update
+func (ldapProxy *LdapProxy) addBackends(backends []Backend) {
 	for _, bkend := range backends {
+		if _, ok := ldapProxy.backends[bkend.Name()]; ok {
+			for i := range ldapProxy.ordered {
+				if ldapProxy.ordered[i].Name() == bkend.Name() {
+					ldapProxy.ordered[i] = bkend
+				}
+			}
+		} else {
+			ldapProxy.ordered = append(ldapProxy.ordered, bkend)
+		}
+
 		ldapProxy.backends[bkend.Name()] = bkend
 	}
 }
 
+func (ldapProxy *LdapProxy) Configure(config ProxyConfig) {
+	ldapProxy.reloadMutex.Lock()
+	ldapProxy.config = config
+	ldapProxy.reloadMutex.Unlock()
+
+	ldapProxy.publishRootDSE()
+}
+
 func (ldapProxy *LdapProxy) ListenAndServe(network, addr string) {
 	log.Printf("Start listening on %s", addr)
 	ldapProxy.server.Serve(network, addr)
+	ldapProxy.waitStopped()
 }
 
 func (ldapProxy *LdapProxy) ListenAndServeTLS(network, addr string, tlsConfig *tls.Config) {
 	log.Printf("Start listening securely on %s", addr)
 	ldapProxy.server.ServeTLS(network, addr, tlsConfig)
+	ldapProxy.waitStopped()
+}
+
+// waitStopped waits for a shutdown closing the server to finish draining
+func (ldapProxy *LdapProxy) waitStopped() {
+	if ldapProxy.isDraining() {
+		<-ldapProxy.stopped
+	}
 }
 
 func (ldapProxy *LdapProxy) Connect(remoteAddr net.Addr) (ldap.Context, error) {
+	sess, err := ldapProxy.current().connect(remoteAddr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// connect refuses connections from source ips the ip filter of the listener
+// doesn't allow and connections exceeding the connection limits. Listeners
+// without ip filter use the one of the proxy.
+func (ldapProxy *LdapProxy) connect(remoteAddr net.Addr, listener *Listener) (*session, error) {
 	requestsTotal.With(prometheus.Labels{"action": "connect"}).Inc()
 
-	ctx, cancle := context.WithCancel(ldapProxy.context)
+	ipFilter := ldapProxy.config.IPFilter
+	if listener != nil && listener.config.IPFilter != nil {
+		ipFilter = listener.config.IPFilter
+	}
+	if !ipFilter.Allows(remoteAddr) {
+		connectionsRefusedTotal.With(prometheus.Labels{"reason": refusedIPFilter}).Inc()
+		log.Printf("connection from %v refused by the ip filter", remoteAddr)
+		return nil, errConnectionRefused
+	}
 
-	return &session{
-		context: ctx,
-		cancle:  cancle,
-	}, nil
+	if ldapProxy.isDraining() {
+		connectionsRefusedTotal.With(prometheus.Labels{"reason": refusedShutdown}).Inc()
+		log.Printf("connection from %v refused, shutting down", remoteAddr)
+		return nil, errConnectionRefused
+	}
+
+	if reason, ok := ldapProxy.admit(remoteAddr); !ok {
+		connectionsRefusedTotal.With(prometheus.Labels{"reason": reason}).Inc()
+		log.Printf("connection from %v refused, %s reached", remoteAddr, reason)
+		return nil, errConnectionRefused
+	}
+
+	location := ldapProxy.config.GeoIP.Lookup(remoteAddr)
+	if ldapProxy.config.GeoIP != nil {
+		connectionsByCountryTotal.With(prometheus.Labels{"country": geoip.CountryOf(location)}).Inc()
+		log.Debugf("connection from %v located in %v", remoteAddr, location)
+	}
+
+	ctx, cancle := context.WithCancel(setLocation(setId(setRemoteAddr(ldapProxy.context, remoteAddr)), location))
+
+	sess := &session{
+		context:  ctx,
+		cancle:   cancle,
+		listener: listener,
+	}
+	ldapProxy.track(sess)
+	ldapProxy.monitor.connected()
+
+	return sess, nil
 }
 
 func (ldapProxy *LdapProxy) Disconnect(ctx ldap.Context) {
-	sess, ok := ctx.(*session)
+	sess, ok := sessionOf(ctx)
 	if !ok {
 		return
 	}
 
 	sess.cancle()
+	ldapProxy.untrack(sess)
+	ldapProxy.release(getRemoteAddr(sess.context))
 
 	requestsTotal.With(prometheus.Labels{"action": "disconnect"}).Inc()
 }
 
 func (ldapProxy *LdapProxy) Bind(ctx ldap.Context, req *ldap.BindRequest) (*ldap.BindResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
 	log.Debugf("bind as %s", req.DN)
 
-	sess, ok := ctx.(*session)
-	if !ok {
-		return nil, errInvalidSessionType
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	requestsTotal.With(prometheus.Labels{"action": "bind"}).Inc()
 
+	if kind, ok := ldapProxy.config.RateLimit.Allow(ratelimit.OperationBind, req.DN, getRemoteAddr(sess.context)); !ok {
+		throttledRequestsTotal.With(prometheus.Labels{"action": "bind", "kind": kind}).Inc()
+		log.Debugf("bind as %s from %v throttled by the %s rate limit", req.DN, getRemoteAddr(sess.context), kind)
+		return &ldap.BindResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultBusy,
+				Message: "rate limit exceeded",
+			},
+		}, nil
+	}
+
 	res := &ldap.BindResponse{
 		BaseResponse: ldap.BaseResponse{
 			Code: ldap.ResultInvalidCredentials,
 		},
 	}
 
-	sess.context = setDn(sess.context, "")
+	sess.context = setAttributes(setBackend(setDn(sess.context, ""), ""), nil)
 
-	for _, backend := range ldapProxy.backends {
-		timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
-			backendActionDuration.With(prometheus.Labels{"action": "auth", "backend": backend.Name()}).Observe(v)
-		}))
-		authenticated := backend.Authenticate(sess.context, req.DN, string(req.Password))
-		timer.ObserveDuration()
+	if req.DN != "" && len(req.Password) == 0 && !ldapProxy.config.UnauthenticatedBinds {
+		// some upstreams accept a dn without password as anonymous bind
+		log.Printf("unauthenticated bind of %s from %v refused%s", req.DN, getRemoteAddr(sess.context), logRequestId(requestId(ctx)))
+		ldapProxy.config.AuthLog.Failure(getRemoteAddr(sess.context), req.DN, authlog.ReasonUnauthenticated, requestId(ctx))
+		res.BaseResponse.Code = ldap.ResultUnwillingToPerform
+		res.BaseResponse.Message = "unauthenticated bind not allowed"
+	} else if req.DN == "" && len(req.Password) == 0 && ldapProxy.config.Anonymous != nil {
+		res.BaseResponse.Code = ldap.ResultSuccess
+	} else if backend, attributes, refused := ldapProxy.verifyCredentials(requestContext(ctx, sess), sess, "bind", req.DN, string(req.Password)); backend != nil {
+		sess.context = setAttributes(setBackend(setDn(sess.context, req.DN), backend.Name()), attributes)
+		reportAnomalies(ldapProxy.config.Anomaly.Bind(req.DN, getRemoteAddr(sess.context), time.Now()))
 
-		if authenticated {
-			sess.context = setDn(sess.context, req.DN)
+		res.BaseResponse.Code = ldap.ResultSuccess
+		res.MatchedDN = req.DN
+	} else {
+		res.BaseResponse = refused
+	}
 
-			res.BaseResponse.Code = ldap.ResultSuccess
-			res.MatchedDN = req.DN
-			break
+	if ldapProxy.config.GeoIP != nil {
+		result := "success"
+		if res.Code != ldap.ResultSuccess {
+			result = "failure"
 		}
+		bindsByCountryTotal.With(prometheus.Labels{"country": geoip.CountryOf(getLocation(sess.context)), "result": result}).Inc()
 	}
 
+	ldapProxy.track(sess)
+
 	return res, nil
 }
 
+// verifyCredentials verifies the password of the dn behind the guards of a
+// bind: the lockout, the one-time password, the account status and the second
+// factor. Refused credentials are counted for the lockout. The backend
+// accepting the credentials and the attributes of the user are returned, the
+// response otherwise. The action names the operation in the logs.
+func (ldapProxy *LdapProxy) verifyCredentials(ctx context.Context, sess *session, action string, dn string, password string) (Backend, map[string][]string, ldap.BaseResponse) {
+	refused := ldap.BaseResponse{Code: ldap.ResultInvalidCredentials}
+	id := RequestId(ctx)
+
+	if ldapProxy.config.Lockout.Locked(dn, getRemoteAddr(sess.context)) {
+		log.Printf("%s of %s from %v refused, locked out%s", action, dn, getRemoteAddr(sess.context), logRequestId(id))
+		ldapProxy.config.AuthLog.Failure(getRemoteAddr(sess.context), dn, authlog.ReasonLockedOut, id)
+		return nil, nil, refused
+	}
+
+	password, ok := ldapProxy.config.TOTP.Verify(dn, password)
+	if !ok {
+		log.Printf("%s of %s from %v refused, invalid one-time password%s", action, dn, getRemoteAddr(sess.context), logRequestId(id))
+		ldapProxy.bindFailed(ctx, sess, dn, authlog.ReasonInvalidOTP)
+		return nil, nil, refused
+	}
+
+	backend, rejected, status := ldapProxy.authenticate(ctx, dn, password)
+	if backend == nil {
+		if status != AccountActive {
+			accountStatusBindsTotal.With(prometheus.Labels{"status": status}).Inc()
+			auditLog.Printf("AUDIT: %s of %s from %v refused, account %s%s", action, dn, getRemoteAddr(sess.context), status, logRequestId(id))
+			ldapProxy.bindFailed(ctx, sess, dn, accountStatusReason(status))
+			refused.Message = accountStatusMessage(status)
+		} else if rejected {
+			ldapProxy.bindFailed(ctx, sess, dn, authlog.ReasonInvalidCredentials)
+		}
+		return nil, nil, refused
+	}
+
+	attributes := ldapProxy.fetchSessionAttributes(ctx, backend, dn)
+	if ldapProxy.config.TOTP.Required(filter.Values(attributes, ldapProxy.config.TOTP.GroupAttribute())) && !ldapProxy.config.TOTP.Enrolled(dn) {
+		log.Printf("%s of %s from %v refused, a one-time password is required%s", action, dn, getRemoteAddr(sess.context), logRequestId(id))
+		ldapProxy.config.AuthLog.Failure(getRemoteAddr(sess.context), dn, authlog.ReasonNotEnrolled, id)
+		refused.Message = "one-time password required"
+		return nil, nil, refused
+	}
+	if !ldapProxy.secondFactor(ctx, sess, action, dn) {
+		refused.Message = "second factor not approved"
+		return nil, nil, refused
+	}
+
+	ldapProxy.config.Lockout.Success(dn)
+
+	return backend, attributes, ldap.BaseResponse{Code: ldap.ResultSuccess}
+}
+
+// secondFactor asks the mfa service to approve the bind of the dn
+func (ldapProxy *LdapProxy) secondFactor(ctx context.Context, sess *session, action string, dn string) bool {
+	id := RequestId(ctx)
+	approved, result, err := ldapProxy.config.MFA.Verify(sess.context, dn, remoteIP(getRemoteAddr(sess.context)))
+	if ldapProxy.config.MFA != nil {
+		mfaRequestsTotal.With(prometheus.Labels{"result": result}).Inc()
+	}
+	if err != nil {
+		log.Printf("second factor of %s from %v failed, %s approved by the fail open policy: %t: %v%s", dn, getRemoteAddr(sess.context), action, approved, err, logRequestId(id))
+	} else if !approved {
+		log.Printf("%s of %s from %v refused, second factor denied%s", action, dn, getRemoteAddr(sess.context), logRequestId(id))
+	}
+	if !approved {
+		ldapProxy.config.AuthLog.Failure(getRemoteAddr(sess.context), dn, authlog.ReasonMFADenied, id)
+	}
+
+	return approved
+}
+
+// bindFailed logs the failed bind and counts it for the lockout
+func (ldapProxy *LdapProxy) bindFailed(ctx context.Context, sess *session, dn string, reason string) {
+	ldapProxy.config.AuthLog.Failure(getRemoteAddr(sess.context), dn, reason, RequestId(ctx))
+	for _, lockout := range ldapProxy.config.Lockout.Failure(dn, getRemoteAddr(sess.context)) {
+		lockoutsTotal.With(prometheus.Labels{"kind": lockout.Kind}).Inc()
+		auditLog.Printf("AUDIT: lockout of %s %s after %d failed binds until %s, last bind as %s%s", lockout.Kind, lockout.Key, lockout.Failures, lockout.Until.Format(time.RFC3339), dn, logRequestId(RequestId(ctx)))
+	}
+}
+
+// authenticate returns the first enabled backend accepting the credentials.
+// Binds verified by the bind cache and binds which just failed don't reach the
+// backends. If every backend timed out or was unavailable the bind is verified
+// by the offline cache. Rejected reports whether the credentials were refused,
+// not just left unverified because backends timed out. If the account status is checked, a
+// locked or disabled account ends the bind without asking the other backends.
+func (ldapProxy *LdapProxy) authenticate(ctx context.Context, dn string, password string) (backend Backend, rejected bool, status string) {
+	if name, ok := ldapProxy.config.BindCache.Verify(dn, password); ok {
+		if backend, ok := ldapProxy.backends[name]; ok && ldapProxy.isEnabled(name) {
+			return backend, false, AccountActive
+		}
+	}
+
+	// the same failed bind is repeated by misbehaving clients
+	if _, ok := ldapProxy.config.NegativeBindCache.Verify(dn, password); ok {
+		return nil, true, AccountActive
+	}
+
+	definite := true
+	reached := false
+	for _, replicas := range ldapProxy.authTargets() {
+		// the verdict of the replica chosen from a group splitting binds is
+		// final, the other replicas are only asked if it timed out
+		for _, backend := range replicas {
+			backendCtx, cancelBackend := ldapProxy.backendContext(ctx, backend, actionAuth)
+			timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+				backendActionDuration.With(prometheus.Labels{"action": actionAuth, "backend": backend.Name()}).Observe(v)
+			}))
+			authenticated, err := Authenticate(backendCtx, backend, dn, password)
+			timer.ObserveDuration()
+			timedOut := isTimeout(ctx, backendCtx)
+			cancelBackend()
+			ldapProxy.monitor.backendCall(backend.Name(), actionAuth, false, timedOut)
+
+			if timedOut {
+				backendTimeoutsTotal.With(prometheus.Labels{"action": actionAuth, "backend": backend.Name()}).Inc()
+				ldapProxy.observeReplica(backend, actionAuth, replicaTimeout, 0)
+				log.ForBackend(backend.Name()).Printf("backend %s timed out authenticating %s, skipped", backend.Name(), dn)
+				definite = false
+				continue
+			}
+			if err == ErrBackendUnavailable {
+				// neither accepted nor refused, like a timeout
+				ldapProxy.observeReplica(backend, actionAuth, replicaUnavailable, 0)
+				log.ForBackend(backend.Name()).Printf("backend %s unavailable authenticating %s, skipped", backend.Name(), dn)
+				definite = false
+				continue
+			}
+			reached = true
+
+			if authenticated {
+				ldapProxy.observeReplica(backend, actionAuth, replicaSuccess, 0)
+				ldapProxy.config.BindCache.Add(dn, password, backend.Name())
+				ldapProxy.config.OfflineBindCache.Add(dn, password, backend.Name())
+				return backend, false, AccountActive
+			}
+
+			ldapProxy.observeReplica(backend, actionAuth, replicaFailure, 0)
+			if ldapProxy.config.AccountStatus {
+				if status := ldapProxy.accountStatus(ctx, backend, dn); status != AccountActive {
+					return nil, true, status
+				}
+			}
+			break
+		}
+	}
+
+	if !definite && !reached && ctx.Err() == nil {
+		return ldapProxy.offlineBind(ctx, dn, password), false, AccountActive
+	}
+
+	if definite && ctx.Err() == nil {
+		ldapProxy.config.NegativeBindCache.Add(dn, password, "")
+		return nil, true, AccountActive
+	}
+
+	return nil, false, AccountActive
+}
+
 func (ldapProxy *LdapProxy) Add(ctx ldap.Context, req *ldap.AddRequest) (*ldap.AddResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	requestsTotal.With(prometheus.Labels{"action": "add"}).Inc()
 
-	return &ldap.AddResponse{
-		BaseResponse: ldap.BaseResponse{
-			Code: ldap.ResultUnwillingToPerform,
-		},
-	}, nil
+	entry := &User{DN: req.DN, Attributes: make(map[string][]string)}
+	var attributes []string
+	for _, attribute := range req.Attributes {
+		attributes = append(attributes, attribute.Name)
+		for _, value := range attribute.Values {
+			entry.Attributes[attribute.Name] = append(entry.Attributes[attribute.Name], string(value))
+		}
+	}
+
+	if res := ldapProxy.authorizeWrite(requestContext(ctx, sess), sess, actionAdd, req.DN, attributes); res != nil {
+		return &ldap.AddResponse{BaseResponse: *res}, nil
+	}
+
+	res := ldapProxy.write(requestContext(ctx, sess), sess, actionAdd, req.DN, func(backend WriterBackend) error {
+		return backend.Add(requestContext(ctx, sess), entry)
+	})
+
+	return &ldap.AddResponse{BaseResponse: res}, nil
 }
 
 func (ldapProxy *LdapProxy) Delete(ctx ldap.Context, req *ldap.DeleteRequest) (*ldap.DeleteResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	requestsTotal.With(prometheus.Labels{"action": "delete"}).Inc()
 
-	return &ldap.DeleteResponse{
-		BaseResponse: ldap.BaseResponse{
-			Code: ldap.ResultUnwillingToPerform,
-		},
-	}, nil
+	if ldapProxy.isProtected(req.DN) {
+		auditLog.Printf("AUDIT: delete of %s by '%s' from %v refused, the entry is protected%s", req.DN, getDn(sess.context), getRemoteAddr(sess.context), logRequestId(requestId(ctx)))
+		return &ldap.DeleteResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultUnwillingToPerform,
+				Message: "entry is protected",
+			},
+		}, nil
+	}
+
+	if res := ldapProxy.authorizeWrite(requestContext(ctx, sess), sess, actionDelete, req.DN, nil); res != nil {
+		return &ldap.DeleteResponse{BaseResponse: *res}, nil
+	}
+
+	if res := ldapProxy.checkApproval(requestContext(ctx, sess), sess, approval.OperationDelete, req.DN, nil); res != nil {
+		return &ldap.DeleteResponse{BaseResponse: *res}, nil
+	}
+
+	res := ldapProxy.write(requestContext(ctx, sess), sess, actionDelete, req.DN, func(backend WriterBackend) error {
+		return backend.Delete(requestContext(ctx, sess), req.DN)
+	})
+	auditLog.Printf("AUDIT: delete of %s by '%s' from %v: %d%s", req.DN, getDn(sess.context), getRemoteAddr(sess.context), res.Code, logRequestId(requestId(ctx)))
+
+	return &ldap.DeleteResponse{BaseResponse: res}, nil
 }
 
 func (ldapProxy *LdapProxy) ExtendedRequest(ctx ldap.Context, req *ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
 	requestsTotal.With(prometheus.Labels{"action": "extended"}).Inc()
 
 	return &ldap.ExtendedResponse{
@@ -186,40 +712,198 @@ func (ldapProxy *LdapProxy) ExtendedRequest(ctx ldap.Context, req *ldap.Extended
 }
 
 func (ldapProxy *LdapProxy) Modify(ctx ldap.Context, req *ldap.ModifyRequest) (*ldap.ModifyResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	requestsTotal.With(prometheus.Labels{"action": "modify"}).Inc()
 
-	return &ldap.ModifyResponse{
-		BaseResponse: ldap.BaseResponse{
-			Code: ldap.ResultUnwillingToPerform,
-		},
-	}, nil
+	var attributes []string
+	for _, mod := range req.Mods {
+		attributes = append(attributes, mod.Name)
+	}
+
+	if res := ldapProxy.authorizeWrite(requestContext(ctx, sess), sess, actionModify, req.DN, attributes); res != nil {
+		return &ldap.ModifyResponse{BaseResponse: *res}, nil
+	}
+
+	if res := ldapProxy.checkApproval(requestContext(ctx, sess), sess, approval.OperationModify, req.DN, attributes); res != nil {
+		return &ldap.ModifyResponse{BaseResponse: *res}, nil
+	}
+
+	res := ldapProxy.write(requestContext(ctx, sess), sess, actionModify, req.DN, func(backend WriterBackend) error {
+		return backend.Modify(requestContext(ctx, sess), req.DN, req.Mods)
+	})
+
+	return &ldap.ModifyResponse{BaseResponse: res}, nil
 }
 
 func (ldapProxy *LdapProxy) ModifyDN(ctx ldap.Context, req *ldap.ModifyDNRequest) (*ldap.ModifyDNResponse, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	requestsTotal.With(prometheus.Labels{"action": "modify_dn"}).Inc()
 
-	return &ldap.ModifyDNResponse{
-		BaseResponse: ldap.BaseResponse{
-			Code: ldap.ResultUnwillingToPerform,
-		},
-	}, nil
+	if ldapProxy.isProtected(req.DN) {
+		auditLog.Printf("AUDIT: rename of %s by '%s' from %v refused, the entry is protected%s", req.DN, getDn(sess.context), getRemoteAddr(sess.context), logRequestId(requestId(ctx)))
+		return &ldap.ModifyDNResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultUnwillingToPerform,
+				Message: "entry is protected",
+			},
+		}, nil
+	}
+
+	for _, dn := range []string{req.DN, RenamedDN(req.DN, req.NewRDN, req.NewSuperior)} {
+		if res := ldapProxy.authorizeWrite(requestContext(ctx, sess), sess, actionModifyDN, dn, nil); res != nil {
+			return &ldap.ModifyDNResponse{BaseResponse: *res}, nil
+		}
+	}
+
+	// entries can't be moved between backends
+	if req.NewSuperior != "" {
+		source, _ := ldapProxy.writerBackend(req.DN)
+		target, _ := ldapProxy.writerBackend(RenamedDN(req.DN, req.NewRDN, req.NewSuperior))
+		if source != nil && source != target {
+			return &ldap.ModifyDNResponse{
+				BaseResponse: ldap.BaseResponse{
+					Code:    ldap.ResultAffectsMultipleDSAs,
+					Message: "the new superior belongs to another backend",
+				},
+			}, nil
+		}
+	}
+
+	res := ldapProxy.write(requestContext(ctx, sess), sess, actionModifyDN, req.DN, func(backend WriterBackend) error {
+		return backend.ModifyDN(requestContext(ctx, sess), req.DN, req.NewRDN, req.DeleteOldRDN, req.NewSuperior)
+	})
+	if res.Code == ldap.ResultSuccess {
+		// binds of the new dn failed before the rename
+		ldapProxy.invalidateBinds(RenamedDN(req.DN, req.NewRDN, req.NewSuperior))
+	}
+
+	return &ldap.ModifyDNResponse{BaseResponse: res}, nil
 }
 
+// checkApproval asks for approval of sensitive operations. It returns the
+// response to send if the operation must not be forwarded.
+func (ldapProxy *LdapProxy) checkApproval(ctx context.Context, sess *session, operation string, dn string, attributes []string) *ldap.BaseResponse {
+	err := ldapProxy.config.Approval.Check(sess.context, &approval.Request{
+		Operation:  operation,
+		DN:         dn,
+		BoundDN:    getDn(sess.context),
+		Attributes: attributes,
+	})
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("%s of %s by %s not approved: %s%s", operation, dn, getDn(sess.context), err, logRequestId(RequestId(ctx)))
+
+	return &ldap.BaseResponse{
+		Code:    ldap.ResultInsufficientAccessRights,
+		Message: err.Error(),
+	}
+}
+
+// PasswordModify changes the password of the session or another user. The
+// ldap library has no response for a failed password modify: every error is
+// answered with resultCode other and the connection is closed. Refusals are
+// returned as *ldap.BaseResponse all the same, so the logs record the reason.
 func (ldapProxy *LdapProxy) PasswordModify(ctx ldap.Context, req *ldap.PasswordModifyRequest) ([]byte, error) {
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	requestsTotal.With(prometheus.Labels{"action": "modify_password"}).Inc()
 
-	return []byte{}, nil
+	id := requestId(ctx)
+	dn, backend, res := ldapProxy.passwordBackend(requestContext(ctx, sess), sess, req)
+	if res != nil {
+		log.Printf("password change of %s by '%s' refused: %s%s", dn, getDn(sess.context), res.Message, logRequestId(id))
+		return nil, res
+	}
+
+	// no generated password is sent back for a given password
+	password, generated := string(req.NewPassword), []byte(nil)
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return nil, err
+		}
+		generated = []byte(password)
+	}
+
+	if err = backend.SetPassword(requestContext(ctx, sess), dn, password); err != nil {
+		log.ForBackend(backend.Name()).Printf("password change of %s failed in backend %s: %v%s", dn, backend.Name(), err, logRequestId(id))
+		if err == ErrNoSuchEntry {
+			return nil, &ldap.BaseResponse{Code: ldap.ResultNoSuchObject, Message: err.Error()}
+		}
+		return nil, &ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform, Message: err.Error()}
+	}
+	log.ForBackend(backend.Name()).Printf("password of %s changed by '%s' in backend %s%s", dn, getDn(sess.context), backend.Name(), logRequestId(id))
+
+	// the old password must not be accepted from the cache anymore
+	ldapProxy.invalidateBinds(dn)
+
+	return generated, nil
 }
 
 func (ldapProxy *LdapProxy) Search(ctx ldap.Context, req *ldap.SearchRequest) (*ldap.SearchResponse, error) {
-	sess, ok := ctx.(*session)
-	if !ok {
-		return nil, errInvalidSessionType
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	requestsTotal.With(prometheus.Labels{"action": "search"}).Inc()
 
-	if getDn(sess.context) == "" {
+	if kind, ok := ldapProxy.config.RateLimit.Allow(ratelimit.OperationSearch, getDn(sess.context), getRemoteAddr(sess.context)); !ok {
+		throttledRequestsTotal.With(prometheus.Labels{"action": "search", "kind": kind}).Inc()
+		log.Debugf("search of %s from %v throttled by the %s rate limit", getDn(sess.context), getRemoteAddr(sess.context), kind)
+		return &ldap.SearchResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultBusy,
+				Message: "rate limit exceeded",
+			},
+		}, nil
+	}
+
+	if limit, exceeded := ldapProxy.exceededFilterLimit(req.Filter); exceeded {
+		rejectedFiltersTotal.With(prometheus.Labels{"limit": limit}).Inc()
+		log.Printf("search of %s from %v refused, the filter exceeds the %s limit", getDn(sess.context), getRemoteAddr(sess.context), limit)
+		return &ldap.SearchResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultUnwillingToPerform,
+				Message: "filter exceeds the " + limit + " limit",
+			},
+		}, nil
+	}
+
+	if isRootDSE(req) {
+		return ldapProxy.rootDSE(req), nil
+	}
+
+	if ldapProxy.isSubschema(req) {
+		return ldapProxy.subschemaEntry(req), nil
+	}
+
+	anonymous := getDn(sess.context) == ""
+	if anonymous && !ldapProxy.config.Anonymous.allows(req) {
 		return &ldap.SearchResponse{
 			BaseResponse: ldap.BaseResponse{
 				Code: ldap.ResultInsufficientAccessRights,
@@ -227,54 +911,323 @@ func (ldapProxy *LdapProxy) Search(ctx ldap.Context, req *ldap.SearchRequest) (*
 		}, nil
 	}
 
+	if ldapProxy.isMonitor(req) {
+		return ldapProxy.monitorSearch(req), nil
+	}
+
+	redacted := ldapProxy.redacted(sess.context)
+	if redacted && ldapProxy.redactsFilter(req.Filter) {
+		return &ldap.SearchResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code: ldap.ResultInsufficientAccessRights,
+			},
+		}, nil
+	}
+
+	if ldapProxy.config.Anomaly.OverQuota(getDn(sess.context)) {
+		log.Printf("searches of %s throttled, daily quota exceeded", getDn(sess.context))
+		return &ldap.SearchResponse{
+			BaseResponse: ldap.BaseResponse{
+				Code:    ldap.ResultAdminLimitExceeded,
+				Message: "daily quota exceeded",
+			},
+		}, nil
+	}
+
+	if urls := ldapProxy.referral(req.BaseDN); urls != nil {
+		log.Debugf("search of %s referred to %v", req.BaseDN, urls)
+		return referralResponse(urls), nil
+	}
+
 	res := &ldap.SearchResponse{
 		BaseResponse: ldap.BaseResponse{
 			Code: ldap.ResultSuccess,
 		},
 	}
 
-	var searchResults []*ldap.SearchResult
+	sizeLimit, timeLimit := ldapProxy.searchLimits(req.SizeLimit, req.TimeLimit)
 
-	for _, backend := range ldapProxy.backends {
-		timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
-			backendActionDuration.With(prometheus.Labels{"action": "search", "backend": backend.Name()}).Observe(v)
-		}))
-		users, err := backend.GetUsers(sess.context, req.Filter)
-		timer.ObserveDuration()
-		if err != nil {
+	searchCtx := requestContext(ctx, sess)
+	if timeLimit > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(searchCtx, timeLimit)
+		defer cancel()
+	}
+
+	users, err := ldapProxy.cachedSearch(searchCtx, req)
+	if isTimeout(sess.context, searchCtx) {
+		log.Printf("search of %s exceeded the time limit of %s", getDn(sess.context), timeLimit)
+		searchLimitsExceededTotal.With(prometheus.Labels{"limit": limitTime}).Inc()
+		res.Code = ldap.ResultTimeLimitExceeded
+		return res, nil
+	}
+	if err != nil {
+		if sess.context.Err() != nil {
+			// the client is gone
 			return nil, err
 		}
 
-		for _, user := range users {
-			searchResult := ldap.SearchResult{
-				DN:         user.DN,
-				Attributes: map[string][][]byte{},
-			}
+		// the library answers errors with a bare resultCode other, the
+		// response carries the request id
+		log.Printf("search of %s failed: %v%s", getDn(sess.context), err, logRequestId(requestId(ctx)))
+		res.Code = ldap.ResultOther
+		res.Message = err.Error()
+		return res, nil
+	}
 
-			for key, values := range user.Attributes {
-				convertedValues := [][]byte{}
-				for _, value := range values {
-					convertedValues = append(convertedValues, []byte(value))
-				}
-				searchResult.Attributes[key] = convertedValues
-			}
+	users = ldapProxy.addMemberOf(searchCtx, users)
+	users = ldapProxy.authorizeResults(sess.context, req.Filter, users)
+
+	if sizeLimit > 0 && len(users) > sizeLimit {
+		searchLimitsExceededTotal.With(prometheus.Labels{"limit": limitSize}).Inc()
+		res.Code = ldap.ResultSizeLimitExceeded
+		users = users[:sizeLimit]
+	}
 
-			searchResults = append(searchResults, &searchResult)
+	var searchResults []*ldap.SearchResult
+	for _, user := range users {
+		if anonymous {
+			user = ldapProxy.config.Anonymous.restrict(user)
+		}
+		if redacted {
+			user = &User{DN: user.DN, Attributes: ldapProxy.config.Redaction.Redact(user.Attributes)}
 		}
+		user = selectAttributes(user, req.Attributes)
+		user = applyValueRules(sess.valueRules(), applyValueRules(ldapProxy.config.ValueRules, user))
+		searchResults = append(searchResults, typesOnly(toSearchResult(maskUser(sess.masking(), user)), req.TypesOnly))
 	}
 
+	reportAnomalies(ldapProxy.config.Anomaly.Operation(getDn(sess.context), "search", len(searchResults)))
+
 	res.Results = searchResults
 
 	return res, nil
 }
 
+// searchBackends queries all backends concurrently, bounded by the configured
+// search concurrency, and merges the users with the configured merge strategy.
+// Of a group of replicas only one backend is queried. The first failing
+// backend aborts the search. If every backend timed out or was unavailable
+// errBackendsUnreachable is returned.
+func (ldapProxy *LdapProxy) searchBackends(ctx context.Context, f ldap.Filter) ([]*User, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type backendResult struct {
+		index       int
+		users       []*User
+		err         error
+		unreachable bool
+	}
+
+	targets := ldapProxy.searchTargets(ctx)
+
+	concurrency := ldapProxy.config.SearchConcurrency
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+
+	results := make(chan backendResult, len(targets))
+	slots := make(chan struct{}, concurrency)
+
+	for i, replicas := range targets {
+		go func(index int, replicas []Backend) {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var users []*User
+			var err error
+
+			// replicas are tried in order until one answers
+			unreachable := true
+			for _, backend := range replicas {
+				if ctx.Err() != nil {
+					results <- backendResult{index: index, err: ctx.Err()}
+					return
+				}
+
+				result := ldapProxy.searchBackend(ctx, backend, f)
+				users, err = result.users, result.err
+
+				if result.timedOut {
+					backendTimeoutsTotal.With(prometheus.Labels{"action": actionSearch, "backend": backend.Name()}).Inc()
+					ldapProxy.observeReplica(backend, actionSearch, replicaTimeout, 0)
+					log.ForBackend(backend.Name()).Printf("backend %s timed out searching, skipped", backend.Name())
+					users, err = nil, nil
+					continue
+				}
+
+				if err == ErrBackendUnavailable {
+					ldapProxy.observeReplica(backend, actionSearch, replicaUnavailable, 0)
+					log.ForBackend(backend.Name()).Debugf("backend %s unavailable, skipped", backend.Name())
+					users, err = nil, nil
+					continue
+				}
+
+				if err != nil {
+					ldapProxy.observeReplica(backend, actionSearch, replicaError, 0)
+				} else {
+					ldapProxy.observeReplica(backend, actionSearch, replicaSuccess, len(users))
+				}
+
+				unreachable = false
+				break
+			}
+
+			results <- backendResult{index: index, users: users, err: err, unreachable: unreachable}
+		}(i, replicas)
+	}
+
+	backendUsers := make([][]*User, len(targets))
+	arrival := make([]int, 0, len(targets))
+	unreachable := len(targets) > 0
+	for range targets {
+		result := <-results
+		if result.err != nil {
+			return nil, result.err
+		}
+		unreachable = unreachable && result.unreachable
+
+		backendUsers[result.index] = result.users
+		arrival = append(arrival, result.index)
+	}
+
+	if unreachable {
+		return nil, errBackendsUnreachable
+	}
+
+	return ldapProxy.config.MergeStrategy.merge(backendUsers, arrival)
+}
+
+// searchBackend queries a single backend. If enabled, identical concurrent
+// searches of the backend are coalesced into one call.
+func (ldapProxy *LdapProxy) searchBackend(ctx context.Context, backend Backend, f ldap.Filter) flightResult {
+	if !ldapProxy.config.CoalesceSearches {
+		return ldapProxy.callBackend(ctx, backend, f, false)
+	}
+
+	// the shared call must outlive single waiters giving up, it's limited by
+	// the backend timeout and cancelled once all waiters are gone
+	// the scope narrows the backend query, so only searches of the same scope
+	// share a call
+	scope, scoped := GetSearchScope(ctx)
+	result, shared, request, err := ldapProxy.flights.do(ctx, ldapProxy.context, flightKey(backend, f, scope), func(callCtx context.Context) flightResult {
+		if scoped {
+			callCtx = WithSearchScope(callCtx, scope)
+		}
+		return ldapProxy.callBackend(callCtx, backend, f, true)
+	})
+	if shared {
+		// the backend logged the search with the id of the call
+		log.ForBackend(backend.Name()).Debugw("search shared", "request", RequestId(ctx), "call", request, "filter", f, "error", err)
+	}
+	if err != nil {
+		return flightResult{err: err}
+	}
+
+	if shared {
+		coalescedSearchesTotal.With(prometheus.Labels{"backend": backend.Name()}).Inc()
+	}
+
+	return result
+}
+
+// callBackend searches the backend, shared marks a call that may be shared by
+// the searches of several requests
+func (ldapProxy *LdapProxy) callBackend(ctx context.Context, backend Backend, f ldap.Filter, shared bool) flightResult {
+	backendCtx, cancelBackend := ldapProxy.backendContext(ctx, backend, actionSearch)
+	defer cancelBackend()
+
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		backendActionDuration.With(prometheus.Labels{"action": actionSearch, "backend": backend.Name()}).Observe(v)
+	}))
+	start := time.Now()
+	users, err := backend.GetUsers(backendCtx, f)
+	timer.ObserveDuration()
+	users = ldapProxy.filterBackend(backend, f, users)
+	users = ldapProxy.limitBackend(backend, users)
+
+	timedOut := isTimeout(ctx, backendCtx)
+	log.ForBackend(backend.Name()).Debugw("search", "request", RequestId(ctx), "shared", shared, "filter", f, "entries", len(users), "error", err, "duration", time.Since(start))
+	ldapProxy.monitor.backendCall(backend.Name(), actionSearch, err != nil && err != ErrBackendUnavailable && !timedOut, timedOut)
+
+	return flightResult{users: users, err: err, timedOut: timedOut}
+}
+
+// backendContext derives the context for a single backend call, limited by the
+// timeout configured for the backend or the proxy wide backend timeout
+func (ldapProxy *LdapProxy) backendContext(ctx context.Context, backend Backend, action string) (context.Context, context.CancelFunc) {
+	timeout := ldapProxy.config.BackendTimeout
+	if timeouts, ok := ldapProxy.config.BackendTimeouts[backend.Name()]; ok {
+		timeout = timeouts.timeout(action, timeout)
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// isTimeout reports whether the backend call failed because of its own
+// deadline rather than the operation being aborted
+func isTimeout(ctx context.Context, backendCtx context.Context) bool {
+	return ctx.Err() == nil && backendCtx.Err() == context.DeadlineExceeded
+}
+
+func reportAnomalies(events []*anomaly.Event) {
+	for _, event := range events {
+		anomaliesTotal.With(prometheus.Labels{"kind": event.Kind}).Inc()
+		log.Printf("ANOMALY %s", event)
+	}
+}
+
+func maskUser(profile *masking.Profile, user *User) *User {
+	if profile == nil {
+		return user
+	}
+
+	return &User{
+		DN:         profile.MaskDN(user.DN),
+		Attributes: profile.Mask(user.Attributes),
+	}
+}
+
+func applyValueRules(policy *valuerules.Policy, user *User) *User {
+	if policy == nil {
+		return user
+	}
+
+	return &User{DN: user.DN, Attributes: policy.Apply(user.Attributes)}
+}
+
+func toSearchResult(user *User) *ldap.SearchResult {
+	searchResult := &ldap.SearchResult{
+		DN:         user.DN,
+		Attributes: map[string][][]byte{},
+	}
+
+	for key, values := range user.Attributes {
+		convertedValues := [][]byte{}
+		for _, value := range values {
+			convertedValues = append(convertedValues, []byte(value))
+		}
+		searchResult.Attributes[key] = convertedValues
+	}
+
+	return searchResult
+}
+
 func (ldapProxy *LdapProxy) Whoami(ctx ldap.Context) (string, error) {
-	sess, ok := ctx.(*session)
-	if !ok {
-		return "", errInvalidSessionType
+	ldapProxy, done := ldapProxy.acquire()
+	defer done()
+
+	sess, err := getSession(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	requestsTotal.With(prometheus.Labels{"action": "whoami"}).Inc()
 
-	return getDn(sess.context), nil
+	return ldapProxy.config.AuthzIdFormat.authzId(getDn(sess.context)), nil
 }
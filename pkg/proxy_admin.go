@@ -0,0 +1,242 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/approval"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	"time"
+)
+
+// defaultLogLevel names the level of the components without override
+const defaultLogLevel = "default"
+
+var _ admin.Sessions = &LdapProxy{}
+var _ admin.Backends = &LdapProxy{}
+var _ admin.Health = &LdapProxy{}
+var _ admin.Lockouts = &LdapProxy{}
+var _ admin.Approvals = &LdapProxy{}
+var _ admin.LogLevels = &LdapProxy{}
+
+// getSession returns the session of a request. Killed sessions return an
+// error, so the connection is closed.
+func getSession(ctx ldap.Context) (*session, error) {
+	sess, ok := sessionOf(ctx)
+	if !ok {
+		return nil, errInvalidSessionType
+	}
+
+	if sess.context.Err() != nil {
+		return nil, errSessionKilled
+	}
+
+	return sess, nil
+}
+
+// track records the current state of the session for the admin api. It must
+// be called by the goroutine serving the session.
+func (ldapProxy *LdapProxy) track(sess *session) {
+	info := &admin.Session{
+		Id:         getId(sess.context),
+		DN:         getDn(sess.context),
+		Backend:    getBackend(sess.context),
+		Attributes: getAttributes(sess.context),
+		Connected:  time.Now(),
+	}
+	if addr := getRemoteAddr(sess.context); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	if location := getLocation(sess.context); location != nil {
+		info.Location = location.String()
+	}
+	if sess.listener != nil {
+		info.Listener = sess.listener.config.Name
+	}
+
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	if existing, ok := ldapProxy.sessions[sess]; ok {
+		info.Connected = existing.Connected
+	}
+	ldapProxy.sessions[sess] = info
+}
+
+func (ldapProxy *LdapProxy) untrack(sess *session) {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	delete(ldapProxy.sessions, sess)
+}
+
+func (ldapProxy *LdapProxy) Sessions() []admin.Session {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	sessions := make([]admin.Session, 0, len(ldapProxy.sessions))
+	for _, info := range ldapProxy.sessions {
+		sessions = append(sessions, *info)
+	}
+
+	return sessions
+}
+
+// KillSession cancels the session. Its connection is closed with the next
+// request.
+func (ldapProxy *LdapProxy) KillSession(id int64) error {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	for sess, info := range ldapProxy.sessions {
+		if info.Id == id {
+			sess.cancle()
+			log.Printf("Killed session %d of %s", id, info.DN)
+			return nil
+		}
+	}
+
+	return admin.ErrNotFound
+}
+
+func (ldapProxy *LdapProxy) Backends() []admin.Backend {
+	ldapProxy = ldapProxy.current()
+
+	backends := make([]admin.Backend, 0, len(ldapProxy.ordered))
+	for _, backend := range ldapProxy.ordered {
+		backends = append(backends, admin.Backend{
+			Name:    backend.Name(),
+			Enabled: ldapProxy.isEnabled(backend.Name()),
+		})
+	}
+
+	return backends
+}
+
+// SetBackendEnabled enables or disables a backend. Disabled backends are
+// neither asked to authenticate nor searched.
+func (ldapProxy *LdapProxy) SetBackendEnabled(name string, enabled bool) error {
+	ldapProxy = ldapProxy.current()
+
+	if _, ok := ldapProxy.backends[name]; !ok {
+		return admin.ErrNotFound
+	}
+
+	// cached results may be missing the entries of the backend
+	defer ldapProxy.FlushCache()
+
+	ldapProxy.mutex.Lock()
+	if enabled {
+		delete(ldapProxy.disabled, name)
+		log.Printf("Enabled backend '%s'", name)
+	} else {
+		ldapProxy.disabled[name] = true
+		log.Printf("Disabled backend '%s'", name)
+	}
+	ldapProxy.mutex.Unlock()
+
+	// the naming contexts list the enabled backends only
+	ldapProxy.publishRootDSE()
+
+	return nil
+}
+
+func (ldapProxy *LdapProxy) isEnabled(name string) bool {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	return !ldapProxy.disabled[name]
+}
+
+// ResetLockout forgets the failed binds of the dn and ends its cooldown. The
+// failures of the source ips are kept.
+func (ldapProxy *LdapProxy) ResetLockout(dn string) error {
+	if !ldapProxy.current().config.Lockout.Reset(dn) {
+		return admin.ErrNotFound
+	}
+
+	log.Printf("Reset the lockout of %s", dn)
+	return nil
+}
+
+// Approvals lists the sensitive operations waiting for an operator, none if
+// they are approved by a webhook.
+func (ldapProxy *LdapProxy) Approvals() []admin.Approval {
+	approvals := []admin.Approval{}
+
+	pending := ldapProxy.current().config.Approval.Pending()
+	if pending == nil {
+		return approvals
+	}
+
+	for _, req := range pending.List() {
+		approvals = append(approvals, admin.Approval{
+			Id:         req.Id,
+			Operation:  req.Operation,
+			DN:         req.DN,
+			BoundDN:    req.BoundDN,
+			Attributes: req.Attributes,
+		})
+	}
+
+	return approvals
+}
+
+// DecideApproval forwards or refuses the waiting operation with the id.
+func (ldapProxy *LdapProxy) DecideApproval(id string, approved bool) error {
+	pending := ldapProxy.current().config.Approval.Pending()
+	if pending == nil || pending.Decide(id, approved) == approval.ErrUnknownRequest {
+		return admin.ErrNotFound
+	}
+
+	log.Printf("Decided on approval %s, approved: %t", id, approved)
+	return nil
+}
+
+// LogLevels returns the overridden log levels and the level of the debug
+// flag as default.
+func (ldapProxy *LdapProxy) LogLevels() map[string]string {
+	levels := map[string]string{defaultLogLevel: log.DefaultLevel().String()}
+	for component, level := range log.Levels() {
+		levels[component] = level.String()
+	}
+
+	return levels
+}
+
+// SetLogLevel overrides the log level of the component until the next start.
+func (ldapProxy *LdapProxy) SetLogLevel(component string, level string) error {
+	if level == defaultLogLevel {
+		log.ResetLevel(component)
+		log.Printf("Reset the log level of %s", component)
+		return nil
+	}
+
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return admin.ErrUnknownLevel
+	}
+
+	log.SetLevel(component, parsed)
+	log.Printf("Set the log level of %s to %s", component, parsed)
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/approval"
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestLdapProxy_Sessions(t *testing.T) {
+	Convey("Given a ldap proxy with a bound session", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{result: true})
+
+		ctx, _ := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000})
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+		Convey("When the sessions are listed", func() {
+			sessions := proxy.Sessions()
+
+			Convey("Then the session is listed with its bind dn and backend", func() {
+				So(sessions, ShouldHaveLength, 1)
+				So(sessions[0].DN, ShouldEqual, "cn=test")
+				So(sessions[0].Backend, ShouldEqual, "test")
+				So(sessions[0].RemoteAddr, ShouldEqual, "10.0.0.1:40000")
+			})
+		})
+
+		Convey("When the session is killed", func() {
+			err := proxy.KillSession(proxy.Sessions()[0].Id)
+			_, searchErr := proxy.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then further requests fail", func() {
+				So(err, ShouldBeNil)
+				So(searchErr, ShouldEqual, errSessionKilled)
+			})
+		})
+
+		Convey("When an unknown session is killed", func() {
+			err := proxy.KillSession(-2)
+
+			Convey("Then the session isn't found", func() {
+				So(err, ShouldEqual, admin.ErrNotFound)
+			})
+		})
+
+		Convey("When the session disconnects", func() {
+			proxy.Disconnect(ctx)
+
+			Convey("Then it isn't listed anymore", func() {
+				So(proxy.Sessions(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_SetBackendEnabled(t *testing.T) {
+	Convey("Given a ldap proxy with a backend", t, func() {
+		proxy := NewLdapProxy()
+		backend := &testBackend{result: true, user: []*User{{DN: "cn=a"}}}
+		proxy.AddBackend(backend)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When the backend is disabled", func() {
+			err := proxy.SetBackendEnabled("test", false)
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the backend isn't asked anymore", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(backend.lastUsername, ShouldEqual, "")
+				So(proxy.Backends(), ShouldResemble, []admin.Backend{{Name: "test", Enabled: false}})
+			})
+		})
+
+		Convey("When an unknown backend is disabled", func() {
+			err := proxy.SetBackendEnabled("unknown", false)
+
+			Convey("Then the backend isn't found", func() {
+				So(err, ShouldEqual, admin.ErrNotFound)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_ResetLockout(t *testing.T) {
+	Convey("Given a ldap proxy locking out after a failed bind", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{result: false})
+
+		guard, err := lockout.New(&lockout.Config{MaxFailures: 1})
+		So(err, ShouldBeNil)
+		config := DefaultProxyConfig()
+		config.Lockout = guard
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+		proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("wrong")})
+		So(guard.Locked("cn=test", nil), ShouldBeTrue)
+
+		Convey("When the lockout of the dn is reset", func() {
+			err := proxy.ResetLockout("cn=test")
+
+			Convey("Then the dn isn't locked out anymore", func() {
+				So(err, ShouldBeNil)
+				So(guard.Locked("cn=test", nil), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the lockout of a dn without failures is reset", func() {
+			err := proxy.ResetLockout("cn=other")
+
+			Convey("Then the dn isn't found", func() {
+				So(err, ShouldEqual, admin.ErrNotFound)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_Approvals(t *testing.T) {
+	Convey("Given a ldap proxy holding deletes for an operator", t, func() {
+		corp := &testWriterBackend{testBackend: testBackend{name: "corp"}}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(corp)
+
+		guard, err := approval.New(&approval.Config{Rules: []approval.Rule{{Operation: approval.OperationDelete, DN: "dc=example,dc=com"}}})
+		So(err, ShouldBeNil)
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}}
+		config.Writable = map[string]bool{"corp": true}
+		config.Approval = guard
+		proxy.Configure(config)
+
+		sess := &session{context: setDn(context.Background(), "cn=test")}
+		deleted := make(chan ldap.ResultCode, 1)
+		go func() {
+			res, _ := proxy.Delete(sess, &ldap.DeleteRequest{DN: "uid=a,dc=example,dc=com"})
+			deleted <- res.Code
+		}()
+		for len(proxy.Approvals()) == 0 {
+			runtime.Gosched()
+		}
+		approvals := proxy.Approvals()
+
+		Convey("When the waiting delete is approved", func() {
+			err := proxy.DecideApproval(approvals[0].Id, true)
+
+			Convey("Then it is forwarded to the backend", func() {
+				So(err, ShouldBeNil)
+				So(<-deleted, ShouldEqual, ldap.ResultSuccess)
+				So(corp.written, ShouldResemble, []string{"delete uid=a,dc=example,dc=com"})
+				So(approvals[0].DN, ShouldEqual, "uid=a,dc=example,dc=com")
+				So(approvals[0].BoundDN, ShouldEqual, "cn=test")
+			})
+		})
+
+		Convey("When the waiting delete is rejected", func() {
+			err := proxy.DecideApproval(approvals[0].Id, false)
+
+			Convey("Then it is refused", func() {
+				So(err, ShouldBeNil)
+				So(<-deleted, ShouldEqual, ldap.ResultInsufficientAccessRights)
+				So(corp.written, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an unknown approval is decided on", func() {
+			err := proxy.DecideApproval("unknown", true)
+			proxy.DecideApproval(approvals[0].Id, false)
+			<-deleted
+
+			Convey("Then it isn't found", func() {
+				So(err, ShouldEqual, admin.ErrNotFound)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_SetLogLevel(t *testing.T) {
+	Convey("Given a ldap proxy", t, func() {
+		proxy := NewLdapProxy()
+		Reset(func() { log.ResetLevel("backend.ad") })
+
+		Convey("When the log level of a backend is set", func() {
+			err := proxy.SetLogLevel("backend.ad", "debug")
+
+			Convey("Then the backend logs with the level", func() {
+				So(err, ShouldBeNil)
+				So(log.LevelOf("backend.ad"), ShouldEqual, log.LevelDebug)
+				So(proxy.LogLevels(), ShouldResemble, map[string]string{"default": "info", "backend.ad": "debug"})
+			})
+
+			Convey("And the level is reset to the default", func() {
+				err := proxy.SetLogLevel("backend.ad", "default")
+
+				Convey("Then the backend logs with the default level", func() {
+					So(err, ShouldBeNil)
+					So(log.LevelOf("backend.ad"), ShouldEqual, log.LevelInfo)
+				})
+			})
+		})
+
+		Convey("When an unknown log level is set", func() {
+			err := proxy.SetLogLevel("backend.ad", "verbose")
+
+			Convey("Then the level is refused", func() {
+				So(err, ShouldEqual, admin.ErrUnknownLevel)
+			})
+		})
+	})
+}
@@ -0,0 +1,263 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/acl"
+	"github.com/gopenguin/ldap-proxy/pkg/anomaly"
+	"github.com/gopenguin/ldap-proxy/pkg/approval"
+	"github.com/gopenguin/ldap-proxy/pkg/audit"
+	"github.com/gopenguin/ldap-proxy/pkg/authlog"
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/gopenguin/ldap-proxy/pkg/geoip"
+	"github.com/gopenguin/ldap-proxy/pkg/ipfilter"
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
+	"github.com/gopenguin/ldap-proxy/pkg/memberof"
+	"github.com/gopenguin/ldap-proxy/pkg/mfa"
+	"github.com/gopenguin/ldap-proxy/pkg/ratelimit"
+	"github.com/gopenguin/ldap-proxy/pkg/redaction"
+	"github.com/gopenguin/ldap-proxy/pkg/subschema"
+	"github.com/gopenguin/ldap-proxy/pkg/totp"
+	"github.com/gopenguin/ldap-proxy/pkg/valuerules"
+	"time"
+)
+
+// ProxyConfig contains the settings of the proxy itself, independent of the
+// configured backends.
+type ProxyConfig struct {
+	// The maximum number of backends queried at the same time during a search.
+	// Zero or less queries all backends at once.
+	SearchConcurrency int
+
+	// The maximum number of open connections, in total and per source ip.
+	// Zero or less doesn't limit the connections.
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	// The deadline for a single backend call. Zero disables the deadline.
+	BackendTimeout time.Duration
+
+	// Timeouts overriding the backend timeout, by backend name. Backends
+	// exceeding their deadline are skipped.
+	BackendTimeouts map[string]Timeouts
+
+	// The maximum number of entries and the maximum duration of a search, also
+	// if the client requests more. Zero doesn't limit the searches.
+	SizeLimit int
+	TimeLimit time.Duration
+
+	// The maximum nesting depth of the and, or and not filters of a search,
+	// the maximum number of filter components and the maximum number of
+	// wildcards of a substring filter. Searches exceeding them are refused
+	// before they reach the backends. Zero or less doesn't limit the filters.
+	MaxFilterDepth      int
+	MaxFilterComponents int
+	MaxFilterWildcards  int
+
+	// The maximum number of entries taken from a backend, by backend name.
+	BackendSizeLimits map[string]int
+
+	// Backends returning entries regardless of the filter, by backend name.
+	// The proxy evaluates the filter against their entries.
+	FilterResults map[string]bool
+
+	// The replica groups of the backends, by backend name. A search only
+	// queries one backend of each group.
+	Replicas map[string]Replica
+
+	// The suffixes of the directories of the backends, by backend name. The
+	// root dse lists them as naming contexts.
+	NamingContexts map[string][]string
+
+	// The backends accepting writes of their naming contexts, by backend
+	// name. Writes of the other backends are refused.
+	Writable map[string]bool
+
+	// Answer searches of naming contexts no backend owns. Nil answers them
+	// with an empty result.
+	Referrals []Referral
+
+	// Decides which sessions may read, search and write which attributes of
+	// which entries. Nil allows everything.
+	ACL *acl.Policy
+
+	// Strips or masks sensitive attributes like userPassword from the search
+	// results of sessions not allowed to see them. Nil redacts nothing.
+	Redaction *redaction.Redactor
+
+	// Drops, replaces or truncates values of the search results, e.g.
+	// internal host names. Nil returns the values unchanged.
+	ValueRules *valuerules.Policy
+
+	// The view of sessions without bound dn. Nil refuses their searches.
+	Anonymous *AnonymousAccess
+
+	// Entries of these subtrees are never deleted, e.g. ou=system.
+	ProtectedSubtrees []string
+
+	// Published as subschema subentry. Nil doesn't publish a schema.
+	Subschema *subschema.Schema
+
+	// The attributes of the bound entry fetched at bind time and kept for the
+	// rest of the session, e.g. memberOf or department.
+	SessionAttributes []string
+
+	// Whether the searches of a session only query the backend which
+	// authenticated the session.
+	SessionAffinity bool
+
+	// Whether identical concurrent searches of a backend are answered by a
+	// single backend call.
+	CoalesceSearches bool
+
+	// Caches the results of searches. Nil disables the cache.
+	SearchCache *cache.Cache
+
+	// Caches successful binds. Nil disables the cache.
+	BindCache *bindcache.Cache
+
+	// Cache empty search results and failed binds, usually for a shorter
+	// time. Nil disables the caches.
+	NegativeSearchCache *cache.Cache
+	NegativeBindCache   *bindcache.Cache
+
+	// Keep the last result of every search and the last successful bind of
+	// every user, usually for a long time. They answer the requests while
+	// all backends are unreachable. Nil disables the offline fallback.
+	OfflineSearchCache *cache.Cache
+	OfflineBindCache   *bindcache.Cache
+
+	// How the entries of multiple backends are combined.
+	MergeStrategy MergeStrategy
+
+	// Whether binds with a dn but without password are passed to the
+	// backends. They are refused with unwillingToPerform otherwise (RFC 4513
+	// section 5.1.2).
+	UnauthenticatedBinds bool
+
+	// Whether the backend refusing a bind is asked if the account is locked
+	// or disabled. Those binds fail with a distinct message and the other
+	// backends aren't asked.
+	AccountStatus bool
+
+	// How whoami returns the identity of a session.
+	AuthzIdFormat AuthzIdFormat
+
+	// Whether the proxy is only ready while all enabled backends pass their
+	// health checks instead of at least one.
+	ReadyAllBackends bool
+
+	// Whether the counters of the proxy are served as cn=Monitor subtree.
+	Monitor bool
+
+	// Records the binds, searches and writes of the clients. Nil disables
+	// the audit log.
+	Audit *audit.Logger
+
+	// Logs every failed bind as a line for fail2ban or CrowdSec. Nil doesn't
+	// log the failures separately.
+	AuthLog *authlog.Logger
+
+	// Guards sensitive operations which require an external approval. Nil
+	// disables the approval workflow.
+	Approval *approval.Guard
+
+	// Decides which source ips may connect. Nil allows every ip.
+	IPFilter *ipfilter.Policy
+
+	// Throttles binds and searches per source ip and dn. Nil doesn't limit
+	// the rate.
+	RateLimit *ratelimit.Limiter
+
+	// Requires a one-time password appended to the bind password of the
+	// enrolled users. Nil binds with the password only.
+	TOTP *totp.Verifier
+
+	// Asks an external service for the second factor once the backend
+	// accepted the password. Nil doesn't ask for a second factor.
+	MFA *mfa.Guard
+
+	// Computes memberOf from the groups of the backends for entries without
+	// it. Nil returns memberOf only if the backends maintain it.
+	MemberOf *memberof.Resolver
+
+	// Looks up the country and autonomous system of the clients for the
+	// audit log, the admin api and the metrics. Nil doesn't locate clients.
+	GeoIP *geoip.Locator
+
+	// Locks out dns and source ips after repeated failed binds. Nil disables
+	// the lockout.
+	Lockout *lockout.Guard
+
+	// Reports sessions deviating from the learned behavior of the bound
+	// identity. Nil disables the detection.
+	Anomaly *anomaly.Detector
+}
+
+func DefaultProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		SearchConcurrency:   8,
+		MaxFilterDepth:      32,
+		MaxFilterComponents: 1000,
+		MaxFilterWildcards:  16,
+		BackendTimeout:      30 * time.Second,
+		CoalesceSearches:    true,
+		MergeStrategy:       MergeAll,
+		AuthzIdFormat:       AuthzIdDN,
+	}
+}
+
+// Replica marks a backend as a copy of the directory of the other backends in
+// its group. Searches are distributed over the group by weight, falling back
+// to the other replicas if the chosen one is unavailable or too slow.
+// Binds are split the same way by bind weight once a replica of the group has
+// one, e.g. to send a small share of the traffic to a new directory.
+type Replica struct {
+	Group string
+
+	// Zero or less counts as one.
+	Weight int
+
+	// Zero or less counts as one. If no replica of the group has a bind
+	// weight, every replica is asked in turn.
+	BindWeight int
+}
+
+// Timeouts limit the calls of a single backend. Zero falls back to the proxy
+// wide backend timeout.
+type Timeouts struct {
+	Authenticate time.Duration
+	GetUsers     time.Duration
+}
+
+func (timeouts Timeouts) timeout(action string, fallback time.Duration) time.Duration {
+	timeout := timeouts.GetUsers
+	if action == actionAuth {
+		timeout = timeouts.Authenticate
+	}
+
+	if timeout == 0 {
+		return fallback
+	}
+
+	return timeout
+}
@@ -22,6 +22,8 @@ package pkg
 
 import (
 	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/geoip"
+	"net"
 	"sync/atomic"
 )
 
@@ -30,6 +32,13 @@ type proxyContextKey int
 const (
 	contextKeyId = proxyContextKey(iota)
 	contextKeyDn
+	contextKeyRemoteAddr
+	contextKeyBackend
+	contextKeyAttributes
+	contextKeyScope
+	contextKeyLocation
+	contextKeyRequestId
+	contextKeyOffline
 )
 
 var (
@@ -61,3 +70,89 @@ func getDn(ctx context.Context) string {
 		return value.(string)
 	}
 }
+
+func setRemoteAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, contextKeyRemoteAddr, addr)
+}
+
+func getRemoteAddr(ctx context.Context) net.Addr {
+	value := ctx.Value(contextKeyRemoteAddr)
+	if value == nil {
+		return nil
+	} else {
+		return value.(net.Addr)
+	}
+}
+
+// setBackend remembers the name of the backend which authenticated the session
+func setBackend(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKeyBackend, name)
+}
+
+func getBackend(ctx context.Context) string {
+	value := ctx.Value(contextKeyBackend)
+	if value == nil {
+		return ""
+	} else {
+		return value.(string)
+	}
+}
+
+// setAttributes stores the attributes of the bound entry fetched at bind time
+func setAttributes(ctx context.Context, attributes map[string][]string) context.Context {
+	return context.WithValue(ctx, contextKeyAttributes, attributes)
+}
+
+func getAttributes(ctx context.Context) map[string][]string {
+	value := ctx.Value(contextKeyAttributes)
+	if value == nil {
+		return nil
+	} else {
+		return value.(map[string][]string)
+	}
+}
+
+// setLocation remembers the location of the client looked up at connect time
+func setLocation(ctx context.Context, location *geoip.Location) context.Context {
+	return context.WithValue(ctx, contextKeyLocation, location)
+}
+
+func getLocation(ctx context.Context) *geoip.Location {
+	value := ctx.Value(contextKeyLocation)
+	if value == nil {
+		return nil
+	} else {
+		return value.(*geoip.Location)
+	}
+}
+
+// setRequestId marks the context of a single request with its id
+func setRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKeyRequestId, id)
+}
+
+// setOffline adds the flag of the request set once it is answered from the
+// offline caches
+func setOffline(ctx context.Context, offline *int32) context.Context {
+	return context.WithValue(ctx, contextKeyOffline, offline)
+}
+
+// markOffline records that the request of the context is answered from the
+// offline caches
+func markOffline(ctx context.Context) {
+	if value := ctx.Value(contextKeyOffline); value != nil {
+		atomic.StoreInt32(value.(*int32), 1)
+	}
+}
+
+// RequestId returns the id of the request a backend is called for, empty if
+// the call isn't made for a client request. Backends add it to their log
+// lines and pass it on to their upstreams where possible.
+func RequestId(ctx context.Context) string {
+	value := ctx.Value(contextKeyRequestId)
+	if value == nil {
+		return ""
+	} else {
+		return value.(string)
+	}
+}
@@ -23,6 +23,7 @@ package pkg
 import (
 	"context"
 	. "github.com/smartystreets/goconvey/convey"
+	"net"
 	"testing"
 )
 
@@ -48,5 +49,33 @@ func TestSetSessId(t *testing.T) {
 				So(getId(ctx), ShouldEqual, -1)
 			})
 		})
+
+		Convey("When the remote address is set", func() {
+			addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 10636}
+			ctx = setRemoteAddr(ctx, addr)
+
+			Convey("Then the address can be retrieved from the context", func() {
+				So(getRemoteAddr(ctx), ShouldEqual, addr)
+				So(getDn(ctx), ShouldEqual, "")
+			})
+		})
+
+		Convey("When the attributes are set", func() {
+			ctx = setAttributes(ctx, map[string][]string{"department": {"IT"}})
+
+			Convey("Then the attributes can be retrieved from the context", func() {
+				So(getAttributes(ctx), ShouldResemble, map[string][]string{"department": {"IT"}})
+				So(getDn(ctx), ShouldEqual, "")
+			})
+		})
+
+		Convey("When the backend is set", func() {
+			ctx = setBackend(ctx, "corp")
+
+			Convey("Then the backend can be retrieved from the context", func() {
+				So(getBackend(ctx), ShouldEqual, "corp")
+				So(getDn(ctx), ShouldEqual, "")
+			})
+		})
 	})
 }
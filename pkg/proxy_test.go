@@ -22,9 +22,24 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg/anomaly"
+	"github.com/gopenguin/ldap-proxy/pkg/authlog"
+	"github.com/gopenguin/ldap-proxy/pkg/lockout"
+	"github.com/gopenguin/ldap-proxy/pkg/mfa"
+	"github.com/gopenguin/ldap-proxy/pkg/ratelimit"
+	"github.com/gopenguin/ldap-proxy/pkg/totp"
 	"github.com/samuel/go-ldap/ldap"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type wrongSession struct{}
@@ -111,12 +126,184 @@ func TestLdapproxy_Bind(t *testing.T) {
 					So(res.MatchedDN, ShouldEqual, dn)
 					So(tb.lastUsername, ShouldEqual, dn)
 					So(tb.lastPassword, ShouldEqual, pw)
+					So(getBackend(sess.context), ShouldEqual, "test")
+				})
+			})
+
+			Convey("When there is a bind request with a dn but without password", func() {
+				ctx, cancle := context.WithCancel(context.Background())
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com"})
+
+				Convey("Then the bind is refused without invoking the backend", func() {
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+					So(tb.lastUsername, ShouldBeBlank)
+					So(getDn(sess.context), ShouldBeBlank)
+				})
+			})
+
+			Convey("When unauthenticated binds are allowed", func() {
+				config := DefaultProxyConfig()
+				config.UnauthenticatedBinds = true
+				proxy.Configure(config)
+
+				ctx, cancle := context.WithCancel(context.Background())
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com"})
+
+				Convey("Then the bind is passed to the backend", func() {
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultSuccess)
+					So(tb.lastUsername, ShouldEqual, "uid=test,ou=People,dc=example,dc=com")
+				})
+			})
+
+			Convey("When the binds of an ip exceed the rate limit", func() {
+				limiter, err := ratelimit.New(&ratelimit.Config{Bind: &ratelimit.Limits{PerIP: &ratelimit.Bucket{Rate: 1}}})
+				So(err, ShouldBeNil)
+				config := DefaultProxyConfig()
+				config.RateLimit = limiter
+				proxy.Configure(config)
+
+				ctx, _ := proxy.Connect(&net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000})
+				first, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+				second, err := proxy.Bind(ctx, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+
+				Convey("Then the bind is refused with busy", func() {
+					So(err, ShouldBeNil)
+					So(first.Code, ShouldEqual, ldap.ResultSuccess)
+					So(second.Code, ShouldEqual, ldap.ResultBusy)
+				})
+			})
+
+			Convey("When a dn is locked out after failed binds", func() {
+				guard, err := lockout.New(&lockout.Config{MaxFailures: 2})
+				So(err, ShouldBeNil)
+				config := DefaultProxyConfig()
+				config.Lockout = guard
+				proxy.Configure(config)
+
+				ctx, cancle := context.WithCancel(context.Background())
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				tb.result = false
+				proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("wrong")})
+				proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("guess")})
+
+				tb.result = true
+				tb.lastPassword = ""
+				res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+
+				Convey("Then also the right password is refused without invoking the backend", func() {
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+					So(tb.lastPassword, ShouldBeBlank)
+					So(getDn(sess.context), ShouldBeBlank)
+				})
+			})
+
+			Convey("When a user with a one-time password seed binds", func() {
+				verifier, err := totp.New(&totp.Config{Seeds: map[string]string{"uid=test,ou=People,dc=example,dc=com": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}})
+				So(err, ShouldBeNil)
+				config := DefaultProxyConfig()
+				config.TOTP = verifier
+				proxy.Configure(config)
+
+				ctx, cancle := context.WithCancel(context.Background())
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				code := totp.Code([]byte("12345678901234567890"), time.Now().Unix()/30, 6)
+
+				Convey("Then a bind without the code is refused without invoking the backend", func() {
+					tb.lastPassword = ""
+					res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+					So(tb.lastPassword, ShouldBeBlank)
+				})
+
+				Convey("Then a bind with the code passes the password only", func() {
+					res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure" + code)})
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultSuccess)
+					So(tb.lastPassword, ShouldEqual, "secure")
+				})
+			})
+
+			Convey("When the second factor of a bind is denied", func() {
+				config := DefaultProxyConfig()
+				config.MFA = mfa.NewGuard(&deniedSecondFactor{}, false)
+				proxy.Configure(config)
+
+				ctx, cancle := context.WithCancel(context.Background())
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				res, err := proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+
+				Convey("Then the bind fails although the password is valid", func() {
+					So(err, ShouldBeNil)
+					So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+					So(tb.lastPassword, ShouldEqual, "secure")
+					So(getDn(sess.context), ShouldBeBlank)
+				})
+			})
+
+			Convey("When binds fail with an auth log", func() {
+				dir, err := ioutil.TempDir("", "authlog")
+				So(err, ShouldBeNil)
+				defer os.RemoveAll(dir)
+
+				file := filepath.Join(dir, "auth.log")
+				logger, err := authlog.New(&authlog.Config{Output: file})
+				So(err, ShouldBeNil)
+				config := DefaultProxyConfig()
+				config.AuthLog = logger
+				proxy.Configure(config)
+
+				addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4321}
+				ctx, cancle := context.WithCancel(setRemoteAddr(context.Background(), addr))
+				sess := &session{
+					context: ctx,
+					cancle:  cancle,
+				}
+				tb.result = false
+				proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("wrong")})
+				proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com"})
+				tb.result = true
+				proxy.Bind(sess, &ldap.BindRequest{DN: "uid=test,ou=People,dc=example,dc=com", Password: []byte("secure")})
+
+				Convey("Then a line is written for each failure", func() {
+					content, err := ioutil.ReadFile(file)
+					So(err, ShouldBeNil)
+					lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+					So(lines, ShouldHaveLength, 2)
+					So(lines[0], ShouldEndWith, `authentication failure; reason=invalid_credentials rhost=192.0.2.1 dn="uid=test,ou=People,dc=example,dc=com"`)
+					So(lines[1], ShouldContainSubstring, "reason=unauthenticated rhost=192.0.2.1")
 				})
 			})
 		})
 	})
 }
 
+type deniedSecondFactor struct{}
+
+func (deniedSecondFactor) Approve(ctx context.Context, req *mfa.Request) (bool, error) {
+	return false, nil
+}
+
 func TestLdapProxy_Whoami(t *testing.T) {
 	Convey("Given a ldap proxy", t, func() {
 		proxy := NewLdapProxy()
@@ -130,7 +317,37 @@ func TestLdapProxy_Whoami(t *testing.T) {
 
 			Convey("Then the id should be returned", func() {
 				So(err, ShouldBeNil)
-				So(id, ShouldEqual, "uid=test,ou=People,dc=example,dc=com")
+				So(id, ShouldEqual, "dn:uid=test,ou=People,dc=example,dc=com")
+			})
+		})
+
+		Convey("When the identity is returned as user", func() {
+			config := DefaultProxyConfig()
+			config.AuthzIdFormat = AuthzIdUser
+			proxy.Configure(config)
+
+			ctx, cancle := context.WithCancel(setDn(context.Background(), "uid=test,ou=People,dc=example,dc=com"))
+			id, err := proxy.Whoami(&session{
+				context: ctx,
+				cancle:  cancle,
+			})
+
+			Convey("Then the value of the first rdn should be returned", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "u:test")
+			})
+		})
+
+		Convey("When there is a whoami request of an anonymous session", func() {
+			ctx, cancle := context.WithCancel(context.Background())
+			id, err := proxy.Whoami(&session{
+				context: ctx,
+				cancle:  cancle,
+			})
+
+			Convey("Then the id should be empty", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldBeBlank)
 			})
 		})
 
@@ -144,3 +361,162 @@ func TestLdapProxy_Whoami(t *testing.T) {
 		})
 	})
 }
+
+// startedBackend closes started once a search reached the backend
+type startedBackend struct {
+	testBackend
+
+	once    sync.Once
+	started chan struct{}
+}
+
+func newStartedBackend(backend testBackend) *startedBackend {
+	return &startedBackend{testBackend: backend, started: make(chan struct{})}
+}
+
+func (backend *startedBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*User, error) {
+	backend.once.Do(func() { close(backend.started) })
+
+	return backend.testBackend.GetUsers(ctx, f)
+}
+
+func TestLdapProxy_Search(t *testing.T) {
+	Convey("Given a ldap proxy with two slow backends and an authenticated session", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(
+			&testBackend{name: "a", delay: 100 * time.Millisecond, user: []*User{{DN: "cn=a"}}},
+			&testBackend{name: "b", delay: 100 * time.Millisecond, user: []*User{{DN: "cn=b"}}},
+		)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When there is a search request", func() {
+			start := time.Now()
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backends are queried concurrently and the results are merged", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 2)
+				So(time.Since(start), ShouldBeLessThan, 190*time.Millisecond)
+			})
+		})
+
+		Convey("When the backend timeout is shorter than the backends need", func() {
+			config := DefaultProxyConfig()
+			config.BackendTimeout = 10 * time.Millisecond
+			proxy.Configure(config)
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backends are skipped", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 0)
+			})
+		})
+
+		Convey("When only one backend has a shorter timeout", func() {
+			config := DefaultProxyConfig()
+			config.BackendTimeouts = map[string]Timeouts{"a": {GetUsers: 10 * time.Millisecond}}
+			proxy.Configure(config)
+
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only this backend is skipped", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn=b")
+			})
+		})
+
+		Convey("When there are identical concurrent search requests", func() {
+			backend := &testBackend{name: "c", delay: 50 * time.Millisecond}
+			proxy.AddBackend(backend)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				}()
+			}
+			wg.Wait()
+
+			Convey("Then the backend is only searched once", func() {
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When coalescing is disabled", func() {
+			config := DefaultProxyConfig()
+			config.CoalesceSearches = false
+			proxy.Configure(config)
+
+			backend := &testBackend{name: "c", delay: 50 * time.Millisecond}
+			proxy.AddBackend(backend)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				}()
+			}
+			wg.Wait()
+
+			Convey("Then every search reaches the backend", func() {
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the client disconnects during a search", func() {
+			backend := newStartedBackend(testBackend{name: "c", delay: time.Second})
+			proxy.AddBackend(backend)
+
+			done := make(chan struct{})
+			var err error
+			go func() {
+				_, err = proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				close(done)
+			}()
+			<-backend.started
+			proxy.Disconnect(sess)
+
+			Convey("Then the backend searches are cancelled", func() {
+				So(closedWithin(done, 500*time.Millisecond), ShouldBeTrue)
+				So(err, ShouldEqual, context.Canceled)
+			})
+		})
+
+		Convey("When the daily quota of the identity is exceeded", func() {
+			config := DefaultProxyConfig()
+			config.Anomaly = anomaly.NewDetector(&anomaly.Config{DailyResultQuota: 1, ThrottleOverQuota: true})
+			proxy.Configure(config)
+
+			proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+			res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then further searches are refused", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultAdminLimitExceeded)
+			})
+		})
+
+		Convey("When a backend fails", func() {
+			proxy.AddBackend(&testBackend{name: "c", err: errors.New("test error")})
+
+			res, err := LogBackend(proxy).Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the search fails with the error and the request id", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultOther)
+				So(res.Message, ShouldStartWith, "test error (request id ")
+			})
+		})
+	})
+}
@@ -0,0 +1,187 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	OperationBind   = "bind"
+	OperationSearch = "search"
+
+	KindIP = "ip"
+	KindDN = "dn"
+
+	sweepInterval = time.Minute
+)
+
+// Config contains the limits of binds and searches. Operations without limits
+// aren't throttled.
+type Config struct {
+	Bind   *Limits `json:"bind"`
+	Search *Limits `json:"search"`
+}
+
+// Limits of an operation per source ip and per dn. The dn of a bind is the
+// bind dn, the dn of a search the bound dn.
+type Limits struct {
+	PerIP *Bucket `json:"perIp"`
+	PerDN *Bucket `json:"perDn"`
+}
+
+// A Bucket refills rate tokens per second up to burst tokens. Every
+// operation takes a token, without tokens the operation is throttled.
+type Bucket struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// A Limiter keeps a token bucket per operation and source ip or dn. All
+// methods may be called on a nil limiter, which never throttles.
+type Limiter struct {
+	limits map[string]*Limits
+
+	now func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limit  *Bucket
+	tokens float64
+	last   time.Time
+}
+
+func New(config *Config) (*Limiter, error) {
+	limiter := &Limiter{
+		limits:  make(map[string]*Limits),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+
+	for operation, limits := range map[string]*Limits{OperationBind: config.Bind, OperationSearch: config.Search} {
+		if limits == nil {
+			continue
+		}
+
+		for _, limit := range []*Bucket{limits.PerIP, limits.PerDN} {
+			if limit == nil {
+				continue
+			}
+			if limit.Rate <= 0 {
+				return nil, fmt.Errorf("ratelimit: the rate of %s must be positive", operation)
+			}
+			if limit.Burst <= 0 {
+				limit.Burst = int(math.Ceil(limit.Rate))
+			}
+		}
+		limiter.limits[operation] = limits
+	}
+
+	limiter.lastSweep = limiter.now()
+
+	return limiter, nil
+}
+
+// Allow takes a token of the operation from the buckets of the source ip and
+// the dn. If a bucket is empty the kind of the bucket is returned.
+func (limiter *Limiter) Allow(operation string, dn string, addr net.Addr) (throttled string, ok bool) {
+	if limiter == nil {
+		return "", true
+	}
+
+	limits, ok := limiter.limits[operation]
+	if !ok {
+		return "", true
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	if ip := ipOf(addr); ip != "" && limits.PerIP != nil && !limiter.take(operation+":"+KindIP+":"+ip, limits.PerIP, now) {
+		return KindIP, false
+	}
+	if dn != "" && limits.PerDN != nil && !limiter.take(operation+":"+KindDN+":"+util.NormalizeDN(dn), limits.PerDN, now) {
+		return KindDN, false
+	}
+
+	return "", true
+}
+
+func (limiter *Limiter) take(key string, limit *Bucket, now time.Time) bool {
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// sweep forgets the full buckets, they behave like new ones
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for key, b := range limiter.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+func ipOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	return host
+}
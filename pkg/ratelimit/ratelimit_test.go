@@ -0,0 +1,96 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	Convey("Given a limiter of two binds per second per ip and one search per second per dn", t, func() {
+		limiter, err := New(&Config{
+			Bind:   &Limits{PerIP: &Bucket{Rate: 2}},
+			Search: &Limits{PerDN: &Bucket{Rate: 1}},
+		})
+		So(err, ShouldBeNil)
+
+		now := time.Date(2017, 10, 2, 9, 0, 0, 0, time.UTC)
+		limiter.now = func() time.Time { return now }
+		limiter.lastSweep = now
+		client := &net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}
+
+		Convey("When an ip binds three times within a second", func() {
+			_, first := limiter.Allow(OperationBind, "uid=user1", client)
+			_, second := limiter.Allow(OperationBind, "uid=user2", client)
+			kind, third := limiter.Allow(OperationBind, "uid=user3", client)
+
+			Convey("Then the third bind is throttled by the ip", func() {
+				So(first, ShouldBeTrue)
+				So(second, ShouldBeTrue)
+				So(third, ShouldBeFalse)
+				So(kind, ShouldEqual, KindIP)
+			})
+
+			Convey("Then another ip may still bind", func() {
+				_, ok := limiter.Allow(OperationBind, "uid=user1", &net.TCPAddr{IP: net.ParseIP("10.0.0.13"), Port: 40000})
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("Then the bucket refills over time", func() {
+				now = now.Add(500 * time.Millisecond)
+				_, ok := limiter.Allow(OperationBind, "uid=user1", client)
+				So(ok, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a dn searches twice within a second from different ips", func() {
+			_, first := limiter.Allow(OperationSearch, "uid=user1", client)
+			kind, second := limiter.Allow(OperationSearch, "UID=user1", &net.TCPAddr{IP: net.ParseIP("10.0.0.13"), Port: 40000})
+
+			Convey("Then the second search is throttled by the dn", func() {
+				So(first, ShouldBeTrue)
+				So(second, ShouldBeFalse)
+				So(kind, ShouldEqual, KindDN)
+			})
+		})
+
+		Convey("When the buckets are full again", func() {
+			limiter.Allow(OperationBind, "uid=user1", client)
+			now = now.Add(2 * time.Minute)
+			limiter.Allow(OperationSearch, "uid=user1", nil)
+
+			Convey("Then they are forgotten", func() {
+				So(limiter.buckets, ShouldHaveLength, 1)
+			})
+		})
+	})
+
+	Convey("Given a limit without rate", t, func() {
+		_, err := New(&Config{Bind: &Limits{PerDN: &Bucket{Burst: 5}}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
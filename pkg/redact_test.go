@@ -0,0 +1,83 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/redaction"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_Redaction(t *testing.T) {
+	Convey("Given a ldap proxy redacting the passwords", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a", user: []*User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"cn": {"John Doe"}, "userPassword": {"{SSHA}abc"}}},
+		}})
+
+		redactor, err := redaction.New(&redaction.Config{Allow: []string{"group:cn=admins,ou=Groups,dc=example,dc=com"}})
+		So(err, ShouldBeNil)
+
+		config := DefaultProxyConfig()
+		config.Redaction = redactor
+		proxy.Configure(config)
+
+		user := &session{context: setDn(context.Background(), "uid=jdoe,ou=People,dc=example,dc=com")}
+		admin := &session{context: setAttributes(setDn(context.Background(), "uid=root,ou=People,dc=example,dc=com"), map[string][]string{"memberOf": {"cn=admins,ou=Groups,dc=example,dc=com"}})}
+
+		Convey("When a user searches", func() {
+			res, err := proxy.Search(user, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the password is stripped", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes, ShouldResemble, map[string][][]byte{"cn": {[]byte("John Doe")}})
+			})
+		})
+
+		Convey("When a user filters by password", func() {
+			f, _ := filter.Parse("(userPassword={SSHA}*)")
+			res, err := proxy.Search(user, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree, Filter: f})
+
+			Convey("Then insufficientAccessRights is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+
+		Convey("When an allowed admin searches", func() {
+			res, err := proxy.Search(admin, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the password is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes["userPassword"], ShouldResemble, [][]byte{[]byte("{SSHA}abc")})
+			})
+		})
+
+		Convey("Then the group attribute is fetched at bind time", func() {
+			So(proxy.sessionAttributeNames(), ShouldResemble, []string{"memberOf"})
+		})
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package redaction
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"strings"
+)
+
+const (
+	// the attributes are removed from the results
+	ModeStrip = "strip"
+	// the values of the attributes are replaced by the mask
+	ModeMask = "mask"
+
+	Mask = "***"
+
+	// the prefix of a group dn in the allow list
+	groupPrefix = "group:"
+)
+
+var (
+	ErrUnknownMode = errors.New("redaction: unknown mode")
+
+	// The attributes redacted when the config does not list its own.
+	DefaultAttributes = []string{
+		"userPassword",
+		"unixUserPassword",
+		"unicodePwd",
+		"sambaNTPassword",
+		"sambaLMPassword",
+		"shadowLastChange",
+	}
+)
+
+type Config struct {
+	// The redacted attributes
+	Attributes []string `json:"attributes"`
+
+	// Strip (default) or mask the attributes
+	Mode string `json:"mode"`
+
+	// The dns, or `group:` followed by a group dn, receiving the attributes
+	Allow []string `json:"allow"`
+
+	// The attribute of the bound entry listing its groups, memberOf by default
+	GroupAttribute string `json:"groupAttribute"`
+}
+
+// A Redactor removes or masks sensitive attributes of the entries, whatever
+// the backends return, unless the requester is allowed to see them. All
+// methods may be called on a nil redactor, which doesn't redact anything.
+type Redactor struct {
+	attributes     map[string]bool
+	mask           bool
+	allowDNs       map[string]bool
+	allowGroups    map[string]bool
+	groupAttribute string
+}
+
+func New(config *Config) (*Redactor, error) {
+	redactor := &Redactor{
+		attributes:     make(map[string]bool),
+		allowDNs:       make(map[string]bool),
+		allowGroups:    make(map[string]bool),
+		groupAttribute: config.GroupAttribute,
+	}
+
+	switch config.Mode {
+	case "", ModeStrip:
+	case ModeMask:
+		redactor.mask = true
+	default:
+		return nil, fmt.Errorf("%v: %s", ErrUnknownMode, config.Mode)
+	}
+
+	attributes := config.Attributes
+	if len(attributes) == 0 {
+		attributes = DefaultAttributes
+	}
+	for _, attribute := range attributes {
+		redactor.attributes[strings.ToLower(attribute)] = true
+	}
+
+	for _, allowed := range config.Allow {
+		if strings.HasPrefix(strings.ToLower(allowed), groupPrefix) {
+			redactor.allowGroups[util.NormalizeDN(allowed[len(groupPrefix):])] = true
+		} else {
+			redactor.allowDNs[util.NormalizeDN(allowed)] = true
+		}
+	}
+
+	if redactor.groupAttribute == "" && len(redactor.allowGroups) > 0 {
+		redactor.groupAttribute = "memberOf"
+	}
+
+	return redactor, nil
+}
+
+// GroupAttribute is the attribute of the bound entry listing its groups, empty
+// if no group is allowed.
+func (redactor *Redactor) GroupAttribute() string {
+	if redactor == nil {
+		return ""
+	}
+
+	return redactor.groupAttribute
+}
+
+// Allowed reports whether the requester with the bound dn and the groups
+// receives the attributes unredacted.
+func (redactor *Redactor) Allowed(dn string, groups []string) bool {
+	if redactor == nil {
+		return true
+	}
+
+	if dn != "" && redactor.allowDNs[util.NormalizeDN(dn)] {
+		return true
+	}
+
+	for _, group := range groups {
+		if redactor.allowGroups[util.NormalizeDN(group)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redacts reports whether the attribute is redacted.
+func (redactor *Redactor) Redacts(attribute string) bool {
+	return redactor != nil && redactor.attributes[strings.ToLower(attribute)]
+}
+
+// Redact returns a copy of the attributes with the redacted attributes
+// removed or masked.
+func (redactor *Redactor) Redact(attributes map[string][]string) map[string][]string {
+	if redactor == nil {
+		return attributes
+	}
+
+	redacted := make(map[string][]string, len(attributes))
+	for name, values := range attributes {
+		if !redactor.Redacts(name) {
+			redacted[name] = values
+		} else if redactor.mask {
+			masked := make([]string, len(values))
+			for i := range values {
+				masked[i] = Mask
+			}
+			redacted[name] = masked
+		}
+	}
+
+	return redacted
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package redaction
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	attributes := map[string][]string{
+		"cn":           {"John Doe"},
+		"userPassword": {"{SSHA}abc"},
+		"apiToken":     {"secret1", "secret2"},
+	}
+
+	Convey("Given a redactor of the default attributes", t, func() {
+		redactor, err := New(&Config{Allow: []string{"cn=admin, dc=example, dc=com", "group:cn=auditors,dc=example,dc=com"}})
+		So(err, ShouldBeNil)
+
+		Convey("Then the passwords are stripped", func() {
+			So(redactor.Redact(attributes), ShouldResemble, map[string][]string{"cn": {"John Doe"}, "apiToken": {"secret1", "secret2"}})
+			So(redactor.Redacts("USERPASSWORD"), ShouldBeTrue)
+			So(redactor.Redacts("cn"), ShouldBeFalse)
+		})
+
+		Convey("Then the allowed dns and groups are allowed", func() {
+			So(redactor.Allowed("CN=admin,DC=example,DC=com", nil), ShouldBeTrue)
+			So(redactor.Allowed("uid=jdoe,dc=example,dc=com", []string{"cn=auditors,dc=example,dc=com"}), ShouldBeTrue)
+			So(redactor.Allowed("uid=jdoe,dc=example,dc=com", nil), ShouldBeFalse)
+			So(redactor.Allowed("", nil), ShouldBeFalse)
+			So(redactor.GroupAttribute(), ShouldEqual, "memberOf")
+		})
+	})
+
+	Convey("Given a redactor masking custom attributes", t, func() {
+		redactor, err := New(&Config{Attributes: []string{"apiToken"}, Mode: ModeMask})
+		So(err, ShouldBeNil)
+
+		Convey("Then every value is masked", func() {
+			So(redactor.Redact(attributes), ShouldResemble, map[string][]string{"cn": {"John Doe"}, "userPassword": {"{SSHA}abc"}, "apiToken": {Mask, Mask}})
+			So(redactor.GroupAttribute(), ShouldEqual, "")
+		})
+	})
+
+	Convey("Given a nil redactor", t, func() {
+		var redactor *Redactor
+
+		Convey("Then nothing is redacted", func() {
+			So(redactor.Redact(attributes), ShouldResemble, attributes)
+			So(redactor.Allowed("", nil), ShouldBeTrue)
+			So(redactor.Redacts("userPassword"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an unknown mode", t, func() {
+		_, err := New(&Config{Mode: "hide"})
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
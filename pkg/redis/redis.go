@@ -0,0 +1,343 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package redis is a minimal client of the redis protocol, just enough to
+// share the caches and lockouts of several proxies.
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoAddress = errors.New("redis: no address configured")
+
+	errUnexpectedReply = errors.New("redis: unexpected reply")
+)
+
+type Config struct {
+	// The address of the redis server e.g. `redis:6379`.
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	Database int    `json:"database"`
+
+	// Prepended to all keys, so the proxies can share a redis with other
+	// applications (default `ldap-proxy:`).
+	Prefix string `json:"prefix"`
+
+	// The number of idle connections kept open (default 8).
+	PoolSize int `json:"poolSize"`
+
+	// The deadline of a single command (default `1s`).
+	Timeout string `json:"timeout"`
+}
+
+// A Client sends commands to a redis server, connections are reused. It is
+// safe to be used concurrently.
+type Client struct {
+	address  string
+	password string
+	database int
+	prefix   string
+	timeout  time.Duration
+
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// An Error is returned by the redis server.
+type Error string
+
+func (err Error) Error() string {
+	return "redis: " + string(err)
+}
+
+func New(config *Config) (*Client, error) {
+	if config.Address == "" {
+		return nil, ErrNoAddress
+	}
+
+	client := &Client{
+		address:  config.Address,
+		password: config.Password,
+		database: config.Database,
+		prefix:   config.Prefix,
+		timeout:  time.Second,
+	}
+
+	if client.prefix == "" {
+		client.prefix = "ldap-proxy:"
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		client.timeout = timeout
+	}
+
+	poolSize := config.PoolSize
+	if poolSize <= 0 {
+		poolSize = 8
+	}
+	client.pool = make(chan *conn, poolSize)
+
+	return client, nil
+}
+
+// Get returns the value of the key, nil if there is none.
+func (client *Client) Get(key string) ([]byte, error) {
+	reply, err := client.do("GET", client.prefix+key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, errUnexpectedReply
+	}
+
+	return value, nil
+}
+
+// Set stores the value, it expires after the ttl.
+func (client *Client) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := client.do("SET", client.prefix+key, string(value), "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return err
+}
+
+// Incr increments the counter of the key and returns its new value, a new
+// counter expires after the ttl.
+func (client *Client) Incr(key string, ttl time.Duration) (int64, error) {
+	reply, err := client.do("INCR", client.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, errUnexpectedReply
+	}
+
+	if count == 1 {
+		_, err = client.do("PEXPIRE", client.prefix+key, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+
+	return count, err
+}
+
+func (client *Client) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, client.prefix+key)
+	}
+
+	_, err := client.do(args...)
+	return err
+}
+
+// Keys returns all keys starting with the prefix, without the prefix of the
+// client.
+func (client *Client) Keys(prefix string) ([]string, error) {
+	pattern := escapePattern(client.prefix+prefix) + "*"
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := client.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, errUnexpectedReply
+		}
+		next, ok := page[0].([]byte)
+		found, ok2 := page[1].([]interface{})
+		if !ok || !ok2 {
+			return nil, errUnexpectedReply
+		}
+
+		for _, key := range found {
+			if key, ok := key.([]byte); ok {
+				keys = append(keys, strings.TrimPrefix(string(key), client.prefix))
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" {
+			return keys, nil
+		}
+	}
+}
+
+func (client *Client) do(args ...string) (interface{}, error) {
+	c, err := client.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(client.timeout, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		// the state of the connection is unknown
+		c.Close()
+		return nil, err
+	}
+
+	select {
+	case client.pool <- c:
+	default:
+		c.Close()
+	}
+
+	return reply, err
+}
+
+func (client *Client) conn() (*conn, error) {
+	select {
+	case c := <-client.pool:
+		return c, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", client.address, client.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if client.password != "" {
+		if _, err := c.do(client.timeout, "AUTH", client.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if client.database != 0 {
+		if _, err := c.do(client.timeout, "SELECT", strconv.Itoa(client.database)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := c.Write([]byte(request.String())); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.reader)
+}
+
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errUnexpectedReply
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+
+	case '-':
+		return nil, Error(value)
+
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+
+	case '*':
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+
+		elements := make([]interface{}, count)
+		for i := range elements {
+			if elements[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	}
+
+	return nil, errUnexpectedReply
+}
+
+// escapePattern escapes the glob characters of a key used in a pattern
+func escapePattern(key string) string {
+	var pattern bytes.Buffer
+	for _, r := range key {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			pattern.WriteRune('\\')
+		}
+		pattern.WriteRune(r)
+	}
+
+	return pattern.String()
+}
@@ -0,0 +1,230 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer answers the commands used by the client from memory
+type testServer struct {
+	listener net.Listener
+
+	mutex    sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newTestServer() *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	server := &testServer{listener: listener, values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (server *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readReply(reader)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, arg := range request.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		fmt.Fprint(conn, server.handle(args))
+	}
+}
+
+func (server *testServer) stored() (map[string]string, []string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	values := make(map[string]string)
+	for key, value := range server.values {
+		values[key] = value
+	}
+
+	return values, append([]string{}, server.commands...)
+}
+
+func (server *testServer) handle(args []string) string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.commands = append(server.commands, args[0])
+
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-ERR invalid password\r\n"
+		}
+		return "+OK\r\n"
+
+	case "GET":
+		value, ok := server.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+
+	case "SET":
+		server.values[args[1]] = args[2]
+		return "+OK\r\n"
+
+	case "INCR":
+		count, _ := strconv.Atoi(server.values[args[1]])
+		server.values[args[1]] = strconv.Itoa(count + 1)
+		return fmt.Sprintf(":%d\r\n", count+1)
+
+	case "PEXPIRE":
+		return ":1\r\n"
+
+	case "DEL":
+		for _, key := range args[1:] {
+			delete(server.values, key)
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+
+	case "SCAN":
+		prefix := strings.Replace(strings.TrimSuffix(args[3], "*"), "\\", "", -1)
+		var keys []string
+		for key := range server.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
+			}
+		}
+		return fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+func TestClient(t *testing.T) {
+	Convey("Given a client of a redis server", t, func() {
+		server := newTestServer()
+		Reset(func() { server.listener.Close() })
+
+		client, err := New(&Config{Address: server.listener.Addr().String(), Password: "secret"})
+		So(err, ShouldBeNil)
+
+		Convey("When a value is set", func() {
+			err := client.Set("a", []byte("value\r\nwith newline"), time.Minute)
+
+			Convey("Then it's stored with the prefix and can be read", func() {
+				So(err, ShouldBeNil)
+				values, _ := server.stored()
+				So(values, ShouldContainKey, "ldap-proxy:a")
+
+				value, err := client.Get("a")
+				So(err, ShouldBeNil)
+				So(string(value), ShouldEqual, "value\r\nwith newline")
+			})
+
+			Convey("Then the connection is reused", func() {
+				client.Get("a")
+				_, commands := server.stored()
+				So(commands, ShouldResemble, []string{"AUTH", "SET", "GET"})
+			})
+		})
+
+		Convey("When a missing value is read", func() {
+			value, err := client.Get("missing")
+
+			Convey("Then nil is returned", func() {
+				So(err, ShouldBeNil)
+				So(value, ShouldBeNil)
+			})
+		})
+
+		Convey("When a counter is incremented twice", func() {
+			first, err := client.Incr("counter", time.Minute)
+			So(err, ShouldBeNil)
+			second, err := client.Incr("counter", time.Minute)
+			So(err, ShouldBeNil)
+
+			Convey("Then the incremented values are returned and only the new counter gets the ttl", func() {
+				So(first, ShouldEqual, 1)
+				So(second, ShouldEqual, 2)
+				_, commands := server.stored()
+				So(commands, ShouldResemble, []string{"AUTH", "INCR", "PEXPIRE", "INCR"})
+			})
+		})
+
+		Convey("When the keys with a prefix are listed and deleted", func() {
+			client.Set("search:a", []byte("1"), time.Minute)
+			client.Set("search:b", []byte("2"), time.Minute)
+			client.Set("bind:a", []byte("3"), time.Minute)
+
+			keys, err := client.Keys("search:")
+			So(err, ShouldBeNil)
+			client.Delete(keys...)
+
+			Convey("Then only the keys with the prefix are gone", func() {
+				So(keys, ShouldHaveLength, 2)
+				values, _ := server.stored()
+				So(values, ShouldHaveLength, 1)
+				So(values, ShouldContainKey, "ldap-proxy:bind:a")
+			})
+		})
+	})
+
+	Convey("Given a client with a wrong password", t, func() {
+		server := newTestServer()
+		Reset(func() { server.listener.Close() })
+
+		client, _ := New(&Config{Address: server.listener.Addr().String(), Password: "wrong"})
+
+		Convey("When a value is read", func() {
+			_, err := client.Get("a")
+
+			Convey("Then the error of the server is returned", func() {
+				So(err, ShouldEqual, Error("ERR invalid password"))
+			})
+		})
+	})
+}
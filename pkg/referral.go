@@ -0,0 +1,80 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// A Referral points the searches of naming contexts no backend owns to the
+// ldap urls of the authoritative servers.
+type Referral struct {
+	// The suffix of the referred naming context. The empty suffix refers the
+	// searches of all unowned naming contexts.
+	Suffix string
+
+	URLs []string
+}
+
+// referral returns the urls of the referral with the longest suffix of the
+// base dn if no enabled backend owns it. The base dn is owned if it is the
+// naming context of a backend or below it, the root and every base dn are
+// owned as long as no naming contexts are configured.
+func (ldapProxy *LdapProxy) referral(baseDN string) []string {
+	if len(ldapProxy.config.Referrals) == 0 || baseDN == "" {
+		return nil
+	}
+
+	namingContexts := ldapProxy.namingContexts()
+	if len(namingContexts) == 0 {
+		return nil
+	}
+
+	for _, namingContext := range namingContexts {
+		if util.IsBelowDN(baseDN, namingContext) {
+			return nil
+		}
+	}
+
+	var urls []string
+	longest := -1
+	for _, referral := range ldapProxy.config.Referrals {
+		if (referral.Suffix == "" || util.IsBelowDN(baseDN, referral.Suffix)) && len(referral.Suffix) > longest {
+			urls, longest = referral.URLs, len(referral.Suffix)
+		}
+	}
+
+	return urls
+}
+
+// referralResponse answers a search with the urls of the referral as search
+// result references, the ldap library doesn't allow a referral in the result.
+func referralResponse(urls []string) *ldap.SearchResponse {
+	return &ldap.SearchResponse{
+		BaseResponse: ldap.BaseResponse{
+			Code:    ldap.ResultReferral,
+			Message: strings.Join(urls, " "),
+		},
+		Referrals: urls,
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_Referral(t *testing.T) {
+	Convey("Given a ldap proxy owning one naming context and referring others", t, func() {
+		backend := &testBackend{user: []*User{{DN: "uid=a,dc=example,dc=com"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{"test": {"dc=example,dc=com"}}
+		config.Referrals = []Referral{
+			{Suffix: "", URLs: []string{"ldap://ldap.example.org"}},
+			{Suffix: "dc=partner,dc=com", URLs: []string{"ldap://ldap.partner.com/dc=partner,dc=com"}},
+		}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When an owned naming context is searched", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "DC=Example,DC=Com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backends answer", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When a referred naming context is searched", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=partner,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the referral with the longest suffix is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultReferral)
+				So(res.Referrals, ShouldResemble, []string{"ldap://ldap.partner.com/dc=partner,dc=com"})
+				So(backend.calls, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When another unowned naming context is searched", func() {
+			res, _ := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=other,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the default referral is returned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultReferral)
+				So(res.Referrals, ShouldResemble, []string{"ldap://ldap.example.org"})
+			})
+		})
+
+		Convey("When no naming contexts are configured", func() {
+			config.NamingContexts = nil
+			proxy.Configure(config)
+
+			res, _ := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=other,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then every naming context is owned", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+			})
+		})
+	})
+}
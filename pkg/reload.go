@@ -0,0 +1,164 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"reflect"
+	"sync"
+)
+
+// closer is implemented by backends holding connections, e.g. postgres
+type closer interface {
+	Close()
+}
+
+// current returns a copy of the proxy with its backends and config, which a
+// reload doesn't change
+func (ldapProxy *LdapProxy) current() *LdapProxy {
+	ldapProxy.reloadMutex.RLock()
+	defer ldapProxy.reloadMutex.RUnlock()
+
+	current := *ldapProxy
+	return &current
+}
+
+// acquire returns the current proxy for an operation. The backends are kept
+// alive by a reload until the operation is done.
+func (ldapProxy *LdapProxy) acquire() (*LdapProxy, func()) {
+	ldapProxy.reloadMutex.RLock()
+	defer ldapProxy.reloadMutex.RUnlock()
+
+	current := *ldapProxy
+	current.operations.Add(1)
+	return &current, current.operations.Done
+}
+
+// Reload replaces the backends and the config of the proxy at once. New
+// operations use the new ones, while the operations in flight finish with the
+// previous ones. Backends implementing Close are closed afterwards. The
+// sessions, the connection counts and the backends disabled by the admin api
+// are kept.
+func (ldapProxy *LdapProxy) Reload(config ProxyConfig, backends ...Backend) {
+	ldapProxy.update(func(current *LdapProxy) (ProxyConfig, []Backend, error) {
+		return config, backends, nil
+	})
+}
+
+// RemoveBackend removes the backend while the proxy is serving. Operations in
+// flight finish with it, it's closed afterwards if it implements Close.
+func (ldapProxy *LdapProxy) RemoveBackend(name string) error {
+	return ldapProxy.update(func(current *LdapProxy) (ProxyConfig, []Backend, error) {
+		if _, ok := current.backends[name]; !ok {
+			return current.config, nil, ErrUnknownBackend
+		}
+
+		var backends []Backend
+		for _, backend := range current.ordered {
+			if backend.Name() != name {
+				backends = append(backends, backend)
+			}
+		}
+		return current.config, backends, nil
+	})
+}
+
+// ReplaceBackend replaces the backend with the same name while the proxy is
+// serving, keeping its position. The previous backend is closed like by
+// RemoveBackend.
+func (ldapProxy *LdapProxy) ReplaceBackend(backend Backend) error {
+	return ldapProxy.update(func(current *LdapProxy) (ProxyConfig, []Backend, error) {
+		if _, ok := current.backends[backend.Name()]; !ok {
+			return current.config, nil, ErrUnknownBackend
+		}
+
+		return current.config, append(append([]Backend{}, current.ordered...), backend), nil
+	})
+}
+
+// update swaps in the config and the backends returned by the change of the
+// current ones. The maps and slices of the current backends are never
+// changed, the copies of the operations in flight keep reading them.
+func (ldapProxy *LdapProxy) update(change func(current *LdapProxy) (ProxyConfig, []Backend, error)) error {
+	ldapProxy.reloadMutex.Lock()
+	previous := *ldapProxy
+
+	config, backends, err := change(&previous)
+	if err != nil {
+		ldapProxy.reloadMutex.Unlock()
+		return err
+	}
+
+	reloaded := &LdapProxy{
+		backends:   make(map[string]Backend),
+		config:     config,
+		flights:    newFlightGroup(),
+		operations: &sync.WaitGroup{},
+	}
+	reloaded.addBackends(backends)
+
+	ldapProxy.backends = reloaded.backends
+	ldapProxy.ordered = reloaded.ordered
+	ldapProxy.config = reloaded.config
+	ldapProxy.flights = reloaded.flights
+	ldapProxy.operations = reloaded.operations
+	ldapProxy.reloadMutex.Unlock()
+
+	ldapProxy.publishRootDSE()
+
+	for _, backend := range previous.ordered {
+		if _, ok := reloaded.backends[backend.Name()]; !ok {
+			log.Printf("Removed backend '%s'", backend.Name())
+		}
+	}
+	for _, backend := range reloaded.ordered {
+		if previousBackend, ok := previous.backends[backend.Name()]; !ok {
+			log.Printf("Added backend '%s'", backend.Name())
+		} else if !isSameBackend(previousBackend, backend) {
+			log.Printf("Replaced backend '%s'", backend.Name())
+		}
+	}
+
+	go func() {
+		previous.operations.Wait()
+
+		for _, backend := range previous.ordered {
+			if isSameBackend(reloaded.backends[backend.Name()], backend) {
+				continue
+			}
+			if closer, ok := backend.(closer); ok {
+				closer.Close()
+				log.Printf("Closed previous backend '%s'", backend.Name())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// isSameBackend compares the backends without panicking on uncomparable types
+func isSameBackend(a Backend, b Backend) bool {
+	if a == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+
+	return a == b
+}
@@ -0,0 +1,198 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type closableBackend struct {
+	*testBackend
+	closed chan struct{}
+}
+
+func (backend *closableBackend) Close() {
+	close(backend.closed)
+}
+
+func TestLdapProxy_Reload(t *testing.T) {
+	Convey("Given a ldap proxy with a slow backend and an authenticated session", t, func() {
+		previous := &closableBackend{
+			testBackend: &testBackend{name: "a", delay: 100 * time.Millisecond, user: []*User{{DN: "cn=previous"}}},
+			closed:      make(chan struct{}),
+		}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(previous)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the config is reloaded during a search", func() {
+			results := make(chan *ldap.SearchResponse)
+			go func() {
+				res, _ := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				results <- res
+			}()
+			time.Sleep(20 * time.Millisecond)
+
+			config := DefaultProxyConfig()
+			config.SizeLimit = 5
+			proxy.Reload(config,
+				&testBackend{name: "a", user: []*User{{DN: "cn=reloaded"}}},
+				&testBackend{name: "b"},
+			)
+
+			Convey("Then new operations should use the new backends and config", func() {
+				res, err := proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn=reloaded")
+				So(proxy.current().config.SizeLimit, ShouldEqual, 5)
+				So(proxy.Backends(), ShouldHaveLength, 2)
+			})
+
+			Convey("Then the search in flight should finish with the previous backend before it's closed", func() {
+				select {
+				case <-previous.closed:
+					t.Fatal("the previous backend was closed during the search")
+				default:
+				}
+
+				res := <-results
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn=previous")
+
+				select {
+				case <-previous.closed:
+				case <-time.After(time.Second):
+					t.Fatal("the previous backend wasn't closed")
+				}
+			})
+		})
+
+		Convey("When the config is reloaded with the same backend", func() {
+			proxy.Reload(DefaultProxyConfig(), previous)
+
+			Convey("Then the backend should be kept open", func() {
+				select {
+				case <-previous.closed:
+					t.Fatal("the kept backend was closed")
+				case <-time.After(50 * time.Millisecond):
+				}
+			})
+		})
+	})
+}
+
+func TestLdapProxy_RemoveBackend(t *testing.T) {
+	Convey("Given a ldap proxy with three backends", t, func() {
+		removed := &closableBackend{
+			testBackend: &testBackend{name: "b"},
+			closed:      make(chan struct{}),
+		}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a"}, removed, &testBackend{name: "c"})
+
+		Convey("When a backend is removed", func() {
+			err := proxy.RemoveBackend("b")
+
+			Convey("Then it should be gone and closed", func() {
+				So(err, ShouldBeNil)
+				So(proxy.Backends(), ShouldHaveLength, 2)
+
+				select {
+				case <-removed.closed:
+				case <-time.After(time.Second):
+					t.Fatal("the removed backend wasn't closed")
+				}
+			})
+		})
+
+		Convey("When a wrapped backend is removed", func() {
+			wrapped := &closableBackend{
+				testBackend: &testBackend{name: "d"},
+				closed:      make(chan struct{}),
+			}
+			proxy.AddBackend(wrap(wrapped))
+			proxy.RemoveBackend("d")
+
+			Convey("Then the wrapped backend should be closed", func() {
+				select {
+				case <-wrapped.closed:
+				case <-time.After(time.Second):
+					t.Fatal("the wrapped backend wasn't closed")
+				}
+			})
+		})
+
+		Convey("When a backend is replaced", func() {
+			err := proxy.ReplaceBackend(&testBackend{name: "b", user: []*User{{DN: "cn=replaced"}}})
+
+			Convey("Then it should keep its position", func() {
+				So(err, ShouldBeNil)
+				So(proxy.Backends()[1].Name, ShouldEqual, "b")
+				So(proxy.current().backends["b"], ShouldNotEqual, removed)
+			})
+		})
+
+		Convey("When an unknown backend is removed or replaced", func() {
+			Convey("Then the backend should be unknown", func() {
+				So(proxy.RemoveBackend("unknown"), ShouldEqual, ErrUnknownBackend)
+				So(proxy.ReplaceBackend(&testBackend{name: "unknown"}), ShouldEqual, ErrUnknownBackend)
+				So(proxy.Backends(), ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When backends are added and removed during searches", func() {
+			ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+			sess := &session{
+				context: ctx,
+				cancle:  cancle,
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 50; i++ {
+					proxy.Search(sess, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				}
+			}()
+			for i := 0; i < 50; i++ {
+				proxy.AddBackend(&testBackend{name: "d"})
+				proxy.RemoveBackend("d")
+			}
+			<-done
+
+			Convey("Then the backends should stay consistent", func() {
+				So(proxy.Backends(), ShouldHaveLength, 3)
+			})
+		})
+	})
+}
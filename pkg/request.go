@@ -0,0 +1,124 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/samuel/go-ldap/ldap"
+	"sync/atomic"
+)
+
+// A request is a single operation of a session. The log backend passes it
+// down in place of the session, so every request carries its own id down to
+// the backends, even if a client sends several at once.
+type request struct {
+	*session
+	id string
+
+	// set once the request is answered from the offline caches, accessed
+	// atomically
+	offline int32
+}
+
+// newRequest numbers the next request of the session, the id is the id of
+// the session followed by the number of the request e.g. 42-7
+func newRequest(sess *session) *request {
+	return &request{
+		session: sess,
+		id:      fmt.Sprintf("%d-%d", getId(sess.context), atomic.AddInt64(&sess.requests, 1)),
+	}
+}
+
+// sessionOf returns the session of a request or the session itself
+func sessionOf(ctx ldap.Context) (*session, bool) {
+	switch ctx := ctx.(type) {
+	case *session:
+		return ctx, true
+	case *request:
+		return ctx.session, true
+	}
+
+	return nil, false
+}
+
+// requestId returns the id of the request, empty for a bare session
+func requestId(ctx ldap.Context) string {
+	if req, ok := ctx.(*request); ok {
+		return req.id
+	}
+
+	return ""
+}
+
+// servedOffline reports whether the request was answered from the offline
+// caches
+func servedOffline(ctx ldap.Context) bool {
+	if req, ok := ctx.(*request); ok {
+		return atomic.LoadInt32(&req.offline) != 0
+	}
+
+	return false
+}
+
+// requestContext is the context of the session marked with the id of the
+// request, the backends are called with it
+func requestContext(ctx ldap.Context, sess *session) context.Context {
+	if req, ok := ctx.(*request); ok {
+		return setOffline(setRequestId(sess.context, req.id), &req.offline)
+	}
+
+	return sess.context
+}
+
+// withRequestId adds the request id to the diagnostic message of an error
+// response, so a client error can be found in the logs of the proxy and the
+// backends
+func withRequestId(res *ldap.BaseResponse, id string) {
+	if res == nil || id == "" || !isError(res.Code) {
+		return
+	}
+
+	if res.Message == "" {
+		res.Message = "request id " + id
+	} else {
+		res.Message += " (request id " + id + ")"
+	}
+}
+
+// logRequestId formats the request id for the log lines of the proxy, empty
+// if the line isn't logged for a request
+func logRequestId(id string) string {
+	if id == "" {
+		return ""
+	}
+
+	return " (request id " + id + ")"
+}
+
+func isError(code ldap.ResultCode) bool {
+	switch code {
+	case ldap.ResultSuccess, ldap.ResultCompareFalse, ldap.ResultCompareTrue, ldap.ResultReferral, ldap.ResultSaslBindInProgress:
+		return false
+	}
+
+	return true
+}
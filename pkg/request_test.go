@@ -0,0 +1,98 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"fmt"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRequestId(t *testing.T) {
+	Convey("Given a ldap proxy behind the log backend", t, func() {
+		proxy := NewLdapProxy()
+		backend := &testBackend{result: false}
+		proxy.AddBackend(backend)
+		server := LogBackend(proxy)
+
+		ctx, err := server.Connect(nil)
+		So(err, ShouldBeNil)
+		id := getId(ctx.(*session).context)
+
+		Convey("When a bind fails", func() {
+			res, err := server.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("wrong")})
+
+			Convey("Then the backend is called with the request id", func() {
+				So(err, ShouldBeNil)
+				So(backend.lastRequest, ShouldEqual, fmt.Sprintf("%d-1", id))
+			})
+
+			Convey("Then the diagnostic message names the request", func() {
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(res.Message, ShouldEqual, fmt.Sprintf("request id %d-1", id))
+			})
+
+			Convey("And the next request has the next id", func() {
+				server.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("wrong")})
+
+				So(backend.lastRequest, ShouldEqual, fmt.Sprintf("%d-2", id))
+			})
+		})
+
+		Convey("When a bind succeeds", func() {
+			backend.result = true
+			res, err := server.Bind(ctx, &ldap.BindRequest{DN: "cn=test", Password: []byte("secure")})
+
+			Convey("Then the message is left as it is", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Message, ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestWithRequestId(t *testing.T) {
+	Convey("Given an error response with a message", t, func() {
+		res := &ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform, Message: "entry is protected"}
+
+		Convey("When the request id is added", func() {
+			withRequestId(res, "42-7")
+
+			Convey("Then it follows the message", func() {
+				So(res.Message, ShouldEqual, "entry is protected (request id 42-7)")
+			})
+		})
+	})
+
+	Convey("Given a referral", t, func() {
+		res := &ldap.BaseResponse{Code: ldap.ResultReferral}
+
+		Convey("When the request id is added", func() {
+			withRequestId(res, "42-7")
+
+			Convey("Then the message is left as it is", func() {
+				So(res.Message, ShouldEqual, "")
+			})
+		})
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package retry
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// the retry budget can't save more retries than this
+	maxTokens = 10
+)
+
+var (
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "retry",
+		Name:      "retries_total",
+		Help:      "The total number of retried backend calls",
+	}, []string{"backend"})
+
+	budgetExhaustedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "retry",
+		Name:      "budget_exhausted_total",
+		Help:      "The total number of transient failures not retried because the retry budget was spent",
+	}, []string{"backend"})
+)
+
+func init() {
+	prometheus.MustRegister(retriesTotal)
+	prometheus.MustRegister(budgetExhaustedTotal)
+}
+
+// RetryConfig defines how transient backend failures are retried. The backoff
+// starts at initialBackoff and doubles per retry up to maxBackoff. The budget
+// is the ratio of retries to calls, so a failing upstream isn't flooded with
+// retries.
+type RetryConfig struct {
+	MaxRetries     int     `json:"maxRetries"`
+	InitialBackoff string  `json:"initialBackoff"`
+	MaxBackoff     string  `json:"maxBackoff"`
+	Budget         float64 `json:"budget"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Retry *RetryConfig `json:"retry"`
+}
+
+type retryBackend struct {
+	// writes aren't retried, a failed write may have been applied
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	budget         float64
+
+	sleep func(ctx context.Context, duration time.Duration) error
+
+	mutex  sync.Mutex
+	tokens float64
+}
+
+var _ pkg.ErrorReportingBackend = &retryBackend{}
+var _ pkg.PasswordBackend = &retryBackend{}
+var _ pkg.WriterBackend = &retryBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *RetryConfig) (pkg.Backend, error) {
+	backend := &retryBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		maxRetries:      config.MaxRetries,
+		budget:          config.Budget,
+		sleep:           sleep,
+		tokens:          maxTokens,
+	}
+
+	if backend.maxRetries <= 0 {
+		backend.maxRetries = 3
+	}
+	if backend.budget <= 0 {
+		backend.budget = 0.1
+	}
+
+	var err error
+	if backend.initialBackoff, err = parseDuration(config.InitialBackoff, 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if backend.maxBackoff, err = parseDuration(config.MaxBackoff, 2*time.Second); err != nil {
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+func (backend *retryBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+// Authenticate is not retried, a failed authentication can't be told apart
+// from a wrong password.
+func (backend *retryBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// AuthenticateErr reports an unavailable delegate, e.g. behind an open
+// circuit. It isn't retried either.
+func (backend *retryBackend) AuthenticateErr(ctx context.Context, username string, password string) (bool, error) {
+	return pkg.Authenticate(ctx, backend.delegateBackend, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+// Like the writes it isn't retried.
+func (backend *retryBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *retryBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.deposit()
+
+	backoff := backend.initialBackoff
+	for retry := 0; ; retry++ {
+		users, err := backend.delegateBackend.GetUsers(ctx, f)
+		if err == nil || retry >= backend.maxRetries || ctx.Err() != nil || !IsTransient(err) {
+			return users, err
+		}
+
+		if !backend.withdraw() {
+			budgetExhaustedTotal.With(prometheus.Labels{"backend": backend.Name()}).Inc()
+			return users, err
+		}
+
+		if backend.sleep(ctx, jitter(backoff)) != nil {
+			return users, err
+		}
+
+		retriesTotal.With(prometheus.Labels{"backend": backend.Name()}).Inc()
+
+		backoff *= 2
+		if backoff > backend.maxBackoff {
+			backoff = backend.maxBackoff
+		}
+	}
+}
+
+// deposit adds the share of a retry earned by a call to the budget
+func (backend *retryBackend) deposit() {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.tokens += backend.budget
+	if backend.tokens > maxTokens {
+		backend.tokens = maxTokens
+	}
+}
+
+// withdraw spends a retry from the budget
+func (backend *retryBackend) withdraw() bool {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	if backend.tokens < 1 {
+		return false
+	}
+
+	backend.tokens--
+	return true
+}
+
+// IsTransient reports whether the error is likely to disappear when the call
+// is repeated: dropped connections, network timeouts and busy or unavailable
+// ldap servers.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case *ldap.BaseResponse:
+		return e.Code == ldap.ResultBusy || e.Code == ldap.ResultUnavailable
+	case *net.OpError:
+		if e.Timeout() {
+			return true
+		}
+		return IsTransient(e.Err)
+	case *os.SyscallError:
+		return IsTransient(e.Err)
+	case syscall.Errno:
+		return e == syscall.ECONNRESET || e == syscall.ECONNABORTED || e == syscall.ECONNREFUSED || e == syscall.EPIPE
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// jitter spreads the retries of concurrent calls between half and the full
+// backoff
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 1 {
+		return backoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(value)
+}
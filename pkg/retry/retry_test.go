@@ -0,0 +1,135 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testBackend struct {
+	calls int
+	errs  []error
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.calls++
+
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.calls++
+
+	if len(backend.errs) > 0 {
+		err := backend.errs[0]
+		backend.errs = backend.errs[1:]
+		return nil, err
+	}
+
+	return []*pkg.User{{DN: "cn=test"}}, nil
+}
+
+var errReset = &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+
+func TestRetryBackend(t *testing.T) {
+	Convey("Given a retrying backend", t, func() {
+		delegate := &testBackend{}
+
+		wrapped, err := NewBackend(delegate, &RetryConfig{MaxRetries: 2})
+		So(err, ShouldBeNil)
+		backend := wrapped.(*retryBackend)
+
+		var backoffs []time.Duration
+		backend.sleep = func(ctx context.Context, duration time.Duration) error {
+			backoffs = append(backoffs, duration)
+			return nil
+		}
+
+		Convey("When the connection is reset once", func() {
+			delegate.errs = []error{errReset}
+			users, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the call is retried after a backoff", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 1)
+				So(delegate.calls, ShouldEqual, 2)
+				So(backoffs, ShouldHaveLength, 1)
+				So(backoffs[0], ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+			})
+		})
+
+		Convey("When the server stays busy", func() {
+			busy := &ldap.BaseResponse{Code: ldap.ResultBusy}
+			delegate.errs = []error{busy, busy, busy, busy}
+			_, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the retries are limited and the backoff grows", func() {
+				So(err, ShouldEqual, busy)
+				So(delegate.calls, ShouldEqual, 3)
+				So(backoffs, ShouldHaveLength, 2)
+				So(backoffs[1], ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+			})
+		})
+
+		Convey("When the error is not transient", func() {
+			delegate.errs = []error{errors.New("invalid filter")}
+			_, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the call is not retried", func() {
+				So(err, ShouldNotBeNil)
+				So(delegate.calls, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the retry budget is spent", func() {
+			backend.tokens = 0.5
+			delegate.errs = []error{errReset}
+			_, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the failure is returned without retry", func() {
+				So(err, ShouldEqual, errReset)
+				So(delegate.calls, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	Convey("Then dropped connections and busy servers are transient", t, func() {
+		So(IsTransient(errReset), ShouldBeTrue)
+		So(IsTransient(&ldap.BaseResponse{Code: ldap.ResultUnavailable}), ShouldBeTrue)
+		So(IsTransient(&ldap.BaseResponse{Code: ldap.ResultInvalidCredentials}), ShouldBeFalse)
+		So(IsTransient(errors.New("test error")), ShouldBeFalse)
+	})
+}
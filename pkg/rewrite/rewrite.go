@@ -0,0 +1,171 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package rewrite
+
+import (
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// A Replacement replaces the parts of a search filter equal to Match, e.g.
+// (objectClass=posixAccount), with the filter With.
+type Replacement struct {
+	Match string `json:"match"`
+	With  string `json:"with"`
+}
+
+// RewriteConfig adapts the search filters of clients which can't change them
+// to the backend. The replacements are applied first, then the filter is
+// combined with the And filter.
+type RewriteConfig struct {
+	Replace []*Replacement `json:"replace"`
+	And     string         `json:"and"`
+}
+
+type Config struct {
+	pkg.Config
+
+	FilterRewrite *RewriteConfig `json:"filterRewrite"`
+}
+
+type replacement struct {
+	match string
+	with  ldap.Filter
+}
+
+type rewriteBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	replacements []*replacement
+	and          ldap.Filter
+}
+
+var _ pkg.PasswordBackend = &rewriteBackend{}
+var _ pkg.WriterBackend = &rewriteBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *RewriteConfig) (pkg.Backend, error) {
+	backend := &rewriteBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+	}
+
+	for _, r := range config.Replace {
+		match, err := filter.Parse(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite: invalid filter '%s': %v", r.Match, err)
+		}
+		with, err := filter.Parse(r.With)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite: invalid filter '%s': %v", r.With, err)
+		}
+
+		backend.replacements = append(backend.replacements, &replacement{match: filter.String(match), with: with})
+	}
+
+	if config.And != "" {
+		and, err := filter.Parse(config.And)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite: invalid filter '%s': %v", config.And, err)
+		}
+		backend.and = and
+	}
+
+	return backend, nil
+}
+
+func (backend *rewriteBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *rewriteBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *rewriteBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *rewriteBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.delegateBackend.GetUsers(ctx, backend.rewrite(f))
+}
+
+// rewrite returns the filter passed to the backend
+func (backend *rewriteBackend) rewrite(f ldap.Filter) ldap.Filter {
+	if len(backend.replacements) > 0 {
+		f = backend.replace(f)
+	}
+
+	if backend.and == nil {
+		return f
+	} else if f == nil {
+		return backend.and
+	}
+
+	return &ldap.AND{Filters: []ldap.Filter{f, backend.and}}
+}
+
+// replace returns a copy of the filter with the parts matching a replacement
+// replaced. The filters are compared in their string representation, case
+// insensitive.
+func (backend *rewriteBackend) replace(f ldap.Filter) ldap.Filter {
+	if f == nil {
+		return nil
+	}
+
+	value := filter.String(f)
+	for _, r := range backend.replacements {
+		if strings.EqualFold(value, r.match) {
+			return r.with
+		}
+	}
+
+	switch f := f.(type) {
+	case *ldap.AND:
+		return &ldap.AND{Filters: backend.replaceList(f.Filters)}
+	case *ldap.OR:
+		return &ldap.OR{Filters: backend.replaceList(f.Filters)}
+	case *ldap.NOT:
+		return &ldap.NOT{Filter: backend.replace(f.Filter)}
+	}
+
+	return f
+}
+
+func (backend *rewriteBackend) replaceList(filters []ldap.Filter) []ldap.Filter {
+	replaced := make([]ldap.Filter, len(filters))
+	for i, f := range filters {
+		replaced[i] = backend.replace(f)
+	}
+
+	return replaced
+}
@@ -0,0 +1,96 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package rewrite
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	lastFilter ldap.Filter
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+
+	return []*pkg.User{}, nil
+}
+
+func TestRewriteBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend rewriting filters", t, func() {
+		delegate := &testBackend{}
+		backend, err := NewBackend(delegate, &RewriteConfig{
+			Replace: []*Replacement{
+				{Match: "(objectClass=posixAccount)", With: "(objectCategory=person)"},
+				{Match: "(|(uid=*)(cn=*))", With: "(sAMAccountName=*)"},
+			},
+			And: "(memberOf=cn=ldap-users,ou=Groups,dc=example,dc=com)",
+		})
+		So(err, ShouldBeNil)
+
+		search := func(raw string) string {
+			f, err := filter.Parse(raw)
+			So(err, ShouldBeNil)
+			_, err = backend.GetUsers(context.Background(), f)
+			So(err, ShouldBeNil)
+			return filter.String(delegate.lastFilter)
+		}
+
+		Convey("Then matching assertions are replaced and the constraint is added", func() {
+			So(search("(&(objectclass=PosixAccount)(uid=jdoe))"), ShouldEqual, "(&(&(objectCategory=person)(uid=jdoe))(memberOf=cn=ldap-users,ou=Groups,dc=example,dc=com))")
+		})
+
+		Convey("Then matching composite filters are replaced", func() {
+			So(search("(!(|(uid=*)(cn=*)))"), ShouldEqual, "(&(!(sAMAccountName=*))(memberOf=cn=ldap-users,ou=Groups,dc=example,dc=com))")
+		})
+
+		Convey("Then other filters only get the constraint", func() {
+			So(search("(mail=jdoe@example.com)"), ShouldEqual, "(&(mail=jdoe@example.com)(memberOf=cn=ldap-users,ou=Groups,dc=example,dc=com))")
+		})
+
+		Convey("Then searches without filter get the constraint only", func() {
+			_, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+			So(filter.String(delegate.lastFilter), ShouldEqual, "(memberOf=cn=ldap-users,ou=Groups,dc=example,dc=com)")
+		})
+	})
+
+	Convey("Given an invalid replacement", t, func() {
+		_, err := NewBackend(&testBackend{}, &RewriteConfig{Replace: []*Replacement{{Match: "(objectClass=posixAccount", With: "(objectCategory=person)"}}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
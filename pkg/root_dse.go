@@ -0,0 +1,170 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/subschema"
+	"github.com/samuel/go-ldap/ldap"
+	"sort"
+	"strings"
+)
+
+const (
+	oidPasswordModify = "1.3.6.1.4.1.4203.1.11.1"
+	oidWhoAmI         = "1.3.6.1.4.1.4203.1.11.3"
+)
+
+// isRootDSE reports whether the search reads the root dse, a base search of
+// the empty dn, which clients may do before binding.
+func isRootDSE(req *ldap.SearchRequest) bool {
+	return req.BaseDN == "" && req.Scope == ldap.ScopeBaseObject
+}
+
+// isSubschema reports whether the search reads the published subschema
+// subentry
+func (ldapProxy *LdapProxy) isSubschema(req *ldap.SearchRequest) bool {
+	return ldapProxy.config.Subschema != nil && req.Scope == ldap.ScopeBaseObject && subschema.IsEntry(req.BaseDN)
+}
+
+// rootDSE answers a search of the root dse through the backend api. Over the
+// wire the ldap library answers it from the published attributes.
+func (ldapProxy *LdapProxy) rootDSE(req *ldap.SearchRequest) *ldap.SearchResponse {
+	return searchEntry("", ldapProxy.rootDSEAttributes(), req)
+}
+
+// rootDSEAttributes are the naming contexts of the enabled backends and the
+// capabilities of the proxy. No controls and sasl mechanisms are listed, the
+// ldap library supports neither.
+func (ldapProxy *LdapProxy) rootDSEAttributes() map[string][]string {
+	attributes := map[string][]string{
+		"objectClass":          {"top"},
+		"namingContexts":       ldapProxy.namingContexts(),
+		"supportedLDAPVersion": {"3"},
+		"supportedExtension":   {oidPasswordModify, oidWhoAmI},
+		"vendorName":           {"ldap-proxy"},
+	}
+	if ldapProxy.config.Subschema != nil {
+		attributes["subschemaSubentry"] = []string{subschema.DN}
+	}
+	if ldapProxy.config.Monitor {
+		attributes["monitorContext"] = []string{monitorDN}
+	}
+
+	return attributes
+}
+
+// publishRootDSE sets the root dse of the current backends and config on the
+// servers, the ldap library answers searches of it without asking the proxy.
+func (ldapProxy *LdapProxy) publishRootDSE() {
+	attributes := ldapProxy.current().rootDSEAttributes()
+
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	for server := range ldapProxy.servers {
+		server.RootDSE = attributes
+	}
+}
+
+// addServer publishes the root dse on the server of the proxy or a listener
+func (ldapProxy *LdapProxy) addServer(server *ldap.Server) {
+	ldapProxy.mutex.Lock()
+	ldapProxy.servers[server] = true
+	ldapProxy.mutex.Unlock()
+
+	ldapProxy.publishRootDSE()
+}
+
+// removeServer stops publishing the root dse on the server of a closed
+// listener
+func (ldapProxy *LdapProxy) removeServer(server *ldap.Server) {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	delete(ldapProxy.servers, server)
+}
+
+// subschemaEntry answers a search of the subschema subentry.
+func (ldapProxy *LdapProxy) subschemaEntry(req *ldap.SearchRequest) *ldap.SearchResponse {
+	return searchEntry(subschema.DN, ldapProxy.config.Subschema.Attributes(), req)
+}
+
+// searchEntry answers a base search of an entry of the proxy itself
+func searchEntry(dn string, attributes map[string][]string, req *ldap.SearchRequest) *ldap.SearchResponse {
+	res := &ldap.SearchResponse{
+		BaseResponse: ldap.BaseResponse{
+			Code: ldap.ResultSuccess,
+		},
+	}
+
+	if !filter.Matches(attributes, req.Filter) {
+		return res
+	}
+
+	result := toSearchResult(&User{DN: dn, Attributes: requestedAttributes(attributes, req.Attributes)})
+	res.Results = []*ldap.SearchResult{typesOnly(result, req.TypesOnly)}
+
+	return res
+}
+
+// namingContexts lists the distinct naming contexts of the enabled backends
+func (ldapProxy *LdapProxy) namingContexts() []string {
+	seen := make(map[string]bool)
+	namingContexts := []string{}
+
+	for _, backend := range ldapProxy.ordered {
+		if !ldapProxy.isEnabled(backend.Name()) {
+			continue
+		}
+
+		for _, namingContext := range ldapProxy.config.NamingContexts[backend.Name()] {
+			if key := strings.ToLower(namingContext); !seen[key] {
+				seen[key] = true
+				namingContexts = append(namingContexts, namingContext)
+			}
+		}
+	}
+
+	sort.Strings(namingContexts)
+
+	return namingContexts
+}
+
+// requestedAttributes keeps the requested attributes, all of them if none,
+// `*` or `+` is requested. Empty attributes are dropped.
+func requestedAttributes(attributes map[string][]string, requested map[string]bool) map[string][]string {
+	all := len(requested) == 0 || requested["*"] || requested["+"]
+
+	wanted := make(map[string]bool)
+	for name := range requested {
+		wanted[strings.ToLower(name)] = true
+	}
+
+	result := make(map[string][]string)
+	for name, values := range attributes {
+		if len(values) > 0 && (all || wanted[strings.ToLower(name)]) {
+			result[name] = values
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/gopenguin/ldap-proxy/pkg/subschema"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_RootDSE(t *testing.T) {
+	Convey("Given a ldap proxy with backends of two naming contexts and an anonymous session", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "a"}, &testBackend{name: "b"}, &testBackend{name: "c"})
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{
+			"a": {"dc=example,dc=com"},
+			"b": {"DC=Example,DC=Com"},
+			"c": {"dc=corp,dc=example,dc=com"},
+		}
+		config.Subschema = subschema.Default()
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When the root dse is read", func() {
+			res, err := proxy.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeBaseObject, Filter: &ldap.Present{Attribute: "objectClass"}})
+
+			Convey("Then the distinct naming contexts and capabilities are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "")
+				So(res.Results[0].Attributes["namingContexts"], ShouldResemble, [][]byte{[]byte("dc=corp,dc=example,dc=com"), []byte("dc=example,dc=com")})
+				So(res.Results[0].Attributes["supportedLDAPVersion"], ShouldResemble, [][]byte{[]byte("3")})
+				So(res.Results[0].Attributes["subschemaSubentry"], ShouldResemble, [][]byte{[]byte("cn=Subschema")})
+			})
+		})
+
+		Convey("When single attributes of the root dse are requested", func() {
+			res, _ := proxy.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeBaseObject, Attributes: map[string]bool{"namingcontexts": true}})
+
+			Convey("Then only these are returned", func() {
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].Attributes, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the subschema subentry is read", func() {
+			res, err := proxy.Search(ctx, &ldap.SearchRequest{BaseDN: "cn=subschema", Scope: ldap.ScopeBaseObject, Attributes: map[string]bool{"objectClasses": true}})
+
+			Convey("Then the object classes are returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(res.Results[0].DN, ShouldEqual, "cn=Subschema")
+				So(res.Results[0].Attributes["objectClasses"], ShouldHaveLength, len(subschema.DefaultObjectClasses))
+			})
+		})
+
+		Convey("When a backend is disabled", func() {
+			proxy.SetBackendEnabled("c", false)
+			res, _ := proxy.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeBaseObject})
+
+			Convey("Then its naming context isn't listed", func() {
+				So(res.Results[0].Attributes["namingContexts"], ShouldResemble, [][]byte{[]byte("dc=example,dc=com")})
+			})
+		})
+
+		Convey("When the root dse is published on the servers", func() {
+			listener := proxy.NewListener(ListenerConfig{Name: "partner"})
+
+			Convey("Then the ldap library answers with the naming contexts", func() {
+				So(proxy.server.RootDSE["namingContexts"], ShouldResemble, []string{"dc=corp,dc=example,dc=com", "dc=example,dc=com"})
+				So(proxy.server.RootDSE["subschemaSubentry"], ShouldResemble, []string{"cn=Subschema"})
+				So(listener.server.RootDSE["namingContexts"], ShouldResemble, []string{"dc=corp,dc=example,dc=com", "dc=example,dc=com"})
+			})
+
+			Convey("Then a disabled backend is removed from them", func() {
+				proxy.SetBackendEnabled("c", false)
+
+				So(proxy.server.RootDSE["namingContexts"], ShouldResemble, []string{"dc=example,dc=com"})
+				So(listener.server.RootDSE["namingContexts"], ShouldResemble, []string{"dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the empty dn is searched with subtree scope", func() {
+			res, _ := proxy.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the anonymous session is refused as before", func() {
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+			})
+		})
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"regexp"
+	"strings"
+)
+
+const (
+	regexPrefix = "regex:"
+
+	MatchDn  = "dn"
+	MatchUid = "uid"
+)
+
+// Config restricts the binds delegated to a backend. A pattern is a glob
+// (`*` and `?`) unless prefixed with `regex:`. Patterns, regular expressions
+// too, are matched case insensitive against the whole normalized bind dn, e.g.
+// `cn=john doe,dc=example,dc=com`, or, with `bindMatch` set to `uid`, against
+// the value of the first rdn.
+type Config struct {
+	pkg.Config
+
+	BindPatterns []string `json:"bindPatterns"`
+	BindMatch    string   `json:"bindMatch"`
+}
+
+type routingBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+	config          *Config
+
+	patterns []*regexp.Regexp
+}
+
+var _ pkg.PasswordBackend = &routingBackend{}
+var _ pkg.WriterBackend = &routingBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *Config) (backend pkg.Backend, err error) {
+	if config.BindMatch != "" && config.BindMatch != MatchDn && config.BindMatch != MatchUid {
+		return nil, fmt.Errorf("routing: unknown bindMatch '%s'", config.BindMatch)
+	}
+
+	patterns := make([]*regexp.Regexp, len(config.BindPatterns))
+	for i, pattern := range config.BindPatterns {
+		patterns[i], err = compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &routingBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		config:          config,
+		patterns:        patterns,
+	}, nil
+}
+
+func (backend *routingBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *routingBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	if !backend.Routes(username) {
+		log.ForBackend(backend.Name()).Debugf("bind of %s not routed to %s", username, backend.Name())
+		return false
+	}
+
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *routingBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *routingBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.delegateBackend.GetUsers(ctx, f)
+}
+
+// Routes reports whether a bind of the given dn should reach the backend.
+func (backend *routingBackend) Routes(dn string) bool {
+	value := util.NormalizeDN(dn)
+	if backend.config.BindMatch == MatchUid {
+		value = extractUid(dn)
+	}
+
+	for _, pattern := range backend.patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, regexPrefix) {
+		// like globs a regular expression has to match the whole value
+		return regexp.Compile("(?i)^(?:" + strings.TrimPrefix(pattern, regexPrefix) + ")$")
+	}
+
+	var expr bytes.Buffer
+	expr.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// extractUid returns the value of the first rdn, or the whole name if it
+// isn't a dn (e.g. user@example.com)
+func extractUid(dn string) string {
+	rdn := util.SplitDN(dn)[0]
+
+	parts := strings.SplitN(rdn, "=", 2)
+	if len(parts) != 2 {
+		return strings.TrimSpace(dn)
+	}
+
+	return strings.TrimSpace(parts[1])
+}
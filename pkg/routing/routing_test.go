@@ -0,0 +1,144 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	lastUsername string
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.lastUsername = username
+
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return []*pkg.User{}, nil
+}
+
+func TestRoutingBackend_Authenticate(t *testing.T) {
+	Convey("Given a routing backend with a glob pattern", t, func() {
+		delegate := &testBackend{lastUsername: "none"}
+		backend, err := NewBackend(delegate, &Config{BindPatterns: []string{"*@contractors.example.com"}})
+		So(err, ShouldBeNil)
+
+		Convey("When a matching user binds", func() {
+			result := backend.Authenticate(context.Background(), "Jane@Contractors.example.com", "password")
+
+			Convey("Then the bind is delegated", func() {
+				So(result, ShouldBeTrue)
+				So(delegate.lastUsername, ShouldEqual, "Jane@Contractors.example.com")
+			})
+		})
+
+		Convey("When a user of another domain binds", func() {
+			result := backend.Authenticate(context.Background(), "john@example.com", "password")
+
+			Convey("Then the delegate is not invoked", func() {
+				So(result, ShouldBeFalse)
+				So(delegate.lastUsername, ShouldEqual, "none")
+			})
+		})
+	})
+
+	Convey("Given a routing backend with a dn pattern", t, func() {
+		delegate := &testBackend{lastUsername: "none"}
+		backend, err := NewBackend(delegate, &Config{BindPatterns: []string{"*,ou=People,dc=example,dc=com"}})
+		So(err, ShouldBeNil)
+
+		Convey("When a user binds with a differently spaced dn", func() {
+			result := backend.Authenticate(context.Background(), "CN=John Doe, OU=People, DC=Example, DC=com", "password")
+
+			Convey("Then the bind is delegated with the dn unchanged", func() {
+				So(result, ShouldBeTrue)
+				So(delegate.lastUsername, ShouldEqual, "CN=John Doe, OU=People, DC=Example, DC=com")
+			})
+		})
+	})
+
+	Convey("Given a routing backend matching the uid with a regex", t, func() {
+		delegate := &testBackend{lastUsername: "none"}
+		backend, err := NewBackend(delegate, &Config{BindPatterns: []string{"regex:^ext-[0-9]+$"}, BindMatch: MatchUid})
+		So(err, ShouldBeNil)
+
+		Convey("When a matching user binds", func() {
+			result := backend.Authenticate(context.Background(), "uid=ext-42,ou=People,dc=example,dc=com", "password")
+
+			Convey("Then the bind is delegated", func() {
+				So(result, ShouldBeTrue)
+			})
+		})
+
+		Convey("When a user without matching uid binds", func() {
+			result := backend.Authenticate(context.Background(), "uid=jdoe,ou=ext-42,dc=example,dc=com", "password")
+
+			Convey("Then the delegate is not invoked", func() {
+				So(result, ShouldBeFalse)
+				So(delegate.lastUsername, ShouldEqual, "none")
+			})
+		})
+	})
+
+	Convey("Given a routing backend matching the dn with an unanchored regex", t, func() {
+		delegate := &testBackend{lastUsername: "none"}
+		backend, err := NewBackend(delegate, &Config{BindPatterns: []string{"regex:uid=admin"}})
+		So(err, ShouldBeNil)
+
+		Convey("When the dn matches the whole regex", func() {
+			result := backend.Authenticate(context.Background(), "uid=admin", "password")
+
+			Convey("Then the bind is delegated", func() {
+				So(result, ShouldBeTrue)
+			})
+		})
+
+		Convey("When only a part of the dn matches", func() {
+			longer := backend.Authenticate(context.Background(), "uid=administrator,dc=example,dc=com", "password")
+			below := backend.Authenticate(context.Background(), "cn=x,uid=admin", "password")
+
+			Convey("Then the delegate is not invoked", func() {
+				So(longer, ShouldBeFalse)
+				So(below, ShouldBeFalse)
+				So(delegate.lastUsername, ShouldEqual, "none")
+			})
+		})
+	})
+
+	Convey("Given an unknown match mode", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{BindPatterns: []string{"*"}, BindMatch: "cn"})
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
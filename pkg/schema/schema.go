@@ -0,0 +1,227 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+const (
+	InvalidFlag   = "flag"
+	InvalidRepair = "repair"
+	InvalidDrop   = "drop"
+
+	reasonMissing  = "missing_required"
+	reasonMultiple = "multiple_values"
+)
+
+var (
+	invalidEntriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "schema",
+		Name:      "invalid_entries_total",
+		Help:      "The total number of backend entries violating the schema, by what was done with them",
+	}, []string{"backend", "reason", "action"})
+)
+
+func init() {
+	prometheus.MustRegister(invalidEntriesTotal)
+}
+
+// SchemaConfig describes the entries a backend must return. Invalid entries
+// are flagged (logged and counted, the default), repaired or dropped. A
+// repair keeps the first value of single valued attributes and takes missing
+// required attributes from the rdn, entries which can't be repaired are
+// dropped.
+type SchemaConfig struct {
+	Required     []string `json:"required"`
+	SingleValued []string `json:"singleValued"`
+	Invalid      string   `json:"invalid"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Schema *SchemaConfig `json:"schema"`
+}
+
+type schemaBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+	config          *SchemaConfig
+}
+
+type violation struct {
+	reason    string
+	attribute string
+}
+
+func (v violation) String() string {
+	return v.reason + " " + v.attribute
+}
+
+var _ pkg.PasswordBackend = &schemaBackend{}
+var _ pkg.WriterBackend = &schemaBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *SchemaConfig) (backend pkg.Backend, err error) {
+	switch config.Invalid {
+	case "":
+		config.Invalid = InvalidFlag
+	case InvalidFlag, InvalidRepair, InvalidDrop:
+	default:
+		return nil, fmt.Errorf("schema: unknown invalid action '%s'", config.Invalid)
+	}
+
+	return &schemaBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		config:          config,
+	}, nil
+}
+
+func (backend *schemaBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *schemaBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *schemaBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *schemaBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make([]*pkg.User, 0, len(users))
+	for _, user := range users {
+		violations := backend.validate(user)
+		if len(violations) == 0 {
+			valid = append(valid, user)
+			continue
+		}
+
+		action := backend.config.Invalid
+		if action == InvalidRepair {
+			if repaired, ok := backend.repair(user); ok {
+				user = repaired
+			} else {
+				action = InvalidDrop
+			}
+		}
+
+		for _, v := range violations {
+			invalidEntriesTotal.With(prometheus.Labels{"backend": backend.Name(), "reason": v.reason, "action": action}).Inc()
+		}
+		log.ForBackend(backend.Name()).Printf("entry %s of backend %s violates the schema (%v): %s", user.DN, backend.Name(), violations, action)
+
+		if action != InvalidDrop {
+			valid = append(valid, user)
+		}
+	}
+
+	return valid, nil
+}
+
+func (backend *schemaBackend) validate(user *pkg.User) []violation {
+	var violations []violation
+	for _, attribute := range backend.config.Required {
+		if len(values(user.Attributes, attribute)) == 0 {
+			violations = append(violations, violation{reasonMissing, attribute})
+		}
+	}
+	for _, attribute := range backend.config.SingleValued {
+		if len(values(user.Attributes, attribute)) > 1 {
+			violations = append(violations, violation{reasonMultiple, attribute})
+		}
+	}
+
+	return violations
+}
+
+// repair returns a valid copy of the user, the entries returned by the
+// backend may be shared and must not be changed.
+func (backend *schemaBackend) repair(user *pkg.User) (*pkg.User, bool) {
+	repaired := &pkg.User{
+		DN:         user.DN,
+		Attributes: make(map[string][]string, len(user.Attributes)),
+	}
+	for name, vals := range user.Attributes {
+		repaired.Attributes[name] = vals
+	}
+
+	for _, attribute := range backend.config.SingleValued {
+		for name, vals := range repaired.Attributes {
+			if strings.EqualFold(name, attribute) && len(vals) > 1 {
+				repaired.Attributes[name] = vals[:1]
+			}
+		}
+	}
+
+	rdnAttribute, rdnValue := rdn(user.DN)
+	for _, attribute := range backend.config.Required {
+		if len(values(repaired.Attributes, attribute)) > 0 {
+			continue
+		}
+		if !strings.EqualFold(attribute, rdnAttribute) {
+			return nil, false
+		}
+		repaired.Attributes[attribute] = []string{rdnValue}
+	}
+
+	return repaired, true
+}
+
+func values(attributes map[string][]string, attribute string) []string {
+	for name, vals := range attributes {
+		if strings.EqualFold(name, attribute) {
+			return vals
+		}
+	}
+
+	return nil
+}
+
+// rdn splits the first rdn of the dn into its attribute and value
+func rdn(dn string) (attribute string, value string) {
+	parts := strings.SplitN(strings.SplitN(dn, ",", 2)[0], "=", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package schema
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.users, nil
+}
+
+func TestSchemaBackend_GetUsers(t *testing.T) {
+	Convey("Given a backend returning a valid and two invalid entries", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "uid=a,dc=example,dc=com", Attributes: map[string][]string{"uid": {"a"}, "mail": {"a@example.com"}}},
+			{DN: "uid=b,dc=example,dc=com", Attributes: map[string][]string{"MAIL": {"b@example.com", "b2@example.com"}}},
+			{DN: "uid=c,dc=example,dc=com", Attributes: map[string][]string{"uid": {"c"}}},
+		}}
+		config := &SchemaConfig{Required: []string{"uid"}, SingleValued: []string{"mail"}}
+
+		Convey("When the invalid entries are flagged", func() {
+			backend, err := NewBackend(delegate, config)
+			So(err, ShouldBeNil)
+			users, err := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then all entries are returned", func() {
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When the invalid entries are dropped", func() {
+			config.Invalid = InvalidDrop
+			backend, _ := NewBackend(delegate, config)
+			users, _ := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then only the valid entries are returned", func() {
+				So(users, ShouldHaveLength, 2)
+				So(users[0].DN, ShouldEqual, "uid=a,dc=example,dc=com")
+				So(users[1].DN, ShouldEqual, "uid=c,dc=example,dc=com")
+			})
+		})
+
+		Convey("When the invalid entries are repaired", func() {
+			config.Invalid = InvalidRepair
+			backend, _ := NewBackend(delegate, config)
+			users, _ := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the first value is kept and the missing attribute is taken from the rdn", func() {
+				So(users, ShouldHaveLength, 3)
+				So(users[1].Attributes["MAIL"], ShouldResemble, []string{"b@example.com"})
+				So(users[1].Attributes["uid"], ShouldResemble, []string{"b"})
+			})
+
+			Convey("Then the entries of the backend are unchanged", func() {
+				So(delegate.users[1].Attributes["MAIL"], ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When a required attribute isn't part of the rdn", func() {
+			config.Required = []string{"cn"}
+			config.Invalid = InvalidRepair
+			backend, _ := NewBackend(delegate, config)
+			users, _ := backend.GetUsers(context.Background(), nil)
+
+			Convey("Then the entries can't be repaired and are dropped", func() {
+				So(users, ShouldHaveLength, 0)
+			})
+		})
+	})
+
+	Convey("Given an unknown invalid action", t, func() {
+		_, err := NewBackend(&testBackend{}, &SchemaConfig{Invalid: "ignore"})
+
+		Convey("Then the backend is rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
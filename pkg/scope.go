@@ -0,0 +1,76 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// A SearchScope limits a search to the base entry, its children or its whole
+// subtree. Backends may read it with GetSearchScope to narrow their queries,
+// the proxy drops the entries outside of the scope anyway.
+type SearchScope struct {
+	BaseDN string
+	Scope  ldap.Scope
+}
+
+// Contains reports whether the entry with the dn is within the scope. Dns are
+// compared case insensitive, ignoring spaces around the rdns.
+func (scope SearchScope) Contains(dn string) bool {
+	dn, base := util.NormalizeDN(dn), util.NormalizeDN(scope.BaseDN)
+
+	switch scope.Scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		return dn != "" && util.ParentDN(dn) == base
+	default:
+		return base == "" || util.IsBelowDN(dn, base)
+	}
+}
+
+func GetSearchScope(ctx context.Context) (SearchScope, bool) {
+	value := ctx.Value(contextKeyScope)
+	if value == nil {
+		return SearchScope{}, false
+	}
+
+	return value.(SearchScope), true
+}
+
+// WithSearchScope passes the scope of a search to the backends.
+func WithSearchScope(ctx context.Context, scope SearchScope) context.Context {
+	return context.WithValue(ctx, contextKeyScope, scope)
+}
+
+// inScope drops the users outside of the scope
+func inScope(users []*User, scope SearchScope) []*User {
+	var scoped []*User
+	for _, user := range users {
+		if scope.Contains(user.DN) {
+			scoped = append(scoped, user)
+		}
+	}
+
+	return scoped
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSearchScope_Contains(t *testing.T) {
+	Convey("Given a base dn", t, func() {
+		base := "ou=People,dc=example,dc=com"
+
+		Convey("When the scope is the base object", func() {
+			scope := SearchScope{BaseDN: base, Scope: ldap.ScopeBaseObject}
+
+			Convey("Then only the base entry is contained", func() {
+				So(scope.Contains("OU=People, DC=example, DC=com"), ShouldBeTrue)
+				So(scope.Contains("uid=a,ou=People,dc=example,dc=com"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the scope is a single level", func() {
+			scope := SearchScope{BaseDN: base, Scope: ldap.ScopeSingleLevel}
+
+			Convey("Then only the children of the base are contained", func() {
+				So(scope.Contains("uid=a,ou=People,dc=example,dc=com"), ShouldBeTrue)
+				So(scope.Contains(`cn=Doe\, John,ou=People,dc=example,dc=com`), ShouldBeTrue)
+				So(scope.Contains("ou=People,dc=example,dc=com"), ShouldBeFalse)
+				So(scope.Contains("uid=a,ou=Old,ou=People,dc=example,dc=com"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the scope is the whole subtree", func() {
+			scope := SearchScope{BaseDN: base, Scope: ldap.ScopeWholeSubtree}
+
+			Convey("Then the base and all entries below are contained", func() {
+				So(scope.Contains("ou=People,dc=example,dc=com"), ShouldBeTrue)
+				So(scope.Contains("uid=a,ou=Old,ou=People,dc=example,dc=com"), ShouldBeTrue)
+				So(scope.Contains("cn=admins,ou=Groups,dc=example,dc=com"), ShouldBeFalse)
+				So(scope.Contains("uid=a,ou=NotPeople,dc=example,dc=com"), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_SearchScope(t *testing.T) {
+	Convey("Given a ldap proxy with a backend returning entries of two subtrees", t, func() {
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{user: []*User{
+			{DN: "uid=a,ou=People,dc=example,dc=com"},
+			{DN: "cn=admins,ou=Groups,dc=example,dc=com"},
+		}})
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When one subtree is searched", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then only its entries are returned", func() {
+				So(err, ShouldBeNil)
+				So(resultDns(res), ShouldResemble, map[string]bool{"uid=a,ou=People,dc=example,dc=com": true})
+			})
+		})
+
+		Convey("When an entry is read with base scope", func() {
+			res, _ := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "cn=admins,ou=Groups,dc=example,dc=com", Scope: ldap.ScopeBaseObject})
+
+			Convey("Then only the entry is returned", func() {
+				So(resultDns(res), ShouldResemble, map[string]bool{"cn=admins,ou=Groups,dc=example,dc=com": true})
+			})
+		})
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// HooksConfig adapts a backend to site specific quirks with expressions: the
+// bind hook returns the name the backend authenticates from the `username`,
+// the attribute hooks return the values of the attributes of the entries from
+// their `dn` and attributes and the drop hook drops the entries it is true
+// for.
+type HooksConfig struct {
+	Bind       string            `json:"bind"`
+	Attributes map[string]string `json:"attributes"`
+	Drop       string            `json:"drop"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Hooks *HooksConfig `json:"hooks"`
+}
+
+type hooksBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	bind       *Program
+	attributes map[string]*Program
+	drop       *Program
+}
+
+var _ pkg.PasswordBackend = &hooksBackend{}
+var _ pkg.WriterBackend = &hooksBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *HooksConfig) (pkg.Backend, error) {
+	backend := &hooksBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		attributes:      make(map[string]*Program),
+	}
+
+	var err error
+	if config.Bind != "" {
+		if backend.bind, err = Compile(config.Bind, "username"); err != nil {
+			return nil, err
+		}
+	}
+	for name, source := range config.Attributes {
+		if backend.attributes[name], err = Compile(source, "dn"); err != nil {
+			return nil, err
+		}
+	}
+	if config.Drop != "" {
+		if backend.drop, err = Compile(config.Drop, "dn"); err != nil {
+			return nil, err
+		}
+	}
+
+	return backend, nil
+}
+
+func (backend *hooksBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+// Authenticate passes the name returned by the bind hook to the delegate, a
+// failing hook rejects the bind.
+func (backend *hooksBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	username, ok := backend.username(username)
+	if !ok {
+		return false
+	}
+
+	return backend.delegateBackend.Authenticate(ctx, username, password)
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *hooksBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	username, ok = backend.username(username)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+// GetUsers applies the attribute hooks to copies of the entries, then drops
+// the entries the drop hook is true for. An entry a drop hook fails for is
+// dropped, an attribute a hook fails for is left unchanged.
+func (backend *hooksBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, f)
+	if err != nil || (len(backend.attributes) == 0 && backend.drop == nil) {
+		return users, err
+	}
+
+	var result []*pkg.User
+	for _, user := range users {
+		user = backend.mutate(user)
+
+		if backend.drop != nil {
+			drop, err := backend.drop.EvalBool(&Env{Vars: map[string]interface{}{"dn": user.DN}, Attributes: user.Attributes})
+			if err != nil {
+				log.ForBackend(backend.Name()).Printf("backend %s dropped %s: %v", backend.Name(), user.DN, err)
+				continue
+			}
+			if drop {
+				continue
+			}
+		}
+
+		result = append(result, user)
+	}
+
+	return result, nil
+}
+
+func (backend *hooksBackend) username(username string) (string, bool) {
+	if backend.bind == nil {
+		return username, true
+	}
+
+	value, err := backend.bind.Eval(&Env{Vars: map[string]interface{}{"username": username}})
+	if err != nil {
+		log.ForBackend(backend.Name()).Printf("the bind hook of backend %s failed for %s: %v", backend.Name(), username, err)
+		return "", false
+	}
+
+	mapped, ok := value.(string)
+	if !ok {
+		log.ForBackend(backend.Name()).Printf("the bind hook of backend %s returned %T for %s", backend.Name(), value, username)
+	}
+
+	return mapped, ok
+}
+
+// mutate returns a copy of the user with the attributes set by the hooks. The
+// hooks see the entry of the delegate, an empty result removes the attribute.
+func (backend *hooksBackend) mutate(user *pkg.User) *pkg.User {
+	if len(backend.attributes) == 0 {
+		return user
+	}
+
+	env := &Env{Vars: map[string]interface{}{"dn": user.DN}, Attributes: user.Attributes}
+	computed := make(map[string][]string, len(backend.attributes))
+	for name, program := range backend.attributes {
+		values, err := program.EvalValues(env)
+		if err != nil {
+			log.ForBackend(backend.Name()).Printf("the hook of attribute %s of backend %s failed for %s: %v", name, backend.Name(), user.DN, err)
+			continue
+		}
+		computed[name] = values
+	}
+
+	mutated := &pkg.User{DN: user.DN, Attributes: make(map[string][]string, len(user.Attributes)+len(computed))}
+	for name, values := range user.Attributes {
+		if !containsFold(computed, name) {
+			mutated.Attributes[name] = values
+		}
+	}
+	for name, values := range computed {
+		if len(values) > 0 {
+			mutated.Attributes[name] = values
+		}
+	}
+
+	return mutated
+}
+
+func containsFold(attributes map[string][]string, name string) bool {
+	for attribute := range attributes {
+		if strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+
+	return false
+}
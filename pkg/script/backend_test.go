@@ -0,0 +1,120 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	users []*pkg.User
+
+	lastUsername string
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.lastUsername = username
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.users, nil
+}
+
+func TestHooksBackend(t *testing.T) {
+	Convey("Given a backend with hooks", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "uid=jdoe,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"jdoe"}, "Mail": {"JDoe@Example.com"}}},
+			{DN: "uid=temp,ou=People,dc=example,dc=com", Attributes: map[string][]string{"uid": {"temp"}, "employeeType": {"Temporary"}}},
+		}}
+		backend, err := NewBackend(delegate, &HooksConfig{
+			Bind: `cond(hasSuffix(username, "@example.com"), "uid=" + replace(username, "@example.com", "") + ",ou=People,dc=example,dc=com", username)`,
+			Attributes: map[string]string{
+				"mail":        `lower(attr("mail"))`,
+				"displayName": `upper(attr("uid"))`,
+				"uid":         `attr("missing")`,
+			},
+			Drop: `attr("employeeType") == "Temporary"`,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When a user binds", func() {
+			So(backend.Authenticate(context.Background(), "jdoe@example.com", "secret"), ShouldBeTrue)
+
+			Convey("Then the bind hook maps the name", func() {
+				So(delegate.lastUsername, ShouldEqual, "uid=jdoe,ou=People,dc=example,dc=com")
+			})
+		})
+
+		Convey("When the users are searched", func() {
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then the entries the drop hook is true for are dropped", func() {
+				So(users, ShouldHaveLength, 1)
+				So(users[0].DN, ShouldEqual, "uid=jdoe,ou=People,dc=example,dc=com")
+			})
+
+			Convey("Then the attribute hooks set the attributes", func() {
+				So(users[0].Attributes["mail"], ShouldResemble, []string{"jdoe@example.com"})
+				So(users[0].Attributes, ShouldNotContainKey, "Mail")
+				So(users[0].Attributes["displayName"], ShouldResemble, []string{"JDOE"})
+			})
+
+			Convey("Then an empty result removes the attribute", func() {
+				So(users[0].Attributes, ShouldNotContainKey, "uid")
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].Attributes["Mail"], ShouldResemble, []string{"JDoe@Example.com"})
+			})
+		})
+	})
+
+	Convey("Given a drop hook failing for an entry", t, func() {
+		delegate := &testBackend{users: []*pkg.User{{DN: "uid=jdoe", Attributes: map[string][]string{}}}}
+		backend, err := NewBackend(delegate, &HooksConfig{Drop: `attr("uid")`})
+		So(err, ShouldBeNil)
+
+		users, err := backend.GetUsers(context.Background(), nil)
+
+		Convey("Then the entry is dropped", func() {
+			So(err, ShouldBeNil)
+			So(users, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a hook referencing an unknown variable", t, func() {
+		_, err := NewBackend(&testBackend{}, &HooksConfig{Bind: `dn`})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,525 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Program is a compiled expression in the syntax of go expressions, e.g.
+// `hasSuffix(lower(attr("mail")), "@contractors.example.com")`. The values are
+// strings, integers, booleans and lists of strings, the variables and the
+// attributes of the entry are passed with the Env.
+type Program struct {
+	source string
+	expr   ast.Expr
+
+	// the compiled patterns of the literal arguments of matches
+	patterns map[string]*regexp.Regexp
+}
+
+// Env is what an expression sees while evaluated.
+type Env struct {
+	Vars       map[string]interface{}
+	Attributes map[string][]string
+}
+
+type builtin struct {
+	args int
+	call func(env *Env, args []interface{}) (interface{}, error)
+}
+
+// the functions of the expressions besides matches
+var builtins = map[string]builtin{
+	"attr": {1, func(env *Env, args []interface{}) (interface{}, error) {
+		name, err := asString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if values := filter.Values(env.Attributes, name); len(values) > 0 {
+			return values[0], nil
+		}
+		return "", nil
+	}},
+	"values": {1, func(env *Env, args []interface{}) (interface{}, error) {
+		name, err := asString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{}, filter.Values(env.Attributes, name)...), nil
+	}},
+	"has": {1, func(env *Env, args []interface{}) (interface{}, error) {
+		name, err := asString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return len(filter.Values(env.Attributes, name)) > 0, nil
+	}},
+	"lower": stringFunc(strings.ToLower),
+	"upper": stringFunc(strings.ToUpper),
+	"trim":  stringFunc(strings.TrimSpace),
+	"rdn":   stringFunc(rdnValue),
+	"hasPrefix": {2, func(env *Env, args []interface{}) (interface{}, error) {
+		s, prefix, err := twoStrings(args)
+		return err == nil && strings.HasPrefix(s, prefix), err
+	}},
+	"hasSuffix": {2, func(env *Env, args []interface{}) (interface{}, error) {
+		s, suffix, err := twoStrings(args)
+		return err == nil && strings.HasSuffix(s, suffix), err
+	}},
+	"contains": {2, func(env *Env, args []interface{}) (interface{}, error) {
+		value, err := asString(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := args[0].([]string); ok {
+			for _, v := range list {
+				if strings.EqualFold(v, value) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		s, err := asString(args[0])
+		return err == nil && strings.Contains(s, value), err
+	}},
+	"replace": {3, func(env *Env, args []interface{}) (interface{}, error) {
+		s, old, err := twoStrings(args[:2])
+		if err != nil {
+			return nil, err
+		}
+		with, err := asString(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Replace(s, old, with, -1), nil
+	}},
+	"split": {2, func(env *Env, args []interface{}) (interface{}, error) {
+		s, separator, err := twoStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(s, separator), nil
+	}},
+	"join": {2, func(env *Env, args []interface{}) (interface{}, error) {
+		list, ok := args[0].([]string)
+		if !ok {
+			return nil, fmt.Errorf("join of %T", args[0])
+		}
+		separator, err := asString(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Join(list, separator), nil
+	}},
+	"len": {1, func(env *Env, args []interface{}) (interface{}, error) {
+		switch value := args[0].(type) {
+		case string:
+			return int64(len(value)), nil
+		case []string:
+			return int64(len(value)), nil
+		}
+		return nil, fmt.Errorf("len of %T", args[0])
+	}},
+	"cond": {3, func(env *Env, args []interface{}) (interface{}, error) {
+		condition, ok := args[0].(bool)
+		if !ok {
+			return nil, fmt.Errorf("condition of type %T", args[0])
+		}
+		if condition {
+			return args[1], nil
+		}
+		return args[2], nil
+	}},
+}
+
+// Compile parses the expression and checks that it only references the
+// variables and the builtin functions.
+func Compile(source string, vars ...string) (*Program, error) {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("script: invalid expression '%s': %v", source, err)
+	}
+
+	program := &Program{source: source, expr: expr, patterns: make(map[string]*regexp.Regexp)}
+	if err := program.check(expr, vars); err != nil {
+		return nil, fmt.Errorf("script: invalid expression '%s': %v", source, err)
+	}
+
+	return program, nil
+}
+
+func (program *Program) String() string {
+	return program.source
+}
+
+// Eval evaluates the expression
+func (program *Program) Eval(env *Env) (interface{}, error) {
+	value, err := program.eval(program.expr, env)
+	if err != nil {
+		return nil, fmt.Errorf("script: evaluating '%s' failed: %v", program.source, err)
+	}
+
+	return value, nil
+}
+
+// EvalBool evaluates an expression returning a boolean.
+func (program *Program) EvalBool(env *Env) (bool, error) {
+	value, err := program.Eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("script: '%s' returned %T instead of a bool", program.source, value)
+	}
+
+	return result, nil
+}
+
+// EvalValues evaluates an expression returning the values of an attribute,
+// no value for the empty string.
+func (program *Program) EvalValues(env *Env) ([]string, error) {
+	value, err := program.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := value.(type) {
+	case []string:
+		return value, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		return []string{value}, nil
+	case int64:
+		return []string{strconv.FormatInt(value, 10)}, nil
+	case bool:
+		return []string{strings.ToUpper(strconv.FormatBool(value))}, nil
+	}
+
+	return nil, fmt.Errorf("script: '%s' returned %T", program.source, value)
+}
+
+func (program *Program) check(expr ast.Expr, vars []string) error {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		if expr.Kind != token.STRING && expr.Kind != token.INT {
+			return fmt.Errorf("unsupported literal %s", expr.Value)
+		}
+		_, err := literal(expr)
+		return err
+	case *ast.Ident:
+		if expr.Name == "true" || expr.Name == "false" {
+			return nil
+		}
+		for _, name := range vars {
+			if name == expr.Name {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown variable %s", expr.Name)
+	case *ast.ParenExpr:
+		return program.check(expr.X, vars)
+	case *ast.UnaryExpr:
+		if expr.Op != token.NOT && expr.Op != token.SUB {
+			return fmt.Errorf("unsupported operator %s", expr.Op)
+		}
+		return program.check(expr.X, vars)
+	case *ast.BinaryExpr:
+		switch expr.Op {
+		case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ,
+			token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		default:
+			return fmt.Errorf("unsupported operator %s", expr.Op)
+		}
+		if err := program.check(expr.X, vars); err != nil {
+			return err
+		}
+		return program.check(expr.Y, vars)
+	case *ast.CallExpr:
+		name, ok := expr.Fun.(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("unsupported call")
+		}
+		if name.Name == "matches" {
+			return program.checkMatches(expr, vars)
+		}
+		function, ok := builtins[name.Name]
+		if !ok {
+			return fmt.Errorf("unknown function %s", name.Name)
+		}
+		if len(expr.Args) != function.args || expr.Ellipsis != token.NoPos {
+			return fmt.Errorf("%s takes %d arguments", name.Name, function.args)
+		}
+		for _, arg := range expr.Args {
+			if err := program.check(arg, vars); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported expression")
+}
+
+// checkMatches compiles the literal patterns of matches up front
+func (program *Program) checkMatches(expr *ast.CallExpr, vars []string) error {
+	if len(expr.Args) != 2 {
+		return fmt.Errorf("matches takes 2 arguments")
+	}
+	for _, arg := range expr.Args {
+		if err := program.check(arg, vars); err != nil {
+			return err
+		}
+	}
+
+	if lit, ok := expr.Args[1].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		pattern, _ := literal(lit)
+		compiled, err := regexp.Compile(pattern.(string))
+		if err != nil {
+			return err
+		}
+		program.patterns[pattern.(string)] = compiled
+	}
+
+	return nil
+}
+
+func (program *Program) eval(expr ast.Expr, env *Env) (interface{}, error) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return literal(expr)
+	case *ast.Ident:
+		switch expr.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		value, ok := env.Vars[expr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %s", expr.Name)
+		}
+		return value, nil
+	case *ast.ParenExpr:
+		return program.eval(expr.X, env)
+	case *ast.UnaryExpr:
+		value, err := program.eval(expr.X, env)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := value.(bool); ok && expr.Op == token.NOT {
+			return !b, nil
+		}
+		if i, ok := value.(int64); ok && expr.Op == token.SUB {
+			return -i, nil
+		}
+		return nil, fmt.Errorf("operator %s on %T", expr.Op, value)
+	case *ast.BinaryExpr:
+		return program.evalBinary(expr, env)
+	case *ast.CallExpr:
+		args := make([]interface{}, len(expr.Args))
+		for i, arg := range expr.Args {
+			value, err := program.eval(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		name := expr.Fun.(*ast.Ident).Name
+		if name == "matches" {
+			return program.matches(args)
+		}
+		return builtins[name].call(env, args)
+	}
+
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+func (program *Program) evalBinary(expr *ast.BinaryExpr, env *Env) (interface{}, error) {
+	x, err := program.eval(expr.X, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Op == token.LAND || expr.Op == token.LOR {
+		left, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s on %T", expr.Op, x)
+		}
+		if left == (expr.Op == token.LOR) {
+			return left, nil
+		}
+		y, err := program.eval(expr.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		right, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s on %T", expr.Op, y)
+		}
+		return right, nil
+	}
+
+	y, err := program.eval(expr.Y, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := x.(type) {
+	case string:
+		if y, ok := y.(string); ok {
+			switch expr.Op {
+			case token.ADD:
+				return x + y, nil
+			case token.EQL:
+				return x == y, nil
+			case token.NEQ:
+				return x != y, nil
+			case token.LSS:
+				return x < y, nil
+			case token.GTR:
+				return x > y, nil
+			case token.LEQ:
+				return x <= y, nil
+			case token.GEQ:
+				return x >= y, nil
+			}
+		}
+	case int64:
+		if y, ok := y.(int64); ok {
+			switch expr.Op {
+			case token.ADD:
+				return x + y, nil
+			case token.SUB:
+				return x - y, nil
+			case token.MUL:
+				return x * y, nil
+			case token.QUO, token.REM:
+				if y == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				if expr.Op == token.QUO {
+					return x / y, nil
+				}
+				return x % y, nil
+			case token.EQL:
+				return x == y, nil
+			case token.NEQ:
+				return x != y, nil
+			case token.LSS:
+				return x < y, nil
+			case token.GTR:
+				return x > y, nil
+			case token.LEQ:
+				return x <= y, nil
+			case token.GEQ:
+				return x >= y, nil
+			}
+		}
+	case bool:
+		if y, ok := y.(bool); ok {
+			switch expr.Op {
+			case token.EQL:
+				return x == y, nil
+			case token.NEQ:
+				return x != y, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("operator %s on %T and %T", expr.Op, x, y)
+}
+
+func (program *Program) matches(args []interface{}) (interface{}, error) {
+	s, pattern, err := twoStrings(args)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, ok := program.patterns[pattern]
+	if !ok {
+		compiled, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compiled.MatchString(s), nil
+}
+
+func literal(lit *ast.BasicLit) (interface{}, error) {
+	if lit.Kind == token.INT {
+		return strconv.ParseInt(lit.Value, 0, 64)
+	}
+
+	return strconv.Unquote(lit.Value)
+}
+
+func stringFunc(f func(string) string) builtin {
+	return builtin{1, func(env *Env, args []interface{}) (interface{}, error) {
+		s, err := asString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}}
+}
+
+func asString(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%T instead of a string", value)
+	}
+
+	return s, nil
+}
+
+func twoStrings(args []interface{}) (string, string, error) {
+	a, err := asString(args[0])
+	if err != nil {
+		return "", "", err
+	}
+	b, err := asString(args[1])
+	return a, b, err
+}
+
+// rdnValue returns the value of the first rdn, or the whole name if it isn't
+// a dn (e.g. user@example.com)
+func rdnValue(dn string) string {
+	parts := strings.SplitN(util.SplitDN(dn)[0], "=", 2)
+	if len(parts) != 2 {
+		return strings.TrimSpace(dn)
+	}
+
+	return strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,88 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestProgram_Eval(t *testing.T) {
+	env := &Env{
+		Vars: map[string]interface{}{"dn": "CN=John Doe,OU=People,DC=example,DC=com"},
+		Attributes: map[string][]string{
+			"mail":     {"JDoe@Contractors.example.com"},
+			"memberOf": {"cn=staff,ou=Groups,dc=example,dc=com", "cn=admins,ou=Groups,dc=example,dc=com"},
+		},
+	}
+
+	eval := func(source string) interface{} {
+		program, err := Compile(source, "dn")
+		So(err, ShouldBeNil)
+		value, err := program.Eval(env)
+		So(err, ShouldBeNil)
+		return value
+	}
+
+	Convey("Given expressions on an entry", t, func() {
+		Convey("Then the attributes are read case insensitive", func() {
+			So(eval(`attr("Mail")`), ShouldEqual, "JDoe@Contractors.example.com")
+			So(eval(`attr("missing")`), ShouldEqual, "")
+			So(eval(`has("MEMBEROF") && !has("missing")`), ShouldEqual, true)
+			So(eval(`len(values("memberOf"))`), ShouldEqual, int64(2))
+		})
+
+		Convey("Then the string functions are applied", func() {
+			So(eval(`hasSuffix(lower(attr("mail")), "@contractors.example.com")`), ShouldEqual, true)
+			So(eval(`contains(values("memberOf"), "CN=admins,ou=Groups,dc=example,dc=com")`), ShouldEqual, true)
+			So(eval(`rdn(dn) + " <" + lower(attr("mail")) + ">"`), ShouldEqual, "John Doe <jdoe@contractors.example.com>")
+			So(eval(`join(split(replace(dn, "DC=", "dc="), ","), ";")`), ShouldEqual, "CN=John Doe;OU=People;dc=example;dc=com")
+			So(eval(`matches(attr("mail"), "(?i)^jdoe@")`), ShouldEqual, true)
+		})
+
+		Convey("Then the operators are evaluated", func() {
+			So(eval(`cond(len(attr("mail")) > 10, "long", "short")`), ShouldEqual, "long")
+			So(eval(`(1 + 2) * 3 % 5 == 4`), ShouldEqual, true)
+			So(eval(`-1 < 0 || 1/0 == 0`), ShouldEqual, true)
+		})
+	})
+
+	Convey("Given invalid expressions", t, func() {
+		Convey("Then compiling them fails", func() {
+			for _, source := range []string{`attr(`, `unknown("mail")`, `attr("a", "b")`, `username`, `x.y`, `matches(dn, "(")`, `1.5`} {
+				_, err := Compile(source, "dn")
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("Then type errors fail the evaluation", func() {
+			program, err := Compile(`attr("mail") + 1`, "dn")
+			So(err, ShouldBeNil)
+			_, err = program.Eval(env)
+			So(err, ShouldNotBeNil)
+
+			program, err = Compile(`attr("mail")`, "dn")
+			So(err, ShouldBeNil)
+			_, err = program.EvalBool(env)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
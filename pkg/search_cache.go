@@ -0,0 +1,198 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"encoding/gob"
+	"github.com/gopenguin/ldap-proxy/pkg/admin"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var _ admin.Cache = &LdapProxy{}
+
+func init() {
+	// the search results are encoded if the search cache is shared
+	gob.Register([]*User{})
+}
+
+// cachedSearch answers repeated identical searches from the search cache
+// instead of querying the backends. Empty results are kept in the negative
+// cache. If every backend is unreachable the last result of the search is
+// served from the offline cache.
+func (ldapProxy *LdapProxy) cachedSearch(ctx context.Context, req *ldap.SearchRequest) ([]*User, error) {
+	searchCache := ldapProxy.config.SearchCache
+	negativeCache := ldapProxy.config.NegativeSearchCache
+	offlineCache := ldapProxy.config.OfflineSearchCache
+	if searchCache == nil && negativeCache == nil && offlineCache == nil {
+		users, err := ldapProxy.searchScope(ctx, req)
+		if err == errBackendsUnreachable {
+			return nil, nil
+		}
+		return users, err
+	}
+
+	key := ldapProxy.searchCacheKey(ctx, req)
+	if users, ok := searchCache.Get(key); ok {
+		return users.([]*User), nil
+	}
+	if _, ok := negativeCache.Get(key); ok {
+		return nil, nil
+	}
+
+	users, err := ldapProxy.searchScope(ctx, req)
+	if err == errBackendsUnreachable {
+		return ldapProxy.offlineSearch(ctx, key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offlineCache.Set(key, users)
+	if len(users) == 0 {
+		negativeCache.Set(key, true)
+	} else {
+		searchCache.Set(key, users)
+	}
+
+	return users, nil
+}
+
+// searchScope searches the backends and drops the entries outside of the
+// base and scope of the request. Backends find the scope in the context.
+func (ldapProxy *LdapProxy) searchScope(ctx context.Context, req *ldap.SearchRequest) ([]*User, error) {
+	scope := SearchScope{BaseDN: req.BaseDN, Scope: req.Scope}
+
+	users, err := ldapProxy.searchBackends(WithSearchScope(ctx, scope), req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return inScope(users, scope), nil
+}
+
+// searchCacheKey identifies a search by base dn, scope, filter and requested
+// attributes. With session affinity the queried backend is part of the key.
+func (ldapProxy *LdapProxy) searchCacheKey(ctx context.Context, req *ldap.SearchRequest) string {
+	attributes := make([]string, 0, len(req.Attributes))
+	for attribute := range req.Attributes {
+		attributes = append(attributes, strings.ToLower(attribute))
+	}
+	sort.Strings(attributes)
+
+	filter := ""
+	if req.Filter != nil {
+		filter = req.Filter.String()
+	}
+
+	backend := ""
+	if ldapProxy.config.SessionAffinity {
+		backend = getBackend(ctx)
+	}
+
+	return strings.Join([]string{
+		util.NormalizeDN(req.BaseDN),
+		strconv.Itoa(int(req.Scope)),
+		filter,
+		strings.Join(attributes, ","),
+		backend,
+	}, "\x00")
+}
+
+// FlushCache drops all cached search results and binds, including the offline
+// cache.
+func (ldapProxy *LdapProxy) FlushCache() {
+	ldapProxy = ldapProxy.current()
+
+	ldapProxy.config.SearchCache.Flush()
+	ldapProxy.config.NegativeSearchCache.Flush()
+	ldapProxy.config.BindCache.Flush()
+	ldapProxy.config.NegativeBindCache.Flush()
+	ldapProxy.config.OfflineSearchCache.Flush()
+	ldapProxy.config.OfflineBindCache.Flush()
+}
+
+// InvalidateCache drops the cached binds of the dn and the cached search
+// results containing the entry. The entry may have been created out of band,
+// so the empty results of searches at or above it are dropped too.
+func (ldapProxy *LdapProxy) InvalidateCache(dn string) int {
+	ldapProxy = ldapProxy.current()
+
+	dn = util.NormalizeDN(dn)
+
+	containsEntry := func(key string, value interface{}) bool {
+		for _, user := range value.([]*User) {
+			if util.NormalizeDN(user.DN) == dn {
+				return true
+			}
+		}
+		return false
+	}
+	containsBase := func(key string, value interface{}) bool {
+		baseDN := key[:strings.Index(key, "\x00")]
+		return baseDN == "" || baseDN == dn || strings.HasSuffix(dn, ","+baseDN)
+	}
+
+	entries := ldapProxy.config.SearchCache.DeleteFunc(containsEntry)
+	entries += ldapProxy.config.OfflineSearchCache.DeleteFunc(containsEntry)
+	entries += ldapProxy.config.NegativeSearchCache.DeleteFunc(containsBase)
+
+	ldapProxy.config.BindCache.Invalidate(dn)
+	ldapProxy.config.NegativeBindCache.Invalidate(dn)
+	ldapProxy.config.OfflineBindCache.Invalidate(dn)
+
+	return entries
+}
+
+// CacheStats returns the stats of the enabled caches.
+func (ldapProxy *LdapProxy) CacheStats() []admin.CacheStats {
+	ldapProxy = ldapProxy.current()
+
+	stats := []admin.CacheStats{}
+	for _, cacheStats := range []cache.Stats{
+		ldapProxy.config.SearchCache.Stats(),
+		ldapProxy.config.NegativeSearchCache.Stats(),
+		ldapProxy.config.OfflineSearchCache.Stats(),
+		ldapProxy.config.BindCache.Stats(),
+		ldapProxy.config.NegativeBindCache.Stats(),
+		ldapProxy.config.OfflineBindCache.Stats(),
+	} {
+		if cacheStats.Name == "" {
+			continue
+		}
+
+		stats = append(stats, admin.CacheStats{
+			Name:       cacheStats.Name,
+			Entries:    cacheStats.Entries,
+			MaxEntries: cacheStats.MaxEntries,
+			TTL:        cacheStats.TTL.String(),
+			Hits:       cacheStats.Hits,
+			Misses:     cacheStats.Misses,
+		})
+	}
+
+	return stats
+}
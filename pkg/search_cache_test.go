@@ -0,0 +1,164 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/gopenguin/ldap-proxy/pkg/cache"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLdapProxy_SearchCache(t *testing.T) {
+	Convey("Given a ldap proxy with a search cache", t, func() {
+		backend := &testBackend{user: []*User{{DN: "cn=a,dc=example,dc=com"}}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.SearchCache, _ = cache.New("test", &cache.Config{})
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+		Convey("When the same search is repeated", func() {
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "DC=example,DC=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the result is served from the cache", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldHaveLength, 1)
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When another base is searched", func() {
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "ou=People,dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backend is searched", func() {
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the cache is flushed", func() {
+			proxy.FlushCache()
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backend is searched again", func() {
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the cache of a returned entry is invalidated", func() {
+			entries := proxy.InvalidateCache("CN=a,DC=example,DC=com")
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backend is searched again", func() {
+				So(entries, ShouldEqual, 1)
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the cache of another entry is invalidated", func() {
+			entries := proxy.InvalidateCache("cn=b,dc=example,dc=com")
+
+			Convey("Then the result stays cached", func() {
+				So(entries, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the cache stats are requested", func() {
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+			stats := proxy.CacheStats()
+
+			Convey("Then only the enabled cache is listed", func() {
+				So(stats, ShouldHaveLength, 1)
+				So(stats[0].Entries, ShouldEqual, 1)
+				So(stats[0].Hits, ShouldEqual, 1)
+				So(stats[0].Misses, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_NegativeCache(t *testing.T) {
+	Convey("Given a ldap proxy with negative caches and an empty backend", t, func() {
+		backend := &testBackend{}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.NegativeSearchCache, _ = cache.New("test_search", &cache.Config{})
+		config.NegativeBindCache, _ = bindcache.New("test_bind", &bindcache.Config{})
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When an empty search is repeated", func() {
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+			res, err := proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backend is only searched once", func() {
+				So(err, ShouldBeNil)
+				So(res.Results, ShouldBeEmpty)
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When an entry below the base of an empty search is invalidated", func() {
+			sess := ctx.(*session)
+			sess.context = setDn(sess.context, "cn=test")
+
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+			entries := proxy.InvalidateCache("cn=new,dc=example,dc=com")
+			proxy.Search(sess, &ldap.SearchRequest{BaseDN: "dc=example,dc=com", Scope: ldap.ScopeWholeSubtree})
+
+			Convey("Then the backend is searched again", func() {
+				So(entries, ShouldEqual, 1)
+				So(atomic.LoadInt32(&backend.calls), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a failed bind is repeated", func() {
+			proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=unknown", Password: []byte("secure")})
+			backend.lastUsername = ""
+			res, _ := proxy.Bind(ctx, &ldap.BindRequest{DN: "cn=unknown", Password: []byte("secure")})
+
+			Convey("Then the backend isn't asked again", func() {
+				So(res.Code, ShouldEqual, ldap.ResultInvalidCredentials)
+				So(backend.lastUsername, ShouldEqual, "")
+			})
+		})
+	})
+}
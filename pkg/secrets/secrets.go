@@ -0,0 +1,192 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	SchemeEnv   = "env"
+	SchemeFile  = "file"
+	SchemeVault = "vault"
+)
+
+var (
+	ErrUnknownScheme = errors.New("secrets: unknown scheme")
+	ErrNotFound      = errors.New("secrets: secret not found")
+)
+
+// A Resolver looks up the secret of a reference, e.g. the path of a secret in a
+// secret store.
+type Resolver interface {
+	Resolve(reference string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(reference string) (string, error)
+
+func (f ResolverFunc) Resolve(reference string) (string, error) {
+	return f(reference)
+}
+
+var (
+	resolversMutex sync.RWMutex
+	resolvers      = map[string]Resolver{
+		SchemeEnv:   ResolverFunc(resolveEnv),
+		SchemeFile:  ResolverFunc(resolveFile),
+		SchemeVault: &VaultResolver{},
+	}
+)
+
+// Register adds a resolver for the references `${scheme:reference}`, e.g. of
+// another secret store. It replaces a resolver of the same scheme.
+func Register(scheme string, resolver Resolver) {
+	resolversMutex.Lock()
+	defer resolversMutex.Unlock()
+
+	resolvers[scheme] = resolver
+}
+
+func resolver(scheme string) (Resolver, bool) {
+	resolversMutex.RLock()
+	defer resolversMutex.RUnlock()
+
+	resolver, ok := resolvers[scheme]
+	return resolver, ok
+}
+
+// Expand replaces the references `${scheme:reference}` in the value with their
+// secrets.
+func Expand(value string) (string, error) {
+	var expanded bytes.Buffer
+
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		scheme, reference := value[start+2:end], ""
+		if i := strings.Index(scheme, ":"); i >= 0 {
+			scheme, reference = scheme[:i], scheme[i+1:]
+		}
+
+		r, ok := resolver(scheme)
+		if !ok {
+			return "", fmt.Errorf("%v: %s", ErrUnknownScheme, scheme)
+		}
+		secret, err := r.Resolve(reference)
+		if err != nil {
+			return "", err
+		}
+
+		expanded.WriteString(value[:start])
+		expanded.WriteString(secret)
+		value = value[end+1:]
+	}
+	expanded.WriteString(value)
+
+	return expanded.String(), nil
+}
+
+// ExpandJSON replaces the references in all string values of the json
+// document, e.g. a configuration file.
+func ExpandJSON(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	document, err := expandValue(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(document)
+}
+
+func expandValue(value interface{}) (interface{}, error) {
+	var err error
+
+	switch v := value.(type) {
+	case string:
+		return Expand(v)
+	case []interface{}:
+		for i := range v {
+			if v[i], err = expandValue(v[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key := range v {
+			if v[key], err = expandValue(v[key]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// resolveEnv returns the environment variable. Like the images of docker, an
+// unset variable NAME is read from the file named by NAME_FILE.
+func resolveEnv(name string) (string, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+
+	if file, ok := os.LookupEnv(name + "_FILE"); ok {
+		return resolveFile(file)
+	}
+
+	return "", fmt.Errorf("%v: environment variable %s", ErrNotFound, name)
+}
+
+// resolveFile returns the content of the file without the trailing line break,
+// e.g. of a docker or kubernetes secret.
+func resolveFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secrets: reading '%s' failed: %v", path, err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// A VaultResolver reads secrets of the key value engine of HashiCorp Vault.
+// References are the path of the secret and the key, e.g.
+// `secret/data/ldap-proxy#password` of version 2 of the engine. The address
+// and token default to VAULT_ADDR and VAULT_TOKEN.
+type VaultResolver struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+func (resolver *VaultResolver) Resolve(reference string) (string, error) {
+	path, key := reference, "value"
+	if i := strings.LastIndex(reference, "#"); i >= 0 {
+		path, key = reference[:i], reference[i+1:]
+	}
+
+	address, token := resolver.Address, resolver.Token
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if address == "" {
+		return "", fmt.Errorf("secrets: no vault address for '%s'", reference)
+	}
+
+	client := resolver.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: reading '%s' from vault failed: %v", path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets: reading '%s' from vault failed: %s", path, res.Status)
+	}
+
+	// version 2 of the engine nests the data of version 1
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("secrets: decoding '%s' from vault failed: %v", path, err)
+	}
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("%v: key %s of '%s' in vault", ErrNotFound, key, path)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// fetchSessionAttributes looks up the configured session attributes of the
+// bound entry in the backend which authenticated it, so later operations of
+// the session don't need to look them up again.
+func (ldapProxy *LdapProxy) fetchSessionAttributes(ctx context.Context, backend Backend, dn string) map[string][]string {
+	names := ldapProxy.sessionAttributeNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	f := rdnFilter(dn)
+	if f == nil {
+		return nil
+	}
+
+	backendCtx, cancelBackend := ldapProxy.backendContext(ctx, backend, actionSearch)
+	defer cancelBackend()
+
+	users, err := backend.GetUsers(backendCtx, f)
+	if err != nil {
+		log.Printf("backend %s failed looking up the session attributes of %s: %v", backend.Name(), dn, err)
+		return nil
+	}
+
+	attributes := make(map[string][]string)
+	for _, user := range ldapProxy.addMemberOf(ctx, users) {
+		if !util.EqualDN(user.DN, dn) {
+			continue
+		}
+
+		for _, name := range names {
+			if values := filter.Values(user.Attributes, name); len(values) > 0 {
+				attributes[name] = values
+			}
+		}
+	}
+
+	return attributes
+}
+
+// sessionAttributeNames are the configured session attributes and the group
+// attributes of the access control, the redaction and the one-time passwords,
+// which are kept like a session attribute
+func (ldapProxy *LdapProxy) sessionAttributeNames() []string {
+	names := ldapProxy.config.SessionAttributes
+
+	groups := []string{ldapProxy.config.ACL.GroupAttribute(), ldapProxy.config.Redaction.GroupAttribute(), ldapProxy.config.TOTP.GroupAttribute()}
+	for _, group := range groups {
+		if group != "" && !containsFold(names, group) {
+			names = append(append([]string{}, names...), group)
+		}
+	}
+
+	return names
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rdnFilter matches the first rdn of the dn, e.g. `(uid=user1)` for
+// `uid=user1,ou=People,dc=example,dc=com`
+func rdnFilter(dn string) ldap.Filter {
+	rdn := dn
+	if i := strings.Index(dn, ","); i >= 0 {
+		rdn = dn[:i]
+	}
+
+	parts := strings.SplitN(rdn, "=", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	return &ldap.EqualityMatch{
+		Attribute: strings.TrimSpace(parts[0]),
+		Value:     []byte(strings.TrimSpace(parts[1])),
+	}
+}
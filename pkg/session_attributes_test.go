@@ -0,0 +1,59 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLdapProxy_SessionAttributes(t *testing.T) {
+	Convey("Given a ldap proxy fetching session attributes", t, func() {
+		backend := &testBackend{result: true, user: []*User{
+			{DN: "uid=user1,ou=People", Attributes: map[string][]string{"uid": {"user1"}, "Department": {"IT"}, "mail": {"user1@example.com"}}},
+		}}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+
+		config := DefaultProxyConfig()
+		config.SessionAttributes = []string{"department", "employeeType"}
+		proxy.Configure(config)
+
+		ctx, _ := proxy.Connect(nil)
+
+		Convey("When the session binds", func() {
+			proxy.Bind(ctx, &ldap.BindRequest{DN: "uid=user1,ou=People", Password: []byte("secure")})
+
+			Convey("Then the configured attributes are kept on the session", func() {
+				So(getAttributes(ctx.(*session).context), ShouldResemble, map[string][]string{"department": {"IT"}})
+			})
+		})
+	})
+
+	Convey("Given a dn", t, func() {
+		Convey("Then the filter matches its first rdn", func() {
+			So(rdnFilter("uid=user1,ou=People"), ShouldResemble, &ldap.EqualityMatch{Attribute: "uid", Value: []byte("user1")})
+			So(rdnFilter("invalid"), ShouldBeNil)
+		})
+	})
+}
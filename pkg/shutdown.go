@@ -0,0 +1,216 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+)
+
+// the message of the requests refused while shutting down
+const shuttingDown = "server is shutting down"
+
+// drainingBackend refuses the requests arriving during a shutdown and tracks
+// the ones in flight, so a shutdown can wait for them. It counts the
+// operations for cn=Monitor too.
+type drainingBackend struct {
+	ldap.Backend
+	proxy *LdapProxy
+}
+
+func (ldapProxy *LdapProxy) drained(backend ldap.Backend) ldap.Backend {
+	return &drainingBackend{
+		Backend: backend,
+		proxy:   ldapProxy,
+	}
+}
+
+// Shutdown drains the proxy: new connections and requests are refused with
+// unavailable, while the requests in flight may finish until the context is
+// done. The sessions are canceled and the backends implementing Close are
+// closed afterwards. The listeners are closed by their owner.
+func (ldapProxy *LdapProxy) Shutdown(ctx context.Context) error {
+	ldapProxy.mutex.Lock()
+	if ldapProxy.draining {
+		ldapProxy.mutex.Unlock()
+		return nil
+	}
+	ldapProxy.draining = true
+	connections := ldapProxy.connections
+	ldapProxy.mutex.Unlock()
+	defer close(ldapProxy.stopped)
+
+	log.Printf("Shutting down, draining %d connections", connections)
+	ldapProxy.server.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		ldapProxy.inFlight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		log.Printf("All requests finished")
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Printf("Canceling the requests in flight after the grace period")
+	}
+
+	ldapProxy.mutex.Lock()
+	for sess := range ldapProxy.sessions {
+		sess.cancle()
+	}
+	ldapProxy.mutex.Unlock()
+
+	for _, backend := range ldapProxy.current().ordered {
+		if closer, ok := backend.(closer); ok {
+			closer.Close()
+		}
+	}
+
+	return err
+}
+
+func (ldapProxy *LdapProxy) isDraining() bool {
+	ldapProxy.mutex.Lock()
+	defer ldapProxy.mutex.Unlock()
+
+	return ldapProxy.draining
+}
+
+// begin registers a request in flight. It returns false during a shutdown
+// and cancels the session, so its connection is closed with the next request.
+func (backend *drainingBackend) begin(ctx ldap.Context, operation string) bool {
+	proxy := backend.proxy
+	proxy.monitor.initiate(operation)
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	if proxy.draining {
+		if sess, ok := sessionOf(ctx); ok {
+			sess.cancle()
+		}
+		proxy.monitor.complete(operation)
+		return false
+	}
+
+	proxy.inFlight.Add(1)
+	return true
+}
+
+func (backend *drainingBackend) end(operation string) {
+	backend.proxy.inFlight.Done()
+	backend.proxy.monitor.complete(operation)
+}
+
+func unavailable() ldap.BaseResponse {
+	return ldap.BaseResponse{
+		Code:    ldap.ResultUnavailable,
+		Message: shuttingDown,
+	}
+}
+
+func (backend *drainingBackend) Add(ctx ldap.Context, req *ldap.AddRequest) (*ldap.AddResponse, error) {
+	if !backend.begin(ctx, operationAdd) {
+		return &ldap.AddResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationAdd)
+
+	return backend.Backend.Add(ctx, req)
+}
+
+func (backend *drainingBackend) Bind(ctx ldap.Context, req *ldap.BindRequest) (*ldap.BindResponse, error) {
+	if !backend.begin(ctx, operationBind) {
+		return &ldap.BindResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationBind)
+
+	return backend.Backend.Bind(ctx, req)
+}
+
+func (backend *drainingBackend) Delete(ctx ldap.Context, req *ldap.DeleteRequest) (*ldap.DeleteResponse, error) {
+	if !backend.begin(ctx, operationDelete) {
+		return &ldap.DeleteResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationDelete)
+
+	return backend.Backend.Delete(ctx, req)
+}
+
+func (backend *drainingBackend) ExtendedRequest(ctx ldap.Context, req *ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
+	if !backend.begin(ctx, operationExtended) {
+		return &ldap.ExtendedResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationExtended)
+
+	return backend.Backend.ExtendedRequest(ctx, req)
+}
+
+func (backend *drainingBackend) Modify(ctx ldap.Context, req *ldap.ModifyRequest) (*ldap.ModifyResponse, error) {
+	if !backend.begin(ctx, operationModify) {
+		return &ldap.ModifyResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationModify)
+
+	return backend.Backend.Modify(ctx, req)
+}
+
+func (backend *drainingBackend) ModifyDN(ctx ldap.Context, req *ldap.ModifyDNRequest) (*ldap.ModifyDNResponse, error) {
+	if !backend.begin(ctx, operationModrdn) {
+		return &ldap.ModifyDNResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationModrdn)
+
+	return backend.Backend.ModifyDN(ctx, req)
+}
+
+func (backend *drainingBackend) PasswordModify(ctx ldap.Context, req *ldap.PasswordModifyRequest) ([]byte, error) {
+	if !backend.begin(ctx, operationExtended) {
+		response := unavailable()
+		return nil, &response
+	}
+	defer backend.end(operationExtended)
+
+	return backend.Backend.PasswordModify(ctx, req)
+}
+
+func (backend *drainingBackend) Search(ctx ldap.Context, req *ldap.SearchRequest) (*ldap.SearchResponse, error) {
+	if !backend.begin(ctx, operationSearch) {
+		return &ldap.SearchResponse{BaseResponse: unavailable()}, nil
+	}
+	defer backend.end(operationSearch)
+
+	return backend.Backend.Search(ctx, req)
+}
+
+func (backend *drainingBackend) Whoami(ctx ldap.Context) (string, error) {
+	if !backend.begin(ctx, operationExtended) {
+		response := unavailable()
+		return "", &response
+	}
+	defer backend.end(operationExtended)
+
+	return backend.Backend.Whoami(ctx)
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLdapProxy_Shutdown(t *testing.T) {
+	Convey("Given a ldap proxy with a slow backend and a session", t, func() {
+		backend := &closableBackend{
+			testBackend: &testBackend{name: "a", delay: 100 * time.Millisecond, user: []*User{{DN: "cn=test"}}},
+			closed:      make(chan struct{}),
+		}
+
+		proxy := NewLdapProxy()
+		proxy.AddBackend(backend)
+		server := proxy.drained(proxy)
+
+		client := &net.TCPAddr{IP: net.ParseIP("10.0.0.12"), Port: 40000}
+		ctx, err := proxy.Connect(client)
+		So(err, ShouldBeNil)
+		ctx.(*session).context = setDn(ctx.(*session).context, "cn=test")
+
+		results := make(chan *ldap.SearchResponse)
+		go func() {
+			res, _ := server.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+			results <- res
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		Convey("When the proxy is shut down during a search", func() {
+			shutdown := make(chan error)
+			go func() {
+				grace, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				shutdown <- proxy.Shutdown(grace)
+			}()
+			time.Sleep(20 * time.Millisecond)
+
+			Convey("Then new requests and connections should be refused", func() {
+				res, err := server.Search(ctx, &ldap.SearchRequest{Scope: ldap.ScopeWholeSubtree})
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultUnavailable)
+				So(res.Message, ShouldEqual, shuttingDown)
+
+				_, err = proxy.Connect(client)
+				So(err, ShouldEqual, errConnectionRefused)
+
+				<-results
+				So(<-shutdown, ShouldBeNil)
+			})
+
+			Convey("Then the search in flight should finish before the backends are closed", func() {
+				res := <-results
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(res.Results, ShouldHaveLength, 1)
+
+				So(<-shutdown, ShouldBeNil)
+				So(proxy.isDraining(), ShouldBeTrue)
+				<-backend.closed
+			})
+		})
+
+		Convey("When the grace period ends before the search", func() {
+			grace, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := proxy.Shutdown(grace)
+
+			Convey("Then the sessions should be canceled", func() {
+				So(err, ShouldEqual, context.DeadlineExceeded)
+				So(ctx.(*session).context.Err(), ShouldNotBeNil)
+				<-results
+			})
+		})
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package static
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+	"sync"
+)
+
+const passwordAttribute = "userPassword"
+
+var ErrNoDN = errors.New("static: entry without dn")
+
+// Config defines the entries the proxy serves itself, e.g. the suffix entry
+// and the containers clients walking the tree from the base expect, or
+// service accounts binding with the hash in their userPassword.
+type Config struct {
+	pkg.Config
+
+	Entries []Entry `json:"entries"`
+}
+
+type Entry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+type backend struct {
+	config *Config
+
+	mutex   sync.RWMutex
+	entries []*pkg.User
+
+	// the password hashes by normalized dn
+	passwords map[string]string
+}
+
+var _ pkg.PasswordBackend = &backend{}
+
+func NewBackend(config *Config) (pkg.Backend, error) {
+	backend := &backend{
+		config:    config,
+		passwords: make(map[string]string),
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range config.Entries {
+		dn := util.NormalizeDN(entry.DN)
+		if dn == "" {
+			return nil, ErrNoDN
+		}
+		if seen[dn] {
+			return nil, fmt.Errorf("static: entry %s defined twice", entry.DN)
+		}
+		seen[dn] = true
+
+		user := &pkg.User{DN: entry.DN, Attributes: make(map[string][]string)}
+		for name, values := range entry.Attributes {
+			if strings.EqualFold(name, passwordAttribute) {
+				if len(values) > 0 {
+					backend.passwords[dn] = values[0]
+				}
+				continue
+			}
+			user.Attributes[name] = values
+		}
+		addRDN(user)
+
+		backend.entries = append(backend.entries, user)
+	}
+
+	return backend, nil
+}
+
+func (backend *backend) Name() (name string) {
+	return backend.config.Name
+}
+
+// Authenticate verifies the password of the entries with a userPassword, the
+// username is their dn.
+func (backend *backend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.mutex.RLock()
+	hash, ok := backend.passwords[util.NormalizeDN(username)]
+	backend.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+
+	return util.VerifyPasswordCtx(ctx, hash, password)
+}
+
+// SetPassword replaces the password of the entry until the proxy is
+// restarted.
+func (backend *backend) SetPassword(ctx context.Context, username string, password string) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	dn := util.NormalizeDN(username)
+	if _, ok := backend.passwords[dn]; !ok {
+		return pkg.ErrNoSuchEntry
+	}
+
+	backend.passwords[dn] = util.HashPassword(password, 12)
+	return nil
+}
+
+// GetUsers returns the entries matching the filter, without their passwords.
+func (backend *backend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users := []*pkg.User{}
+	for _, entry := range backend.entries {
+		if filter.Matches(entry.Attributes, f) {
+			users = append(users, entry)
+		}
+	}
+
+	return users, nil
+}
+
+// addRDN adds the values of the rdn to the attributes of the entry lacking
+// them, e.g. ou: people of ou=people,dc=example,dc=com
+func addRDN(user *pkg.User) {
+	for _, pair := range strings.Split(util.SplitDN(user.DN)[0], "+") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if name == "" || value == "" || containsFold(filter.Values(user.Attributes, name), value) {
+			continue
+		}
+
+		attribute := name
+		for existing := range user.Attributes {
+			if strings.EqualFold(existing, name) {
+				attribute = existing
+			}
+		}
+		user.Attributes[attribute] = append(append([]string{}, user.Attributes[attribute]...), value)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
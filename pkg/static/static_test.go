@@ -0,0 +1,109 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package static
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestBackend(t *testing.T) {
+	Convey("Given a backend with static entries", t, func() {
+		backend, err := NewBackend(&Config{
+			Config: pkg.Config{Name: "static"},
+			Entries: []Entry{
+				{DN: "dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"top", "domain"}}},
+				{DN: "ou=People,dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"top", "organizationalUnit"}}},
+				{DN: "cn=gitlab,ou=Apps,dc=example,dc=com", Attributes: map[string][]string{
+					"objectClass":  {"top", "applicationProcess", "simpleSecurityObject"},
+					"userPassword": {"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ="},
+				}},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("When the entries are searched", func() {
+			users, err := backend.GetUsers(context.Background(), &ldap.EqualityMatch{Attribute: "objectClass", Value: []byte("organizationalUnit")})
+			So(err, ShouldBeNil)
+
+			Convey("Then the matching entries are returned with their rdn", func() {
+				So(users, ShouldHaveLength, 1)
+				So(users[0].DN, ShouldEqual, "ou=People,dc=example,dc=com")
+				So(users[0].Attributes["ou"], ShouldResemble, []string{"People"})
+			})
+		})
+
+		Convey("When all entries are searched", func() {
+			users, err := backend.GetUsers(context.Background(), nil)
+			So(err, ShouldBeNil)
+
+			Convey("Then the passwords aren't returned", func() {
+				So(users, ShouldHaveLength, 3)
+				So(users[2].Attributes, ShouldNotContainKey, "userPassword")
+				So(users[0].Attributes["dc"], ShouldResemble, []string{"example"})
+			})
+		})
+
+		Convey("When a service account binds", func() {
+			Convey("Then the password is verified", func() {
+				So(backend.Authenticate(context.Background(), "CN=gitlab, OU=Apps, DC=example, DC=com", "secret"), ShouldBeTrue)
+				So(backend.Authenticate(context.Background(), "cn=gitlab,ou=Apps,dc=example,dc=com", "wrong"), ShouldBeFalse)
+				So(backend.Authenticate(context.Background(), "ou=People,dc=example,dc=com", ""), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the password of a service account is changed", func() {
+			err := backend.(pkg.PasswordBackend).SetPassword(context.Background(), "cn=gitlab,ou=Apps,dc=example,dc=com", "changed")
+
+			Convey("Then the old password is replaced", func() {
+				So(err, ShouldBeNil)
+				So(backend.Authenticate(context.Background(), "cn=gitlab,ou=Apps,dc=example,dc=com", "secret"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When the password of an entry without password is changed", func() {
+			err := backend.(pkg.PasswordBackend).SetPassword(context.Background(), "ou=People,dc=example,dc=com", "changed")
+
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+	})
+
+	Convey("Given an entry defined twice", t, func() {
+		_, err := NewBackend(&Config{Entries: []Entry{{DN: "ou=People,dc=example,dc=com"}, {DN: "OU=people, DC=example,DC=com"}}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an entry without dn", t, func() {
+		_, err := NewBackend(&Config{Entries: []Entry{{}}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldEqual, ErrNoDN)
+		})
+	})
+}
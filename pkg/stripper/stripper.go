@@ -38,12 +38,18 @@ type Config struct {
 }
 
 type strippingBackend struct {
+	pkg.Forwarder
+
 	delegateBackend pkg.Backend
 	config          *Config
 }
 
+var _ pkg.PasswordBackend = &strippingBackend{}
+var _ pkg.WriterBackend = &strippingBackend{}
+
 func NewBackend(delegateBackend pkg.Backend, config *Config) (backend pkg.Backend) {
 	return &strippingBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
 		delegateBackend: delegateBackend,
 		config:          config,
 	}
@@ -54,23 +60,47 @@ func (backend *strippingBackend) Name() (name string) {
 }
 
 func (backend *strippingBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	strippedUsername, ok := backend.strip(username)
+	if !ok {
+		return false
+	}
+
+	log.ForBackend(backend.Name()).Debugf("stripped user %s", strippedUsername)
+
+	return backend.delegateBackend.Authenticate(ctx, strippedUsername, password)
+}
+
+// SetPassword changes the password of the stripped user if the delegate
+// backend changes passwords.
+func (backend *strippingBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	strippedUsername, ok := backend.strip(username)
+	if !ok {
+		return pkg.ErrNoSuchEntry
+	}
+
+	return passwordBackend.SetPassword(ctx, strippedUsername, password)
+}
+
+// strip returns the user rdn value of the dn
+func (backend *strippingBackend) strip(username string) (string, bool) {
 	suffix := backend.config.suffix()
 
 	if !strings.HasSuffix(username, suffix) {
-		return false // wrong suffix, doesn't match the base dn and people rdn
+		return "", false // wrong suffix, doesn't match the base dn and people rdn
 	}
 
 	prefix := backend.config.prefix()
 
 	if !strings.HasPrefix(username, prefix) {
-		return false // wrong prefix, doesn't match the user rdn attribute
+		return "", false // wrong prefix, doesn't match the user rdn attribute
 	}
 
-	strippedUsername := strings.TrimPrefix(strings.TrimSuffix(username, suffix), prefix)
-
-	log.Debugf("stripped user %s", strippedUsername)
-
-	return backend.delegateBackend.Authenticate(ctx, strippedUsername, password)
+	return strings.TrimPrefix(strings.TrimSuffix(username, suffix), prefix), true
 }
 
 func (backend *strippingBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
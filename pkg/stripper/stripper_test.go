@@ -42,6 +42,13 @@ func (backend *testBackend) Authenticate(ctx context.Context, username string, p
 	return backend.result
 }
 
+func (backend *testBackend) SetPassword(ctx context.Context, username string, password string) error {
+	backend.lastUsername = username
+	backend.lastPassword = password
+
+	return nil
+}
+
 func (backend *testBackend) Name() (name string) {
 	return "test"
 }
@@ -128,3 +135,34 @@ func TestStrippingBackend_GetUsers(t *testing.T) {
 func toPointer(value string) *string {
 	return &value
 }
+
+func TestStrippingBackend_SetPassword(t *testing.T) {
+	Convey("Given a stripping ldap backend", t, func() {
+		backend := &testBackend{}
+		config := &Config{
+			BaseDn:           toPointer("dc=example,dc=com"),
+			PeopleRdn:        toPointer("ou=People"),
+			UserRdnAttribute: toPointer("uid"),
+		}
+
+		stripper := NewBackend(backend, config).(pkg.PasswordBackend)
+
+		Convey("When the password of a matching dn is changed", func() {
+			err := stripper.SetPassword(context.Background(), "uid=admin,ou=People,dc=example,dc=com", "secret")
+
+			Convey("Then the password of the stripped user is changed", func() {
+				So(err, ShouldBeNil)
+				So(backend.lastUsername, ShouldEqual, "admin")
+				So(backend.lastPassword, ShouldEqual, "secret")
+			})
+		})
+
+		Convey("When the password of another dn is changed", func() {
+			err := stripper.SetPassword(context.Background(), "uid=admin,ou=Staff,dc=example,dc=com", "secret")
+
+			Convey("Then the user is not found", func() {
+				So(err, ShouldEqual, pkg.ErrNoSuchEntry)
+			})
+		})
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package subschema
+
+import (
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"regexp"
+	"strings"
+)
+
+// The dn of the subschema subentry, listed as subschemaSubentry of the root
+// dse.
+const DN = "cn=Subschema"
+
+var (
+	oidPattern = regexp.MustCompile(`^\(\s*([0-9]+(\.[0-9]+)*)\s`)
+
+	// The definitions (RFC 4512, 4519, 2798 and 2307bis) of the attributes and
+	// object classes the proxy and most directories serve.
+	DefaultAttributeTypes = []string{
+		"( 2.5.4.0 NAME 'objectClass' EQUALITY objectIdentifierMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.38 )",
+		"( 2.5.4.41 NAME 'name' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{32768} )",
+		"( 2.5.4.49 NAME 'distinguishedName' EQUALITY distinguishedNameMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.12 )",
+		"( 2.5.4.3 NAME ( 'cn' 'commonName' ) SUP name )",
+		"( 2.5.4.4 NAME ( 'sn' 'surname' ) SUP name )",
+		"( 2.5.4.42 NAME ( 'givenName' 'gn' ) SUP name )",
+		"( 2.5.4.10 NAME ( 'o' 'organizationName' ) SUP name )",
+		"( 2.5.4.11 NAME ( 'ou' 'organizationalUnitName' ) SUP name )",
+		"( 2.5.4.13 NAME 'description' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{1024} )",
+		"( 2.5.4.20 NAME 'telephoneNumber' EQUALITY telephoneNumberMatch SUBSTR telephoneNumberSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.50{32} )",
+		"( 2.5.4.31 NAME 'member' SUP distinguishedName )",
+		"( 2.5.4.35 NAME 'userPassword' EQUALITY octetStringMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.40{128} )",
+		"( 0.9.2342.19200300.100.1.1 NAME ( 'uid' 'userid' ) EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{256} )",
+		"( 0.9.2342.19200300.100.1.3 NAME ( 'mail' 'rfc822Mailbox' ) EQUALITY caseIgnoreIA5Match SUBSTR caseIgnoreIA5SubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.26{256} )",
+		"( 0.9.2342.19200300.100.1.25 NAME ( 'dc' 'domainComponent' ) EQUALITY caseIgnoreIA5Match SUBSTR caseIgnoreIA5SubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.26 SINGLE-VALUE )",
+		"( 2.16.840.1.113730.3.1.241 NAME 'displayName' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 SINGLE-VALUE )",
+		"( 1.2.840.113556.1.2.102 NAME 'memberOf' EQUALITY distinguishedNameMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.12 NO-USER-MODIFICATION USAGE dSAOperation )",
+		"( 2.5.18.10 NAME 'subschemaSubentry' EQUALITY distinguishedNameMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.12 SINGLE-VALUE NO-USER-MODIFICATION USAGE directoryOperation )",
+		"( 2.5.21.5 NAME 'attributeTypes' EQUALITY objectIdentifierFirstComponentMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.3 USAGE directoryOperation )",
+		"( 2.5.21.6 NAME 'objectClasses' EQUALITY objectIdentifierFirstComponentMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.37 USAGE directoryOperation )",
+	}
+
+	DefaultObjectClasses = []string{
+		"( 2.5.6.0 NAME 'top' ABSTRACT MUST objectClass )",
+		"( 2.5.6.4 NAME 'organization' SUP top STRUCTURAL MUST o MAY description )",
+		"( 2.5.6.5 NAME 'organizationalUnit' SUP top STRUCTURAL MUST ou MAY description )",
+		"( 2.5.6.6 NAME 'person' SUP top STRUCTURAL MUST ( sn $ cn ) MAY ( userPassword $ telephoneNumber $ description ) )",
+		"( 2.5.6.7 NAME 'organizationalPerson' SUP person STRUCTURAL MAY ou )",
+		"( 2.16.840.1.113730.3.2.2 NAME 'inetOrgPerson' SUP organizationalPerson STRUCTURAL MAY ( displayName $ givenName $ mail $ uid ) )",
+		"( 2.5.6.9 NAME 'groupOfNames' SUP top STRUCTURAL MUST ( member $ cn ) MAY ( o $ ou $ description ) )",
+		"( 1.3.6.1.4.1.1466.344 NAME 'dcObject' SUP top AUXILIARY MUST dc )",
+		"( 2.5.20.1 NAME 'subschema' AUXILIARY MAY ( attributeTypes $ objectClasses ) )",
+	}
+)
+
+// Config extends the default schema. Definitions with the oid of a default
+// definition replace it.
+type Config struct {
+	AttributeTypes []string `json:"attributeTypes"`
+	ObjectClasses  []string `json:"objectClasses"`
+
+	// Only publish the configured definitions, e.g. the schema exported from
+	// the backend directories.
+	OmitDefaults bool `json:"omitDefaults"`
+}
+
+// A Schema is published as the subschema subentry of the proxy, schema aware
+// clients read it to learn the attributes and object classes.
+type Schema struct {
+	attributeTypes []string
+	objectClasses  []string
+}
+
+// Default returns the schema of the default definitions.
+func Default() *Schema {
+	schema, _ := New(&Config{})
+	return schema
+}
+
+func New(config *Config) (*Schema, error) {
+	var attributeTypes, objectClasses []string
+	if !config.OmitDefaults {
+		attributeTypes, objectClasses = DefaultAttributeTypes, DefaultObjectClasses
+	}
+
+	var err error
+	schema := &Schema{}
+	schema.attributeTypes, err = merge(attributeTypes, config.AttributeTypes)
+	if err != nil {
+		return nil, err
+	}
+	schema.objectClasses, err = merge(objectClasses, config.ObjectClasses)
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// Attributes returns the subschema subentry.
+func (schema *Schema) Attributes() map[string][]string {
+	return map[string][]string{
+		"objectClass":    {"top", "subschema"},
+		"cn":             {"Subschema"},
+		"attributeTypes": schema.attributeTypes,
+		"objectClasses":  schema.objectClasses,
+	}
+}
+
+// IsEntry reports whether the dn names the subschema subentry.
+func IsEntry(dn string) bool {
+	return util.EqualDN(dn, DN)
+}
+
+// merge appends the definitions to the defaults, a definition with the oid of
+// a default replaces it
+func merge(defaults []string, definitions []string) ([]string, error) {
+	merged := append([]string(nil), defaults...)
+	index := make(map[string]int)
+	for i, definition := range merged {
+		index[oid(definition)] = i
+	}
+
+	for _, definition := range definitions {
+		definition = strings.TrimSpace(definition)
+		id := oid(definition)
+		if id == "" || !strings.HasSuffix(definition, ")") {
+			return nil, fmt.Errorf("subschema: invalid definition '%s', expected ( oid NAME ... )", definition)
+		}
+
+		if i, ok := index[id]; ok {
+			merged[i] = definition
+			continue
+		}
+
+		index[id] = len(merged)
+		merged = append(merged, definition)
+	}
+
+	return merged, nil
+}
+
+func oid(definition string) string {
+	match := oidPattern.FindStringSubmatch(definition)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
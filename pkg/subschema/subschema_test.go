@@ -0,0 +1,87 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package subschema
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	Convey("Given a config replacing and adding definitions", t, func() {
+		config := &Config{
+			AttributeTypes: []string{
+				"( 2.5.4.13 NAME 'description' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )",
+				"( 1.3.6.1.4.1.99999.1 NAME 'badgeNumber' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 SINGLE-VALUE )",
+			},
+		}
+
+		Convey("When the schema is created", func() {
+			schema, err := New(config)
+			attributeTypes := schema.Attributes()["attributeTypes"]
+
+			Convey("Then the default with the same oid is replaced and the other one is added", func() {
+				So(err, ShouldBeNil)
+				So(attributeTypes, ShouldHaveLength, len(DefaultAttributeTypes)+1)
+				So(attributeTypes, ShouldContain, config.AttributeTypes[0])
+				So(attributeTypes[len(attributeTypes)-1], ShouldEqual, config.AttributeTypes[1])
+			})
+		})
+
+		Convey("When the defaults are omitted", func() {
+			config.OmitDefaults = true
+			schema, err := New(config)
+
+			Convey("Then only the configured definitions are published", func() {
+				So(err, ShouldBeNil)
+				So(schema.Attributes()["attributeTypes"], ShouldResemble, config.AttributeTypes)
+				So(schema.Attributes()["objectClasses"], ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a definition has no oid", func() {
+			config.ObjectClasses = []string{"( NAME 'badge' )"}
+			_, err := New(config)
+
+			Convey("Then it is rejected", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestIsEntry(t *testing.T) {
+	Convey("Given the dn of the subschema subentry in another case", t, func() {
+		dn := "CN=subschema"
+
+		Convey("Then it names the subentry", func() {
+			So(IsEntry(dn), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a dn below an entry named like the subentry", t, func() {
+		dn := "cn=Subschema,dc=example,dc=com"
+
+		Convey("Then it doesn't name the subentry", func() {
+			So(IsEntry(dn), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,249 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package suffix
+
+import (
+	"context"
+	"errors"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+var (
+	ErrInvalidRule = errors.New("suffix: a rewrite rule needs a client and a backend suffix")
+
+	// The attributes whose values are dns in the common schemas
+	DefaultDNAttributes = []string{"member", "uniqueMember", "memberOf", "manager", "owner", "secretary", "seeAlso", "roleOccupant", "distinguishedName"}
+)
+
+// A Rule maps the suffix the clients see to the suffix of the backend.
+type Rule struct {
+	Client  string `json:"client"`
+	Backend string `json:"backend"`
+}
+
+// Config rewrites the suffixes of the dns passed to and returned by the
+// backend: the bind dns, the dns of the entries and the values of the dn
+// attributes, also if they are asserted by a filter.
+type Config struct {
+	pkg.Config
+
+	SuffixRewrite []*Rule  `json:"suffixRewrite"`
+	DNAttributes  []string `json:"dnAttributes"`
+}
+
+type suffixBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+
+	rules        []*Rule
+	dnAttributes []string
+}
+
+var _ pkg.PasswordBackend = &suffixBackend{}
+var _ pkg.WriterBackend = &suffixBackend{}
+
+func NewBackend(delegateBackend pkg.Backend, config *Config) (pkg.Backend, error) {
+	for _, rule := range config.SuffixRewrite {
+		if rule.Client == "" || rule.Backend == "" {
+			return nil, ErrInvalidRule
+		}
+	}
+
+	backend := &suffixBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		rules:           config.SuffixRewrite,
+		dnAttributes:    config.DNAttributes,
+	}
+	if len(backend.dnAttributes) == 0 {
+		backend.dnAttributes = DefaultDNAttributes
+	}
+
+	return backend, nil
+}
+
+func (backend *suffixBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+func (backend *suffixBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.delegateBackend.Authenticate(ctx, backend.toBackend(username), password)
+}
+
+// SetPassword changes the password of the rewritten user if the delegate
+// backend changes passwords.
+func (backend *suffixBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, backend.toBackend(username), password)
+}
+
+func (backend *suffixBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	users, err := backend.delegateBackend.GetUsers(ctx, backend.rewriteFilter(f))
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten := make([]*pkg.User, len(users))
+	for i, user := range users {
+		rewritten[i] = backend.rewriteUser(user, backend.toClient)
+	}
+
+	return rewritten, nil
+}
+
+// rewriteFilter maps the dns asserted on dn attributes to the backend
+func (backend *suffixBackend) rewriteFilter(f ldap.Filter) ldap.Filter {
+	return filter.Rewrite(f, func(assertion ldap.Filter) ldap.Filter {
+		switch assertion := assertion.(type) {
+		case *ldap.EqualityMatch:
+			if backend.isDNAttribute(assertion.Attribute) {
+				return &ldap.EqualityMatch{Attribute: assertion.Attribute, Value: []byte(backend.toBackend(string(assertion.Value)))}
+			}
+		case *ldap.ExtensibleMatch:
+			if backend.isDNAttribute(assertion.Attribute) {
+				rewritten := *assertion
+				rewritten.Value = []byte(backend.toBackend(string(assertion.Value)))
+				return &rewritten
+			}
+		}
+		return assertion
+	})
+}
+
+// Add writes the entry with the dn and the values of the dn attributes
+// mapped to the backend.
+func (backend *suffixBackend) Add(ctx context.Context, entry *pkg.User) error {
+	return backend.Forwarder.Add(ctx, backend.rewriteUser(entry, backend.toBackend))
+}
+
+// Modify writes the modifications of the dn mapped to the backend, like the
+// values of the dn attributes.
+func (backend *suffixBackend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	rewritten := make([]*ldap.Mod, len(mods))
+	for i, mod := range mods {
+		rewritten[i] = mod
+		if !backend.isDNAttribute(mod.Name) {
+			continue
+		}
+
+		values := make([][]byte, len(mod.Values))
+		for j, value := range mod.Values {
+			values[j] = []byte(backend.toBackend(string(value)))
+		}
+		rewritten[i] = &ldap.Mod{Type: mod.Type, Name: mod.Name, Values: values}
+	}
+
+	return backend.Forwarder.Modify(ctx, backend.toBackend(dn), rewritten)
+}
+
+func (backend *suffixBackend) Delete(ctx context.Context, dn string) error {
+	return backend.Forwarder.Delete(ctx, backend.toBackend(dn))
+}
+
+// ModifyDN renames the entry mapped to the backend, a new superior is mapped
+// as well.
+func (backend *suffixBackend) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	if newSuperior != "" {
+		newSuperior = backend.toBackend(newSuperior)
+	}
+
+	return backend.Forwarder.ModifyDN(ctx, backend.toBackend(dn), newRDN, deleteOldRDN, newSuperior)
+}
+
+// rewriteUser returns a copy of the entry with the dn and the values of the
+// dn attributes mapped in the direction, to the clients or to the backend
+func (backend *suffixBackend) rewriteUser(user *pkg.User, direction func(dn string) string) *pkg.User {
+	rewritten := &pkg.User{
+		DN:         direction(user.DN),
+		Attributes: make(map[string][]string, len(user.Attributes)),
+	}
+
+	for name, values := range user.Attributes {
+		if !backend.isDNAttribute(name) {
+			rewritten.Attributes[name] = values
+			continue
+		}
+
+		dns := make([]string, len(values))
+		for i, value := range values {
+			dns[i] = direction(value)
+		}
+		rewritten.Attributes[name] = dns
+	}
+
+	return rewritten
+}
+
+func (backend *suffixBackend) toBackend(dn string) string {
+	return backend.rewrite(dn, func(rule *Rule) (string, string) { return rule.Client, rule.Backend })
+}
+
+func (backend *suffixBackend) toClient(dn string) string {
+	return backend.rewrite(dn, func(rule *Rule) (string, string) { return rule.Backend, rule.Client })
+}
+
+// rewrite replaces the longest matching suffix of the dn, dns without
+// matching suffix are returned unchanged
+func (backend *suffixBackend) rewrite(dn string, direction func(rule *Rule) (from string, to string)) string {
+	var replacement string
+	longest := -1
+
+	for _, rule := range backend.rules {
+		from, to := direction(rule)
+		if hasSuffix(dn, from) && len(from) > longest {
+			replacement, longest = to, len(from)
+		}
+	}
+
+	if longest < 0 {
+		return dn
+	}
+
+	return dn[:len(dn)-longest] + replacement
+}
+
+func (backend *suffixBackend) isDNAttribute(attribute string) bool {
+	for _, name := range backend.dnAttributes {
+		if strings.EqualFold(name, attribute) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSuffix reports whether the dn is the suffix or below it, compared case
+// insensitive
+func hasSuffix(dn string, suffix string) bool {
+	if len(dn) < len(suffix) || !strings.EqualFold(dn[len(dn)-len(suffix):], suffix) {
+		return false
+	}
+
+	return len(dn) == len(suffix) || dn[len(dn)-len(suffix)-1] == ','
+}
@@ -0,0 +1,207 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package suffix
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/filter"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testBackend struct {
+	lastUsername string
+	lastFilter   ldap.Filter
+
+	users []*pkg.User
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	backend.lastUsername = username
+
+	return true
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	backend.lastFilter = f
+
+	return backend.users, nil
+}
+
+type testWriter struct {
+	testBackend
+
+	lastDN       string
+	lastEntry    *pkg.User
+	lastMods     []*ldap.Mod
+	lastNewRDN   string
+	lastSuperior string
+}
+
+func (backend *testWriter) Add(ctx context.Context, entry *pkg.User) error {
+	backend.lastEntry = entry
+	return nil
+}
+
+func (backend *testWriter) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	backend.lastDN, backend.lastMods = dn, mods
+	return nil
+}
+
+func (backend *testWriter) Delete(ctx context.Context, dn string) error {
+	backend.lastDN = dn
+	return nil
+}
+
+func (backend *testWriter) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	backend.lastDN, backend.lastNewRDN, backend.lastSuperior = dn, newRDN, newSuperior
+	return nil
+}
+
+func TestSuffixBackend(t *testing.T) {
+	Convey("Given a backend rewriting the suffix", t, func() {
+		delegate := &testBackend{users: []*pkg.User{
+			{DN: "cn=admins,ou=Groups,dc=corp,dc=ad,dc=example", Attributes: map[string][]string{
+				"cn":     {"admins"},
+				"member": {"uid=jdoe,ou=People,DC=Corp,DC=AD,DC=Example", "uid=partner,dc=partner,dc=com"},
+			}},
+		}}
+		backend, err := NewBackend(delegate, &Config{SuffixRewrite: []*Rule{
+			{Client: "dc=company,dc=internal", Backend: "dc=corp,dc=ad,dc=example"},
+			{Client: "ou=Legacy,dc=company,dc=internal", Backend: "dc=legacy,dc=example"},
+		}})
+		So(err, ShouldBeNil)
+
+		Convey("When a user binds", func() {
+			backend.Authenticate(context.Background(), "uid=jdoe,ou=People,dc=company,dc=internal", "secret")
+
+			Convey("Then the dn of the backend is authenticated", func() {
+				So(delegate.lastUsername, ShouldEqual, "uid=jdoe,ou=People,dc=corp,dc=ad,dc=example")
+			})
+		})
+
+		Convey("When a user of the longer suffix binds", func() {
+			backend.Authenticate(context.Background(), "uid=old,ou=Legacy,dc=company,dc=internal", "secret")
+
+			Convey("Then the longer suffix is rewritten", func() {
+				So(delegate.lastUsername, ShouldEqual, "uid=old,dc=legacy,dc=example")
+			})
+		})
+
+		Convey("When a dn only ends with the suffix text", func() {
+			backend.Authenticate(context.Background(), "uid=jdoe,xdc=company,dc=internal", "secret")
+
+			Convey("Then it isn't rewritten", func() {
+				So(delegate.lastUsername, ShouldEqual, "uid=jdoe,xdc=company,dc=internal")
+			})
+		})
+
+		Convey("When the members of a group are searched", func() {
+			f, err := filter.Parse("(&(cn=admins)(member=uid=jdoe,ou=People,dc=company,dc=internal))")
+			So(err, ShouldBeNil)
+			users, err := backend.GetUsers(context.Background(), f)
+
+			Convey("Then the filter and the entries are rewritten", func() {
+				So(err, ShouldBeNil)
+				So(filter.String(delegate.lastFilter), ShouldEqual, "(&(cn=admins)(member=uid=jdoe,ou=People,dc=corp,dc=ad,dc=example))")
+				So(users, ShouldHaveLength, 1)
+				So(users[0].DN, ShouldEqual, "cn=admins,ou=Groups,dc=company,dc=internal")
+				So(users[0].Attributes["member"], ShouldResemble, []string{"uid=jdoe,ou=People,dc=company,dc=internal", "uid=partner,dc=partner,dc=com"})
+				So(users[0].Attributes["cn"], ShouldResemble, []string{"admins"})
+			})
+
+			Convey("Then the entries of the delegate are unchanged", func() {
+				So(delegate.users[0].DN, ShouldEqual, "cn=admins,ou=Groups,dc=corp,dc=ad,dc=example")
+			})
+		})
+	})
+
+	Convey("Given a writer backend rewriting the suffix", t, func() {
+		delegate := &testWriter{}
+		backend, _ := NewBackend(delegate, &Config{SuffixRewrite: []*Rule{
+			{Client: "dc=company,dc=internal", Backend: "dc=corp,dc=ad,dc=example"},
+		}})
+		writer := backend.(pkg.WriterBackend)
+
+		Convey("When an entry is added", func() {
+			err := writer.Add(context.Background(), &pkg.User{DN: "cn=admins,dc=company,dc=internal", Attributes: map[string][]string{
+				"member": {"uid=jdoe,dc=company,dc=internal"},
+			}})
+
+			Convey("Then the dn and the dn attributes of the backend are written", func() {
+				So(err, ShouldBeNil)
+				So(delegate.lastEntry.DN, ShouldEqual, "cn=admins,dc=corp,dc=ad,dc=example")
+				So(delegate.lastEntry.Attributes["member"], ShouldResemble, []string{"uid=jdoe,dc=corp,dc=ad,dc=example"})
+			})
+		})
+
+		Convey("When an entry is modified", func() {
+			writer.Modify(context.Background(), "cn=admins,dc=company,dc=internal", []*ldap.Mod{
+				{Type: ldap.ModAdd, Name: "member", Values: [][]byte{[]byte("uid=jdoe,dc=company,dc=internal")}},
+				{Type: ldap.ModReplace, Name: "description", Values: [][]byte{[]byte("dc=company,dc=internal")}},
+			})
+
+			Convey("Then the dn and the values of the dn attributes are rewritten", func() {
+				So(delegate.lastDN, ShouldEqual, "cn=admins,dc=corp,dc=ad,dc=example")
+				So(string(delegate.lastMods[0].Values[0]), ShouldEqual, "uid=jdoe,dc=corp,dc=ad,dc=example")
+				So(string(delegate.lastMods[1].Values[0]), ShouldEqual, "dc=company,dc=internal")
+			})
+		})
+
+		Convey("When an entry is moved", func() {
+			writer.ModifyDN(context.Background(), "uid=jdoe,ou=People,dc=company,dc=internal", "uid=john", true, "ou=Staff,dc=company,dc=internal")
+
+			Convey("Then the dn and the new superior are rewritten", func() {
+				So(delegate.lastDN, ShouldEqual, "uid=jdoe,ou=People,dc=corp,dc=ad,dc=example")
+				So(delegate.lastNewRDN, ShouldEqual, "uid=john")
+				So(delegate.lastSuperior, ShouldEqual, "ou=Staff,dc=corp,dc=ad,dc=example")
+			})
+		})
+	})
+
+	Convey("Given a backend without writes rewriting the suffix", t, func() {
+		backend, _ := NewBackend(&testBackend{}, &Config{SuffixRewrite: []*Rule{
+			{Client: "dc=company,dc=internal", Backend: "dc=corp,dc=ad,dc=example"},
+		}})
+
+		Convey("When an entry is deleted", func() {
+			err := backend.(pkg.WriterBackend).Delete(context.Background(), "uid=jdoe,dc=company,dc=internal")
+
+			Convey("Then the write is refused", func() {
+				So(err, ShouldEqual, pkg.ErrUnwillingToPerform)
+			})
+		})
+	})
+
+	Convey("Given a rule without backend suffix", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{SuffixRewrite: []*Rule{{Client: "dc=company,dc=internal"}}})
+
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldEqual, ErrInvalidRule)
+		})
+	})
+}
@@ -0,0 +1,252 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidSeed = errors.New("totp: invalid seed")
+)
+
+// Config enables the one-time passwords of RFC 6238. Users with a seed must
+// bind with their password followed by the current code, e.g. `secret123456`.
+type Config struct {
+	// The base32 seeds of the authenticator apps by bind dn
+	Seeds map[string]string `json:"seeds"`
+
+	// The path of a json file with further seeds by bind dn
+	SeedsFile string `json:"seedsFile"`
+
+	// The dns of groups whose members must have a seed, their binds without
+	// seed are refused
+	Groups []string `json:"groups"`
+
+	// The attribute of the bound entry listing its groups, memberOf by default
+	GroupAttribute string `json:"groupAttribute"`
+
+	// The number of digits (default 6), the period of a code (default 30s) and
+	// the number of periods a code is accepted early or late (default 1)
+	Digits int    `json:"digits"`
+	Period string `json:"period"`
+	Skew   *int   `json:"skew"`
+}
+
+// A Verifier checks the one-time passwords appended to the bind passwords.
+// Every code is accepted once per user. All methods may be called on a nil
+// verifier, which leaves the passwords unchanged.
+type Verifier struct {
+	seeds          map[string][]byte
+	groups         map[string]bool
+	groupAttribute string
+
+	digits int
+	period time.Duration
+	skew   int
+
+	now func() time.Time
+
+	mutex sync.Mutex
+	// the counter of the last accepted code by dn against replays
+	used map[string]int64
+}
+
+func New(config *Config) (*Verifier, error) {
+	verifier := &Verifier{
+		seeds:          make(map[string][]byte),
+		groups:         make(map[string]bool),
+		groupAttribute: config.GroupAttribute,
+		digits:         config.Digits,
+		period:         30 * time.Second,
+		skew:           1,
+		now:            time.Now,
+		used:           make(map[string]int64),
+	}
+
+	if verifier.digits <= 0 {
+		verifier.digits = 6
+	}
+	if config.Skew != nil && *config.Skew >= 0 {
+		verifier.skew = *config.Skew
+	}
+	if config.Period != "" {
+		period, err := time.ParseDuration(config.Period)
+		if err != nil {
+			return nil, err
+		}
+		if period < time.Second {
+			return nil, fmt.Errorf("totp: the period %s is shorter than a second", period)
+		}
+		verifier.period = period
+	}
+
+	seeds := make(map[string]string)
+	if config.SeedsFile != "" {
+		content, err := ioutil.ReadFile(config.SeedsFile)
+		if err != nil {
+			return nil, fmt.Errorf("totp: reading '%s' failed: %v", config.SeedsFile, err)
+		}
+		if err := json.Unmarshal(content, &seeds); err != nil {
+			return nil, fmt.Errorf("totp: decoding '%s' failed: %v", config.SeedsFile, err)
+		}
+	}
+	for dn, seed := range config.Seeds {
+		seeds[dn] = seed
+	}
+
+	for dn, seed := range seeds {
+		decoded, err := decodeSeed(seed)
+		if err != nil {
+			return nil, fmt.Errorf("%v: of %s", ErrInvalidSeed, dn)
+		}
+		verifier.seeds[util.NormalizeDN(dn)] = decoded
+	}
+
+	for _, group := range config.Groups {
+		verifier.groups[util.NormalizeDN(group)] = true
+	}
+	if verifier.groupAttribute == "" && len(verifier.groups) > 0 {
+		verifier.groupAttribute = "memberOf"
+	}
+
+	return verifier, nil
+}
+
+// decodeSeed decodes the base32 seed of authenticator apps, which is often
+// shown in lower case, in groups or without padding
+func decodeSeed(seed string) ([]byte, error) {
+	seed = strings.ToUpper(strings.Replace(strings.TrimSpace(seed), " ", "", -1))
+	seed = strings.TrimRight(seed, "=")
+
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+	if err != nil || len(decoded) == 0 {
+		return nil, ErrInvalidSeed
+	}
+
+	return decoded, nil
+}
+
+// GroupAttribute is the attribute of the bound entry listing its groups, empty
+// if no group requires a seed.
+func (verifier *Verifier) GroupAttribute() string {
+	if verifier == nil {
+		return ""
+	}
+
+	return verifier.groupAttribute
+}
+
+// Enrolled reports whether the dn has a seed.
+func (verifier *Verifier) Enrolled(dn string) bool {
+	if verifier == nil {
+		return false
+	}
+
+	_, ok := verifier.seeds[util.NormalizeDN(dn)]
+	return ok
+}
+
+// Required reports whether one of the groups requires a seed.
+func (verifier *Verifier) Required(groups []string) bool {
+	if verifier == nil {
+		return false
+	}
+
+	for _, group := range groups {
+		if verifier.groups[util.NormalizeDN(group)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify splits the code off the password of an enrolled dn and checks it.
+// It returns the password without code, passwords of dns without seed are
+// returned unchanged.
+func (verifier *Verifier) Verify(dn string, password string) (string, bool) {
+	if verifier == nil {
+		return password, true
+	}
+
+	seed, ok := verifier.seeds[util.NormalizeDN(dn)]
+	if !ok {
+		return password, true
+	}
+
+	if len(password) <= verifier.digits {
+		return "", false
+	}
+	plain, code := password[:len(password)-verifier.digits], password[len(password)-verifier.digits:]
+
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+
+	current := verifier.now().Unix() / int64(verifier.period/time.Second)
+	for counter := current - int64(verifier.skew); counter <= current+int64(verifier.skew); counter++ {
+		if subtle.ConstantTimeCompare([]byte(Code(seed, counter, verifier.digits)), []byte(code)) != 1 {
+			continue
+		}
+
+		// a code seen on the wire mustn't be replayed
+		if last, ok := verifier.used[util.NormalizeDN(dn)]; ok && counter <= last {
+			return "", false
+		}
+		verifier.used[util.NormalizeDN(dn)] = counter
+
+		return plain, true
+	}
+
+	return "", false
+}
+
+// Code computes the one-time password of the seed for the counter (RFC 4226).
+func Code(seed []byte, counter int64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, seed)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
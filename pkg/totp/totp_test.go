@@ -0,0 +1,149 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package totp
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	Convey("Given the seed of the test vectors of RFC 6238", t, func() {
+		seed := []byte("12345678901234567890")
+
+		Convey("Then the codes match the vectors", func() {
+			So(Code(seed, 59/30, 8), ShouldEqual, "94287082")
+			So(Code(seed, 1111111109/30, 8), ShouldEqual, "07081804")
+			So(Code(seed, 1234567890/30, 8), ShouldEqual, "89005924")
+			So(Code(seed, 59/30, 6), ShouldEqual, "287082")
+		})
+	})
+}
+
+func TestVerifier(t *testing.T) {
+	Convey("Given a verifier with the seed of a user", t, func() {
+		// base32 of 12345678901234567890
+		verifier, err := New(&Config{
+			Seeds:  map[string]string{"uid=jdoe,ou=People,dc=example,dc=com": "gezdgnbvgy3tqojqgezdgnbvgy3tqojq"},
+			Groups: []string{"cn=vpn,ou=Groups,dc=example,dc=com"},
+		})
+		So(err, ShouldBeNil)
+
+		now := time.Unix(59, 0)
+		verifier.now = func() time.Time { return now }
+
+		Convey("When the password ends with the current code", func() {
+			password, ok := verifier.Verify("UID=jdoe, ou=People, dc=example, dc=com", "secret287082")
+
+			Convey("Then the password without code is returned", func() {
+				So(ok, ShouldBeTrue)
+				So(password, ShouldEqual, "secret")
+			})
+
+			Convey("Then the code can't be replayed", func() {
+				_, ok := verifier.Verify("uid=jdoe,ou=People,dc=example,dc=com", "secret287082")
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the code is of the previous period", func() {
+			now = now.Add(30 * time.Second)
+			password, ok := verifier.Verify("uid=jdoe,ou=People,dc=example,dc=com", "secret287082")
+
+			Convey("Then it is accepted within the skew", func() {
+				So(ok, ShouldBeTrue)
+				So(password, ShouldEqual, "secret")
+			})
+		})
+
+		Convey("When the code is too old", func() {
+			now = now.Add(90 * time.Second)
+			_, ok := verifier.Verify("uid=jdoe,ou=People,dc=example,dc=com", "secret287082")
+
+			Convey("Then it is refused", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the code is missing", func() {
+			_, ok := verifier.Verify("uid=jdoe,ou=People,dc=example,dc=com", "secret")
+
+			Convey("Then the bind is refused", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a user without seed binds", func() {
+			password, ok := verifier.Verify("uid=other,ou=People,dc=example,dc=com", "secret")
+
+			Convey("Then the password is returned unchanged", func() {
+				So(ok, ShouldBeTrue)
+				So(password, ShouldEqual, "secret")
+				So(verifier.Enrolled("uid=other,ou=People,dc=example,dc=com"), ShouldBeFalse)
+			})
+		})
+
+		Convey("Then the members of the groups require a seed", func() {
+			So(verifier.Required([]string{"CN=vpn,OU=Groups,DC=example,DC=com"}), ShouldBeTrue)
+			So(verifier.Required([]string{"cn=staff,ou=Groups,dc=example,dc=com"}), ShouldBeFalse)
+			So(verifier.GroupAttribute(), ShouldEqual, "memberOf")
+		})
+	})
+
+	Convey("Given seeds in a file", t, func() {
+		dir, err := ioutil.TempDir("", "totp")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "seeds.json")
+		So(ioutil.WriteFile(file, []byte(`{"uid=jdoe,dc=example,dc=com": "GEZD GNBV GY3T QOJQ"}`), 0600), ShouldBeNil)
+
+		verifier, err := New(&Config{SeedsFile: file})
+
+		Convey("Then the users are enrolled", func() {
+			So(err, ShouldBeNil)
+			So(verifier.Enrolled("uid=jdoe,dc=example,dc=com"), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an invalid seed", t, func() {
+		_, err := New(&Config{Seeds: map[string]string{"uid=jdoe": "not base32!"}})
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a nil verifier", t, func() {
+		var verifier *Verifier
+
+		Convey("Then passwords are returned unchanged", func() {
+			password, ok := verifier.Verify("uid=jdoe", "secret")
+			So(ok, ShouldBeTrue)
+			So(password, ShouldEqual, "secret")
+			So(verifier.Required([]string{"cn=vpn"}), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeDN returns the dn in the form used to compare dns: the attribute
+// names and values are lower cased, the spaces around the rdns, their
+// attribute value pairs and the equal signs are dropped and the pairs of
+// multi-valued rdns are sorted, so "CN=Foo, DC=Example" and
+// "cn=foo,dc=example" are equal. Escaped characters are kept as they are.
+func NormalizeDN(dn string) string {
+	if strings.TrimSpace(dn) == "" {
+		return ""
+	}
+
+	rdns := SplitDN(dn)
+	for i, rdn := range rdns {
+		pairs := split(rdn, '+')
+		for j, pair := range pairs {
+			pairs[j] = normalizePair(pair)
+		}
+		sort.Strings(pairs)
+
+		rdns[i] = strings.Join(pairs, "+")
+	}
+
+	return strings.Join(rdns, ",")
+}
+
+// EqualDN reports whether the dns are equal once normalized.
+func EqualDN(a string, b string) bool {
+	return NormalizeDN(a) == NormalizeDN(b)
+}
+
+// IsBelowDN reports whether the dn equals the base or is below it.
+func IsBelowDN(dn string, base string) bool {
+	dn, base = NormalizeDN(dn), NormalizeDN(base)
+	return dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+// ParentDN returns the normalized dn without its first rdn.
+func ParentDN(dn string) string {
+	rdns := SplitDN(NormalizeDN(dn))
+	return strings.Join(rdns[1:], ",")
+}
+
+// SplitDN splits the dn into its rdns at the unescaped commas.
+func SplitDN(dn string) []string {
+	return split(dn, ',')
+}
+
+// split splits the value at the unescaped separators
+func split(value string, separator byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case separator:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+func normalizePair(pair string) string {
+	parts := strings.SplitN(pair, "=", 2)
+	if len(parts) != 2 {
+		return strings.ToLower(trimSpace(pair))
+	}
+
+	return strings.ToLower(strings.TrimSpace(parts[0])) + "=" + strings.ToLower(trimSpace(parts[1]))
+}
+
+// trimSpace drops the leading and the unescaped trailing spaces
+func trimSpace(value string) string {
+	value = strings.TrimLeft(value, " ")
+	for strings.HasSuffix(value, " ") && !escaped(value, len(value)-1) {
+		value = value[:len(value)-1]
+	}
+
+	return value
+}
+
+// escaped reports whether the character at the index is escaped by an odd
+// number of backslashes
+func escaped(value string, index int) bool {
+	backslashes := 0
+	for i := index - 1; i >= 0 && value[i] == '\\'; i-- {
+		backslashes++
+	}
+
+	return backslashes%2 == 1
+}
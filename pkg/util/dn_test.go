@@ -0,0 +1,76 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNormalizeDN(t *testing.T) {
+	Convey("Given dns differing in case and spacing", t, func() {
+		Convey("Then they are normalized to the same dn", func() {
+			So(NormalizeDN("CN=Foo, DC=Example"), ShouldEqual, "cn=foo,dc=example")
+			So(NormalizeDN(" cn = Foo ,dc= example "), ShouldEqual, "cn=foo,dc=example")
+			So(EqualDN("CN=Foo, DC=Example", "cn=foo,dc=example"), ShouldBeTrue)
+		})
+
+		Convey("Then the spaces within values are kept", func() {
+			So(NormalizeDN("CN=John  Doe,DC=Example"), ShouldEqual, "cn=john  doe,dc=example")
+		})
+	})
+
+	Convey("Given dns with escaped characters", t, func() {
+		Convey("Then escaped separators and spaces are kept", func() {
+			So(NormalizeDN(`CN=Doe\, John ,DC=Example`), ShouldEqual, `cn=doe\, john,dc=example`)
+			So(NormalizeDN(`cn=trailing\ ,dc=example`), ShouldEqual, `cn=trailing\ ,dc=example`)
+			So(SplitDN(`cn=Doe\, John,dc=example`), ShouldResemble, []string{`cn=Doe\, John`, "dc=example"})
+		})
+	})
+
+	Convey("Given a multi-valued rdn", t, func() {
+		Convey("Then its pairs are sorted", func() {
+			So(NormalizeDN("UID=jdoe + CN=John,dc=example"), ShouldEqual, "cn=john+uid=jdoe,dc=example")
+			So(EqualDN("cn=john+uid=jdoe,dc=example", "uid=jdoe+cn=john,dc=example"), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an empty dn", t, func() {
+		So(NormalizeDN("  "), ShouldEqual, "")
+	})
+}
+
+func TestIsBelowDN(t *testing.T) {
+	Convey("Given a base", t, func() {
+		base := "OU=People, DC=Example"
+
+		Convey("Then the base and the dns below are below the base", func() {
+			So(IsBelowDN("ou=people,dc=example", base), ShouldBeTrue)
+			So(IsBelowDN("cn=Foo, ou=People,dc=example", base), ShouldBeTrue)
+			So(ParentDN("CN=Foo, OU=People,dc=example"), ShouldEqual, "ou=people,dc=example")
+		})
+
+		Convey("Then other dns aren't below the base", func() {
+			So(IsBelowDN("cn=Foo,ou=OtherPeople,dc=example", base), ShouldBeFalse)
+			So(IsBelowDN("dc=example", base), ShouldBeFalse)
+		})
+	})
+}
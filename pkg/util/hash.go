@@ -0,0 +1,321 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Hasher verifies the passwords hashed with one scheme.
+type Hasher interface {
+	// Handles reports whether the hash belongs to the scheme of the hasher.
+	Handles(hash string) bool
+	Verify(hash string, plain string) bool
+}
+
+var (
+	hashersMutex sync.RWMutex
+	hashers      = []Hasher{bcryptHasher{}, shaHasher{}, sha512CryptHasher{}, argon2Hasher{}}
+)
+
+// RegisterHasher adds a password scheme to VerifyPassword. Hashers are asked
+// in the order of registration after the built in ones: bcrypt, {SHA},
+// {SSHA}, {SHA512-CRYPT} and argon2id.
+func RegisterHasher(hasher Hasher) {
+	hashersMutex.Lock()
+	defer hashersMutex.Unlock()
+
+	hashers = append(hashers, hasher)
+}
+
+func hasherOf(hash string) Hasher {
+	hashersMutex.RLock()
+	defer hashersMutex.RUnlock()
+
+	for _, hasher := range hashers {
+		if hasher.Handles(hash) {
+			return hasher
+		}
+	}
+
+	return nil
+}
+
+// trimScheme removes the {SCHEME} prefix of the hash, compared case
+// insensitive
+func trimScheme(hash string, scheme string) (string, bool) {
+	if len(hash) < len(scheme) || !strings.EqualFold(hash[:len(scheme)], scheme) {
+		return hash, false
+	}
+
+	return hash[len(scheme):], true
+}
+
+// bcryptHasher verifies $2a$, $2b$ and $2y$ hashes, also prefixed with
+// {CRYPT} or {BCRYPT}
+type bcryptHasher struct{}
+
+func (bcryptHasher) trim(hash string) string {
+	if trimmed, ok := trimScheme(hash, "{CRYPT}"); ok {
+		return trimmed
+	}
+	trimmed, _ := trimScheme(hash, "{BCRYPT}")
+	return trimmed
+}
+
+func (hasher bcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hasher.trim(hash), "$2")
+}
+
+func (hasher bcryptHasher) Verify(hash string, plain string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hasher.trim(hash)), []byte(plain)) == nil
+}
+
+// shaHasher verifies the {SHA} and salted {SSHA} hashes of openldap
+type shaHasher struct{}
+
+func (shaHasher) Handles(hash string) bool {
+	_, sha := trimScheme(hash, "{SHA}")
+	_, ssha := trimScheme(hash, "{SSHA}")
+	return sha || ssha
+}
+
+func (shaHasher) Verify(hash string, plain string) bool {
+	encoded, salted := trimScheme(hash, "{SSHA}")
+	if !salted {
+		encoded, _ = trimScheme(hash, "{SHA}")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) < sha1.Size || (!salted && len(decoded) != sha1.Size) {
+		return false
+	}
+
+	sum := sha1.Sum(append([]byte(plain), decoded[sha1.Size:]...))
+	return subtle.ConstantTimeCompare(sum[:], decoded[:sha1.Size]) == 1
+}
+
+// sha512CryptHasher verifies the $6$ hashes of crypt(3), also prefixed with
+// {SHA512-CRYPT} or {CRYPT}
+type sha512CryptHasher struct{}
+
+func (sha512CryptHasher) trim(hash string) string {
+	if trimmed, ok := trimScheme(hash, "{SHA512-CRYPT}"); ok {
+		return trimmed
+	}
+	trimmed, _ := trimScheme(hash, "{CRYPT}")
+	return trimmed
+}
+
+func (hasher sha512CryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hasher.trim(hash), "$6$")
+}
+
+func (hasher sha512CryptHasher) Verify(hash string, plain string) bool {
+	setting := strings.TrimPrefix(hasher.trim(hash), "$6$")
+
+	rounds := 5000
+	if strings.HasPrefix(setting, "rounds=") {
+		i := strings.Index(setting, "$")
+		if i < 0 {
+			return false
+		}
+		n, err := strconv.Atoi(setting[len("rounds="):i])
+		if err != nil {
+			return false
+		}
+		rounds, setting = n, setting[i+1:]
+	}
+	if rounds < 1000 {
+		rounds = 1000
+	} else if rounds > 999999999 {
+		rounds = 999999999
+	}
+
+	i := strings.LastIndex(setting, "$")
+	if i < 0 {
+		return false
+	}
+	salt, encoded := setting[:i], setting[i+1:]
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	computed := sha512Crypt([]byte(plain), []byte(salt), rounds)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1
+}
+
+// sha512Crypt computes the encoded digest of the SHA-crypt specification of
+// Ulrich Drepper
+func sha512Crypt(password []byte, salt []byte, rounds int) string {
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	for i := len(password); i > 0; i -= sha512.Size {
+		if i > sha512.Size {
+			a.Write(digestB)
+		} else {
+			a.Write(digestB[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(password)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range password {
+		dp.Write(password)
+	}
+	p := repeat(dp.Sum(nil), len(password))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	c := digestA
+	for r := 0; r < rounds; r++ {
+		h := sha512.New()
+		if r&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if r%3 != 0 {
+			h.Write(s)
+		}
+		if r%7 != 0 {
+			h.Write(p)
+		}
+		if r&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var encoded bytes.Buffer
+	for i := 0; i < 21; i++ {
+		encode24(&encoded, c[i], c[(i+21)%63], c[(i+42)%63], 4, i)
+	}
+	encode24(&encoded, 0, 0, c[63], 2, -1)
+
+	return encoded.String()
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// encode24 appends the base64 of crypt(3) of three bytes. The bytes of the
+// groups rotate, group i starts with byte i, i+21 or i+42.
+func encode24(encoded *bytes.Buffer, b0 byte, b1 byte, b2 byte, n int, i int) {
+	switch i % 3 {
+	case 1:
+		b0, b1, b2 = b1, b2, b0
+	case 2:
+		b0, b1, b2 = b2, b0, b1
+	}
+
+	w := uint(b0)<<16 | uint(b1)<<8 | uint(b2)
+	for ; n > 0; n-- {
+		encoded.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+func repeat(digest []byte, length int) []byte {
+	repeated := make([]byte, 0, length)
+	for len(repeated) < length {
+		n := length - len(repeated)
+		if n > len(digest) {
+			n = len(digest)
+		}
+		repeated = append(repeated, digest[:n]...)
+	}
+
+	return repeated
+}
+
+// argon2Hasher verifies the $argon2id$ hashes of the argon2 reference
+// implementation, also prefixed with {ARGON2}
+type argon2Hasher struct{}
+
+func (argon2Hasher) trim(hash string) string {
+	trimmed, _ := trimScheme(hash, "{ARGON2}")
+	return trimmed
+}
+
+func (hasher argon2Hasher) Handles(hash string) bool {
+	return strings.HasPrefix(hasher.trim(hash), "$argon2id$")
+}
+
+func (hasher argon2Hasher) Verify(hash string, plain string) bool {
+	// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+	parts := strings.Split(hasher.trim(hash), "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
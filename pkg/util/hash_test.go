@@ -0,0 +1,100 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/argon2"
+	"strings"
+	"testing"
+)
+
+type prefixHasher string
+
+func (h prefixHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, string(h))
+}
+
+func (h prefixHasher) Verify(hash string, plain string) bool {
+	return strings.TrimPrefix(hash, string(h)) == strings.ToUpper(plain)
+}
+
+func TestHashSchemes(t *testing.T) {
+	Convey("Given a hash of sha512 crypt", t, func() {
+		hash := "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+
+		So(VerifyPassword(hash, "Hello world!"), ShouldBeTrue)
+		So(VerifyPassword("{SHA512-CRYPT}"+hash, "Hello world!"), ShouldBeTrue)
+		So(VerifyPassword("{CRYPT}"+hash, "Hello world!"), ShouldBeTrue)
+		So(VerifyPassword(hash, "Hello world"), ShouldBeFalse)
+
+		Convey("With rounds and a long salt", func() {
+			hash := "$6$rounds=10000$saltstringsaltstring$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."
+
+			So(VerifyPassword(hash, "Hello world!"), ShouldBeTrue)
+			So(VerifyPassword(hash, "Hello world?"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a hash of ssha", t, func() {
+		salt := []byte("salt")
+		sum := sha1.Sum(append([]byte("secret"), salt...))
+		hash := "{SSHA}" + base64.StdEncoding.EncodeToString(append(sum[:], salt...))
+
+		So(VerifyPassword(hash, "secret"), ShouldBeTrue)
+		So(VerifyPassword(strings.Replace(hash, "{SSHA}", "{ssha}", 1), "secret"), ShouldBeTrue)
+		So(VerifyPassword(hash, "Secret"), ShouldBeFalse)
+		So(VerifyPassword("{SSHA}invalid", "secret"), ShouldBeFalse)
+
+		Convey("Without a salt", func() {
+			sum := sha1.Sum([]byte("secret"))
+			hash := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+
+			So(VerifyPassword(hash, "secret"), ShouldBeTrue)
+			So(VerifyPassword(hash, "secret2"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a hash of argon2id", t, func() {
+		salt := []byte("somesalt")
+		key := argon2.IDKey([]byte("password"), salt, 2, 64, 1, 32)
+		hash := "$argon2id$v=19$m=64,t=2,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+
+		So(VerifyPassword(hash, "password"), ShouldBeTrue)
+		So(VerifyPassword("{ARGON2}"+hash, "password"), ShouldBeTrue)
+		So(VerifyPassword(hash, "passwort"), ShouldBeFalse)
+		So(VerifyPassword(strings.Replace(hash, "v=19", "v=16", 1), "password"), ShouldBeFalse)
+	})
+
+	Convey("Given a password of an unknown scheme", t, func() {
+		So(VerifyPassword("secret", "secret"), ShouldBeFalse)
+		So(VerifyPassword("{MD5}Xr4ilOzQ4PCOq3aQ0qbuaQ==", "secret"), ShouldBeFalse)
+
+		Convey("After registering a hasher of the scheme", func() {
+			RegisterHasher(prefixHasher("{UPPER}"))
+
+			So(VerifyPassword("{UPPER}SECRET", "secret"), ShouldBeTrue)
+			So(VerifyPassword("{UPPER}SECRET", "other"), ShouldBeFalse)
+		})
+	})
+}
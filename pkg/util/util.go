@@ -25,8 +25,16 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// VerifyPassword verifies the password against the hash with the registered
+// hasher of its scheme. Hashes of an unknown scheme, including cleartext, never
+// match.
 func VerifyPassword(encrypted string, plain string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(encrypted), []byte(plain)) == nil
+	hasher := hasherOf(encrypted)
+	if hasher == nil {
+		return false
+	}
+
+	return hasher.Verify(encrypted, plain)
 }
 
 func VerifyPasswordCtx(ctx context.Context, encrypted string, plain string) bool {
@@ -0,0 +1,147 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package valuerules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrNoAttribute = errors.New("valuerules: a rule needs an attribute")
+
+// A Rule changes the values of an attribute of the returned entries: values
+// not matching `allow` or matching `deny` are dropped, the matches of
+// `replace` are replaced by `with` and longer values are truncated to
+// `maxLength` characters, in this order.
+type Rule struct {
+	Attribute string `json:"attribute"`
+	Allow     string `json:"allow"`
+	Deny      string `json:"deny"`
+	Replace   string `json:"replace"`
+	With      string `json:"with"`
+	MaxLength int    `json:"maxLength"`
+}
+
+type rule struct {
+	allow     *regexp.Regexp
+	deny      *regexp.Regexp
+	replace   *regexp.Regexp
+	with      string
+	maxLength int
+}
+
+// A Policy applies the rules of the attributes to the values of the entries,
+// e.g. to strip internal host names from the descriptions shown to partners.
+type Policy struct {
+	// the rules by lower case attribute, in the order of the config
+	rules map[string][]*rule
+}
+
+func New(rules []*Rule) (*Policy, error) {
+	policy := &Policy{rules: make(map[string][]*rule)}
+
+	for _, config := range rules {
+		if config.Attribute == "" {
+			return nil, ErrNoAttribute
+		}
+
+		r := &rule{with: config.With, maxLength: config.MaxLength}
+		var err error
+		if r.allow, err = compile(config.Allow); err != nil {
+			return nil, err
+		}
+		if r.deny, err = compile(config.Deny); err != nil {
+			return nil, err
+		}
+		if r.replace, err = compile(config.Replace); err != nil {
+			return nil, err
+		}
+
+		name := strings.ToLower(config.Attribute)
+		policy.rules[name] = append(policy.rules[name], r)
+	}
+
+	return policy, nil
+}
+
+// Apply returns a copy of the attributes with the values changed by the
+// rules. Attributes without values left are dropped. A nil policy returns the
+// attributes unchanged.
+func (policy *Policy) Apply(attributes map[string][]string) map[string][]string {
+	if policy == nil {
+		return attributes
+	}
+
+	applied := make(map[string][]string, len(attributes))
+	for name, values := range attributes {
+		rules, ok := policy.rules[strings.ToLower(name)]
+		if !ok {
+			applied[name] = values
+			continue
+		}
+
+		for _, r := range rules {
+			values = r.apply(values)
+		}
+		if len(values) > 0 {
+			applied[name] = values
+		}
+	}
+
+	return applied
+}
+
+func (r *rule) apply(values []string) []string {
+	var applied []string
+	for _, value := range values {
+		if (r.allow != nil && !r.allow.MatchString(value)) || (r.deny != nil && r.deny.MatchString(value)) {
+			continue
+		}
+		if r.replace != nil {
+			value = r.replace.ReplaceAllString(value, r.with)
+		}
+		if r.maxLength > 0 {
+			if runes := []rune(value); len(runes) > r.maxLength {
+				value = string(runes[:r.maxLength])
+			}
+		}
+		if value != "" {
+			applied = append(applied, value)
+		}
+	}
+
+	return applied
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("valuerules: invalid pattern '%s': %v", pattern, err)
+	}
+
+	return compiled, nil
+}
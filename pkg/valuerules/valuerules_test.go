@@ -0,0 +1,87 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package valuerules
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPolicy_Apply(t *testing.T) {
+	Convey("Given a policy with value rules", t, func() {
+		policy, err := New([]*Rule{
+			{Attribute: "description", Replace: `\b[a-z0-9-]+\.corp\.example\.com\b`, With: "[internal]"},
+			{Attribute: "Description", MaxLength: 20},
+			{Attribute: "mail", Allow: `@example\.com$`},
+			{Attribute: "telephoneNumber", Deny: `^\+49 30 1234`},
+		})
+		So(err, ShouldBeNil)
+
+		attributes := map[string][]string{
+			"cn":              {"John Doe"},
+			"description":     {"runs on db-01.corp.example.com", "db-02.corp.example.com"},
+			"mail":            {"jdoe@example.com", "john@private.example.org"},
+			"telephoneNumber": {"+49 30 1234 567"},
+		}
+		applied := policy.Apply(attributes)
+
+		Convey("Then the matches are replaced and the values truncated", func() {
+			So(applied["description"], ShouldResemble, []string{"runs on [internal]", "[internal]"})
+		})
+
+		Convey("Then values not allowed are dropped", func() {
+			So(applied["mail"], ShouldResemble, []string{"jdoe@example.com"})
+		})
+
+		Convey("Then attributes without values left are dropped", func() {
+			So(applied, ShouldNotContainKey, "telephoneNumber")
+		})
+
+		Convey("Then other attributes and the original are unchanged", func() {
+			So(applied["cn"], ShouldResemble, []string{"John Doe"})
+			So(attributes["mail"], ShouldHaveLength, 2)
+		})
+
+		Convey("Then long values are truncated", func() {
+			applied := policy.Apply(map[string][]string{"description": {"a description longer than twenty characters"}})
+			So(applied["description"], ShouldResemble, []string{"a description longer"})
+		})
+	})
+
+	Convey("Given a nil policy", t, func() {
+		var policy *Policy
+		attributes := map[string][]string{"cn": {"John Doe"}}
+
+		Convey("Then the attributes are unchanged", func() {
+			So(policy.Apply(attributes), ShouldResemble, attributes)
+		})
+	})
+
+	Convey("Given invalid rules", t, func() {
+		Convey("Then an error should be returned", func() {
+			_, err := New([]*Rule{{Allow: ".*"}})
+			So(err, ShouldEqual, ErrNoAttribute)
+
+			_, err = New([]*Rule{{Attribute: "mail", Deny: "("}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NewRemoteVerifier delegates the verification to a remote service, e.g. one
+// backed by a hardware security module. The credentials are posted as json
+// `{"username": "", "password": ""}`, the service answers with 404 for unknown
+// users or with `{"valid": true|false}`.
+func NewRemoteVerifier(url string, timeout time.Duration) Verifier {
+	return &remoteVerifier{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+type remoteVerifier struct {
+	url    string
+	client *http.Client
+}
+
+type remoteRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type remoteResponse struct {
+	Valid bool `json:"valid"`
+}
+
+func (verifier *remoteVerifier) Verify(ctx context.Context, username string, password string) (Result, error) {
+	body, err := json.Marshal(&remoteRequest{Username: username, Password: password})
+	if err != nil {
+		return Unknown, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, verifier.url, bytes.NewReader(body))
+	if err != nil {
+		return Unknown, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := verifier.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Unknown, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Unknown, nil
+	default:
+		return Unknown, fmt.Errorf("verify: remote verifier returned %s", res.Status)
+	}
+
+	decoded := &remoteResponse{}
+	if err = json.NewDecoder(res.Body).Decode(decoded); err != nil {
+		return Unknown, err
+	}
+
+	if decoded.Valid {
+		return Valid, nil
+	}
+
+	return Invalid, nil
+}
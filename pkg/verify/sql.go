@@ -0,0 +1,62 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package verify
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/lib/pq"
+
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+)
+
+// NewSqlVerifier verifies the password against a bcrypt hash read from a
+// database. The query gets the username as only argument ($1) and has to
+// return the hash as first column.
+func NewSqlVerifier(db *sql.DB, query string) Verifier {
+	return &sqlVerifier{
+		db:    db,
+		query: query,
+	}
+}
+
+type sqlVerifier struct {
+	db    *sql.DB
+	query string
+}
+
+func (verifier *sqlVerifier) Verify(ctx context.Context, username string, password string) (Result, error) {
+	var hashedPassword string
+
+	err := verifier.db.QueryRowContext(ctx, verifier.query, username).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return Unknown, nil
+	}
+	if err != nil {
+		return Unknown, err
+	}
+
+	if util.VerifyPasswordCtx(ctx, hashedPassword, password) {
+		return Valid, nil
+	}
+
+	return Invalid, nil
+}
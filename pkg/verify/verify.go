@@ -0,0 +1,188 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package verify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/samuel/go-ldap/ldap"
+	"time"
+)
+
+// The outcome of a single password verification.
+type Result int
+
+const (
+	// The verifier doesn't know the user, the next verifier is asked.
+	Unknown Result = iota
+	Valid
+	Invalid
+)
+
+// A Verifier checks the password of a user independent of where the profile
+// data of the user lives.
+type Verifier interface {
+	Verify(ctx context.Context, username string, password string) (Result, error)
+}
+
+const (
+	KindBackend = "backend"
+	KindSql     = "sql"
+	KindRemote  = "remote"
+)
+
+// VerifierConfig configures a single verifier of the chain.
+type VerifierConfig struct {
+	Kind string `json:"kind"`
+
+	// the database url and the query returning the bcrypt hash for the
+	// username ($1) for the sql verifier
+	Url   string `json:"url"`
+	Query string `json:"query"`
+
+	// the timeout of the remote verifier
+	Timeout string `json:"timeout"`
+}
+
+type Config struct {
+	pkg.Config
+
+	Verifiers []VerifierConfig `json:"verifiers"`
+}
+
+type verifyingBackend struct {
+	pkg.Forwarder
+
+	delegateBackend pkg.Backend
+	verifiers       []Verifier
+}
+
+var _ pkg.PasswordBackend = &verifyingBackend{}
+var _ pkg.WriterBackend = &verifyingBackend{}
+
+// NewBackend returns a backend verifying passwords with the configured chain
+// of verifiers. The users are still served by the delegate.
+func NewBackend(delegateBackend pkg.Backend, config *Config) (pkg.Backend, error) {
+	verifiers := []Verifier{}
+	for _, verifierConfig := range config.Verifiers {
+		verifier, err := newVerifier(delegateBackend, verifierConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	return &verifyingBackend{
+		Forwarder:       pkg.Forward(delegateBackend),
+		delegateBackend: delegateBackend,
+		verifiers:       verifiers,
+	}, nil
+}
+
+func newVerifier(delegateBackend pkg.Backend, config VerifierConfig) (Verifier, error) {
+	switch config.Kind {
+	case KindBackend:
+		return NewBackendVerifier(delegateBackend), nil
+
+	case KindSql:
+		db, err := sql.Open("postgres", config.Url)
+		if err != nil {
+			return nil, err
+		}
+		return NewSqlVerifier(db, config.Query), nil
+
+	case KindRemote:
+		timeout := 5 * time.Second
+		if config.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+				return nil, err
+			}
+		}
+		return NewRemoteVerifier(config.Url, timeout), nil
+	}
+
+	return nil, fmt.Errorf("verify: unknown verifier kind '%s'", config.Kind)
+}
+
+func (backend *verifyingBackend) Name() (name string) {
+	return backend.delegateBackend.Name()
+}
+
+// Authenticate asks the verifiers in order until one of them knows the user.
+// Failing verifiers are logged and skipped.
+func (backend *verifyingBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	for i, verifier := range backend.verifiers {
+		result, err := verifier.Verify(ctx, username, password)
+		if err != nil {
+			log.ForBackend(backend.Name()).Printf("verifier %d of backend %s failed: %s", i, backend.Name(), err)
+			continue
+		}
+
+		switch result {
+		case Valid:
+			return true
+		case Invalid:
+			return false
+		}
+	}
+
+	return false
+}
+
+// SetPassword changes the password if the delegate backend changes passwords.
+func (backend *verifyingBackend) SetPassword(ctx context.Context, username string, password string) error {
+	passwordBackend, ok := backend.delegateBackend.(pkg.PasswordBackend)
+	if !ok {
+		return pkg.ErrUnwillingToPerform
+	}
+
+	return passwordBackend.SetPassword(ctx, username, password)
+}
+
+func (backend *verifyingBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return backend.delegateBackend.GetUsers(ctx, f)
+}
+
+// NewBackendVerifier uses the native authentication of the backend. As a
+// backend can't tell unknown users from wrong passwords, failures continue the
+// chain.
+func NewBackendVerifier(backend pkg.Backend) Verifier {
+	return &backendVerifier{
+		backend: backend,
+	}
+}
+
+type backendVerifier struct {
+	backend pkg.Backend
+}
+
+func (verifier *backendVerifier) Verify(ctx context.Context, username string, password string) (Result, error) {
+	if verifier.backend.Authenticate(ctx, username, password) {
+		return Valid, nil
+	}
+
+	return Unknown, nil
+}
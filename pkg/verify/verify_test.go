@@ -0,0 +1,170 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gopenguin/ldap-proxy/pkg"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testBackend struct {
+	result bool
+}
+
+func (backend *testBackend) Authenticate(ctx context.Context, username string, password string) bool {
+	return backend.result
+}
+
+func (backend *testBackend) Name() (name string) {
+	return "test"
+}
+
+func (backend *testBackend) GetUsers(ctx context.Context, f ldap.Filter) ([]*pkg.User, error) {
+	return []*pkg.User{}, nil
+}
+
+type testVerifier struct {
+	result Result
+	called bool
+}
+
+func (verifier *testVerifier) Verify(ctx context.Context, username string, password string) (Result, error) {
+	verifier.called = true
+
+	return verifier.result, nil
+}
+
+func TestVerifyingBackend_Authenticate(t *testing.T) {
+	Convey("Given a chain of verifiers", t, func() {
+		first := &testVerifier{result: Unknown}
+		second := &testVerifier{result: Invalid}
+		third := &testVerifier{result: Valid}
+
+		backend := &verifyingBackend{
+			delegateBackend: &testBackend{},
+			verifiers:       []Verifier{first, second, third},
+		}
+
+		Convey("When a user authenticates", func() {
+			result := backend.Authenticate(context.Background(), "user1", "password")
+
+			Convey("Then the first verifier knowing the user decides", func() {
+				So(result, ShouldBeFalse)
+				So(first.called, ShouldBeTrue)
+				So(second.called, ShouldBeTrue)
+				So(third.called, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given a config with an unknown verifier", t, func() {
+		_, err := NewBackend(&testBackend{}, &Config{Verifiers: []VerifierConfig{{Kind: "pkcs11"}}})
+
+		Convey("Then an error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBackendVerifier(t *testing.T) {
+	Convey("Given a backend rejecting the credentials", t, func() {
+		verifier := NewBackendVerifier(&testBackend{result: false})
+
+		Convey("Then the user is unknown to the verifier", func() {
+			result, err := verifier.Verify(context.Background(), "user1", "password")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, Unknown)
+		})
+	})
+}
+
+func TestSqlVerifier(t *testing.T) {
+	Convey("Given a database with the hash of user1", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+
+		verifier := NewSqlVerifier(db, "SELECT password FROM credentials WHERE name = $1")
+
+		Convey("When user1 authenticates with the correct password", func() {
+			mock.ExpectQuery("^SELECT password FROM credentials").WithArgs("user1").
+				WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(util.HashPassword("test123", 4)))
+
+			result, err := verifier.Verify(context.Background(), "user1", "test123")
+
+			Convey("Then the password is valid", func() {
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, Valid)
+			})
+		})
+
+		Convey("When an unknown user authenticates", func() {
+			mock.ExpectQuery("^SELECT password FROM credentials").WithArgs("user2").
+				WillReturnRows(sqlmock.NewRows([]string{"password"}))
+
+			result, err := verifier.Verify(context.Background(), "user2", "test123")
+
+			Convey("Then the user is unknown", func() {
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, Unknown)
+			})
+		})
+	})
+}
+
+func TestRemoteVerifier(t *testing.T) {
+	Convey("Given a remote verification service knowing user1", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &remoteRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			if req.Username != "user1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(&remoteResponse{Valid: req.Password == "test123"})
+		}))
+		defer server.Close()
+
+		verifier := NewRemoteVerifier(server.URL, time.Second)
+
+		Convey("Then the service decides for known users only", func() {
+			result, err := verifier.Verify(context.Background(), "user1", "test123")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, Valid)
+
+			result, err = verifier.Verify(context.Background(), "user1", "wrong")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, Invalid)
+
+			result, err = verifier.Verify(context.Background(), "user2", "test123")
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, Unknown)
+		})
+	})
+}
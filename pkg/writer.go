@@ -0,0 +1,131 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/log"
+	"github.com/gopenguin/ldap-proxy/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samuel/go-ldap/ldap"
+	"strings"
+)
+
+// writerBackend returns the enabled writable backend owning the longest naming
+// context of the dn. Backends must be configured writable to get writes.
+func (ldapProxy *LdapProxy) writerBackend(dn string) (WriterBackend, bool) {
+	var writer WriterBackend
+	longest := -1
+
+	for _, backend := range ldapProxy.ordered {
+		candidate, ok := backend.(WriterBackend)
+		if !ok || !ldapProxy.config.Writable[backend.Name()] || !ldapProxy.isEnabled(backend.Name()) {
+			continue
+		}
+
+		for _, namingContext := range ldapProxy.config.NamingContexts[backend.Name()] {
+			if util.IsBelowDN(dn, namingContext) && len(namingContext) > longest {
+				writer, longest = candidate, len(namingContext)
+			}
+		}
+	}
+
+	return writer, writer != nil
+}
+
+// invalidateBinds drops the cached binds of the dn, e.g. after its password,
+// status or groups changed
+func (ldapProxy *LdapProxy) invalidateBinds(dn string) {
+	ldapProxy.config.BindCache.Invalidate(dn)
+	ldapProxy.config.NegativeBindCache.Invalidate(dn)
+	ldapProxy.config.OfflineBindCache.Invalidate(dn)
+}
+
+// RenamedDN returns the dn of an entry renamed to the new rdn and moved to the
+// new superior. Without new superior the entry keeps its parent.
+func RenamedDN(dn string, newRDN string, newSuperior string) string {
+	parent := newSuperior
+	if parent == "" {
+		parent = strings.Join(util.SplitDN(dn)[1:], ",")
+	}
+
+	if parent == "" {
+		return newRDN
+	}
+
+	return newRDN + "," + parent
+}
+
+// isProtected reports whether the dn is within a protected subtree
+func (ldapProxy *LdapProxy) isProtected(dn string) bool {
+	for _, subtree := range ldapProxy.config.ProtectedSubtrees {
+		if util.IsBelowDN(dn, subtree) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// write delegates the write of the dn to the owning writer backend. Bound
+// sessions only may write, the cached searches and the cached binds of the dn
+// are dropped after a write.
+func (ldapProxy *LdapProxy) write(ctx context.Context, sess *session, action string, dn string, write func(backend WriterBackend) error) ldap.BaseResponse {
+	if getDn(sess.context) == "" {
+		return ldap.BaseResponse{Code: ldap.ResultInsufficientAccessRights}
+	}
+
+	backend, ok := ldapProxy.writerBackend(dn)
+	if !ok {
+		log.Debugf("no writer backend for %s", dn)
+		return ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform}
+	}
+
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		backendActionDuration.With(prometheus.Labels{"action": action, "backend": backend.Name()}).Observe(v)
+	}))
+	err := write(backend)
+	timer.ObserveDuration()
+	ldapProxy.monitor.backendCall(backend.Name(), action, err != nil && err != ErrEntryExists && err != ErrNoSuchEntry, false)
+
+	switch err {
+	case nil:
+		log.ForBackend(backend.Name()).Printf("%s of %s by %s written to backend %s%s", action, dn, getDn(sess.context), backend.Name(), logRequestId(RequestId(ctx)))
+		ldapProxy.config.SearchCache.Flush()
+		ldapProxy.config.NegativeSearchCache.Flush()
+		ldapProxy.config.MemberOf.Flush()
+		ldapProxy.invalidateBinds(dn)
+		return ldap.BaseResponse{Code: ldap.ResultSuccess}
+	case ErrEntryExists:
+		return ldap.BaseResponse{Code: ldap.ResultEntryAlreadyExists}
+	case ErrNoSuchEntry:
+		return ldap.BaseResponse{Code: ldap.ResultNoSuchObject}
+	case ErrUnwillingToPerform:
+		return ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform}
+	case ErrMoveUnsupported:
+		return ldap.BaseResponse{Code: ldap.ResultUnwillingToPerform, Message: err.Error()}
+	case ErrBackendUnavailable:
+		return ldap.BaseResponse{Code: ldap.ResultUnavailable}
+	}
+
+	log.ForBackend(backend.Name()).Printf("%s of %s failed in backend %s: %v%s", action, dn, backend.Name(), err, logRequestId(RequestId(ctx)))
+	return ldap.BaseResponse{Code: ldap.ResultOperationsError, Message: err.Error()}
+}
@@ -0,0 +1,308 @@
+// Copyright © 2017 Stefan Kollmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pkg
+
+import (
+	"context"
+	"github.com/gopenguin/ldap-proxy/pkg/bindcache"
+	"github.com/samuel/go-ldap/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+type testWriterBackend struct {
+	testBackend
+
+	written []string
+	err     error
+}
+
+func (backend *testWriterBackend) Add(ctx context.Context, entry *User) error {
+	return backend.record("add " + entry.DN)
+}
+
+func (backend *testWriterBackend) Modify(ctx context.Context, dn string, mods []*ldap.Mod) error {
+	return backend.record("modify " + dn)
+}
+
+func (backend *testWriterBackend) Delete(ctx context.Context, dn string) error {
+	return backend.record("delete " + dn)
+}
+
+func (backend *testWriterBackend) ModifyDN(ctx context.Context, dn string, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	return backend.record("modify_dn " + dn + " " + newRDN)
+}
+
+func (backend *testWriterBackend) record(write string) error {
+	if backend.err != nil {
+		return backend.err
+	}
+
+	backend.written = append(backend.written, write)
+	return nil
+}
+
+func TestLdapProxy_Add(t *testing.T) {
+	Convey("Given a ldap proxy with writer backends of nested naming contexts", t, func() {
+		corp := &testWriterBackend{testBackend: testBackend{name: "corp"}}
+		groups := &testWriterBackend{testBackend: testBackend{name: "groups"}}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(&testBackend{name: "readonly"}, corp, groups)
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{
+			"readonly": {"dc=partner,dc=com"},
+			"corp":     {"dc=example,dc=com"},
+			"groups":   {"ou=Groups,dc=example,dc=com"},
+		}
+		config.Writable = map[string]bool{"readonly": true, "corp": true, "groups": true}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		add := func(dn string) (*ldap.AddResponse, error) {
+			return proxy.Add(sess, &ldap.AddRequest{DN: dn, Attributes: []*ldap.Attribute{
+				{Name: "objectClass", Values: [][]byte{[]byte("groupOfNames")}},
+			}})
+		}
+
+		Convey("When an entry is added", func() {
+			res, err := add("cn=admins,ou=groups,dc=example,dc=com")
+
+			Convey("Then the backend with the longest naming context adds it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(groups.written, ShouldResemble, []string{"add cn=admins,ou=groups,dc=example,dc=com"})
+				So(corp.written, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When an entry of a read only backend is added", func() {
+			res, err := add("uid=a,dc=partner,dc=com")
+
+			Convey("Then the proxy is unwilling to perform it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+			})
+		})
+
+		Convey("When the entry already exists", func() {
+			corp.err = ErrEntryExists
+			res, err := add("uid=a,dc=example,dc=com")
+
+			Convey("Then entryAlreadyExists is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultEntryAlreadyExists)
+			})
+		})
+
+		Convey("When an unbound session adds an entry", func() {
+			ctx, cancle := context.WithCancel(context.Background())
+			res, err := proxy.Add(&session{context: ctx, cancle: cancle}, &ldap.AddRequest{DN: "uid=a,dc=example,dc=com"})
+
+			Convey("Then the access is denied", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultInsufficientAccessRights)
+				So(corp.written, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_Modify(t *testing.T) {
+	Convey("Given a ldap proxy with a writer backend", t, func() {
+		corp := &testWriterBackend{testBackend: testBackend{name: "corp"}}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(corp)
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}}
+		config.Writable = map[string]bool{"corp": true}
+		config.BindCache, _ = bindcache.New("test", &bindcache.Config{})
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When the password of an entry with a cached bind is modified", func() {
+			config.BindCache.Add("uid=a,dc=example,dc=com", "secret", "corp")
+			res, _ := proxy.Modify(sess, &ldap.ModifyRequest{DN: "uid=a,dc=example,dc=com", Mods: []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "userPassword", Values: [][]byte{[]byte("changed")}},
+			}})
+
+			Convey("Then the cached bind is dropped", func() {
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				_, cached := config.BindCache.Verify("uid=a,dc=example,dc=com", "secret")
+				So(cached, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an entry is modified", func() {
+			res, err := proxy.Modify(sess, &ldap.ModifyRequest{DN: "uid=a,dc=example,dc=com", Mods: []*ldap.Mod{
+				{Type: ldap.ModReplace, Name: "mail", Values: [][]byte{[]byte("a@example.com")}},
+			}})
+
+			Convey("Then the backend modifies it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(corp.written, ShouldResemble, []string{"modify uid=a,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When the entry doesn't exist", func() {
+			corp.err = ErrNoSuchEntry
+			res, err := proxy.Modify(sess, &ldap.ModifyRequest{DN: "uid=b,dc=example,dc=com"})
+
+			Convey("Then noSuchObject is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultNoSuchObject)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_Delete(t *testing.T) {
+	Convey("Given a ldap proxy with a writer backend and a protected subtree", t, func() {
+		corp := &testWriterBackend{testBackend: testBackend{name: "corp"}}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(corp)
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}}
+		config.Writable = map[string]bool{"corp": true}
+		config.ProtectedSubtrees = []string{"ou=system,dc=example,dc=com"}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When an entry is deleted", func() {
+			res, err := proxy.Delete(sess, &ldap.DeleteRequest{DN: "uid=a,dc=example,dc=com"})
+
+			Convey("Then the backend deletes it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(corp.written, ShouldResemble, []string{"delete uid=a,dc=example,dc=com"})
+			})
+		})
+
+		Convey("When an entry of the protected subtree is deleted", func() {
+			res, err := proxy.Delete(sess, &ldap.DeleteRequest{DN: "cn=replicator,OU=System,dc=example,dc=com"})
+
+			Convey("Then the proxy is unwilling to perform it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(corp.written, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the backend isn't configured writable", func() {
+			config := DefaultProxyConfig()
+			config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}}
+			proxy.Configure(config)
+
+			res, err := proxy.Delete(sess, &ldap.DeleteRequest{DN: "uid=a,dc=example,dc=com"})
+
+			Convey("Then the proxy is unwilling to perform the delete", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(corp.written, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLdapProxy_ModifyDN(t *testing.T) {
+	Convey("Given a ldap proxy with two writer backends", t, func() {
+		corp := &testWriterBackend{testBackend: testBackend{name: "corp"}}
+		partner := &testWriterBackend{testBackend: testBackend{name: "partner"}}
+		proxy := NewLdapProxy()
+		proxy.AddBackend(corp, partner)
+
+		config := DefaultProxyConfig()
+		config.NamingContexts = map[string][]string{"corp": {"dc=example,dc=com"}, "partner": {"dc=partner,dc=com"}}
+		config.Writable = map[string]bool{"corp": true, "partner": true}
+		proxy.Configure(config)
+
+		ctx, cancle := context.WithCancel(setDn(context.Background(), "cn=test"))
+		sess := &session{
+			context: ctx,
+			cancle:  cancle,
+		}
+
+		Convey("When an entry is renamed", func() {
+			res, err := proxy.ModifyDN(sess, &ldap.ModifyDNRequest{DN: "uid=a,dc=example,dc=com", NewRDN: "uid=b", DeleteOldRDN: true})
+
+			Convey("Then the backend renames it", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultSuccess)
+				So(corp.written, ShouldResemble, []string{"modify_dn uid=a,dc=example,dc=com uid=b"})
+			})
+		})
+
+		Convey("When an entry is moved to another backend", func() {
+			res, err := proxy.ModifyDN(sess, &ldap.ModifyDNRequest{DN: "uid=a,dc=example,dc=com", NewRDN: "uid=a", NewSuperior: "dc=partner,dc=com"})
+
+			Convey("Then affectsMultipleDSAs is returned", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultAffectsMultipleDSAs)
+				So(corp.written, ShouldBeEmpty)
+				So(partner.written, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the backend can't move entries", func() {
+			corp.err = ErrMoveUnsupported
+			res, err := proxy.ModifyDN(sess, &ldap.ModifyDNRequest{DN: "uid=a,ou=a,dc=example,dc=com", NewRDN: "uid=a", NewSuperior: "ou=b,dc=example,dc=com"})
+
+			Convey("Then the proxy is unwilling to perform it with a message", func() {
+				So(err, ShouldBeNil)
+				So(res.Code, ShouldEqual, ldap.ResultUnwillingToPerform)
+				So(res.Message, ShouldNotBeBlank)
+			})
+		})
+	})
+}
+
+func TestRenamedDN(t *testing.T) {
+	Convey("Given the dn of an entry", t, func() {
+		dn := "uid=a\\,b,ou=People,dc=example,dc=com"
+
+		Convey("Then a rename keeps the parent", func() {
+			So(RenamedDN(dn, "uid=c", ""), ShouldEqual, "uid=c,ou=People,dc=example,dc=com")
+		})
+
+		Convey("Then a move replaces the parent", func() {
+			So(RenamedDN(dn, "uid=c", "ou=Staff,dc=example,dc=com"), ShouldEqual, "uid=c,ou=Staff,dc=example,dc=com")
+			So(RenamedDN("userA", "userB", ""), ShouldEqual, "userB")
+		})
+	})
+}
@@ -0,0 +1,9 @@
+#!/bin/bash
+
+# runs the client compatibility tests in a container with the openldap client tools
+
+docker run --rm \
+-v "${PWD}:/go/src/github.com/gopenguin/ldap-proxy" \
+-w /go/src/github.com/gopenguin/ldap-proxy \
+golang:1.9 \
+sh -c "apt-get update && apt-get install -y ldap-utils && go test -v -tags compat ./pkg/compat/..."